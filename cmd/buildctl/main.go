@@ -0,0 +1,204 @@
+// Command buildctl provides administrative operations against the build store.
+//
+// Usage:
+//
+//	buildctl export [-o history.ndjson] [-anonymize [-key KEY]]
+//	buildctl import [-i history.ndjson]
+//	buildctl report <file.json[.zst]>
+//	buildctl bench [-jobs 500] [-rate 0] [-projects 3] [-build-time 200ms] [-o report.json]
+//	buildctl onboard [-apply] [-webhook-url URL] [-forks] <org>
+//	buildctl migrate <status|up>
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/bench"
+	"github.com/jorgerua/build-system/container-build-service/internal/buildreport"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"go.uber.org/zap"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		fatal("load config: %v", err)
+	}
+
+	ctx := context.Background()
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "export":
+		err = runExport(ctx, cfg, args)
+	case "import":
+		err = runImport(ctx, cfg, args)
+	case "report":
+		err = runReport(args)
+	case "bench":
+		err = runBench(ctx, cfg, args)
+	case "onboard":
+		err = runOnboard(ctx, cfg, args)
+	case "migrate":
+		err = runMigrate(ctx, cfg, args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal("%s: %v", cmd, err)
+	}
+}
+
+func runExport(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("o", "-", "output file (- for stdout)")
+	anonymize := fs.Bool("anonymize", false, "export only build durations, sizes and outcomes, with hashed identifiers, for external benchmarking")
+	key := fs.String("key", "", "with -anonymize, the secret hashing the identifiers; exports with the same key can be compared (default: random)")
+	_ = fs.Parse(args)
+
+	db, err := tidb.Open(cfg.TiDB.DSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *anonymize {
+		secret := []byte(*key)
+		if len(secret) == 0 {
+			secret = make([]byte, 32)
+			_, _ = rand.Read(secret)
+		}
+		n, err := tidb.ExportAnonymized(ctx, db, w, tidb.NewAnonymizer(secret))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "exported %d anonymized builds\n", n)
+		return nil
+	}
+	n, err := tidb.Export(ctx, db, w)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d records\n", n)
+	return nil
+}
+
+func runImport(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("i", "-", "input file (- for stdin)")
+	_ = fs.Parse(args)
+
+	db, err := tidb.Open(cfg.TiDB.DSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	n, err := tidb.Import(ctx, db, r)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "imported %d records\n", n)
+	return nil
+}
+
+// runReport prints a worker build report as indented JSON, decompressing
+// zstd-compressed reports.
+func runReport(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: buildctl report <file>")
+	}
+	r, err := buildreport.Load(args[0])
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// runBench pushes synthetic jobs through a throwaway JetStream stream with
+// simulated builds and reports throughput and latency percentiles.
+func runBench(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	opts := bench.Options{}
+	fs.IntVar(&opts.Jobs, "jobs", 500, "jobs to publish")
+	fs.Float64Var(&opts.Rate, "rate", 0, "jobs published per second (0 = as fast as possible)")
+	fs.IntVar(&opts.Projects, "projects", 3, "simulated affected projects per job")
+	fs.IntVar(&opts.Concurrency, "concurrency", cfg.Worker.Concurrency, "parallel project builds per job")
+	fs.DurationVar(&opts.BuildTime, "build-time", 200*time.Millisecond, "simulated duration of one project build")
+	fs.IntVar(&opts.MessageBytes, "message-bytes", 0, "commit message size per job, to exercise payload offload")
+	fs.DurationVar(&opts.Timeout, "timeout", 10*time.Minute, "give up waiting for jobs after this long")
+	out := fs.String("o", "", "also write the JSON report to this file")
+	_ = fs.Parse(args)
+	if opts.Jobs < 1 || opts.Projects < 1 {
+		return fmt.Errorf("-jobs and -projects must be at least 1")
+	}
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return err
+	}
+	defer logger.Sync()
+
+	report, runErr := bench.Run(ctx, cfg, opts, logger)
+	if report == nil {
+		return runErr
+	}
+	fmt.Fprint(os.Stderr, report)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	}
+	return runErr
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: buildctl <export|import|report|bench|onboard|migrate> [flags]")
+}
+
+func fatal(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "buildctl: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+)
+
+// runMigrate lists the schema migrations and whether they are applied
+// ("status"), or applies the pending ones ("up"), for operators who run
+// the services with tidb.auto_migrate disabled.
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "up") {
+		return fmt.Errorf("usage: buildctl migrate <status|up>")
+	}
+
+	db, err := tidb.Open(cfg.TiDB.DSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if args[0] == "up" {
+		applied, err := tidb.Migrate(ctx, db)
+		for _, m := range applied {
+			fmt.Fprintf(os.Stderr, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "applied %d migrations\n", len(applied))
+		return nil
+	}
+
+	statuses, err := tidb.MigrationStatuses(ctx, db)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return tw.Flush()
+}
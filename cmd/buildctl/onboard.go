@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	"github.com/jorgerua/build-system/container-build-service/internal/httpclient"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+)
+
+// buildableLanguages maps the GitHub languages the workers build to the
+// detected language; see package detection.
+var buildableLanguages = map[string]string{
+	"Go":                "go",
+	"Java":              "java",
+	"Kotlin":            "java",
+	"C#":                "dotnet",
+	"F#":                "dotnet",
+	"Visual Basic .NET": "dotnet",
+}
+
+// supported returns the buildable languages among a repository's GitHub
+// languages, sorted.
+func supported(langs map[string]int64) []string {
+	var out []string
+	for lang := range langs {
+		if l, ok := buildableLanguages[lang]; ok && !slices.Contains(out, l) {
+			out = append(out, l)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// runOnboard lists the repositories the GitHub App can access in an
+// organization, detects which the workers can build and, with -apply,
+// onboards them. With -webhook-url it also registers a repository webhook
+// signed with a new per-repository secret.
+func runOnboard(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("onboard", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "onboard the buildable repositories (default: only list them)")
+	hookURL := fs.String("webhook-url", cfg.GitHub.WebhookURL, "with -apply, register a webhook to this URL on each onboarded repository")
+	forks := fs.Bool("forks", false, "include forks")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: buildctl onboard [-apply] [-webhook-url URL] <org>")
+	}
+	org := fs.Arg(0)
+
+	httpClient, err := httpclient.New(cfg)
+	if err != nil {
+		return err
+	}
+	gh, err := githubpkg.NewClient(cfg, httpclient.WithTimeout(httpClient, 30*time.Second))
+	if err != nil {
+		return err
+	}
+	installation, err := gh.OrgInstallationID(ctx, org)
+	if err != nil {
+		return err
+	}
+	token, err := gh.GenerateInstallationToken(ctx, installation)
+	if err != nil {
+		return err
+	}
+	installed, err := gh.InstallationRepos(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	db, err := tidb.Open(cfg.TiDB.DSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	repos := tidb.NewRepositoryRepository(db)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tLANGUAGES\tSTATUS")
+	onboarded := 0
+	for _, repo := range installed {
+		if !strings.EqualFold(githubOwner(repo.FullName), org) {
+			continue
+		}
+		status, langs := "", []string(nil)
+		switch {
+		case repo.Archived:
+			status = "archived"
+		case repo.Fork && !*forks:
+			status = "fork"
+		default:
+			status, langs, err = onboardRepo(ctx, gh, repos, token, repo.FullName, *apply, *hookURL)
+			if err != nil {
+				status = strings.TrimPrefix(status+"; error: ", "; ") + err.Error()
+			}
+		}
+		if strings.HasPrefix(status, "onboarded") {
+			onboarded++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", repo.FullName, strings.Join(langs, ","), status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "onboarded %d repositories\n", onboarded)
+	return nil
+}
+
+// onboardRepo detects whether a repository is buildable and, with apply,
+// onboards it with default settings. It returns the repository's status.
+func onboardRepo(ctx context.Context, gh *githubpkg.Client, repos *tidb.RepositoryRepository, token, name string, apply bool, hookURL string) (string, []string, error) {
+	if _, err := repos.Get(ctx, name); err == nil {
+		return "already onboarded", nil, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return "", nil, err
+	}
+	languages, err := gh.Languages(ctx, token, name)
+	if err != nil {
+		return "", nil, err
+	}
+	langs := supported(languages)
+	switch {
+	case len(langs) == 0:
+		return "unsupported", nil, nil
+	case !apply:
+		return "buildable", langs, nil
+	}
+	if _, err := repos.Put(ctx, name, tidb.RepositorySettings{}); err != nil {
+		return "", langs, err
+	}
+	if hookURL == "" {
+		return "onboarded", langs, nil
+	}
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	hexSecret := hex.EncodeToString(secret)
+	if err := repos.RotateWebhookSecret(ctx, name, hexSecret); err != nil {
+		return "onboarded, webhook secret not stored", langs, err
+	}
+	if _, err := gh.EnsureWebhook(ctx, token, name, hookURL, hexSecret); err != nil {
+		return "onboarded, webhook not created", langs, err
+	}
+	return "onboarded", langs, nil
+}
+
+func githubOwner(fullName string) string {
+	owner, _, _ := strings.Cut(fullName, "/")
+	return owner
+}
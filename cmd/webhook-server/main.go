@@ -1,10 +1,21 @@
 package main
 
 import (
+	"github.com/jorgerua/build-system/container-build-service/internal/api"
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
 	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/debug"
+	"github.com/jorgerua/build-system/container-build-service/internal/eta"
+	"github.com/jorgerua/build-system/container-build-service/internal/events"
+	"github.com/jorgerua/build-system/container-build-service/internal/freeze"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	"github.com/jorgerua/build-system/container-build-service/internal/httpclient"
+	"github.com/jorgerua/build-system/container-build-service/internal/idempotency"
 	"github.com/jorgerua/build-system/container-build-service/internal/logging"
 	"github.com/jorgerua/build-system/container-build-service/internal/metrics"
 	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/jorgerua/build-system/container-build-service/internal/selfcheck"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
 	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
 	"go.uber.org/fx"
 )
@@ -14,8 +25,33 @@ func main() {
 		config.Module,
 		logging.Module,
 		metrics.Module,
-		natspkg.Module,
+		httpclient.Module,
+		auth.Module,
+		natspkg.LazyModule,
+		events.Module,
+		tidb.Module,
 		webhook.Module,
-		fx.Provide(natspkg.NewPublisher),
+		api.Module,
+		freeze.Module,
+		eta.Module,
+		selfcheck.Module,
+		debug.Module,
+		fx.Provide(
+			natspkg.NewPublisher,
+			natspkg.NewQueue,
+			githubpkg.NewRegistrar,
+			idempotency.New,
+			metrics.NewWebhookMetrics,
+			tidb.NewBuildRecordRepository,
+			tidb.NewAnnotationRepository,
+			tidb.NewRepositoryRepository,
+			tidb.NewBuildNumberRepository,
+			tidb.NewSkippedBuildRepository,
+			tidb.NewCacheSnapshotRepository,
+			tidb.NewHeldBuildRepository,
+			tidb.NewWarmImageRepository,
+			tidb.NewIdempotencyKeyRepository,
+			tidb.NewOrgBuildConfigRepository,
+		),
 	).Run()
 }
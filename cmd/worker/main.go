@@ -2,15 +2,33 @@ package main
 
 import (
 	"context"
+	"time"
 
+	"github.com/jorgerua/build-system/container-build-service/internal/admission"
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/autoscale"
 	buildahpkg "github.com/jorgerua/build-system/container-build-service/internal/buildah"
+	"github.com/jorgerua/build-system/container-build-service/internal/cachestats"
+	"github.com/jorgerua/build-system/container-build-service/internal/clock"
 	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/debug"
+	"github.com/jorgerua/build-system/container-build-service/internal/diagnosis"
+	"github.com/jorgerua/build-system/container-build-service/internal/events"
+	"github.com/jorgerua/build-system/container-build-service/internal/evictguard"
 	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	"github.com/jorgerua/build-system/container-build-service/internal/httpclient"
 	"github.com/jorgerua/build-system/container-build-service/internal/logging"
 	"github.com/jorgerua/build-system/container-build-service/internal/metrics"
 	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
 	"github.com/jorgerua/build-system/container-build-service/internal/orchestrator"
+	"github.com/jorgerua/build-system/container-build-service/internal/preflight"
+	"github.com/jorgerua/build-system/container-build-service/internal/procgroup"
+	"github.com/jorgerua/build-system/container-build-service/internal/registryauth"
+	"github.com/jorgerua/build-system/container-build-service/internal/retention"
+	"github.com/jorgerua/build-system/container-build-service/internal/selfcheck"
 	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/toolchain"
+	"github.com/jorgerua/build-system/container-build-service/internal/warmimages"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
@@ -19,29 +37,76 @@ func main() {
 	fx.New(
 		config.Module,
 		logging.Module,
+		clock.Module,
+		httpclient.Module,
+		toolchain.Module,
+		registryauth.Module,
+		auth.Module,
 		metrics.Module,
 		natspkg.Module,
+		events.Module,
 		githubpkg.Module,
 		tidb.Module,
 		fx.Provide(
 			tidb.NewVersionRepository,
 			tidb.NewBuildStateRepository,
 			tidb.NewBuildRecordRepository,
+			tidb.NewSkippedBuildRepository,
+			tidb.NewCacheSnapshotRepository,
+			tidb.NewWarmImageRepository,
+			tidb.NewOrgBuildConfigRepository,
 			natspkg.NewSubscriber,
 			buildahpkg.New,
+			metrics.NewBuildMetrics,
+			diagnosis.NewClassifier,
 			orchestrator.New,
+			preflight.New,
+			func(o *orchestrator.Orchestrator) autoscale.LoadSource { return o },
+			func(o *orchestrator.Orchestrator) cachestats.StatsSource { return o },
+			func(o *orchestrator.Orchestrator) warmimages.UsageSource { return o },
+			func(o *orchestrator.Orchestrator) evictguard.JobSource { return o },
+			func(s *natspkg.Subscriber) admission.Intake { return s },
 		),
-		fx.Invoke(func(lc fx.Lifecycle, orch *orchestrator.Orchestrator, logger *zap.Logger) {
+		retention.Module,
+		cachestats.Module,
+		warmimages.Module,
+		admission.Module,
+		autoscale.Module,
+		evictguard.Module,
+		selfcheck.Module,
+		debug.WorkerModule,
+		fx.Invoke(func(lc fx.Lifecycle, logger *zap.Logger) {
+			var stop func()
+			lc.Append(fx.Hook{
+				OnStart: func(context.Context) error {
+					stop = procgroup.StartReaper(logger)
+					return nil
+				},
+				OnStop: func(context.Context) error {
+					stop()
+					return nil
+				},
+			})
+		}),
+		fx.Invoke(func(lc fx.Lifecycle, orch *orchestrator.Orchestrator, checks *preflight.Checker, logger *zap.Logger) {
 			lc.Append(fx.Hook{
 				OnStart: func(ctx context.Context) error {
 					go func() {
+						// Jobs are only consumed once the worker can build them.
+						if err := checks.Wait(context.Background()); err != nil {
+							return
+						}
 						if err := orch.Run(context.Background()); err != nil {
 							logger.Error("orchestrator stopped", zap.Error(err))
 						}
 					}()
 					return nil
 				},
+				// Applies worker.shutdown_policy to running builds.
+				OnStop: orch.Shutdown,
 			})
 		}),
+		// Room for the longest shutdown wait, plus requeueing what is left.
+		fx.StopTimeout(time.Duration(config.MaxShutdownWaitMinutes+2)*time.Minute),
 	).Run()
 }
@@ -0,0 +1,202 @@
+// Package admission holds a worker's job intake while its host runs short
+// of disk or memory ("backpressure"), so a saturated host finishes its
+// running builds instead of failing new ones and dragging down the jobs
+// retried elsewhere. The latest state is published as the "admission"
+// expvar and in the autoscaling signal.
+package admission
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	metricspkg "github.com/jorgerua/build-system/container-build-service/internal/metrics"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Intake is the job intake the Monitor holds; see nats.Subscriber.Hold.
+type Intake interface {
+	Hold()
+	Release()
+}
+
+// State is the worker's admission state. Unknown percentages are -1.
+type State struct {
+	Status string `json:"status"` // "ok" or "backpressure"
+	Reason string `json:"reason,omitempty"`
+	// DiskFreePercent is the lowest free share of the watched directories.
+	DiskFreePercent        float64   `json:"disk_free_percent"`
+	MemoryAvailablePercent float64   `json:"memory_available_percent"`
+	Time                   time.Time `json:"time"`
+}
+
+// Backpressure reports whether intake is held.
+func (s State) Backpressure() bool { return s.Status == StatusBackpressure }
+
+const (
+	StatusOK           = "ok"
+	StatusBackpressure = "backpressure"
+)
+
+var (
+	latest      atomic.Pointer[State]
+	publishOnce sync.Once
+)
+
+// Monitor samples the host's free disk and memory and holds the intake
+// while either is below its threshold.
+type Monitor struct {
+	cfg    config.AdmissionConfig
+	dirs   []string
+	intake Intake
+	bm     *metricspkg.BuildMetrics
+	logger *zap.Logger
+
+	state atomic.Pointer[State]
+}
+
+// New creates a Monitor and schedules it on the fx lifecycle.
+func New(cfg *config.Config, intake Intake, bm *metricspkg.BuildMetrics, logger *zap.Logger, lc fx.Lifecycle) *Monitor {
+	m := &Monitor{
+		cfg:    cfg.Admission,
+		intake: intake,
+		bm:     bm,
+		logger: logger.Named("admission"),
+	}
+	for _, dir := range []string{cfg.Buildah.StorageRoot, cfg.Buildah.CacheMountDir, cfg.Worker.WorkspaceDir, cfg.Worker.GitMirrorDir} {
+		if dir != "" && !slices.Contains(m.dirs, dir) {
+			m.dirs = append(m.dirs, dir)
+		}
+	}
+	publishOnce.Do(func() {
+		expvar.Publish("admission", expvar.Func(func() any { return latest.Load() }))
+	})
+	if m.cfg.IntervalSeconds <= 0 {
+		return m
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			go func() {
+				defer close(done)
+				m.loop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			cancel()
+			<-done
+			return nil
+		},
+	})
+	return m
+}
+
+// State returns the latest admission state; "ok" before the first sample
+// and on a nil Monitor.
+func (m *Monitor) State() State {
+	if m == nil {
+		return State{Status: StatusOK, DiskFreePercent: -1, MemoryAvailablePercent: -1}
+	}
+	if s := m.state.Load(); s != nil {
+		return *s
+	}
+	return State{Status: StatusOK, DiskFreePercent: -1, MemoryAvailablePercent: -1}
+}
+
+func (m *Monitor) loop(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(m.cfg.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	m.check(m.sample())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.check(m.sample())
+		}
+	}
+}
+
+// sample measures the watched directories and memory.
+func (m *Monitor) sample() State {
+	s := State{DiskFreePercent: -1, Time: time.Now().UTC()}
+	for _, dir := range m.dirs {
+		free, err := diskFreePercent(dir)
+		if err != nil {
+			m.logger.Debug("disk usage unavailable", zap.String("dir", dir), zap.Error(err))
+			continue
+		}
+		if free >= 0 && (s.DiskFreePercent < 0 || free < s.DiskFreePercent) {
+			s.DiskFreePercent = free
+		}
+	}
+	s.MemoryAvailablePercent = memoryAvailablePercent()
+	return s
+}
+
+// check applies a sample: it holds or releases the intake when the state
+// changes.
+func (m *Monitor) check(s State) {
+	prev := m.State()
+	s.Status, s.Reason = StatusOK, ""
+	if pressured, reason := evaluate(m.cfg, prev.Backpressure(), s.DiskFreePercent, s.MemoryAvailablePercent); pressured {
+		s.Status, s.Reason = StatusBackpressure, reason
+	}
+	m.state.Store(&s)
+	latest.Store(&s)
+	m.bm.HostPressure(s.DiskFreePercent, s.MemoryAvailablePercent, s.Backpressure())
+
+	switch {
+	case s.Backpressure() && !prev.Backpressure():
+		m.logger.Warn("backpressure: no new jobs taken",
+			zap.String("reason", s.Reason),
+			zap.Float64("disk_free_percent", s.DiskFreePercent),
+			zap.Float64("memory_available_percent", s.MemoryAvailablePercent),
+		)
+		m.intake.Hold()
+	case !s.Backpressure() && prev.Backpressure():
+		m.logger.Info("backpressure cleared: taking jobs again",
+			zap.Float64("disk_free_percent", s.DiskFreePercent),
+			zap.Float64("memory_available_percent", s.MemoryAvailablePercent),
+		)
+		m.intake.Release()
+	}
+}
+
+// evaluate decides whether intake is held. Once held, both resources must
+// recover HysteresisPercent past their thresholds, so intake does not flap
+// around them. Unknown (negative) measurements never hold intake.
+func evaluate(cfg config.AdmissionConfig, held bool, diskFree, memAvailable float64) (bool, string) {
+	margin := 0.0
+	if held {
+		margin = float64(cfg.HysteresisPercent)
+	}
+	for _, r := range []struct {
+		name      string
+		value     float64
+		threshold int
+	}{
+		{"disk", diskFree, cfg.MinFreeDiskPercent},
+		{"memory", memAvailable, cfg.MinAvailableMemoryPercent},
+	} {
+		if r.value >= 0 && r.threshold > 0 && r.value < float64(r.threshold)+margin {
+			return true, fmt.Sprintf("%s %.1f%% free, below %d%%", r.name, r.value, r.threshold)
+		}
+	}
+	return false, ""
+}
+
+// Module provides and starts the Monitor via fx.
+var Module = fx.Module("admission",
+	fx.Provide(New),
+	fx.Invoke(func(*Monitor) {}),
+)
@@ -0,0 +1,68 @@
+package admission
+
+import (
+	"testing"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	metricspkg "github.com/jorgerua/build-system/container-build-service/internal/metrics"
+	"go.uber.org/zap"
+)
+
+type fakeIntake struct{ holds, releases int }
+
+func (f *fakeIntake) Hold()    { f.holds++ }
+func (f *fakeIntake) Release() { f.releases++ }
+
+func TestMonitorCheck(t *testing.T) {
+	intake := &fakeIntake{}
+	m := &Monitor{
+		cfg:    config.AdmissionConfig{MinFreeDiskPercent: 10, MinAvailableMemoryPercent: 10, HysteresisPercent: 5},
+		intake: intake,
+		bm:     metricspkg.NewBuildMetrics(&statsd.NoOpClient{}),
+		logger: zap.NewNop(),
+	}
+	if s := m.State(); s.Backpressure() {
+		t.Fatalf("initial state = %+v", s)
+	}
+	steps := []struct {
+		disk, mem float64
+		want      bool
+	}{
+		{50, 50, false},
+		{8, 50, true},  // disk below 10%
+		{12, 50, true}, // above the threshold, within the hysteresis
+		{16, 9, true},  // disk recovered, memory short
+		{16, -1, false},
+		{-1, -1, false}, // unknown never holds
+	}
+	for i, step := range steps {
+		m.check(State{DiskFreePercent: step.disk, MemoryAvailablePercent: step.mem})
+		if got := m.State(); got.Backpressure() != step.want {
+			t.Fatalf("step %d: state = %+v; want backpressure %v", i, got, step.want)
+		}
+	}
+	if intake.holds != 1 || intake.releases != 1 {
+		t.Errorf("holds = %d, releases = %d; want 1, 1", intake.holds, intake.releases)
+	}
+	if (*Monitor)(nil).State().Status != StatusOK {
+		t.Error("a nil Monitor must report ok")
+	}
+}
+
+func TestMemoryAvailablePercent(t *testing.T) {
+	meminfo := []byte("MemTotal:       16000000 kB\nMemFree:         1000000 kB\nMemAvailable:    4000000 kB\n")
+	if got := meminfoAvailablePercent(meminfo); got != 25 {
+		t.Errorf("meminfo = %v; want 25", got)
+	}
+	stat := []byte("anon 600\nfile 400\ninactive_file 200\n")
+	if got := cgroupAvailablePercent([]byte("1000\n"), []byte("1000\n"), stat); got != 20 {
+		t.Errorf("cgroup = %v; want 20", got)
+	}
+	if got := cgroupAvailablePercent([]byte("max\n"), []byte("1000\n"), stat); got != -1 {
+		t.Errorf("cgroup without limit = %v; want -1", got)
+	}
+	if got := meminfoAvailablePercent(nil); got != -1 {
+		t.Errorf("empty meminfo = %v; want -1", got)
+	}
+}
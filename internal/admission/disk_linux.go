@@ -0,0 +1,16 @@
+package admission
+
+import "syscall"
+
+// diskFreePercent returns the share of dir's filesystem available to
+// unprivileged users, or -1 when unknown.
+func diskFreePercent(dir string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return -1, err
+	}
+	if st.Blocks == 0 {
+		return -1, nil
+	}
+	return 100 * float64(st.Bavail) / float64(st.Blocks), nil
+}
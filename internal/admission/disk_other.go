@@ -0,0 +1,8 @@
+//go:build !linux
+
+package admission
+
+// diskFreePercent reports unknown outside Linux; services only run on Linux.
+func diskFreePercent(string) (float64, error) {
+	return -1, nil
+}
@@ -0,0 +1,72 @@
+package admission
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// memoryAvailablePercent returns the available share of the container's
+// cgroup v2 memory limit or, without one, of the host's memory; -1 when
+// unknown.
+func memoryAvailablePercent() float64 {
+	if limit, err := os.ReadFile("/sys/fs/cgroup/memory.max"); err == nil {
+		current, err1 := os.ReadFile("/sys/fs/cgroup/memory.current")
+		stat, err2 := os.ReadFile("/sys/fs/cgroup/memory.stat")
+		if err1 == nil && err2 == nil {
+			if p := cgroupAvailablePercent(limit, current, stat); p >= 0 {
+				return p
+			}
+		}
+	}
+	meminfo, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return -1
+	}
+	return meminfoAvailablePercent(meminfo)
+}
+
+// cgroupAvailablePercent computes the available share of a cgroup v2
+// memory limit. The inactive page cache can be reclaimed, so it counts as
+// available. It returns -1 without a limit.
+func cgroupAvailablePercent(limit, current, stat []byte) float64 {
+	max, err := strconv.ParseInt(strings.TrimSpace(string(limit)), 10, 64)
+	if err != nil || max <= 0 { // "max": no limit
+		return -1
+	}
+	used, err := strconv.ParseInt(strings.TrimSpace(string(current)), 10, 64)
+	if err != nil {
+		return -1
+	}
+	used -= field(stat, "inactive_file")
+	return clampPercent(100 * float64(max-used) / float64(max))
+}
+
+// meminfoAvailablePercent computes MemAvailable over MemTotal from
+// /proc/meminfo.
+func meminfoAvailablePercent(meminfo []byte) float64 {
+	total, available := field(meminfo, "MemTotal:"), field(meminfo, "MemAvailable:")
+	if total <= 0 {
+		return -1
+	}
+	return clampPercent(100 * float64(available) / float64(total))
+}
+
+// field returns the number following name at the start of a line, or 0.
+func field(data []byte, name string) int64 {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == name {
+			n, _ := strconv.ParseInt(fields[1], 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+func clampPercent(p float64) float64 {
+	return min(max(p, 0), 100)
+}
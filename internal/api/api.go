@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/fx"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// Module registers the query API routes on the webhook-server mux.
+var Module = fx.Module("api",
+	fx.Provide(
+		webhook.AsRoute(NewProvenanceRoute),
+		webhook.AsRoute(NewConfigRoute),
+		webhook.AsRoute(NewBuildStatusRoute),
+		webhook.AsRoute(NewAnnotationRoute),
+		webhook.AsRoute(NewBuildDeleteRoute),
+		webhook.AsRoute(NewBuildArchiveRoute),
+		webhook.AsRoute(NewBuildRestoreRoute),
+		webhook.AsRoute(NewFeedRoute),
+		webhook.AsRoute(NewRepositoryListRoute),
+		webhook.AsRoute(NewRepositoryGetRoute),
+		webhook.AsRoute(NewRepositoryPutRoute),
+		webhook.AsRoute(NewRepositoryDeleteRoute),
+		webhook.AsRoute(NewWebhookSecretPutRoute),
+		webhook.AsRoute(NewWebhookSecretDeleteRoute),
+		webhook.AsRoute(NewOrgBuildConfigGetRoute),
+		webhook.AsRoute(NewOrgBuildConfigPutRoute),
+		webhook.AsRoute(NewOrgBuildConfigDeleteRoute),
+		webhook.AsRoute(NewUsageRoute),
+		webhook.AsRoute(NewThroughputRoute),
+		webhook.AsRoute(NewFlakinessRoute),
+		webhook.AsRoute(NewCacheTrendRoute),
+		webhook.AsRoute(NewWarmImagesRoute),
+		webhook.AsRoute(NewQueueRoute),
+		webhook.AsRoute(NewQueuePauseGetRoute),
+		webhook.AsRoute(NewQueuePausePutRoute),
+		webhook.AsRoute(NewQueuePauseDeleteRoute),
+		webhook.AsRoute(NewSkipListRoute),
+		webhook.AsRoute(NewBuildsCancelRoute),
+		webhook.AsRoute(NewBuildsRequeueRoute),
+		webhook.AsRoute(NewFreezeRoute),
+	),
+)
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/eta"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+// maxAnnotationBytes bounds a single annotation body.
+const maxAnnotationBytes = 4096
+
+// buildStatus is the GET /builds/{id} response.
+type buildStatus struct {
+	*tidb.Provenance
+	Annotations []tidb.Annotation `json:"annotations"`
+}
+
+// queuedBuild is the GET /builds/{id} response for a job still queued.
+type queuedBuild struct {
+	Status string `json:"status"` // "queued"
+	eta.Estimate
+}
+
+// NewBuildStatusRoute serves GET /builds/{id}: a build record with its
+// annotations. Given the ID of a job no worker has received yet, it serves
+// the job's queue position and estimated start time instead.
+func NewBuildStatusRoute(buildRec *tidb.BuildRecordRepository, annotations *tidb.AnnotationRepository, estimator *eta.Estimator, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if jobID := r.PathValue("id"); !isNumeric(jobID) {
+			est, ok, err := estimator.Job(r.Context(), jobID)
+			switch {
+			case err != nil:
+				logger.Error("queued job lookup failed", zap.Error(err), zap.String("job_id", jobID))
+				writeError(w, http.StatusServiceUnavailable, "queue unavailable")
+			case !ok:
+				writeError(w, http.StatusNotFound, "build not found")
+			default:
+				writeJSON(w, http.StatusOK, queuedBuild{Status: "queued", Estimate: est})
+			}
+			return
+		}
+		id, ok := buildID(w, r)
+		if !ok {
+			return
+		}
+		build, err := buildRec.FindByID(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "build not found")
+			return
+		}
+		if err != nil {
+			logger.Error("build lookup failed", zap.Error(err), zap.Int64("build_id", id))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		notes, err := annotations.List(r.Context(), id)
+		if err != nil {
+			logger.Error("annotation lookup failed", zap.Error(err), zap.Int64("build_id", id))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, buildStatus{Provenance: build, Annotations: notes})
+	})
+	return webhook.Route{
+		Pattern: "GET /builds/{id}",
+		Handler: authn.Require(auth.RoleViewer, h),
+	}
+}
+
+// NewAnnotationRoute serves POST /builds/{id}/annotations, attaching a note
+// authored by the caller to a build for post-incident review.
+func NewAnnotationRoute(buildRec *tidb.BuildRecordRepository, annotations *tidb.AnnotationRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := buildID(w, r)
+		if !ok {
+			return
+		}
+		var req struct {
+			Body string `json:"body"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxAnnotationBytes)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		req.Body = strings.TrimSpace(req.Body)
+		if req.Body == "" || len(req.Body) > maxAnnotationBytes {
+			writeError(w, http.StatusBadRequest, "body must be 1-4096 bytes")
+			return
+		}
+
+		if _, err := buildRec.FindByID(r.Context(), id); errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "build not found")
+			return
+		} else if err != nil {
+			logger.Error("build lookup failed", zap.Error(err), zap.Int64("build_id", id))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+
+		p, _ := auth.PrincipalFrom(r.Context())
+		note, err := annotations.Add(r.Context(), id, p.Subject, req.Body)
+		if err != nil {
+			logger.Error("add annotation failed", zap.Error(err), zap.Int64("build_id", id))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusCreated, note)
+	})
+	return webhook.Route{
+		Pattern: "POST /builds/{id}/annotations",
+		Handler: authn.Require(auth.RoleTrigger, h),
+	}
+}
+
+// buildID parses the {id} path value, writing a 400 when it is invalid.
+func buildID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid build id")
+		return 0, false
+	}
+	return id, true
+}
+
+// isNumeric reports whether s is made of digits only, like build IDs; job
+// IDs are ULIDs.
+func isNumeric(s string) bool {
+	return strings.Trim(s, "0123456789") == ""
+}
+
+// NewBuildDeleteRoute serves DELETE /builds/{id}: soft-deletes a build, for
+// data removal requests. The build disappears from every lookup and listing
+// and is purged after retention.deleted_record_days unless restored. A build
+// still pending is not found.
+func NewBuildDeleteRoute(buildRec *tidb.BuildRecordRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	return buildLifecycleRoute("DELETE /builds/{id}", "build deleted", buildRec.SoftDelete, authn, logger)
+}
+
+// NewBuildArchiveRoute serves POST /builds/{id}/archive: keeps a completed
+// build past the retention ages, hidden from repository listings.
+func NewBuildArchiveRoute(buildRec *tidb.BuildRecordRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	return buildLifecycleRoute("POST /builds/{id}/archive", "build archived", buildRec.Archive, authn, logger)
+}
+
+// NewBuildRestoreRoute serves POST /builds/{id}/restore: undoes a delete or
+// archive that retention has not purged yet.
+func NewBuildRestoreRoute(buildRec *tidb.BuildRecordRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	return buildLifecycleRoute("POST /builds/{id}/restore", "build restored", buildRec.Restore, authn, logger)
+}
+
+// buildLifecycleRoute serves an admin-only change to a build's lifecycle,
+// answering 404 when update reports sql.ErrNoRows.
+func buildLifecycleRoute(pattern, msg string, update func(context.Context, int64) error, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := buildID(w, r)
+		if !ok {
+			return
+		}
+		err := update(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "build not found")
+			return
+		}
+		if err != nil {
+			logger.Error("build update failed", zap.Error(err), zap.Int64("build_id", id), zap.String("route", pattern))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		p, _ := auth.PrincipalFrom(r.Context())
+		logger.Info(msg, zap.Int64("build_id", id), zap.String("by", p.Subject))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return webhook.Route{
+		Pattern: pattern,
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
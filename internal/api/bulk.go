@@ -0,0 +1,272 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	"github.com/jorgerua/build-system/container-build-service/internal/idempotency"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultRequeueAgeMinutes is how far back requeue looks without
+	// max_age_minutes; the stream may keep months of processed jobs.
+	defaultRequeueAgeMinutes = 60
+	maxBulkAgeMinutes        = 7 * 24 * 60
+)
+
+// bulkFilter selects the jobs of a bulk action. Empty fields match every
+// job; ages are measured from when the job was queued.
+type bulkFilter struct {
+	Repo          string `json:"repo"`   // "owner/name"
+	Branch        string `json:"branch"` // pushed or pull request head branch
+	Status        string `json:"status"`
+	MinAgeMinutes int    `json:"min_age_minutes"`
+	MaxAgeMinutes int    `json:"max_age_minutes"`
+	DryRun        bool   `json:"dry_run"`
+}
+
+// matches reports whether j passes the filter's repo, branch and minimum
+// age; the maximum age bounds the scan itself.
+func (f bulkFilter) matches(j natspkg.StreamJob, now time.Time) bool {
+	if f.Repo != "" && githubpkg.RepoFullName(j.Job.RepoURL) != f.Repo {
+		return false
+	}
+	if f.Branch != "" && j.Job.Branch != f.Branch {
+		return false
+	}
+	return now.Sub(j.QueuedAt) >= time.Duration(f.MinAgeMinutes)*time.Minute
+}
+
+// since returns the oldest queue time the scan reaches, or the zero time.
+func (f bulkFilter) since(now time.Time) time.Time {
+	if f.MaxAgeMinutes == 0 {
+		return time.Time{}
+	}
+	return now.Add(-time.Duration(f.MaxAgeMinutes) * time.Minute)
+}
+
+// bulkJob is one job affected by a bulk action.
+type bulkJob struct {
+	ID          string    `json:"id"`
+	Repo        string    `json:"repo"`
+	Branch      string    `json:"branch,omitempty"`
+	SHA         string    `json:"sha"`
+	QueuedAt    time.Time `json:"queued_at"`
+	RequeuedAs  string    `json:"requeued_as,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	BuildNumber int64     `json:"build_number,omitempty"`
+}
+
+func newBulkJob(j natspkg.StreamJob) bulkJob {
+	return bulkJob{
+		ID:          j.Job.EffectiveID(),
+		Repo:        githubpkg.RepoFullName(j.Job.RepoURL),
+		Branch:      j.Job.Branch,
+		SHA:         j.Job.SHA,
+		QueuedAt:    j.QueuedAt,
+		BuildNumber: j.Job.BuildNumber,
+	}
+}
+
+// bulkResponse is the response of the bulk actions.
+type bulkResponse struct {
+	DryRun bool      `json:"dry_run"`
+	Jobs   []bulkJob `json:"jobs"`
+}
+
+// decodeBulkFilter reads the request's filter, writing a 400 when it is
+// invalid. status must be one of statuses; the first is the default.
+func decodeBulkFilter(w http.ResponseWriter, r *http.Request, statuses ...string) (bulkFilter, bool) {
+	var f bulkFilter
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return f, false
+	}
+	if f.Status == "" {
+		f.Status = statuses[0]
+	}
+	valid := false
+	for _, s := range statuses {
+		valid = valid || f.Status == s
+	}
+	switch {
+	case !valid:
+		writeError(w, http.StatusBadRequest, "unsupported status "+f.Status)
+	case f.MinAgeMinutes < 0 || f.MaxAgeMinutes < 0 || f.MinAgeMinutes > maxBulkAgeMinutes || f.MaxAgeMinutes > maxBulkAgeMinutes:
+		writeError(w, http.StatusBadRequest, "ages must be 0-10080 minutes")
+	case f.MaxAgeMinutes > 0 && f.MinAgeMinutes > f.MaxAgeMinutes:
+		writeError(w, http.StatusBadRequest, "min_age_minutes exceeds max_age_minutes")
+	default:
+		return f, true
+	}
+	return f, false
+}
+
+// NewBuildsCancelRoute serves POST /builds/cancel: removes the queued jobs
+// matching a filter ({"repo", "branch", "min_age_minutes",
+// "max_age_minutes"}) from the stream, such as everything queued for a
+// broken repository during an incident. Only jobs no worker has received
+// are cancelled; status is "queued", the default. With "dry_run": true the
+// jobs are listed without being removed.
+func NewBuildsCancelRoute(queue *natspkg.Queue, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := decodeBulkFilter(w, r, "queued")
+		if !ok {
+			return
+		}
+		now := time.Now()
+		jobs, err := queue.Jobs(r.Context(), f.since(now), true)
+		if err != nil {
+			logger.Error("queued jobs lookup failed", zap.Error(err))
+			writeError(w, http.StatusServiceUnavailable, "queue unavailable")
+			return
+		}
+		resp := bulkResponse{DryRun: f.DryRun, Jobs: []bulkJob{}}
+		for _, j := range jobs {
+			if !f.matches(j, now) {
+				continue
+			}
+			out := newBulkJob(j)
+			if !f.DryRun {
+				if err := queue.Remove(r.Context(), j.Seq); err != nil {
+					logger.Error("cancel job failed", zap.String("job_id", out.ID), zap.Error(err))
+					out.Error = "cancel failed"
+				}
+			}
+			resp.Jobs = append(resp.Jobs, out)
+		}
+		p, _ := auth.PrincipalFrom(r.Context())
+		logger.Warn("bulk cancel",
+			zap.String("by", p.Subject),
+			zap.Any("filter", f),
+			zap.Int("jobs", len(resp.Jobs)),
+		)
+		writeJSON(w, http.StatusOK, resp)
+	})
+	return webhook.Route{
+		Pattern: "POST /builds/cancel",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
+
+// NewBuildsRequeueRoute serves POST /builds/requeue: queues again, as new
+// jobs, the processed jobs matching a filter whose commit has a failed
+// build, such as the builds failed by a registry outage. status is
+// "failure", the default; max_age_minutes defaults to 60. A commit queued
+// several times is requeued once. The commit's failed and expired build
+// records are reopened and the job is published as a requeue of just
+// their projects, which the worker builds although it has processed the
+// commit before. With "dry_run": true the jobs are listed
+// without being queued. With an Idempotency-Key header, a retried request
+// replays the first response instead of requeueing again.
+func NewBuildsRequeueRoute(queue *natspkg.Queue, publisher *natspkg.Publisher, payloads *natspkg.PayloadStore, buildRec *tidb.BuildRecordRepository, keys *idempotency.Keys, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := decodeBulkFilter(w, r, "failure")
+		if !ok {
+			return
+		}
+		if f.MaxAgeMinutes == 0 {
+			f.MaxAgeMinutes = max(defaultRequeueAgeMinutes, f.MinAgeMinutes)
+		}
+		now := time.Now()
+		jobs, err := queue.Jobs(r.Context(), f.since(now), false)
+		if err != nil {
+			logger.Error("stream jobs lookup failed", zap.Error(err))
+			writeError(w, http.StatusServiceUnavailable, "queue unavailable")
+			return
+		}
+
+		// Newest job per commit, leaving out commits still queued.
+		seen := map[string]bool{}
+		var candidates []natspkg.StreamJob
+		var shas []string
+		for _, j := range jobs {
+			key := githubpkg.RepoFullName(j.Job.RepoURL) + "@" + j.Job.SHA
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if j.Waiting || !f.matches(j, now) {
+				continue
+			}
+			candidates = append(candidates, j)
+			shas = append(shas, j.Job.SHA)
+		}
+		failed, err := buildRec.FailedCommits(r.Context(), shas)
+		if err != nil {
+			logger.Error("failed commits lookup failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+
+		resp := bulkResponse{DryRun: f.DryRun, Jobs: []bulkJob{}}
+		for _, j := range candidates {
+			if !failed[j.Job.SHA] {
+				continue
+			}
+			out := newBulkJob(j)
+			if !f.DryRun {
+				id, err := requeue(r.Context(), publisher, payloads, buildRec, j.Job)
+				switch {
+				case errors.Is(err, errNothingReopened):
+					out.Error = "already requeued"
+				case err != nil:
+					logger.Error("requeue job failed", zap.String("job_id", out.ID), zap.Error(err))
+					out.Error = "requeue failed"
+				}
+				out.RequeuedAs = id
+			}
+			resp.Jobs = append(resp.Jobs, out)
+		}
+		p, _ := auth.PrincipalFrom(r.Context())
+		logger.Warn("bulk requeue",
+			zap.String("by", p.Subject),
+			zap.Any("filter", f),
+			zap.Int("jobs", len(resp.Jobs)),
+		)
+		writeJSON(w, http.StatusOK, resp)
+	})
+	return webhook.Route{
+		Pattern: "POST /builds/requeue",
+		Handler: authn.Require(auth.RoleAdmin, keys.Wrap(h)),
+	}
+}
+
+// errNothingReopened is returned by requeue when the commit has no failed
+// or expired build left, such as after a concurrent requeue.
+var errNothingReopened = errors.New("no failed build to reopen")
+
+// requeue reopens the failed builds of job's commit and publishes job
+// again under a new ID as a requeue of their projects, restoring offloaded
+// commit messages first. It keeps the job's build number.
+func requeue(ctx context.Context, publisher *natspkg.Publisher, payloads *natspkg.PayloadStore, buildRec *tidb.BuildRecordRepository, job natspkg.BuildJob) (string, error) {
+	if err := payloads.Resolve(ctx, &job); err != nil {
+		return "", err
+	}
+	projects, err := buildRec.Reopen(ctx, githubpkg.RepoFullName(job.RepoURL), job.SHA)
+	if err != nil {
+		return "", err
+	}
+	if len(projects) == 0 {
+		return "", errNothingReopened
+	}
+	return publisher.Publish(ctx, requeueJob(job, projects))
+}
+
+// requeueJob returns job as a requeue that rebuilds projects.
+func requeueJob(job natspkg.BuildJob, projects []string) natspkg.BuildJob {
+	job.ID, job.PublishedAt = "", time.Time{}
+	job.Requeue = true
+	job.Directives = &natspkg.Directives{Build: projects}
+	return job
+}
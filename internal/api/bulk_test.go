@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+)
+
+func TestBulkFilter(t *testing.T) {
+	decode := func(body string) (bulkFilter, int) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/builds/cancel", strings.NewReader(body))
+		f, _ := decodeBulkFilter(w, r, "queued")
+		return f, w.Code
+	}
+	f, code := decode(`{"repo":"acme/shop","branch":"main","min_age_minutes":10,"max_age_minutes":60,"dry_run":true}`)
+	if code != 200 || f.Status != "queued" || !f.DryRun {
+		t.Fatalf("filter = %+v (%d)", f, code)
+	}
+	if f, code := decode(""); code != 200 || f.Status != "queued" {
+		t.Errorf("empty body = %+v (%d)", f, code)
+	}
+	for _, body := range []string{`{"status":"failure"}`, `{"min_age_minutes":-1}`, `{"min_age_minutes":20,"max_age_minutes":10}`, `{`} {
+		if _, code := decode(body); code != 400 {
+			t.Errorf("decode(%s) = %d; want 400", body, code)
+		}
+	}
+
+	now := time.Now()
+	job := func(url, branch string, age time.Duration) natspkg.StreamJob {
+		return natspkg.StreamJob{QueuedAt: now.Add(-age), Job: natspkg.BuildJob{RepoURL: url, Branch: branch}}
+	}
+	for _, tc := range []struct {
+		job  natspkg.StreamJob
+		want bool
+	}{
+		{job("https://github.com/acme/shop.git", "main", 30*time.Minute), true},
+		{job("https://github.com/acme/shop.git", "dev", 30*time.Minute), false},
+		{job("https://github.com/acme/cart.git", "main", 30*time.Minute), false},
+		{job("https://github.com/acme/shop.git", "main", 5*time.Minute), false},
+	} {
+		if got := f.matches(tc.job, now); got != tc.want {
+			t.Errorf("matches(%s %s) = %v; want %v", tc.job.Job.RepoURL, tc.job.Job.Branch, got, tc.want)
+		}
+	}
+	if got := f.since(now); !got.Equal(now.Add(-time.Hour)) {
+		t.Errorf("since = %v", got)
+	}
+}
+
+func TestRequeueJob(t *testing.T) {
+	job := natspkg.BuildJob{
+		ID:          "job-1",
+		SHA:         "abc123",
+		BuildNumber: 7,
+		PublishedAt: time.Now(),
+		Directives:  &natspkg.Directives{Skip: []string{"docs"}},
+	}
+	got := requeueJob(job, []string{"api", "web"})
+	if !got.Requeue {
+		t.Error("requeued job should skip the last processed SHA check")
+	}
+	if got.ID != "" || !got.PublishedAt.IsZero() {
+		t.Errorf("requeued job keeps ID %q, published %v", got.ID, got.PublishedAt)
+	}
+	if got.BuildNumber != 7 || got.SHA != "abc123" {
+		t.Errorf("requeued job = %+v; want build 7 of abc123", got)
+	}
+	if d := got.Directives; d == nil || strings.Join(d.Build, ",") != "api,web" || len(d.Skip) != 0 {
+		t.Errorf("directives = %+v; want build api,web", d)
+	}
+	if job.Requeue || len(job.Directives.Build) != 0 {
+		t.Error("requeueJob modified its argument")
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCacheTrendDays = 30
+	maxCacheTrendDays     = 365
+)
+
+// cacheTrendResponse is the GET /reports/cache response.
+type cacheTrendResponse struct {
+	Since time.Time       `json:"since"`
+	Days  []tidb.CacheDay `json:"days"`
+}
+
+// NewCacheTrendRoute serves GET /reports/cache?days=N: per day, worker and
+// cache, the cache's size and file count at the day's last snapshot and
+// its lookups, evictions and hit rate over the day, for the last N days
+// (default 30). ?cache= and ?worker= narrow the report.
+func NewCacheTrendRoute(snaps *tidb.CacheSnapshotRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		days := defaultCacheTrendDays
+		if s := q.Get("days"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > maxCacheTrendDays {
+				writeError(w, http.StatusBadRequest, "days must be 1-365")
+				return
+			}
+			days = n
+		}
+
+		// Whole UTC days, so the first day is not reported partially.
+		since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+		report, err := snaps.TrendSince(r.Context(), since, q.Get("cache"), q.Get("worker"))
+		if err != nil {
+			logger.Error("cache trend query failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, cacheTrendResponse{Since: since, Days: report})
+	})
+	return webhook.Route{
+		Pattern: "GET /reports/cache",
+		Handler: authn.Require(auth.RoleViewer, h),
+	}
+}
+
+// warmImagesResponse is the GET /admin/warm-images response.
+type warmImagesResponse struct {
+	Images []tidb.WarmImage `json:"images"`
+}
+
+// NewWarmImagesRoute serves GET /admin/warm-images: the base images each
+// worker keeps pulled for its builds, with the digest pulled and when it
+// was last checked against the registry. ?worker= narrows the list.
+func NewWarmImagesRoute(warm *tidb.WarmImageRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		images, err := warm.List(r.Context(), r.URL.Query().Get("worker"))
+		if err != nil {
+			logger.Error("warm images query failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, warmImagesResponse{Images: images})
+	})
+	return webhook.Route{
+		Pattern: "GET /admin/warm-images",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+)
+
+// NewConfigRoute serves GET /admin/config: the effective configuration after
+// defaults, file and environment are merged, with secrets masked, for
+// debugging deployments.
+func NewConfigRoute(cfg *config.Config, authn *auth.Authenticator) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, cfg.Redacted())
+	})
+	return webhook.Route{
+		Pattern: "GET /admin/config",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
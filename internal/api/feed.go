@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultFeedItems = 50
+	maxFeedItems     = 200
+)
+
+// jsonFeed is a JSON Feed 1.1 document (https://jsonfeed.org/version/1.1).
+type jsonFeed struct {
+	Version string         `json:"version"`
+	Title   string         `json:"title"`
+	FeedURL string         `json:"feed_url"`
+	Items   []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	ContentText   string   `json:"content_text"`
+	DatePublished string   `json:"date_published"`
+	DateModified  string   `json:"date_modified"`
+	Tags          []string `json:"tags"`
+}
+
+// NewFeedRoute serves GET /repos/{owner}/{name}/feed.json: a JSON Feed of
+// the repository's recent builds, for dashboards and chat integrations that
+// poll rather than receive webhooks. ?limit= caps the item count.
+func NewFeedRoute(buildRec *tidb.BuildRecordRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repo := repoName(r)
+		limit := defaultFeedItems
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxFeedItems {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be 1-%d", maxFeedItems))
+				return
+			}
+			limit = n
+		}
+
+		builds, err := buildRec.RecentByRepo(r.Context(), repo, limit)
+		if err != nil {
+			logger.Error("feed lookup failed", zap.Error(err), zap.String("repo", repo))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+
+		feed := jsonFeed{
+			Version: "https://jsonfeed.org/version/1.1",
+			Title:   "Builds of " + repo,
+			FeedURL: r.URL.Path,
+			Items:   make([]jsonFeedItem, 0, len(builds)),
+		}
+		for _, b := range builds {
+			feed.Items = append(feed.Items, feedItem(b))
+		}
+		w.Header().Set("Content-Type", "application/feed+json")
+		_ = json.NewEncoder(w).Encode(feed)
+	})
+	return webhook.Route{
+		Pattern: "GET /repos/{owner}/{name}/feed.json",
+		Handler: authn.Require(auth.RoleViewer, h),
+	}
+}
+
+func feedItem(b tidb.Provenance) jsonFeedItem {
+	sha := b.CommitSHA
+	if len(sha) > 8 {
+		sha = sha[:8]
+	}
+	text := fmt.Sprintf("Build of %s at %s: %s.", b.Project, b.CommitSHA, b.Status)
+	if b.ImageRef != "" {
+		text += fmt.Sprintf(" Pushed %s@%s.", b.ImageRef, b.ImageDigest)
+	}
+	return jsonFeedItem{
+		ID:            strconv.FormatInt(b.BuildID, 10),
+		URL:           "/v1/builds/" + strconv.FormatInt(b.BuildID, 10),
+		Title:         fmt.Sprintf("%s %s %s", b.Project, sha, b.Status),
+		ContentText:   text,
+		DatePublished: b.ClaimedAt.UTC().Format(time.RFC3339),
+		DateModified:  b.UpdatedAt.UTC().Format(time.RFC3339),
+		Tags:          []string{b.Project, string(b.Status)},
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+)
+
+func TestFeedItem(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	item := feedItem(tidb.Provenance{
+		BuildID:     42,
+		Project:     "api",
+		CommitSHA:   "0123456789abcdef0123456789abcdef01234567",
+		Status:      tidb.BuildStatusSuccess,
+		ImageRef:    "registry/api:1.0.0",
+		ImageDigest: "sha256:00",
+		ClaimedAt:   at,
+		UpdatedAt:   at.Add(time.Minute),
+	})
+
+	if item.ID != "42" || item.URL != "/v1/builds/42" {
+		t.Errorf("id/url = %q, %q", item.ID, item.URL)
+	}
+	if item.Title != "api 01234567 success" {
+		t.Errorf("title = %q", item.Title)
+	}
+	if item.DatePublished != "2026-03-01T12:00:00Z" || item.DateModified != "2026-03-01T12:01:00Z" {
+		t.Errorf("dates = %q, %q", item.DatePublished, item.DateModified)
+	}
+	want := "Build of api at 0123456789abcdef0123456789abcdef01234567: success. Pushed registry/api:1.0.0@sha256:00."
+	if item.ContentText != want {
+		t.Errorf("content = %q", item.ContentText)
+	}
+}
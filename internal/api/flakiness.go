@@ -0,0 +1,55 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultFlakinessWindow = 20
+	maxFlakinessWindow     = 500
+)
+
+// NewFlakinessRoute serves GET /reports/flakiness: for each repository
+// branch, how many of its last completed builds passed only after a retry
+// on the same commit, and the resulting score. ?repo=owner/name narrows it
+// to one repository; ?window=N sets the builds considered (default 20).
+func NewFlakinessRoute(buildRec *tidb.BuildRecordRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repo, window, err := parseFlakinessQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		report, err := buildRec.FlakinessByBranch(r.Context(), repo, window)
+		if err != nil {
+			logger.Error("flakiness query failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	})
+	return webhook.Route{
+		Pattern: "GET /reports/flakiness",
+		Handler: authn.Require(auth.RoleViewer, h),
+	}
+}
+
+func parseFlakinessQuery(q url.Values) (repo string, window int, err error) {
+	window = defaultFlakinessWindow
+	if v := q.Get("window"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxFlakinessWindow {
+			return "", 0, errors.New("window must be 1-500")
+		}
+		window = n
+	}
+	return q.Get("repo"), window, nil
+}
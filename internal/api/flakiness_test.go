@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseFlakinessQuery(t *testing.T) {
+	for _, c := range []struct {
+		query  string
+		repo   string
+		window int
+		ok     bool
+	}{
+		{"", "", 20, true},
+		{"repo=acme/shop", "acme/shop", 20, true},
+		{"repo=acme/shop&window=50", "acme/shop", 50, true},
+		{"window=500", "", 500, true},
+		{"window=0", "", 0, false},
+		{"window=501", "", 0, false},
+		{"window=many", "", 0, false},
+	} {
+		q, _ := url.ParseQuery(c.query)
+		repo, window, err := parseFlakinessQuery(q)
+		if repo != c.repo || window != c.window || (err == nil) != c.ok {
+			t.Errorf("parseFlakinessQuery(%q) = %q, %d, %v; want %q, %d, ok %v", c.query, repo, window, err, c.repo, c.window, c.ok)
+		}
+	}
+}
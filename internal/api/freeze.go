@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/freeze"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+// freezeState is the response of GET /freeze.
+type freezeState struct {
+	Mode string `json:"mode"`
+	// Frozen is the freeze of the ?repo= repository, if any.
+	Frozen  *freeze.Window   `json:"frozen,omitempty"`
+	Windows []freeze.Window  `json:"windows"`
+	Held    []tidb.HeldBuild `json:"held"`
+}
+
+// NewFreezeRoute serves GET /freeze: the change freeze windows in effect
+// and the pushes held until they end. ?repo=owner/name narrows both to one
+// repository and reports whether it is frozen.
+func NewFreezeRoute(cfg *config.Config, held *tidb.HeldBuildRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repo, now := r.URL.Query().Get("repo"), time.Now()
+		state := freezeState{Mode: cfg.Freeze.Mode, Windows: []freeze.Window{}}
+		for _, win := range freeze.Windows(cfg.Freeze, now) {
+			if repo == "" || config.MatchRepo(win.Match, repo) > 0 {
+				state.Windows = append(state.Windows, win)
+			}
+		}
+		if repo != "" {
+			if win, ok := freeze.Active(cfg.Freeze, repo, now); ok {
+				state.Frozen = &win
+			}
+		}
+		list, err := held.List(r.Context(), repo)
+		if err != nil {
+			logger.Error("held builds lookup failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		state.Held = list
+		writeJSON(w, http.StatusOK, state)
+	})
+	return webhook.Route{
+		Pattern: "GET /freeze",
+		Handler: authn.Require(auth.RoleViewer, h),
+	}
+}
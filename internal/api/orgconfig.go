@@ -0,0 +1,95 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/orchestrator"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+// NewOrgBuildConfigGetRoute serves GET /orgs/{owner}/build-config: the
+// owner's default .ocibuild.yaml.
+func NewOrgBuildConfigGetRoute(configs *tidb.OrgBuildConfigRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		owner := r.PathValue("owner")
+		c, err := configs.Get(r.Context(), owner)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "no build defaults for "+owner)
+			return
+		}
+		if err != nil {
+			logger.Error("build defaults lookup failed", zap.Error(err), zap.String("owner", owner))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, c)
+	})
+	return webhook.Route{
+		Pattern: "GET /orgs/{owner}/build-config",
+		Handler: authn.Require(auth.RoleViewer, h),
+	}
+}
+
+// NewOrgBuildConfigPutRoute serves PUT /orgs/{owner}/build-config: sets
+// the owner's default .ocibuild.yaml from a YAML body of the same form.
+// Every repository of the owner inherits it from its next build, its own
+// .ocibuild.yaml overriding the defaults key by key.
+func NewOrgBuildConfigPutRoute(configs *tidb.OrgBuildConfigRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSettingsBytes))
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		if err := orchestrator.ValidateOrgDefaults(string(body)); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		owner := r.PathValue("owner")
+		p, _ := auth.PrincipalFrom(r.Context())
+		c, err := configs.Put(r.Context(), owner, string(body), p.Subject)
+		if err != nil {
+			logger.Error("put build defaults failed", zap.Error(err), zap.String("owner", owner))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		logger.Info("organization build defaults saved", zap.String("owner", c.Owner), zap.String("by", p.Subject))
+		writeJSON(w, http.StatusOK, c)
+	})
+	return webhook.Route{
+		Pattern: "PUT /orgs/{owner}/build-config",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
+
+// NewOrgBuildConfigDeleteRoute serves DELETE /orgs/{owner}/build-config:
+// removes the owner's build defaults.
+func NewOrgBuildConfigDeleteRoute(configs *tidb.OrgBuildConfigRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		owner := r.PathValue("owner")
+		err := configs.Delete(r.Context(), owner)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "no build defaults for "+owner)
+			return
+		}
+		if err != nil {
+			logger.Error("delete build defaults failed", zap.Error(err), zap.String("owner", owner))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		p, _ := auth.PrincipalFrom(r.Context())
+		logger.Info("organization build defaults removed", zap.String("owner", owner), zap.String("by", p.Subject))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return webhook.Route{
+		Pattern: "DELETE /orgs/{owner}/build-config",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
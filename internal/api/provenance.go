@@ -0,0 +1,36 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+// NewProvenanceRoute serves GET /images/{digest}: the build, commit,
+// repository and Dockerfile hash that produced an image, for tracing a
+// running container back to source during incident response.
+func NewProvenanceRoute(buildRec *tidb.BuildRecordRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		digest := r.PathValue("digest")
+		prov, err := buildRec.FindByDigest(r.Context(), digest)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "no build recorded for digest "+digest)
+			return
+		}
+		if err != nil {
+			logger.Error("provenance lookup failed", zap.Error(err), zap.String("digest", digest))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, prov)
+	})
+	return webhook.Route{
+		Pattern: "GET /images/{digest}",
+		Handler: authn.Require(auth.RoleViewer, h),
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/eta"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+// queueResponse is the GET /queue response.
+type queueResponse struct {
+	Jobs []eta.Estimate `json:"jobs"`
+}
+
+// NewQueueRoute serves GET /queue: the jobs no worker has received yet,
+// next first, with their estimated start times.
+func NewQueueRoute(estimator *eta.Estimator, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jobs, err := estimator.Queue(r.Context())
+		if err != nil {
+			logger.Error("queued jobs lookup failed", zap.Error(err))
+			writeError(w, http.StatusServiceUnavailable, "queue unavailable")
+			return
+		}
+		if jobs == nil {
+			jobs = []eta.Estimate{}
+		}
+		writeJSON(w, http.StatusOK, queueResponse{Jobs: jobs})
+	})
+	return webhook.Route{
+		Pattern: "GET /queue",
+		Handler: authn.Require(auth.RoleViewer, h),
+	}
+}
+
+// NewQueuePauseGetRoute serves GET /queue/pause: whether workers are taking
+// new jobs.
+func NewQueuePauseGetRoute(control *natspkg.Control, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, err := control.Pause(r.Context())
+		if err != nil {
+			logger.Error("pause state lookup failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, state)
+	})
+	return webhook.Route{
+		Pattern: "GET /queue/pause",
+		Handler: authn.Require(auth.RoleViewer, h),
+	}
+}
+
+// NewQueuePausePutRoute serves PUT /queue/pause: stops every worker from
+// taking new jobs, for maintenance windows. Webhooks are still queued and
+// running jobs finish. The optional body is {"reason": "..."}.
+func NewQueuePausePutRoute(control *natspkg.Control, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		p, _ := auth.PrincipalFrom(r.Context())
+		state := natspkg.PauseState{Paused: true, By: p.Subject, Reason: req.Reason, Since: time.Now().UTC()}
+		if err := control.SetPause(r.Context(), state); err != nil {
+			logger.Error("pause queue failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		logger.Warn("queue paused", zap.String("by", p.Subject), zap.String("reason", req.Reason))
+		writeJSON(w, http.StatusOK, state)
+	})
+	return webhook.Route{
+		Pattern: "PUT /queue/pause",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
+
+// NewQueuePauseDeleteRoute serves DELETE /queue/pause: workers resume
+// taking jobs, starting with the backlog queued while paused.
+func NewQueuePauseDeleteRoute(control *natspkg.Control, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := auth.PrincipalFrom(r.Context())
+		state := natspkg.PauseState{By: p.Subject, Since: time.Now().UTC()}
+		if err := control.SetPause(r.Context(), state); err != nil {
+			logger.Error("resume queue failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		logger.Info("queue resumed", zap.String("by", p.Subject))
+		writeJSON(w, http.StatusOK, state)
+	})
+	return webhook.Route{
+		Pattern: "DELETE /queue/pause",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
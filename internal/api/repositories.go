@@ -0,0 +1,295 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/buildwarn"
+	"github.com/jorgerua/build-system/container-build-service/internal/detection"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/validation"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+// maxSettingsBytes bounds a repository settings request body.
+const maxSettingsBytes = 64 << 10
+
+// NewRepositoryListRoute serves GET /repos: every onboarded repository.
+func NewRepositoryListRoute(repos *tidb.RepositoryRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list, err := repos.List(r.Context())
+		if err != nil {
+			logger.Error("list repositories failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+	return webhook.Route{
+		Pattern: "GET /repos",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
+
+// NewRepositoryGetRoute serves GET /repos/{owner}/{name}: an onboarded
+// repository and its settings.
+func NewRepositoryGetRoute(repos *tidb.RepositoryRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := repoName(r)
+		repo, err := repos.Get(r.Context(), name)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "repository not onboarded")
+			return
+		}
+		if err != nil {
+			logger.Error("repository lookup failed", zap.Error(err), zap.String("repo", name))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, repo)
+	})
+	return webhook.Route{
+		Pattern: "GET /repos/{owner}/{name}",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
+
+// NewRepositoryPutRoute serves PUT /repos/{owner}/{name}: onboards a
+// repository, or replaces its settings, from a RepositorySettings body.
+// With github.webhook_url set it also creates or updates the repository's
+// GitHub webhook; a failure there answers 502 with the settings saved, and
+// the request can be retried.
+func NewRepositoryPutRoute(repos *tidb.RepositoryRepository, registrar *githubpkg.Registrar, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var settings tidb.RepositorySettings
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSettingsBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&settings); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if err := validateSettings(settings); err != nil {
+			var details validation.Errors
+			errors.As(err, &details)
+			writeJSON(w, http.StatusBadRequest, struct {
+				Error   string            `json:"error"`
+				Details validation.Errors `json:"details"`
+			}{"invalid repository settings", details})
+			return
+		}
+
+		name := repoName(r)
+		repo, err := repos.Put(r.Context(), name, settings)
+		if err != nil {
+			logger.Error("put repository failed", zap.Error(err), zap.String("repo", name))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		p, _ := auth.PrincipalFrom(r.Context())
+		logger.Info("repository settings saved", zap.String("repo", repo.FullName), zap.String("by", p.Subject))
+		if registrar != nil {
+			if err := registerWebhook(r.Context(), registrar, repos, name, logger); err != nil {
+				logger.Error("webhook registration failed", zap.Error(err), zap.String("repo", name))
+				writeError(w, http.StatusBadGateway, "settings saved, but the GitHub webhook could not be registered")
+				return
+			}
+			if repo, err = repos.Get(r.Context(), name); err != nil {
+				logger.Error("repository lookup failed", zap.Error(err), zap.String("repo", name))
+				writeError(w, http.StatusInternalServerError, "internal error")
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, repo)
+	})
+	return webhook.Route{
+		Pattern: "PUT /repos/{owner}/{name}",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
+
+// NewRepositoryDeleteRoute serves DELETE /repos/{owner}/{name}: offboards
+// a repository.
+func NewRepositoryDeleteRoute(repos *tidb.RepositoryRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := repoName(r)
+		err := repos.Delete(r.Context(), name)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "repository not onboarded")
+			return
+		}
+		if err != nil {
+			logger.Error("delete repository failed", zap.Error(err), zap.String("repo", name))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		p, _ := auth.PrincipalFrom(r.Context())
+		logger.Info("repository offboarded", zap.String("repo", name), zap.String("by", p.Subject))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return webhook.Route{
+		Pattern: "DELETE /repos/{owner}/{name}",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
+
+// minWebhookSecretBytes is the shortest accepted repository webhook secret.
+const minWebhookSecretBytes = 16
+
+// NewWebhookSecretPutRoute serves PUT /repos/{owner}/{name}/webhook-secret:
+// sets the secret the repository's GitHub webhook is signed with, from a
+// {"secret": "..."} body. The previous secret stays valid until the next
+// rotation. With github.webhook_url set the GitHub webhook is updated too.
+func NewWebhookSecretPutRoute(repos *tidb.RepositoryRepository, registrar *githubpkg.Registrar, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Secret string `json:"secret"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if len(req.Secret) < minWebhookSecretBytes || len(req.Secret) > 255 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("secret must be %d-255 bytes", minWebhookSecretBytes))
+			return
+		}
+
+		name := repoName(r)
+		err := repos.RotateWebhookSecret(r.Context(), name, req.Secret)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "repository not onboarded")
+			return
+		}
+		if err != nil {
+			logger.Error("rotate webhook secret failed", zap.Error(err), zap.String("repo", name))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		p, _ := auth.PrincipalFrom(r.Context())
+		logger.Info("repository webhook secret rotated", zap.String("repo", name), zap.String("by", p.Subject))
+		if registrar != nil {
+			if _, err := registrar.Register(r.Context(), name, req.Secret); err != nil {
+				logger.Error("webhook update failed", zap.Error(err), zap.String("repo", name))
+				writeError(w, http.StatusBadGateway, "secret saved, but the GitHub webhook could not be updated")
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return webhook.Route{
+		Pattern: "PUT /repos/{owner}/{name}/webhook-secret",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
+
+// NewWebhookSecretDeleteRoute serves DELETE
+// /repos/{owner}/{name}/webhook-secret: the repository's webhooks are
+// verified with github.webhook_secret again, and with github.webhook_url set
+// the GitHub webhook is signed with it.
+func NewWebhookSecretDeleteRoute(repos *tidb.RepositoryRepository, registrar *githubpkg.Registrar, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := repoName(r)
+		err := repos.ClearWebhookSecret(r.Context(), name)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "repository not onboarded")
+			return
+		}
+		if err != nil {
+			logger.Error("clear webhook secret failed", zap.Error(err), zap.String("repo", name))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		p, _ := auth.PrincipalFrom(r.Context())
+		logger.Info("repository webhook secret cleared", zap.String("repo", name), zap.String("by", p.Subject))
+		if registrar != nil {
+			if _, err := registrar.Register(r.Context(), name, ""); err != nil {
+				logger.Error("webhook update failed", zap.Error(err), zap.String("repo", name))
+				writeError(w, http.StatusBadGateway, "secret cleared, but the GitHub webhook could not be updated")
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return webhook.Route{
+		Pattern: "DELETE /repos/{owner}/{name}/webhook-secret",
+		Handler: authn.Require(auth.RoleAdmin, h),
+	}
+}
+
+// registerWebhook creates or updates a repository's GitHub webhook, signed
+// with the repository's own secret. A repository without one gets a
+// generated secret first.
+func registerWebhook(ctx context.Context, registrar *githubpkg.Registrar, repos *tidb.RepositoryRepository, name string, logger *zap.Logger) error {
+	secrets, err := repos.WebhookSecrets(ctx, name)
+	if err != nil {
+		return err
+	}
+	if len(secrets) == 0 {
+		b := make([]byte, 32)
+		_, _ = rand.Read(b)
+		secrets = []string{hex.EncodeToString(b)}
+		if err := repos.RotateWebhookSecret(ctx, name, secrets[0]); err != nil {
+			return err
+		}
+	}
+	created, err := registrar.Register(ctx, name, secrets[0])
+	if err != nil {
+		return err
+	}
+	logger.Info("repository webhook registered", zap.String("repo", name), zap.Bool("created", created))
+	return nil
+}
+
+// repoName returns the "owner/name" of the {owner} and {name} path values.
+func repoName(r *http.Request) string {
+	return r.PathValue("owner") + "/" + r.PathValue("name")
+}
+
+// validateSettings checks repository settings before they are stored.
+func validateSettings(s tidb.RepositorySettings) error {
+	var errs validation.Errors
+	for i, pattern := range s.Projects {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			errs.Add(fmt.Sprintf("projects[%d]", i), "invalid pattern %q", pattern)
+		}
+	}
+	for i, l := range s.Requires {
+		if strings.TrimSpace(l) == "" {
+			errs.Add(fmt.Sprintf("requires[%d]", i), "must not be empty")
+		}
+	}
+	for i, l := range s.Avoids {
+		if strings.TrimSpace(l) == "" {
+			errs.Add(fmt.Sprintf("avoids[%d]", i), "must not be empty")
+		}
+	}
+	for k := range s.Env {
+		if k == "" {
+			errs.Add("env", "variable names must not be empty")
+		}
+	}
+	if s.Language != "" && !detection.ValidPin(s.Language) {
+		errs.Add("language", "must be one of %v, got %q", detection.PinNames, s.Language)
+	}
+	for _, project := range slices.Sorted(maps.Keys(s.Languages)) {
+		if name := s.Languages[project]; !detection.ValidPin(name) {
+			errs.Add("languages."+project, "must be one of %v, got %q", detection.PinNames, name)
+		}
+	}
+	if s.FailOnWarning != "" && !buildwarn.Severity(s.FailOnWarning).Valid() {
+		errs.Add("fail_on_warning", "must be one of %v, got %q", buildwarn.Severities, s.FailOnWarning)
+	}
+	return errs.Err()
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/validation"
+)
+
+func TestValidateSettings(t *testing.T) {
+	if err := validateSettings(tidb.RepositorySettings{Projects: []string{"api-*"}, Env: map[string]string{"GOFLAGS": "-mod=mod"}, Language: "java", Languages: map[string]string{"tools": "go"}, FailOnWarning: "critical"}); err != nil {
+		t.Errorf("valid settings rejected: %v", err)
+	}
+
+	err := validateSettings(tidb.RepositorySettings{Projects: []string{"ok", "[", ""}, Env: map[string]string{"": "x"}, Language: "rust", Languages: map[string]string{"b": "node", "a": "cobol"}, FailOnWarning: "error"})
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v, want validation.Errors", err)
+	}
+	want := []string{"projects[1]", "projects[2]", "env", "language", "languages.a", "languages.b", "fail_on_warning"}
+	if len(errs) != len(want) {
+		t.Fatalf("errors = %v, want fields %v", errs, want)
+	}
+	for i, f := range errs {
+		if f.Field != want[i] {
+			t.Errorf("errors[%d].Field = %q, want %q", i, f.Field, want[i])
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSkipItems = 50
+	maxSkipItems     = 500
+)
+
+// NewSkipListRoute serves GET /skips: pushes and build jobs that were not
+// built, and why, newest first. ?repo=owner/name, ?sha= (a prefix),
+// ?reason= and ?since= (RFC 3339) narrow the list; ?limit= caps it.
+func NewSkipListRoute(skips *tidb.SkippedBuildRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseSkipFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		list, err := skips.List(r.Context(), f)
+		if err != nil {
+			logger.Error("skipped build lookup failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+	return webhook.Route{
+		Pattern: "GET /skips",
+		Handler: authn.Require(auth.RoleViewer, h),
+	}
+}
+
+func parseSkipFilter(q url.Values) (tidb.SkipFilter, error) {
+	f := tidb.SkipFilter{
+		Repo:   q.Get("repo"),
+		SHA:    q.Get("sha"),
+		Reason: q.Get("reason"),
+		Limit:  defaultSkipItems,
+	}
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, errors.New("since must be an RFC 3339 time")
+		}
+		f.Since = t
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSkipItems {
+			return f, fmt.Errorf("limit must be 1-%d", maxSkipItems)
+		}
+		f.Limit = n
+	}
+	return f, nil
+}
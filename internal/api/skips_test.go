@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseSkipFilter(t *testing.T) {
+	f, err := parseSkipFilter(url.Values{
+		"repo":   {"acme/shop"},
+		"sha":    {"abc1"},
+		"reason": {"branch_filter"},
+		"since":  {"2026-03-01T12:00:00Z"},
+		"limit":  {"10"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Repo != "acme/shop" || f.SHA != "abc1" || f.Reason != "branch_filter" || f.Limit != 10 ||
+		!f.Since.Equal(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("filter = %+v", f)
+	}
+
+	if f, err := parseSkipFilter(url.Values{}); err != nil || f.Limit != defaultSkipItems {
+		t.Errorf("default filter = %+v, %v", f, err)
+	}
+	for _, q := range []url.Values{{"limit": {"0"}}, {"limit": {"501"}}, {"since": {"yesterday"}}} {
+		if _, err := parseSkipFilter(q); err == nil {
+			t.Errorf("parseSkipFilter(%v) succeeded", q)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultThroughputDays = 14
+	maxThroughputDays     = 90
+)
+
+// throughputResponse is the GET /reports/throughput response.
+type throughputResponse struct {
+	Since time.Time            `json:"since"`
+	Days  []tidb.DayThroughput `json:"days"`
+}
+
+// NewThroughputRoute serves GET /reports/throughput?days=N: builds started,
+// completed and failed per day over the last N days (default 14), with
+// queue wait percentiles and worker utilization.
+func NewThroughputRoute(cfg *config.Config, buildRec *tidb.BuildRecordRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		days := defaultThroughputDays
+		if s := r.URL.Query().Get("days"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > maxThroughputDays {
+				writeError(w, http.StatusBadRequest, "days must be 1-90")
+				return
+			}
+			days = n
+		}
+
+		// Whole UTC days, so the first day is not reported partially.
+		since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+		report, err := buildRec.ThroughputSince(r.Context(), since, cfg.Worker.Concurrency)
+		if err != nil {
+			logger.Error("throughput query failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, throughputResponse{Since: since, Days: report})
+	})
+	return webhook.Route{
+		Pattern: "GET /reports/throughput",
+		Handler: authn.Require(auth.RoleViewer, h),
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultUsageDays = 30
+	maxUsageDays     = 366
+)
+
+// usageResponse is the GET /usage response.
+type usageResponse struct {
+	Since   time.Time    `json:"since"`
+	GroupBy string       `json:"group_by"`
+	Usage   []tidb.Usage `json:"usage"`
+}
+
+// NewUsageRoute serves GET /usage?days=N&group_by=repo|owner: the estimated
+// cost of builds over the last N days (default 30), per repository or per
+// repository owner, for budgeting.
+func NewUsageRoute(buildRec *tidb.BuildRecordRepository, authn *auth.Authenticator, logger *zap.Logger) webhook.Route {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		days := defaultUsageDays
+		if s := q.Get("days"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > maxUsageDays {
+				writeError(w, http.StatusBadRequest, "days must be 1-366")
+				return
+			}
+			days = n
+		}
+		groupBy := q.Get("group_by")
+		switch groupBy {
+		case "":
+			groupBy = "repo"
+		case "repo", "owner":
+		default:
+			writeError(w, http.StatusBadRequest, `group_by must be "repo" or "owner"`)
+			return
+		}
+
+		since := time.Now().UTC().AddDate(0, 0, -days).Truncate(time.Second)
+		usage, err := buildRec.UsageSince(r.Context(), since, groupBy == "owner")
+		if err != nil {
+			logger.Error("usage query failed", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, usageResponse{Since: since, GroupBy: groupBy, Usage: usage})
+	})
+	return webhook.Route{
+		Pattern: "GET /usage",
+		Handler: authn.Require(auth.RoleViewer, h),
+	}
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jwksRefreshInterval bounds how long fetched keys are trusted, and
+// jwksMinRefetch rate-limits refetches triggered by unknown key IDs.
+const (
+	jwksRefreshInterval = time.Hour
+	jwksMinRefetch      = time.Minute
+)
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet caches the signing keys published at an OIDC provider's JWKS URL.
+type keySet struct {
+	url        string
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// fetching is closed when the fetch in flight, if any, completes.
+	fetching chan struct{}
+}
+
+func newKeySet(url string, httpClient *http.Client) *keySet {
+	return &keySet{url: url, httpClient: httpClient}
+}
+
+// key returns the public key for kid, refetching the JWKS when the cache is
+// expired or the key ID is unknown (provider key rotation). Only one
+// lookup fetches at a time; the others wait for it, and lookups of fresh
+// keys are not held up by it.
+func (s *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	if k, ok := s.keys[kid]; ok && time.Since(s.fetchedAt) < jwksRefreshInterval {
+		s.mu.Unlock()
+		return k, nil
+	}
+	wait, fetch := s.fetching, false
+	if wait == nil && time.Since(s.fetchedAt) >= jwksMinRefetch {
+		wait, fetch = make(chan struct{}), true
+		s.fetching = wait
+	}
+	s.mu.Unlock()
+
+	switch {
+	case fetch:
+		if err := s.refresh(ctx, wait); err != nil {
+			return nil, err
+		}
+	case wait != nil:
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	s.mu.Lock()
+	k, ok := s.keys[kid]
+	s.mu.Unlock()
+	if ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// refresh fetches the key set without holding s.mu, swaps it in, and
+// wakes the lookups waiting on done.
+func (s *keySet) refresh(ctx context.Context, done chan struct{}) error {
+	keys, err := s.fetch(ctx)
+	s.mu.Lock()
+	if err == nil {
+		s.keys, s.fetchedAt = keys, time.Now()
+	}
+	s.fetching = nil
+	s.mu.Unlock()
+	close(done)
+	return err
+}
+
+func (s *keySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build jwks request: %w", err)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status from jwks endpoint: %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		k, err := jwk.publicKey()
+		if err != nil {
+			continue // skip unsupported key types
+		}
+		keys[jwk.Kid] = k
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode jwk field: %w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
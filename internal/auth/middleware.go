@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Authenticator validates bearer tokens on API requests. Tokens are either
+// configured static tokens or, when OIDC is configured, JWTs issued by the
+// corporate identity provider.
+type Authenticator struct {
+	cfg    config.AuthConfig
+	keys   *keySet
+	logger *zap.Logger
+}
+
+// NewAuthenticator creates an Authenticator from config. OIDC key sets are
+// fetched with httpClient.
+func NewAuthenticator(cfg *config.Config, httpClient *http.Client, logger *zap.Logger) *Authenticator {
+	a := &Authenticator{cfg: cfg.Auth, logger: logger.Named("auth")}
+	if cfg.Auth.OIDC.JWKSURL != "" {
+		a.keys = newKeySet(cfg.Auth.OIDC.JWKSURL, httpClient)
+	}
+	return a
+}
+
+// Require wraps next so that it is only served to callers holding at least
+// the required role. Unauthenticated requests get 401, insufficient roles 403.
+func (a *Authenticator) Require(required Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="container-build-service"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		p, err := a.Authenticate(r.Context(), token)
+		if err != nil {
+			a.logger.Warn("authentication failed", zap.Error(err), zap.String("path", r.URL.Path))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="container-build-service", error="invalid_token"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !p.Role.Satisfies(required) {
+			a.logger.Warn("insufficient role",
+				zap.String("subject", p.Subject),
+				zap.String("role", string(p.Role)),
+				zap.String("required", string(required)),
+				zap.String("path", r.URL.Path),
+			)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// Authenticate resolves a bearer token to a Principal.
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (Principal, error) {
+	for _, st := range a.cfg.StaticTokens {
+		if st.Token != "" && subtle.ConstantTimeCompare([]byte(st.Token), []byte(token)) == 1 {
+			return Principal{Subject: st.Name, Role: Role(st.Role)}, nil
+		}
+	}
+	if a.keys == nil {
+		return Principal{}, fmt.Errorf("unknown static token")
+	}
+	return a.validateJWT(ctx, token)
+}
+
+func (a *Authenticator) validateJWT(ctx context.Context, token string) (Principal, error) {
+	oidc := a.cfg.OIDC
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+		// Both are required by config validation: without them, tokens the
+		// provider issued to other applications would be accepted.
+		jwt.WithIssuer(oidc.Issuer),
+		jwt.WithAudience(oidc.Audience),
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.keys.key(ctx, kid)
+	}, opts...)
+	if err != nil {
+		return Principal{}, fmt.Errorf("validate jwt: %w", err)
+	}
+
+	sub, _ := claims.GetSubject()
+	role := a.roleFromClaims(claims)
+	if role == "" {
+		return Principal{}, fmt.Errorf("no role mapped for subject %q", sub)
+	}
+	return Principal{Subject: sub, Role: role}, nil
+}
+
+// roleFromClaims maps the configured roles claim (a string or list of
+// strings, e.g. groups) to the highest matching Role.
+func (a *Authenticator) roleFromClaims(claims jwt.MapClaims) Role {
+	var values []string
+	switch v := claims[a.cfg.OIDC.RolesClaim].(type) {
+	case string:
+		values = []string{v}
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	var best Role
+	for _, v := range values {
+		// Viper lowercases map keys, so mappings are matched case-insensitively.
+		mapped, ok := a.cfg.OIDC.RoleMapping[strings.ToLower(v)]
+		if !ok {
+			continue
+		}
+		if r := Role(mapped); roleRank[r] > roleRank[best] {
+			best = r
+		}
+	}
+	return best
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(h[len(prefix):]), true
+}
+
+// Module provides *Authenticator via fx.
+var Module = fx.Module("auth",
+	fx.Provide(NewAuthenticator),
+)
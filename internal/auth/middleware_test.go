@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/zap"
+)
+
+func newTestJWKS(t *testing.T, key *rsa.PrivateKey, kid string) *httptest.Server {
+	t.Helper()
+	doc := map[string]any{
+		"keys": []map[string]string{{
+			"kid": kid,
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(doc)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = kid
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRequire(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := newTestJWKS(t, key, "k1")
+
+	cfg := &config.Config{Auth: config.AuthConfig{
+		StaticTokens: []config.StaticToken{
+			{Name: "ops", Token: "static-admin", Role: "admin"},
+			{Name: "bot", Token: "static-viewer", Role: "viewer"},
+		},
+		OIDC: config.OIDCConfig{
+			Issuer:      "https://sso.example.com",
+			Audience:    "build-service",
+			JWKSURL:     jwks.URL,
+			RolesClaim:  "groups",
+			RoleMapping: map[string]string{"build-admins": "admin", "developers": "trigger"},
+		},
+	}}
+	a := NewAuthenticator(cfg, http.DefaultClient, zap.NewNop())
+	handler := a.Require(RoleTrigger, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	valid := jwt.MapClaims{
+		"iss":    "https://sso.example.com",
+		"aud":    "build-service",
+		"sub":    "alice",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"groups": []string{"Developers"},
+	}
+	wrongAud := jwt.MapClaims{
+		"iss":    "https://sso.example.com",
+		"aud":    "other",
+		"sub":    "alice",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"groups": []string{"build-admins"},
+	}
+	wrongIss := jwt.MapClaims{
+		"iss":    "https://other.example.com",
+		"aud":    "build-service",
+		"sub":    "alice",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"groups": []string{"build-admins"},
+	}
+	noRole := jwt.MapClaims{
+		"iss": "https://sso.example.com",
+		"aud": "build-service",
+		"sub": "bob",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"missing header", "", http.StatusUnauthorized},
+		{"static admin", "Bearer static-admin", http.StatusNoContent},
+		{"static viewer lacks trigger", "Bearer static-viewer", http.StatusForbidden},
+		{"unknown static", "Bearer nope", http.StatusUnauthorized},
+		{"jwt mapped group", "Bearer " + signToken(t, key, "k1", valid), http.StatusNoContent},
+		{"jwt wrong audience", "Bearer " + signToken(t, key, "k1", wrongAud), http.StatusUnauthorized},
+		{"jwt wrong issuer", "Bearer " + signToken(t, key, "k1", wrongIss), http.StatusUnauthorized},
+		{"jwt unknown kid", "Bearer " + signToken(t, key, "k2", valid), http.StatusUnauthorized},
+		{"jwt without role", "Bearer " + signToken(t, key, "k1", noRole), http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestKeySetFetchDoesNotBlockCachedKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requested, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(requested)
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	s := newKeySet(srv.URL, srv.Client())
+	s.keys = map[string]crypto.PublicKey{"k1": &key.PublicKey}
+	s.fetchedAt = time.Now().Add(-2 * jwksMinRefetch)
+
+	// An unknown key ID refetches from the slow provider...
+	fetched := make(chan error, 1)
+	go func() {
+		_, err := s.key(context.Background(), "k2")
+		fetched <- err
+	}()
+	<-requested
+
+	// ...while the cached key is still served.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if k, err := s.key(context.Background(), "k1"); err != nil || k != &key.PublicKey {
+			t.Errorf("key(k1) = %v, %v; want the cached key", k, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cached key lookup blocked by the JWKS fetch")
+	}
+
+	close(release)
+	if err := <-fetched; err == nil {
+		t.Error("key(k2) succeeded, want the fetch error")
+	}
+}
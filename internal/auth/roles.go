@@ -0,0 +1,43 @@
+package auth
+
+import "context"
+
+// Role is an authorization level for HTTP endpoints.
+// Roles are hierarchical: admin > trigger > viewer.
+type Role string
+
+const (
+	RoleViewer  Role = "viewer"
+	RoleTrigger Role = "trigger"
+	RoleAdmin   Role = "admin"
+)
+
+var roleRank = map[Role]int{
+	RoleViewer:  1,
+	RoleTrigger: 2,
+	RoleAdmin:   3,
+}
+
+// Satisfies reports whether r grants at least the required role.
+func (r Role) Satisfies(required Role) bool {
+	return roleRank[r] > 0 && roleRank[r] >= roleRank[required]
+}
+
+// Principal identifies an authenticated caller.
+type Principal struct {
+	Subject string
+	Role    Role
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the authenticated caller stored by the middleware.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,164 @@
+package autoscale
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/admission"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	metricspkg "github.com/jorgerua/build-system/container-build-service/internal/metrics"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// LoadSource reports the current build load of this worker.
+type LoadSource interface {
+	Load() (running, capacity int, avgWait time.Duration)
+}
+
+// Signal is the machine-readable load report published on the autoscaling
+// subject. KEDA/HPA adapters can scale on QueueDepth or Utilization.
+type Signal struct {
+	Worker        string `json:"worker"`
+	RunningBuilds int    `json:"running_builds"`
+	Capacity      int    `json:"capacity"`
+	// Status is "backpressure" while the worker takes no new jobs for lack
+	// of disk or memory, for Reason; its Capacity is then what it is
+	// already running, and its Utilization 1.
+	Status              string    `json:"status"`
+	Reason              string    `json:"reason,omitempty"`
+	Utilization         float64   `json:"utilization"`
+	QueueDepth          uint64    `json:"queue_depth"`    // messages not yet delivered
+	InFlightJobs        int       `json:"in_flight_jobs"` // delivered, not yet acked
+	RedeliveredJobs     int       `json:"redelivered_jobs"`
+	AvgQueueWaitSeconds float64   `json:"avg_queue_wait_seconds"`
+	Timestamp           time.Time `json:"timestamp"`
+}
+
+// Reporter periodically publishes the autoscaling Signal.
+type Reporter struct {
+	cfg      *config.Config
+	nc       *nats.Conn
+	consumer jetstream.Consumer
+	load     LoadSource
+	pressure *admission.Monitor
+	bm       *metricspkg.BuildMetrics
+	logger   *zap.Logger
+	hostname string
+}
+
+// New creates a Reporter and schedules it on the fx lifecycle.
+func New(
+	cfg *config.Config,
+	nc *nats.Conn,
+	consumer jetstream.Consumer,
+	load LoadSource,
+	pressure *admission.Monitor,
+	bm *metricspkg.BuildMetrics,
+	logger *zap.Logger,
+	lc fx.Lifecycle,
+) *Reporter {
+	hostname, _ := os.Hostname()
+	r := &Reporter{
+		cfg:      cfg,
+		nc:       nc,
+		consumer: consumer,
+		load:     load,
+		pressure: pressure,
+		bm:       bm,
+		logger:   logger.Named("autoscale"),
+		hostname: hostname,
+	}
+	if cfg.Autoscaling.IntervalSeconds <= 0 {
+		return r
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			go func() {
+				defer close(done)
+				r.loop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			cancel()
+			<-done
+			return nil
+		},
+	})
+	return r
+}
+
+func (r *Reporter) loop(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(r.cfg.Autoscaling.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.report(ctx)
+		}
+	}
+}
+
+func (r *Reporter) report(ctx context.Context) {
+	running, capacity, avgWait := r.load.Load()
+	sig := newSignal(r.hostname, running, capacity, avgWait, r.pressure.State(), time.Now())
+
+	infoCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if lag, err := natspkg.Lag(infoCtx, r.consumer); err == nil {
+		sig.QueueDepth = lag.Pending
+		sig.InFlightJobs = lag.AckPending
+		sig.RedeliveredJobs = lag.Redelivered
+		r.bm.ConsumerLag(lag.AckPending, lag.Redelivered, lag.Waiting)
+	} else {
+		r.logger.Warn("consumer info failed", zap.Error(err))
+	}
+
+	r.bm.WorkerLoad(sig.RunningBuilds, sig.Capacity, sig.QueueDepth, avgWait)
+
+	data, err := json.Marshal(sig)
+	if err != nil {
+		return
+	}
+	if err := r.nc.Publish(r.cfg.Autoscaling.Subject, data); err != nil {
+		r.logger.Warn("publish autoscaling signal failed", zap.Error(err))
+	}
+}
+
+// newSignal computes the load part of a Signal; the queue figures come from
+// the consumer.
+func newSignal(worker string, running, capacity int, avgWait time.Duration, state admission.State, now time.Time) Signal {
+	sig := Signal{
+		Worker:              worker,
+		RunningBuilds:       running,
+		Capacity:            capacity,
+		Status:              state.Status,
+		Reason:              state.Reason,
+		AvgQueueWaitSeconds: avgWait.Seconds(),
+		Timestamp:           now.UTC(),
+	}
+	switch {
+	case state.Backpressure():
+		sig.Capacity, sig.Utilization = running, 1
+	case capacity > 0:
+		sig.Utilization = float64(running) / float64(capacity)
+	}
+	return sig
+}
+
+// Module provides and starts the autoscaling Reporter via fx.
+var Module = fx.Module("autoscale",
+	fx.Provide(New),
+	fx.Invoke(func(*Reporter) {}),
+)
@@ -0,0 +1,40 @@
+package autoscale
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/admission"
+)
+
+func TestNewSignal(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	ok := admission.State{Status: admission.StatusOK}
+
+	sig := newSignal("w1", 3, 4, 90*time.Second, ok, now)
+	if sig.Worker != "w1" || sig.RunningBuilds != 3 || sig.Capacity != 4 || sig.Status != admission.StatusOK {
+		t.Errorf("signal = %+v", sig)
+	}
+	if sig.Utilization != 0.75 {
+		t.Errorf("utilization = %v, want 0.75", sig.Utilization)
+	}
+	if sig.AvgQueueWaitSeconds != 90 {
+		t.Errorf("avg wait = %v, want 90", sig.AvgQueueWaitSeconds)
+	}
+	if !sig.Timestamp.Equal(now) || sig.Timestamp.Location() != time.UTC {
+		t.Errorf("timestamp = %v, want %v in UTC", sig.Timestamp, now)
+	}
+
+	if sig := newSignal("w1", 0, 0, 0, ok, now); sig.Utilization != 0 {
+		t.Errorf("utilization without capacity = %v, want 0", sig.Utilization)
+	}
+
+	full := admission.State{Status: admission.StatusBackpressure, Reason: "disk"}
+	sig = newSignal("w1", 1, 4, 0, full, now)
+	if sig.Status != admission.StatusBackpressure || sig.Reason != "disk" {
+		t.Errorf("status = %q, %q; want backpressure, disk", sig.Status, sig.Reason)
+	}
+	if sig.Capacity != 1 || sig.Utilization != 1 {
+		t.Errorf("under backpressure capacity, utilization = %d, %v; want 1, 1", sig.Capacity, sig.Utilization)
+	}
+}
@@ -0,0 +1,275 @@
+// Package bench drives synthetic build jobs through NATS JetStream with the
+// production publisher and subscriber, simulating builds in place of git,
+// nx, buildah and TiDB, to measure job throughput, queue latency and NATS
+// round-trips. It backs `buildctl bench`.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+// Options shape a benchmark run.
+type Options struct {
+	Jobs        int           `json:"jobs"`
+	Rate        float64       `json:"rate"`        // jobs published per second; 0 publishes as fast as possible
+	Projects    int           `json:"projects"`    // simulated affected projects per job
+	Concurrency int           `json:"concurrency"` // parallel project builds per job, like worker.concurrency
+	BuildTime   time.Duration `json:"build_time"`  // simulated duration of one project build
+	// MessageBytes pads each job's commit messages, to exercise payload
+	// offload with large pushes.
+	MessageBytes int           `json:"message_bytes"`
+	Timeout      time.Duration `json:"timeout"`
+}
+
+// Summary describes a latency distribution in milliseconds.
+type Summary struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P95   float64 `json:"p95_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// Report is the result of a run.
+type Report struct {
+	Options     Options       `json:"options"`
+	StartedAt   time.Time     `json:"started_at"`
+	Elapsed     time.Duration `json:"elapsed_ns"`
+	Published   int           `json:"published"`
+	Completed   int           `json:"completed"`
+	Redelivered int           `json:"redelivered"`
+	// Throughput is completed jobs per second of the run.
+	Throughput float64 `json:"throughput_jobs_per_second"`
+	// Publish is the JetStream publish round-trip, including payload
+	// offload; QueueWait runs from publish to the handler picking the job
+	// up; EndToEnd from publish to the simulated build finishing.
+	Publish   Summary `json:"publish"`
+	QueueWait Summary `json:"queue_wait"`
+	EndToEnd  Summary `json:"end_to_end"`
+}
+
+// String renders the report for a terminal.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "jobs: %d published, %d completed, %d redelivered in %s (%.1f jobs/s)\n",
+		r.Published, r.Completed, r.Redelivered, r.Elapsed.Round(time.Millisecond), r.Throughput)
+	for _, s := range []struct {
+		name string
+		Summary
+	}{{"publish", r.Publish}, {"queue wait", r.QueueWait}, {"end to end", r.EndToEnd}} {
+		fmt.Fprintf(&b, "%-10s p50 %8.2fms  p95 %8.2fms  p99 %8.2fms  max %8.2fms\n", s.name, s.P50, s.P95, s.P99, s.Max)
+	}
+	return b.String()
+}
+
+// Summarize returns the nearest-rank percentiles of samples.
+func Summarize(samples []time.Duration) Summary {
+	if len(samples) == 0 {
+		return Summary{}
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(p int) float64 {
+		idx := (len(sorted)*p+99)/100 - 1
+		return float64(sorted[idx]) / float64(time.Millisecond)
+	}
+	return Summary{
+		Count: len(sorted),
+		P50:   rank(50),
+		P95:   rank(95),
+		P99:   rank(99),
+		Max:   float64(sorted[len(sorted)-1]) / float64(time.Millisecond),
+	}
+}
+
+// Run benchmarks against the NATS server of cfg. It works on a throwaway
+// stream, consumer and payload bucket, removed afterwards, so it can run
+// next to production traffic without consuming real jobs.
+func Run(ctx context.Context, cfg *config.Config, opts Options, logger *zap.Logger) (*Report, error) {
+	nc, err := nats.Connect(cfg.NATS.URL)
+	if err != nil {
+		return nil, fmt.Errorf("nats connect: %w", err)
+	}
+	defer nc.Close()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, fmt.Errorf("jetstream init: %w", err)
+	}
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	benchCfg := *cfg
+	benchCfg.NATS.StreamName = "BENCH_" + suffix
+	benchCfg.NATS.Subject = "bench." + suffix + ".jobs"
+	benchCfg.NATS.PayloadBucket = "bench-" + suffix
+
+	setupCtx := context.WithoutCancel(ctx)
+	if _, err := js.CreateStream(setupCtx, jetstream.StreamConfig{
+		Name:     benchCfg.NATS.StreamName,
+		Subjects: []string{benchCfg.NATS.Subject},
+	}); err != nil {
+		return nil, fmt.Errorf("create bench stream: %w", err)
+	}
+	defer js.DeleteStream(setupCtx, benchCfg.NATS.StreamName)
+	consumer, err := js.CreateConsumer(setupCtx, benchCfg.NATS.StreamName, jetstream.ConsumerConfig{
+		Durable:    "bench",
+		AckPolicy:  jetstream.AckExplicitPolicy,
+		AckWait:    time.Duration(cfg.NATS.AckWaitSeconds) * time.Second,
+		MaxDeliver: cfg.NATS.MaxDelivers,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create bench consumer: %w", err)
+	}
+	bucket, err := js.CreateObjectStore(setupCtx, jetstream.ObjectStoreConfig{
+		Bucket: benchCfg.NATS.PayloadBucket,
+		TTL:    time.Hour,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create bench payload bucket: %w", err)
+	}
+	defer js.DeleteObjectStore(setupCtx, benchCfg.NATS.PayloadBucket)
+
+	payloads := natspkg.NewPayloadStore(bucket, nc.MaxPayload())
+	return run(ctx, natspkg.NewPublisher(js, payloads, &benchCfg),
+		natspkg.NewSubscriber(consumer, payloads, nil, &benchCfg, logger), opts)
+}
+
+// recorder collects the samples of a run.
+type recorder struct {
+	mu          sync.Mutex
+	publish     []time.Duration
+	queueWait   []time.Duration
+	endToEnd    []time.Duration
+	completed   map[string]bool
+	redelivered int
+	done        chan struct{}
+	want        int
+}
+
+func (r *recorder) add(samples *[]time.Duration, d time.Duration) {
+	r.mu.Lock()
+	*samples = append(*samples, d)
+	r.mu.Unlock()
+}
+
+func (r *recorder) complete(id string, endToEnd time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.completed[id] {
+		return
+	}
+	r.completed[id] = true
+	r.endToEnd = append(r.endToEnd, endToEnd)
+	if len(r.completed) == r.want {
+		close(r.done)
+	}
+}
+
+func run(ctx context.Context, pub *natspkg.Publisher, sub *natspkg.Subscriber, opts Options) (*Report, error) {
+	rec := &recorder{completed: make(map[string]bool), done: make(chan struct{}), want: opts.Jobs}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	subCtx, stopSub := context.WithCancel(ctx)
+	defer stopSub()
+	go func() { _ = sub.Subscribe(subCtx, handler(opts, rec)) }()
+
+	report := &Report{Options: opts, StartedAt: time.Now().UTC()}
+	start := time.Now()
+	var interval time.Duration
+	if opts.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.Rate)
+	}
+	messages := []string{"bench: synthetic job"}
+	if opts.MessageBytes > 0 {
+		messages = []string{strings.Repeat("x", opts.MessageBytes)}
+	}
+	for i := 0; i < opts.Jobs; i++ {
+		if interval > 0 {
+			if wait := time.Until(start.Add(time.Duration(i) * interval)); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return finish(report, rec, start), ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+		job := natspkg.BuildJob{
+			RepoURL:        "https://github.com/bench/monorepo",
+			SHA:            fmt.Sprintf("%040x", i+1),
+			CommitMessages: messages,
+			InstallationID: 1,
+		}
+		t := time.Now()
+		if _, err := pub.Publish(ctx, job); err != nil {
+			return finish(report, rec, start), fmt.Errorf("publish job %d: %w", i, err)
+		}
+		rec.add(&rec.publish, time.Since(t))
+		report.Published++
+	}
+
+	select {
+	case <-rec.done:
+		return finish(report, rec, start), nil
+	case <-ctx.Done():
+		return finish(report, rec, start), fmt.Errorf("waiting for jobs: %w", ctx.Err())
+	}
+}
+
+// handler simulates the orchestrator: each job's projects are "built" in
+// parallel, at most opts.Concurrency at a time.
+func handler(opts Options, rec *recorder) natspkg.HandlerFunc {
+	return func(ctx context.Context, msg jetstream.Msg, job natspkg.BuildJob) error {
+		rec.add(&rec.queueWait, time.Since(job.PublishedAt))
+		if meta, err := msg.Metadata(); err == nil && meta.NumDelivered > 1 {
+			rec.mu.Lock()
+			rec.redelivered++
+			rec.mu.Unlock()
+		}
+
+		sem := make(chan struct{}, max(opts.Concurrency, 1))
+		var wg sync.WaitGroup
+		for range opts.Projects {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				select {
+				case <-ctx.Done():
+				case <-time.After(opts.BuildTime):
+				}
+			}()
+		}
+		wg.Wait()
+		rec.complete(job.ID, time.Since(job.PublishedAt))
+		return nil
+	}
+}
+
+func finish(report *Report, rec *recorder, start time.Time) *Report {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	report.Elapsed = time.Since(start)
+	report.Completed = len(rec.completed)
+	report.Redelivered = rec.redelivered
+	if secs := report.Elapsed.Seconds(); secs > 0 {
+		report.Throughput = float64(report.Completed) / secs
+	}
+	report.Publish = Summarize(rec.publish)
+	report.QueueWait = Summarize(rec.queueWait)
+	report.EndToEnd = Summarize(rec.endToEnd)
+	return report
+}
@@ -0,0 +1,55 @@
+package bench
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestSummarize(t *testing.T) {
+	var samples []time.Duration
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	got := Summarize(samples)
+	want := Summary{Count: 100, P50: 50, P95: 95, P99: 99, Max: 100}
+	if got != want {
+		t.Errorf("Summarize = %+v, want %+v", got, want)
+	}
+	if samples[0] != 100*time.Millisecond {
+		t.Error("Summarize reordered its input")
+	}
+	if got := Summarize(nil); got != (Summary{}) {
+		t.Errorf("Summarize(nil) = %+v", got)
+	}
+}
+
+// TestRun benchmarks a handful of jobs end to end.
+// Requires NATS_URL (see the nats package integration test).
+func TestRun(t *testing.T) {
+	natsURL := os.Getenv("NATS_URL")
+	if natsURL == "" {
+		t.Skip("NATS_URL not set — skipping integration test")
+	}
+	cfg := &config.Config{
+		NATS:   config.NATSConfig{URL: natsURL, AckWaitSeconds: 30, MaxDelivers: 3},
+		Worker: config.WorkerConfig{HeartbeatSeconds: 5},
+	}
+	report, err := Run(context.Background(), cfg, Options{
+		Jobs: 20, Projects: 3, Concurrency: 2, BuildTime: 5 * time.Millisecond,
+		MessageBytes: 2 << 20, Timeout: 30 * time.Second,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Run: %v (report %+v)", err, report)
+	}
+	if report.Completed != 20 || report.EndToEnd.Count != 20 || report.Publish.Count != 20 {
+		t.Errorf("report = %+v", report)
+	}
+	if report.EndToEnd.P50 < 10 {
+		t.Errorf("end to end p50 = %vms, want at least two 5ms build rounds", report.EndToEnd.P50)
+	}
+}
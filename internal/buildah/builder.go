@@ -1,13 +1,21 @@
 package buildah
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"maps"
 	"os"
-	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/jorgerua/build-system/container-build-service/internal/buildreport"
 	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/cost"
+	"github.com/jorgerua/build-system/container-build-service/internal/procgroup"
+	"github.com/jorgerua/build-system/container-build-service/internal/registryauth"
 	"go.uber.org/zap"
 )
 
@@ -15,20 +23,25 @@ import (
 type Builder struct {
 	cfg    *config.Config
 	driver string // "overlay" or "vfs"
+	auth   *registryauth.Store
 	logger *zap.Logger
+
+	mu   sync.Mutex
+	warm map[string]bool // image IDs kept by PruneImages; see SetWarm
 }
 
 // New creates a Builder and detects the available storage driver.
-func New(cfg *config.Config, logger *zap.Logger) *Builder {
+func New(cfg *config.Config, auth *registryauth.Store, logger *zap.Logger) *Builder {
+	logger = logger.Named("buildah")
 	driver := detectStorageDriver(logger)
 	cfg.Buildah.StorageDriver = driver
-	return &Builder{cfg: cfg, driver: driver, logger: logger}
+	return &Builder{cfg: cfg, driver: driver, auth: auth, logger: logger}
 }
 
 // detectStorageDriver probes for overlay capability at startup.
 // Falls back to vfs if overlay is unavailable.
 func detectStorageDriver(logger *zap.Logger) string {
-	cmd := exec.Command("buildah", "info", "--storage-driver", "overlay")
+	cmd := procgroup.Command(context.Background(), "buildah", "info", "--storage-driver", "overlay")
 	if err := cmd.Run(); err == nil {
 		logger.Info("buildah: using overlay storage driver")
 		return "overlay"
@@ -37,13 +50,62 @@ func detectStorageDriver(logger *zap.Logger) string {
 	return "vfs"
 }
 
+// BuildOptions adjusts a single image build.
+type BuildOptions struct {
+	// NoCache rebuilds every layer and re-pulls base images.
+	NoCache bool
+	// Ignore lists .containerignore patterns excluded from the build
+	// context, overriding any ignore file in the repository.
+	Ignore []string
+	// BuildArgs are passed as --build-arg; the Dockerfile must declare
+	// them with ARG.
+	BuildArgs map[string]string
+	// Secrets are passed as --secret, for the Dockerfile to mount with
+	// RUN --mount=type=secret.
+	Secrets []config.BuildSecret
+	// Network is passed as --network ("none", "host" or a CNI network)
+	// unless empty; DNS and DNSSearch as --dns and --dns-search, AddHosts
+	// ("host:IP") as --add-host.
+	Network   string
+	DNS       []string
+	DNSSearch []string
+	AddHosts  []string
+	// Target stops the build at the named stage (--target).
+	Target string
+}
+
+// LayerCache counts the steps of a build and how many of them reused a
+// cached layer. FROM steps are not counted.
+type LayerCache struct {
+	Steps  int
+	Cached int
+}
+
+var (
+	stepLine  = regexp.MustCompile(`(?m)^(?:\[\d+/\d+\] )?STEP \d+/\d+: (\S+)`)
+	cacheLine = regexp.MustCompile(`(?m)^--> Using cache `)
+)
+
+// parseLayerCache reads the layer cache use of a build from its output.
+func parseLayerCache(stdout string) LayerCache {
+	var lc LayerCache
+	for _, m := range stepLine.FindAllStringSubmatch(stdout, -1) {
+		if !strings.EqualFold(m[1], "FROM") {
+			lc.Steps++
+		}
+	}
+	lc.Cached = len(cacheLine.FindAllStringIndex(stdout, -1))
+	return lc
+}
+
 // Build writes the generated Dockerfile to a temp file, runs buildah bud,
-// then removes the temp file regardless of outcome.
-func (b *Builder) Build(ctx context.Context, jobID, project, imageRef, repoDir, dockerfileContent string) error {
+// then removes the temp file regardless of outcome. It reports how much of
+// the build the layer cache served.
+func (b *Builder) Build(ctx context.Context, jobID, project, imageRef, repoDir, dockerfileContent string, opts BuildOptions) (LayerCache, error) {
 	// Write Dockerfile to temp file.
 	dfPath := fmt.Sprintf("/tmp/dockerfile-%s-%s", jobID, project)
 	if err := os.WriteFile(dfPath, []byte(dockerfileContent), 0600); err != nil {
-		return fmt.Errorf("write dockerfile: %w", err)
+		return LayerCache{}, fmt.Errorf("write dockerfile: %w", err)
 	}
 	defer os.Remove(dfPath)
 
@@ -53,10 +115,46 @@ func (b *Builder) Build(ctx context.Context, jobID, project, imageRef, repoDir,
 		"--root", b.cfg.Buildah.StorageRoot,
 		"-f", dfPath,
 		"-t", imageRef,
-		repoDir,
 	}
+	if opts.NoCache {
+		args = append(args, "--no-cache", "--pull=always")
+	}
+	if len(opts.Ignore) > 0 {
+		ignorePath := dfPath + ".ignore"
+		if err := os.WriteFile(ignorePath, []byte(strings.Join(opts.Ignore, "\n")+"\n"), 0600); err != nil {
+			return LayerCache{}, fmt.Errorf("write ignore file: %w", err)
+		}
+		defer os.Remove(ignorePath)
+		args = append(args, "--ignorefile", ignorePath)
+	}
+	for _, name := range slices.Sorted(maps.Keys(opts.BuildArgs)) {
+		args = append(args, "--build-arg", name+"="+opts.BuildArgs[name])
+	}
+	if opts.Network != "" {
+		args = append(args, "--network", opts.Network)
+	}
+	for _, dns := range opts.DNS {
+		args = append(args, "--dns", dns)
+	}
+	for _, domain := range opts.DNSSearch {
+		args = append(args, "--dns-search", domain)
+	}
+	for _, host := range opts.AddHosts {
+		args = append(args, "--add-host", host)
+	}
+	for _, s := range opts.Secrets {
+		args = append(args, "--secret", "id="+s.ID+",src="+s.File)
+	}
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	args = append(args, repoDir)
 
-	stdout, stderr, err := b.run(ctx, args)
+	if dir := b.cfg.Buildah.CacheMountDir; dir != "" {
+		// Buildah keeps cache mounts under TMPDIR.
+		ctx = procgroup.WithTempDir(ctx, dir)
+	}
+	stdout, stderr, err := b.runLogged(ctx, args)
 	b.logger.Info("buildah bud",
 		zap.String("project", project),
 		zap.String("image", imageRef),
@@ -68,22 +166,35 @@ func (b *Builder) Build(ctx context.Context, jobID, project, imageRef, repoDir,
 			zap.String("stderr", stderr),
 			zap.Error(err),
 		)
-		return fmt.Errorf("buildah bud: %w", err)
+		return parseLayerCache(stdout), fmt.Errorf("buildah bud: %w", err)
 	}
-	return nil
+	return parseLayerCache(stdout), nil
 }
 
-// Push runs buildah push to send the built image to the registry.
-func (b *Builder) Push(ctx context.Context, project, imageRef string) error {
+// Push runs buildah push to send the built image to the registry and
+// returns the digest of the pushed manifest.
+func (b *Builder) Push(ctx context.Context, project, imageRef string) (string, error) {
+	digestFile, err := os.CreateTemp(procgroup.TempDir(ctx), "digest-"+project+"-")
+	if err != nil {
+		return "", fmt.Errorf("create digest file: %w", err)
+	}
+	digestFile.Close()
+	defer os.Remove(digestFile.Name())
+
+	auth, err := b.authArgs(ctx)
+	if err != nil {
+		return "", err
+	}
 	args := []string{
 		"push",
 		"--storage-driver", b.driver,
 		"--root", b.cfg.Buildah.StorageRoot,
+		"--digestfile", digestFile.Name(),
 		imageRef,
-		"--authfile", b.cfg.Registry.AuthFile,
 	}
+	args = append(args, auth...)
 
-	stdout, stderr, err := b.run(ctx, args)
+	stdout, stderr, err := b.runLogged(ctx, args)
 	b.logger.Info("buildah push",
 		zap.String("project", project),
 		zap.String("image", imageRef),
@@ -95,21 +206,69 @@ func (b *Builder) Push(ctx context.Context, project, imageRef string) error {
 			zap.String("stderr", stderr),
 			zap.Error(err),
 		)
-		return fmt.Errorf("buildah push: %w", err)
+		return "", fmt.Errorf("buildah push: %w", err)
 	}
-	return nil
+
+	digest, err := os.ReadFile(digestFile.Name())
+	if err != nil {
+		return "", fmt.Errorf("read digest file: %w", err)
+	}
+	return strings.TrimSpace(string(digest)), nil
 }
 
+// run runs buildah, keeping its whole output.
 func (b *Builder) run(ctx context.Context, args []string) (stdout, stderr string, err error) {
-	var stdoutBuf, stderrBuf bytes.Buffer
-	cmd := exec.CommandContext(ctx, "buildah", args...)
+	return b.exec(ctx, args, nil)
+}
+
+// runLogged runs a buildah build step, whose output counts towards the
+// build's log budget; see WithLogBudget. Output past the budget is dropped
+// with a marker, from the returned output and the logs alike.
+func (b *Builder) runLogged(ctx context.Context, args []string) (stdout, stderr string, err error) {
+	return b.exec(ctx, args, logBudgetFrom(ctx))
+}
+
+func (b *Builder) exec(ctx context.Context, args []string, budget *LogBudget) (stdout, stderr string, err error) {
+	stdoutBuf, stderrBuf := cappedBuffer{budget: budget}, cappedBuffer{budget: budget}
+	cmd := procgroup.Command(ctx, "buildah", args...)
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
+	start := time.Now()
 	err = cmd.Run()
+	buildreport.RecordCommand(ctx, "buildah", args, start, err)
+	cost.AddProcess(ctx, cmd.ProcessState)
+	procgroup.Track(ctx, cmd)
+	budget.drop(stdoutBuf.dropped() + stderrBuf.dropped())
+	if err != nil {
+		err = &CommandError{Err: err, output: tail(stdoutBuf.String(), maxErrorOutput) + tail(stderrBuf.String(), maxErrorOutput)}
+	}
 	return stdoutBuf.String(), stderrBuf.String(), err
 }
 
-// ImageRef builds the full image reference: registry/project:version.
-func ImageRef(registry, project, version string) string {
-	return fmt.Sprintf("%s/%s:%s", registry, project, version)
+// maxErrorOutput bounds each output stream kept on a CommandError.
+const maxErrorOutput = 16 << 10
+
+// CommandError is a failed buildah command. It keeps the end of the
+// command's output for failure diagnosis.
+type CommandError struct {
+	Err    error
+	output string
+}
+
+func (e *CommandError) Error() string { return e.Err.Error() }
+func (e *CommandError) Unwrap() error { return e.Err }
+
+// Output returns the tail of the command's stdout followed by its stderr.
+func (e *CommandError) Output() string { return e.output }
+
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
+
+// ImageRef builds the full image reference: registry/repository:version.
+func ImageRef(registry, repository, version string) string {
+	return fmt.Sprintf("%s/%s:%s", registry, repository, version)
 }
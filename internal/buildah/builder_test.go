@@ -0,0 +1,27 @@
+package buildah
+
+import "testing"
+
+func TestParseLayerCache(t *testing.T) {
+	stdout := `[1/2] STEP 1/4: FROM golang:1.26-bookworm AS builder
+[1/2] STEP 2/4: WORKDIR /src
+--> Using cache 3f1c2a
+--> 3f1c2a
+[1/2] STEP 3/4: COPY go.mod go.sum ./
+--> Using cache 9b8d7e
+--> 9b8d7e
+[1/2] STEP 4/4: RUN go build -o /out/app ./apps/api
+--> a1b2c3
+[2/2] STEP 1/2: FROM gcr.io/distroless/static-debian12
+[2/2] STEP 2/2: COPY --from=builder /out/app /app
+[2/2] COMMIT registry/api:1.2.0
+--> d4e5f6
+`
+	got := parseLayerCache(stdout)
+	if got != (LayerCache{Steps: 4, Cached: 2}) {
+		t.Errorf("parseLayerCache = %+v, want 4 steps, 2 cached", got)
+	}
+	if got := parseLayerCache("STEP 1/2: FROM alpine\nSTEP 2/2: RUN true\n--> 01ab\n"); got != (LayerCache{Steps: 1}) {
+		t.Errorf("single stage = %+v, want 1 step, 0 cached", got)
+	}
+}
@@ -0,0 +1,95 @@
+package buildah
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// cacheMounts returns the cache mount directories under dir, the
+// buildah.cache_mount_dir. Buildah keeps each mount in
+// buildah-cache-<uid>/<hash of the mount ID>.
+func cacheMounts(dir string) ([]string, error) {
+	parents, err := filepath.Glob(filepath.Join(dir, "buildah-cache-*"))
+	if err != nil {
+		return nil, err
+	}
+	var mounts []string
+	for _, parent := range parents {
+		entries, err := os.ReadDir(parent)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				mounts = append(mounts, filepath.Join(parent, e.Name()))
+			}
+		}
+	}
+	return mounts, nil
+}
+
+// lastWrite returns the newest modification time under dir.
+func lastWrite(dir string) (time.Time, error) {
+	var newest time.Time
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest, err
+}
+
+// PruneCacheMounts removes the builds' cache mounts last written before
+// cutoff, so caches of retired languages, paths and repositories do not
+// grow the worker's disk forever. With dryRun it only reports how many
+// would be removed. A mount idle for that long is not expected to be in
+// use; a build that mounts it next starts with an empty cache.
+func (b *Builder) PruneCacheMounts(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	if b.cfg.Buildah.CacheMountDir == "" {
+		return 0, nil
+	}
+	mounts, err := cacheMounts(b.cfg.Buildah.CacheMountDir)
+	if err != nil {
+		return 0, fmt.Errorf("list cache mounts: %w", err)
+	}
+	removed := 0
+	for _, dir := range mounts {
+		if ctx.Err() != nil {
+			return removed, ctx.Err()
+		}
+		written, err := lastWrite(dir)
+		if err != nil {
+			b.logger.Warn("cache mount scan failed", zap.String("dir", dir), zap.Error(err))
+			continue
+		}
+		if written.After(cutoff) {
+			continue
+		}
+		if !dryRun {
+			if err := os.RemoveAll(dir); err != nil {
+				b.logger.Warn("cache mount removal failed", zap.String("dir", dir), zap.Error(err))
+				continue
+			}
+		}
+		removed++
+	}
+	return removed, nil
+}
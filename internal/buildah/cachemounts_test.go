@@ -0,0 +1,62 @@
+package buildah
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestPruneCacheMounts(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	mount := func(name string, written time.Time) string {
+		path := filepath.Join(dir, "buildah-cache-0", name)
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(path, "pkg")
+		if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []string{file, path} {
+			if err := os.Chtimes(p, written, written); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+	stale := mount("stale", old)
+	fresh := mount("fresh", old)
+	if err := os.WriteFile(filepath.Join(fresh, "new"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Buildah.CacheMountDir = dir
+	b := &Builder{cfg: cfg, logger: zap.NewNop()}
+	cutoff := time.Now().Add(-14 * 24 * time.Hour)
+
+	n, err := b.PruneCacheMounts(context.Background(), cutoff, true)
+	if err != nil || n != 1 {
+		t.Fatalf("dry run = %d, %v; want 1", n, err)
+	}
+	if _, err := os.Stat(stale); err != nil {
+		t.Fatalf("dry run removed the mount: %v", err)
+	}
+
+	n, err = b.PruneCacheMounts(context.Background(), cutoff, false)
+	if err != nil || n != 1 {
+		t.Fatalf("prune = %d, %v; want 1", n, err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale mount kept: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("recently written mount removed: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package buildah
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// localImage is the subset of `buildah images --json` output we need.
+type localImage struct {
+	ID      string   `json:"id"`
+	Names   []string `json:"names"`
+	Created int64    `json:"created"` // unix seconds
+}
+
+// PruneImages removes images from the worker's buildah storage that were
+// created before cutoff. With dryRun it only reports how many would be
+// removed. Base images pulled by builds are pruned too and re-pulled on
+// demand, except those in the warm set; see SetWarm.
+func (b *Builder) PruneImages(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	images, err := b.localImages(ctx)
+	if err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	warm := b.warm
+	b.mu.Unlock()
+	removed := 0
+	for _, img := range images {
+		if time.Unix(img.Created, 0).After(cutoff) || warm[img.ID] {
+			continue
+		}
+		if dryRun || b.removeImage(ctx, img) {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// SetWarm replaces the warm set: the IDs of the images PruneImages keeps
+// however old they are, such as the base images pre-pulled for builds.
+func (b *Builder) SetWarm(ids []string) {
+	warm := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		warm[id] = true
+	}
+	b.mu.Lock()
+	b.warm = warm
+	b.mu.Unlock()
+}
+
+// Pull pulls imageRef into the worker's buildah storage and returns the
+// pulled image's ID.
+func (b *Builder) Pull(ctx context.Context, imageRef string) (string, error) {
+	auth, err := b.authArgs(ctx)
+	if err != nil {
+		return "", err
+	}
+	args := append([]string{
+		"pull",
+		"--storage-driver", b.driver,
+		"--root", b.cfg.Buildah.StorageRoot,
+		"--quiet",
+	}, auth...)
+	stdout, stderr, err := b.run(ctx, append(args, imageRef))
+	if err != nil {
+		return "", fmt.Errorf("buildah pull %s: %w: %s", imageRef, err, strings.TrimSpace(stderr))
+	}
+	lines := strings.Fields(stdout)
+	if len(lines) == 0 {
+		return "", fmt.Errorf("buildah pull %s: no image ID in output", imageRef)
+	}
+	return lines[len(lines)-1], nil
+}
+
+// JobImageRef returns the reference of an image that job jobID builds but
+// does not push, such as a compile-only or validation build. It is tagged
+// in the job's namespace of the local storage, which RemoveJobImages
+// clears when the job finishes.
+func JobImageRef(jobID, repository, tag string) string {
+	return ImageRef("localhost", jobNamespace(jobID)+"/"+repository, tag)
+}
+
+// jobNamespace returns the repository prefix of job jobID's images, in the
+// lowercase characters image names allow.
+func jobNamespace(jobID string) string {
+	ns := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, jobID)
+	return "jobs/" + ns
+}
+
+// RemoveJobImages removes the images tagged in job jobID's namespace and
+// returns how many were removed.
+func (b *Builder) RemoveJobImages(ctx context.Context, jobID string) (int, error) {
+	images, err := b.localImages(ctx)
+	if err != nil {
+		return 0, err
+	}
+	prefix := "localhost/" + jobNamespace(jobID) + "/"
+	removed := 0
+	for _, img := range images {
+		if slices.ContainsFunc(img.Names, func(name string) bool { return strings.HasPrefix(name, prefix) }) && b.removeImage(ctx, img) {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// localImages lists the images in the worker's buildah storage.
+func (b *Builder) localImages(ctx context.Context) ([]localImage, error) {
+	stdout, stderr, err := b.run(ctx, []string{
+		"images",
+		"--storage-driver", b.driver,
+		"--root", b.cfg.Buildah.StorageRoot,
+		"--json",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("buildah images: %w: %s", err, stderr)
+	}
+	var images []localImage
+	if stdout != "" {
+		if err := json.Unmarshal([]byte(stdout), &images); err != nil {
+			return nil, fmt.Errorf("decode buildah images: %w", err)
+		}
+	}
+	return images, nil
+}
+
+// removeImage removes img from the worker's buildah storage and reports
+// whether it was removed.
+func (b *Builder) removeImage(ctx context.Context, img localImage) bool {
+	_, stderr, err := b.run(ctx, []string{
+		"rmi",
+		"--storage-driver", b.driver,
+		"--root", b.cfg.Buildah.StorageRoot,
+		img.ID,
+	})
+	if err != nil {
+		// Images still referenced by a running build cannot be removed; skip them.
+		b.logger.Warn("buildah rmi failed",
+			zap.String("image_id", img.ID),
+			zap.Strings("names", img.Names),
+			zap.String("stderr", stderr),
+			zap.Error(err),
+		)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package buildah
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestJobImageRef(t *testing.T) {
+	got := JobImageRef("01HZX3K9QW8E5V7T2M4N6P8R0S", "untrusted/api", "abc123def456")
+	want := "localhost/jobs/01hzx3k9qw8e5v7t2m4n6p8r0s/untrusted/api:abc123def456"
+	if got != want {
+		t.Errorf("JobImageRef = %q, want %q", got, want)
+	}
+	if got := jobNamespace("retry:Job/1"); got != "jobs/retry-job-1" {
+		t.Errorf("jobNamespace = %q", got)
+	}
+}
+
+// fakeBuildah puts a buildah on PATH that lists images as images.json in
+// dir and logs the image IDs removed to rmi.log; removing "busy" fails.
+func fakeBuildah(t *testing.T, images string) (dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	script := fmt.Sprintf(`#!/bin/sh
+case "$1" in
+images) cat %[1]s/images.json ;;
+rmi) for a; do id=$a; done; [ "$id" = busy ] && exit 1; echo "$id" >> %[1]s/rmi.log ;;
+esac
+`, dir)
+	if err := os.WriteFile(filepath.Join(dir, "buildah"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "images.json"), []byte(images), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestPruneImages(t *testing.T) {
+	now := time.Now()
+	created := func(age time.Duration) int64 { return now.Add(-age).Unix() }
+	dir := fakeBuildah(t, fmt.Sprintf(`[
+		{"id": "old", "names": ["localhost/api:1.0.0"], "created": %d},
+		{"id": "busy", "names": ["localhost/web:1.0.0"], "created": %d},
+		{"id": "warm", "names": ["docker.io/library/golang:1.26"], "created": %d},
+		{"id": "new", "names": ["localhost/api:1.1.0"], "created": %d}
+	]`, created(30*24*time.Hour), created(30*24*time.Hour), created(30*24*time.Hour), created(time.Hour)))
+
+	b := &Builder{cfg: &config.Config{}, driver: "vfs", logger: zap.NewNop()}
+	b.SetWarm([]string{"warm"})
+	cutoff := now.Add(-14 * 24 * time.Hour)
+
+	n, err := b.PruneImages(context.Background(), cutoff, true)
+	if err != nil || n != 2 {
+		t.Fatalf("dry run = %d, %v; want 2", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rmi.log")); !os.IsNotExist(err) {
+		t.Fatalf("dry run removed images: %v", err)
+	}
+
+	// An image a running build still uses is skipped, not counted.
+	n, err = b.PruneImages(context.Background(), cutoff, false)
+	if err != nil || n != 1 {
+		t.Fatalf("prune = %d, %v; want 1", n, err)
+	}
+	removed, err := os.ReadFile(filepath.Join(dir, "rmi.log"))
+	if ids := strings.Fields(string(removed)); err != nil || len(ids) != 1 || ids[0] != "old" {
+		t.Errorf("removed %q, %v; want old", removed, err)
+	}
+}
@@ -0,0 +1,100 @@
+package buildah
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// LogBudget bounds the build output kept for one build, across its
+// commands and attempts, so a runaway build cannot exhaust the worker's
+// memory or flood the logs. It is safe for concurrent use; a nil
+// LogBudget keeps everything.
+type LogBudget struct {
+	mu        sync.Mutex
+	remaining int64
+	dropped   int64
+}
+
+type logBudgetKey struct{}
+
+// WithLogBudget returns a context whose buildah build output is limited to
+// limit bytes by a new LogBudget. A limit of 0 or less keeps everything.
+func WithLogBudget(ctx context.Context, limit int64) (context.Context, *LogBudget) {
+	if limit <= 0 {
+		return ctx, nil
+	}
+	lb := &LogBudget{remaining: limit}
+	return context.WithValue(ctx, logBudgetKey{}, lb), lb
+}
+
+func logBudgetFrom(ctx context.Context) *LogBudget {
+	lb, _ := ctx.Value(logBudgetKey{}).(*LogBudget)
+	return lb
+}
+
+// take grants up to n bytes of the budget.
+func (lb *LogBudget) take(n int) int {
+	if lb == nil {
+		return n
+	}
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	n = int(min(int64(n), lb.remaining))
+	lb.remaining -= int64(n)
+	return n
+}
+
+func (lb *LogBudget) drop(n int64) {
+	if lb == nil || n == 0 {
+		return
+	}
+	lb.mu.Lock()
+	lb.dropped += n
+	lb.mu.Unlock()
+}
+
+// Dropped returns how many bytes of output were dropped.
+func (lb *LogBudget) Dropped() int64 {
+	if lb == nil {
+		return 0
+	}
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.dropped
+}
+
+// cappedBuffer is a command output buffer drawing on a LogBudget. Once the
+// budget is spent it keeps only the last maxErrorOutput bytes, for failure
+// diagnosis, and marks the bytes dropped in between.
+type cappedBuffer struct {
+	budget *LogBudget
+	head   bytes.Buffer
+	tail   []byte
+	over   int64 // bytes written after the budget ran out
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	n := c.budget.take(len(p))
+	c.head.Write(p[:n])
+	if rest := p[n:]; len(rest) > 0 {
+		c.over += int64(len(rest))
+		c.tail = append(c.tail, rest...)
+		if extra := len(c.tail) - maxErrorOutput; extra > 0 {
+			c.tail = append(c.tail[:0], c.tail[extra:]...)
+		}
+	}
+	return len(p), nil
+}
+
+// dropped returns how many bytes were written but not kept.
+func (c *cappedBuffer) dropped() int64 { return c.over - int64(len(c.tail)) }
+
+func (c *cappedBuffer) String() string {
+	d := c.dropped()
+	if d == 0 {
+		return c.head.String() + string(c.tail)
+	}
+	return fmt.Sprintf("%s\n[... %d bytes dropped ...]\n%s", c.head.String(), d, c.tail)
+}
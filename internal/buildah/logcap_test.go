@@ -0,0 +1,40 @@
+package buildah
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCappedBuffer(t *testing.T) {
+	_, budget := WithLogBudget(context.Background(), 10)
+	stdout, stderr := cappedBuffer{budget: budget}, cappedBuffer{budget: budget}
+	stdout.Write([]byte("0123456"))
+	stderr.Write([]byte("abcdef"))
+	if got := stdout.String(); got != "0123456" {
+		t.Errorf("stdout = %q", got)
+	}
+	if got := stderr.String(); got != "abcdef" || stderr.dropped() != 0 {
+		t.Errorf("stderr = %q; the tail within maxErrorOutput is kept", got)
+	}
+
+	big := strings.Repeat("x", maxErrorOutput) + "END"
+	stdout.Write([]byte(big))
+	budget.drop(stdout.dropped() + stderr.dropped())
+	got := stdout.String()
+	if !strings.HasPrefix(got, "0123456\n[... 3 bytes dropped ...]\n") || !strings.HasSuffix(got, "END") {
+		t.Errorf("stdout = %.60q...", got)
+	}
+	if budget.Dropped() != 3 {
+		t.Errorf("dropped = %d; want 3", budget.Dropped())
+	}
+
+	if ctx, lb := WithLogBudget(context.Background(), 0); lb != nil || logBudgetFrom(ctx) != nil {
+		t.Error("a zero limit must not cap the output")
+	}
+	var unlimited cappedBuffer
+	unlimited.Write([]byte(big))
+	if unlimited.String() != big {
+		t.Error("output without a budget was truncated")
+	}
+}
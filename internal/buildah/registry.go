@@ -0,0 +1,126 @@
+package buildah
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/procgroup"
+)
+
+// TagExists reports whether imageRef is already present in the registry.
+// It queries the registry with skopeo so nothing is pulled.
+func (b *Builder) TagExists(ctx context.Context, imageRef string) (bool, error) {
+	auth, err := b.authArgs(ctx)
+	if err != nil {
+		return false, err
+	}
+	args := append([]string{"inspect", "--raw", "docker://" + imageRef}, auth...)
+	var stderr bytes.Buffer
+	cmd := procgroup.Command(ctx, "skopeo", args...)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	procgroup.Track(ctx, cmd)
+	if err != nil {
+		msg := strings.ToLower(stderr.String())
+		if strings.Contains(msg, "manifest unknown") || strings.Contains(msg, "not found") {
+			return false, nil
+		}
+		return false, fmt.Errorf("skopeo inspect %s: %w: %s", imageRef, err, strings.TrimSpace(stderr.String()))
+	}
+	return true, nil
+}
+
+// ImageSize returns the compressed size of a pushed image: the sum of its
+// config and layer blobs as listed in the registry manifest.
+func (b *Builder) ImageSize(ctx context.Context, imageRef string) (int64, error) {
+	auth, err := b.authArgs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	args := append([]string{"inspect", "--raw", "docker://" + imageRef}, auth...)
+	var stderr bytes.Buffer
+	cmd := procgroup.Command(ctx, "skopeo", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	procgroup.Track(ctx, cmd)
+	if err != nil {
+		return 0, fmt.Errorf("skopeo inspect %s: %w: %s", imageRef, err, strings.TrimSpace(stderr.String()))
+	}
+	return manifestSize(out)
+}
+
+// RemoteDigest returns the digest of the manifest imageRef currently points
+// to in its registry, without pulling it. A manifest list has the digest
+// of the list, so a change to any of its platforms changes it.
+func (b *Builder) RemoteDigest(ctx context.Context, imageRef string) (string, error) {
+	auth, err := b.authArgs(ctx)
+	if err != nil {
+		return "", err
+	}
+	args := append([]string{"inspect", "--raw", "docker://" + imageRef}, auth...)
+	var stderr bytes.Buffer
+	cmd := procgroup.Command(ctx, "skopeo", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	procgroup.Track(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("skopeo inspect %s: %w: %s", imageRef, err, strings.TrimSpace(stderr.String()))
+	}
+	return manifestDigest(out), nil
+}
+
+// manifestDigest returns the digest of a raw manifest, as registries
+// compute it.
+func manifestDigest(manifest []byte) string {
+	sum := sha256.Sum256(manifest)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// authArgs returns the --authfile flag of registry commands, with freshly
+// minted tokens for the registries that need them.
+func (b *Builder) authArgs(ctx context.Context) ([]string, error) {
+	path, err := b.auth.AuthFile(ctx)
+	if err != nil || path == "" {
+		return nil, err
+	}
+	return []string{"--authfile", path}, nil
+}
+
+// manifestSize sums the blob sizes of an OCI or Docker v2 image manifest.
+func manifestSize(manifest []byte) (int64, error) {
+	var m struct {
+		Config struct {
+			Size int64 `json:"size"`
+		} `json:"config"`
+		Layers []struct {
+			Size int64 `json:"size"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return 0, fmt.Errorf("decode manifest: %w", err)
+	}
+	if len(m.Layers) == 0 {
+		return 0, fmt.Errorf("manifest lists no layers")
+	}
+	size := m.Config.Size
+	for _, l := range m.Layers {
+		size += l.Size
+	}
+	return size, nil
+}
+
+// SplitTag splits an image reference into repository and tag. The tag is
+// empty when the reference has none.
+func SplitTag(imageRef string) (repository, tag string) {
+	slash := strings.LastIndex(imageRef, "/")
+	colon := strings.LastIndex(imageRef, ":")
+	if colon <= slash {
+		return imageRef, ""
+	}
+	return imageRef[:colon], imageRef[colon+1:]
+}
@@ -0,0 +1,30 @@
+package buildah
+
+import "testing"
+
+func TestSplitTag(t *testing.T) {
+	tests := []struct {
+		ref, repo, tag string
+	}{
+		{"registry.local/api:1.2.3", "registry.local/api", "1.2.3"},
+		{"registry.local:5000/ecom/api:1.0.0", "registry.local:5000/ecom/api", "1.0.0"},
+		{"registry.local:5000/ecom/api", "registry.local:5000/ecom/api", ""},
+	}
+	for _, tc := range tests {
+		repo, tag := SplitTag(tc.ref)
+		if repo != tc.repo || tag != tc.tag {
+			t.Errorf("SplitTag(%q) = %q, %q; want %q, %q", tc.ref, repo, tag, tc.repo, tc.tag)
+		}
+	}
+}
+
+func TestManifestSize(t *testing.T) {
+	manifest := `{"schemaVersion":2,"config":{"size":1500},"layers":[{"size":1000},{"size":250}]}`
+	got, err := manifestSize([]byte(manifest))
+	if err != nil || got != 2750 {
+		t.Errorf("manifestSize = %d, %v; want 2750", got, err)
+	}
+	if _, err := manifestSize([]byte(`{"manifests":[{"size":500}]}`)); err == nil {
+		t.Error("manifestSize accepted an index without layers")
+	}
+}
@@ -0,0 +1,94 @@
+// Package buildenv renders build environment variables whose values are
+// templates over the job being built, such as "{{.CommitHash | short}}".
+// Templates may only use the functions listed in Funcs.
+package buildenv
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Data is what an environment template can reference.
+type Data struct {
+	Branch     string // e.g. "main"; empty when the job does not record it
+	CommitHash string // full commit SHA
+	Project    string // Nx project being built
+	Version    string // version the image is tagged with
+	JobID      string
+	// BuildNumber is the repository's build number; 0 when none was
+	// assigned.
+	BuildNumber int64
+	Repository  Repository
+}
+
+// Repository identifies the repository being built.
+type Repository struct {
+	Owner    string // "acme"
+	Name     string // "shop"
+	FullName string // "acme/shop"
+}
+
+// shortSHA is the length of a commit hash shortened by "short".
+const shortSHA = 12
+
+// Funcs is the function whitelist of environment templates, in addition
+// to text/template's builtins.
+var Funcs = template.FuncMap{
+	"short": func(s string) string {
+		if len(s) > shortSHA {
+			return s[:shortSHA]
+		}
+		return s
+	},
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"trim":    strings.TrimSpace,
+	"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"default": func(def, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+}
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Template is a parsed set of environment variable templates.
+type Template struct {
+	vars map[string]*template.Template
+}
+
+// Parse parses env, a map of variable names to value templates.
+func Parse(env map[string]string) (*Template, error) {
+	t := &Template{vars: make(map[string]*template.Template, len(env))}
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		if !envName.MatchString(name) {
+			return nil, fmt.Errorf("invalid environment variable name %q", name)
+		}
+		tmpl, err := template.New(name).Funcs(Funcs).Option("missingkey=error").Parse(env[name])
+		if err != nil {
+			return nil, fmt.Errorf("env %s: %w", name, err)
+		}
+		t.vars[name] = tmpl
+	}
+	return t, nil
+}
+
+// Render returns the variables with their values rendered for data.
+func (t *Template) Render(data Data) (map[string]string, error) {
+	env := make(map[string]string, len(t.vars))
+	for name, tmpl := range t.vars {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("env %s: %w", name, err)
+		}
+		env[name] = buf.String()
+	}
+	return env, nil
+}
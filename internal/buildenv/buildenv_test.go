@@ -0,0 +1,48 @@
+package buildenv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tmpl, err := Parse(map[string]string{
+		"GIT_COMMIT": "{{.CommitHash | short}}",
+		"BRANCH":     `{{.Branch | default "main" | replace "/" "-"}}`,
+		"APP":        "{{.Repository.Name | upper}}-{{.Project}}",
+		"STATIC":     "plain",
+		"BUILD":      "#{{.BuildNumber}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tmpl.Render(Data{
+		CommitHash:  "0123456789abcdef0123456789abcdef01234567",
+		Project:     "api",
+		BuildNumber: 142,
+		Repository:  Repository{Owner: "acme", Name: "shop", FullName: "acme/shop"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"GIT_COMMIT": "0123456789ab", "BRANCH": "main", "APP": "SHOP-api", "STATIC": "plain", "BUILD": "#142"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Render = %v, want %v", got, want)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"1BAD": "x"},
+		{"OK": "{{.CommitHash"},
+		{"OK": "{{env \"HOME\"}}"}, // not whitelisted
+	} {
+		if _, err := Parse(env); err == nil {
+			t.Errorf("Parse(%v) accepted", env)
+		}
+	}
+	tmpl, _ := Parse(map[string]string{"OK": "{{.Nope}}"})
+	if _, err := tmpl.Render(Data{}); err == nil {
+		t.Error("Render accepted an unknown field")
+	}
+}
@@ -0,0 +1,178 @@
+package buildreport
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/diagnosis"
+	"github.com/jorgerua/build-system/container-build-service/internal/procgroup"
+)
+
+const (
+	// diagnosticsTimeout bounds the commands run for one bundle.
+	diagnosticsTimeout = 30 * time.Second
+	// maxListing caps the entries of each directory listing.
+	maxListing = 5000
+	// maxCommandOutput caps the output kept of each command.
+	maxCommandOutput = 64 << 10
+)
+
+// listingSkip are directories left out of the workspace listing: their
+// content is large and rarely explains a failure.
+var listingSkip = []string{".git", "node_modules"}
+
+// Failure describes a failed project build for its diagnostic bundle.
+type Failure struct {
+	JobID   string
+	Project string
+	Err     error
+	// RepoDir is the job's checkout.
+	RepoDir string
+}
+
+// WriteDiagnostics writes a gzipped tar bundle into dir with what a
+// maintainer needs to debug f without access to the worker: the error with
+// the tail of the failed command's output, the worker's environment with
+// sensitive values masked, disk usage, listings of the workspace and its
+// dist directory, and buildah info. Commands that fail are recorded in the
+// bundle rather than failing it.
+func WriteDiagnostics(ctx context.Context, dir string, f Failure) (Written, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), diagnosticsTimeout)
+	defer cancel()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"error.txt", failureText(f.Err)},
+		{"env.txt", redactedEnv(os.Environ())},
+		{"df.txt", commandOutput(ctx, "df", "-h")},
+		{"workspace.txt", listing(f.RepoDir, listingSkip)},
+		{"dist.txt", listing(filepath.Join(f.RepoDir, "dist"), nil)},
+		{"buildah-info.json", commandOutput(ctx, "buildah", "info")},
+	}
+	for _, file := range files {
+		hdr := &tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.data)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return Written{}, fmt.Errorf("write diagnostics: %w", err)
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return Written{}, fmt.Errorf("write diagnostics: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return Written{}, fmt.Errorf("write diagnostics: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return Written{}, fmt.Errorf("write diagnostics: %w", err)
+	}
+
+	w := Written{
+		Path: filepath.Join(dir, fmt.Sprintf("%s-%s-%d.tar.gz", f.JobID, f.Project, now.Unix())),
+		Size: buf.Len(),
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Written{}, fmt.Errorf("create diagnostics dir: %w", err)
+	}
+	tmp := w.Path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return Written{}, fmt.Errorf("write diagnostics: %w", err)
+	}
+	return w, os.Rename(tmp, w.Path)
+}
+
+// failureText is the error followed by the output of the failed command,
+// when the error carries it.
+func failureText(err error) []byte {
+	if err == nil {
+		return nil
+	}
+	text := err.Error() + "\n"
+	var out diagnosis.OutputError
+	if errors.As(err, &out) {
+		text += "\n--- command output (tail) ---\n" + out.Output()
+	}
+	return []byte(text)
+}
+
+// redactedEnv lists environ sorted, masking the values of sensitive-looking
+// names and credentials embedded in URLs.
+func redactedEnv(environ []string) []byte {
+	lines := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		k, v, _ := strings.Cut(kv, "=")
+		if sensitiveEnv.MatchString(k) && v != "" {
+			v = "***"
+		}
+		lines = append(lines, k+"="+urlCredentials.ReplaceAllString(v, "://***@"))
+	}
+	slices.Sort(lines)
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// commandOutput runs a diagnostic command, returning its combined output
+// or why it failed.
+func commandOutput(ctx context.Context, name string, args ...string) []byte {
+	out, err := procgroup.Command(ctx, name, args...).CombinedOutput()
+	if len(out) > maxCommandOutput {
+		out = out[:maxCommandOutput]
+	}
+	if err != nil {
+		out = append(out, fmt.Sprintf("\n%s failed: %v\n", name, err)...)
+	}
+	return out
+}
+
+// listing walks root, one line per entry with its mode and size, skipping
+// directories named in skip and stopping after maxListing entries.
+func listing(root string, skip []string) []byte {
+	var b strings.Builder
+	n := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Fprintf(&b, "%s: %v\n", path, err)
+			return nil
+		}
+		if d.IsDir() && path != root && slices.Contains(skip, d.Name()) {
+			fmt.Fprintf(&b, "%s/ (skipped)\n", rel(root, path))
+			return filepath.SkipDir
+		}
+		if n++; n > maxListing {
+			fmt.Fprintf(&b, "... truncated after %d entries\n", maxListing)
+			return filepath.SkipAll
+		}
+		info, err := d.Info()
+		if err != nil {
+			fmt.Fprintf(&b, "%s: %v\n", rel(root, path), err)
+			return nil
+		}
+		fmt.Fprintf(&b, "%s %10d %s\n", info.Mode(), info.Size(), rel(root, path))
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(&b, "%v\n", err)
+	}
+	return []byte(b.String())
+}
+
+func rel(root, path string) string {
+	r, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+	return r
+}
@@ -0,0 +1,99 @@
+package buildreport
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type outputError struct{ output string }
+
+func (e *outputError) Error() string  { return "exit status 1" }
+func (e *outputError) Output() string { return e.output }
+
+func TestWriteDiagnostics(t *testing.T) {
+	t.Setenv("CBS_TEST_TOKEN", "s3cret")
+	t.Setenv("CBS_TEST_MIRROR", "https://user:pw@mirror.example.com")
+
+	repo := t.TempDir()
+	for _, p := range []string{"apps/api/main.go", "dist/apps/api/api", ".git/HEAD", "node_modules/x/index.js"} {
+		path := filepath.Join(repo, p)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failure := errors.Join(errors.New("buildah build"), &outputError{output: "npm ERR! missing script: build"})
+	w, err := WriteDiagnostics(context.Background(), t.TempDir(), Failure{
+		JobID: "job1", Project: "api", Err: failure, RepoDir: repo,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(w.Path, ".tar.gz") || !strings.Contains(filepath.Base(w.Path), "job1-api-") {
+		t.Errorf("path = %q", w.Path)
+	}
+
+	files := readBundle(t, w.Path)
+	for _, name := range []string{"error.txt", "env.txt", "df.txt", "workspace.txt", "dist.txt", "buildah-info.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("bundle lacks %s", name)
+		}
+	}
+	if !strings.Contains(files["error.txt"], "npm ERR! missing script") {
+		t.Errorf("error.txt lacks command output:\n%s", files["error.txt"])
+	}
+	env := files["env.txt"]
+	if strings.Contains(env, "s3cret") || !strings.Contains(env, "CBS_TEST_TOKEN=***") {
+		t.Errorf("token not masked:\n%s", env)
+	}
+	if strings.Contains(env, "user:pw") {
+		t.Errorf("URL credentials not masked:\n%s", env)
+	}
+	ws := files["workspace.txt"]
+	if !strings.Contains(ws, "apps/api/main.go") || !strings.Contains(ws, ".git/ (skipped)") ||
+		strings.Contains(ws, "node_modules/x") {
+		t.Errorf("workspace.txt:\n%s", ws)
+	}
+	if !strings.Contains(files["dist.txt"], "apps/api/api") {
+		t.Errorf("dist.txt:\n%s", files["dist.txt"])
+	}
+}
+
+func readBundle(t *testing.T, path string) map[string]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(data)
+	}
+}
@@ -0,0 +1,484 @@
+// Package buildreport collects a machine-readable record of what a build job
+// ran — environment, tool versions, command lines and timings — so builds can
+// be audited and reproduced offline.
+package buildreport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/buildwarn"
+	"github.com/jorgerua/build-system/container-build-service/internal/clock"
+	"github.com/jorgerua/build-system/container-build-service/internal/hostinfo"
+)
+
+// Report is the JSON build report for one job. Its methods are safe for
+// concurrent use and are no-ops on a nil Report, so callers need not check
+// whether reporting is enabled.
+type Report struct {
+	mu    sync.Mutex
+	clock clock.Clock
+
+	JobID           string            `json:"job_id"`
+	Repo            string            `json:"repo"`
+	SHA             string            `json:"sha"`
+	BaseSHA         string            `json:"base_sha,omitempty"`
+	Branch          string            `json:"branch,omitempty"`
+	BranchProtected bool              `json:"branch_protected,omitempty"` // GitHub branch protection
+	Clean           bool              `json:"clean,omitempty"`
+	CompileOnly     bool              `json:"compile_only,omitempty"`
+	BuildConfig     string            `json:"build_config,omitempty"` // effective .ocibuild.yaml, with organization defaults
+	Worker          string            `json:"worker"`
+	Host            *hostinfo.Info    `json:"host,omitempty"`
+	StartedAt       time.Time         `json:"started_at"`
+	FinishedAt      time.Time         `json:"finished_at"`
+	DurationMS      int64             `json:"duration_ms"`
+	Error           string            `json:"error,omitempty"`
+	Tools           map[string]string `json:"tools"`
+	// Toolchains are the runtime versions provisioned for the repository,
+	// by tool.
+	Toolchains map[string]string `json:"toolchains,omitempty"`
+	// ToolchainSources are the archives the toolchains were installed
+	// from, by tool.
+	ToolchainSources map[string]ToolchainSource `json:"toolchain_sources,omitempty"`
+	Env              map[string]string          `json:"env"`
+	// DependencyDownloadBytes is how much the package cache grew while
+	// the workspace was bootstrapped: roughly what was downloaded.
+	DependencyDownloadBytes int64     `json:"dependency_download_bytes,omitempty"`
+	Commands                []Command `json:"commands"`
+	Projects                []Project `json:"projects"`
+}
+
+// ToolchainSource is the archive a provisioned toolchain was installed
+// from and how its digest was verified: "pinned" or "published".
+type ToolchainSource struct {
+	URL      string `json:"url"`
+	SHA256   string `json:"sha256"`
+	Verified string `json:"verified"`
+}
+
+// Command is one executed subprocess.
+type Command struct {
+	Project    string    `json:"project,omitempty"`
+	Args       []string  `json:"args"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Project is the outcome of one project build within the job.
+type Project struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Image    string `json:"image,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// BuildTool is the project's build tool and LanguageSource where its
+	// language came from: "detected", or pinned by "ocibuild.yaml" or the
+	// "registry".
+	BuildTool      string `json:"build_tool,omitempty"`
+	LanguageSource string `json:"language_source,omitempty"`
+	// LayerSteps and LayersCached count the image build's steps and those
+	// served from the layer cache, for the last attempt.
+	LayerSteps   int `json:"layer_steps,omitempty"`
+	LayersCached int `json:"layers_cached,omitempty"`
+	// FailureCategory and FailureHint classify Error; see package diagnosis.
+	FailureCategory string `json:"failure_category,omitempty"`
+	FailureHint     string `json:"failure_hint,omitempty"`
+	// Diagnostics is the path of the failure's diagnostic bundle; see
+	// WriteDiagnostics.
+	Diagnostics string `json:"diagnostics,omitempty"`
+	// LogDroppedBytes is how much build output the log cap dropped.
+	LogDroppedBytes int64 `json:"log_dropped_bytes,omitempty"`
+	// Warnings are the non-fatal findings of the last attempt.
+	Warnings []buildwarn.Warning `json:"warnings,omitempty"`
+}
+
+// New starts a report for a job, timed by clk.
+func New(clk clock.Clock, jobID, repo, sha string, tools map[string]string) *Report {
+	worker, _ := os.Hostname()
+	return &Report{
+		clock:     clk,
+		JobID:     jobID,
+		Repo:      repo,
+		SHA:       sha,
+		Worker:    worker,
+		StartedAt: clk.Now().UTC(),
+		Tools:     tools,
+		Env:       CaptureEnv(os.Environ()),
+	}
+}
+
+type ctxKey struct{}
+
+// WithReport returns a context whose subprocesses are recorded into r.
+func WithReport(ctx context.Context, r *Report) context.Context {
+	return context.WithValue(ctx, ctxKey{}, r)
+}
+
+// FromContext returns the report carried by ctx, or nil.
+func FromContext(ctx context.Context) *Report {
+	r, _ := ctx.Value(ctxKey{}).(*Report)
+	return r
+}
+
+type projectKey struct{}
+
+// WithProject tags commands run under ctx with a project name.
+func WithProject(ctx context.Context, project string) context.Context {
+	return context.WithValue(ctx, projectKey{}, project)
+}
+
+// RecordCommand records a finished subprocess into the report carried by ctx.
+func RecordCommand(ctx context.Context, name string, args []string, start time.Time, err error) {
+	r := FromContext(ctx)
+	if r == nil {
+		return
+	}
+	project, _ := ctx.Value(projectKey{}).(string)
+	c := Command{
+		Project:    project,
+		Args:       redactArgs(append([]string{name}, args...)),
+		StartedAt:  start.UTC(),
+		DurationMS: clock.Since(r.clock, start).Milliseconds(),
+	}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	r.mu.Lock()
+	r.Commands = append(r.Commands, c)
+	r.mu.Unlock()
+}
+
+// SetBase records the base commit the job was diffed against.
+func (r *Report) SetBase(sha string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.BaseSHA = sha
+	r.mu.Unlock()
+}
+
+// SetBranch records the job's branch and whether it is protected.
+func (r *Report) SetBranch(branch string, protected bool) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.Branch, r.BranchProtected = branch, protected
+	r.mu.Unlock()
+}
+
+// SetClean marks the job as built with all caches disabled.
+func (r *Report) SetClean() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.Clean = true
+	r.mu.Unlock()
+}
+
+// SetBuildConfig records the effective .ocibuild.yaml of the job.
+func (r *Report) SetBuildConfig(config string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.BuildConfig = config
+	r.mu.Unlock()
+}
+
+// SetCompileOnly marks the job as a compile-only build.
+func (r *Report) SetCompileOnly() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.CompileOnly = true
+	r.mu.Unlock()
+}
+
+// SetHost records the worker host the job runs on.
+func (r *Report) SetHost(info hostinfo.Info) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.Host = &info
+	r.mu.Unlock()
+}
+
+// SetToolchain records the version of a tool provisioned for the job.
+func (r *Report) SetToolchain(tool, version string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.Toolchains == nil {
+		r.Toolchains = map[string]string{}
+	}
+	r.Toolchains[tool] = version
+	r.mu.Unlock()
+}
+
+// SetToolchainSource records the archive a tool provisioned for the job was
+// installed from.
+func (r *Report) SetToolchainSource(tool string, src ToolchainSource) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.ToolchainSources == nil {
+		r.ToolchainSources = map[string]ToolchainSource{}
+	}
+	r.ToolchainSources[tool] = src
+	r.mu.Unlock()
+}
+
+// ProjectImage records the image pushed for a project.
+func (r *Report) ProjectImage(name, image, digest string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.project(name)
+	p.Image, p.Digest = image, digest
+}
+
+// ProjectLanguage records a project's build tool and where its language
+// came from.
+func (r *Report) ProjectLanguage(name, buildTool, source string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.project(name)
+	p.BuildTool, p.LanguageSource = buildTool, source
+}
+
+// ProjectLayerCache records the layer cache use of a project's image build.
+func (r *Report) ProjectLayerCache(name string, steps, cached int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.project(name)
+	p.LayerSteps, p.LayersCached = steps, cached
+}
+
+// SetDependencyDownload records the package cache growth of the workspace
+// bootstrap.
+func (r *Report) SetDependencyDownload(bytes int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.DependencyDownloadBytes = bytes
+	r.mu.Unlock()
+}
+
+// ProjectResult records the final status of a project build.
+func (r *Report) ProjectResult(name, status string, attempts int, buildErr error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.project(name)
+	p.Status, p.Attempts = status, attempts
+	if buildErr != nil {
+		p.Error = buildErr.Error()
+	}
+}
+
+// ProjectFailure records the diagnosis of a project's failed build.
+func (r *Report) ProjectFailure(name, category, hint string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.project(name)
+	p.FailureCategory, p.FailureHint = category, hint
+}
+
+// ProjectDiagnostics records the diagnostic bundle of a project's failed
+// build.
+func (r *Report) ProjectDiagnostics(name, path string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.project(name).Diagnostics = path
+}
+
+// ProjectLogTruncated records how much of a project's build output the
+// log cap dropped.
+func (r *Report) ProjectLogTruncated(name string, dropped int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.project(name).LogDroppedBytes = dropped
+}
+
+// ProjectWarnings records the warnings of a project's last build attempt.
+func (r *Report) ProjectWarnings(name string, warnings []buildwarn.Warning) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.project(name).Warnings = warnings
+}
+
+// project returns the entry for name, adding it if needed. r.mu must be held.
+func (r *Report) project(name string) *Project {
+	for i := range r.Projects {
+		if r.Projects[i].Name == name {
+			return &r.Projects[i]
+		}
+	}
+	r.Projects = append(r.Projects, Project{Name: name})
+	return &r.Projects[len(r.Projects)-1]
+}
+
+// Written describes a report file written by Finish.
+type Written struct {
+	Path    string
+	Size    int // bytes on disk
+	RawSize int // bytes before compression
+}
+
+// Finish stamps the end time and job error and writes the report to
+// dir/<sha>-<start unix>.json, zstd-compressed at zstdLevel (1-22) into a
+// .json.zst file unless zstdLevel is 0.
+func (r *Report) Finish(dir string, zstdLevel int, jobErr error) (Written, error) {
+	if r == nil {
+		return Written{}, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FinishedAt = r.clock.Now().UTC()
+	r.DurationMS = r.FinishedAt.Sub(r.StartedAt).Milliseconds()
+	if jobErr != nil {
+		r.Error = jobErr.Error()
+	}
+	sort.SliceStable(r.Projects, func(i, j int) bool { return r.Projects[i].Name < r.Projects[j].Name })
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return Written{}, fmt.Errorf("marshal report: %w", err)
+	}
+	w := Written{
+		Path:    filepath.Join(dir, fmt.Sprintf("%s-%d.json", r.SHA, r.StartedAt.Unix())),
+		RawSize: len(data),
+	}
+	if zstdLevel > 0 {
+		if data, err = compress(data, zstdLevel); err != nil {
+			return Written{}, err
+		}
+		w.Path += zstdExt
+	}
+	w.Size = len(data)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Written{}, fmt.Errorf("create report dir: %w", err)
+	}
+	tmp := w.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return Written{}, fmt.Errorf("write report: %w", err)
+	}
+	return w, os.Rename(tmp, w.Path)
+}
+
+// Prune removes the files in dir last written before cutoff, and returns
+// how many it removed (or would remove, in dry-run mode). A missing dir
+// has nothing to prune.
+func Prune(dir string, cutoff time.Time, dryRun bool) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("list %s: %w", dir, err)
+	}
+	removed := 0
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return removed, fmt.Errorf("prune %s: %w", dir, err)
+			}
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// envPrefixes selects the environment variables that influence a build.
+var envPrefixes = []string{"CBS_", "NX_", "NODE_", "NPM_", "BUILDAH_", "GIT_", "GOFLAGS", "GOPROXY", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "PATH"}
+
+var sensitiveEnv = regexp.MustCompile(`(?i)(SECRET|TOKEN|PASSWORD|PASSWD|KEY|DSN|AUTH|CREDENTIAL)`)
+
+// CaptureEnv returns the build-relevant variables of environ with values of
+// sensitive-looking names masked.
+func CaptureEnv(environ []string) map[string]string {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || !hasAnyPrefix(strings.ToUpper(k), envPrefixes) {
+			continue
+		}
+		if sensitiveEnv.MatchString(k) && v != "" {
+			v = "***"
+		}
+		env[k] = v
+	}
+	return env
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+var urlCredentials = regexp.MustCompile(`://[^/@\s]+@`)
+
+// redactArgs masks credentials embedded in URLs, such as clone tokens.
+func redactArgs(args []string) []string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		out[i] = urlCredentials.ReplaceAllString(a, "://***@")
+	}
+	return out
+}
@@ -0,0 +1,37 @@
+package buildreport
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/procgroup"
+)
+
+// versionCommands are the tools whose versions determine build output.
+var versionCommands = map[string][]string{
+	"git":     {"git", "--version"},
+	"buildah": {"buildah", "--version"},
+	"skopeo":  {"skopeo", "--version"},
+	"node":    {"node", "--version"},
+	"nx":      {"nx", "--version"},
+}
+
+// ToolVersions returns the first output line of each tool's version command.
+// Tools that are missing or fail are reported as "unavailable".
+func ToolVersions(ctx context.Context) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	versions := make(map[string]string, len(versionCommands))
+	for tool, argv := range versionCommands {
+		out, err := procgroup.Command(ctx, argv[0], argv[1:]...).Output()
+		if err != nil {
+			versions[tool] = "unavailable"
+			continue
+		}
+		line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		versions[tool] = line
+	}
+	return versions
+}
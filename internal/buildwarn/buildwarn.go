@@ -0,0 +1,109 @@
+// Package buildwarn collects the non-fatal findings of a build, such as a
+// base image the policy only warns about or an unusually large image. Each
+// warning has a severity, and a repository's settings can fail builds on
+// warnings of a given severity or above.
+package buildwarn
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Severity ranks a warning.
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Severities lists the severities, lowest first.
+var Severities = []Severity{SeverityInfo, SeverityWarning, SeverityCritical}
+
+// Valid reports whether s is one of Severities.
+func (s Severity) Valid() bool {
+	return slices.Contains(Severities, s)
+}
+
+// AtLeast reports whether s ranks at or above min. Nothing ranks above an
+// invalid or empty min.
+func (s Severity) AtLeast(min Severity) bool {
+	return min.Valid() && slices.Index(Severities, s) >= slices.Index(Severities, min)
+}
+
+// Warning codes.
+const (
+	// BaseImageNotAllowed: a base image is outside the allowlist of a
+	// base image policy with severity "warn".
+	BaseImageNotAllowed = "base_image_not_allowed"
+	// ColdLayerCache: the layer cache served none of the image build's
+	// steps, though caching was enabled.
+	ColdLayerCache = "cold_layer_cache"
+	// LargeImage: the pushed image is larger than warnings.large_image_mb.
+	// It is found after the push and so never fails a build.
+	LargeImage = "large_image"
+)
+
+// Warning is one finding of a project build.
+type Warning struct {
+	Code     string   `json:"code"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// Collector gathers the warnings of one build attempt. It is safe for
+// concurrent use; a nil Collector discards warnings.
+type Collector struct {
+	mu       sync.Mutex
+	warnings []Warning
+}
+
+type collectorKey struct{}
+
+// WithCollector returns a context whose warnings are gathered into a new
+// Collector.
+func WithCollector(ctx context.Context) (context.Context, *Collector) {
+	c := &Collector{}
+	return context.WithValue(ctx, collectorKey{}, c), c
+}
+
+// FromContext returns the Collector carried by ctx, or nil.
+func FromContext(ctx context.Context) *Collector {
+	c, _ := ctx.Value(collectorKey{}).(*Collector)
+	return c
+}
+
+// Add records a warning into the Collector carried by ctx.
+func Add(ctx context.Context, code string, severity Severity, format string, args ...any) {
+	c := FromContext(ctx)
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.warnings = append(c.warnings, Warning{Code: code, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	c.mu.Unlock()
+}
+
+// Warnings returns the warnings gathered so far, in order.
+func (c *Collector) Warnings() []Warning {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.warnings)
+}
+
+// AtLeast returns the warnings ranking at or above min.
+func AtLeast(warnings []Warning, min Severity) []Warning {
+	var out []Warning
+	for _, w := range warnings {
+		if w.Severity.AtLeast(min) {
+			out = append(out, w)
+		}
+	}
+	return out
+}
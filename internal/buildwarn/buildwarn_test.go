@@ -0,0 +1,46 @@
+package buildwarn
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSeverityAtLeast(t *testing.T) {
+	cases := []struct {
+		s, min Severity
+		want   bool
+	}{
+		{SeverityInfo, SeverityInfo, true},
+		{SeverityWarning, SeverityInfo, true},
+		{SeverityInfo, SeverityWarning, false},
+		{SeverityCritical, SeverityWarning, true},
+		{SeverityWarning, SeverityCritical, false},
+		{SeverityCritical, "", false},
+		{SeverityCritical, "error", false},
+	}
+	for _, tc := range cases {
+		if got := tc.s.AtLeast(tc.min); got != tc.want {
+			t.Errorf("%q.AtLeast(%q) = %v, want %v", tc.s, tc.min, got, tc.want)
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+	// Without a collector, warnings are discarded.
+	Add(context.Background(), LargeImage, SeverityWarning, "ignored")
+
+	ctx, c := WithCollector(context.Background())
+	Add(ctx, ColdLayerCache, SeverityInfo, "%d steps", 7)
+	Add(ctx, LargeImage, SeverityWarning, "image is %d MiB", 2048)
+
+	got := c.Warnings()
+	if len(got) != 2 || got[0].Message != "7 steps" || got[1].Code != LargeImage {
+		t.Fatalf("warnings = %+v", got)
+	}
+	if failing := AtLeast(got, SeverityWarning); len(failing) != 1 || failing[0].Code != LargeImage {
+		t.Errorf("AtLeast(warning) = %+v, want the large image only", failing)
+	}
+	if failing := AtLeast(got, ""); len(failing) != 0 {
+		t.Errorf("AtLeast(\"\") = %+v, want none", failing)
+	}
+}
@@ -0,0 +1,121 @@
+package cachelock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// pollInterval is how often Acquire retries while another holder owns the lock.
+const pollInterval = 500 * time.Millisecond
+
+// Lock is an advisory lock on a cache directory shared between worker pods.
+//
+// It is implemented as an exclusively-created lockfile rather than flock,
+// because flock is unreliable on NFS-backed (ReadWriteMany) volumes.
+// The holder refreshes the lockfile mtime while the lock is held so that
+// other workers can tell a live holder from one that crashed.
+type Lock struct {
+	path        string
+	stopRefresh context.CancelFunc
+	done        chan struct{}
+}
+
+// Acquire blocks until it creates dir/<name>.lock, or ctx is cancelled.
+// A lockfile whose mtime is older than stale is considered abandoned by a
+// crashed worker and is removed before retrying.
+func Acquire(ctx context.Context, dir, name string, stale time.Duration) (*Lock, error) {
+	path := filepath.Join(dir, name+".lock")
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			host, _ := os.Hostname()
+			fmt.Fprintf(f, "host=%s pid=%d acquired=%s\n", host, os.Getpid(), time.Now().UTC().Format(time.RFC3339))
+			f.Close()
+			return newLock(path, stale), nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("create lockfile: %w", err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > stale {
+			// Abandoned by a crashed holder.
+			takeOver(path, info)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// takeovers numbers this process's takeover attempts, for unique names.
+var takeovers atomic.Int64
+
+// takeOver removes the lockfile at path if it is still the stale one
+// observed as info. Removing it by name would race: since the stat,
+// another waiter may have taken it over and created its own lock, which
+// the removal would delete. Instead the file is renamed to a unique name,
+// atomically, and removed only if the moved file is the stale one,
+// unchanged. A live lock moved by mistake is linked back under path,
+// which never replaces a lock another waiter created in the meantime.
+func takeOver(path string, info os.FileInfo) {
+	host, _ := os.Hostname()
+	moved := fmt.Sprintf("%s.stale-%s-%d-%d", path, host, os.Getpid(), takeovers.Add(1))
+	if err := os.Rename(path, moved); err != nil {
+		return // taken over by another waiter, or released
+	}
+	if got, err := os.Stat(moved); err == nil && os.SameFile(got, info) && got.ModTime().Equal(info.ModTime()) {
+		_ = os.Remove(moved)
+		return
+	}
+	if err := os.Link(moved, path); err != nil && !errors.Is(err, os.ErrExist) {
+		// No hard links on this filesystem: rename back instead.
+		_ = os.Rename(moved, path)
+		return
+	}
+	_ = os.Remove(moved)
+}
+
+func newLock(path string, stale time.Duration) *Lock {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Lock{path: path, stopRefresh: cancel, done: make(chan struct{})}
+	go l.refresh(ctx, stale/3)
+	return l
+}
+
+// refresh touches the lockfile periodically so it never looks stale while held.
+func (l *Lock) refresh(ctx context.Context, every time.Duration) {
+	defer close(l.done)
+	if every <= 0 {
+		every = time.Second
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			_ = os.Chtimes(l.path, now, now)
+		}
+	}
+}
+
+// Release stops the refresh loop and removes the lockfile.
+func (l *Lock) Release() error {
+	l.stopRefresh()
+	<-l.done
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove lockfile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package cachelock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquireExclusive(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	l, err := Acquire(ctx, dir, "nx", time.Minute)
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	// A second acquire must block until the first is released.
+	waitCtx, cancel := context.WithTimeout(ctx, 1200*time.Millisecond)
+	defer cancel()
+	if _, err := Acquire(waitCtx, dir, "nx", time.Minute); err == nil {
+		t.Fatal("second acquire should block while lock is held")
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	l2, err := Acquire(ctx, dir, "nx", time.Minute)
+	if err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	_ = l2.Release()
+}
+
+func TestAcquireStale(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nx.lock")
+	if err := os.WriteFile(path, []byte("host=dead pid=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	l, err := Acquire(ctx, dir, "nx", time.Minute)
+	if err != nil {
+		t.Fatalf("stale lock should be taken over: %v", err)
+	}
+	_ = l.Release()
+}
+
+func TestReleaseRemovesLockfile(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Acquire(context.Background(), dir, "nx", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "nx.lock")); !os.IsNotExist(err) {
+		t.Errorf("lockfile still present after release: %v", err)
+	}
+}
+
+func TestTakeOverKeepsNewLock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nx.lock")
+	if err := os.WriteFile(path, []byte("host=dead pid=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another waiter takes the stale lock over after our stat.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("host=live pid=2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	takeOver(path, stale)
+	if b, err := os.ReadFile(path); err != nil || string(b) != "host=live pid=2\n" {
+		t.Fatalf("live lock after takeover = %q, %v", b, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("lock dir holds %d files, want 1", len(entries))
+	}
+
+	// The stale one itself is removed.
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if stale, err = os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	takeOver(path, stale)
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("lock dir holds %d files after takeover, want 0", len(entries))
+	}
+}
+
+func TestAcquireStaleConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nx.lock")
+	if err := os.WriteFile(path, []byte("host=dead pid=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	var (
+		held, most atomic.Int32
+		wg         sync.WaitGroup
+	)
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, err := Acquire(ctx, dir, "nx", time.Second)
+			if err != nil {
+				t.Errorf("acquire: %v", err)
+				return
+			}
+			n := held.Add(1)
+			for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+			}
+			time.Sleep(20 * time.Millisecond)
+			held.Add(-1)
+			if err := l.Release(); err != nil {
+				t.Errorf("release: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if most.Load() != 1 {
+		t.Errorf("%d waiters held the lock at once", most.Load())
+	}
+}
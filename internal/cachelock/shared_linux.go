@@ -0,0 +1,28 @@
+package cachelock
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Filesystem magic numbers (see statfs(2)) for network filesystems commonly
+// backing ReadWriteMany PVCs.
+var sharedFSTypes = map[int64]string{
+	0x6969:     "nfs",
+	0xFF534D42: "cifs",
+	0xFE534D42: "smb2",
+	0x00C36400: "ceph",
+	0x65735546: "fuse", // e.g. EFS utils, s3fs, JuiceFS
+}
+
+// IsShared reports whether dir lives on a network filesystem that may be
+// mounted by several worker pods at once (NFS, CIFS, CephFS, FUSE).
+// hostPath and local volumes report false.
+func IsShared(dir string) (bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return false, fmt.Errorf("statfs %s: %w", dir, err)
+	}
+	_, ok := sharedFSTypes[int64(st.Type)]
+	return ok, nil
+}
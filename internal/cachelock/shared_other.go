@@ -0,0 +1,8 @@
+//go:build !linux
+
+package cachelock
+
+// IsShared always reports false outside Linux; workers only run on Linux.
+func IsShared(dir string) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,198 @@
+// Package cachestats records the size of the worker's caches at intervals,
+// so capacity planning can follow cache growth over time and see when
+// evictions start to cost hit rate.
+package cachestats
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/clock"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/resultcache"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// StatsSource reports the activity of the worker's result cache.
+type StatsSource interface {
+	ResultCacheStats() resultcache.Stats
+}
+
+// Snapshotter periodically records a tidb.CacheSnapshot per cache.
+type Snapshotter struct {
+	cfg     *config.Config
+	results StatsSource
+	snaps   *tidb.CacheSnapshotRepository
+	clock   clock.Clock
+	logger  *zap.Logger
+	worker  string
+}
+
+// New creates a Snapshotter and schedules it on the fx lifecycle.
+func New(cfg *config.Config, results StatsSource, snaps *tidb.CacheSnapshotRepository, clk clock.Clock, logger *zap.Logger, lc fx.Lifecycle) *Snapshotter {
+	worker, _ := os.Hostname()
+	s := &Snapshotter{
+		cfg:     cfg,
+		results: results,
+		snaps:   snaps,
+		clock:   clk,
+		logger:  logger.Named("cachestats"),
+		worker:  worker,
+	}
+	if cfg.Cache.SnapshotIntervalMinutes <= 0 {
+		s.logger.Info("cache snapshots disabled")
+		return s
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			go func() {
+				defer close(done)
+				s.loop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			cancel()
+			<-done
+			return nil
+		},
+	})
+	return s
+}
+
+func (s *Snapshotter) loop(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.cfg.Cache.SnapshotIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		s.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce measures every cache and records the snapshots.
+func (s *Snapshotter) RunOnce(ctx context.Context) {
+	now := s.clock.Now().UTC()
+	var snaps []tidb.CacheSnapshot
+	for _, c := range caches(s.cfg) {
+		bytes, files, err := Measure(c.dir, c.skip)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			s.logger.Warn("cache measurement failed", zap.String("cache", c.name), zap.String("dir", c.dir), zap.Error(err))
+			continue
+		}
+		snap := tidb.CacheSnapshot{Worker: s.worker, Cache: c.name, Bytes: bytes, Files: files, TakenAt: now}
+		if c.name == "results" {
+			st := s.results.ResultCacheStats()
+			snap.Hits, snap.Misses, snap.Evictions = st.Hits, st.Misses, st.Evictions
+		}
+		snaps = append(snaps, snap)
+	}
+	if err := s.snaps.Record(ctx, snaps); err != nil {
+		s.logger.Error("record cache snapshots failed", zap.Error(err))
+		return
+	}
+	s.logger.Info("cache snapshots recorded", zap.Int("caches", len(snaps)))
+}
+
+// cache is a directory measured as one cache.
+type cache struct {
+	name string
+	dir  string
+	skip string // a nested directory measured separately
+}
+
+// caches returns the worker's cache directories: the Nx cache, a package
+// cache per package manager, a toolchain cache per language, the result
+// cache, buildah's image storage and the builds' cache mounts.
+func caches(cfg *config.Config) []cache {
+	// As in the orchestrator's workspace bootstrap.
+	packages := cfg.Bootstrap.CacheDir
+	if packages == "" {
+		packages = filepath.Join(cfg.Cache.Dir, "packages")
+	}
+	var out []cache
+	if cfg.Cache.Dir != "" {
+		out = append(out, cache{name: "nx", dir: cfg.Cache.Dir, skip: packages})
+	}
+	out = append(out, subdirs("packages", packages)...)
+	if cfg.Toolchain.Enabled && cfg.Toolchain.Dir != "" {
+		out = append(out, subdirs("toolchains", cfg.Toolchain.Dir)...)
+	}
+	if cfg.Cache.ResultDir != "" {
+		out = append(out, cache{name: "results", dir: cfg.Cache.ResultDir})
+	}
+	if cfg.Buildah.StorageRoot != "" {
+		out = append(out, cache{name: "buildah", dir: cfg.Buildah.StorageRoot})
+	}
+	if cfg.Buildah.CacheMountDir != "" {
+		out = append(out, cache{name: "mounts", dir: cfg.Buildah.CacheMountDir})
+	}
+	return out
+}
+
+// subdirs returns a cache named prefix/<name> per subdirectory of dir.
+func subdirs(prefix, dir string) []cache {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var out []cache
+	for _, e := range entries {
+		if e.IsDir() {
+			out = append(out, cache{name: prefix + "/" + e.Name(), dir: filepath.Join(dir, e.Name())})
+		}
+	}
+	return out
+}
+
+// Measure returns the size and number of regular files under dir, leaving
+// out skip. Entries that vanish or cannot be read during the walk are left
+// out too.
+func Measure(dir, skip string) (bytes, files int64, err error) {
+	if _, err := os.Stat(dir); err != nil {
+		return 0, 0, err
+	}
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && path == skip {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		bytes += info.Size()
+		files++
+		return nil
+	})
+	return bytes, files, err
+}
+
+// Module provides and starts the Snapshotter via fx.
+var Module = fx.Module("cachestats",
+	fx.Provide(New),
+	fx.Invoke(func(*Snapshotter) {}),
+)
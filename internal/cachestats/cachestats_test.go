@@ -0,0 +1,54 @@
+package cachestats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+func TestCaches(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel string, size int) {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("nx/abc/output.tar", 100)
+	write("nx/packages/npm/_cacache/x", 40)
+	write("nx/packages/pnpm/store/y", 60)
+	write("toolchains/go/1.26/bin/go", 7)
+
+	cfg := &config.Config{}
+	cfg.Cache.Dir = filepath.Join(root, "nx")
+	cfg.Toolchain.Enabled = true
+	cfg.Toolchain.Dir = filepath.Join(root, "toolchains")
+
+	got := map[string][2]int64{}
+	for _, c := range caches(cfg) {
+		bytes, files, err := Measure(c.dir, c.skip)
+		if err != nil {
+			t.Fatalf("measure %s: %v", c.name, err)
+		}
+		got[c.name] = [2]int64{bytes, files}
+	}
+	want := map[string][2]int64{
+		"nx":            {100, 1},
+		"packages/npm":  {40, 1},
+		"packages/pnpm": {60, 1},
+		"toolchains/go": {7, 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("caches = %v, want %v", got, want)
+	}
+	for name, w := range want {
+		if got[name] != w {
+			t.Errorf("%s = %v, want %v", name, got[name], w)
+		}
+	}
+}
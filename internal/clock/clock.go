@@ -0,0 +1,111 @@
+// Package clock abstracts the current time so duration and timestamp logic
+// can be tested without sleeping.
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+)
+
+// Clock tells the current time.
+type Clock interface {
+	Now() time.Time
+	// After sends the current time on the returned channel once d has
+	// elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// Since returns the time elapsed on c since t.
+func Since(c Clock, t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Real is the system clock.
+type Real struct{}
+
+// Now returns time.Now().
+func (Real) Now() time.Time { return time.Now() }
+
+// After returns time.After(d).
+func (Real) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Fake is a Clock that only moves when told to. It is safe for concurrent
+// use.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+// waiter is a pending Fake.After.
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewFake returns a Fake set to t.
+func NewFake(t time.Time) *Fake {
+	return &Fake{now: t}
+}
+
+// Now returns the fake's current time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// After returns a channel that receives the fake's time once it has been
+// moved d past now.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	f.waiters = append(f.waiters, waiter{at: f.now.Add(d), ch: ch})
+	f.fire()
+	return ch
+}
+
+// Advance moves the fake forward by d.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	f.fire()
+}
+
+// Set moves the fake to t.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = t
+	f.fire()
+}
+
+// Waiters returns the number of After channels that have not fired yet,
+// so tests can advance the fake once code is waiting on it.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// fire sends on the waiters that are due. f.mu must be held.
+func (f *Fake) fire() {
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- f.now
+	}
+	f.waiters = pending
+}
+
+// Module provides the system Clock via fx.
+var Module = fx.Module("clock",
+	fx.Provide(func() Clock { return Real{} }),
+)
@@ -0,0 +1,54 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := NewFake(start)
+	if !c.Now().Equal(start) {
+		t.Fatalf("Now = %v, want %v", c.Now(), start)
+	}
+	c.Advance(90 * time.Second)
+	if got := Since(c, start); got != 90*time.Second {
+		t.Errorf("Since = %v, want 1m30s", got)
+	}
+	c.Set(start)
+	if got := Since(c, start); got != 0 {
+		t.Errorf("Since after Set = %v, want 0", got)
+	}
+}
+
+func TestFakeAfter(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := NewFake(start)
+	ch := c.After(time.Minute)
+	if n := c.Waiters(); n != 1 {
+		t.Fatalf("Waiters = %d, want 1", n)
+	}
+	c.Advance(59 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("After fired early")
+	default:
+	}
+	c.Advance(time.Second)
+	select {
+	case got := <-ch:
+		if want := start.Add(time.Minute); !got.Equal(want) {
+			t.Errorf("After sent %v, want %v", got, want)
+		}
+	default:
+		t.Fatal("After did not fire")
+	}
+	if n := c.Waiters(); n != 0 {
+		t.Errorf("Waiters = %d, want 0", n)
+	}
+	select {
+	case <-c.After(0):
+	default:
+		t.Error("After(0) did not fire")
+	}
+}
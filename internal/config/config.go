@@ -1,98 +1,766 @@
 package config
 
-import (
-	"strings"
-
-	"github.com/spf13/viper"
-)
-
 // Config holds all service configuration.
+//
+// Struct tags form the configuration schema: `mapstructure` names the key,
+// `default` supplies its default value and `secret` marks values masked in
+// effective-config dumps ("true" masks the whole value, "dsn" only the
+// password of a MySQL DSN).
 type Config struct {
-	NATS     NATSConfig
-	TiDB     TiDBConfig
-	GitHub   GitHubConfig
-	Registry RegistryConfig
-	Worker   WorkerConfig
-	Buildah  BuildahConfig
-	Metrics  MetricsConfig
+	// Strict rejects configuration files containing unknown keys, so typos
+	// such as "concurrencyy" fail startup instead of being ignored.
+	Strict bool `mapstructure:"strict"`
+
+	Server      ServerConfig
+	NATS        NATSConfig
+	TiDB        TiDBConfig
+	GitHub      GitHubConfig
+	Registry    RegistryConfig
+	Worker      WorkerConfig
+	Buildah     BuildahConfig
+	Cache       CacheConfig
+	Bootstrap   BootstrapConfig
+	Node        NodeConfig
+	Toolchain   ToolchainConfig
+	DotNet      DotNetConfig
+	Gradle      GradleConfig
+	Metrics     MetricsConfig
+	Log         LogConfig
+	Auth        AuthConfig
+	Retention   RetentionConfig
+	Autoscaling AutoscalingConfig
+	Admission   AdmissionConfig
+	Freeze      FreezeConfig
+	Policy      PolicyConfig
+	Cost        CostConfig
+	Propagate   PropagateConfig
+	Events      EventsConfig
+	Warnings    WarningsConfig
+	Proxy       ProxyConfig
+	HTTPClient  HTTPClientConfig `mapstructure:"http_client"`
+	SelfCheck   SelfCheckConfig  `mapstructure:"self_check"`
+	Debug       DebugConfig
+}
+
+// ServerConfig tunes the webhook-server HTTP listener.
+type ServerConfig struct {
+	Port                int `mapstructure:"port" default:"8080"`
+	ReadTimeoutSeconds  int `mapstructure:"read_timeout_seconds" default:"15"`
+	WriteTimeoutSeconds int `mapstructure:"write_timeout_seconds" default:"15"`
+	// IdleTimeoutSeconds closes idle keep-alive connections.
+	IdleTimeoutSeconds int `mapstructure:"idle_timeout_seconds" default:"120"`
+	MaxHeaderBytes     int `mapstructure:"max_header_bytes" default:"1048576"` // 1 MiB
+	// H2C serves HTTP/2 without TLS, for ingresses that speak h2c upstream.
+	H2C bool `mapstructure:"h2c"`
+	// DrainSeconds is how long /readyz reports not-ready on shutdown, with
+	// keep-alives disabled, before in-flight requests are awaited and the
+	// listener closes.
+	DrainSeconds int `mapstructure:"drain_seconds" default:"5"`
+	// LegacyRoutes keeps the unversioned API paths (/webhook, /builds/...)
+	// as deprecated aliases of their /v1 equivalents.
+	LegacyRoutes bool `mapstructure:"legacy_routes" default:"true"`
+	// LegacySunset is the date (YYYY-MM-DD) announced in the Sunset header
+	// of legacy paths. Empty omits the header.
+	LegacySunset string `mapstructure:"legacy_sunset"`
+	// SpoolDir holds webhook build jobs on local disk while NATS is
+	// unreachable; they are published once it is back. Empty disables
+	// spooling: webhooks fail with 503 until NATS recovers.
+	SpoolDir string `mapstructure:"spool_dir"`
+	// IdempotencyKeyHours is how long the response to a request with an
+	// Idempotency-Key header is replayed to retries with the same key.
+	IdempotencyKeyHours int `mapstructure:"idempotency_key_hours" default:"24"`
+	// WebhookConcurrency bounds the webhooks handled at once, signature
+	// validation included. Up to WebhookQueue more wait for a slot, each
+	// for at most WebhookQueueSeconds; the rest are shed with 503 and a
+	// Retry-After header. 0 handles every webhook at once.
+	WebhookConcurrency  int `mapstructure:"webhook_concurrency" default:"32"`
+	WebhookQueue        int `mapstructure:"webhook_queue" default:"256"`
+	WebhookQueueSeconds int `mapstructure:"webhook_queue_seconds" default:"5"`
 }
 
 type NATSConfig struct {
-	URL          string `mapstructure:"url"`
-	StreamName   string `mapstructure:"stream_name"`
-	Subject      string `mapstructure:"subject"`
-	ConsumerName string `mapstructure:"consumer_name"`
+	URL          string `mapstructure:"url" default:"nats://localhost:4222"`
+	StreamName   string `mapstructure:"stream_name" default:"BUILDS"`
+	Subject      string `mapstructure:"subject" default:"builds.jobs"`
+	ConsumerName string `mapstructure:"consumer_name" default:"build-worker"`
 	// AckWait in seconds
-	AckWaitSeconds int `mapstructure:"ack_wait_seconds"`
-	MaxDelivers    int `mapstructure:"max_delivers"`
+	AckWaitSeconds int `mapstructure:"ack_wait_seconds" default:"300"`
+	MaxDelivers    int `mapstructure:"max_delivers" default:"3"`
+	// PayloadBucket is the JetStream object store holding commit messages
+	// of jobs too large for one NATS message.
+	PayloadBucket   string `mapstructure:"payload_bucket" default:"build-job-payloads"`
+	PayloadTTLHours int    `mapstructure:"payload_ttl_hours" default:"168"` // 7 days
+	// ControlBucket is the JetStream key-value bucket holding operator
+	// switches shared by all services, such as the queue pause.
+	ControlBucket string `mapstructure:"control_bucket" default:"build-control"`
 }
 
 type TiDBConfig struct {
-	DSN string `mapstructure:"dsn"`
+	DSN string `mapstructure:"dsn" secret:"dsn"` // password is masked in dumps
+
+	// AutoMigrate applies pending schema migrations on startup. Operators
+	// who review schema changes first disable it and run buildctl migrate.
+	AutoMigrate bool `mapstructure:"auto_migrate" default:"true"`
 }
 
 type GitHubConfig struct {
 	AppID          int64  `mapstructure:"app_id"`
 	PrivateKeyPath string `mapstructure:"private_key_path"`
-	WebhookSecret  string `mapstructure:"webhook_secret"`
+	WebhookSecret  string `mapstructure:"webhook_secret" secret:"true"`
+	// WebhookURL is the public URL of the webhook endpoint, such as
+	// https://cbs.example.com/v1/webhook. When set, onboarding a
+	// repository registers its GitHub webhook through the App, signed with
+	// a secret of its own, so the webhook-server needs the App credentials.
+	WebhookURL string `mapstructure:"webhook_url"`
+	// ForkPullRequests enables validation builds for pull requests opened
+	// from forks. They run untrusted: anonymous clone, build only.
+	ForkPullRequests bool `mapstructure:"fork_pull_requests"`
+	// RepositoryMode is "open" (build any repository the app is installed
+	// on) or "closed" (only repositories onboarded through /repositories).
+	RepositoryMode string `mapstructure:"repository_mode" default:"open"`
+	// SkipEmptyPushes ignores pushes to main that carry no commits, such as
+	// a force-push back to an ancestor, instead of rebuilding their head.
+	SkipEmptyPushes bool `mapstructure:"skip_empty_pushes" default:"true"`
+	// CompileOnlyBranches are branch patterns (path.Match syntax, e.g.
+	// "feature/*") whose pushes get compile-only builds: compiled and
+	// tested, but no image is pushed. Other branches but main are ignored.
+	CompileOnlyBranches []string `mapstructure:"compile_only_branches"`
+	// HookOrigin restricts which addresses may deliver webhooks.
+	HookOrigin HookOriginConfig `mapstructure:"hook_origin"`
+}
+
+// HookOriginConfig rejects webhook requests from outside GitHub's published
+// hook ranges and/or a configured CIDR list, before signature validation.
+// With Meta off and no CIDRs, every origin is accepted.
+type HookOriginConfig struct {
+	// Meta accepts the "hooks" ranges of GitHub's meta API, refetched every
+	// MetaRefreshMinutes.
+	Meta               bool   `mapstructure:"meta"`
+	MetaURL            string `mapstructure:"meta_url" default:"https://api.github.com/meta"`
+	MetaRefreshMinutes int    `mapstructure:"meta_refresh_minutes" default:"60"`
+	// CIDRs are accepted in addition to the meta ranges (e.g. a GitHub
+	// Enterprise Server or a webhook relay).
+	CIDRs []string `mapstructure:"cidrs"`
+	// TrustedProxies are the CIDRs of load balancers whose X-Forwarded-For
+	// header is used to find the client address.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type RegistryConfig struct {
 	URL      string `mapstructure:"url"`
 	AuthFile string `mapstructure:"auth_file"`
+	// Images overrides the registry and image name used for a repository's
+	// projects. Projects without a mapping are pushed to URL/<project>.
+	Images []ImageMapping `mapstructure:"images"`
+	// ImmutableTags refuses to push a tag that already exists in the
+	// registry, so a released version is never silently replaced.
+	ImmutableTags bool `mapstructure:"immutable_tags"`
+	// ProtectedImmutableTags enforces ImmutableTags for jobs on protected
+	// branches even when it is off.
+	ProtectedImmutableTags bool `mapstructure:"protected_immutable_tags"`
+	// MutableTags lists tag patterns (path.Match syntax, e.g. "latest",
+	// "main-*") that may still be overwritten when ImmutableTags is set.
+	MutableTags []string `mapstructure:"mutable_tags"`
+	// Credentials mint short-lived registry tokens, such as ECR's 12-hour
+	// authorization tokens, refreshed before they expire. They are merged
+	// over the entries of AuthFile.
+	Credentials []RegistryCredential `mapstructure:"credentials"`
+}
+
+// RegistryCredential mints the credentials of one registry host.
+type RegistryCredential struct {
+	// Registry is the host the credentials are for, e.g.
+	// "123456789012.dkr.ecr.eu-west-1.amazonaws.com".
+	Registry string `mapstructure:"registry"`
+	// Provider is "ecr" (AWS GetAuthorizationToken with the credentials of
+	// the environment, web identity, the container credentials endpoint or
+	// the instance role) or "gcp" (the access token of the metadata
+	// server's default service account).
+	Provider string `mapstructure:"provider"`
+	// Region is the AWS region of an ECR registry; by default it is read
+	// from the registry host.
+	Region string `mapstructure:"region"`
 }
 
 type WorkerConfig struct {
-	Concurrency        int `mapstructure:"concurrency"`
-	MaxBuildRetries    int `mapstructure:"max_build_retries"`
-	StaleClaimMinutes  int `mapstructure:"stale_claim_minutes"`
-	HeartbeatSeconds   int `mapstructure:"heartbeat_seconds"`
+	Concurrency       int `mapstructure:"concurrency" default:"3"`
+	MaxBuildRetries   int `mapstructure:"max_build_retries" default:"3"`
+	StaleClaimMinutes int `mapstructure:"stale_claim_minutes" default:"30"`
+	HeartbeatSeconds  int `mapstructure:"heartbeat_seconds" default:"120"` // 2 minutes
+	// JobTTLHours expires jobs queued longer, such as those of an
+	// offboarded repository or queued behind a pause of days: they are
+	// recorded as skipped ("expired") instead of built. Build records
+	// pending longer are marked expired by retention. 0 disables expiry.
+	JobTTLHours int `mapstructure:"job_ttl_hours" default:"72"`
+	// DurationAnomalyFactor flags builds slower than factor × p95 of the
+	// project's recent successful builds. 0 disables the check.
+	DurationAnomalyFactor float64 `mapstructure:"duration_anomaly_factor" default:"1.5"`
+	// CheckoutVerification compares the cloned HEAD with the webhook's head
+	// commit: "off", "warn" (log only), or "enforce" (skip the job).
+	CheckoutVerification string `mapstructure:"checkout_verification" default:"warn"`
+	// ReportDir receives a JSON build report per job (environment, tool
+	// versions, commands and timings). Empty disables reports.
+	ReportDir string `mapstructure:"report_dir"`
+	// ReportZstdLevel compresses reports with zstd at this level (1-22);
+	// 0 writes plain JSON.
+	ReportZstdLevel int `mapstructure:"report_zstd_level" default:"3"`
+	// DiagnosticsDir receives a diagnostic bundle per failed project build
+	// (error output, redacted environment, disk usage, workspace listing,
+	// buildah info). Empty disables bundles.
+	DiagnosticsDir string `mapstructure:"diagnostics_dir"`
+	// CommitFetchWindowSeconds is how long a pushed commit missing from the
+	// clone is re-fetched by SHA before the job fails with commit not found.
+	CommitFetchWindowSeconds int `mapstructure:"commit_fetch_window_seconds" default:"30"`
+	// ReachabilityTimeoutSeconds bounds the git ls-remote probe run when a
+	// job is received. A repository that does not answer in time fails the
+	// job at once instead of its clone being retried; 0 disables the probe.
+	ReachabilityTimeoutSeconds int `mapstructure:"reachability_timeout_seconds" default:"10"`
+	// GitMirrorDir keeps a bare mirror per repository. Job workspaces are
+	// cloned from it with hardlinked objects, so only new commits cross the
+	// network. It should share a filesystem with /tmp; empty disables.
+	GitMirrorDir string `mapstructure:"git_mirror_dir" default:"/tmp/git-mirrors"`
+	// WorkspaceDir holds a directory per job with the repository checkout
+	// and the TMPDIR of the job's tools.
+	WorkspaceDir string `mapstructure:"workspace_dir" default:"/tmp"`
+	// WorkspaceQuotaMB fails a job's builds once its workspace grows past
+	// this size, measured every WorkspaceCheckSeconds. 0 disables the quota.
+	WorkspaceQuotaMB      int `mapstructure:"workspace_quota_mb"`
+	WorkspaceCheckSeconds int `mapstructure:"workspace_check_seconds" default:"15"`
+	// FailureRules classify failed builds by their output, ahead of the
+	// built-in rules (out of memory, disk full, registry auth, ...).
+	FailureRules []FailureRule `mapstructure:"failure_rules"`
+	// BuildEnv is passed to every image build as build arguments. Values
+	// are templates over the job, e.g. "{{.CommitHash | short}}"; see
+	// package buildenv. .ocibuild.yaml's build.env overrides it.
+	BuildEnv map[string]string `mapstructure:"build_env"`
+	// PreflightSkip consumes builds without checking binaries, directories,
+	// the registry and NATS at startup. Failed checks are retried every
+	// PreflightRetrySeconds.
+	PreflightSkip         bool `mapstructure:"preflight_skip"`
+	PreflightRetrySeconds int  `mapstructure:"preflight_retry_seconds" default:"30"`
+	// DeterministicSchedule handles one job at a time and builds its
+	// projects one by one, in an order shuffled by ScheduleSeed, so races
+	// between concurrent builds reproduce. For tests and debugging only.
+	DeterministicSchedule bool `mapstructure:"deterministic_schedule"`
+	// ScheduleSeed orders the projects of a deterministic schedule. 0
+	// derives the seed from the job's commit SHA.
+	ScheduleSeed int64 `mapstructure:"schedule_seed"`
+	// Labels describe this worker for repositories' affinity hints, such
+	// as "large-memory" or "gpu".
+	Labels []string `mapstructure:"labels"`
+	// AffinityWaitSeconds is how long a job whose affinity hints this
+	// worker does not meet is left for other workers before it is built
+	// here anyway.
+	AffinityWaitSeconds int `mapstructure:"affinity_wait_seconds" default:"300"`
+	// ShutdownPolicy decides what happens to running builds when the
+	// worker stops: "wait" lets them finish for up to ShutdownWaitMinutes,
+	// then requeues the rest; "requeue" stops them and returns their jobs to
+	// the queue, where another worker rebuilds the unfinished projects;
+	// "abort" stops them and records them as failed.
+	ShutdownPolicy      string `mapstructure:"shutdown_policy" default:"wait"`
+	ShutdownWaitMinutes int    `mapstructure:"shutdown_wait_minutes" default:"30"`
+}
+
+// MaxShutdownWaitMinutes bounds worker.shutdown_wait_minutes; the worker's
+// stop timeout is derived from it.
+const MaxShutdownWaitMinutes = 60
+
+// FailureRule attaches a category and hint to failed builds whose error or
+// output matches Pattern (RE2 syntax).
+type FailureRule struct {
+	Category string `mapstructure:"category"`
+	Pattern  string `mapstructure:"pattern"`
+	Hint     string `mapstructure:"hint"`
 }
 
 type BuildahConfig struct {
-	StorageRoot   string `mapstructure:"storage_root"`
+	StorageRoot   string `mapstructure:"storage_root" default:"/var/lib/buildah"`
 	StorageDriver string `mapstructure:"storage_driver"` // set at startup by detection
+	// SecretsDir holds the build secret files, typically a mounted
+	// Kubernetes Secret. Relative BuildSecret.File paths are resolved in it.
+	SecretsDir string         `mapstructure:"secrets_dir" default:"/var/run/secrets/cbs/build"`
+	Secrets    []BuildSecret  `mapstructure:"secrets"`
+	Networks   []BuildNetwork `mapstructure:"networks"`
+	// CacheMountDir keeps the builds' cache mounts (RUN --mount=type=cache)
+	// across jobs; buildah stores them under buildah-cache-<uid>/ in it.
+	// Empty keeps them in the job's temporary directory, for one job only.
+	CacheMountDir string `mapstructure:"cache_mount_dir" default:"/var/cache/buildah-mounts"`
+	// CachePaths overrides where the dependency caches are mounted in the
+	// builder stage, by cache name: go-mod, go-build, maven, gradle or
+	// nuget.
+	CachePaths map[string]string `mapstructure:"cache_paths"`
+	// MaxLogBytes caps the build output kept per project build, across
+	// its attempts; output past it is dropped with a "N bytes dropped"
+	// marker and the build record notes the truncation. 0 keeps all.
+	MaxLogBytes int64 `mapstructure:"max_log_bytes" default:"33554432"` // 32 MiB
+
+	WarmImages WarmImagesConfig `mapstructure:"warm_images"`
 }
 
-type MetricsConfig struct {
-	DogStatsDAddr string `mapstructure:"dogstatsd_addr"`
+// WarmImagesConfig keeps the base images of the worker's recent builds
+// pulled in its buildah storage, pulling them again when their registry
+// digest changes, so image builds start without a cold pull. Warm images
+// are exempt from retention.local_image_days.
+type WarmImagesConfig struct {
+	// IntervalMinutes is how often the warm set is refreshed. 0 disables it.
+	IntervalMinutes int `mapstructure:"interval_minutes" default:"15"`
+	// MaxImages bounds the warm set; the base images used most by recent
+	// builds are kept.
+	MaxImages int `mapstructure:"max_images" default:"10"`
+	// Images are kept warm whether builds use them or not, in addition to
+	// MaxImages.
+	Images []string `mapstructure:"images"`
+}
+
+// BuildNetwork sets the network of the image builds of the repositories it
+// matches. Match is a repository ("owner/name"), an owner, or "*"; the most
+// specific matching entry applies.
+type BuildNetwork struct {
+	Match string `mapstructure:"match"`
+	// Network is "none" (hermetic builds without network access), "host",
+	// or the name of a CNI network. Empty keeps buildah's default.
+	Network string `mapstructure:"network"`
+	// DNS and DNSSearch override the build containers' resolv.conf.
+	DNS       []string `mapstructure:"dns"`
+	DNSSearch []string `mapstructure:"dns_search"`
+	// AddHosts adds "host:IP" entries to the build containers' /etc/hosts,
+	// for internal hosts missing from DNS.
+	AddHosts []string `mapstructure:"add_hosts"`
+}
+
+// BuildSecret is a credential, such as a private npm token or package
+// index password, mounted into the build steps of the repositories it
+// matches (RUN --mount=type=secret) so it never lands in an image layer.
+// Match is a repository ("owner/name"), an owner, or "*"; for each ID the
+// most specific matching secret applies.
+type BuildSecret struct {
+	Match string `mapstructure:"match"`
+	// ID names the secret; builds read it from /run/secrets/<ID>.
+	ID   string `mapstructure:"id"`
+	File string `mapstructure:"file"`
+	// Env, when set, also exposes the secret to the build steps as this
+	// environment variable.
+	Env string `mapstructure:"env"`
+	// NetrcMachine, when set, also writes the secret to the build steps'
+	// .netrc as the password of NetrcLogin on this host, such as a token
+	// for private Go modules on github.com (login x-access-token).
+	NetrcMachine string `mapstructure:"netrc_machine"`
+	NetrcLogin   string `mapstructure:"netrc_login"`
+	// MavenServer, when set, makes the secret the password of
+	// MavenUsername for the Maven server of this ID in the generated
+	// settings.xml, and for the Gradle repositories of this name. Env must
+	// be set: the password is read from it.
+	MavenServer   string `mapstructure:"maven_server"`
+	MavenUsername string `mapstructure:"maven_username"`
+}
+
+type CacheConfig struct {
+	// Dir is the Nx computation cache directory (NX_CACHE_DIRECTORY).
+	Dir string `mapstructure:"dir" default:"/var/cache/nx"`
+	// Shared controls cross-worker locking of Dir: "auto" (detect network
+	// filesystems), "always", or "never".
+	Shared           string `mapstructure:"shared" default:"auto"`
+	LockStaleSeconds int    `mapstructure:"lock_stale_seconds" default:"600"` // 10 minutes
+	// ResultDir holds worker-local cached results such as the nx affected
+	// project list of a commit range. Empty disables the result cache.
+	ResultDir        string `mapstructure:"result_dir" default:"/tmp/cbs-results"`
+	ResultMaxEntries int    `mapstructure:"result_max_entries" default:"1000"`
+	// SnapshotIntervalMinutes is how often the worker records the size of
+	// its caches for GET /reports/cache. 0 disables snapshots.
+	SnapshotIntervalMinutes int `mapstructure:"snapshot_interval_minutes" default:"1440"` // daily
+}
+
+// BootstrapConfig installs a workspace's node_modules before nx runs.
+type BootstrapConfig struct {
+	Enabled bool `mapstructure:"enabled" default:"true"`
+	// PackageManager is "auto" (detected from the lockfile), "npm", "yarn"
+	// or "pnpm".
+	PackageManager string `mapstructure:"package_manager" default:"auto"`
+	// CacheDir holds the package managers' download caches. Empty uses
+	// <cache.dir>/packages, next to the Nx cache.
+	CacheDir string `mapstructure:"cache_dir"`
+	// FrozenLockfile fails the install when the lockfile is out of date
+	// (npm ci, --frozen-lockfile, --immutable).
+	FrozenLockfile bool `mapstructure:"frozen_lockfile" default:"true"`
+	// Offline installs from the cache only.
+	Offline        bool     `mapstructure:"offline"`
+	TimeoutSeconds int      `mapstructure:"timeout_seconds" default:"900"` // 15 minutes
+	Args           []string `mapstructure:"args"`                          // extra install arguments
+}
+
+// NodeConfig selects the Node.js runtime the workspace bootstrap and nx run
+// with, from the repository's .nvmrc, Volta pin or package.json engines.
+// Repositories that declare none use the worker's node.
+type NodeConfig struct {
+	Enabled bool `mapstructure:"enabled" default:"true"`
+	// ToolchainDir holds the installed runtimes, one v<version> directory
+	// each.
+	ToolchainDir string `mapstructure:"toolchain_dir" default:"/var/cache/toolchains/node"`
+	// DistURL is where runtimes are downloaded from: nodejs.org or a mirror
+	// with the same layout.
+	DistURL string `mapstructure:"dist_url" default:"https://nodejs.org/dist"`
+}
+
+// ToolchainConfig provisions the Go, JDK and .NET SDK versions a repository
+// declares in go.mod, .java-version or global.json, as NodeConfig does for
+// Node.js. The runtimes are on the PATH of the job's commands.
+type ToolchainConfig struct {
+	Enabled bool `mapstructure:"enabled" default:"true"`
+	// Dir holds the installed runtimes under go/, java/ and dotnet/.
+	Dir string `mapstructure:"dir" default:"/var/cache/toolchains"`
+	// GoDistURL serves the Go release list (?mode=json) and archives.
+	GoDistURL string `mapstructure:"go_dist_url" default:"https://go.dev/dl"`
+	// JavaAPIURL is the Adoptium API JDKs are resolved and downloaded with.
+	JavaAPIURL string `mapstructure:"java_api_url" default:"https://api.adoptium.net/v3"`
+	// DotnetFeedURL serves the .NET release-metadata.
+	DotnetFeedURL string `mapstructure:"dotnet_feed_url" default:"https://builds.dotnet.microsoft.com/dotnet"`
+	// Checksums pins the digests of runtime archives, Node.js's included.
+	// A pinned archive must match its pin as well as the digest its
+	// release index publishes.
+	Checksums []ToolchainChecksum `mapstructure:"checksums"`
+	// RequirePinned refuses to install archives without a pinned digest,
+	// and to use runtimes installed from one.
+	RequirePinned bool `mapstructure:"require_pinned"`
+}
+
+// ToolchainChecksum pins the SHA-256 digest of a runtime archive.
+type ToolchainChecksum struct {
+	// File is the archive's file name, such as go1.22.5.linux-amd64.tar.gz.
+	File   string `mapstructure:"file"`
+	SHA256 string `mapstructure:"sha256"`
+}
+
+// DotNetConfig tunes the build step of .NET images.
+type DotNetConfig struct {
+	// FallbackFolders are package folders in the builder image, such as an
+	// offline package store, that NuGet restores from before downloading
+	// (NUGET_FALLBACK_PACKAGES).
+	FallbackFolders []string `mapstructure:"fallback_folders"`
+	// NodeReuse keeps MSBuild worker nodes running after the build. Off,
+	// the default, sets MSBUILDDISABLENODEREUSE: a build container has no
+	// later build to reuse them.
+	NodeReuse bool `mapstructure:"node_reuse"`
+	// Workloads runs dotnet workload restore before the build, installing
+	// the workloads the project needs (such as wasm-tools) into the
+	// dotnet-workloads cache rather than the SDK, so later builds reuse them.
+	Workloads bool `mapstructure:"workloads"`
+}
+
+// GradleConfig tunes the build step of Gradle images.
+type GradleConfig struct {
+	// BuildCache reuses task outputs from Gradle's build cache: the local
+	// one, kept in the gradle dependency cache, and RemoteBuildCacheURL.
+	BuildCache bool `mapstructure:"build_cache" default:"true"`
+	// RemoteBuildCacheURL is an HTTP build cache shared by the workers.
+	RemoteBuildCacheURL string `mapstructure:"remote_build_cache_url"`
+	// RemoteBuildCachePush stores task outputs in the remote cache;
+	// otherwise builds only read it. Untrusted builds never push.
+	RemoteBuildCachePush bool `mapstructure:"remote_build_cache_push"`
+}
+
+// RetentionConfig controls periodic cleanup of old build data.
+// An age of 0 keeps that data type forever. Every worker cleans up its own
+// cache mounts, images, reports and diagnostic bundles; the database is cleaned up by one of
+// them.
+type RetentionConfig struct {
+	IntervalMinutes int  `mapstructure:"interval_minutes" default:"360"` // 0 disables retention
+	DryRun          bool `mapstructure:"dry_run"`
+	// SuccessRecordDays and FailureRecordDays apply to build_records rows;
+	// FailureRecordDays to expired ones too.
+	SuccessRecordDays int `mapstructure:"success_record_days" default:"90"`
+	FailureRecordDays int `mapstructure:"failure_record_days" default:"30"`
+	// ArchiveRecordDays archives completed build_records rows instead:
+	// archived rows are hidden from listings and kept until deleted.
+	ArchiveRecordDays int `mapstructure:"archive_record_days"`
+	// DeletedRecordDays is how long soft-deleted builds can be restored
+	// before they are purged.
+	DeletedRecordDays int `mapstructure:"deleted_record_days" default:"7"`
+	// SkipRecordDays applies to skipped_builds rows.
+	SkipRecordDays int `mapstructure:"skip_record_days" default:"30"`
+	// CacheSnapshotDays applies to cache_snapshots rows.
+	CacheSnapshotDays int `mapstructure:"cache_snapshot_days" default:"365"`
+	// CacheMountDays applies to the builds' cache mounts, by their last
+	// write; see buildah.cache_mount_dir.
+	CacheMountDays int `mapstructure:"cache_mount_days" default:"14"`
+	// LocalImageDays applies to images left in the worker's buildah storage.
+	LocalImageDays int `mapstructure:"local_image_days" default:"7"`
+	// ReportDays applies to the build reports in worker.report_dir.
+	ReportDays int `mapstructure:"report_days" default:"30"`
+	// DiagnosticsDays applies to the bundles in worker.diagnostics_dir.
+	DiagnosticsDays int `mapstructure:"diagnostics_days" default:"14"`
+}
+
+// AutoscalingConfig controls the load signal published for HPA/KEDA.
+type AutoscalingConfig struct {
+	// Subject receives a JSON load report from every worker.
+	Subject         string `mapstructure:"subject" default:"builds.autoscaling"`
+	IntervalSeconds int    `mapstructure:"interval_seconds" default:"15"` // 0 disables reporting
+
+	// EvictionProtection annotates the worker's pod
+	// cluster-autoscaler.kubernetes.io/safe-to-evict: "false" while it
+	// handles jobs, so the cluster autoscaler does not remove its node
+	// under an in-flight build. The pod's service account must be allowed
+	// to patch pods; see deploy/k8s/rbac.yaml.
+	EvictionProtection bool `mapstructure:"eviction_protection"`
+}
+
+// DebugConfig exposes admin-only pprof, expvar and goroutine dump endpoints
+// under /debug/. The webhook-server mounts them on its API port; the worker
+// serves them on WorkerAddr.
+type DebugConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	WorkerAddr string `mapstructure:"worker_addr" default:":6060"`
+}
+
+// SelfCheckConfig tunes the periodic resource self-check both services run
+// to catch slow goroutine, file-descriptor and subscription leaks.
+type SelfCheckConfig struct {
+	IntervalSeconds int `mapstructure:"interval_seconds" default:"60"` // 0 disables
+	MaxGoroutines   int `mapstructure:"max_goroutines" default:"5000"`
+	// MaxFDPercent warns when open descriptors exceed this share of the
+	// process's RLIMIT_NOFILE.
+	MaxFDPercent         int `mapstructure:"max_fd_percent" default:"80"`
+	MaxNATSSubscriptions int `mapstructure:"max_nats_subscriptions" default:"50"`
+	// GrowthSamples warns when a resource grew in this many consecutive
+	// checks, the signature of a slow leak. 0 disables the trend check.
+	GrowthSamples int `mapstructure:"growth_samples" default:"30"`
+}
+
+// AdmissionConfig makes a worker stop taking new jobs while its host runs
+// short of disk or memory ("backpressure"), so a saturated host finishes
+// its running builds instead of failing new ones. Intake resumes once both
+// are HysteresisPercent above their thresholds.
+type AdmissionConfig struct {
+	IntervalSeconds int `mapstructure:"interval_seconds" default:"15"` // 0 disables
+	// MinFreeDiskPercent applies to each of the buildah storage root, the
+	// cache mount, workspace and git mirror directories.
+	MinFreeDiskPercent int `mapstructure:"min_free_disk_percent" default:"10"`
+	// MinAvailableMemoryPercent applies to the container's memory limit,
+	// or the host's memory without one.
+	MinAvailableMemoryPercent int `mapstructure:"min_available_memory_percent" default:"10"`
+	HysteresisPercent         int `mapstructure:"hysteresis_percent" default:"5"`
+}
+
+// CostConfig prices build resources for per-build cost estimates. A zero
+// rate leaves that resource out of the estimate.
+type CostConfig struct {
+	CPUHourUSD        float64 `mapstructure:"cpu_hour_usd"`         // worker CPU, per core-hour
+	StorageGBMonthUSD float64 `mapstructure:"storage_gb_month_usd"` // registry storage
+	EgressGBUSD       float64 `mapstructure:"egress_gb_usd"`        // registry egress, one pull per image
+}
+
+// ProxyConfig routes the dependency downloads of builds through internal
+// proxies such as Athens or Nexus, as air-gapped clusters require. Empty
+// values keep each tool's public default.
+type ProxyConfig struct {
+	GoProxy string `mapstructure:"go_proxy"` // GOPROXY of Go builds
+	GoSumDB string `mapstructure:"go_sumdb"` // GOSUMDB, e.g. "off"
+	// MavenMirror mirrors every Maven repository through a generated
+	// settings.xml.
+	MavenMirror string `mapstructure:"maven_mirror"`
+	// NuGetSource replaces every NuGet package source through a generated
+	// NuGet.Config.
+	NuGetSource string `mapstructure:"nuget_source"`
+}
+
+// HTTPClientConfig applies to the service's own outbound HTTP calls: the
+// GitHub API, OIDC key sets and the preflight registry check.
+type HTTPClientConfig struct {
+	// Proxy is the proxy URL of every outbound request. Empty honors the
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+	Proxy string `mapstructure:"proxy" secret:"true"`
+	// CABundle is a PEM file of CA certificates trusted in addition to the
+	// system pool, e.g. a TLS-intercepting corporate proxy's.
+	CABundle              string `mapstructure:"ca_bundle"`
+	ConnectTimeoutSeconds int    `mapstructure:"connect_timeout_seconds" default:"5"`
+	// TimeoutSeconds bounds a whole request, including reading the body.
+	TimeoutSeconds int `mapstructure:"timeout_seconds" default:"10"`
+}
+
+// PropagateConfig commits each pushed image's version back to Git: a
+// VERSION file in the built repository, or the image tag in a
+// kustomization of a config repository. The commits are marked so the push
+// they cause is not built again.
+type PropagateConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Repo is the "owner/name" committed to; empty commits to the built
+	// repository. The GitHub App must be able to write its contents.
+	Repo   string `mapstructure:"repo"`
+	Branch string `mapstructure:"branch" default:"main"`
+	// Path is the file updated; "{project}" is replaced by the project.
+	Path string `mapstructure:"path" default:"apps/{project}/VERSION"`
+	// Format is "version" (the file holds the version) or "kustomize" (the
+	// image's images[].newTag is set).
+	Format string `mapstructure:"format" default:"version"`
+}
+
+// WarningsConfig sets the thresholds of build warnings; see package
+// buildwarn.
+type WarningsConfig struct {
+	// LargeImageMB warns about pushed images whose compressed size exceeds
+	// it. 0 disables the warning. The warning is only reported: the image
+	// is already published when it is found.
+	LargeImageMB int `mapstructure:"large_image_mb" default:"1024"`
 }
 
-// New loads configuration from file + environment variables.
-func New() (*Config, error) {
-	v := viper.New()
+// EventsConfig emits job lifecycle events as CloudEvents to Sinks; see
+// package events.
+type EventsConfig struct {
+	// Source is the CloudEvents source attribute of the events.
+	Source string `mapstructure:"source" default:"/container-build-service"`
+	// BufferSize bounds the events awaiting delivery. Events beyond it are
+	// dropped, so a slow sink never holds up builds.
+	BufferSize int `mapstructure:"buffer_size" default:"1000"`
 
-	v.SetConfigName("config")
-	v.SetConfigType("yaml")
-	v.AddConfigPath(".")
-	v.AddConfigPath("/etc/container-build-service")
+	Sinks []EventSink `mapstructure:"sinks"`
+}
 
-	setDefaults(v)
+// EventSink is a destination of events. Type "http" POSTs each event to
+// URL; "nats" publishes it on Subject of the service's NATS connection.
+type EventSink struct {
+	Type    string `mapstructure:"type"`
+	URL     string `mapstructure:"url"`
+	Subject string `mapstructure:"subject"`
+	// Headers are set on HTTP requests, such as Authorization.
+	Headers map[string]string `mapstructure:"headers" secret:"true"`
+	// Types limits the sink to these event types, such as "job.finished";
+	// empty sends every event.
+	Types []string `mapstructure:"types"`
+}
 
-	v.SetEnvPrefix("CBS")
-	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-	v.AutomaticEnv()
+// FreezeConfig stops pushes from being built during change freezes. Pull
+// request builds, which push nothing, are not frozen. A push whose commit
+// messages carry "[freeze-override]" is built regardless, for emergencies.
+type FreezeConfig struct {
+	// Mode is "reject", skipping frozen pushes (see GET /skips), or
+	// "hold", keeping them and publishing them once the freeze is over.
+	Mode    string         `mapstructure:"mode" default:"reject"`
+	Windows []FreezeWindow `mapstructure:"windows"`
+}
 
-	_ = v.ReadInConfig() // missing file is acceptable; env vars take precedence
+// FreezeWindow is a change freeze of the repositories it matches. Match is
+// a repository ("owner/name"), an owner, or "*"; every matching window
+// applies. A window is either a date range, Start to End, or a weekly
+// schedule, Days from From to To.
+type FreezeWindow struct {
+	Match  string `mapstructure:"match"`
+	Reason string `mapstructure:"reason"`
+	// Start and End bound a one-off freeze (RFC 3339).
+	Start string `mapstructure:"start"`
+	End   string `mapstructure:"end"`
+	// Days ("mon" to "sun"; empty is every day) are the days the freeze
+	// starts, at From ("15:04"), to end at To; a To not after From ends
+	// the next day. Timezone is an IANA zone, UTC when empty.
+	Days     []string `mapstructure:"days"`
+	From     string   `mapstructure:"from"`
+	To       string   `mapstructure:"to"`
+	Timezone string   `mapstructure:"timezone"`
+}
 
-	var cfg Config
-	if err := v.Unmarshal(&cfg); err != nil {
-		return nil, err
+// PolicyConfig holds supply-chain policies enforced by the worker.
+//
+// A policy's Branches, "protected" or "unprotected", limits it to jobs on
+// branches with or without GitHub branch protection; empty applies to
+// both. Among the policies matching a repository equally specifically, one
+// limited to the job's kind of branch wins, so a stricter policy can be
+// set for protected branches.
+type PolicyConfig struct {
+	Signatures []SignaturePolicy `mapstructure:"signatures"`
+	BaseImages []BaseImagePolicy `mapstructure:"base_images"`
+}
+
+// SignaturePolicy requires the pushed head commit to carry a signature from
+// a trusted key. Match is a repository ("owner/name"), an owner, or "*";
+// the most specific matching policy applies.
+type SignaturePolicy struct {
+	Match    string `mapstructure:"match"`
+	Branches string `mapstructure:"branches"`
+	// AllowedSignersFile is an SSH allowed_signers file (gpg.ssh.allowedSignersFile).
+	AllowedSignersFile string `mapstructure:"allowed_signers_file"`
+	// GPGHome is a GNUPGHOME directory whose keyring holds the trusted GPG keys.
+	GPGHome string `mapstructure:"gpg_home"`
+}
+
+// SignaturePolicyFor returns the most specific signature policy for a job
+// on repo, on a protected branch or not.
+func (c PolicyConfig) SignaturePolicyFor(repo string, protected bool) (SignaturePolicy, bool) {
+	var best SignaturePolicy
+	bestScore := 0
+	for _, p := range c.Signatures {
+		if score := policyScore(p.Match, p.Branches, repo, protected); score > bestScore {
+			best, bestScore = p, score
+		}
+	}
+	return best, bestScore > 0
+}
+
+// BaseImagePolicy restricts the FROM images of a repository's generated
+// Dockerfiles. Match is a repository ("owner/name"), an owner, or "*"; the
+// most specific matching policy applies.
+type BaseImagePolicy struct {
+	Match    string `mapstructure:"match"`
+	Branches string `mapstructure:"branches"`
+	// Allow lists the permitted images, each a registry ("gcr.io"), a
+	// namespace or repository ("docker.io/library/golang"), or a
+	// digest-pinned image ("docker.io/library/golang@sha256:…"), which
+	// admits that digest only. Short Docker Hub names in FROM lines are
+	// expanded to docker.io/library/ before matching.
+	Allow []string `mapstructure:"allow"`
+	// Severity "warn" only logs a disallowed base image; "enforce" (the
+	// default when empty) fails the build.
+	Severity string `mapstructure:"severity"`
+}
+
+// BaseImagePolicyFor returns the most specific base image policy for a job
+// on repo, on a protected branch or not.
+func (c PolicyConfig) BaseImagePolicyFor(repo string, protected bool) (BaseImagePolicy, bool) {
+	var best BaseImagePolicy
+	bestScore := 0
+	for _, p := range c.BaseImages {
+		if score := policyScore(p.Match, p.Branches, repo, protected); score > bestScore {
+			best, bestScore = p, score
+		}
 	}
-	return &cfg, nil
-}
-
-func setDefaults(v *viper.Viper) {
-	v.SetDefault("nats.url", "nats://localhost:4222")
-	v.SetDefault("nats.stream_name", "BUILDS")
-	v.SetDefault("nats.subject", "builds.jobs")
-	v.SetDefault("nats.consumer_name", "build-worker")
-	v.SetDefault("nats.ack_wait_seconds", 300)  // 5 minutes
-	v.SetDefault("nats.max_delivers", 3)
-	v.SetDefault("worker.concurrency", 3)
-	v.SetDefault("worker.max_build_retries", 3)
-	v.SetDefault("worker.stale_claim_minutes", 30)
-	v.SetDefault("worker.heartbeat_seconds", 120) // 2 minutes
-	v.SetDefault("buildah.storage_root", "/var/lib/buildah")
-	v.SetDefault("metrics.dogstatsd_addr", "localhost:8125")
+	return best, bestScore > 0
+}
+
+type MetricsConfig struct {
+	DogStatsDAddr string `mapstructure:"dogstatsd_addr" default:"localhost:8125"`
+}
+
+// LogConfig sets the log levels: debug, info, warn or error.
+type LogConfig struct {
+	Level string `mapstructure:"level" default:"info"`
+	// Components overrides Level per component logger, as comma-separated
+	// name=level pairs such as "orchestrator=debug,nats=warn". The
+	// components include orchestrator, buildah, nats, webhook, auth,
+	// registryauth, retention, freeze and the other background loops, by
+	// package name. A level applies to the component's named sub-loggers
+	// too, unless they are listed themselves.
+	Components string `mapstructure:"components"`
+}
+
+type AuthConfig struct {
+	StaticTokens []StaticToken `mapstructure:"static_tokens"`
+	OIDC         OIDCConfig    `mapstructure:"oidc"`
+}
+
+// StaticToken is a pre-shared bearer token granting a fixed role.
+type StaticToken struct {
+	Name  string `mapstructure:"name"`
+	Token string `mapstructure:"token" secret:"true"`
+	Role  string `mapstructure:"role"` // viewer | trigger | admin
+}
+
+// OIDCConfig enables JWT bearer validation against a corporate identity
+// provider. Validation is disabled when JWKSURL is empty; otherwise Issuer
+// and Audience are required.
+type OIDCConfig struct {
+	Issuer   string `mapstructure:"issuer"`
+	Audience string `mapstructure:"audience"`
+	JWKSURL  string `mapstructure:"jwks_url"`
+	// RolesClaim names the claim holding role or group names.
+	RolesClaim string `mapstructure:"roles_claim" default:"roles"`
+	// RoleMapping maps claim values (lowercased) to viewer | trigger | admin.
+	RoleMapping map[string]string `mapstructure:"role_mapping"`
 }
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// New loads configuration from file + environment variables.
+func New() (*Config, error) {
+	v := viper.New()
+
+	v.SetConfigName("config")
+	v.SetConfigType("yaml")
+	v.AddConfigPath(".")
+	v.AddConfigPath("/etc/container-build-service")
+
+	return load(v)
+}
+
+func load(v *viper.Viper) (*Config, error) {
+	v.SetEnvPrefix("CBS")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	// Registering every key also binds its CBS_* variable; viper otherwise
+	// ignores environment values for keys that have neither a default nor
+	// an entry in the config file.
+	if err := registerKeys(v, reflect.TypeOf(Config{}), ""); err != nil {
+		return nil, err
+	}
+
+	// A missing file is acceptable (env vars take precedence); a file that
+	// exists but does not parse is not.
+	var notFound viper.ConfigFileNotFoundError
+	if err := v.ReadInConfig(); err != nil && !errors.As(err, &notFound) {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var cfg Config
+	unmarshal := v.Unmarshal
+	if v.GetBool("strict") {
+		unmarshal = v.UnmarshalExact
+	}
+	if err := unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// registerKeys walks the config schema and sets the `default` tag of every
+// scalar key. Slices and maps are only settable from the config file.
+func registerKeys(v *viper.Viper, t reflect.Type, prefix string) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := prefix + keyName(f)
+		switch f.Type.Kind() {
+		case reflect.Struct:
+			if err := registerKeys(v, f.Type, key+"."); err != nil {
+				return err
+			}
+		case reflect.Slice, reflect.Map:
+		default:
+			if err := v.BindEnv(key); err != nil {
+				return fmt.Errorf("bind %s: %w", key, err)
+			}
+			if def, ok := f.Tag.Lookup("default"); ok {
+				v.SetDefault(key, def)
+			}
+		}
+	}
+	return nil
+}
+
+// keyName returns the configuration key of a struct field.
+func keyName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ","); name != "" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
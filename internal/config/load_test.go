@@ -0,0 +1,172 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/validation"
+	"github.com/spf13/viper"
+)
+
+func loadFile(t *testing.T, yaml string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	return load(v)
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := loadFile(t, "worker:\n  concurrency: 5\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Worker.Concurrency != 5 {
+		t.Errorf("concurrency = %d, want 5 from file", cfg.Worker.Concurrency)
+	}
+	if cfg.Worker.MaxBuildRetries != 3 || cfg.Worker.DurationAnomalyFactor != 1.5 {
+		t.Errorf("worker defaults not applied: %+v", cfg.Worker)
+	}
+	if cfg.NATS.URL != "nats://localhost:4222" || cfg.Auth.OIDC.RolesClaim != "roles" {
+		t.Errorf("nested defaults not applied: %q %q", cfg.NATS.URL, cfg.Auth.OIDC.RolesClaim)
+	}
+}
+
+func TestLoadEnvWithoutDefault(t *testing.T) {
+	t.Setenv("CBS_TIDB_DSN", "root@tcp(tidb:4000)/builds")
+	cfg, err := loadFile(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TiDB.DSN != "root@tcp(tidb:4000)/builds" {
+		t.Errorf("DSN = %q, want value from CBS_TIDB_DSN", cfg.TiDB.DSN)
+	}
+}
+
+func TestLoadStrict(t *testing.T) {
+	const typo = "worker:\n  concurrencyy: 5\n"
+
+	if _, err := loadFile(t, typo); err != nil {
+		t.Errorf("non-strict load rejected unknown key: %v", err)
+	}
+	if _, err := loadFile(t, "strict: true\n"+typo); err == nil {
+		t.Error("strict load accepted unknown key worker.concurrencyy")
+	}
+	if _, err := loadFile(t, "strict: true\nauth:\n  static_tokens:\n    - name: ci\n      tokn: x\n"); err == nil {
+		t.Error("strict load accepted unknown key inside a list item")
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := &Config{
+		TiDB:   TiDBConfig{DSN: "app:hunter2@tcp(tidb:4000)/builds"},
+		GitHub: GitHubConfig{WebhookSecret: "s3cret"},
+		Auth:   AuthConfig{StaticTokens: []StaticToken{{Name: "ci", Token: "tok", Role: "admin"}}},
+	}
+	got := cfg.Redacted()
+
+	if dsn := got["tidb"].(map[string]any)["dsn"]; dsn != "app:***@tcp(tidb:4000)/builds" {
+		t.Errorf("dsn = %v", dsn)
+	}
+	if s := got["github"].(map[string]any)["webhook_secret"]; s != masked {
+		t.Errorf("webhook_secret = %v", s)
+	}
+	tok := got["auth"].(map[string]any)["static_tokens"].([]any)[0].(map[string]any)
+	if tok["token"] != masked || tok["name"] != "ci" {
+		t.Errorf("static token = %v", tok)
+	}
+}
+
+func TestMaskDSNPassword(t *testing.T) {
+	tests := map[string]string{
+		"root@tcp(tidb:4000)/builds":         "root@tcp(tidb:4000)/builds",
+		"u:p@ss@tcp(tidb:4000)/builds":       "u:***@tcp(tidb:4000)/builds",
+		"u:p@tcp(tidb:4000)/builds?tls=true": "u:***@tcp(tidb:4000)/builds?tls=true",
+		"tidb:4000":                          "tidb:4000",
+	}
+	for in, want := range tests {
+		if got := maskDSNPassword(in); got != want {
+			t.Errorf("maskDSNPassword(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLoadValidates(t *testing.T) {
+	_, err := loadFile(t, "worker:\n  concurrency: 0\n  checkout_verification: strict\nauth:\n  static_tokens:\n    - name: ci\n      token: x\n      role: root\n")
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v, want validation.Errors", err)
+	}
+	want := []string{"worker.concurrency", "worker.checkout_verification", "auth.static_tokens[0].role"}
+	if len(errs) != len(want) {
+		t.Fatalf("errors = %v, want fields %v", errs, want)
+	}
+	for i, f := range errs {
+		if f.Field != want[i] {
+			t.Errorf("errors[%d].Field = %q, want %q", i, f.Field, want[i])
+		}
+	}
+}
+
+func TestLoadValidatesAddHosts(t *testing.T) {
+	_, err := loadFile(t, `buildah:
+  networks:
+    - match: acme/*
+      add_hosts: ["nexus.corp:10.0.0.7", "nexus.corp", "db:not-an-ip", ":10.0.0.8", "v6.corp:fd00::1"]
+    - match: acme/offline
+      network: none
+      add_hosts: ["nexus.corp:10.0.0.7"]
+`)
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v, want validation.Errors", err)
+	}
+	want := []string{
+		"buildah.networks[0].add_hosts[1]",
+		"buildah.networks[0].add_hosts[2]",
+		"buildah.networks[0].add_hosts[3]",
+		"buildah.networks[1]",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("errors = %v, want fields %v", errs, want)
+	}
+	for i, f := range errs {
+		if f.Field != want[i] {
+			t.Errorf("errors[%d].Field = %q, want %q", i, f.Field, want[i])
+		}
+	}
+
+	cfg, err := loadFile(t, "buildah:\n  networks:\n    - match: acme/*\n      add_hosts: [\"nexus.corp:10.0.0.7\"]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := cfg.Buildah.NetworkFor("acme/shop"); !ok || len(n.AddHosts) != 1 || n.AddHosts[0] != "nexus.corp:10.0.0.7" {
+		t.Errorf("NetworkFor(acme/shop) = %+v, %v", n, ok)
+	}
+}
+
+func TestLoadValidatesOIDC(t *testing.T) {
+	_, err := loadFile(t, "auth:\n  oidc:\n    jwks_url: https://sso.example.com/jwks\n")
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v, want validation.Errors", err)
+	}
+	want := []string{"auth.oidc.issuer", "auth.oidc.audience"}
+	if len(errs) != len(want) {
+		t.Fatalf("errors = %v, want fields %v", errs, want)
+	}
+	for i, f := range errs {
+		if f.Field != want[i] {
+			t.Errorf("errors[%d].Field = %q, want %q", i, f.Field, want[i])
+		}
+	}
+
+	if _, err := loadFile(t, "auth:\n  oidc:\n    jwks_url: https://sso.example.com/jwks\n    issuer: https://sso.example.com\n    audience: build-service\n"); err != nil {
+		t.Errorf("complete oidc config: %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ComponentLevels parses Components into levels by component name.
+func (c LogConfig) ComponentLevels() (map[string]string, error) {
+	levels := map[string]string{}
+	for _, pair := range strings.Split(c.Components, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, level, ok := strings.Cut(pair, "=")
+		name, level = strings.TrimSpace(name), strings.TrimSpace(level)
+		if !ok || name == "" || level == "" {
+			return nil, fmt.Errorf("invalid component level %q, want name=level", pair)
+		}
+		levels[name] = level
+	}
+	return levels, nil
+}
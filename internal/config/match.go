@@ -0,0 +1,90 @@
+package config
+
+import (
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// MatchRepo reports how specifically pattern matches a repository full name
+// ("owner/name"). It returns 3 for an exact repository match, 2 for an owner
+// match ("owner" or "owner/*"), 1 for the "*" wildcard, and 0 for no match.
+// Matching is case-insensitive, as GitHub names are.
+func MatchRepo(pattern, fullName string) int {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	fullName = strings.ToLower(fullName)
+	switch {
+	case pattern == "":
+		return 0
+	case pattern == "*":
+		return 1
+	case pattern == fullName:
+		return 3
+	}
+	owner, _, _ := strings.Cut(fullName, "/")
+	if strings.TrimSuffix(pattern, "/*") == owner {
+		return 2
+	}
+	return 0
+}
+
+// policyScore ranks a policy for a job on repo: by MatchRepo, then one
+// limited to the job's kind of branch over one that is not. 0 means the
+// policy does not apply.
+func policyScore(match, branches, repo string, protected bool) int {
+	score := MatchRepo(match, repo) * 2
+	switch {
+	case score == 0:
+		return 0
+	case branches == "":
+		return score
+	case (branches == "protected") == protected:
+		return score + 1
+	}
+	return 0
+}
+
+// CompileOnly reports whether pushes to branch get compile-only builds.
+func (c GitHubConfig) CompileOnly(branch string) bool {
+	for _, pattern := range c.CompileOnlyBranches {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SecretsFor returns the build secrets of repo sorted by ID, with File
+// resolved against SecretsDir.
+func (c BuildahConfig) SecretsFor(repo string) []BuildSecret {
+	best := map[string]BuildSecret{}
+	score := map[string]int{}
+	for _, s := range c.Secrets {
+		if m := MatchRepo(s.Match, repo); m > score[s.ID] {
+			best[s.ID], score[s.ID] = s, m
+		}
+	}
+	out := make([]BuildSecret, 0, len(best))
+	for _, id := range slices.Sorted(maps.Keys(best)) {
+		s := best[id]
+		if !filepath.IsAbs(s.File) {
+			s.File = filepath.Join(c.SecretsDir, s.File)
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// NetworkFor returns the most specific build network settings for repo.
+func (c BuildahConfig) NetworkFor(repo string) (BuildNetwork, bool) {
+	var best BuildNetwork
+	bestScore := 0
+	for _, n := range c.Networks {
+		if score := MatchRepo(n.Match, repo); score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	return best, bestScore > 0
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchRepo(t *testing.T) {
+	tests := []struct {
+		pattern, repo string
+		want          int
+	}{
+		{"acme/shop", "acme/shop", 3},
+		{"ACME/Shop", "acme/shop", 3},
+		{"acme", "acme/shop", 2},
+		{"acme/*", "acme/shop", 2},
+		{"*", "acme/shop", 1},
+		{"acme/other", "acme/shop", 0},
+		{"other", "acme/shop", 0},
+		{"", "acme/shop", 0},
+	}
+	for _, tc := range tests {
+		if got := MatchRepo(tc.pattern, tc.repo); got != tc.want {
+			t.Errorf("MatchRepo(%q, %q) = %d, want %d", tc.pattern, tc.repo, got, tc.want)
+		}
+	}
+}
+
+func TestSignaturePolicyFor(t *testing.T) {
+	c := PolicyConfig{Signatures: []SignaturePolicy{
+		{Match: "*", AllowedSignersFile: "all"},
+		{Match: "acme", AllowedSignersFile: "owner"},
+		{Match: "acme/shop", AllowedSignersFile: "repo"},
+	}}
+
+	tests := map[string]string{
+		"acme/shop":  "repo",
+		"acme/other": "owner",
+		"else/where": "all",
+	}
+	for repo, want := range tests {
+		p, ok := c.SignaturePolicyFor(repo, false)
+		if !ok || p.AllowedSignersFile != want {
+			t.Errorf("SignaturePolicyFor(%q) = %+v, %v; want %q", repo, p, ok, want)
+		}
+	}
+
+	if _, ok := (PolicyConfig{}).SignaturePolicyFor("acme/shop", false); ok {
+		t.Error("empty policy config should not match")
+	}
+}
+
+func TestBaseImagePolicyForBranches(t *testing.T) {
+	c := PolicyConfig{BaseImages: []BaseImagePolicy{
+		{Match: "*", Severity: "warn"},
+		{Match: "*", Branches: "protected", Severity: "enforce"},
+		{Match: "acme/shop", Branches: "unprotected", Severity: "shop-unprotected"},
+	}}
+
+	tests := []struct {
+		repo      string
+		protected bool
+		want      string
+	}{
+		{"else/where", false, "warn"},
+		{"else/where", true, "enforce"},
+		{"acme/shop", false, "shop-unprotected"},
+		{"acme/shop", true, "enforce"},
+	}
+	for _, tc := range tests {
+		p, ok := c.BaseImagePolicyFor(tc.repo, tc.protected)
+		if !ok || p.Severity != tc.want {
+			t.Errorf("BaseImagePolicyFor(%q, %v) = %+v, %v; want %q", tc.repo, tc.protected, p, ok, tc.want)
+		}
+	}
+}
+
+func TestSecretsFor(t *testing.T) {
+	c := BuildahConfig{SecretsDir: "/secrets", Secrets: []BuildSecret{
+		{Match: "*", ID: "npm", File: "npm-default"},
+		{Match: "acme", ID: "npm", File: "npm-acme", Env: "NPM_TOKEN"},
+		{Match: "acme/shop", ID: "pip", File: "/etc/pip-shop"},
+		{Match: "other", ID: "pip", File: "pip-other"},
+	}}
+
+	got := c.SecretsFor("acme/shop")
+	want := []BuildSecret{
+		{Match: "acme", ID: "npm", File: "/secrets/npm-acme", Env: "NPM_TOKEN"},
+		{Match: "acme/shop", ID: "pip", File: "/etc/pip-shop"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("SecretsFor(acme/shop) = %+v, want %+v", got, want)
+	}
+	if got := c.SecretsFor("else/where"); len(got) != 1 || got[0].File != "/secrets/npm-default" {
+		t.Errorf("SecretsFor(else/where) = %+v", got)
+	}
+}
+
+func TestNetworkFor(t *testing.T) {
+	c := BuildahConfig{Networks: []BuildNetwork{
+		{Match: "*", DNS: []string{"10.0.0.53"}},
+		{Match: "acme/shop", Network: "none"},
+	}}
+	if n, ok := c.NetworkFor("acme/shop"); !ok || n.Network != "none" || n.DNS != nil {
+		t.Errorf("NetworkFor(acme/shop) = %+v, %v", n, ok)
+	}
+	if n, ok := c.NetworkFor("acme/other"); !ok || n.Network != "" || len(n.DNS) != 1 {
+		t.Errorf("NetworkFor(acme/other) = %+v, %v", n, ok)
+	}
+	if _, ok := (BuildahConfig{}).NetworkFor("acme/shop"); ok {
+		t.Error("empty network config should not match")
+	}
+}
+
+func TestCompileOnly(t *testing.T) {
+	gh := GitHubConfig{CompileOnlyBranches: []string{"feature/*", "spike"}}
+	for branch, want := range map[string]bool{
+		"feature/cart":     true,
+		"feature/cart/sub": false,
+		"spike":            true,
+		"main":             false,
+		"release/1.0":      false,
+	} {
+		if got := gh.CompileOnly(branch); got != want {
+			t.Errorf("CompileOnly(%q) = %v, want %v", branch, got, want)
+		}
+	}
+}
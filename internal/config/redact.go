@@ -0,0 +1,68 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+const masked = "***"
+
+// Redacted returns the effective configuration keyed like the config file,
+// with values tagged `secret` masked. It backs the /admin/config dump.
+func (c *Config) Redacted() map[string]any {
+	return redactStruct(reflect.ValueOf(*c))
+}
+
+func redactStruct(v reflect.Value) map[string]any {
+	out := make(map[string]any, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		out[keyName(f)] = redactValue(v.Field(i), f.Tag.Get("secret"))
+	}
+	return out
+}
+
+func redactValue(v reflect.Value, secret string) any {
+	switch v.Kind() {
+	case reflect.Struct:
+		return redactStruct(v)
+	case reflect.Slice:
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = redactValue(v.Index(i), secret)
+		}
+		return items
+	case reflect.Map:
+		m := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = redactValue(iter.Value(), secret)
+		}
+		return m
+	case reflect.String:
+		s := v.String()
+		switch {
+		case s == "" || secret == "":
+			return s
+		case secret == "dsn":
+			return maskDSNPassword(s)
+		default:
+			return masked
+		}
+	default:
+		return v.Interface()
+	}
+}
+
+// maskDSNPassword masks the password in a "user:password@tcp(host)/db" DSN.
+func maskDSNPassword(dsn string) string {
+	at := strings.LastIndex(dsn, "@")
+	if at < 0 {
+		return dsn
+	}
+	user, _, hasPassword := strings.Cut(dsn[:at], ":")
+	if !hasPassword {
+		return dsn
+	}
+	return user + ":" + masked + dsn[at:]
+}
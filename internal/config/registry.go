@@ -0,0 +1,56 @@
+package config
+
+import (
+	"path"
+	"strings"
+)
+
+// ImageMapping places the images of matching repositories, e.g. acme/shop's
+// "api" project at registry.acme.io/ecom/shop-api.
+type ImageMapping struct {
+	// Match is a repository ("owner/name"), an owner, or "*".
+	Match string `mapstructure:"match"`
+	// Project restricts the mapping to one Nx project; empty matches all.
+	Project string `mapstructure:"project"`
+	// Registry overrides RegistryConfig.URL.
+	Registry  string `mapstructure:"registry"`
+	Namespace string `mapstructure:"namespace"`
+	// Name is the image name; "{project}" is replaced by the project name.
+	// Defaults to the project name.
+	Name string `mapstructure:"name"`
+}
+
+// ImageRepository returns the registry and repository path (without tag)
+// that project from repo is pushed to. An exact project mapping wins over a
+// repository-wide one at the same repository specificity.
+func (c RegistryConfig) ImageRepository(repo, project string) (registry, repository string) {
+	var best *ImageMapping
+	bestScore := 0
+	for i, m := range c.Images {
+		if m.Project != "" && !strings.EqualFold(m.Project, project) {
+			continue
+		}
+		score := MatchRepo(m.Match, repo) * 2
+		if score == 0 {
+			continue
+		}
+		if m.Project != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = &c.Images[i], score
+		}
+	}
+
+	registry, name := c.URL, project
+	if best == nil {
+		return registry, name
+	}
+	if best.Registry != "" {
+		registry = best.Registry
+	}
+	if best.Name != "" {
+		name = strings.ReplaceAll(best.Name, "{project}", project)
+	}
+	return strings.TrimSuffix(registry, "/"), path.Join(best.Namespace, name)
+}
@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestImageRepository(t *testing.T) {
+	c := RegistryConfig{
+		URL: "registry.local",
+		Images: []ImageMapping{
+			{Match: "acme", Namespace: "acme"},
+			{Match: "acme/shop", Registry: "registry.acme.io/", Namespace: "ecom", Name: "shop-{project}"},
+			{Match: "acme/shop", Project: "legacy", Namespace: "ecom", Name: "old-shop"},
+		},
+	}
+
+	tests := []struct {
+		repo, project      string
+		wantReg, wantImage string
+	}{
+		{"acme/shop", "api", "registry.acme.io", "ecom/shop-api"},
+		{"acme/shop", "legacy", "registry.local", "ecom/old-shop"},
+		{"acme/blog", "web", "registry.local", "acme/web"},
+		{"other/repo", "api", "registry.local", "api"},
+	}
+	for _, tc := range tests {
+		reg, image := c.ImageRepository(tc.repo, tc.project)
+		if reg != tc.wantReg || image != tc.wantImage {
+			t.Errorf("ImageRepository(%q, %q) = %q, %q; want %q, %q",
+				tc.repo, tc.project, reg, image, tc.wantReg, tc.wantImage)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package config
+
+import (
+	"maps"
+	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/buildenv"
+	"github.com/jorgerua/build-system/container-build-service/internal/validation"
+)
+
+// Validate checks settings whose invalid values would otherwise only surface
+// mid-build. The returned error is a validation.Errors keyed by config key.
+func (c *Config) Validate() error {
+	var errs validation.Errors
+
+	if c.Server.Port < 0 || c.Server.Port > 65535 {
+		errs.Add("server.port", "must be 0-65535")
+	}
+	if s := c.Server.LegacySunset; s != "" {
+		if _, err := time.Parse(time.DateOnly, s); err != nil {
+			errs.Add("server.legacy_sunset", "must be a YYYY-MM-DD date")
+		}
+	}
+	if c.Server.IdempotencyKeyHours < 1 {
+		errs.Add("server.idempotency_key_hours", "must be at least 1")
+	}
+	if c.Server.WebhookConcurrency < 0 {
+		errs.Add("server.webhook_concurrency", "must not be negative")
+	}
+	if c.Server.WebhookConcurrency > 0 {
+		if c.Server.WebhookQueue < 0 {
+			errs.Add("server.webhook_queue", "must not be negative")
+		}
+		if c.Server.WebhookQueueSeconds < 1 {
+			errs.Add("server.webhook_queue_seconds", "must be at least 1")
+		}
+	}
+	if c.Worker.Concurrency < 1 {
+		errs.Add("worker.concurrency", "must be at least 1")
+	}
+	if c.Worker.MaxBuildRetries < 1 {
+		errs.Add("worker.max_build_retries", "must be at least 1")
+	}
+	if c.Worker.DurationAnomalyFactor < 0 {
+		errs.Add("worker.duration_anomaly_factor", "must not be negative")
+	}
+	oneOf(&errs, "worker.checkout_verification", c.Worker.CheckoutVerification, "off", "warn", "enforce")
+	if l := c.Worker.ReportZstdLevel; l < 0 || l > 22 {
+		errs.Add("worker.report_zstd_level", "must be 0-22")
+	}
+	if c.Worker.JobTTLHours < 0 {
+		errs.Add("worker.job_ttl_hours", "must not be negative")
+	}
+	if c.Worker.ReachabilityTimeoutSeconds < 0 {
+		errs.Add("worker.reachability_timeout_seconds", "must not be negative")
+	}
+	if c.Worker.WorkspaceDir == "" {
+		errs.Add("worker.workspace_dir", "is required")
+	}
+	if c.Worker.WorkspaceQuotaMB < 0 {
+		errs.Add("worker.workspace_quota_mb", "must not be negative")
+	}
+	if c.Worker.WorkspaceQuotaMB > 0 && c.Worker.WorkspaceCheckSeconds < 1 {
+		errs.Add("worker.workspace_check_seconds", "must be at least 1 when a quota is set")
+	}
+	oneOf(&errs, "github.repository_mode", c.GitHub.RepositoryMode, "open", "closed")
+	if u, err := url.Parse(c.GitHub.WebhookURL); c.GitHub.WebhookURL != "" && (err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https")) {
+		errs.Add("github.webhook_url", "must be an http(s) URL, got %q", c.GitHub.WebhookURL)
+	}
+	for i, cidr := range c.GitHub.HookOrigin.CIDRs {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			errs.Add(indexed("github.hook_origin.cidrs", i), "invalid CIDR %q", cidr)
+		}
+	}
+	for i, cidr := range c.GitHub.HookOrigin.TrustedProxies {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			errs.Add(indexed("github.hook_origin.trusted_proxies", i), "invalid CIDR %q", cidr)
+		}
+	}
+	oneOf(&errs, "log.level", c.Log.Level, logLevels...)
+	if levels, err := c.Log.ComponentLevels(); err != nil {
+		errs.Add("log.components", "%v", err)
+	} else {
+		for _, name := range slices.Sorted(maps.Keys(levels)) {
+			oneOf(&errs, "log.components."+name, levels[name], logLevels...)
+		}
+	}
+	if c.Debug.Enabled && c.Debug.WorkerAddr == "" {
+		errs.Add("debug.worker_addr", "is required when debug is enabled")
+	}
+	if c.Worker.PreflightRetrySeconds < 1 {
+		errs.Add("worker.preflight_retry_seconds", "must be at least 1")
+	}
+	if c.Admission.IntervalSeconds < 0 {
+		errs.Add("admission.interval_seconds", "must not be negative")
+	}
+	percents := map[string]int{
+		"admission.min_free_disk_percent":        c.Admission.MinFreeDiskPercent,
+		"admission.min_available_memory_percent": c.Admission.MinAvailableMemoryPercent,
+		"admission.hysteresis_percent":           c.Admission.HysteresisPercent,
+	}
+	for _, key := range slices.Sorted(maps.Keys(percents)) {
+		if p := percents[key]; p < 0 || p > 100 {
+			errs.Add(key, "must be 0-100")
+		}
+	}
+	if c.SelfCheck.IntervalSeconds < 0 {
+		errs.Add("self_check.interval_seconds", "must not be negative")
+	}
+	oneOf(&errs, "freeze.mode", c.Freeze.Mode, "reject", "hold")
+	for i, fw := range c.Freeze.Windows {
+		validateFreezeWindow(&errs, indexed("freeze.windows", i), fw)
+	}
+	if c.Events.BufferSize < 1 {
+		errs.Add("events.buffer_size", "must be at least 1")
+	}
+	for i, s := range c.Events.Sinks {
+		key := indexed("events.sinks", i)
+		switch s.Type {
+		case "http":
+			if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs.Add(key+".url", "must be an http(s) URL")
+			}
+		case "nats":
+			if s.Subject == "" || strings.ContainsAny(s.Subject, " *>") {
+				errs.Add(key+".subject", "must be a NATS subject without wildcards")
+			}
+		default:
+			errs.Add(key+".type", "must be one of [http nats], got %q", s.Type)
+		}
+	}
+	if c.Warnings.LargeImageMB < 0 {
+		errs.Add("warnings.large_image_mb", "must not be negative")
+	}
+	if p := c.SelfCheck.MaxFDPercent; p < 1 || p > 100 {
+		errs.Add("self_check.max_fd_percent", "must be 1-100")
+	}
+	if c.Cost.CPUHourUSD < 0 || c.Cost.StorageGBMonthUSD < 0 || c.Cost.EgressGBUSD < 0 {
+		errs.Add("cost", "rates must not be negative")
+	}
+	// Go proxy settings are written into Dockerfile ENV instructions.
+	for _, kv := range [][2]string{{"proxy.go_proxy", c.Proxy.GoProxy}, {"proxy.go_sumdb", c.Proxy.GoSumDB}} {
+		if strings.ContainsAny(kv[1], " \t\r\n\"'$\\") {
+			errs.Add(kv[0], "must not contain whitespace, quotes, $ or backslashes")
+		}
+	}
+	for _, kv := range [][2]string{
+		{"proxy.maven_mirror", c.Proxy.MavenMirror},
+		{"proxy.nuget_source", c.Proxy.NuGetSource},
+		{"gradle.remote_build_cache_url", c.Gradle.RemoteBuildCacheURL},
+	} {
+		if kv[1] != "" && !strings.HasPrefix(kv[1], "https://") && !strings.HasPrefix(kv[1], "http://") {
+			errs.Add(kv[0], "must be an http(s) URL")
+		}
+	}
+	if p := c.HTTPClient.Proxy; p != "" {
+		if u, err := url.Parse(p); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			errs.Add("http_client.proxy", "must be an http, https or socks5 URL")
+		}
+	}
+	if c.HTTPClient.ConnectTimeoutSeconds < 1 {
+		errs.Add("http_client.connect_timeout_seconds", "must be at least 1")
+	}
+	if c.HTTPClient.TimeoutSeconds < 1 {
+		errs.Add("http_client.timeout_seconds", "must be at least 1")
+	}
+	oneOf(&errs, "propagate.format", c.Propagate.Format, "version", "kustomize")
+	if c.Propagate.Enabled && (c.Propagate.Path == "" || c.Propagate.Branch == "") {
+		errs.Add("propagate", "path and branch are required when enabled")
+	}
+	oneOf(&errs, "cache.shared", c.Cache.Shared, "auto", "always", "never")
+	if c.Cache.SnapshotIntervalMinutes < 0 {
+		errs.Add("cache.snapshot_interval_minutes", "must not be negative")
+	}
+	oneOf(&errs, "bootstrap.package_manager", c.Bootstrap.PackageManager, "auto", "npm", "yarn", "pnpm")
+	if c.Node.Enabled && c.Node.ToolchainDir == "" {
+		errs.Add("node.toolchain_dir", "is required when enabled")
+	}
+	if u := c.Node.DistURL; c.Node.Enabled && !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+		errs.Add("node.dist_url", "must be an http(s) URL")
+	}
+	if c.Toolchain.Enabled {
+		if c.Toolchain.Dir == "" {
+			errs.Add("toolchain.dir", "is required when enabled")
+		}
+		for _, u := range []struct{ key, url string }{
+			{"toolchain.go_dist_url", c.Toolchain.GoDistURL},
+			{"toolchain.java_api_url", c.Toolchain.JavaAPIURL},
+			{"toolchain.dotnet_feed_url", c.Toolchain.DotnetFeedURL},
+		} {
+			if !strings.HasPrefix(u.url, "https://") && !strings.HasPrefix(u.url, "http://") {
+				errs.Add(u.key, "must be an http(s) URL")
+			}
+		}
+	}
+	for i, pin := range c.Toolchain.Checksums {
+		key := indexed("toolchain.checksums", i)
+		if pin.File == "" || strings.Contains(pin.File, "/") {
+			errs.Add(key+".file", "must be an archive file name")
+		}
+		if !sha256Pattern.MatchString(pin.SHA256) {
+			errs.Add(key+".sha256", "must be a hex SHA-256 digest")
+		}
+	}
+	if c.Worker.AffinityWaitSeconds < 0 {
+		errs.Add("worker.affinity_wait_seconds", "must not be negative")
+	}
+	oneOf(&errs, "worker.shutdown_policy", c.Worker.ShutdownPolicy, "wait", "requeue", "abort")
+	if m := c.Worker.ShutdownWaitMinutes; m < 0 || m > MaxShutdownWaitMinutes {
+		errs.Add("worker.shutdown_wait_minutes", "must be 0-%d", MaxShutdownWaitMinutes)
+	}
+	if c.Bootstrap.TimeoutSeconds < 1 {
+		errs.Add("bootstrap.timeout_seconds", "must be at least 1")
+	}
+
+	for i, pattern := range c.GitHub.CompileOnlyBranches {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs.Add(indexed("github.compile_only_branches", i), "invalid pattern %q", pattern)
+		}
+	}
+	for i, pattern := range c.Registry.MutableTags {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs.Add(indexed("registry.mutable_tags", i), "invalid pattern %q", pattern)
+		}
+	}
+	for i, m := range c.Registry.Images {
+		if m.Match == "" {
+			errs.Add(indexed("registry.images", i)+".match", "is required")
+		}
+	}
+	for i, rc := range c.Registry.Credentials {
+		key := indexed("registry.credentials", i)
+		if rc.Registry == "" || strings.Contains(rc.Registry, "/") {
+			errs.Add(key+".registry", "must be a registry host, got %q", rc.Registry)
+		}
+		oneOf(&errs, key+".provider", rc.Provider, "ecr", "gcp")
+	}
+	for i, s := range c.Buildah.Secrets {
+		key := indexed("buildah.secrets", i)
+		if s.Match == "" {
+			errs.Add(key+".match", "is required")
+		}
+		if !secretIDPattern.MatchString(s.ID) {
+			errs.Add(key+".id", "must be letters, digits, '.', '_' or '-', got %q", s.ID)
+		}
+		if s.File == "" {
+			errs.Add(key+".file", "is required")
+		}
+		if s.Env != "" && !envNamePattern.MatchString(s.Env) {
+			errs.Add(key+".env", "invalid environment variable name %q", s.Env)
+		}
+		if s.NetrcMachine != "" || s.NetrcLogin != "" {
+			if !netrcTokenPattern.MatchString(s.NetrcMachine) {
+				errs.Add(key+".netrc_machine", "must be a host name, got %q", s.NetrcMachine)
+			}
+			if !netrcTokenPattern.MatchString(s.NetrcLogin) {
+				errs.Add(key+".netrc_login", "must be letters, digits, '.', '_', '@' or '-', got %q", s.NetrcLogin)
+			}
+		}
+		if s.MavenServer != "" || s.MavenUsername != "" {
+			if !secretIDPattern.MatchString(s.MavenServer) {
+				errs.Add(key+".maven_server", "must be letters, digits, '.', '_' or '-', got %q", s.MavenServer)
+			}
+			if !netrcTokenPattern.MatchString(s.MavenUsername) {
+				errs.Add(key+".maven_username", "must be letters, digits, '.', '_', '@' or '-', got %q", s.MavenUsername)
+			}
+			if s.Env == "" {
+				errs.Add(key+".env", "is required with maven_server: the password is read from it")
+			}
+		}
+	}
+	if c.Buildah.MaxLogBytes < 0 {
+		errs.Add("buildah.max_log_bytes", "must not be negative")
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Buildah.CachePaths)) {
+		key, p := "buildah.cache_paths."+name, c.Buildah.CachePaths[name]
+		oneOf(&errs, key, name, "go-mod", "go-build", "maven", "gradle", "nuget")
+		if !path.IsAbs(p) {
+			errs.Add(key, "must be an absolute path, got %q", p)
+		}
+	}
+	if c.Buildah.WarmImages.IntervalMinutes < 0 || c.Buildah.WarmImages.MaxImages < 0 {
+		errs.Add("buildah.warm_images", "interval_minutes and max_images must not be negative")
+	}
+	for i, image := range c.Buildah.WarmImages.Images {
+		if image == "" || strings.ContainsAny(image, "$ \t") {
+			errs.Add(indexed("buildah.warm_images.images", i), "must be an image reference, got %q", image)
+		}
+	}
+	for i, dir := range c.DotNet.FallbackFolders {
+		if !path.IsAbs(dir) || strings.ContainsAny(dir, ";'") {
+			errs.Add(indexed("dotnet.fallback_folders", i), "must be an absolute path without ';' or quotes, got %q", dir)
+		}
+	}
+	for i, n := range c.Buildah.Networks {
+		key := indexed("buildah.networks", i)
+		if n.Match == "" {
+			errs.Add(key+".match", "is required")
+		}
+		if n.Network == "none" && len(n.DNS)+len(n.DNSSearch)+len(n.AddHosts) > 0 {
+			errs.Add(key, "dns settings need network access, but network is \"none\"")
+		}
+		for j, dns := range n.DNS {
+			if _, err := netip.ParseAddr(dns); err != nil {
+				errs.Add(indexed(key+".dns", j), "invalid IP address %q", dns)
+			}
+		}
+		for j, entry := range n.AddHosts {
+			host, ip, _ := strings.Cut(entry, ":")
+			if _, err := netip.ParseAddr(ip); err != nil || host == "" || strings.ContainsAny(host, " \t") {
+				errs.Add(indexed(key+".add_hosts", j), "must be host:IP, got %q", entry)
+			}
+		}
+	}
+	if _, err := buildenv.Parse(c.Worker.BuildEnv); err != nil {
+		errs.Add("worker.build_env", "%v", err)
+	}
+	for i, r := range c.Worker.FailureRules {
+		key := indexed("worker.failure_rules", i)
+		if r.Category == "" {
+			errs.Add(key+".category", "is required")
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil || r.Pattern == "" {
+			errs.Add(key+".pattern", "must be a valid regular expression")
+		}
+	}
+	for i, st := range c.Auth.StaticTokens {
+		key := indexed("auth.static_tokens", i)
+		if st.Token == "" {
+			errs.Add(key+".token", "is required")
+		}
+		oneOf(&errs, key+".role", st.Role, "viewer", "trigger", "admin")
+	}
+	if oidc := c.Auth.OIDC; oidc.JWKSURL != "" {
+		if oidc.Issuer == "" {
+			errs.Add("auth.oidc.issuer", "is required with jwks_url")
+		}
+		if oidc.Audience == "" {
+			errs.Add("auth.oidc.audience", "is required with jwks_url")
+		}
+	}
+	for i, p := range c.Policy.Signatures {
+		key := indexed("policy.signatures", i)
+		if p.Match == "" {
+			errs.Add(key+".match", "is required")
+		}
+		if p.AllowedSignersFile == "" && p.GPGHome == "" {
+			errs.Add(key, "needs allowed_signers_file or gpg_home")
+		}
+		if p.Branches != "" {
+			oneOf(&errs, key+".branches", p.Branches, "protected", "unprotected")
+		}
+	}
+	for i, p := range c.Policy.BaseImages {
+		key := indexed("policy.base_images", i)
+		if p.Match == "" {
+			errs.Add(key+".match", "is required")
+		}
+		if len(p.Allow) == 0 {
+			errs.Add(key+".allow", "must list at least one image")
+		}
+		if p.Severity != "" {
+			oneOf(&errs, key+".severity", p.Severity, "enforce", "warn")
+		}
+		if p.Branches != "" {
+			oneOf(&errs, key+".branches", p.Branches, "protected", "unprotected")
+		}
+	}
+
+	return errs.Err()
+}
+
+var (
+	secretIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	envNamePattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// netrcTokenPattern keeps .netrc fields free of whitespace and shell
+	// quoting.
+	netrcTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_.@-]+$`)
+	sha256Pattern     = regexp.MustCompile(`^[0-9A-Fa-f]{64}$`)
+)
+
+// weekdays are the FreezeWindow.Days names.
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func validateFreezeWindow(errs *validation.Errors, key string, fw FreezeWindow) {
+	if fw.Match == "" {
+		errs.Add(key+".match", "is required")
+	}
+	dated, weekly := fw.Start != "" || fw.End != "", fw.From != "" || fw.To != ""
+	switch {
+	case dated && weekly:
+		errs.Add(key, "is either a date range (start, end) or weekly (from, to), not both")
+	case dated:
+		start, err1 := time.Parse(time.RFC3339, fw.Start)
+		end, err2 := time.Parse(time.RFC3339, fw.End)
+		if err1 != nil || err2 != nil {
+			errs.Add(key, "start and end must be RFC 3339 times")
+		} else if !end.After(start) {
+			errs.Add(key+".end", "must be after start")
+		}
+	case weekly:
+		for _, t := range []struct{ name, value string }{{"from", fw.From}, {"to", fw.To}} {
+			if _, err := time.Parse("15:04", t.value); err != nil {
+				errs.Add(key+"."+t.name, "must be a time such as 18:30, got %q", t.value)
+			}
+		}
+	default:
+		errs.Add(key, "needs start and end, or from and to")
+	}
+	for j, day := range fw.Days {
+		if !slices.Contains(weekdays, day) {
+			errs.Add(indexed(key+".days", j), "must be one of %s, got %q", strings.Join(weekdays, ", "), day)
+		}
+	}
+	if dated && len(fw.Days) > 0 {
+		errs.Add(key+".days", "only apply to weekly windows")
+	}
+	if _, err := time.LoadLocation(fw.Timezone); err != nil {
+		errs.Add(key+".timezone", "unknown time zone %q", fw.Timezone)
+	}
+}
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+func oneOf(errs *validation.Errors, key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	errs.Add(key, "must be one of %v, got %q", allowed, value)
+}
+
+func indexed(key string, i int) string {
+	return key + "[" + strconv.Itoa(i) + "]"
+}
@@ -0,0 +1,73 @@
+// Package cost meters the resources a build consumes and prices them with
+// the configured rates, so build spend can be budgeted per repository.
+package cost
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+// Meter accumulates the CPU time of subprocesses run for one build. It is
+// safe for concurrent use; a nil Meter discards usage.
+type Meter struct {
+	mu  sync.Mutex
+	cpu time.Duration
+}
+
+type meterKey struct{}
+
+// WithMeter returns a context whose subprocesses are metered into a new
+// Meter.
+func WithMeter(ctx context.Context) (context.Context, *Meter) {
+	m := &Meter{}
+	return context.WithValue(ctx, meterKey{}, m), m
+}
+
+// FromContext returns the Meter carried by ctx, or nil.
+func FromContext(ctx context.Context) *Meter {
+	m, _ := ctx.Value(meterKey{}).(*Meter)
+	return m
+}
+
+// AddProcess adds the user and system CPU time of a finished subprocess,
+// including the children it waited for, to the Meter carried by ctx.
+func AddProcess(ctx context.Context, ps *os.ProcessState) {
+	m := FromContext(ctx)
+	if m == nil || ps == nil {
+		return
+	}
+	m.mu.Lock()
+	m.cpu += ps.UserTime() + ps.SystemTime()
+	m.mu.Unlock()
+}
+
+// CPU returns the metered CPU time.
+func (m *Meter) CPU() time.Duration {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cpu
+}
+
+// Usage is what one build consumed.
+type Usage struct {
+	CPU        time.Duration
+	ImageBytes int64 // compressed size of the pushed image
+}
+
+const bytesPerGB = 1 << 30
+
+// Estimate prices usage in USD: CPU hours, one month of registry storage
+// for the image, and one transfer of the image out of the registry.
+func Estimate(rates config.CostConfig, u Usage) float64 {
+	gb := float64(u.ImageBytes) / bytesPerGB
+	return u.CPU.Hours()*rates.CPUHourUSD +
+		gb*rates.StorageGBMonthUSD +
+		gb*rates.EgressGBUSD
+}
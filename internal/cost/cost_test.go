@@ -0,0 +1,38 @@
+package cost
+
+import (
+	"context"
+	"math"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+func TestEstimate(t *testing.T) {
+	rates := config.CostConfig{CPUHourUSD: 0.04, StorageGBMonthUSD: 0.10, EgressGBUSD: 0.09}
+	got := Estimate(rates, Usage{CPU: 30 * time.Minute, ImageBytes: 2 << 30})
+	if want := 0.02 + 0.20 + 0.18; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Estimate = %v, want %v", got, want)
+	}
+	if got := Estimate(config.CostConfig{}, Usage{CPU: time.Hour, ImageBytes: 1 << 30}); got != 0 {
+		t.Errorf("Estimate with zero rates = %v", got)
+	}
+}
+
+func TestMeter(t *testing.T) {
+	ctx, m := WithMeter(context.Background())
+	cmd := exec.Command("sh", "-c", "i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("sh unavailable: %v", err)
+	}
+	AddProcess(ctx, cmd.ProcessState)
+	AddProcess(context.Background(), cmd.ProcessState) // no meter: ignored
+	if m.CPU() <= 0 {
+		t.Errorf("CPU = %v, want > 0", m.CPU())
+	}
+	if (*Meter)(nil).CPU() != 0 {
+		t.Error("nil meter reports usage")
+	}
+}
@@ -0,0 +1,110 @@
+// Package debug serves runtime profiling endpoints (pprof, expvar and a
+// goroutine dump) to admins, for profiling production slowdowns without a
+// rebuild. The endpoints are disabled unless debug.enabled is set.
+package debug
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/webhook"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Routes returns the admin-only debug endpoints, or none when debugging is
+// disabled. pprof links between its pages by absolute /debug/pprof/ paths,
+// so the routes are mounted unversioned.
+func Routes(cfg *config.Config, authn *auth.Authenticator) []webhook.Route {
+	if !cfg.Debug.Enabled {
+		return nil
+	}
+	handlers := []struct {
+		pattern string
+		h       http.Handler
+	}{
+		{"/debug/pprof/", http.HandlerFunc(pprof.Index)},
+		{"/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline)},
+		{"/debug/pprof/profile", noWriteDeadline(pprof.Profile)},
+		{"/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol)},
+		{"/debug/pprof/trace", noWriteDeadline(pprof.Trace)},
+		{"GET /debug/vars", expvar.Handler()},
+		{"GET /debug/goroutines", http.HandlerFunc(goroutines)},
+	}
+	routes := make([]webhook.Route, len(handlers))
+	for i, h := range handlers {
+		routes[i] = webhook.Route{
+			Pattern:     h.pattern,
+			Handler:     authn.Require(auth.RoleAdmin, h.h),
+			Unversioned: true,
+		}
+	}
+	return routes
+}
+
+// goroutines writes the stack of every goroutine, as in a crash dump.
+func goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	r.URL.RawQuery = "debug=2"
+	pprof.Handler("goroutine").ServeHTTP(w, r)
+}
+
+// noWriteDeadline lifts the server's write timeout for handlers that stream
+// for as long as the caller asks, like a 30-second CPU profile.
+func noWriteDeadline(h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		h(w, r)
+	})
+}
+
+// NewServer starts a listener for the debug endpoints on
+// debug.worker_addr, for services without an HTTP API of their own. It
+// returns nil when debugging is disabled.
+func NewServer(cfg *config.Config, authn *auth.Authenticator, logger *zap.Logger, lc fx.Lifecycle) *http.Server {
+	routes := Routes(cfg, authn)
+	if len(routes) == 0 {
+		return nil
+	}
+	mux := http.NewServeMux()
+	for _, r := range routes {
+		mux.Handle(r.Pattern, r.Handler)
+	}
+	srv := &http.Server{
+		Addr:              cfg.Debug.WorkerAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			go func() {
+				logger.Info("debug server starting", zap.String("addr", srv.Addr))
+				if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					logger.Error("debug server error", zap.Error(err))
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return srv.Shutdown(ctx)
+		},
+	})
+	return srv
+}
+
+// Module mounts the debug endpoints on the webhook-server mux.
+var Module = fx.Module("debug",
+	fx.Provide(fx.Annotate(Routes, fx.ResultTags(`group:"routes,flatten"`))),
+)
+
+// WorkerModule serves the debug endpoints on their own listener.
+var WorkerModule = fx.Module("debug",
+	fx.Provide(NewServer),
+	fx.Invoke(func(*http.Server) {}),
+)
@@ -0,0 +1,60 @@
+package debug
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestRoutes(t *testing.T) {
+	cfg := &config.Config{Auth: config.AuthConfig{StaticTokens: []config.StaticToken{
+		{Name: "ops", Token: "admin-token", Role: "admin"},
+		{Name: "bot", Token: "viewer-token", Role: "viewer"},
+	}}}
+	authn := auth.NewAuthenticator(cfg, http.DefaultClient, zap.NewNop())
+
+	if routes := Routes(cfg, authn); len(routes) != 0 {
+		t.Fatalf("disabled debug mounted %d routes", len(routes))
+	}
+
+	cfg.Debug.Enabled = true
+	mux := http.NewServeMux()
+	for _, r := range Routes(cfg, authn) {
+		if !r.Unversioned {
+			t.Errorf("route %q is versioned", r.Pattern)
+		}
+		mux.Handle(r.Pattern, r.Handler)
+	}
+
+	tests := []struct {
+		path, token string
+		want        int
+		body        string
+	}{
+		{"/debug/vars", "", http.StatusUnauthorized, ""},
+		{"/debug/vars", "viewer-token", http.StatusForbidden, ""},
+		{"/debug/vars", "admin-token", http.StatusOK, `"memstats"`},
+		{"/debug/goroutines", "admin-token", http.StatusOK, "goroutine "},
+		{"/debug/pprof/", "admin-token", http.StatusOK, "heap"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("GET %s with %q = %d, want %d", tc.path, tc.token, rec.Code, tc.want)
+			continue
+		}
+		if tc.body != "" && !strings.Contains(rec.Body.String(), tc.body) {
+			t.Errorf("GET %s body lacks %q", tc.path, tc.body)
+		}
+	}
+}
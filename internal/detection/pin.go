@@ -0,0 +1,38 @@
+package detection
+
+// pins maps the names a language can be pinned by to their result. "java"
+// is resolved from the project's build files; see Pin.
+var pins = map[string]Result{
+	"go":     {Language: LanguageGo, BuildTool: BuildToolGo},
+	"maven":  {Language: LanguageJava, BuildTool: BuildToolMaven},
+	"gradle": {Language: LanguageJava, BuildTool: BuildToolGradle},
+	"dotnet": {Language: LanguageDotNet, BuildTool: BuildToolDotNet},
+}
+
+// PinNames lists the names a project's language can be pinned by.
+var PinNames = []string{"go", "java", "maven", "gradle", "dotnet"}
+
+// ValidPin reports whether name is one of PinNames.
+func ValidPin(name string) bool {
+	_, ok := pins[name]
+	return ok || name == "java"
+}
+
+// Pin returns the result for a pinned language name, without looking at
+// other languages' marker files: "go", "maven", "gradle", "dotnet", or
+// "java", which is Maven when projectDir has a pom.xml and Gradle when it
+// has a Gradle build file.
+func Pin(projectDir, name string) (Result, error) {
+	if r, ok := pins[name]; ok {
+		return r, nil
+	}
+	if name == "java" {
+		switch {
+		case exists(projectDir, "pom.xml"):
+			return pins["maven"], nil
+		case exists(projectDir, "build.gradle") || exists(projectDir, "build.gradle.kts"):
+			return pins["gradle"], nil
+		}
+	}
+	return Result{}, &ErrUnknownLanguage{ProjectPath: projectDir}
+}
@@ -0,0 +1,102 @@
+// Package diagnosis classifies build failures by matching known signatures
+// in build output, attaching a category and a human-readable hint so
+// developers can tell an out-of-memory kill from a missing dependency
+// without reading the whole log.
+package diagnosis
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+// Categories of the built-in rules.
+const (
+	CategoryWorkspaceQuota = "workspace_quota"
+	CategoryOOM            = "oom"
+	CategoryDiskFull       = "disk_full"
+	CategoryRegistryAuth   = "registry_auth"
+	CategoryMissingDep     = "missing_dependency"
+	CategoryNetwork        = "network"
+	CategoryWarningPolicy  = "warning_policy"
+	CategoryUnknown        = "unknown"
+)
+
+// Diagnosis is the classification of one failure.
+type Diagnosis struct {
+	Category string `json:"category"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+// OutputError is implemented by errors that carry the output of the failed
+// command, such as *buildah.CommandError.
+type OutputError interface {
+	error
+	Output() string
+}
+
+type rule struct {
+	category string
+	pattern  *regexp.Regexp
+	hint     string
+}
+
+// builtinRules are checked after the configured rules, in order.
+var builtinRules = []rule{
+	{CategoryWarningPolicy, regexp.MustCompile(`warnings fail the build \(fail_on_warning`),
+		"The build succeeded with warnings the repository's fail_on_warning setting turns into failures. Address the warnings, or raise the setting."},
+	// Ahead of oom: the tools are killed when the quota is exceeded.
+	{CategoryWorkspaceQuota, regexp.MustCompile(`workspace quota exceeded`),
+		"The job's checkout and temporary files outgrew worker.workspace_quota_mb. Check for generated artifacts, or raise the quota."},
+	{CategoryOOM, regexp.MustCompile(`(?i)out of memory|cannot allocate memory|exit (status|code) 137|signal: killed|OutOfMemoryError|JavaScript heap out of memory`),
+		"The build was killed for exceeding its memory. Reduce build parallelism or raise the worker's memory limit."},
+	{CategoryDiskFull, regexp.MustCompile(`(?i)no space left on device|disk quota exceeded`),
+		"The worker ran out of disk. Old images may need pruning, or the build storage volume is too small."},
+	{CategoryRegistryAuth, regexp.MustCompile(`(?i)401 unauthorized|unauthorized: |authentication required|denied: requested access`),
+		"The registry rejected the credentials. Check registry.auth_file and that the account may push to this repository."},
+	{CategoryMissingDep, regexp.MustCompile(`(?i)cannot find module|no required module provides package|could not resolve dependencies|could not find artifact|unable to find package|NU1101|could not resolve all (files|dependencies)`),
+		"A dependency could not be resolved. Check that it is published and that the version in the lockfile exists."},
+	{CategoryNetwork, regexp.MustCompile(`(?i)i/o timeout|tls handshake timeout|connection refused|temporary failure in name resolution|could not resolve host`),
+		"A network request failed during the build. This is often transient; retry, or check egress and DNS from the worker."},
+}
+
+// Classifier matches failures against configured and built-in rules.
+type Classifier struct {
+	rules []rule
+}
+
+// NewClassifier compiles the worker.failure_rules from cfg ahead of the
+// built-in rules, so operators can override or extend them.
+func NewClassifier(cfg *config.Config) (*Classifier, error) {
+	c := &Classifier{}
+	for i, r := range cfg.Worker.FailureRules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("worker.failure_rules[%d]: %w", i, err)
+		}
+		c.rules = append(c.rules, rule{category: r.Category, pattern: re, hint: r.Hint})
+	}
+	c.rules = append(c.rules, builtinRules...)
+	return c, nil
+}
+
+// Classify returns the diagnosis of a failed build. The error message and
+// any command output it carries are matched; the first matching rule wins.
+func (c *Classifier) Classify(err error) Diagnosis {
+	if err == nil {
+		return Diagnosis{}
+	}
+	text := err.Error()
+	var out OutputError
+	if errors.As(err, &out) {
+		text += "\n" + out.Output()
+	}
+	for _, r := range c.rules {
+		if r.pattern.MatchString(text) {
+			return Diagnosis{Category: r.category, Hint: r.hint}
+		}
+	}
+	return Diagnosis{Category: CategoryUnknown}
+}
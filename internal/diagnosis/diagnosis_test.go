@@ -0,0 +1,60 @@
+package diagnosis
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+type outputErr struct {
+	err    error
+	output string
+}
+
+func (e *outputErr) Error() string  { return e.err.Error() }
+func (e *outputErr) Unwrap() error  { return e.err }
+func (e *outputErr) Output() string { return e.output }
+
+func TestClassify(t *testing.T) {
+	c, err := NewClassifier(&config.Config{Worker: config.WorkerConfig{FailureRules: []config.FailureRule{
+		{Category: "flaky_mirror", Pattern: `mirror\.internal.*503`, Hint: "The internal mirror is flaky; retry."},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withOutput := func(output string) error {
+		return fmt.Errorf("build: %w", &outputErr{err: errors.New("buildah bud: exit status 1"), output: output})
+	}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"oom kill", errors.New("buildah bud: signal: killed"), CategoryOOM},
+		{"workspace quota kill", errors.New("workspace quota exceeded: 2048 bytes used, quota 1024 bytes: buildah bud: signal: killed"), CategoryWorkspaceQuota},
+		{"disk full in output", withOutput("write /var/lib/buildah/x: no space left on device"), CategoryDiskFull},
+		{"registry auth", withOutput("Error: pushing: unauthorized: authentication required"), CategoryRegistryAuth},
+		{"go module", withOutput("main.go:4: no required module provides package example.com/x"), CategoryMissingDep},
+		{"configured rule first", withOutput("GET https://mirror.internal/x: 503 i/o timeout"), "flaky_mirror"},
+		{"warning policy", errors.New("warnings fail the build (fail_on_warning warning): large_image (warning): image is 2048 MiB"), CategoryWarningPolicy},
+		{"unmatched", errors.New("something else"), CategoryUnknown},
+	}
+	for _, tc := range tests {
+		if got := c.Classify(tc.err); got.Category != tc.want {
+			t.Errorf("%s: category = %q, want %q", tc.name, got.Category, tc.want)
+		}
+	}
+	if d := c.Classify(nil); d.Category != "" {
+		t.Errorf("nil error classified as %q", d.Category)
+	}
+}
+
+func TestNewClassifierInvalidRule(t *testing.T) {
+	_, err := NewClassifier(&config.Config{Worker: config.WorkerConfig{FailureRules: []config.FailureRule{{Category: "x", Pattern: "("}}}})
+	if err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
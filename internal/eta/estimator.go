@@ -0,0 +1,229 @@
+package eta
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	metricspkg "github.com/jorgerua/build-system/container-build-service/internal/metrics"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// trackInterval is how often the estimates are recomputed to report
+	// significant changes.
+	trackInterval = time.Minute
+	// historyWindow is how far back completed jobs set the expected
+	// durations, refreshed every durationsTTL.
+	historyWindow = 7 * 24 * time.Hour
+	durationsTTL  = 10 * time.Minute
+	// workerWindow is how recently a worker must have claimed a build to
+	// count towards capacity.
+	workerWindow = time.Hour
+)
+
+// Estimate is a queued build job with its estimated start time.
+type Estimate struct {
+	JobID       string    `json:"job_id"`
+	Repo        string    `json:"repo"`
+	Branch      string    `json:"branch,omitempty"`
+	SHA         string    `json:"sha"`
+	BuildNumber int64     `json:"build_number,omitempty"`
+	Position    int       `json:"position"` // 1 is the next job a worker takes
+	QueuedAt    time.Time `json:"queued_at"`
+	// EstimatedStartAt is omitted when no worker has claimed a build
+	// within the last hour, as there is no capacity to estimate from.
+	EstimatedStartAt *time.Time `json:"estimated_start_at,omitempty"`
+}
+
+// Estimator estimates the start times of the jobs waiting in the queue.
+// Capacity is the workers that claimed a build within the last hour times
+// worker.concurrency, which must match the workers' setting. Every minute
+// it recomputes the estimates and reports those that moved significantly;
+// every webhook-server runs one.
+type Estimator struct {
+	cfg      config.WorkerConfig
+	queue    *natspkg.Queue
+	buildRec *tidb.BuildRecordRepository
+	metrics  *metricspkg.WebhookMetrics
+	logger   *zap.Logger
+
+	mu          sync.Mutex
+	durations   Durations
+	durationsAt time.Time
+	reported    map[string]time.Time // job ID → last reported estimate
+}
+
+// New creates an Estimator and schedules its tracking on the fx lifecycle.
+func New(cfg *config.Config, queue *natspkg.Queue, buildRec *tidb.BuildRecordRepository, metrics *metricspkg.WebhookMetrics, logger *zap.Logger, lc fx.Lifecycle) *Estimator {
+	e := &Estimator{
+		cfg:      cfg.Worker,
+		queue:    queue,
+		buildRec: buildRec,
+		metrics:  metrics,
+		logger:   logger.Named("eta"),
+		reported: map[string]time.Time{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			go func() {
+				defer close(done)
+				e.loop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			cancel()
+			<-done
+			return nil
+		},
+	})
+	return e
+}
+
+func (e *Estimator) loop(ctx context.Context) {
+	ticker := time.NewTicker(trackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.track(ctx)
+		}
+	}
+}
+
+// track reports the jobs whose estimate moved significantly since it was
+// last reported, or first computed.
+func (e *Estimator) track(ctx context.Context) {
+	estimates, err := e.Queue(ctx)
+	if err != nil {
+		e.logger.Warn("estimate queued jobs failed", zap.Error(err))
+		return
+	}
+	now := time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	reported := make(map[string]time.Time, len(estimates))
+	for _, est := range estimates {
+		if est.EstimatedStartAt == nil {
+			continue
+		}
+		next := *est.EstimatedStartAt
+		prev, ok := e.reported[est.JobID]
+		if ok && !significant(prev, next, now) {
+			reported[est.JobID] = prev
+			continue
+		}
+		if ok {
+			e.logger.Info("queued job estimate changed",
+				zap.String("job_id", est.JobID),
+				zap.String("repo", est.Repo),
+				zap.Int("position", est.Position),
+				zap.Time("from", prev),
+				zap.Time("to", next),
+			)
+			e.metrics.EstimateChanged(est.Repo, est.JobID, prev, next)
+		}
+		reported[est.JobID] = next
+	}
+	e.reported = reported
+}
+
+// Queue returns the jobs waiting in the queue, next first, with their
+// estimated start times.
+func (e *Estimator) Queue(ctx context.Context) ([]Estimate, error) {
+	now := time.Now()
+	jobs, err := e.queue.Jobs(ctx, time.Time{}, true)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(jobs) // oldest, next to be delivered, first
+	running, err := e.buildRec.RunningJobs(ctx, now.Add(-time.Duration(e.cfg.StaleClaimMinutes)*time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	workers, err := e.buildRec.ActiveWorkers(ctx, now.Add(-workerWindow))
+	if err != nil {
+		return nil, err
+	}
+	d, err := e.expectedDurations(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	busy := make([]Running, len(running))
+	for i, r := range running {
+		busy[i] = Running{Repo: r.Repo, StartedAt: r.ClaimedAt}
+		if r.Worker != "" && !slices.Contains(workers, r.Worker) {
+			workers = append(workers, r.Worker)
+		}
+	}
+	out := make([]Estimate, len(jobs))
+	repos := make([]string, len(jobs))
+	for i, j := range jobs {
+		repos[i] = githubpkg.RepoFullName(j.Job.RepoURL)
+		out[i] = Estimate{
+			JobID:       j.Job.EffectiveID(),
+			Repo:        repos[i],
+			Branch:      j.Job.Branch,
+			SHA:         j.Job.SHA,
+			BuildNumber: j.Job.BuildNumber,
+			Position:    i + 1,
+			QueuedAt:    j.QueuedAt,
+		}
+	}
+	for i, at := range Schedule(now, len(workers)*max(e.cfg.Concurrency, 1), busy, repos, d) {
+		out[i].EstimatedStartAt = &at
+	}
+	return out, nil
+}
+
+// Job returns the queued job with the given ID.
+func (e *Estimator) Job(ctx context.Context, id string) (Estimate, bool, error) {
+	estimates, err := e.Queue(ctx)
+	if err != nil {
+		return Estimate{}, false, err
+	}
+	for _, est := range estimates {
+		if est.JobID == id {
+			return est, true, nil
+		}
+	}
+	return Estimate{}, false, nil
+}
+
+// expectedDurations returns the median job duration of each repository
+// over historyWindow, cached for durationsTTL.
+func (e *Estimator) expectedDurations(ctx context.Context, now time.Time) (Durations, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.durationsAt.IsZero() && now.Sub(e.durationsAt) < durationsTTL {
+		return e.durations, nil
+	}
+	history, err := e.buildRec.JobDurationsSince(ctx, now.Add(-historyWindow))
+	if err != nil {
+		return Durations{}, err
+	}
+	samples := map[string][]time.Duration{}
+	for _, h := range history {
+		samples[h.Repo] = append(samples[h.Repo], h.Duration)
+	}
+	e.durations, e.durationsAt = medians(samples), now
+	return e.durations, nil
+}
+
+// Module provides the Estimator via fx and starts its tracking.
+var Module = fx.Module("eta",
+	fx.Provide(New),
+	fx.Invoke(func(*Estimator) {}),
+)
@@ -0,0 +1,108 @@
+// Package eta estimates when queued build jobs will start, from their
+// queue position, the recent durations of each repository's builds and
+// the workers' build slots.
+package eta
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	// fallbackDuration is the expected job duration when no job has
+	// completed recently.
+	fallbackDuration = 10 * time.Minute
+	// minShift is the smallest change of an estimate that is reported.
+	minShift = 5 * time.Minute
+)
+
+// Durations are the expected durations of build jobs.
+type Durations struct {
+	ByRepo  map[string]time.Duration
+	Default time.Duration
+}
+
+// For returns the expected duration of a job of repo.
+func (d Durations) For(repo string) time.Duration {
+	if v, ok := d.ByRepo[repo]; ok {
+		return v
+	}
+	if d.Default > 0 {
+		return d.Default
+	}
+	return fallbackDuration
+}
+
+// medians returns the median of each repository's samples, and of all
+// samples as the default.
+func medians(samples map[string][]time.Duration) Durations {
+	d := Durations{ByRepo: make(map[string]time.Duration, len(samples))}
+	var all []time.Duration
+	for repo, s := range samples {
+		d.ByRepo[repo] = median(s)
+		all = append(all, s...)
+	}
+	d.Default = median(all)
+	return d
+}
+
+func median(s []time.Duration) time.Duration {
+	if len(s) == 0 {
+		return 0
+	}
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s[len(s)/2]
+}
+
+// Running is a build job a worker is building.
+type Running struct {
+	Repo      string
+	StartedAt time.Time
+}
+
+// Schedule returns when each queued job, given by repository in queue
+// order, is expected to start: each takes the build slot that frees up
+// first, the running jobs' slots freeing up once their expected duration
+// has passed. It returns nil without slots.
+func Schedule(now time.Time, slots int, running []Running, queued []string, d Durations) []time.Time {
+	slots = max(slots, len(running))
+	if slots == 0 {
+		return nil
+	}
+	free := make([]time.Time, 0, slots)
+	for _, r := range running {
+		// An overrunning job is expected to finish any moment.
+		free = append(free, latest(r.StartedAt.Add(d.For(r.Repo)), now))
+	}
+	for len(free) < slots {
+		free = append(free, now)
+	}
+	out := make([]time.Time, len(queued))
+	for i, repo := range queued {
+		next := 0
+		for j := range free {
+			if free[j].Before(free[next]) {
+				next = j
+			}
+		}
+		out[i] = free[next]
+		free[next] = free[next].Add(d.For(repo))
+	}
+	return out
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// significant reports whether an estimate moving from prev to next, at
+// now, is worth reporting: by minShift, and by a quarter of the wait that
+// was expected.
+func significant(prev, next, now time.Time) bool {
+	shift := next.Sub(prev).Abs()
+	return shift >= minShift && shift >= prev.Sub(now)/4
+}
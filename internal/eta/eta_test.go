@@ -0,0 +1,70 @@
+package eta
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	d := Durations{ByRepo: map[string]time.Duration{"acme/api": 10 * time.Minute, "acme/web": 4 * time.Minute}, Default: 6 * time.Minute}
+	running := []Running{
+		{Repo: "acme/api", StartedAt: now.Add(-8 * time.Minute)},  // frees at +2m
+		{Repo: "acme/web", StartedAt: now.Add(-30 * time.Minute)}, // overrunning: frees now
+	}
+	got := Schedule(now, 2, running, []string{"acme/web", "acme/api", "acme/shop", "acme/web"}, d)
+	want := []time.Duration{0, 2 * time.Minute, 4 * time.Minute, 10 * time.Minute}
+	if len(got) != len(want) {
+		t.Fatalf("Schedule = %v", got)
+	}
+	for i := range want {
+		if got[i].Sub(now) != want[i] {
+			t.Errorf("job %d starts at +%s, want +%s", i, got[i].Sub(now), want[i])
+		}
+	}
+
+	if got := Schedule(now, 0, nil, []string{"acme/api"}, d); got != nil {
+		t.Errorf("Schedule without slots = %v, want nil", got)
+	}
+	// More running jobs than known slots: each running job holds a slot.
+	if got := Schedule(now, 1, running, []string{"acme/api"}, d); !got[0].Equal(now) {
+		t.Errorf("Schedule = %v, want now", got)
+	}
+}
+
+func TestMedians(t *testing.T) {
+	d := medians(map[string][]time.Duration{
+		"acme/api": {3 * time.Minute, time.Minute, 2 * time.Minute},
+		"acme/web": {9 * time.Minute},
+	})
+	if d.For("acme/api") != 2*time.Minute || d.For("acme/web") != 9*time.Minute {
+		t.Errorf("ByRepo = %v", d.ByRepo)
+	}
+	if d.For("acme/new") != 3*time.Minute {
+		t.Errorf("default = %s, want 3m", d.For("acme/new"))
+	}
+	if got := (Durations{}).For("acme/api"); got != fallbackDuration {
+		t.Errorf("without history = %s, want %s", got, fallbackDuration)
+	}
+}
+
+func TestSignificant(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		prev, next time.Duration // from now
+		want       bool
+	}{
+		{"unchanged", 10 * time.Minute, 10 * time.Minute, false},
+		{"below minimum shift", 10 * time.Minute, 14 * time.Minute, false},
+		{"later", 10 * time.Minute, 20 * time.Minute, true},
+		{"earlier", 20 * time.Minute, 5 * time.Minute, true},
+		{"small against a long wait", 4 * time.Hour, 4*time.Hour + 30*time.Minute, false},
+		{"large against a long wait", 4 * time.Hour, 5*time.Hour + 30*time.Minute, true},
+	}
+	for _, tc := range tests {
+		if got := significant(now.Add(tc.prev), now.Add(tc.next), now); got != tc.want {
+			t.Errorf("%s: significant = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
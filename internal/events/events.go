@@ -0,0 +1,243 @@
+// Package events emits build job lifecycle events as CloudEvents 1.0
+// (https://cloudevents.io) to the sinks of events.sinks, so event-driven
+// platforms such as Knative or Argo Events can react to builds without a
+// custom adapter.
+//
+// Delivery is best effort and never holds up a build: events are queued and
+// sent in the background, and dropped when the queue is full or a sink keeps
+// failing.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	"github.com/jorgerua/build-system/container-build-service/internal/jobid"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// typePrefix prefixes the CloudEvents type of every event.
+const typePrefix = "io.ocibuild."
+
+// Event types, as set in a sink's types without typePrefix.
+const (
+	JobQueued       = "job.queued"
+	JobHeld         = "job.held"
+	JobSkipped      = "job.skipped"
+	JobStarted      = "job.started"
+	JobFinished     = "job.finished"
+	ProjectFinished = "project.finished"
+	BuildTransition = "build.transition"
+)
+
+// Types lists the event types.
+var Types = []string{JobQueued, JobHeld, JobSkipped, JobStarted, JobFinished, ProjectFinished, BuildTransition}
+
+// Job is the data of an event: the job it concerns and, depending on the
+// type, its outcome.
+type Job struct {
+	JobID       string     `json:"job_id,omitempty"`
+	Repo        string     `json:"repo"` // "owner/name"
+	SHA         string     `json:"sha"`
+	Branch      string     `json:"branch,omitempty"`
+	BuildNumber int64      `json:"build_number,omitempty"`
+	Trust       string     `json:"trust,omitempty"`
+	CompileOnly bool       `json:"compile_only,omitempty"`
+	Worker      string     `json:"worker,omitempty"`     // job.started and later
+	HeldUntil   *time.Time `json:"held_until,omitempty"` // job.held
+	// Reason and Detail say why a job was skipped; see GET /skips.
+	Reason string `json:"reason,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	// Project and Status are the outcome of project.finished. Status is
+	// also job.finished's: "succeeded", "failed", "skipped" (nothing was
+	// built) or "requeued" (the job returns to the queue).
+	Project string `json:"project,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// From is the status a project's build record left in
+	// build.transition, and Status the one it entered.
+	From string `json:"from,omitempty"`
+	// Projects are the project outcomes of job.finished, by project.
+	Projects map[string]string `json:"projects,omitempty"`
+}
+
+// FromJob returns the event data of a build job.
+func FromJob(job natspkg.BuildJob) Job {
+	return Job{
+		JobID:       job.ID,
+		Repo:        githubpkg.RepoFullName(job.RepoURL),
+		SHA:         job.SHA,
+		Branch:      job.Branch,
+		BuildNumber: job.BuildNumber,
+		Trust:       string(job.Trust),
+		CompileOnly: job.CompileOnly,
+	}
+}
+
+// Event is a CloudEvent in the JSON event format.
+type Event struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            Job       `json:"data"`
+}
+
+// contentType is the media type of a structured-mode CloudEvent.
+const contentType = "application/cloudevents+json"
+
+// drainTimeout bounds the delivery of the events queued at shutdown.
+const drainTimeout = 5 * time.Second
+
+// Bridge sends events to the configured sinks. A nil Bridge, returned when
+// no sink is configured, discards events.
+type Bridge struct {
+	source  string
+	sinks   []sink
+	ids     jobid.Generator
+	queue   chan Event
+	dropped atomic.Int64
+	logger  *zap.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates the Bridge of events.sinks, or nil when there are none.
+func New(cfg *config.Config, nc *nats.Conn, httpClient *http.Client, logger *zap.Logger, lc fx.Lifecycle) (*Bridge, error) {
+	if len(cfg.Events.Sinks) == 0 {
+		return nil, nil
+	}
+	b := &Bridge{
+		source: cfg.Events.Source,
+		ids:    jobid.NewULIDGenerator(),
+		queue:  make(chan Event, cfg.Events.BufferSize),
+		logger: logger.Named("events"),
+		done:   make(chan struct{}),
+	}
+	for i, s := range cfg.Events.Sinks {
+		for _, t := range s.Types {
+			if !slices.Contains(Types, t) {
+				return nil, fmt.Errorf("events.sinks[%d].types: unknown event type %q, want one of %s", i, t, strings.Join(Types, ", "))
+			}
+		}
+		var send sender
+		switch s.Type {
+		case "http":
+			send = &httpSender{client: httpClient, url: s.URL, headers: s.Headers}
+		case "nats":
+			send = &natsSender{nc: nc, subject: s.Subject}
+		default:
+			return nil, fmt.Errorf("events.sinks[%d].type: unsupported sink %q", i, s.Type)
+		}
+		b.sinks = append(b.sinks, sink{name: s.Type + " " + s.URL + s.Subject, types: s.Types, send: send})
+	}
+
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go b.loop()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			b.cancel()
+			select {
+			case <-b.done:
+			case <-ctx.Done():
+			}
+			return nil
+		},
+	})
+	return b, nil
+}
+
+// Emit queues an event of type typ about job. It never blocks: when the
+// queue is full the event is dropped.
+func (b *Bridge) Emit(typ string, job Job) {
+	if b == nil {
+		return
+	}
+	e := Event{
+		SpecVersion:     "1.0",
+		ID:              b.ids.NewID(),
+		Source:          b.source,
+		Type:            typePrefix + typ,
+		Subject:         job.Repo,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            job,
+	}
+	select {
+	case b.queue <- e:
+	default:
+		if n := b.dropped.Add(1); n == 1 || n%100 == 0 {
+			b.logger.Warn("event queue full, dropping events", zap.String("type", e.Type), zap.Int64("dropped", n))
+		}
+	}
+}
+
+func (b *Bridge) loop() {
+	defer close(b.done)
+	for {
+		select {
+		case e := <-b.queue:
+			b.deliver(b.ctx, e)
+		case <-b.ctx.Done():
+			// Deliver what is queued, within bounds.
+			ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			defer cancel()
+			for ctx.Err() == nil {
+				select {
+				case e := <-b.queue:
+					b.deliver(ctx, e)
+				default:
+					return
+				}
+			}
+			return
+		}
+	}
+}
+
+// deliver sends e to every sink taking its type.
+func (b *Bridge) deliver(ctx context.Context, e Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		b.logger.Error("marshal event failed", zap.Error(err), zap.String("type", e.Type))
+		return
+	}
+	typ := strings.TrimPrefix(e.Type, typePrefix)
+	for _, s := range b.sinks {
+		if len(s.types) > 0 && !slices.Contains(s.types, typ) {
+			continue
+		}
+		if err := s.send.send(ctx, body); err != nil {
+			b.logger.Warn("event delivery failed",
+				zap.String("sink", s.name),
+				zap.String("type", e.Type),
+				zap.String("id", e.ID),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// Module provides the Bridge.
+var Module = fx.Module("events",
+	fx.Provide(New),
+)
@@ -0,0 +1,127 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/jobid"
+	"go.uber.org/zap"
+)
+
+// recordSender keeps the events sent to it.
+type recordSender struct{ bodies [][]byte }
+
+func (s *recordSender) send(_ context.Context, body []byte) error {
+	s.bodies = append(s.bodies, body)
+	return nil
+}
+
+func TestDeliver(t *testing.T) {
+	var (
+		got   Event
+		ctype string
+		calls int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		ctype = r.Header.Get("Content-Type")
+		if r.Header.Get("Authorization") != "Bearer t" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	finished := &recordSender{}
+	b := &Bridge{
+		source: "/cbs",
+		ids:    jobid.NewULIDGenerator(),
+		queue:  make(chan Event, 1),
+		logger: zap.NewNop(),
+		sinks: []sink{
+			{name: "http", send: &httpSender{client: srv.Client(), url: srv.URL, headers: map[string]string{"Authorization": "Bearer t"}}},
+			{name: "finished", types: []string{JobFinished}, send: finished},
+		},
+	}
+	b.Emit(JobQueued, Job{JobID: "01J", Repo: "acme/shop", SHA: "abc"})
+	b.Emit(JobQueued, Job{Repo: "acme/shop"})
+	b.deliver(context.Background(), <-b.queue)
+
+	if calls != 2 {
+		t.Errorf("%d requests, want a retry after 503", calls)
+	}
+	if ctype != "application/cloudevents+json" {
+		t.Errorf("Content-Type = %q", ctype)
+	}
+	if got.SpecVersion != "1.0" || got.Type != "io.ocibuild.job.queued" || got.Source != "/cbs" ||
+		got.Subject != "acme/shop" || got.ID == "" || got.Data.JobID != "01J" {
+		t.Errorf("event = %+v", got)
+	}
+	if len(finished.bodies) != 0 {
+		t.Errorf("filtered sink got %d events", len(finished.bodies))
+	}
+	if len(b.queue) != 0 || b.dropped.Load() != 1 {
+		t.Errorf("full queue: %d queued, %d dropped, want 0 and 1", len(b.queue), b.dropped.Load())
+	}
+}
+
+func TestJobStatus(t *testing.T) {
+	for _, c := range []struct {
+		projects map[string]string
+		err      error
+		want     string
+	}{
+		{nil, nil, "skipped"},
+		{map[string]string{"a": "success", "b": "skipped"}, nil, "succeeded"},
+		{map[string]string{"a": "success", "b": "failure"}, nil, "failed"},
+		{map[string]string{"a": "success", "b": "requeued"}, nil, "requeued"},
+		{map[string]string{"a": "success"}, errors.New("clone failed"), "requeued"},
+	} {
+		if got := jobStatus(c.projects, c.err); got != c.want {
+			t.Errorf("jobStatus(%v, %v) = %q, want %q", c.projects, c.err, got, c.want)
+		}
+	}
+}
+
+func TestRunTransition(t *testing.T) {
+	b := &Bridge{ids: jobid.NewULIDGenerator(), queue: make(chan Event, 4), logger: zap.NewNop()}
+	run := b.Start(Job{JobID: "01J", Repo: "acme/shop", SHA: "abc"})
+	run.Transition("api", "pending", "failure")
+	if e := <-b.queue; e.Type != typePrefix+JobStarted {
+		t.Fatalf("first event = %s, want job.started", e.Type)
+	}
+	e := <-b.queue
+	if e.Type != "io.ocibuild.build.transition" {
+		t.Fatalf("event type = %s", e.Type)
+	}
+	if d := e.Data; d.JobID != "01J" || d.Project != "api" || d.From != "pending" || d.Status != "failure" {
+		t.Errorf("transition data = %+v", d)
+	}
+
+	// Transitions are not project outcomes.
+	run.Finish(nil)
+	if e := <-b.queue; e.Data.Status != "skipped" || len(e.Data.Projects) != 0 {
+		t.Errorf("job.finished = %+v", e.Data)
+	}
+}
+
+func TestNilBridge(t *testing.T) {
+	var b *Bridge
+	b.Emit(JobQueued, Job{})
+	run := b.Start(Job{})
+	run.Transition("api", "pending", "success")
+	run.Project("api", "success", nil)
+	run.Finish(nil)
+	if RunFrom(context.Background()) != nil {
+		t.Error("RunFrom without a run")
+	}
+}
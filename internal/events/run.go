@@ -0,0 +1,113 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Project outcomes, as recorded in the build report.
+const (
+	projectSuccess  = "success"
+	projectFailure  = "failure"
+	projectRequeued = "requeued"
+)
+
+// Run follows one job on a worker: it emits job.started, each
+// build.transition and project.finished, and job.finished, which sums up
+// the projects. Its
+// methods are safe for concurrent use and no-ops on a nil Run.
+type Run struct {
+	bridge *Bridge
+	job    Job
+
+	mu       sync.Mutex
+	projects map[string]string
+}
+
+// Start emits job.started and returns the job's Run, nil without a Bridge.
+func (b *Bridge) Start(job Job) *Run {
+	if b == nil {
+		return nil
+	}
+	b.Emit(JobStarted, job)
+	return &Run{bridge: b, job: job, projects: map[string]string{}}
+}
+
+type ctxKey struct{}
+
+// WithRun returns ctx carrying r.
+func WithRun(ctx context.Context, r *Run) context.Context {
+	return context.WithValue(ctx, ctxKey{}, r)
+}
+
+// RunFrom returns the Run carried by ctx, or nil.
+func RunFrom(ctx context.Context) *Run {
+	r, _ := ctx.Value(ctxKey{}).(*Run)
+	return r
+}
+
+// Project emits project.finished with the project's status: "success",
+// "failure", "skipped" or "requeued", like the build report's.
+func (r *Run) Project(name, status string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.projects[name] = status
+	r.mu.Unlock()
+	job := r.job
+	job.Project, job.Status = name, status
+	if err != nil {
+		job.Error = err.Error()
+	}
+	r.bridge.Emit(ProjectFinished, job)
+}
+
+// Transition emits build.transition: the build record of a project moved
+// from one status to another.
+func (r *Run) Transition(project, from, to string) {
+	if r == nil {
+		return
+	}
+	job := r.job
+	job.Project, job.From, job.Status = project, from, to
+	r.bridge.Emit(BuildTransition, job)
+}
+
+// Finish emits job.finished. jobErr is the job handler's result: an error
+// returns the job to the queue.
+func (r *Run) Finish(jobErr error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	job := r.job
+	job.Projects = r.projects
+	r.mu.Unlock()
+	job.Status = jobStatus(job.Projects, jobErr)
+	if jobErr != nil {
+		job.Error = jobErr.Error()
+	}
+	r.bridge.Emit(JobFinished, job)
+}
+
+// jobStatus sums up a job from its project outcomes.
+func jobStatus(projects map[string]string, jobErr error) string {
+	if jobErr != nil {
+		return "requeued"
+	}
+	status := "skipped"
+	for _, s := range projects {
+		switch s {
+		case projectFailure:
+			return "failed"
+		case projectRequeued:
+			status = "requeued"
+		case projectSuccess:
+			if status == "skipped" {
+				status = "succeeded"
+			}
+		}
+	}
+	return status
+}
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// httpAttempts is how often an HTTP sink is tried per event; httpBackoff
+// is the wait before the second attempt, doubling after.
+const (
+	httpAttempts = 3
+	httpBackoff  = time.Second
+)
+
+// sink is a destination of events; types, when set, limits it to those
+// event types.
+type sink struct {
+	name  string
+	types []string
+	send  sender
+}
+
+// sender delivers one structured-mode CloudEvent.
+type sender interface {
+	send(ctx context.Context, body []byte) error
+}
+
+// httpSender POSTs events in the structured content mode of the
+// CloudEvents HTTP binding, as Knative brokers and Argo Events webhook
+// sources accept them. Server errors, 429 and network failures are
+// retried.
+type httpSender struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+func (s *httpSender) send(ctx context.Context, body []byte) error {
+	backoff := httpBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = s.post(ctx, body)
+		if !retry || attempt == httpAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends body once, reporting whether a failure is worth retrying.
+func (s *httpSender) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("POST %s: %s", s.url, resp.Status)
+}
+
+// natsSender publishes events on a core NATS subject in the structured
+// content mode of the CloudEvents NATS binding. A JetStream stream
+// capturing the subject makes them durable.
+type natsSender struct {
+	nc      *nats.Conn
+	subject string
+}
+
+func (s *natsSender) send(_ context.Context, body []byte) error {
+	msg := nats.NewMsg(s.subject)
+	msg.Header.Set("content-type", contentType)
+	msg.Data = body
+	return s.nc.PublishMsg(msg)
+}
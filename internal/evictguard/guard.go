@@ -0,0 +1,135 @@
+// Package evictguard keeps the Kubernetes cluster autoscaler from removing
+// a worker's node while the worker runs builds. The worker annotates its own
+// pod cluster-autoscaler.kubernetes.io/safe-to-evict: "false" while it
+// handles jobs and removes the annotation once it has been idle for a
+// while.
+package evictguard
+
+import (
+	"context"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Annotation is the cluster autoscaler's pod annotation.
+const Annotation = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+
+const (
+	// checkInterval is how often the worker's jobs are checked.
+	checkInterval = 5 * time.Second
+	// idleGrace is how long the worker stays protected after its last job,
+	// so back-to-back jobs do not patch the pod for each job.
+	idleGrace = time.Minute
+)
+
+// JobSource reports how many jobs the worker is handling.
+type JobSource interface {
+	RunningJobs() int
+}
+
+// annotator sets or, given nil, removes an annotation of the worker's pod.
+type annotator interface {
+	annotate(ctx context.Context, key string, value *string) error
+}
+
+// Guard maintains the worker pod's safe-to-evict annotation.
+type Guard struct {
+	pod    annotator
+	jobs   JobSource
+	logger *zap.Logger
+
+	// protected is whether the annotation may be set. It starts true, so
+	// an annotation left by a restarted container is removed once idle.
+	protected bool
+	idleSince time.Time
+}
+
+// New creates a Guard with autoscaling.eviction_protection and schedules
+// it on the fx lifecycle; it returns nil when protection is disabled.
+func New(cfg *config.Config, jobs JobSource, logger *zap.Logger, lc fx.Lifecycle) (*Guard, error) {
+	if !cfg.Autoscaling.EvictionProtection {
+		return nil, nil
+	}
+	pod, err := inClusterPod()
+	if err != nil {
+		return nil, err
+	}
+	g := &Guard{pod: pod, jobs: jobs, logger: logger.Named("evictguard"), protected: true, idleSince: time.Now()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				g.loop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			<-done
+			// The worker's jobs have been drained or requeued by now.
+			if err := g.pod.annotate(stopCtx, Annotation, nil); err != nil {
+				g.logger.Warn("remove eviction protection failed", zap.Error(err))
+			}
+			return nil
+		},
+	})
+	return g, nil
+}
+
+func (g *Guard) loop(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		g.update(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update protects the pod while jobs run and unprotects it once idle for
+// idleGrace. A failed patch is retried on the next check.
+func (g *Guard) update(ctx context.Context, now time.Time) {
+	running := g.jobs.RunningJobs()
+	switch {
+	case running > 0:
+		g.idleSince = time.Time{}
+		if g.protected {
+			return
+		}
+		value := "false"
+		if err := g.pod.annotate(ctx, Annotation, &value); err != nil {
+			g.logger.Warn("eviction protection failed", zap.Error(err))
+			return
+		}
+		g.protected = true
+		g.logger.Info("pod protected from eviction while building", zap.Int("jobs", running))
+	case g.protected:
+		if g.idleSince.IsZero() {
+			g.idleSince = now
+		}
+		if now.Sub(g.idleSince) < idleGrace {
+			return
+		}
+		if err := g.pod.annotate(ctx, Annotation, nil); err != nil {
+			g.logger.Warn("remove eviction protection failed", zap.Error(err))
+			return
+		}
+		g.protected = false
+		g.logger.Info("pod idle, eviction protection removed")
+	}
+}
+
+// Module provides the Guard and starts it.
+var Module = fx.Module("evictguard",
+	fx.Provide(New),
+	fx.Invoke(func(*Guard) {}),
+)
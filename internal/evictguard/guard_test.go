@@ -0,0 +1,66 @@
+package evictguard
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakePod records the annotation.
+type fakePod struct {
+	value   *string
+	patches int
+}
+
+func (p *fakePod) annotate(_ context.Context, key string, value *string) error {
+	if key != Annotation {
+		panic(key)
+	}
+	p.value = value
+	p.patches++
+	return nil
+}
+
+type jobCount int
+
+func (n *jobCount) RunningJobs() int { return int(*n) }
+
+func TestUpdate(t *testing.T) {
+	pod, jobs := &fakePod{}, jobCount(0)
+	start := time.Now()
+	g := &Guard{pod: pod, jobs: &jobs, logger: zap.NewNop(), protected: true, idleSince: start}
+	ctx := context.Background()
+
+	g.update(ctx, start.Add(time.Second))
+	if pod.patches != 0 {
+		t.Fatal("unprotected before the idle grace")
+	}
+	g.update(ctx, start.Add(idleGrace))
+	if pod.patches != 1 || pod.value != nil {
+		t.Fatalf("leftover annotation not removed: %d patches, %v", pod.patches, pod.value)
+	}
+
+	jobs = 1
+	now := start.Add(2 * idleGrace)
+	g.update(ctx, now)
+	g.update(ctx, now.Add(checkInterval))
+	if pod.patches != 2 || pod.value == nil || *pod.value != "false" {
+		t.Fatalf("busy: %d patches, %v, want one patch to \"false\"", pod.patches, pod.value)
+	}
+
+	jobs = 0
+	g.update(ctx, now.Add(time.Minute))
+	jobs = 1
+	g.update(ctx, now.Add(time.Minute+checkInterval))
+	jobs = 0
+	g.update(ctx, now.Add(2*time.Minute))
+	if pod.patches != 2 {
+		t.Errorf("back-to-back jobs patched the pod: %d patches", pod.patches)
+	}
+	g.update(ctx, now.Add(2*time.Minute+idleGrace))
+	if pod.patches != 3 || pod.value != nil {
+		t.Errorf("idle: %d patches, %v, want the annotation removed", pod.patches, pod.value)
+	}
+}
@@ -0,0 +1,99 @@
+package evictguard
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir holds the pod's service account credentials.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// podClient patches the worker's own pod through the Kubernetes API, with
+// the pod's service account.
+type podClient struct {
+	http      *http.Client
+	url       string // the pod's API URL
+	tokenFile string
+}
+
+// inClusterPod returns the client of the pod the process runs in. The pod
+// is named by POD_NAME and POD_NAMESPACE, set from the downward API,
+// falling back to the hostname and the service account's namespace.
+func inClusterPod() (*podClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in Kubernetes: KUBERNETES_SERVICE_HOST is not set")
+	}
+	name := os.Getenv("POD_NAME")
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		data, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("pod namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("cluster CA: no certificate in ca.crt")
+	}
+	return &podClient{
+		http: &http.Client{
+			Timeout: 10 * time.Second,
+			// The API server is in the cluster: no proxy.
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}},
+		},
+		url:       "https://" + net.JoinHostPort(host, port) + "/api/v1/namespaces/" + namespace + "/pods/" + name,
+		tokenFile: serviceAccountDir + "/token",
+	}, nil
+}
+
+// annotate sets the pod's annotation key to value, or removes it when value
+// is nil.
+func (c *podClient) annotate(ctx context.Context, key string, value *string) error {
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": map[string]*string{key: value}},
+	})
+	if err != nil {
+		return err
+	}
+	// Projected tokens are rotated: read it for every request.
+	token, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return fmt.Errorf("service account token: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, c.url, bytes.NewReader(patch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("patch pod: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("patch pod: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Package freeze applies the change freeze windows of freeze.windows: which
+// repositories are frozen and until when, and the release of the pushes
+// held during a freeze.
+package freeze
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+// overrideDirective builds a push despite a freeze.
+const overrideDirective = "[freeze-override]"
+
+// Window is a freeze window in effect.
+type Window struct {
+	Match  string    `json:"match"`
+	Reason string    `json:"reason,omitempty"`
+	Until  time.Time `json:"until"`
+}
+
+// Windows returns the windows in effect at now.
+func Windows(cfg config.FreezeConfig, now time.Time) []Window {
+	var active []Window
+	for _, fw := range cfg.Windows {
+		if until, ok := windowEnd(fw, now); ok {
+			active = append(active, Window{Match: fw.Match, Reason: fw.Reason, Until: until})
+		}
+	}
+	return active
+}
+
+// Active returns the freeze of repo ("owner/name") at now: of the windows
+// in effect matching it, the one ending last.
+func Active(cfg config.FreezeConfig, repo string, now time.Time) (Window, bool) {
+	var (
+		freeze Window
+		found  bool
+	)
+	for _, w := range Windows(cfg, now) {
+		if config.MatchRepo(w.Match, repo) > 0 && (!found || w.Until.After(freeze.Until)) {
+			freeze, found = w, true
+		}
+	}
+	return freeze, found
+}
+
+// Overridden reports whether a commit message of the push carries the
+// "[freeze-override]" directive.
+func Overridden(messages []string) bool {
+	return slices.ContainsFunc(messages, func(m string) bool {
+		return strings.Contains(strings.ToLower(m), overrideDirective)
+	})
+}
+
+// windowEnd returns the end of fw's occurrence in effect at now.
+func windowEnd(fw config.FreezeWindow, now time.Time) (time.Time, bool) {
+	if fw.Start != "" {
+		start, err1 := time.Parse(time.RFC3339, fw.Start)
+		end, err2 := time.Parse(time.RFC3339, fw.End)
+		return end, err1 == nil && err2 == nil && !now.Before(start) && now.Before(end)
+	}
+	loc, err := time.LoadLocation(fw.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+	from, err1 := time.Parse("15:04", fw.From)
+	to, err2 := time.Parse("15:04", fw.To)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, false
+	}
+	local := now.In(loc)
+	// The occurrence started today or, spanning midnight, yesterday.
+	for _, days := range []int{0, -1} {
+		d := local.AddDate(0, 0, days)
+		if len(fw.Days) > 0 && !slices.Contains(fw.Days, strings.ToLower(d.Weekday().String()[:3])) {
+			continue
+		}
+		start := time.Date(d.Year(), d.Month(), d.Day(), from.Hour(), from.Minute(), 0, 0, loc)
+		end := time.Date(d.Year(), d.Month(), d.Day(), to.Hour(), to.Minute(), 0, 0, loc)
+		if !end.After(start) {
+			end = end.AddDate(0, 0, 1)
+		}
+		if !now.Before(start) && now.Before(end) {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
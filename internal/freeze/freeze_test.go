@@ -0,0 +1,57 @@
+package freeze
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+func TestActive(t *testing.T) {
+	cfg := config.FreezeConfig{Windows: []config.FreezeWindow{
+		// Friday evening to Monday morning, Berlin time.
+		{Match: "*", Reason: "weekend", Days: []string{"fri"}, From: "18:00", To: "06:00", Timezone: "Europe/Berlin"},
+		{Match: "*", Reason: "weekend", Days: []string{"sat", "sun"}, From: "00:00", To: "00:00", Timezone: "Europe/Berlin"},
+		{Match: "acme/shop", Reason: "sale", Start: "2026-11-27T00:00:00Z", End: "2026-11-30T12:00:00Z"},
+	}}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, berlin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	tests := []struct {
+		repo      string
+		now       time.Time
+		wantUntil time.Time // zero when not frozen
+		wantWhy   string
+	}{
+		{"acme/api", at("2026-10-16 17:59"), time.Time{}, ""},                   // Friday
+		{"acme/api", at("2026-10-16 18:00"), at("2026-10-17 06:00"), "weekend"}, // overnight occurrence
+		{"acme/api", at("2026-10-17 03:00"), at("2026-10-18 00:00"), "weekend"}, // Saturday window ends last
+		{"acme/api", at("2026-10-18 23:59"), at("2026-10-19 00:00"), "weekend"}, // Sunday
+		{"acme/api", at("2026-10-19 00:00"), time.Time{}, ""},                   // Monday
+		{"acme/shop", at("2026-11-30 09:00"), at("2026-11-30 13:00"), "sale"},   // Monday, date range
+		{"acme/api", at("2026-11-30 09:00"), time.Time{}, ""},                   // range only matches the shop
+		{"acme/shop", at("2026-11-28 10:00"), at("2026-11-30 13:00"), "sale"},   // ends after the weekend window
+		{"acme/shop", at("2026-11-30 13:00"), time.Time{}, ""},                  // range end is exclusive
+	}
+	for _, tc := range tests {
+		w, ok := Active(cfg, tc.repo, tc.now)
+		if ok != !tc.wantUntil.IsZero() || !w.Until.Equal(tc.wantUntil) || w.Reason != tc.wantWhy {
+			t.Errorf("Active(%s, %s) = %+v, %v; want until %s (%q)", tc.repo, tc.now, w, ok, tc.wantUntil, tc.wantWhy)
+		}
+	}
+}
+
+func TestOverridden(t *testing.T) {
+	if !Overridden([]string{"fix checkout", "Hotfix payment outage [Freeze-Override]"}) {
+		t.Error("override directive not found")
+	}
+	if Overridden([]string{"freeze-override without brackets"}) {
+		t.Error("override found without the directive")
+	}
+}
@@ -0,0 +1,134 @@
+package freeze
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/events"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// releaseInterval is how often held builds are checked for release.
+	releaseInterval = time.Minute
+	// releaseBatch bounds the held builds published per check.
+	releaseBatch = 100
+)
+
+// Releaser publishes the pushes held by a freeze once it is over,
+// postponing those whose repository is frozen again. Every webhook-server
+// runs one; each held build is published by the one that takes it.
+type Releaser struct {
+	cfg       config.FreezeConfig
+	held      *tidb.HeldBuildRepository
+	publisher *natspkg.Publisher
+	spool     *natspkg.Spool // nil when spooling is disabled
+	events    *events.Bridge
+	logger    *zap.Logger
+}
+
+// NewReleaser creates a Releaser and schedules it on the fx lifecycle.
+// spool may be nil.
+func NewReleaser(cfg *config.Config, held *tidb.HeldBuildRepository, publisher *natspkg.Publisher, spool *natspkg.Spool, bridge *events.Bridge, logger *zap.Logger, lc fx.Lifecycle) *Releaser {
+	r := &Releaser{
+		cfg:       cfg.Freeze,
+		held:      held,
+		publisher: publisher,
+		spool:     spool,
+		events:    bridge,
+		logger:    logger.Named("freeze"),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			go func() {
+				defer close(done)
+				r.loop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			cancel()
+			<-done
+			return nil
+		},
+	})
+	return r
+}
+
+func (r *Releaser) loop(ctx context.Context) {
+	ticker := time.NewTicker(releaseInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.release(ctx, time.Now())
+		}
+	}
+}
+
+// release publishes the held builds due at now.
+func (r *Releaser) release(ctx context.Context, now time.Time) {
+	due, err := r.held.Due(ctx, now, releaseBatch)
+	if err != nil {
+		r.logger.Warn("held builds lookup failed", zap.Error(err))
+		return
+	}
+	for _, h := range due {
+		log := r.logger.With(zap.Int64("held_id", h.ID), zap.String("repo", h.Repo), zap.String("sha", h.SHA))
+		if w, frozen := Active(r.cfg, h.Repo, now); frozen {
+			if err := r.held.Postpone(ctx, h.ID, w.Reason, w.Until); err != nil {
+				log.Warn("postpone held build failed", zap.Error(err))
+			}
+			continue
+		}
+		var job natspkg.BuildJob
+		if err := json.Unmarshal(h.Job, &job); err != nil {
+			log.Error("held build unreadable, dropping it", zap.Error(err))
+			_, _ = r.held.Take(ctx, h.ID)
+			continue
+		}
+		job.PublishedAt = time.Time{} // queued now
+		taken, err := r.held.Take(ctx, h.ID)
+		if err != nil || !taken {
+			if err != nil {
+				log.Warn("take held build failed", zap.Error(err))
+			}
+			continue
+		}
+		id, err := r.publish(ctx, job)
+		if err != nil {
+			// Hold it again rather than lose the push.
+			log.Error("publish held build failed", zap.Error(err))
+			if _, err := r.held.Hold(ctx, h); err != nil {
+				log.Error("held build lost", zap.Error(err))
+			}
+			continue
+		}
+		log.Info("held build released", zap.String("job_id", id), zap.Duration("held_for", now.Sub(h.CreatedAt)))
+		job.ID = id
+		r.events.Emit(events.JobQueued, events.FromJob(job))
+	}
+}
+
+func (r *Releaser) publish(ctx context.Context, job natspkg.BuildJob) (string, error) {
+	if r.spool != nil {
+		id, _, err := r.spool.Publish(ctx, job)
+		return id, err
+	}
+	return r.publisher.Publish(ctx, job)
+}
+
+// Module provides the freeze Releaser via fx and starts it.
+var Module = fx.Module("freeze",
+	fx.Provide(NewReleaser),
+	fx.Invoke(func(*Releaser) {}),
+)
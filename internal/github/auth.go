@@ -5,6 +5,7 @@ import (
 	"crypto/hmac"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
@@ -25,10 +26,15 @@ type Client struct {
 	appID      int64
 	privateKey *rsa.PrivateKey
 	httpClient *http.Client
+	apiURL     string
 }
 
-// NewClient creates a GitHub App client from config.
-func NewClient(cfg *config.Config) (*Client, error) {
+// defaultAPIURL is the GitHub REST API root.
+const defaultAPIURL = "https://api.github.com"
+
+// NewClient creates a GitHub App client from config. API calls go through
+// httpClient.
+func NewClient(cfg *config.Config, httpClient *http.Client) (*Client, error) {
 	keyBytes, err := os.ReadFile(cfg.GitHub.PrivateKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("read github private key: %w", err)
@@ -40,7 +46,8 @@ func NewClient(cfg *config.Config) (*Client, error) {
 	return &Client{
 		appID:      cfg.GitHub.AppID,
 		privateKey: key,
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		httpClient: httpClient,
+		apiURL:     defaultAPIURL,
 	}, nil
 }
 
@@ -73,7 +80,7 @@ func (c *Client) GenerateInstallationToken(ctx context.Context, installationID i
 		return "", err
 	}
 
-	url := fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", installationID)
+	url := fmt.Sprintf("%s/app/installations/%d/access_tokens", c.apiURL, installationID)
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
 	if err != nil {
 		return "", fmt.Errorf("build token request: %w", err)
@@ -101,6 +108,13 @@ func (c *Client) GenerateInstallationToken(ctx context.Context, installationID i
 
 // ValidateWebhookSignature verifies the X-Hub-Signature-256 header.
 func ValidateWebhookSignature(secret, signature string, body []byte) error {
+	return ValidateWebhookSignatureAny([]string{secret}, signature, body)
+}
+
+// ValidateWebhookSignatureAny verifies the X-Hub-Signature-256 header
+// against several candidate secrets, e.g. a current and a rotated-out one.
+// Every candidate is checked so timing does not reveal which one matched.
+func ValidateWebhookSignatureAny(secrets []string, signature string, body []byte) error {
 	const prefix = "sha256="
 	if !strings.HasPrefix(signature, prefix) {
 		return fmt.Errorf("invalid signature format")
@@ -109,10 +123,13 @@ func ValidateWebhookSignature(secret, signature string, body []byte) error {
 	if err != nil {
 		return fmt.Errorf("decode signature hex: %w", err)
 	}
-	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write(body)
-	expected := mac.Sum(nil)
-	if !hmac.Equal(expected, sigBytes) {
+	matched := 0
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		matched |= subtle.ConstantTimeCompare(mac.Sum(nil), sigBytes)
+	}
+	if matched != 1 {
 		return fmt.Errorf("signature mismatch")
 	}
 	return nil
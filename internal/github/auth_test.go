@@ -38,3 +38,18 @@ func TestValidateWebhookSignature(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateWebhookSignatureAny(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	sig := computeTestSig("old-secret", body)
+
+	if err := ValidateWebhookSignatureAny([]string{"new-secret", "old-secret"}, sig, body); err != nil {
+		t.Errorf("rotated-out secret rejected: %v", err)
+	}
+	if err := ValidateWebhookSignatureAny([]string{"new-secret"}, sig, body); err == nil {
+		t.Error("signature by a secret outside the candidates accepted")
+	}
+	if err := ValidateWebhookSignatureAny(nil, sig, body); err == nil {
+		t.Error("signature accepted with no candidates")
+	}
+}
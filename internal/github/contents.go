@@ -0,0 +1,119 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PropagationMarker is appended to commits the service makes to Git. The
+// webhook-server ignores pushes made only of such commits, so a version
+// bump never triggers another build of itself.
+const PropagationMarker = "[skip build]"
+
+// IsPropagationCommit reports whether a commit message carries
+// PropagationMarker.
+func IsPropagationCommit(message string) bool {
+	return strings.Contains(message, PropagationMarker)
+}
+
+// ErrContentConflict is returned by PutContents when the file changed since
+// it was read; read it again and retry.
+var ErrContentConflict = errors.New("file changed since it was read")
+
+// File is a file read through the contents API.
+type File struct {
+	Content []byte
+	// SHA is the blob SHA, required to update the file. It is empty when
+	// the file does not exist.
+	SHA string
+}
+
+// GetContents reads path on branch of repo ("owner/name"). A missing file
+// returns an empty File and no error.
+func (c *Client) GetContents(ctx context.Context, token, repo, path, branch string) (File, error) {
+	u := c.contentsURL(repo, path) + "?ref=" + url.QueryEscape(branch)
+	resp, err := c.api(ctx, token, http.MethodGet, u, nil)
+	if err != nil {
+		return File{}, fmt.Errorf("get %s from %s: %w", path, repo, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return File{}, nil
+	default:
+		return File{}, fmt.Errorf("get %s from %s: unexpected status from github: %d", path, repo, resp.StatusCode)
+	}
+	var body struct {
+		Content string `json:"content"`
+		SHA     string `json:"sha"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return File{}, fmt.Errorf("decode contents of %s: %w", path, err)
+	}
+	// The API wraps base64 content at 60 columns.
+	content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(body.Content, "\n", ""))
+	if err != nil {
+		return File{}, fmt.Errorf("decode contents of %s: %w", path, err)
+	}
+	return File{Content: content, SHA: body.SHA}, nil
+}
+
+// PutContents commits content to path on branch of repo, replacing the
+// file read as prev. It returns ErrContentConflict when the file changed in
+// between.
+func (c *Client) PutContents(ctx context.Context, token, repo, path, branch, message string, content []byte, prev File) error {
+	req := struct {
+		Message string `json:"message"`
+		Content string `json:"content"`
+		Branch  string `json:"branch"`
+		SHA     string `json:"sha,omitempty"`
+	}{message, base64.StdEncoding.EncodeToString(content), branch, prev.SHA}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encode contents request: %w", err)
+	}
+	resp, err := c.api(ctx, token, http.MethodPut, c.contentsURL(repo, path), data)
+	if err != nil {
+		return fmt.Errorf("put %s to %s: %w", path, repo, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusConflict, http.StatusUnprocessableEntity:
+		return ErrContentConflict
+	default:
+		return fmt.Errorf("put %s to %s: unexpected status from github: %d", path, repo, resp.StatusCode)
+	}
+}
+
+func (c *Client) contentsURL(repo, path string) string {
+	return fmt.Sprintf("%s/repos/%s/contents/%s", c.apiURL, repo, strings.TrimPrefix(path, "/"))
+}
+
+// api sends an installation-authenticated REST request.
+func (c *Client) api(ctx context.Context, token, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.httpClient.Do(req)
+}
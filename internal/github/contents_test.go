@@ -0,0 +1,61 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContentsRoundTrip(t *testing.T) {
+	stored := map[string]string{} // path -> blob sha
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		path := r.URL.Path
+		switch r.Method {
+		case http.MethodGet:
+			sha, ok := stored[path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			// GitHub wraps the base64 content across lines.
+			enc := base64.StdEncoding.EncodeToString([]byte("1.2.3\n"))
+			_ = json.NewEncoder(w).Encode(map[string]string{"sha": sha, "content": enc[:4] + "\n" + enc[4:]})
+		case http.MethodPut:
+			var req struct{ SHA, Branch, Message string }
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req.SHA != stored[path] {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			stored[path] = "blob2"
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+	c := &Client{httpClient: srv.Client(), apiURL: srv.URL}
+	ctx := context.Background()
+
+	f, err := c.GetContents(ctx, "tok", "acme/shop", "apps/api/VERSION", "main")
+	if err != nil || f.SHA != "" {
+		t.Fatalf("missing file = %+v, %v", f, err)
+	}
+	if err := c.PutContents(ctx, "tok", "acme/shop", "apps/api/VERSION", "main", "bump", []byte("1.2.3\n"), f); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	f, err = c.GetContents(ctx, "tok", "acme/shop", "apps/api/VERSION", "main")
+	if err != nil || string(f.Content) != "1.2.3\n" || f.SHA != "blob2" {
+		t.Fatalf("read back = %q %q, %v", f.Content, f.SHA, err)
+	}
+	stale := File{SHA: "blob1"}
+	if err := c.PutContents(ctx, "tok", "acme/shop", "apps/api/VERSION", "main", "bump", nil, stale); !errors.Is(err, ErrContentConflict) {
+		t.Errorf("stale update err = %v, want ErrContentConflict", err)
+	}
+}
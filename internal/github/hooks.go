@@ -0,0 +1,114 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+// webhookEvents are the events the webhook-server handles.
+var webhookEvents = []string{"push", "pull_request"}
+
+// repoHook is the subset of a repository webhook the service manages.
+type repoHook struct {
+	ID     int64 `json:"id"`
+	Config struct {
+		URL string `json:"url"`
+	} `json:"config"`
+}
+
+// RepoInstallationID returns the ID of the App's installation covering
+// repo ("owner/name").
+func (c *Client) RepoInstallationID(ctx context.Context, repo string) (int64, error) {
+	jwtToken, err := c.GenerateJWT()
+	if err != nil {
+		return 0, err
+	}
+	var body struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.getJSON(ctx, jwtToken, fmt.Sprintf("%s/repos/%s/installation", c.apiURL, repo), &body); err != nil {
+		return 0, fmt.Errorf("installation of %s: %w", repo, err)
+	}
+	return body.ID, nil
+}
+
+// EnsureWebhook makes repo send push and pull request events to hookURL,
+// signed with secret: it updates the repository webhook already pointing
+// at hookURL, or creates one. It reports whether the webhook was created.
+// The App needs the repository webhooks permission.
+func (c *Client) EnsureWebhook(ctx context.Context, token, repo, hookURL, secret string) (bool, error) {
+	var hooks []repoHook
+	if err := c.getJSON(ctx, token, fmt.Sprintf("%s/repos/%s/hooks?per_page=100", c.apiURL, repo), &hooks); err != nil {
+		return false, fmt.Errorf("list webhooks of %s: %w", repo, err)
+	}
+	method, u, want := http.MethodPost, fmt.Sprintf("%s/repos/%s/hooks", c.apiURL, repo), http.StatusCreated
+	for _, h := range hooks {
+		if h.Config.URL == hookURL {
+			method, u, want = http.MethodPatch, fmt.Sprintf("%s/%d", u, h.ID), http.StatusOK
+			break
+		}
+	}
+	data, err := json.Marshal(map[string]any{
+		"active": true,
+		"events": webhookEvents,
+		"config": map[string]string{"url": hookURL, "content_type": "json", "secret": secret},
+	})
+	if err != nil {
+		return false, fmt.Errorf("encode webhook request: %w", err)
+	}
+	resp, err := c.api(ctx, token, method, u, data)
+	if err != nil {
+		return false, fmt.Errorf("save webhook of %s: %w", repo, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != want {
+		return false, fmt.Errorf("save webhook of %s: unexpected status from github: %d", repo, resp.StatusCode)
+	}
+	return method == http.MethodPost, nil
+}
+
+// Registrar registers the webhooks of onboarded repositories through the
+// GitHub App, pointing them at github.webhook_url.
+type Registrar struct {
+	client  *Client
+	hookURL string
+	secret  string // github.webhook_secret
+}
+
+// NewRegistrar creates a Registrar. It returns nil when github.webhook_url
+// is unset, so the webhook-server needs no App key unless it registers
+// webhooks.
+func NewRegistrar(cfg *config.Config, httpClient *http.Client) (*Registrar, error) {
+	if cfg.GitHub.WebhookURL == "" {
+		return nil, nil
+	}
+	client, err := NewClient(cfg, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return &Registrar{client: client, hookURL: cfg.GitHub.WebhookURL, secret: cfg.GitHub.WebhookSecret}, nil
+}
+
+// Register creates or updates repo's webhook, signed with secret, or with
+// github.webhook_secret when secret is empty. It reports whether the
+// webhook was created.
+func (r *Registrar) Register(ctx context.Context, repo, secret string) (bool, error) {
+	if secret == "" {
+		secret = r.secret
+	}
+	installation, err := r.client.RepoInstallationID(ctx, repo)
+	if err != nil {
+		return false, err
+	}
+	token, err := r.client.GenerateInstallationToken(ctx, installation)
+	if err != nil {
+		return false, err
+	}
+	return r.client.EnsureWebhook(ctx, token, repo, r.hookURL, secret)
+}
@@ -0,0 +1,60 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnsureWebhook(t *testing.T) {
+	type hook struct {
+		ID     int64             `json:"id"`
+		Events []string          `json:"events"`
+		Config map[string]string `json:"config"`
+	}
+	hooks := []hook{{ID: 1, Config: map[string]string{"url": "https://ci.example.com/hook"}}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req hook
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/acme/shop/hooks":
+			_ = json.NewEncoder(w).Encode(hooks)
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/acme/shop/hooks":
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			req.ID = int64(len(hooks) + 1)
+			hooks = append(hooks, req)
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPatch:
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			for i := range hooks {
+				if r.URL.Path == fmt.Sprintf("/repos/acme/shop/hooks/%d", hooks[i].ID) {
+					req.ID = hooks[i].ID
+					hooks[i] = req
+				}
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c := &Client{httpClient: srv.Client(), apiURL: srv.URL}
+	ctx := context.Background()
+	const url = "https://cbs.example.com/v1/webhook"
+
+	created, err := c.EnsureWebhook(ctx, "tok", "acme/shop", url, "one")
+	if err != nil || !created || len(hooks) != 2 {
+		t.Fatalf("first EnsureWebhook = %v, %v; hooks %+v", created, err, hooks)
+	}
+	created, err = c.EnsureWebhook(ctx, "tok", "acme/shop", url, "two")
+	if err != nil || created || len(hooks) != 2 {
+		t.Fatalf("second EnsureWebhook = %v, %v; hooks %+v", created, err, hooks)
+	}
+	if h := hooks[1]; h.Config["url"] != url || h.Config["secret"] != "two" || len(h.Events) != 2 {
+		t.Errorf("webhook = %+v", h)
+	}
+	if hooks[0].Config["url"] != "https://ci.example.com/hook" {
+		t.Errorf("unrelated webhook changed: %+v", hooks[0])
+	}
+}
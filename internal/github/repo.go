@@ -0,0 +1,23 @@
+package github
+
+import "strings"
+
+// RepoFullName extracts "owner/name" from a clone URL such as
+// https://github.com/acme/shop.git or git@github.com:acme/shop.git.
+// It returns the input unchanged when no owner/name pair can be found.
+func RepoFullName(cloneURL string) string {
+	s := strings.TrimSuffix(strings.TrimSuffix(cloneURL, "/"), ".git")
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+		if j := strings.Index(s, "/"); j >= 0 {
+			s = s[j+1:]
+		}
+	} else if i := strings.Index(s, ":"); i >= 0 {
+		s = s[i+1:]
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 {
+		return cloneURL
+	}
+	return parts[len(parts)-2] + "/" + parts[len(parts)-1]
+}
@@ -0,0 +1,19 @@
+package github
+
+import "testing"
+
+func TestRepoFullName(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/acme/shop.git":                  "acme/shop",
+		"https://github.com/acme/shop":                      "acme/shop",
+		"https://x-access-token:t@github.com/acme/shop.git": "acme/shop",
+		"git@github.com:acme/shop.git":                      "acme/shop",
+		"https://ghe.example.com/enterprise/acme/shop.git":  "acme/shop",
+		"not-a-url": "not-a-url",
+	}
+	for in, want := range tests {
+		if got := RepoFullName(in); got != want {
+			t.Errorf("RepoFullName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// InstalledRepo is a repository the GitHub App is installed on.
+type InstalledRepo struct {
+	FullName      string `json:"full_name"`
+	DefaultBranch string `json:"default_branch"`
+	Archived      bool   `json:"archived"`
+	Fork          bool   `json:"fork"`
+}
+
+// OrgInstallationID returns the ID of the App's installation on an
+// organization or user account.
+func (c *Client) OrgInstallationID(ctx context.Context, org string) (int64, error) {
+	jwtToken, err := c.GenerateJWT()
+	if err != nil {
+		return 0, err
+	}
+	var body struct {
+		ID int64 `json:"id"`
+	}
+	u := fmt.Sprintf("%s/orgs/%s/installation", c.apiURL, url.PathEscape(org))
+	if err := c.getJSON(ctx, jwtToken, u, &body); err != nil {
+		return 0, fmt.Errorf("installation of %s: %w", org, err)
+	}
+	return body.ID, nil
+}
+
+// InstallationRepos lists the repositories an installation token can
+// access.
+func (c *Client) InstallationRepos(ctx context.Context, token string) ([]InstalledRepo, error) {
+	var repos []InstalledRepo
+	for page := 1; ; page++ {
+		var body struct {
+			TotalCount   int             `json:"total_count"`
+			Repositories []InstalledRepo `json:"repositories"`
+		}
+		u := fmt.Sprintf("%s/installation/repositories?per_page=100&page=%d", c.apiURL, page)
+		if err := c.getJSON(ctx, token, u, &body); err != nil {
+			return nil, fmt.Errorf("list installation repositories: %w", err)
+		}
+		repos = append(repos, body.Repositories...)
+		if len(body.Repositories) == 0 || len(repos) >= body.TotalCount {
+			return repos, nil
+		}
+	}
+}
+
+// Languages returns the bytes of code per language in repo ("owner/name"),
+// as detected by GitHub.
+func (c *Client) Languages(ctx context.Context, token, repo string) (map[string]int64, error) {
+	langs := map[string]int64{}
+	if err := c.getJSON(ctx, token, fmt.Sprintf("%s/repos/%s/languages", c.apiURL, repo), &langs); err != nil {
+		return nil, fmt.Errorf("languages of %s: %w", repo, err)
+	}
+	return langs, nil
+}
+
+// BranchProtected reports whether branch of repo ("owner/name") has branch
+// protection enabled.
+func (c *Client) BranchProtected(ctx context.Context, token, repo, branch string) (bool, error) {
+	var body struct {
+		Protected bool `json:"protected"`
+	}
+	segments := strings.Split(branch, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	u := fmt.Sprintf("%s/repos/%s/branches/%s", c.apiURL, repo, strings.Join(segments, "/"))
+	if err := c.getJSON(ctx, token, u, &body); err != nil {
+		return false, fmt.Errorf("branch %s of %s: %w", branch, repo, err)
+	}
+	return body.Protected, nil
+}
+
+// getJSON sends an authenticated GET and decodes the JSON response into v.
+func (c *Client) getJSON(ctx context.Context, token, u string, v any) error {
+	resp, err := c.api(ctx, token, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("unexpected status from github: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,63 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInstallationRepos(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/installation/repositories":
+			page := r.URL.Query().Get("page")
+			var repos []InstalledRepo
+			if page == "1" {
+				for i := range 100 {
+					repos = append(repos, InstalledRepo{FullName: fmt.Sprintf("acme/r%d", i)})
+				}
+			} else if page == "2" {
+				repos = []InstalledRepo{{FullName: "acme/last", Archived: true}}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"total_count": 101, "repositories": repos})
+		case "/repos/acme/shop/languages":
+			_, _ = w.Write([]byte(`{"Go": 1200, "Shell": 30}`))
+		case "/repos/acme/shop/branches/release/1.x":
+			_, _ = w.Write([]byte(`{"name": "release/1.x", "protected": true}`))
+		case "/repos/acme/shop/branches/spike":
+			_, _ = w.Write([]byte(`{"name": "spike", "protected": false}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c := &Client{httpClient: srv.Client(), apiURL: srv.URL}
+	ctx := context.Background()
+
+	repos, err := c.InstallationRepos(ctx, "tok")
+	if err != nil || len(repos) != 101 || repos[100].FullName != "acme/last" || !repos[100].Archived {
+		t.Fatalf("repos = %d, %v", len(repos), err)
+	}
+	langs, err := c.Languages(ctx, "tok", "acme/shop")
+	if err != nil || langs["Go"] != 1200 {
+		t.Errorf("languages = %v, %v", langs, err)
+	}
+	if _, err := c.Languages(ctx, "tok", "acme/gone"); err == nil {
+		t.Error("languages of a missing repository succeeded")
+	}
+	for branch, want := range map[string]bool{"release/1.x": true, "spike": false} {
+		if got, err := c.BranchProtected(ctx, "tok", "acme/shop", branch); err != nil || got != want {
+			t.Errorf("BranchProtected(%s) = %v, %v; want %v", branch, got, err, want)
+		}
+	}
+	if _, err := c.BranchProtected(ctx, "tok", "acme/shop", "gone"); err == nil {
+		t.Error("protection of a missing branch succeeded")
+	}
+}
@@ -0,0 +1,96 @@
+// Package hostinfo describes the machine a worker runs on — hostname,
+// kernel, container runtime and cgroup limits — for build records, so a
+// failure that only happens on some nodes can be traced to them.
+package hostinfo
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Info describes a worker host.
+type Info struct {
+	Hostname string `json:"hostname"`
+	Kernel   string `json:"kernel,omitempty"`
+	// Runtime is the container runtime the worker runs under ("containerd",
+	// "cri-o", "docker", "podman"), or "" outside a container.
+	Runtime string `json:"runtime,omitempty"`
+	// CPULimit is the cgroup CPU quota in cores; 0 is unlimited.
+	CPULimit float64 `json:"cpu_limit,omitempty"`
+	// MemoryLimit is the cgroup memory limit in bytes; 0 is unlimited.
+	MemoryLimit int64 `json:"memory_limit,omitempty"`
+}
+
+// Collect describes the current host. If the hostname lookup fails, it
+// returns the rest of the description with the error.
+func Collect() (Info, error) {
+	info := collect("/")
+	var err error
+	info.Hostname, err = os.Hostname()
+	return info, err
+}
+
+// collect reads the host's description from the filesystem rooted at root.
+func collect(root string) Info {
+	read := func(path string) string {
+		data, _ := os.ReadFile(filepath.Join(root, path))
+		return strings.TrimSpace(string(data))
+	}
+	info := Info{Kernel: read("proc/sys/kernel/osrelease")}
+	info.Runtime = detectRuntime(root, read("proc/self/cgroup"))
+
+	// cgroup v2, else v1.
+	if cpu := strings.Fields(read("sys/fs/cgroup/cpu.max")); len(cpu) == 2 {
+		info.CPULimit = quota(cpu[0], cpu[1])
+	} else {
+		info.CPULimit = quota(read("sys/fs/cgroup/cpu/cpu.cfs_quota_us"), read("sys/fs/cgroup/cpu/cpu.cfs_period_us"))
+	}
+	mem := read("sys/fs/cgroup/memory.max")
+	if mem == "" {
+		mem = read("sys/fs/cgroup/memory/memory.limit_in_bytes")
+	}
+	if n, err := strconv.ParseInt(mem, 10, 64); err == nil && n < 1<<62 {
+		// cgroup v1 reports no limit as a page-aligned near-maximum value.
+		info.MemoryLimit = n
+	}
+	return info
+}
+
+// quota returns the cores allowed by a CFS quota and period, or 0 when the
+// quota is unlimited ("max" or -1) or unknown.
+func quota(q, period string) float64 {
+	qn, err1 := strconv.ParseFloat(q, 64)
+	pn, err2 := strconv.ParseFloat(period, 64)
+	if err1 != nil || err2 != nil || qn <= 0 || pn <= 0 {
+		return 0
+	}
+	return qn / pn
+}
+
+// runtimeMarkers map /proc/self/cgroup substrings to container runtimes.
+var runtimeMarkers = []struct{ marker, runtime string }{
+	{"cri-containerd", "containerd"},
+	{"containerd", "containerd"},
+	{"crio", "cri-o"},
+	{"docker", "docker"},
+	{"libpod", "podman"},
+}
+
+func detectRuntime(root, cgroup string) string {
+	for _, m := range runtimeMarkers {
+		if strings.Contains(cgroup, m.marker) {
+			return m.runtime
+		}
+	}
+	// cgroup v2 namespaces hide the path ("0::/"); fall back to the files
+	// runtimes leave in the container.
+	if _, err := os.Stat(filepath.Join(root, "run/.containerenv")); err == nil {
+		return "podman"
+	}
+	if _, err := os.Stat(filepath.Join(root, ".dockerenv")); err == nil {
+		return "docker"
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+package hostinfo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  Info
+	}{
+		{
+			name: "cgroup v2 in containerd",
+			files: map[string]string{
+				"proc/sys/kernel/osrelease": "6.8.0-1015-aws\n",
+				"proc/self/cgroup":          "0::/kubepods/burstable/pod1/cri-containerd-abc.scope\n",
+				"sys/fs/cgroup/cpu.max":     "250000 100000\n",
+				"sys/fs/cgroup/memory.max":  "8589934592\n",
+			},
+			want: Info{Kernel: "6.8.0-1015-aws", Runtime: "containerd", CPULimit: 2.5, MemoryLimit: 8 << 30},
+		},
+		{
+			name: "cgroup v2 unlimited in podman",
+			files: map[string]string{
+				"proc/self/cgroup":         "0::/\n",
+				"run/.containerenv":        "",
+				"sys/fs/cgroup/cpu.max":    "max 100000\n",
+				"sys/fs/cgroup/memory.max": "max\n",
+			},
+			want: Info{Runtime: "podman"},
+		},
+		{
+			name: "cgroup v1 in docker",
+			files: map[string]string{
+				"proc/self/cgroup":                           "12:cpu,cpuacct:/docker/abc\n",
+				"sys/fs/cgroup/cpu/cpu.cfs_quota_us":         "-1\n",
+				"sys/fs/cgroup/cpu/cpu.cfs_period_us":        "100000\n",
+				"sys/fs/cgroup/memory/memory.limit_in_bytes": "9223372036854771712\n",
+			},
+			want: Info{Runtime: "docker"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, tc.files)
+			if got := collect(root); got != tc.want {
+				t.Errorf("collect = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
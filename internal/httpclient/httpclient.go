@@ -0,0 +1,77 @@
+// Package httpclient builds the client of the service's outbound HTTP
+// calls, so every caller honors the same proxy, CA bundle and timeouts.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/fx"
+)
+
+// New returns an http.Client configured by cfg.HTTPClient. It fails when
+// the CA bundle cannot be read or holds no certificate.
+func New(cfg *config.Config) (*http.Client, error) {
+	hc := cfg.HTTPClient
+	connect := time.Duration(hc.ConnectTimeoutSeconds) * time.Second
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{Timeout: connect, KeepAlive: 30 * time.Second}).DialContext
+	t.TLSHandshakeTimeout = connect
+	t.Proxy = http.ProxyFromEnvironment
+	if hc.Proxy != "" {
+		u, err := url.Parse(hc.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("http client proxy: %w", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	if hc.CABundle != "" {
+		pool, err := certPool(hc.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &http.Client{
+		Transport: t,
+		Timeout:   time.Duration(hc.TimeoutSeconds) * time.Second,
+	}, nil
+}
+
+// certPool returns the system roots plus the certificates of a PEM bundle.
+func certPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA bundle %s: no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// WithTimeout returns a copy of c, sharing its transport, whose requests
+// are bounded by d instead.
+func WithTimeout(c *http.Client, d time.Duration) *http.Client {
+	cp := *c
+	cp.Timeout = d
+	return &cp
+}
+
+// Module provides the shared outbound *http.Client via fx.
+var Module = fx.Module("httpclient",
+	fx.Provide(New),
+)
@@ -0,0 +1,72 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+func testConfig(hc config.HTTPClientConfig) *config.Config {
+	hc.ConnectTimeoutSeconds, hc.TimeoutSeconds = 5, 10
+	return &config.Config{HTTPClient: hc}
+}
+
+func TestNewTrustsCABundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer srv.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(bundle, block, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := New(testConfig(config.HTTPClientConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Get(srv.URL); err == nil {
+		t.Error("request to a self-signed server succeeded without the CA bundle")
+	}
+
+	c, err := New(testConfig(config.HTTPClientConfig{CABundle: bundle}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request with CA bundle: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewRejectsEmptyCABundle(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundle, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(testConfig(config.HTTPClientConfig{CABundle: bundle})); err == nil {
+		t.Error("New accepted a CA bundle without certificates")
+	}
+}
+
+func TestNewProxy(t *testing.T) {
+	c, err := New(testConfig(config.HTTPClientConfig{Proxy: "http://proxy.internal:3128"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/", nil)
+	got, err := c.Transport.(*http.Transport).Proxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := url.Parse("http://proxy.internal:3128"); got.String() != want.String() {
+		t.Errorf("proxy = %v, want %v", got, want)
+	}
+}
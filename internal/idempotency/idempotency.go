@@ -0,0 +1,166 @@
+// Package idempotency replays the responses of API requests retried with
+// the same Idempotency-Key header, so a client retrying a request that
+// queues builds does not queue them twice.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"go.uber.org/zap"
+)
+
+const (
+	// Header carries the client's key for a request.
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on replayed responses.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength  = 255
+	maxBodyBytes  = 1 << 20
+	storeTimeout  = 5 * time.Second
+	maxStoredBody = 1 << 20
+)
+
+// store is the subset of tidb.IdempotencyKeyRepository used by Keys.
+type store interface {
+	Reserve(ctx context.Context, scope, key, fingerprint string, ttl time.Duration) (*tidb.StoredResponse, error)
+	Complete(ctx context.Context, scope, key string, status int, contentType string, body []byte) error
+	Release(ctx context.Context, scope, key string) error
+}
+
+// Keys makes handlers idempotent per caller and key.
+type Keys struct {
+	store  store
+	ttl    time.Duration
+	logger *zap.Logger
+}
+
+// New creates Keys keeping responses for server.idempotency_key_hours.
+func New(cfg *config.Config, repo *tidb.IdempotencyKeyRepository, logger *zap.Logger) *Keys {
+	return &Keys{
+		store:  repo,
+		ttl:    time.Duration(cfg.Server.IdempotencyKeyHours) * time.Hour,
+		logger: logger.Named("idempotency"),
+	}
+}
+
+// Wrap handles a request with an Idempotency-Key header once per caller
+// and key: a retry gets the first response replayed, with
+// Idempotent-Replayed: true. Reusing a key for another request is refused
+// with 422, and a retry while the first request is in flight with 409.
+// Server errors (5xx) are not kept, so the request can be retried. It must
+// run after authentication, which names the caller. Requests without the
+// header are handled as usual.
+func (k *Keys) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			writeError(w, http.StatusBadRequest, "Idempotency-Key longer than 255 bytes")
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		p, _ := auth.PrincipalFrom(r.Context())
+		scope, fp := p.Subject, fingerprint(r, body)
+		ctx, cancel := storeContext(r)
+		stored, err := k.store.Reserve(ctx, scope, key, fp, k.ttl)
+		cancel()
+		switch {
+		case err != nil:
+			// Handling the request anyway could act twice on a retry.
+			k.logger.Error("idempotency key reservation failed", zap.Error(err))
+			writeError(w, http.StatusServiceUnavailable, "idempotency store unavailable")
+			return
+		case stored != nil && stored.Fingerprint != fp:
+			writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was used for a different request")
+			return
+		case stored != nil && stored.Status == 0:
+			writeError(w, http.StatusConflict, "a request with this Idempotency-Key is in progress")
+			return
+		case stored != nil:
+			if stored.ContentType != "" {
+				w.Header().Set("Content-Type", stored.ContentType)
+			}
+			w.Header().Set(ReplayedHeader, "true")
+			w.WriteHeader(stored.Status)
+			_, _ = w.Write(stored.Body)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		ctx, cancel = storeContext(r)
+		defer cancel()
+		if rec.status >= 500 || rec.body.Len() > maxStoredBody {
+			if err := k.store.Release(ctx, scope, key); err != nil {
+				k.logger.Warn("idempotency key release failed", zap.Error(err))
+			}
+			return
+		}
+		if err := k.store.Complete(ctx, scope, key, rec.status, w.Header().Get("Content-Type"), rec.body.Bytes()); err != nil {
+			// The key stays in progress until it expires: retries get 409
+			// rather than a second build.
+			k.logger.Error("idempotency key completion failed", zap.Error(err))
+		}
+	})
+}
+
+// storeContext bounds a store call, which must complete even when the
+// client has gone away.
+func storeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(r.Context()), storeTimeout)
+}
+
+// fingerprint identifies a request by its method, path and body.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder passes a response through, keeping its status and body.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,87 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"go.uber.org/zap"
+)
+
+// memStore is an in-memory store.
+type memStore map[string]*tidb.StoredResponse
+
+func (m memStore) Reserve(_ context.Context, scope, key, fingerprint string, _ time.Duration) (*tidb.StoredResponse, error) {
+	if s, ok := m[scope+"/"+key]; ok {
+		return s, nil
+	}
+	m[scope+"/"+key] = &tidb.StoredResponse{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (m memStore) Complete(_ context.Context, scope, key string, status int, contentType string, body []byte) error {
+	s := m[scope+"/"+key]
+	s.Status, s.ContentType, s.Body = status, contentType, body
+	return nil
+}
+
+func (m memStore) Release(_ context.Context, scope, key string) error {
+	delete(m, scope+"/"+key)
+	return nil
+}
+
+func TestWrap(t *testing.T) {
+	store := memStore{}
+	k := &Keys{store: store, ttl: time.Hour, logger: zap.NewNop()}
+	calls, status := 0, http.StatusAccepted
+	h := k.Wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"job_id":"01J"}`))
+	}))
+	do := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/webhook/simulate", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(Header, key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	do("", "{}")
+	do("", "{}")
+	if calls != 2 {
+		t.Fatalf("without a key: %d calls, want 2", calls)
+	}
+
+	first := do("k1", `{"sha":"a"}`)
+	replay := do("k1", `{"sha":"a"}`)
+	if calls != 3 {
+		t.Errorf("retry handled again: %d calls, want 3", calls)
+	}
+	if replay.Code != first.Code || replay.Body.String() != first.Body.String() ||
+		replay.Header().Get(ReplayedHeader) != "true" || replay.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("replay = %d %q %v, want the first response", replay.Code, replay.Body, replay.Header())
+	}
+	if rec := do("k1", `{"sha":"b"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused for another request: %d, want 422", rec.Code)
+	}
+
+	store["/busy"] = &tidb.StoredResponse{Fingerprint: store["/k1"].Fingerprint}
+	if rec := do("busy", `{"sha":"a"}`); rec.Code != http.StatusConflict {
+		t.Errorf("in flight: %d, want 409", rec.Code)
+	}
+
+	status = http.StatusServiceUnavailable
+	do("k2", "{}")
+	do("k2", "{}")
+	if calls != 5 {
+		t.Errorf("server error kept: %d calls, want 5", calls)
+	}
+}
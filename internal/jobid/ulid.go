@@ -0,0 +1,108 @@
+// Package jobid generates build job identifiers.
+//
+// IDs are ULIDs (https://github.com/ulid/spec): 26 Crockford base32
+// characters encoding a millisecond timestamp followed by 80 random bits, so
+// they sort lexically in creation order and embed when the job was created.
+package jobid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Generator produces unique job IDs.
+type Generator interface {
+	NewID() string
+}
+
+// crockford is the ULID base32 alphabet (no I, L, O, U).
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator generates monotonic ULIDs: IDs created within the same
+// millisecond increment the random part, so they still sort in order.
+type ULIDGenerator struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entropy io.Reader
+	lastMS  uint64
+	last    [10]byte
+}
+
+// NewULIDGenerator returns a generator using the system clock and crypto/rand.
+func NewULIDGenerator() *ULIDGenerator {
+	return &ULIDGenerator{now: time.Now, entropy: rand.Reader}
+}
+
+// NewID returns the next ULID.
+func (g *ULIDGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(g.now().UnixMilli())
+	// Within the same millisecond the previous random part is incremented.
+	if ms != g.lastMS || !increment(&g.last) {
+		g.lastMS = ms
+		if _, err := io.ReadFull(g.entropy, g.last[:]); err != nil {
+			panic("jobid: entropy source failed: " + err.Error())
+		}
+	}
+
+	var b [16]byte
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], ms)
+	copy(b[:6], ts[2:])
+	copy(b[6:], g.last[:])
+	return encode(b)
+}
+
+// increment adds one to the 80-bit big-endian value, reporting false on
+// overflow.
+func increment(r *[10]byte) bool {
+	for i := len(r) - 1; i >= 0; i-- {
+		r[i]++
+		if r[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encode renders 128 bits as 26 base32 characters (the first carries 3 bits).
+func encode(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// Time returns the creation time embedded in a ULID job ID. It reports false
+// for IDs that are not ULIDs, such as the commit-SHA prefixes used by jobs
+// published before job IDs were introduced.
+func Time(id string) (time.Time, bool) {
+	if len(id) != 26 || id[0] > '7' {
+		return time.Time{}, false
+	}
+	var ms uint64
+	for i := 0; i < 10; i++ {
+		v := strings.IndexByte(crockford, id[i])
+		if v < 0 {
+			return time.Time{}, false
+		}
+		ms = ms<<5 | uint64(v)
+	}
+	for i := 10; i < 26; i++ {
+		if strings.IndexByte(crockford, id[i]) < 0 {
+			return time.Time{}, false
+		}
+	}
+	return time.UnixMilli(int64(ms)).UTC(), true
+}
@@ -0,0 +1,58 @@
+package jobid
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestULIDOrderingAndTime(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	g := NewULIDGenerator()
+	g.now = func() time.Time { return at }
+
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = g.NewID()
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Error("IDs within one millisecond are not monotonic")
+	}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if len(id) != 26 || seen[id] {
+			t.Fatalf("bad or duplicate id %q", id)
+		}
+		seen[id] = true
+	}
+
+	got, ok := Time(ids[0])
+	if !ok || !got.Equal(at) {
+		t.Errorf("Time(%q) = %v, %v; want %v", ids[0], got, ok, at)
+	}
+
+	g.now = func() time.Time { return at.Add(time.Millisecond) }
+	if next := g.NewID(); next <= ids[len(ids)-1] {
+		t.Errorf("later ID %q does not sort after %q", next, ids[len(ids)-1])
+	}
+}
+
+func TestULIDKnownEncoding(t *testing.T) {
+	g := &ULIDGenerator{
+		now:     func() time.Time { return time.UnixMilli(1469918176385) },
+		entropy: bytes.NewReader(make([]byte, 10)),
+	}
+	// Timestamp example from the ULID spec.
+	if id := g.NewID(); id[:10] != "01ARYZ6S41" || id[10:] != "0000000000000000" {
+		t.Errorf("NewID = %q", id)
+	}
+}
+
+func TestTimeRejectsNonULID(t *testing.T) {
+	for _, id := range []string{"abcdef12", "", "8ZZZZZZZZZZZZZZZZZZZZZZZZZ", "01ARYZ6S41000000000000000U"} {
+		if _, ok := Time(id); ok {
+			t.Errorf("Time(%q) reported a ULID", id)
+		}
+	}
+}
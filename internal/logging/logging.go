@@ -1,13 +1,82 @@
 package logging
 
 import (
+	"strings"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
-// New creates a production zap logger (JSON to stdout).
-func New() (*zap.Logger, error) {
-	return zap.NewProduction()
+// New creates a production zap logger (JSON to stdout) at log.level, with
+// the log.components levels applied to the named component loggers.
+func New(cfg *config.Config) (*zap.Logger, error) {
+	base, err := zapcore.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return nil, err
+	}
+	names, err := cfg.Log.ComponentLevels()
+	if err != nil {
+		return nil, err
+	}
+	levels := componentLevels{base: base, names: map[string]zapcore.Level{}}
+	lowest := base
+	for name, s := range names {
+		l, err := zapcore.ParseLevel(s)
+		if err != nil {
+			return nil, err
+		}
+		levels.names[name], lowest = l, min(lowest, l)
+	}
+
+	zcfg := zap.NewProductionConfig()
+	zcfg.Level = zap.NewAtomicLevelAt(lowest)
+	if len(levels.names) == 0 {
+		return zcfg.Build()
+	}
+	return zcfg.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelCore{Core: core, levels: levels}
+	}))
+}
+
+// componentLevels maps logger names to levels; see config.LogConfig.
+type componentLevels struct {
+	base  zapcore.Level
+	names map[string]zapcore.Level
+}
+
+// level returns the level of the logger named name: that of the longest
+// configured name it is, or is a sub-logger of, else the base level.
+func (c componentLevels) level(name string) zapcore.Level {
+	for {
+		if l, ok := c.names[name]; ok {
+			return l
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return c.base
+		}
+		name = name[:i]
+	}
+}
+
+// levelCore filters entries by the level of their logger's component. The
+// wrapped core is enabled at the lowest configured level.
+type levelCore struct {
+	zapcore.Core
+	levels componentLevels
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *levelCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if e.Level < c.levels.level(e.LoggerName) {
+		return ce
+	}
+	return c.Core.Check(e, ce)
 }
 
 // Module provides *zap.Logger via fx.
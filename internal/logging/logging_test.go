@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestComponentLevels(t *testing.T) {
+	levels := componentLevels{
+		base: zapcore.InfoLevel,
+		names: map[string]zapcore.Level{
+			"orchestrator":           zapcore.DebugLevel,
+			"orchestrator.bootstrap": zapcore.WarnLevel,
+			"nats":                   zapcore.WarnLevel,
+		},
+	}
+	obs, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(&levelCore{Core: obs, levels: levels})
+
+	logger.Debug("root debug")
+	logger.Info("root info")
+	logger.Named("orchestrator").Debug("orchestrator debug")
+	logger.Named("orchestrator").Named("bootstrap").Info("bootstrap info")
+	logger.Named("orchestrator").Named("bootstrap").With(zap.String("job", "1")).Warn("bootstrap warn")
+	logger.Named("nats").Info("nats info")
+	logger.Named("natsx").Info("natsx info")
+
+	var got []string
+	for _, e := range logs.All() {
+		got = append(got, e.Message)
+	}
+	want := []string{"root info", "orchestrator debug", "bootstrap warn", "natsx info"}
+	if len(got) != len(want) {
+		t.Fatalf("logged %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("logged %q, want %q", got, want)
+			break
+		}
+	}
+}
@@ -27,12 +27,46 @@ func (m *BuildMetrics) BuildDuration(project, language, status string, d time.Du
 	_ = m.client.Histogram("build.duration", d.Seconds(), tags, 1)
 }
 
+// BootstrapDuration emits build.bootstrap.duration histogram: the workspace
+// package install before nx runs.
+func (m *BuildMetrics) BootstrapDuration(manager, status string, d time.Duration) {
+	tags := []string{"package_manager:" + manager, "status:" + status}
+	_ = m.client.Histogram("build.bootstrap.duration", d.Seconds(), tags, 1)
+}
+
+// DependencyDownload emits build.bootstrap.download_bytes histogram: how
+// much the package cache grew during the workspace install.
+func (m *BuildMetrics) DependencyDownload(manager string, bytes int64) {
+	_ = m.client.Histogram("build.bootstrap.download_bytes", float64(bytes), []string{"package_manager:" + manager}, 1)
+}
+
+// LayerCache counts an image build's steps in build.layer_cache.steps and
+// those served from the layer cache in build.layer_cache.hits; their ratio
+// is the layer cache hit rate.
+func (m *BuildMetrics) LayerCache(project string, steps, cached int) {
+	tags := []string{"project:" + project}
+	_ = m.client.Count("build.layer_cache.steps", int64(steps), tags, 1)
+	_ = m.client.Count("build.layer_cache.hits", int64(cached), tags, 1)
+}
+
 // BuildStatus increments build.status count.
 func (m *BuildMetrics) BuildStatus(project, status string) {
 	tags := []string{"project:" + project, "status:" + status}
 	_ = m.client.Incr("build.status", tags, 1)
 }
 
+// FailureCategory increments build.failure_category for a failed build.
+func (m *BuildMetrics) FailureCategory(project, category string) {
+	tags := []string{"project:" + project, "category:" + category}
+	_ = m.client.Incr("build.failure_category", tags, 1)
+}
+
+// BuildWarning increments build.warning for a warning of a project build.
+func (m *BuildMetrics) BuildWarning(project, code, severity string) {
+	tags := []string{"project:" + project, "code:" + code, "severity:" + severity}
+	_ = m.client.Incr("build.warning", tags, 1)
+}
+
 // QueueWaitTime emits build.queue_wait_time histogram using the published_at timestamp.
 func (m *BuildMetrics) QueueWaitTime(publishedAt time.Time) {
 	wait := time.Since(publishedAt)
@@ -52,3 +86,101 @@ func (m *BuildMetrics) RetryCount(project string, attempt int) {
 	}
 	_ = m.client.Incr("build.retry_count", tags, 1)
 }
+
+// Flaky increments build.flaky for builds that passed only after a retry.
+func (m *BuildMetrics) Flaky(project string) {
+	_ = m.client.Incr("build.flaky", []string{"project:" + project}, 1)
+}
+
+// FlakinessScore emits build.flakiness_score gauge (0..1) for a repository's
+// branch.
+func (m *BuildMetrics) FlakinessScore(repo, branch string, score float64) {
+	_ = m.client.Gauge("build.flakiness_score", score, []string{"repo:" + repo, "branch:" + branch}, 1)
+}
+
+// DurationAnomaly increments build.duration_anomaly and posts a warning event
+// to the Datadog event stream for a build that exceeded its p95 baseline.
+func (m *BuildMetrics) DurationAnomaly(project string, d, baseline time.Duration) {
+	tags := []string{"project:" + project}
+	_ = m.client.Incr("build.duration_anomaly", tags, 1)
+	_ = m.client.Event(&statsd.Event{
+		Title:          "Build duration anomaly: " + project,
+		Text:           fmt.Sprintf("Build of %s took %s, exceeding its p95 baseline of %s.", project, d.Round(time.Second), baseline.Round(time.Second)),
+		AggregationKey: "build-duration-anomaly-" + project,
+		AlertType:      statsd.Warning,
+		Tags:           tags,
+	})
+}
+
+// WorkerLoad emits the autoscaling gauges for this worker: running builds,
+// build capacity, consumer queue depth, and average queue wait.
+func (m *BuildMetrics) WorkerLoad(running, capacity int, queueDepth uint64, avgWait time.Duration) {
+	_ = m.client.Gauge("worker.running_builds", float64(running), nil, 1)
+	_ = m.client.Gauge("worker.capacity", float64(capacity), nil, 1)
+	_ = m.client.Gauge("queue.depth", float64(queueDepth), nil, 1)
+	_ = m.client.Gauge("queue.avg_wait_time", avgWait.Seconds(), nil, 1)
+}
+
+// HostPressure emits the worker.disk_free_percent,
+// worker.memory_available_percent and worker.backpressure gauges; unknown
+// percentages are skipped.
+func (m *BuildMetrics) HostPressure(diskFree, memAvailable float64, backpressure bool) {
+	if diskFree >= 0 {
+		_ = m.client.Gauge("worker.disk_free_percent", diskFree, nil, 1)
+	}
+	if memAvailable >= 0 {
+		_ = m.client.Gauge("worker.memory_available_percent", memAvailable, nil, 1)
+	}
+	held := 0.0
+	if backpressure {
+		held = 1
+	}
+	_ = m.client.Gauge("worker.backpressure", held, nil, 1)
+}
+
+// ConsumerLag emits the JetStream consumer's queue.ack_pending,
+// queue.redelivered and queue.waiting gauges; queue.depth comes with
+// WorkerLoad.
+func (m *BuildMetrics) ConsumerLag(ackPending, redelivered, waiting int) {
+	_ = m.client.Gauge("queue.ack_pending", float64(ackPending), nil, 1)
+	_ = m.client.Gauge("queue.redelivered", float64(redelivered), nil, 1)
+	_ = m.client.Gauge("queue.waiting", float64(waiting), nil, 1)
+}
+
+// UntrustedCommit increments build.untrusted_commit for jobs rejected by the
+// commit signature policy.
+func (m *BuildMetrics) UntrustedCommit(repo string) {
+	_ = m.client.Incr("build.untrusted_commit", []string{"repo:" + repo}, 1)
+}
+
+// JobExpired increments build.job_expired and posts a warning event to the
+// Datadog event stream for a job that waited in the queue past its TTL.
+func (m *BuildMetrics) JobExpired(repo string, age time.Duration) {
+	tags := []string{"repo:" + repo}
+	_ = m.client.Incr("build.job_expired", tags, 1)
+	_ = m.client.Event(&statsd.Event{
+		Title:          "Build job expired: " + repo,
+		Text:           fmt.Sprintf("A job of %s waited %s in the queue, past worker.job_ttl_hours, and was not built.", repo, age.Round(time.Minute)),
+		AggregationKey: "build-job-expired-" + repo,
+		AlertType:      statsd.Warning,
+		Tags:           tags,
+	})
+}
+
+// PendingExpired increments build.pending_expired by the build records
+// retention marked expired.
+func (m *BuildMetrics) PendingExpired(n int64) {
+	_ = m.client.Count("build.pending_expired", n, nil, 1)
+}
+
+// StatusConflict increments build.status_conflict for build status updates
+// the store rejected; reason is "illegal_transition" or "superseded".
+func (m *BuildMetrics) StatusConflict(project, reason string) {
+	_ = m.client.Incr("build.status_conflict", []string{"project:" + project, "reason:" + reason}, 1)
+}
+
+// RepoUnreachable increments build.repo_unreachable for jobs failed because
+// their repository did not answer the reachability probe.
+func (m *BuildMetrics) RepoUnreachable(repo string) {
+	_ = m.client.Incr("build.repo_unreachable", []string{"repo:" + repo}, 1)
+}
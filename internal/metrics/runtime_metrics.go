@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// RuntimeMetrics emits DogStatsD gauges for process resources, tagged with
+// the service binary name.
+type RuntimeMetrics struct {
+	client statsd.ClientInterface
+	tags   []string
+}
+
+// NewRuntimeMetrics creates a RuntimeMetrics.
+func NewRuntimeMetrics(client statsd.ClientInterface) *RuntimeMetrics {
+	return &RuntimeMetrics{client: client, tags: []string{"service:" + filepath.Base(os.Args[0])}}
+}
+
+// Resources emits runtime.goroutines, runtime.open_fds and
+// nats.subscriptions. Negative values are unknown and not emitted.
+func (m *RuntimeMetrics) Resources(goroutines, openFDs, subscriptions int) {
+	_ = m.client.Gauge("runtime.goroutines", float64(goroutines), m.tags, 1)
+	if openFDs >= 0 {
+		_ = m.client.Gauge("runtime.open_fds", float64(openFDs), m.tags, 1)
+	}
+	if subscriptions >= 0 {
+		_ = m.client.Gauge("nats.subscriptions", float64(subscriptions), m.tags, 1)
+	}
+}
+
+// ResourceWarning increments runtime.resource_warning when a self-check
+// threshold is crossed.
+func (m *RuntimeMetrics) ResourceWarning(resource, reason string) {
+	tags := append([]string{"resource:" + resource, "reason:" + reason}, m.tags...)
+	_ = m.client.Incr("runtime.resource_warning", tags, 1)
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// WebhookMetrics emits DogStatsD metrics for webhook intake.
+type WebhookMetrics struct {
+	client statsd.ClientInterface
+}
+
+// NewWebhookMetrics creates a WebhookMetrics.
+func NewWebhookMetrics(client statsd.ClientInterface) *WebhookMetrics {
+	return &WebhookMetrics{client: client}
+}
+
+// PushSkipped increments webhook.push_skipped for a push that published no
+// build job, tagged with why.
+func (m *WebhookMetrics) PushSkipped(reason string) {
+	_ = m.client.Incr("webhook.push_skipped", []string{"reason:" + reason}, 1)
+}
+
+// Shed increments webhook.shed for a webhook rejected with 503 under load,
+// tagged with why: "queue_full" or "queue_timeout".
+func (m *WebhookMetrics) Shed(reason string) {
+	_ = m.client.Incr("webhook.shed", []string{"reason:" + reason}, 1)
+}
+
+// Backlog emits the webhooks being handled and those waiting for a slot.
+func (m *WebhookMetrics) Backlog(inflight, queued int) {
+	_ = m.client.Gauge("webhook.inflight", float64(inflight), nil, 1)
+	_ = m.client.Gauge("webhook.queued", float64(queued), nil, 1)
+}
+
+// EstimateChanged increments queue.estimate_changed and sends an event
+// when a queued job's estimated start time moved significantly.
+func (m *WebhookMetrics) EstimateChanged(repo, jobID string, from, to time.Time) {
+	tags := []string{"repo:" + repo}
+	direction := "later"
+	if to.Before(from) {
+		direction = "earlier"
+	}
+	_ = m.client.Incr("queue.estimate_changed", append(tags, "direction:"+direction), 1)
+	_ = m.client.Event(&statsd.Event{
+		Title: "Queued build estimate changed: " + repo,
+		Text: fmt.Sprintf("Job %s of %s is now expected to start at %s, %s %s than estimated.",
+			jobID, repo, to.UTC().Format(time.RFC3339), to.Sub(from).Abs().Round(time.Minute), direction),
+		AggregationKey: "queue-estimate-changed-" + repo,
+		AlertType:      statsd.Info,
+		Tags:           tags,
+	})
+}
@@ -0,0 +1,40 @@
+package nats
+
+import (
+	"slices"
+	"strings"
+)
+
+// Affinity hints which workers should build a job, by the labels workers
+// advertise in worker.labels, such as "large-memory". Hints are soft: a
+// job no worker satisfies is built anyway once it has waited
+// worker.affinity_wait_seconds.
+type Affinity struct {
+	// Requires lists labels the worker should have.
+	Requires []string `json:"requires,omitempty"`
+	// Avoids lists labels the worker should not have.
+	Avoids []string `json:"avoids,omitempty"`
+}
+
+// Unmet returns the hints a worker with labels does not satisfy, such as
+// "requires large-memory". Labels compare case-insensitively.
+func (a *Affinity) Unmet(labels []string) []string {
+	if a == nil {
+		return nil
+	}
+	has := func(label string) bool {
+		return slices.ContainsFunc(labels, func(l string) bool { return strings.EqualFold(l, label) })
+	}
+	var unmet []string
+	for _, l := range a.Requires {
+		if !has(l) {
+			unmet = append(unmet, "requires "+l)
+		}
+	}
+	for _, l := range a.Avoids {
+		if has(l) {
+			unmet = append(unmet, "avoids "+l)
+		}
+	}
+	return unmet
+}
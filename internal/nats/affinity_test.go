@@ -0,0 +1,26 @@
+package nats
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAffinityUnmet(t *testing.T) {
+	a := &Affinity{Requires: []string{"large-memory", "arm64"}, Avoids: []string{"spot"}}
+	tests := []struct {
+		labels []string
+		want   []string
+	}{
+		{[]string{"Large-Memory", "arm64"}, nil},
+		{[]string{"large-memory", "spot"}, []string{"requires arm64", "avoids spot"}},
+		{nil, []string{"requires large-memory", "requires arm64"}},
+	}
+	for _, tc := range tests {
+		if got := a.Unmet(tc.labels); !slices.Equal(got, tc.want) {
+			t.Errorf("Unmet(%v) = %v, want %v", tc.labels, got, tc.want)
+		}
+	}
+	if got := (*Affinity)(nil).Unmet(nil); got != nil {
+		t.Errorf("nil affinity unmet: %v", got)
+	}
+}
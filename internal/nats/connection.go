@@ -25,6 +25,8 @@ type Result struct {
 	Conn      *nats.Conn
 	JetStream jetstream.JetStream
 	Consumer  jetstream.Consumer
+	Payloads  *PayloadStore
+	Control   *Control
 }
 
 // New establishes the NATS connection, creates/updates the stream and
@@ -41,32 +43,10 @@ func New(p Params, lc fx.Lifecycle) (Result, error) {
 		return Result{}, fmt.Errorf("jetstream init: %w", err)
 	}
 
-	ctx := context.Background()
-	ackWait := time.Duration(p.Config.NATS.AckWaitSeconds) * time.Second
-
-	// Create or update the stream.
-	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
-		Name:     p.Config.NATS.StreamName,
-		Subjects: []string{p.Config.NATS.Subject},
-	})
+	res, err := setup(context.Background(), js, p.Config.NATS)
 	if err != nil {
 		nc.Close()
-		return Result{}, fmt.Errorf("stream create/update: %w", err)
-	}
-
-	// Create or update the durable consumer.
-	//  - AckWait: 5 min (workers send heartbeats every 2 min to prevent false redelivery)
-	//  - MaxDelivers: 3  (crash-recovery only; build retries are application-level)
-	consumer, err := js.CreateOrUpdateConsumer(ctx, p.Config.NATS.StreamName, jetstream.ConsumerConfig{
-		Durable:       p.Config.NATS.ConsumerName,
-		AckPolicy:     jetstream.AckExplicitPolicy,
-		AckWait:       ackWait,
-		MaxDeliver:    p.Config.NATS.MaxDelivers,
-		FilterSubject: p.Config.NATS.Subject,
-	})
-	if err != nil {
-		nc.Close()
-		return Result{}, fmt.Errorf("consumer create/update: %w", err)
+		return Result{}, err
 	}
 
 	lc.Append(fx.Hook{
@@ -85,11 +65,73 @@ func New(p Params, lc fx.Lifecycle) (Result, error) {
 	return Result{
 		Conn:      nc,
 		JetStream: js,
-		Consumer:  consumer,
+		Consumer:  res.consumer,
+		Payloads:  NewPayloadStore(res.payloads, nc.MaxPayload()),
+		Control:   NewControl(res.control),
 	}, nil
 }
 
+// resources are the JetStream objects both services work with.
+type resources struct {
+	consumer jetstream.Consumer
+	payloads jetstream.ObjectStore
+	control  jetstream.KeyValue
+}
+
+// setup creates or updates the stream, durable consumer, payload object
+// store and control bucket.
+func setup(ctx context.Context, js jetstream.JetStream, cfg config.NATSConfig) (resources, error) {
+	ackWait := time.Duration(cfg.AckWaitSeconds) * time.Second
+
+	// Create or update the stream.
+	_, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     cfg.StreamName,
+		Subjects: []string{cfg.Subject},
+	})
+	if err != nil {
+		return resources{}, fmt.Errorf("stream create/update: %w", err)
+	}
+
+	// Create or update the durable consumer.
+	//  - AckWait: 5 min (workers send heartbeats every 2 min to prevent false redelivery)
+	//  - MaxDelivers: 3  (crash-recovery only; build retries are application-level)
+	consumer, err := js.CreateOrUpdateConsumer(ctx, cfg.StreamName, jetstream.ConsumerConfig{
+		Durable:       cfg.ConsumerName,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       ackWait,
+		MaxDeliver:    cfg.MaxDelivers,
+		FilterSubject: cfg.Subject,
+	})
+	if err != nil {
+		return resources{}, fmt.Errorf("consumer create/update: %w", err)
+	}
+
+	// Oversized job fields are offloaded here; objects expire on their own
+	// once every delivery attempt is long over.
+	payloadBucket, err := js.CreateOrUpdateObjectStore(ctx, jetstream.ObjectStoreConfig{
+		Bucket: cfg.PayloadBucket,
+		TTL:    time.Duration(cfg.PayloadTTLHours) * time.Hour,
+	})
+	if err != nil {
+		return resources{}, fmt.Errorf("payload object store create/update: %w", err)
+	}
+
+	controlKV, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket: cfg.ControlBucket,
+	})
+	if err != nil {
+		return resources{}, fmt.Errorf("control bucket create/update: %w", err)
+	}
+	return resources{consumer: consumer, payloads: payloadBucket, control: controlKV}, nil
+}
+
 // Module provides NATS connection, JetStream, and Consumer via fx.
 var Module = fx.Module("nats",
 	fx.Provide(New),
 )
+
+// LazyModule provides the NATS connection without waiting for it; see
+// NewLazy. Services that can do useful work while NATS is down use it.
+var LazyModule = fx.Module("nats",
+	fx.Provide(NewLazy),
+)
@@ -0,0 +1,115 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// pauseKey is the control bucket key holding the queue PauseState.
+const pauseKey = "queue.paused"
+
+// PauseState is the cluster-wide queue switch. While paused, workers stop
+// taking new jobs; webhooks are still accepted into the stream.
+type PauseState struct {
+	Paused bool      `json:"paused"`
+	By     string    `json:"by,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since,omitzero"`
+}
+
+// Control holds operator switches shared by every service in a JetStream
+// key-value bucket.
+type Control struct {
+	kv controlKV
+}
+
+// controlKV is the subset of jetstream.KeyValue used by Control.
+type controlKV interface {
+	Get(ctx context.Context, key string) (jetstream.KeyValueEntry, error)
+	Put(ctx context.Context, key string, value []byte) (uint64, error)
+	Watch(ctx context.Context, keys string, opts ...jetstream.WatchOpt) (jetstream.KeyWatcher, error)
+}
+
+// NewControl creates a Control on a key-value bucket.
+func NewControl(kv jetstream.KeyValue) *Control {
+	return &Control{kv: kv}
+}
+
+// Pause returns the current queue switch. It is unpaused until first set.
+func (c *Control) Pause(ctx context.Context) (PauseState, error) {
+	entry, err := c.kv.Get(ctx, pauseKey)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return PauseState{}, nil
+	}
+	if err != nil {
+		return PauseState{}, fmt.Errorf("get pause state: %w", err)
+	}
+	return decodePause(entry.Value())
+}
+
+// SetPause stores the queue switch.
+func (c *Control) SetPause(ctx context.Context, state PauseState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshal pause state: %w", err)
+	}
+	if _, err := c.kv.Put(ctx, pauseKey, data); err != nil {
+		return fmt.Errorf("put pause state: %w", err)
+	}
+	return nil
+}
+
+// WatchPause sends the current queue switch, then every change, until ctx
+// is done.
+func (c *Control) WatchPause(ctx context.Context) (<-chan PauseState, error) {
+	watcher, err := c.kv.Watch(ctx, pauseKey)
+	if err != nil {
+		return nil, fmt.Errorf("watch pause state: %w", err)
+	}
+	states := make(chan PauseState, 1)
+	go func() {
+		defer close(states)
+		defer watcher.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry, ok := <-watcher.Updates():
+				if !ok {
+					return
+				}
+				if entry == nil {
+					continue // end of the initial values
+				}
+				// A deleted key unpauses, like one never set.
+				var state PauseState
+				if entry.Operation() == jetstream.KeyValuePut {
+					decoded, err := decodePause(entry.Value())
+					if err != nil {
+						continue
+					}
+					state = decoded
+				}
+				select {
+				case states <- state:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return states, nil
+}
+
+func decodePause(data []byte) (PauseState, error) {
+	var state PauseState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return PauseState{}, fmt.Errorf("decode pause state: %w", err)
+	}
+	return state, nil
+}
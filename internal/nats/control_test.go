@@ -0,0 +1,52 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type memEntry struct {
+	jetstream.KeyValueEntry
+	value []byte
+}
+
+func (e memEntry) Value() []byte { return e.value }
+
+type memKV struct {
+	controlKV
+	data map[string][]byte
+}
+
+func (kv *memKV) Get(_ context.Context, key string) (jetstream.KeyValueEntry, error) {
+	v, ok := kv.data[key]
+	if !ok {
+		return nil, jetstream.ErrKeyNotFound
+	}
+	return memEntry{value: v}, nil
+}
+
+func (kv *memKV) Put(_ context.Context, key string, value []byte) (uint64, error) {
+	kv.data[key] = value
+	return uint64(len(kv.data)), nil
+}
+
+func TestControlPause(t *testing.T) {
+	ctx := context.Background()
+	c := &Control{kv: &memKV{data: map[string][]byte{}}}
+
+	state, err := c.Pause(ctx)
+	if err != nil || state.Paused {
+		t.Fatalf("Pause before any switch = %+v, %v; want unpaused", state, err)
+	}
+
+	want := PauseState{Paused: true, By: "ops", Reason: "TiDB upgrade", Since: time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)}
+	if err := c.SetPause(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Pause(ctx); err != nil || got != want {
+		t.Errorf("Pause = %+v, %v; want %+v", got, err, want)
+	}
+}
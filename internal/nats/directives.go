@@ -0,0 +1,89 @@
+package nats
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Directives override nx affected detection for one job. They are parsed
+// from commit messages: "[build: app-a,app-b]" builds exactly the named
+// projects and "[skip: app-c]" drops projects from the affected set.
+type Directives struct {
+	// Build, when non-empty, replaces the affected projects.
+	Build []string `json:"build,omitempty"`
+	// Skip is removed from the projects to build, including Build.
+	Skip []string `json:"skip,omitempty"`
+}
+
+var directive = regexp.MustCompile(`(?i)\[(build|skip):([^\]]*)\]`)
+
+var compileOnly = regexp.MustCompile(`(?i)\[compile[- ]only\]`)
+
+// RequestsCompileOnly reports whether a commit message of the push carries
+// the "[compile-only]" directive.
+func RequestsCompileOnly(messages []string) bool {
+	return slices.ContainsFunc(messages, compileOnly.MatchString)
+}
+
+// ParseDirectives returns the directives in a push's commit messages, or
+// nil when there are none. Directives from every commit are combined.
+func ParseDirectives(messages []string) *Directives {
+	var d Directives
+	for _, msg := range messages {
+		for _, m := range directive.FindAllStringSubmatch(msg, -1) {
+			names := splitProjects(m[2])
+			if strings.EqualFold(m[1], "build") {
+				d.Build = appendNew(d.Build, names)
+			} else {
+				d.Skip = appendNew(d.Skip, names)
+			}
+		}
+	}
+	if len(d.Build) == 0 && len(d.Skip) == 0 {
+		return nil
+	}
+	return &d
+}
+
+// Apply returns the projects a job builds: Build if set, otherwise
+// affected, without Skip. known reports whether a Build project exists;
+// unknown names are returned separately so the caller can report them.
+func (d *Directives) Apply(affected []string, known func(string) bool) (projects, unknown []string) {
+	if d == nil {
+		return affected, nil
+	}
+	projects = affected
+	if len(d.Build) > 0 {
+		projects = nil
+		for _, name := range d.Build {
+			if known(name) {
+				projects = append(projects, name)
+			} else {
+				unknown = append(unknown, name)
+			}
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(projects), func(p string) bool {
+		return slices.Contains(d.Skip, p)
+	}), unknown
+}
+
+func splitProjects(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func appendNew(list, names []string) []string {
+	for _, name := range names {
+		if !slices.Contains(list, name) {
+			list = append(list, name)
+		}
+	}
+	return list
+}
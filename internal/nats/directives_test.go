@@ -0,0 +1,68 @@
+package nats
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDirectives(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		want     *Directives
+	}{
+		{"none", []string{"feat: add cart", "fix: [wip] typo"}, nil},
+		{"build", []string{"feat: x [build: app-a, app-b]"}, &Directives{Build: []string{"app-a", "app-b"}}},
+		{"skip", []string{"chore: bump [Skip: app-c]"}, &Directives{Skip: []string{"app-c"}}},
+		{"combined across commits", []string{"[build: app-a]", "[build: app-a,app-b] [skip: app-c]"},
+			&Directives{Build: []string{"app-a", "app-b"}, Skip: []string{"app-c"}}},
+		{"empty list", []string{"[build: ]"}, nil},
+	}
+	for _, tc := range tests {
+		if got := ParseDirectives(tc.messages); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: ParseDirectives = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDirectivesApply(t *testing.T) {
+	known := func(name string) bool { return name != "ghost" }
+	affected := []string{"app-a", "app-b"}
+
+	var none *Directives
+	if got, _ := none.Apply(affected, known); !reflect.DeepEqual(got, affected) {
+		t.Errorf("nil directives: projects = %v", got)
+	}
+
+	skip := &Directives{Skip: []string{"app-b"}}
+	if got, _ := skip.Apply(affected, known); !reflect.DeepEqual(got, []string{"app-a"}) {
+		t.Errorf("skip: projects = %v", got)
+	}
+	if !reflect.DeepEqual(affected, []string{"app-a", "app-b"}) {
+		t.Errorf("Apply modified affected: %v", affected)
+	}
+
+	build := &Directives{Build: []string{"app-c", "ghost", "app-d"}, Skip: []string{"app-d"}}
+	got, unknown := build.Apply(affected, known)
+	if !reflect.DeepEqual(got, []string{"app-c"}) || !reflect.DeepEqual(unknown, []string{"ghost"}) {
+		t.Errorf("build: projects = %v, unknown = %v", got, unknown)
+	}
+}
+
+func TestRequestsCompileOnly(t *testing.T) {
+	tests := []struct {
+		messages []string
+		want     bool
+	}{
+		{nil, false},
+		{[]string{"feat: cart"}, false},
+		{[]string{"feat: cart", "wip [compile-only]"}, true},
+		{[]string{"wip [Compile Only]"}, true},
+		{[]string{"compile-only"}, false},
+	}
+	for _, tc := range tests {
+		if got := RequestsCompileOnly(tc.messages); got != tc.want {
+			t.Errorf("RequestsCompileOnly(%q) = %v, want %v", tc.messages, got, tc.want)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
 )
 
 // TestNATSPublishSubscribe tests the full publish/subscribe round trip.
@@ -58,15 +59,21 @@ func TestNATSPublishSubscribe(t *testing.T) {
 	}
 	defer js.DeleteStream(ctx, cfg.NATS.StreamName) //nolint:errcheck
 
+	bucket, err := js.CreateOrUpdateObjectStore(ctx, jetstream.ObjectStoreConfig{Bucket: "test-build-job-payloads"})
+	if err != nil {
+		t.Fatalf("object store: %v", err)
+	}
+	defer js.DeleteObjectStore(ctx, "test-build-job-payloads") //nolint:errcheck
+
 	// Publish a job.
-	pub := natspkg.NewPublisher(js, cfg)
+	pub := natspkg.NewPublisher(js, natspkg.NewPayloadStore(bucket, nc.MaxPayload()), cfg)
 	job := natspkg.BuildJob{
 		RepoURL:        "https://github.com/test/repo",
 		SHA:            "abc123def456abc123def456abc123def456abc1",
 		CommitMessages: []string{"feat: test feature"},
 		InstallationID: 12345,
 	}
-	if err := pub.Publish(ctx, job); err != nil {
+	if _, err := pub.Publish(ctx, job); err != nil {
 		t.Fatalf("publish: %v", err)
 	}
 
@@ -99,3 +106,94 @@ func TestNATSPublishSubscribe(t *testing.T) {
 		t.Error("timed out waiting for message")
 	}
 }
+
+// TestSubscriberPause checks that a paused queue holds jobs until resumed.
+// Requires NATS_URL (see TestNATSPublishSubscribe).
+func TestSubscriberPause(t *testing.T) {
+	natsURL := os.Getenv("NATS_URL")
+	if natsURL == "" {
+		t.Skip("NATS_URL not set — skipping integration test")
+	}
+	cfg := &config.Config{
+		NATS: config.NATSConfig{
+			URL:            natsURL,
+			StreamName:     "TEST_PAUSE",
+			Subject:        "test.pause.jobs",
+			AckWaitSeconds: 30,
+			MaxDelivers:    3,
+		},
+		Worker: config.WorkerConfig{HeartbeatSeconds: 5},
+	}
+	nc, err := nats.Connect(natsURL)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer nc.Close()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("jetstream: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{Name: "TEST_PAUSE", Subjects: []string{cfg.NATS.Subject}}); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer js.DeleteStream(context.Background(), "TEST_PAUSE") //nolint:errcheck
+	consumer, err := js.CreateOrUpdateConsumer(ctx, "TEST_PAUSE", jetstream.ConsumerConfig{
+		Durable: "test-pause", AckPolicy: jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		t.Fatalf("consumer: %v", err)
+	}
+	bucket, err := js.CreateOrUpdateObjectStore(ctx, jetstream.ObjectStoreConfig{Bucket: "test-pause-payloads"})
+	if err != nil {
+		t.Fatalf("object store: %v", err)
+	}
+	defer js.DeleteObjectStore(context.Background(), "test-pause-payloads") //nolint:errcheck
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "test-pause-control"})
+	if err != nil {
+		t.Fatalf("kv: %v", err)
+	}
+	defer js.DeleteKeyValue(context.Background(), "test-pause-control") //nolint:errcheck
+
+	control := natspkg.NewControl(kv)
+	if err := control.SetPause(ctx, natspkg.PauseState{Paused: true, By: "test"}); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	payloads := natspkg.NewPayloadStore(bucket, nc.MaxPayload())
+	received := make(chan natspkg.BuildJob, 1)
+	sub := natspkg.NewSubscriber(consumer, payloads, control, cfg, zap.NewNop())
+	go func() {
+		_ = sub.Subscribe(ctx, func(_ context.Context, _ jetstream.Msg, job natspkg.BuildJob) error {
+			received <- job
+			return nil
+		})
+	}()
+
+	job := natspkg.BuildJob{
+		RepoURL:        "https://github.com/test/repo",
+		SHA:            "abc123def456abc123def456abc123def456abc1",
+		InstallationID: 12345,
+	}
+	if _, err := natspkg.NewPublisher(js, payloads, cfg).Publish(ctx, job); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	select {
+	case <-received:
+		t.Fatal("job consumed while the queue was paused")
+	case <-time.After(time.Second):
+	}
+
+	if err := control.SetPause(ctx, natspkg.PauseState{By: "test"}); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	select {
+	case got := <-received:
+		if got.SHA != job.SHA {
+			t.Errorf("sha: got %q, want %q", got.SHA, job.SHA)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("job not consumed after resume")
+	}
+}
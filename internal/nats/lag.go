@@ -0,0 +1,34 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ConsumerLag is how far the build consumer is behind the stream.
+type ConsumerLag struct {
+	Pending     uint64 `json:"pending"`     // stored, not yet delivered
+	AckPending  int    `json:"ack_pending"` // delivered, not yet acked
+	Redelivered int    `json:"redelivered"` // delivered more than once, not yet acked
+	Waiting     int    `json:"waiting"`     // pull requests waiting for messages
+}
+
+// Lag returns the consumer's current lag.
+func Lag(ctx context.Context, consumer jetstream.Consumer) (ConsumerLag, error) {
+	info, err := consumer.Info(ctx)
+	if err != nil {
+		return ConsumerLag{}, fmt.Errorf("consumer info: %w", err)
+	}
+	return lagFromInfo(info), nil
+}
+
+func lagFromInfo(info *jetstream.ConsumerInfo) ConsumerLag {
+	return ConsumerLag{
+		Pending:     info.NumPending,
+		AckPending:  info.NumAckPending,
+		Redelivered: info.NumRedelivered,
+		Waiting:     info.NumWaiting,
+	}
+}
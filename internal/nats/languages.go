@@ -0,0 +1,11 @@
+package nats
+
+// Languages pins the language of a repository's projects, from its
+// settings in the repository registry, bypassing detection. Names are
+// those of detection.PinNames.
+type Languages struct {
+	// Default applies to every project without an entry in Projects.
+	Default string `json:"default,omitempty"`
+	// Projects pins the language of single projects.
+	Projects map[string]string `json:"projects,omitempty"`
+}
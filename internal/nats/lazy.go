@@ -0,0 +1,204 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// ErrNotReady is returned by lazily connected JetStream resources until
+// the connection and setup have succeeded.
+var ErrNotReady = errors.New("nats: not connected yet")
+
+// defaultMaxPayload is the NATS server's default max_payload. A lazily
+// connected PayloadStore assumes it, as the server's limit is not known
+// until the first connect.
+const defaultMaxPayload = 1 << 20
+
+// Link setup retry backoff.
+const (
+	linkRetryMin = time.Second
+	linkRetryMax = 30 * time.Second
+)
+
+// Link tracks the background connection and JetStream setup of a lazily
+// connected service.
+type Link struct {
+	res     atomic.Pointer[resources]
+	ready   chan struct{}
+	mu      sync.Mutex
+	lastErr error
+}
+
+func newLink() *Link {
+	return &Link{ready: make(chan struct{})}
+}
+
+// Ready reports whether JetStream is set up.
+func (l *Link) Ready() bool {
+	return l.res.Load() != nil
+}
+
+// Done is closed once JetStream is set up.
+func (l *Link) Done() <-chan struct{} {
+	return l.ready
+}
+
+// Err returns why the link is not ready: the last setup error, or
+// ErrNotReady before the first attempt finished. It is nil once ready.
+func (l *Link) Err() error {
+	if l.Ready() {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lastErr == nil {
+		return ErrNotReady
+	}
+	return l.lastErr
+}
+
+// Consumer returns the build consumer, or nil until ready.
+func (l *Link) Consumer() jetstream.Consumer {
+	if r := l.res.Load(); r != nil {
+		return r.consumer
+	}
+	return nil
+}
+
+// run sets up JetStream, retrying with backoff until it succeeds or ctx
+// is cancelled.
+func (l *Link) run(ctx context.Context, js jetstream.JetStream, p Params) {
+	backoff := linkRetryMin
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		res, err := setup(attemptCtx, js, p.Config.NATS)
+		cancel()
+		if err == nil {
+			l.res.Store(&res)
+			close(l.ready)
+			p.Logger.Info("nats connected",
+				zap.String("url", p.Config.NATS.URL),
+				zap.String("stream", p.Config.NATS.StreamName),
+			)
+			return
+		}
+		l.mu.Lock()
+		l.lastErr = err
+		l.mu.Unlock()
+		p.Logger.Warn("nats not ready, retrying", zap.Error(err), zap.Duration("backoff", backoff))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, linkRetryMax)
+	}
+}
+
+// LazyResult groups fx outputs of NewLazy. It has no Consumer: Link
+// provides it once ready.
+type LazyResult struct {
+	fx.Out
+	Conn      *nats.Conn
+	JetStream jetstream.JetStream
+	Payloads  *PayloadStore
+	Control   *Control
+	Link      *Link
+}
+
+// NewLazy connects to NATS in the background, so the service starts while
+// NATS is down. Until Link is ready, publishing fails, the payload store
+// and control bucket return ErrNotReady, and the connection keeps
+// retrying.
+func NewLazy(p Params, lc fx.Lifecycle) (LazyResult, error) {
+	nc, err := nats.Connect(p.Config.NATS.URL,
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return LazyResult{}, fmt.Errorf("nats connect: %w", err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return LazyResult{}, fmt.Errorf("jetstream init: %w", err)
+	}
+
+	link := newLink()
+	ctx, cancel := context.WithCancel(context.Background())
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go link.run(ctx, js, p)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			nc.Close()
+			return nil
+		},
+	})
+
+	return LazyResult{
+		Conn:      nc,
+		JetStream: js,
+		Payloads:  &PayloadStore{bucket: lazyBucket{link}, limit: defaultMaxPayload - payloadHeadroom},
+		Control:   &Control{kv: lazyKV{link}},
+		Link:      link,
+	}, nil
+}
+
+// lazyBucket is the payload object store of a Link.
+type lazyBucket struct{ link *Link }
+
+func (b lazyBucket) PutBytes(ctx context.Context, name string, data []byte) (*jetstream.ObjectInfo, error) {
+	r := b.link.res.Load()
+	if r == nil {
+		return nil, ErrNotReady
+	}
+	return r.payloads.PutBytes(ctx, name, data)
+}
+
+func (b lazyBucket) GetBytes(ctx context.Context, name string, opts ...jetstream.GetObjectOpt) ([]byte, error) {
+	r := b.link.res.Load()
+	if r == nil {
+		return nil, ErrNotReady
+	}
+	return r.payloads.GetBytes(ctx, name, opts...)
+}
+
+// lazyKV is the control bucket of a Link.
+type lazyKV struct{ link *Link }
+
+func (k lazyKV) Get(ctx context.Context, key string) (jetstream.KeyValueEntry, error) {
+	r := k.link.res.Load()
+	if r == nil {
+		return nil, ErrNotReady
+	}
+	return r.control.Get(ctx, key)
+}
+
+func (k lazyKV) Put(ctx context.Context, key string, value []byte) (uint64, error) {
+	r := k.link.res.Load()
+	if r == nil {
+		return 0, ErrNotReady
+	}
+	return r.control.Put(ctx, key, value)
+}
+
+func (k lazyKV) Watch(ctx context.Context, keys string, opts ...jetstream.WatchOpt) (jetstream.KeyWatcher, error) {
+	r := k.link.res.Load()
+	if r == nil {
+		return nil, ErrNotReady
+	}
+	return r.control.Watch(ctx, keys, opts...)
+}
@@ -0,0 +1,107 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// payloadHeadroom is reserved below the server's max payload for the
+// JetStream publish overhead.
+const payloadHeadroom = 1024
+
+// ErrPayloadTooLarge is returned when a build job does not fit in a NATS
+// message even after its large fields are offloaded.
+type ErrPayloadTooLarge struct {
+	Size, Limit int
+}
+
+func (e *ErrPayloadTooLarge) Error() string {
+	return fmt.Sprintf("build job payload is %d bytes, limit is %d", e.Size, e.Limit)
+}
+
+// payloadBucket is the subset of jetstream.ObjectStore used for offloading.
+type payloadBucket interface {
+	PutBytes(ctx context.Context, name string, data []byte) (*jetstream.ObjectInfo, error)
+	GetBytes(ctx context.Context, name string, opts ...jetstream.GetObjectOpt) ([]byte, error)
+}
+
+// PayloadStore keeps build job messages under the NATS max payload by
+// moving commit messages — the only unbounded part of a job — into a
+// JetStream object store and referencing them from the message.
+type PayloadStore struct {
+	bucket payloadBucket
+	limit  int
+}
+
+// NewPayloadStore creates a PayloadStore for messages of at most maxPayload
+// bytes (the server's advertised limit).
+func NewPayloadStore(bucket jetstream.ObjectStore, maxPayload int64) *PayloadStore {
+	return &PayloadStore{bucket: bucket, limit: int(maxPayload) - payloadHeadroom}
+}
+
+// offloaded is the object stored for a job's PayloadRef.
+type offloaded struct {
+	CommitMessages    []string `json:"commit_messages"`
+	HeadCommitMessage string   `json:"head_commit_message,omitempty"`
+}
+
+// Marshal encodes a job for publishing, offloading its commit messages when
+// the encoded job exceeds the limit.
+func (p *PayloadStore) Marshal(ctx context.Context, job BuildJob) ([]byte, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("marshal build job: %w", err)
+	}
+	if len(data) <= p.limit {
+		return data, nil
+	}
+
+	var off offloaded
+	off.CommitMessages, job.CommitMessages = job.CommitMessages, nil
+	if hc := job.HeadCommit; hc != nil {
+		c := *hc
+		off.HeadCommitMessage, c.Message = c.Message, ""
+		job.HeadCommit = &c
+	}
+	blob, err := json.Marshal(off)
+	if err != nil {
+		return nil, fmt.Errorf("marshal offloaded payload: %w", err)
+	}
+	job.PayloadRef = "jobs/" + job.ID
+	if _, err := p.bucket.PutBytes(ctx, job.PayloadRef, blob); err != nil {
+		return nil, fmt.Errorf("offload build job payload: %w", err)
+	}
+
+	data, err = json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("marshal build job: %w", err)
+	}
+	if len(data) > p.limit {
+		return nil, &ErrPayloadTooLarge{Size: len(data), Limit: p.limit}
+	}
+	return data, nil
+}
+
+// Resolve restores the fields of a job that were offloaded by Marshal.
+func (p *PayloadStore) Resolve(ctx context.Context, job *BuildJob) error {
+	if job.PayloadRef == "" {
+		return nil
+	}
+	blob, err := p.bucket.GetBytes(ctx, job.PayloadRef)
+	if err != nil {
+		return fmt.Errorf("fetch offloaded payload %s: %w", job.PayloadRef, err)
+	}
+	var off offloaded
+	if err := json.Unmarshal(blob, &off); err != nil {
+		return fmt.Errorf("decode offloaded payload %s: %w", job.PayloadRef, err)
+	}
+	job.CommitMessages = off.CommitMessages
+	if job.HeadCommit != nil {
+		job.HeadCommit.Message = off.HeadCommitMessage
+	}
+	job.PayloadRef = ""
+	return nil
+}
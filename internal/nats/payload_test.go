@@ -0,0 +1,72 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type memBucket map[string][]byte
+
+func (b memBucket) PutBytes(_ context.Context, name string, data []byte) (*jetstream.ObjectInfo, error) {
+	b[name] = data
+	return &jetstream.ObjectInfo{}, nil
+}
+
+func (b memBucket) GetBytes(_ context.Context, name string, _ ...jetstream.GetObjectOpt) ([]byte, error) {
+	data, ok := b[name]
+	if !ok {
+		return nil, jetstream.ErrObjectNotFound
+	}
+	return data, nil
+}
+
+func TestPayloadStoreOffload(t *testing.T) {
+	ctx := context.Background()
+	bucket := memBucket{}
+	p := &PayloadStore{bucket: bucket, limit: 512}
+
+	small := BuildJob{ID: "01J", SHA: strings.Repeat("a", 40), CommitMessages: []string{"fix: x"}}
+	if _, err := p.Marshal(ctx, small); err != nil || len(bucket) != 0 {
+		t.Fatalf("small job: err = %v, offloaded %d", err, len(bucket))
+	}
+
+	big := small
+	big.CommitMessages = []string{strings.Repeat("m", 1000), "feat: y"}
+	big.HeadCommit = &CommitInfo{ID: big.SHA, Message: "feat: y"}
+	data, err := p.Marshal(ctx, big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > p.limit {
+		t.Fatalf("message is %d bytes, limit %d", len(data), p.limit)
+	}
+
+	var got BuildJob
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.PayloadRef == "" || got.CommitMessages != nil {
+		t.Fatalf("fields not offloaded: %+v", got)
+	}
+	if err := p.Resolve(ctx, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.CommitMessages, big.CommitMessages) || got.HeadCommit.Message != "feat: y" || got.PayloadRef != "" {
+		t.Errorf("resolved job = %+v", got)
+	}
+}
+
+func TestPayloadStoreTooLarge(t *testing.T) {
+	p := &PayloadStore{bucket: memBucket{}, limit: 64}
+	job := BuildJob{ID: "01J", RepoURL: "https://github.com/" + strings.Repeat("o", 100) + "/r"}
+	var tooLarge *ErrPayloadTooLarge
+	if _, err := p.Marshal(context.Background(), job); !errors.As(err, &tooLarge) {
+		t.Fatalf("err = %v, want ErrPayloadTooLarge", err)
+	}
+}
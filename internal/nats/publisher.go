@@ -2,45 +2,148 @@ package nats
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/jobid"
 	"github.com/nats-io/nats.go/jetstream"
 )
 
 // BuildJob is the message published by the webhook-server and consumed by the worker.
 type BuildJob struct {
-	RepoURL        string    `json:"repo_url"`
-	SHA            string    `json:"sha"`
-	CommitMessages []string  `json:"commit_messages"`
-	InstallationID int64     `json:"installation_id"`
-	PublishedAt    time.Time `json:"published_at"`
+	// ID is a ULID assigned at publish time. Jobs published before IDs were
+	// introduced have none; see EffectiveID.
+	ID             string      `json:"id,omitempty"`
+	RepoURL        string      `json:"repo_url"`
+	SHA            string      `json:"sha"`
+	CommitMessages []string    `json:"commit_messages"`
+	Branch         string      `json:"branch,omitempty"` // pushed branch, or a pull request's head branch
+	InstallationID int64       `json:"installation_id"`
+	PublishedAt    time.Time   `json:"published_at"`
+	HeadCommit     *CommitInfo `json:"head_commit,omitempty"`
+
+	// BuildNumber counts the repository's builds (acme/shop #142), assigned
+	// by the webhook-server from the store. 0 when it could not be assigned.
+	BuildNumber int64 `json:"build_number,omitempty"`
+
+	// Trust is empty (trusted) for pushes to the repository itself and
+	// TrustUntrusted for code from forks. Untrusted jobs are built for
+	// validation only: no credentials, no push, no version or SHA update.
+	Trust Trust `json:"trust,omitempty"`
+	// CloneURL overrides RepoURL as the clone source (the fork of a pull
+	// request). RepoURL still identifies the repository being built.
+	CloneURL string `json:"clone_url,omitempty"`
+	// BaseSHA, when set, is the nx affected base instead of the last
+	// processed SHA (the pull request's base commit).
+	BaseSHA     string           `json:"base_sha,omitempty"`
+	PullRequest *PullRequestInfo `json:"pull_request,omitempty"`
+
+	// Clean disables every build cache for this job: the nx affected result
+	// cache, the Nx computation cache and buildah's layer cache. The
+	// repository can request the same through .ocibuild.yaml.
+	Clean bool `json:"clean,omitempty"`
+
+	// CompileOnly builds the image's builder stage only, compiling and
+	// testing the projects without producing, pushing or versioning an
+	// image. It never advances the last processed SHA.
+	CompileOnly bool `json:"compile_only,omitempty"`
+
+	// Directives are the [build: ...] and [skip: ...] commit message
+	// directives of the push, recorded when the job is published.
+	Directives *Directives `json:"directives,omitempty"`
+
+	// Affinity carries the repository's hints on which workers should
+	// build the job, from its settings.
+	Affinity *Affinity `json:"affinity,omitempty"`
+
+	// Languages pins the language of the repository's projects, from its
+	// settings.
+	Languages *Languages `json:"languages,omitempty"`
+
+	// FailOnWarning fails the repository's project builds with warnings of
+	// this severity or above, from its settings; see package buildwarn.
+	FailOnWarning string `json:"fail_on_warning,omitempty"`
+
+	// Requeue marks a job published again by POST /builds/requeue to
+	// rebuild the projects its Directives name. It is built even when SHA
+	// is the repository's last processed SHA, and never advances it.
+	Requeue bool `json:"requeue,omitempty"`
+
+	// PayloadRef names the object holding this job's commit messages when
+	// they were too large to send inline; see PayloadStore.
+	PayloadRef string `json:"payload_ref,omitempty"`
+
+	// BranchProtected is set by the worker when it starts the job: whether
+	// Branch has GitHub branch protection. Policy rules can apply to
+	// protected branches only.
+	BranchProtected bool `json:"branch_protected,omitempty"`
+}
+
+// Trust is the trust level of a build job's source code.
+type Trust string
+
+const (
+	TrustTrusted   Trust = "trusted"
+	TrustUntrusted Trust = "untrusted"
+)
+
+// EffectiveID returns the job ID, falling back to the short commit SHA that
+// identified jobs before IDs were assigned.
+func (j BuildJob) EffectiveID() string {
+	if j.ID != "" {
+		return j.ID
+	}
+	if len(j.SHA) > 8 {
+		return j.SHA[:8]
+	}
+	return j.SHA
+}
+
+// Untrusted reports whether the job builds code from outside the repository.
+func (j BuildJob) Untrusted() bool { return j.Trust == TrustUntrusted }
+
+// PullRequestInfo identifies the pull request an untrusted job validates.
+type PullRequestInfo struct {
+	Number   int    `json:"number"`
+	HeadRepo string `json:"head_repo"` // fork full name, "owner/name"
+}
+
+// CommitInfo is the webhook's view of a commit, used to verify the checkout.
+type CommitInfo struct {
+	ID          string `json:"id"`
+	Message     string `json:"message"`
+	AuthorEmail string `json:"author_email"`
 }
 
 // Publisher publishes build job messages to NATS JetStream.
 type Publisher struct {
-	js      jetstream.JetStream
-	subject string
+	js       jetstream.JetStream
+	payloads *PayloadStore
+	subject  string
+	ids      jobid.Generator
 }
 
 // NewPublisher creates a Publisher.
-func NewPublisher(js jetstream.JetStream, cfg *config.Config) *Publisher {
-	return &Publisher{js: js, subject: cfg.NATS.Subject}
+func NewPublisher(js jetstream.JetStream, payloads *PayloadStore, cfg *config.Config) *Publisher {
+	return &Publisher{js: js, payloads: payloads, subject: cfg.NATS.Subject, ids: jobid.NewULIDGenerator()}
 }
 
-// Publish serializes and publishes a BuildJob.
-func (p *Publisher) Publish(ctx context.Context, job BuildJob) error {
+// Publish serializes and publishes a BuildJob, assigning its ID if unset.
+// It returns the job ID.
+func (p *Publisher) Publish(ctx context.Context, job BuildJob) (string, error) {
+	if job.ID == "" {
+		job.ID = p.ids.NewID()
+	}
 	if job.PublishedAt.IsZero() {
 		job.PublishedAt = time.Now().UTC()
 	}
-	data, err := json.Marshal(job)
+	data, err := p.payloads.Marshal(ctx, job)
 	if err != nil {
-		return fmt.Errorf("marshal build job: %w", err)
+		return "", err
 	}
 	if _, err := p.js.Publish(ctx, p.subject, data); err != nil {
-		return fmt.Errorf("nats publish: %w", err)
+		return "", fmt.Errorf("nats publish: %w", err)
 	}
-	return nil
+	return job.ID, nil
 }
@@ -0,0 +1,106 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// maxScannedJobs bounds one walk over the stream, so a wide age window
+// cannot read the whole job history.
+const maxScannedJobs = 10000
+
+// StreamJob is a build job message kept in the stream.
+type StreamJob struct {
+	Seq      uint64
+	QueuedAt time.Time // when the message entered the stream
+	// Waiting is true until a worker has received the job.
+	Waiting bool
+	Job     BuildJob
+}
+
+// Queue reads and removes the build jobs in the stream, for operator bulk
+// actions. The stream keeps processed jobs too, up to its limits.
+type Queue struct {
+	js  jetstream.JetStream
+	cfg config.NATSConfig
+}
+
+// NewQueue creates a Queue on the build stream.
+func NewQueue(js jetstream.JetStream, cfg *config.Config) *Queue {
+	return &Queue{js: js, cfg: cfg.NATS}
+}
+
+// queueStream is the subset of jetstream.Stream used by Queue.
+type queueStream interface {
+	Info(ctx context.Context, opts ...jetstream.StreamInfoOpt) (*jetstream.StreamInfo, error)
+	GetMsg(ctx context.Context, seq uint64, opts ...jetstream.GetMsgOpt) (*jetstream.RawStreamMsg, error)
+}
+
+// Jobs returns the jobs that entered the stream since since, newest first.
+// With waitingOnly it stops at the jobs workers have already received.
+func (q *Queue) Jobs(ctx context.Context, since time.Time, waitingOnly bool) ([]StreamJob, error) {
+	stream, err := q.js.Stream(ctx, q.cfg.StreamName)
+	if err != nil {
+		return nil, fmt.Errorf("stream lookup: %w", err)
+	}
+	consumer, err := stream.Consumer(ctx, q.cfg.ConsumerName)
+	if err != nil {
+		return nil, fmt.Errorf("consumer lookup: %w", err)
+	}
+	info, err := consumer.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("consumer info: %w", err)
+	}
+	return scanJobs(ctx, stream, info.Delivered.Stream, since, waitingOnly)
+}
+
+// scanJobs walks stream back from its last message. Messages at or below
+// delivered have been received by a worker.
+func scanJobs(ctx context.Context, stream queueStream, delivered uint64, since time.Time, waitingOnly bool) ([]StreamJob, error) {
+	info, err := stream.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("stream info: %w", err)
+	}
+	first, last := info.State.FirstSeq, info.State.LastSeq
+	if waitingOnly {
+		first = max(first, delivered+1)
+	}
+	var jobs []StreamJob
+	for seq, scanned := last, 0; seq >= first && seq > 0 && scanned < maxScannedJobs; seq, scanned = seq-1, scanned+1 {
+		msg, err := stream.GetMsg(ctx, seq)
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			continue // removed
+		}
+		if err != nil {
+			return jobs, fmt.Errorf("get message %d: %w", seq, err)
+		}
+		if msg.Time.Before(since) {
+			break
+		}
+		var job BuildJob
+		if err := json.Unmarshal(msg.Data, &job); err != nil {
+			continue // not a build job; the worker terminates it
+		}
+		jobs = append(jobs, StreamJob{Seq: seq, QueuedAt: msg.Time, Waiting: seq > delivered, Job: job})
+	}
+	return jobs, nil
+}
+
+// Remove deletes a job from the stream. A job no worker has received yet
+// is never built; one already received is unaffected.
+func (q *Queue) Remove(ctx context.Context, seq uint64) error {
+	stream, err := q.js.Stream(ctx, q.cfg.StreamName)
+	if err != nil {
+		return fmt.Errorf("stream lookup: %w", err)
+	}
+	if err := stream.DeleteMsg(ctx, seq); err != nil && !errors.Is(err, jetstream.ErrMsgNotFound) {
+		return fmt.Errorf("delete message %d: %w", seq, err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// fakeStream is a queueStream over messages keyed by sequence.
+type fakeStream struct {
+	first, last uint64
+	msgs        map[uint64]*jetstream.RawStreamMsg
+}
+
+func (s *fakeStream) Info(context.Context, ...jetstream.StreamInfoOpt) (*jetstream.StreamInfo, error) {
+	return &jetstream.StreamInfo{State: jetstream.StreamState{FirstSeq: s.first, LastSeq: s.last}}, nil
+}
+
+func (s *fakeStream) GetMsg(_ context.Context, seq uint64, _ ...jetstream.GetMsgOpt) (*jetstream.RawStreamMsg, error) {
+	if m, ok := s.msgs[seq]; ok {
+		return m, nil
+	}
+	return nil, jetstream.ErrMsgNotFound
+}
+
+func TestScanJobs(t *testing.T) {
+	now := time.Now()
+	stream := &fakeStream{first: 1, last: 5, msgs: map[uint64]*jetstream.RawStreamMsg{}}
+	for seq := uint64(1); seq <= 5; seq++ {
+		if seq == 4 {
+			continue // removed
+		}
+		data, _ := json.Marshal(BuildJob{ID: string(rune('a' + seq - 1)), SHA: "abc"})
+		stream.msgs[seq] = &jetstream.RawStreamMsg{Sequence: seq, Data: data, Time: now.Add(-time.Duration(6-seq) * time.Hour)}
+	}
+	stream.msgs[2].Data = []byte("not json")
+
+	jobs, err := scanJobs(context.Background(), stream, 3, time.Time{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, j := range jobs {
+		ids = append(ids, j.Job.ID)
+	}
+	if got := len(jobs); got != 3 || ids[0] != "e" || ids[1] != "c" || ids[2] != "a" {
+		t.Fatalf("jobs = %v; want [e c a]", ids)
+	}
+	if !jobs[0].Waiting || jobs[1].Waiting || jobs[0].Seq != 5 {
+		t.Errorf("jobs = %+v", jobs)
+	}
+
+	jobs, err = scanJobs(context.Background(), stream, 3, time.Time{}, true)
+	if err != nil || len(jobs) != 1 || jobs[0].Job.ID != "e" {
+		t.Errorf("waiting jobs = %+v, %v; want [e]", jobs, err)
+	}
+
+	jobs, err = scanJobs(context.Background(), stream, 0, now.Add(-200*time.Minute), false)
+	if err != nil || len(jobs) != 2 {
+		t.Errorf("jobs since 200m ago = %+v, %v; want [e c]", jobs, err)
+	}
+}
@@ -0,0 +1,187 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/jobid"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// spoolExt names spooled jobs; rejectedExt names spooled jobs that can
+// never be published, kept for inspection.
+const (
+	spoolExt    = ".json"
+	rejectedExt = ".rejected"
+)
+
+// Spool holds build jobs on local disk while JetStream is unavailable and
+// publishes them, oldest first, once it is back. While jobs are spooled,
+// new jobs are spooled behind them so none is published out of order.
+type Spool struct {
+	dir     string
+	pub     *Publisher
+	link    *Link
+	ids     jobid.Generator
+	pending atomic.Int64
+	drainMu sync.Mutex
+}
+
+// NewSpool opens the spool in dir, counting jobs left by a previous run.
+// link may be nil when NATS is connected eagerly.
+func NewSpool(dir string, pub *Publisher, link *Link) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+	s := &Spool{dir: dir, pub: pub, link: link, ids: jobid.NewULIDGenerator()}
+	names, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	s.pending.Store(int64(len(names)))
+	return s, nil
+}
+
+// Pending returns the number of spooled jobs.
+func (s *Spool) Pending() int {
+	return int(s.pending.Load())
+}
+
+// Publish publishes job, or spools it when JetStream is not ready, jobs
+// are already spooled, or publishing fails. Jobs that can never be
+// published, such as an ErrPayloadTooLarge, are not spooled.
+func (s *Spool) Publish(ctx context.Context, job BuildJob) (id string, spooled bool, err error) {
+	if s.Pending() == 0 && (s.link == nil || s.link.Ready()) {
+		id, err = s.pub.Publish(ctx, job)
+		if err == nil || permanent(err) {
+			return id, false, err
+		}
+	}
+	id, err = s.put(job)
+	return id, err == nil, err
+}
+
+// put writes job to the spool, assigning its ID and publish time.
+func (s *Spool) put(job BuildJob) (string, error) {
+	if job.ID == "" {
+		job.ID = s.ids.NewID()
+	}
+	if job.PublishedAt.IsZero() {
+		job.PublishedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return "", fmt.Errorf("marshal spooled job: %w", err)
+	}
+	// Write then rename, so Drain never reads a partial job.
+	path := filepath.Join(s.dir, job.ID+spoolExt)
+	if err := os.WriteFile(path+".tmp", data, 0o640); err != nil {
+		return "", fmt.Errorf("spool job: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return "", fmt.Errorf("spool job: %w", err)
+	}
+	s.pending.Add(1)
+	return job.ID, nil
+}
+
+// Drain publishes spooled jobs in order until the spool is empty or a
+// publish fails, returning how many were published. Jobs that can never
+// be published are set aside with a .rejected suffix.
+func (s *Spool) Drain(ctx context.Context, logger *zap.Logger) (int, error) {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+
+	names, err := s.list()
+	if err != nil {
+		return 0, err
+	}
+	published := 0
+	for _, name := range names {
+		path := filepath.Join(s.dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return published, fmt.Errorf("read spooled job: %w", err)
+		}
+		var job BuildJob
+		rejected := json.Unmarshal(data, &job)
+		if rejected == nil {
+			if _, err := s.pub.Publish(ctx, job); err != nil {
+				if !permanent(err) {
+					return published, err
+				}
+				rejected = err
+			}
+		}
+		if rejected != nil {
+			logger.Error("spooled job rejected", zap.String("file", name), zap.Error(rejected))
+			err = os.Rename(path, path+rejectedExt)
+		} else {
+			published++
+			err = os.Remove(path)
+		}
+		if err != nil {
+			return published, fmt.Errorf("dequeue spooled job: %w", err)
+		}
+		s.pending.Add(-1)
+	}
+	return published, nil
+}
+
+// Run drains the spool every interval while JetStream is ready, until ctx
+// is cancelled.
+func (s *Spool) Run(ctx context.Context, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if s.Pending() == 0 || (s.link != nil && !s.link.Ready()) {
+			continue
+		}
+		n, err := s.Drain(ctx, logger)
+		if n > 0 {
+			logger.Info("spooled build jobs published", zap.Int("published", n), zap.Int("pending", s.Pending()))
+		}
+		if err != nil {
+			logger.Warn("spool drain stopped", zap.Error(err), zap.Int("pending", s.Pending()))
+		}
+	}
+}
+
+// list returns the spooled job files, oldest first. Job IDs are ULIDs,
+// which sort by time.
+func (s *Spool) list() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spool dir: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), spoolExt) {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// permanent reports whether publishing a job failed for a reason retrying
+// cannot fix.
+func permanent(err error) bool {
+	var tooLarge *ErrPayloadTooLarge
+	return errors.As(err, &tooLarge) || errors.Is(err, nats.ErrMaxPayload)
+}
@@ -0,0 +1,105 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/jobid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+// fakeJetStream records published messages, failing while down. Other
+// methods are not used by Publisher.
+type fakeJetStream struct {
+	jetstream.JetStream
+	down bool
+	sent []BuildJob
+}
+
+func (f *fakeJetStream) Publish(_ context.Context, _ string, data []byte, _ ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	if f.down {
+		return nil, nats.ErrConnectionClosed
+	}
+	var job BuildJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	f.sent = append(f.sent, job)
+	return &jetstream.PubAck{}, nil
+}
+
+func TestSpool(t *testing.T) {
+	ctx := context.Background()
+	js := &fakeJetStream{down: true}
+	pub := &Publisher{js: js, payloads: &PayloadStore{bucket: memBucket{}, limit: 512}, subject: "builds.jobs", ids: jobid.NewULIDGenerator()}
+	dir := t.TempDir()
+	spool, err := NewSpool(dir, pub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Publishing fails: both jobs are spooled, the second behind the first
+	// even once NATS is back.
+	if _, spooled, err := spool.Publish(ctx, BuildJob{SHA: "a"}); err != nil || !spooled {
+		t.Fatalf("first job: spooled = %v, err = %v", spooled, err)
+	}
+	js.down = false
+	if _, spooled, err := spool.Publish(ctx, BuildJob{SHA: "b"}); err != nil || !spooled {
+		t.Fatalf("second job: spooled = %v, err = %v", spooled, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "01ZZZZZZZZZZZZZZZZZZZZZZZZ"+spoolExt), []byte("{"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewSpool(dir, pub, nil)
+	if err != nil || reopened.Pending() != 3 {
+		t.Fatalf("reopened spool: pending = %d, err = %v", reopened.Pending(), err)
+	}
+
+	n, err := reopened.Drain(ctx, zap.NewNop())
+	if err != nil || n != 2 {
+		t.Fatalf("Drain = %d, %v; want 2 published", n, err)
+	}
+	if len(js.sent) != 2 || js.sent[0].SHA != "a" || js.sent[1].SHA != "b" || js.sent[0].ID == "" {
+		t.Errorf("published = %+v, want a then b with IDs", js.sent)
+	}
+	if reopened.Pending() != 0 {
+		t.Errorf("pending after drain = %d", reopened.Pending())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "01ZZZZZZZZZZZZZZZZZZZZZZZZ"+spoolExt+rejectedExt)); err != nil {
+		t.Errorf("corrupt job not set aside: %v", err)
+	}
+
+	// With the spool empty, jobs are published directly; oversized jobs
+	// fail instead of being spooled.
+	if _, spooled, err := reopened.Publish(ctx, BuildJob{SHA: "c"}); err != nil || spooled {
+		t.Errorf("direct publish: spooled = %v, err = %v", spooled, err)
+	}
+	huge := BuildJob{SHA: strings.Repeat("c", 1000)}
+	var tooLarge *ErrPayloadTooLarge
+	if _, spooled, err := reopened.Publish(ctx, huge); !errors.As(err, &tooLarge) || spooled {
+		t.Errorf("oversized job: spooled = %v, err = %v", spooled, err)
+	}
+}
+
+func TestLinkNotReady(t *testing.T) {
+	link := newLink()
+	if link.Ready() || link.Consumer() != nil || !errors.Is(link.Err(), ErrNotReady) {
+		t.Fatalf("new link: ready = %v, err = %v", link.Ready(), link.Err())
+	}
+	payloads := &PayloadStore{bucket: lazyBucket{link}, limit: 64}
+	job := BuildJob{ID: "01J", CommitMessages: []string{strings.Repeat("m", 100)}}
+	if _, err := payloads.Marshal(context.Background(), job); !errors.Is(err, ErrNotReady) {
+		t.Errorf("offload before ready: err = %v, want ErrNotReady", err)
+	}
+	control := &Control{kv: lazyKV{link}}
+	if _, err := control.Pause(context.Background()); !errors.Is(err, ErrNotReady) {
+		t.Errorf("pause state before ready: err = %v, want ErrNotReady", err)
+	}
+}
@@ -3,7 +3,10 @@ package nats
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jorgerua/build-system/container-build-service/internal/config"
@@ -18,51 +21,181 @@ type HandlerFunc func(ctx context.Context, msg jetstream.Msg, job BuildJob) erro
 // Subscriber consumes build job messages from NATS JetStream.
 type Subscriber struct {
 	consumer         jetstream.Consumer
+	payloads         *PayloadStore
+	control          *Control // nil: never paused
 	cfg              *config.Config
 	logger           *zap.Logger
 	heartbeatSeconds time.Duration
+
+	// inFlight tracks stream sequences being handled by this process, so a
+	// redelivery of a message we are still working on is not run twice.
+	mu       sync.Mutex
+	inFlight map[uint64]struct{}
+	iter     jetstream.MessagesContext // current iterator, stopped on pause
+
+	paused atomic.Bool
+	held   atomic.Bool   // this worker's intake is held; see Hold
+	wake   chan struct{} // signalled on pause and hold state changes
 }
 
-// NewSubscriber creates a Subscriber.
-func NewSubscriber(consumer jetstream.Consumer, cfg *config.Config, logger *zap.Logger) *Subscriber {
+// NewSubscriber creates a Subscriber. A nil control never pauses.
+func NewSubscriber(consumer jetstream.Consumer, payloads *PayloadStore, control *Control, cfg *config.Config, logger *zap.Logger) *Subscriber {
 	return &Subscriber{
 		consumer:         consumer,
+		payloads:         payloads,
+		control:          control,
+		wake:             make(chan struct{}, 1),
 		cfg:              cfg,
-		logger:           logger,
+		logger:           logger.Named("nats"),
 		heartbeatSeconds: time.Duration(cfg.Worker.HeartbeatSeconds) * time.Second,
+		inFlight:         make(map[uint64]struct{}),
 	}
 }
 
 // Subscribe starts consuming messages, calling handler for each.
 // It sends periodic msg.InProgress() heartbeats so NATS does not
-// redeliver the message while the handler is running.
+// redeliver the message while the handler is running. While the queue is
+// paused through Control, no new messages are fetched; jobs already
+// running finish. Ending ctx stops fetching but does not cancel running
+// handlers, which keep their heartbeats until they return.
 func (s *Subscriber) Subscribe(ctx context.Context, handler HandlerFunc) error {
-	msgCh, err := s.consumer.Messages()
-	if err != nil {
-		return fmt.Errorf("subscribe: %w", err)
+	if err := s.watchPause(ctx); err != nil {
+		return err
 	}
-
 	for {
-		select {
-		case <-ctx.Done():
+		if err := s.waitResumed(ctx); err != nil {
+			return err
+		}
+		msgCh, err := s.consumer.Messages()
+		if err != nil {
+			return fmt.Errorf("subscribe: %w", err)
+		}
+		s.setIterator(msgCh)
+		if s.paused.Load() || s.held.Load() {
+			// Paused or held while the iterator was being created.
 			msgCh.Stop()
+			continue
+		}
+		s.consume(ctx, msgCh, handler)
+		if ctx.Err() != nil {
 			return ctx.Err()
-		default:
 		}
+	}
+}
 
+// consume hands messages to handler until the iterator is stopped, by a
+// pause or by ctx ending.
+func (s *Subscriber) consume(ctx context.Context, msgCh jetstream.MessagesContext, handler HandlerFunc) {
+	stop := context.AfterFunc(ctx, msgCh.Stop)
+	defer stop()
+	handlerCtx := context.WithoutCancel(ctx)
+	for {
 		msg, err := msgCh.Next()
 		if err != nil {
-			if ctx.Err() != nil {
-				return ctx.Err()
+			if errors.Is(err, jetstream.ErrMsgIteratorClosed) || ctx.Err() != nil {
+				return
 			}
 			s.logger.Error("fetch message error", zap.Error(err))
 			continue
 		}
+		if s.cfg.Worker.DeterministicSchedule {
+			s.handle(handlerCtx, msg, handler)
+			continue
+		}
+		go s.handle(handlerCtx, msg, handler)
+	}
+}
+
+// watchPause follows the queue switch, stopping the current iterator when
+// the queue is paused. Messages the iterator had prefetched are redelivered
+// after AckWait once consumption resumes.
+func (s *Subscriber) watchPause(ctx context.Context) error {
+	if s.control == nil {
+		return nil
+	}
+	// Read the switch before the first fetch; the watch follows changes.
+	state, err := s.control.Pause(ctx)
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+	if state.Paused {
+		s.paused.Store(true)
+		s.logger.Warn("job consumption paused",
+			zap.String("by", state.By), zap.String("reason", state.Reason))
+	}
+	states, err := s.control.WatchPause(ctx)
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+	go func() {
+		for state := range states {
+			if s.paused.Swap(state.Paused) == state.Paused {
+				continue
+			}
+			if state.Paused {
+				s.logger.Warn("job consumption paused",
+					zap.String("by", state.By), zap.String("reason", state.Reason))
+				s.stopIterator()
+			} else {
+				s.logger.Info("job consumption resumed", zap.String("by", state.By))
+			}
+			s.signal()
+		}
+	}()
+	return nil
+}
+
+// Hold stops this worker from fetching new jobs, like a queue pause local
+// to it, until Release. Jobs already running finish; prefetched messages
+// are redelivered, possibly to other workers, after AckWait.
+func (s *Subscriber) Hold() {
+	if !s.held.Swap(true) {
+		s.stopIterator()
+		s.signal()
+	}
+}
 
-		go s.handle(ctx, msg, handler)
+// Release undoes Hold.
+func (s *Subscriber) Release() {
+	if s.held.Swap(false) {
+		s.signal()
 	}
 }
 
+func (s *Subscriber) stopIterator() {
+	s.mu.Lock()
+	if s.iter != nil {
+		s.iter.Stop()
+	}
+	s.mu.Unlock()
+}
+
+// signal wakes waitResumed.
+func (s *Subscriber) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// waitResumed blocks while the queue is paused or intake is held.
+func (s *Subscriber) waitResumed(ctx context.Context) error {
+	for s.paused.Load() || s.held.Load() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.wake:
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *Subscriber) setIterator(it jetstream.MessagesContext) {
+	s.mu.Lock()
+	s.iter = it
+	s.mu.Unlock()
+}
+
 func (s *Subscriber) handle(ctx context.Context, msg jetstream.Msg, handler HandlerFunc) {
 	var job BuildJob
 	if err := json.Unmarshal(msg.Data(), &job); err != nil {
@@ -73,6 +206,45 @@ func (s *Subscriber) handle(ctx context.Context, msg jetstream.Msg, handler Hand
 		_ = msg.Nak()
 		return
 	}
+	if err := s.payloads.Resolve(ctx, &job); err != nil {
+		s.logger.Error("resolve offloaded build job payload failed",
+			zap.Error(err),
+			zap.String("payload_ref", job.PayloadRef),
+		)
+		_ = msg.Nak()
+		return
+	}
+	if err := job.Validate(); err != nil {
+		// Redelivery cannot fix a malformed job: terminate it.
+		s.logger.Error("invalid build job, terminating",
+			zap.Error(err),
+			zap.String("raw", string(msg.Data())),
+		)
+		_ = msg.Term()
+		return
+	}
+
+	log := s.logger.With(zap.String("sha", job.SHA), zap.String("repo", job.RepoURL))
+	if meta, err := msg.Metadata(); err == nil {
+		log = log.With(
+			zap.Uint64("stream_seq", meta.Sequence.Stream),
+			zap.Uint64("num_delivered", meta.NumDelivered),
+		)
+		if meta.NumDelivered > 1 {
+			// A previous delivery was not acked in time: the worker handling
+			// it died or stalled. The handler is idempotent per project.
+			log.Warn("build job redelivered",
+				zap.Int("max_delivers", s.cfg.NATS.MaxDelivers),
+			)
+		}
+		if !s.begin(meta.Sequence.Stream) {
+			// Still running here (e.g. a heartbeat was delayed past AckWait).
+			// Leave the redelivery unacked; the running handler acks it.
+			log.Warn("build job already in progress on this worker, ignoring redelivery")
+			return
+		}
+		defer s.end(meta.Sequence.Stream)
+	}
 
 	// Start heartbeat goroutine: sends InProgress every heartbeatSeconds
 	// to prevent false redelivery during long-running processing.
@@ -81,20 +253,50 @@ func (s *Subscriber) handle(ctx context.Context, msg jetstream.Msg, handler Hand
 	go s.heartbeat(heartbeatCtx, msg)
 
 	if err := handler(ctx, msg, job); err != nil {
-		s.logger.Error("build job handler error",
-			zap.Error(err),
-			zap.String("sha", job.SHA),
-			zap.String("repo", job.RepoURL),
-		)
+		var deferred *DeferError
+		if errors.As(err, &deferred) {
+			log.Info("build job deferred", zap.String("reason", deferred.Reason), zap.Duration("delay", deferred.Delay))
+			_ = msg.NakWithDelay(deferred.Delay)
+			return
+		}
+		log.Error("build job handler error", zap.Error(err))
 		_ = msg.Nak()
 		return
 	}
 
 	if err := msg.Ack(); err != nil {
-		s.logger.Error("ack failed", zap.Error(err), zap.String("sha", job.SHA))
+		log.Error("ack failed", zap.Error(err))
 	}
 }
 
+// DeferError is returned by a handler that leaves a job to another worker
+// or a later attempt. The job is redelivered after Delay; the deferral is
+// not logged as a failure, but counts toward nats.max_delivers.
+type DeferError struct {
+	Delay  time.Duration
+	Reason string
+}
+
+func (e *DeferError) Error() string { return "deferred: " + e.Reason }
+
+// begin marks a stream sequence as in flight. It returns false when the
+// sequence is already being handled by this process.
+func (s *Subscriber) begin(seq uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.inFlight[seq]; ok {
+		return false
+	}
+	s.inFlight[seq] = struct{}{}
+	return true
+}
+
+func (s *Subscriber) end(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inFlight, seq)
+}
+
 func (s *Subscriber) heartbeat(ctx context.Context, msg jetstream.Msg) {
 	ticker := time.NewTicker(s.heartbeatSeconds)
 	defer ticker.Stop()
@@ -0,0 +1,100 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+// fakeMsg is a delivery of the stream message seq, counting its acks.
+type fakeMsg struct {
+	jetstream.Msg
+	data []byte
+	seq  uint64
+	n    uint64
+
+	mu         sync.Mutex
+	acks, naks int
+}
+
+func (m *fakeMsg) Data() []byte { return m.data }
+
+func (m *fakeMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{Sequence: jetstream.SequencePair{Stream: m.seq}, NumDelivered: m.n}, nil
+}
+
+func (m *fakeMsg) Ack() error                       { m.count(&m.acks); return nil }
+func (m *fakeMsg) Nak() error                       { m.count(&m.naks); return nil }
+func (m *fakeMsg) NakWithDelay(time.Duration) error { m.count(&m.naks); return nil }
+func (m *fakeMsg) Term() error                      { m.count(&m.naks); return nil }
+func (m *fakeMsg) InProgress() error                { return nil }
+func (m *fakeMsg) count(n *int)                     { m.mu.Lock(); *n++; m.mu.Unlock() }
+func (m *fakeMsg) settled() (acks, naks int)        { m.mu.Lock(); defer m.mu.Unlock(); return m.acks, m.naks }
+
+func TestHandleIgnoresRedeliveryInFlight(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Worker.HeartbeatSeconds = 60
+	s := NewSubscriber(nil, nil, nil, cfg, zap.NewNop())
+
+	job := BuildJob{RepoURL: "https://github.com/acme/shop.git", SHA: "0123456789abcdef0123456789abcdef01234567", InstallationID: 1}
+	if err := job.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(job)
+
+	var calls atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := func(context.Context, jetstream.Msg, BuildJob) error {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		return nil
+	}
+
+	first := &fakeMsg{data: data, seq: 7, n: 1}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.handle(context.Background(), first, handler)
+	}()
+	<-started
+
+	// AckWait passed while the first delivery runs: the redelivery is
+	// neither handled nor settled.
+	second := &fakeMsg{data: data, seq: 7, n: 2}
+	s.handle(context.Background(), second, handler)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("handler ran %d times, want once", n)
+	}
+	if acks, naks := second.settled(); acks != 0 || naks != 0 {
+		t.Errorf("redelivery settled: %d acks, %d naks", acks, naks)
+	}
+
+	// Another message is not held up.
+	other := &fakeMsg{data: data, seq: 8, n: 1}
+	s.handle(context.Background(), other, handler)
+	if acks, _ := other.settled(); calls.Load() != 2 || acks != 1 {
+		t.Errorf("other message: %d calls, %d acks; want handled", calls.Load(), acks)
+	}
+
+	close(release)
+	<-done
+	if acks, naks := first.settled(); acks != 1 || naks != 0 {
+		t.Errorf("first delivery: %d acks, %d naks; want acked", acks, naks)
+	}
+
+	// Once it finished, a later delivery is handled again.
+	third := &fakeMsg{data: data, seq: 7, n: 3}
+	s.handle(context.Background(), third, handler)
+	if acks, _ := third.settled(); calls.Load() != 3 || acks != 1 {
+		t.Errorf("delivery after completion: %d calls, %d acks; want handled", calls.Load(), acks)
+	}
+}
@@ -0,0 +1,54 @@
+package nats
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/validation"
+)
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Validate checks that a job is well-formed before it is published or
+// processed. The returned error is a validation.Errors listing every
+// invalid field by its JSON name.
+func (j BuildJob) Validate() error {
+	var errs validation.Errors
+
+	if j.RepoURL == "" {
+		errs.Add("repo_url", "is required")
+	} else if !isCloneURL(j.RepoURL) {
+		errs.Add("repo_url", "must be an https:// or git@ clone URL")
+	}
+	if !commitSHA.MatchString(j.SHA) {
+		errs.Add("sha", "must be a 40-character lowercase hex commit SHA")
+	}
+	if j.BaseSHA != "" && !commitSHA.MatchString(j.BaseSHA) {
+		errs.Add("base_sha", "must be a 40-character lowercase hex commit SHA")
+	}
+
+	switch j.Trust {
+	case "", TrustTrusted:
+		if j.InstallationID <= 0 {
+			errs.Add("installation_id", "is required for trusted jobs")
+		}
+	case TrustUntrusted:
+		if j.CloneURL == "" {
+			errs.Add("clone_url", "is required for untrusted jobs")
+		}
+	default:
+		errs.Add("trust", "must be %q or %q", TrustTrusted, TrustUntrusted)
+	}
+	if j.CloneURL != "" && !isCloneURL(j.CloneURL) {
+		errs.Add("clone_url", "must be an https:// or git@ clone URL")
+	}
+	if hc := j.HeadCommit; hc != nil && hc.ID != j.SHA {
+		errs.Add("head_commit.id", "must equal sha")
+	}
+
+	return errs.Err()
+}
+
+func isCloneURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "git@")
+}
@@ -0,0 +1,48 @@
+package nats
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/validation"
+)
+
+func TestBuildJobValidate(t *testing.T) {
+	sha := strings.Repeat("a", 40)
+	valid := BuildJob{RepoURL: "https://github.com/acme/shop.git", SHA: sha, InstallationID: 1}
+
+	tests := []struct {
+		name       string
+		mutate     func(*BuildJob)
+		wantFields []string
+	}{
+		{"valid", func(*BuildJob) {}, nil},
+		{"missing everything", func(j *BuildJob) { *j = BuildJob{} }, []string{"repo_url", "sha", "installation_id"}},
+		{"short sha", func(j *BuildJob) { j.SHA = "abc123" }, []string{"sha"}},
+		{"bad repo url", func(j *BuildJob) { j.RepoURL = "ftp://example.com/x" }, []string{"repo_url"}},
+		{"untrusted without clone url", func(j *BuildJob) { j.Trust = TrustUntrusted }, []string{"clone_url"}},
+		{"untrusted fork", func(j *BuildJob) {
+			j.Trust, j.CloneURL, j.InstallationID = TrustUntrusted, "https://github.com/dev/shop.git", 0
+		}, nil},
+		{"unknown trust", func(j *BuildJob) { j.Trust = "maybe" }, []string{"trust"}},
+		{"head commit mismatch", func(j *BuildJob) { j.HeadCommit = &CommitInfo{ID: "b"} }, []string{"head_commit.id"}},
+	}
+	for _, tc := range tests {
+		job := valid
+		tc.mutate(&job)
+		err := job.Validate()
+
+		var errs validation.Errors
+		if err != nil && !errors.As(err, &errs) {
+			t.Fatalf("%s: error %T is not validation.Errors", tc.name, err)
+		}
+		var got []string
+		for _, f := range errs {
+			got = append(got, f.Field)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.wantFields, ",") {
+			t.Errorf("%s: invalid fields = %v, want %v", tc.name, got, tc.wantFields)
+		}
+	}
+}
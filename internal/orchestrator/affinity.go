@@ -0,0 +1,35 @@
+package orchestrator
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/clock"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// affinityRetryDelay is how long a job is left for other workers after
+// this one declines it.
+const affinityRetryDelay = 15 * time.Second
+
+// routeJob returns a *natspkg.DeferError when the job's affinity hints ask
+// for another kind of worker, or nil to build it here. Hints are soft: a
+// job is built here anyway once it has waited worker.affinity_wait_seconds,
+// or when one more deferral could exhaust nats.max_delivers.
+func (o *Orchestrator) routeJob(msg jetstream.Msg, job natspkg.BuildJob) error {
+	unmet := job.Affinity.Unmet(o.cfg.Worker.Labels)
+	if len(unmet) == 0 {
+		return nil
+	}
+	wait := time.Duration(o.cfg.Worker.AffinityWaitSeconds) * time.Second
+	if clock.Since(o.clock, job.PublishedAt) >= wait {
+		return nil
+	}
+	if limit := o.cfg.NATS.MaxDelivers; limit > 0 {
+		if meta, err := msg.Metadata(); err != nil || int(meta.NumDelivered) >= limit-1 {
+			return nil
+		}
+	}
+	return &natspkg.DeferError{Delay: affinityRetryDelay, Reason: "unmet affinity hints: " + strings.Join(unmet, ", ")}
+}
@@ -0,0 +1,57 @@
+package orchestrator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/clock"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// deliveredMsg is a jetstream.Msg delivered n times.
+type deliveredMsg struct {
+	jetstream.Msg
+	n uint64
+}
+
+func (m deliveredMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumDelivered: m.n}, nil
+}
+
+func TestRouteJob(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	cfg := &config.Config{}
+	cfg.Worker.Labels = []string{"spot"}
+	cfg.Worker.AffinityWaitSeconds = 300
+	cfg.NATS.MaxDelivers = 5
+	o := &Orchestrator{cfg: cfg, clock: clk}
+
+	job := natspkg.BuildJob{PublishedAt: clk.Now().Add(-time.Minute), Affinity: &natspkg.Affinity{Requires: []string{"large-memory"}}}
+	var deferred *natspkg.DeferError
+	if err := o.routeJob(deliveredMsg{n: 1}, job); !errors.As(err, &deferred) {
+		t.Fatalf("routeJob = %v, want deferral", err)
+	}
+	if deferred.Reason != "unmet affinity hints: requires large-memory" {
+		t.Errorf("reason = %q", deferred.Reason)
+	}
+
+	if err := o.routeJob(deliveredMsg{n: 4}, job); err != nil {
+		t.Errorf("last delivery deferred: %v", err)
+	}
+	clk.Advance(5 * time.Minute)
+	if err := o.routeJob(deliveredMsg{n: 1}, job); err != nil {
+		t.Errorf("job past the affinity wait deferred: %v", err)
+	}
+
+	cfg.Worker.Labels = []string{"large-memory"}
+	clk.Set(job.PublishedAt)
+	if err := o.routeJob(deliveredMsg{n: 1}, job); err != nil {
+		t.Errorf("matching worker deferred: %v", err)
+	}
+	if err := o.routeJob(deliveredMsg{n: 1}, natspkg.BuildJob{PublishedAt: job.PublishedAt}); err != nil {
+		t.Errorf("job without hints deferred: %v", err)
+	}
+}
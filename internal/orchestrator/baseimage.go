@@ -0,0 +1,128 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+// ErrBaseImageNotAllowed is returned when a generated Dockerfile builds
+// from images outside the repository's base image allowlist. Retrying
+// cannot help: the same Dockerfile is generated again.
+type ErrBaseImageNotAllowed struct {
+	Images []string
+}
+
+func (e *ErrBaseImageNotAllowed) Error() string {
+	return fmt.Sprintf("base images not allowed by policy: %s", strings.Join(e.Images, ", "))
+}
+
+// baseImages returns the images the FROM lines of dockerfile build from, in
+// order. References to earlier stages and scratch are left out.
+func baseImages(dockerfile string) []string {
+	stages := map[string]bool{}
+	var images []string
+	for _, line := range strings.Split(dockerfile, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		args := fields[1:]
+		for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+			args = args[1:] // --platform=…
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if image := args[0]; image != "scratch" && !stages[strings.ToLower(image)] {
+			images = append(images, image)
+		}
+		if len(args) >= 3 && strings.EqualFold(args[1], "AS") {
+			stages[strings.ToLower(args[2])] = true
+		}
+	}
+	return images
+}
+
+// normalizeImage splits an image reference into its fully qualified name,
+// expanding Docker Hub short names, and its digest, if pinned.
+func normalizeImage(ref string) (name, digest string) {
+	name, digest, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i] // tag
+	}
+	first, _, qualified := strings.Cut(name, "/")
+	if !qualified || !strings.ContainsAny(first, ".:") && first != "localhost" {
+		if !qualified {
+			name = "library/" + name
+		}
+		name = "docker.io/" + name
+	}
+	return name, digest
+}
+
+// allowedImage reports whether policy admits image.
+func allowedImage(policy config.BaseImagePolicy, image string) bool {
+	name, digest := normalizeImage(image)
+	for _, entry := range policy.Allow {
+		if strings.Contains(entry, "@") {
+			allowName, allowDigest := normalizeImage(entry)
+			if name == allowName && digest == allowDigest {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimSuffix(entry, "/")
+		if name == entry || strings.HasPrefix(name, entry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// disallowedImages returns the base images of dockerfile that policy does
+// not admit.
+func disallowedImages(policy config.BaseImagePolicy, dockerfile string) []string {
+	var out []string
+	for _, image := range baseImages(dockerfile) {
+		if !allowedImage(policy, image) {
+			out = append(out, image)
+		}
+	}
+	return out
+}
+
+// baseImageUsage counts the base images of the Dockerfiles built, for the
+// warm image set.
+type baseImageUsage struct {
+	mu   sync.Mutex
+	uses map[string]int
+}
+
+// observe counts the base images of dockerfile. Images with unexpanded
+// build arguments cannot be pulled ahead and are left out.
+func (u *baseImageUsage) observe(dockerfile string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, image := range baseImages(dockerfile) {
+		if strings.Contains(image, "$") {
+			continue
+		}
+		if u.uses == nil {
+			u.uses = map[string]int{}
+		}
+		u.uses[image]++
+	}
+}
+
+// TakeBaseImageUsage returns how many builds used each base image since the
+// previous call and resets the counts; see package warmimages.
+func (o *Orchestrator) TakeBaseImageUsage() map[string]int {
+	o.imageUses.mu.Lock()
+	defer o.imageUses.mu.Unlock()
+	uses := o.imageUses.uses
+	o.imageUses.uses = nil
+	return uses
+}
@@ -0,0 +1,82 @@
+package orchestrator
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+func TestBaseImages(t *testing.T) {
+	dockerfile := `# syntax=docker/dockerfile:1
+FROM --platform=$BUILDPLATFORM golang:1.26-bookworm AS builder
+RUN go build ./...
+FROM builder AS test
+FROM scratch AS empty
+from gcr.io/distroless/static-debian12
+COPY --from=builder /out /app
+`
+	got := baseImages(dockerfile)
+	want := []string{"golang:1.26-bookworm", "gcr.io/distroless/static-debian12"}
+	if !slices.Equal(got, want) {
+		t.Errorf("baseImages = %q, want %q", got, want)
+	}
+}
+
+func TestBaseImageUsage(t *testing.T) {
+	o := &Orchestrator{}
+	o.imageUses.observe("FROM golang:1.26-bookworm AS builder\nFROM ${RUNTIME_IMAGE}\n")
+	o.imageUses.observe("FROM golang:1.26-bookworm\n")
+
+	got := o.TakeBaseImageUsage()
+	if len(got) != 1 || got["golang:1.26-bookworm"] != 2 {
+		t.Errorf("TakeBaseImageUsage = %v, want golang:1.26-bookworm twice", got)
+	}
+	if got := o.TakeBaseImageUsage(); len(got) != 0 {
+		t.Errorf("TakeBaseImageUsage after reset = %v", got)
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	tests := []struct {
+		ref, name, digest string
+	}{
+		{"golang:1.26", "docker.io/library/golang", ""},
+		{"bitnami/redis", "docker.io/bitnami/redis", ""},
+		{"gcr.io/distroless/static-debian12", "gcr.io/distroless/static-debian12", ""},
+		{"localhost/base:1", "localhost/base", ""},
+		{"registry.local:5000/base:1", "registry.local:5000/base", ""},
+		{"golang:1.26@sha256:abc", "docker.io/library/golang", "sha256:abc"},
+	}
+	for _, tt := range tests {
+		name, digest := normalizeImage(tt.ref)
+		if name != tt.name || digest != tt.digest {
+			t.Errorf("normalizeImage(%q) = %q, %q; want %q, %q", tt.ref, name, digest, tt.name, tt.digest)
+		}
+	}
+}
+
+func TestAllowedImage(t *testing.T) {
+	policy := config.BaseImagePolicy{Allow: []string{
+		"gcr.io",
+		"docker.io/library/eclipse-temurin",
+		"docker.io/library/golang@sha256:abc",
+	}}
+	tests := []struct {
+		image string
+		want  bool
+	}{
+		{"gcr.io/distroless/static-debian12", true},
+		{"eclipse-temurin:21-jre-jammy", true},
+		{"eclipse-temurin-fork:21", false},
+		{"golang:1.26@sha256:abc", true},
+		{"golang@sha256:def", false},
+		{"golang:1.26", false},
+		{"gcr.io.evil.example/x", false},
+	}
+	for _, tt := range tests {
+		if got := allowedImage(policy, tt.image); got != tt.want {
+			t.Errorf("allowedImage(%q) = %v, want %v", tt.image, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/buildreport"
+	"github.com/jorgerua/build-system/container-build-service/internal/cachestats"
+	"github.com/jorgerua/build-system/container-build-service/internal/clock"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/procgroup"
+	"go.uber.org/zap"
+)
+
+// installPlan is the package install that bootstraps a workspace.
+type installPlan struct {
+	manager string // npm, yarn or pnpm
+	args    []string
+	env     []string // added to the worker's environment
+	// cacheDir is the package manager's download cache.
+	cacheDir string
+}
+
+// lockfiles maps lockfiles to their package manager, in detection order.
+var lockfiles = []struct{ file, manager string }{
+	{"pnpm-lock.yaml", "pnpm"},
+	{"yarn.lock", "yarn"},
+	{"package-lock.json", "npm"},
+	{"npm-shrinkwrap.json", "npm"},
+}
+
+// planInstall returns the install command for the workspace in repoDir, or
+// nil when it has no package.json. Untrusted code is installed without
+// running lifecycle scripts. Untrusted and clean installs use jobCache
+// rather than the shared package cache.
+func planInstall(cfg config.Config, repoDir string, untrusted, clean bool, jobCache string) *installPlan {
+	if !fileExists(filepath.Join(repoDir, "package.json")) {
+		return nil
+	}
+	bc := cfg.Bootstrap
+	manager, locked := bc.PackageManager, false
+	for _, l := range lockfiles {
+		if fileExists(filepath.Join(repoDir, l.file)) && (manager == "auto" || manager == l.manager) {
+			manager, locked = l.manager, true
+			break
+		}
+	}
+	if manager == "auto" {
+		manager = "npm"
+	}
+	cacheDir := bc.CacheDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(cfg.Cache.Dir, "packages")
+	}
+	if untrusted || clean {
+		cacheDir = jobCache
+	}
+	cacheDir = filepath.Join(cacheDir, manager)
+	frozen := bc.FrozenLockfile && locked
+
+	p := &installPlan{manager: manager, cacheDir: cacheDir}
+	switch manager {
+	case "npm":
+		p.args = []string{"install"}
+		if frozen {
+			p.args = []string{"ci"}
+		}
+		p.args = append(p.args, "--cache", cacheDir, "--no-audit", "--no-fund")
+		if bc.Offline {
+			p.args = append(p.args, "--offline")
+		}
+		if untrusted {
+			p.args = append(p.args, "--ignore-scripts")
+		}
+	case "pnpm":
+		p.args = []string{"install", "--store-dir", cacheDir}
+		if frozen {
+			p.args = append(p.args, "--frozen-lockfile")
+		}
+		if bc.Offline {
+			p.args = append(p.args, "--offline")
+		}
+		if untrusted {
+			p.args = append(p.args, "--ignore-scripts")
+		}
+	case "yarn":
+		if fileExists(filepath.Join(repoDir, ".yarnrc.yml")) {
+			// Yarn 2+ is configured through the environment.
+			p.args = []string{"install"}
+			if frozen {
+				p.args = append(p.args, "--immutable")
+			}
+			if untrusted {
+				p.args = append(p.args, "--mode=skip-build")
+			}
+			p.env = []string{"YARN_CACHE_FOLDER=" + cacheDir, "YARN_ENABLE_GLOBAL_CACHE=false"}
+			if bc.Offline {
+				p.env = append(p.env, "YARN_ENABLE_NETWORK=0")
+			}
+			break
+		}
+		p.args = []string{"install", "--non-interactive", "--cache-folder", cacheDir}
+		if frozen {
+			p.args = append(p.args, "--frozen-lockfile")
+		}
+		if bc.Offline {
+			p.args = append(p.args, "--offline")
+		}
+		if untrusted {
+			p.args = append(p.args, "--ignore-scripts")
+		}
+	}
+	p.args = append(p.args, bc.Args...)
+	return p
+}
+
+// provisionToolchains installs the runtimes the repository declares and
+// returns a context whose commands run with them. Tools it declares no
+// version of keep the worker's.
+func (o *Orchestrator) provisionToolchains(ctx context.Context, log *zap.Logger, repoDir string) (context.Context, error) {
+	runtimes, err := o.toolchains.Provision(ctx, repoDir)
+	if err != nil {
+		return ctx, err
+	}
+	for _, rt := range runtimes {
+		report := buildreport.FromContext(ctx)
+		report.SetToolchain(rt.Tool, rt.Version)
+		fields := []zap.Field{
+			zap.String("tool", rt.Tool),
+			zap.String("version", rt.Version),
+			zap.String("spec", rt.Spec),
+			zap.String("source", rt.Source),
+		}
+		if p := rt.Provenance; p != nil {
+			report.SetToolchainSource(rt.Tool, buildreport.ToolchainSource{URL: p.URL, SHA256: p.SHA256, Verified: p.Verified})
+			fields = append(fields, zap.String("archive", p.URL), zap.String("sha256", p.SHA256), zap.String("verified", p.Verified))
+		}
+		log.Info("toolchain selected", fields...)
+		ctx = procgroup.WithEnv(procgroup.WithPath(ctx, rt.Bin), rt.Env...)
+	}
+	return ctx, nil
+}
+
+// bootstrap installs the workspace's packages so nx can run. Untrusted and
+// clean installs get a package cache of their own, removed afterwards.
+func (o *Orchestrator) bootstrap(ctx context.Context, log *zap.Logger, repoDir string, untrusted, clean bool) error {
+	if !o.cfg.Bootstrap.Enabled {
+		return nil
+	}
+	var jobCache string
+	if untrusted || clean {
+		dir, err := os.MkdirTemp(procgroup.TempDir(ctx), "packages-")
+		if err != nil {
+			return fmt.Errorf("create package cache: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		jobCache = dir
+	}
+	p := planInstall(*o.cfg, repoDir, untrusted, clean, jobCache)
+	if p == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(o.cfg.Bootstrap.TimeoutSeconds)*time.Second)
+	defer cancel()
+	cmd := procgroup.Command(ctx, p.manager, p.args...)
+	cmd.Dir = repoDir
+	if len(p.env) > 0 {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, p.env...)
+	}
+
+	cacheBefore, _, sizeErr := cachestats.Measure(p.cacheDir, "")
+	start := o.clock.Now()
+	out, err := cmd.CombinedOutput()
+	procgroup.Track(ctx, cmd)
+	buildreport.RecordCommand(ctx, p.manager, p.args, start, err)
+	elapsed := clock.Since(o.clock, start)
+
+	status := "success"
+	if err != nil {
+		status = "failure"
+	}
+	o.bm.BootstrapDuration(p.manager, status, elapsed)
+	if err != nil {
+		return fmt.Errorf("%s install: %w: %s", p.manager, err, tail(out, 2048))
+	}
+	// A missing cache was empty before the install.
+	if sizeErr == nil || errors.Is(sizeErr, fs.ErrNotExist) {
+		if cacheAfter, _, err := cachestats.Measure(p.cacheDir, ""); err == nil {
+			downloaded := max(cacheAfter-cacheBefore, 0)
+			o.bm.DependencyDownload(p.manager, downloaded)
+			buildreport.FromContext(ctx).SetDependencyDownload(downloaded)
+			log = log.With(zap.Int64("downloaded_bytes", downloaded))
+		}
+	}
+	log.Info("workspace bootstrapped", zap.String("package_manager", p.manager), zap.Duration("elapsed", elapsed))
+	return nil
+}
+
+// tail returns at most the last n bytes of out.
+func tail(out []byte, n int) []byte {
+	if len(out) > n {
+		return out[len(out)-n:]
+	}
+	return out
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,123 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+func TestPlanInstall(t *testing.T) {
+	base := config.Config{
+		Cache:     config.CacheConfig{Dir: "/var/cache/nx"},
+		Bootstrap: config.BootstrapConfig{PackageManager: "auto", FrozenLockfile: true},
+	}
+	tests := []struct {
+		name      string
+		files     []string
+		mutate    func(*config.BootstrapConfig)
+		untrusted bool
+		clean     bool
+		want      []string // manager, then args
+		wantEnv   []string
+	}{
+		{
+			name:  "npm lockfile",
+			files: []string{"package-lock.json"},
+			want:  []string{"npm", "ci", "--cache", "/var/cache/nx/packages/npm", "--no-audit", "--no-fund"},
+		},
+		{
+			name:  "no lockfile cannot be frozen",
+			files: nil,
+			want:  []string{"npm", "install", "--cache", "/var/cache/nx/packages/npm", "--no-audit", "--no-fund"},
+		},
+		{
+			name:      "pnpm offline untrusted",
+			files:     []string{"pnpm-lock.yaml", "package-lock.json"},
+			mutate:    func(b *config.BootstrapConfig) { b.Offline = true },
+			untrusted: true,
+			want:      []string{"pnpm", "install", "--store-dir", "/job/packages/pnpm", "--frozen-lockfile", "--offline", "--ignore-scripts"},
+		},
+		{
+			name:   "yarn classic with custom cache and args",
+			files:  []string{"yarn.lock"},
+			mutate: func(b *config.BootstrapConfig) { b.CacheDir, b.Args = "/cache", []string{"--prefer-offline"} },
+			want:   []string{"yarn", "install", "--non-interactive", "--cache-folder", "/cache/yarn", "--frozen-lockfile", "--prefer-offline"},
+		},
+		{
+			name:    "yarn berry",
+			files:   []string{"yarn.lock", ".yarnrc.yml"},
+			want:    []string{"yarn", "install", "--immutable"},
+			wantEnv: []string{"YARN_CACHE_FOLDER=/var/cache/nx/packages/yarn", "YARN_ENABLE_GLOBAL_CACHE=false"},
+		},
+		{
+			name:   "forced manager ignores other lockfiles",
+			files:  []string{"yarn.lock"},
+			mutate: func(b *config.BootstrapConfig) { b.PackageManager = "pnpm" },
+			want:   []string{"pnpm", "install", "--store-dir", "/var/cache/nx/packages/pnpm"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range append([]string{"package.json"}, tc.files...) {
+				if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := base
+			if tc.mutate != nil {
+				tc.mutate(&cfg.Bootstrap)
+			}
+			p := planInstall(cfg, dir, tc.untrusted, tc.clean, "/job/packages")
+			if got := append([]string{p.manager}, p.args...); !slices.Equal(got, tc.want) {
+				t.Errorf("plan = %v, want %v", got, tc.want)
+			}
+			if !slices.Equal(p.env, tc.wantEnv) {
+				t.Errorf("env = %v, want %v", p.env, tc.wantEnv)
+			}
+		})
+	}
+}
+
+func TestPlanInstallWithoutPackageJSON(t *testing.T) {
+	if p := planInstall(config.Config{}, t.TempDir(), false, false, ""); p != nil {
+		t.Errorf("plan = %+v, want nil", p)
+	}
+}
+
+func TestPlanInstallPrivateCache(t *testing.T) {
+	for _, files := range [][]string{
+		{"package-lock.json"},
+		{"pnpm-lock.yaml"},
+		{"yarn.lock"},
+		{"yarn.lock", ".yarnrc.yml"},
+	} {
+		for _, shared := range []string{"", "/cache"} {
+			dir := t.TempDir()
+			for _, f := range append([]string{"package.json"}, files...) {
+				if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := config.Config{
+				Cache:     config.CacheConfig{Dir: "/var/cache/nx"},
+				Bootstrap: config.BootstrapConfig{PackageManager: "auto", CacheDir: shared},
+			}
+			for _, untrusted := range []bool{true, false} {
+				p := planInstall(cfg, dir, untrusted, !untrusted, "/job/packages")
+				if !strings.HasPrefix(p.cacheDir, "/job/packages/") {
+					t.Errorf("%v untrusted=%v: cache dir = %q, want under /job/packages", files, untrusted, p.cacheDir)
+				}
+				for _, arg := range append(p.args, p.env...) {
+					if strings.Contains(arg, "/var/cache/nx") || strings.Contains(arg, "/cache/") {
+						t.Errorf("%v untrusted=%v: plan uses the shared cache: %q", files, untrusted, arg)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package orchestrator
+
+import (
+	"maps"
+	"strings"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/buildenv"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+)
+
+// buildEnv renders the worker's build_env merged with the repository's
+// build.env for one project build.
+func (o *Orchestrator) buildEnv(job natspkg.BuildJob, repoCfg RepoConfig, jobID, project, version string) (map[string]string, error) {
+	env := maps.Clone(o.cfg.Worker.BuildEnv)
+	if env == nil {
+		env = make(map[string]string)
+	}
+	maps.Copy(env, repoCfg.Build.Env)
+	if len(env) == 0 {
+		return nil, nil
+	}
+	tmpl, err := buildenv.Parse(env)
+	if err != nil {
+		return nil, err
+	}
+
+	fullName := githubpkg.RepoFullName(job.RepoURL)
+	owner, name, _ := strings.Cut(fullName, "/")
+	return tmpl.Render(buildenv.Data{
+		Branch:      job.Branch,
+		CommitHash:  job.SHA,
+		Project:     project,
+		Version:     version,
+		JobID:       jobID,
+		BuildNumber: job.BuildNumber,
+		Repository:  buildenv.Repository{Owner: owner, Name: name, FullName: fullName},
+	})
+}
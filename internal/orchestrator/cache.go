@@ -0,0 +1,138 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/cachelock"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/detection"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/jorgerua/build-system/container-build-service/internal/resultcache"
+	"github.com/jorgerua/build-system/container-build-service/internal/templates"
+	"go.uber.org/zap"
+)
+
+// resultCacheVersion is part of every result cache key; bump it when the
+// shape or meaning of a cached result changes.
+const resultCacheVersion = "v1"
+
+// openResultCache opens the worker-local result cache, or returns nil (an
+// always-empty cache) when it is disabled or unusable.
+func openResultCache(cfg config.CacheConfig, logger *zap.Logger) *resultcache.Cache {
+	if cfg.ResultDir == "" {
+		return nil
+	}
+	c, err := resultcache.Open(cfg.ResultDir, cfg.ResultMaxEntries)
+	if err != nil {
+		logger.Warn("result cache disabled", zap.String("dir", cfg.ResultDir), zap.Error(err))
+		return nil
+	}
+	return c
+}
+
+// ResultCacheStats returns the result cache's lookups and evictions since
+// the previous call; see package cachestats.
+func (o *Orchestrator) ResultCacheStats() resultcache.Stats {
+	return o.results.TakeStats()
+}
+
+// cachedAffectedProjects returns the nx affected projects for base..head.
+// Commits are immutable, so the result is cached per range: redelivered and
+// retried jobs skip recomputing the project graph, and bootstrapping the
+// workspace for it. Clean builds neither read the result cache nor use the
+// Nx cache, but still store their result.
+//
+// Untrusted jobs build every app: installing packages and running nx
+// would run the fork's code on the worker, next to its credentials.
+func (o *Orchestrator) cachedAffectedProjects(ctx context.Context, log *zap.Logger, job natspkg.BuildJob, repoDir, baseSHA string) ([]string, error) {
+	if job.Untrusted() {
+		log.Info("untrusted job, building every app without nx")
+		return allApps(repoDir)
+	}
+	headSHA, clean := job.SHA, job.Clean
+	key := fmt.Sprintf("%s:affected:%s..%s", resultCacheVersion, baseSHA, headSHA)
+	var projects []string
+	if !clean && o.results.Get(key, &projects) {
+		log.Info("nx affected result cache hit")
+		return projects, nil
+	}
+
+	if err := o.bootstrap(ctx, log, repoDir, job.Untrusted(), clean); err != nil {
+		return nil, err
+	}
+	err := o.withCacheLock(ctx, log, func() error {
+		var err error
+		projects, err = affectedProjects(ctx, repoDir, baseSHA, headSHA, clean)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := o.results.Put(key, projects); err != nil {
+		log.Warn("store nx affected result failed", zap.Error(err))
+	}
+	return projects, nil
+}
+
+// cacheIsShared resolves the cache.shared setting. In "auto" mode the Nx
+// cache directory is probed for a network filesystem (RWX PVC).
+func cacheIsShared(cfg config.CacheConfig, logger *zap.Logger) bool {
+	switch cfg.Shared {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	shared, err := cachelock.IsShared(cfg.Dir)
+	if err != nil {
+		logger.Warn("cache filesystem detection failed, assuming local", zap.String("dir", cfg.Dir), zap.Error(err))
+		return false
+	}
+	logger.Info("cache filesystem detected", zap.String("dir", cfg.Dir), zap.Bool("shared", shared))
+	return shared
+}
+
+// withCacheLock runs fn while holding the cross-worker Nx cache lock.
+// When the cache is not shared, fn runs without locking.
+func (o *Orchestrator) withCacheLock(ctx context.Context, log *zap.Logger, fn func() error) error {
+	if !o.cacheShared {
+		return fn()
+	}
+
+	stale := time.Duration(o.cfg.Cache.LockStaleSeconds) * time.Second
+	start := time.Now()
+	lock, err := cachelock.Acquire(ctx, o.cfg.Cache.Dir, "nx", stale)
+	if err != nil {
+		return fmt.Errorf("acquire cache lock: %w", err)
+	}
+	defer func() {
+		if err := lock.Release(); err != nil {
+			log.Warn("release cache lock failed", zap.Error(err))
+		}
+	}()
+	log.Debug("cache lock acquired", zap.Duration("wait", time.Since(start)))
+
+	return fn()
+}
+
+// buildCaches returns the cache mounts of a build step: buildTool's
+// dependency caches, shared by the repositories built with it, and the
+// caches the repository declares, its own. Untrusted and clean builds get
+// none, so they can neither poison nor read the shared caches.
+func (o *Orchestrator) buildCaches(job natspkg.BuildJob, repoCfg RepoConfig, buildTool detection.BuildTool) []templates.Cache {
+	if job.Untrusted() || job.Clean {
+		return nil
+	}
+	caches := templates.LanguageCaches(buildTool, o.cfg.Buildah.CachePaths)
+	if buildTool == detection.BuildToolDotNet && o.cfg.DotNet.Workloads {
+		caches = append(caches, templates.DotNetWorkloadsCache)
+	}
+	repo := githubpkg.RepoFullName(job.RepoURL)
+	for _, c := range repoCfg.Build.Caches {
+		caches = append(caches, templates.Cache{ID: repo + "/" + c.ID, Target: c.Path, Env: c.Env})
+	}
+	return caches
+}
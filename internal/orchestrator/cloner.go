@@ -3,35 +3,174 @@ package orchestrator
 import (
 	"context"
 	"fmt"
-	"os/exec"
+	"os"
+	"regexp"
 	"strings"
+	"time"
 
+	"github.com/jorgerua/build-system/container-build-service/internal/buildreport"
 	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/jorgerua/build-system/container-build-service/internal/procgroup"
+	"go.uber.org/zap"
 )
 
-// cloneRepo generates a fresh installation token and clones the repository
-// to /tmp/repo-<jobID>, checking out the given SHA.
-// Returns the local repo path.
-func cloneRepo(ctx context.Context, gh *githubpkg.Client, repoURL string, installationID int64, sha, jobID string) (string, error) {
-	token, err := gh.GenerateInstallationToken(ctx, installationID)
-	if err != nil {
-		return "", fmt.Errorf("generate installation token: %w", err)
+// remoteURL generates a fresh installation token and returns the job's
+// fetch URL carrying it. Untrusted jobs fetch their CloneURL anonymously so
+// fork code never sees the installation token.
+func (o *Orchestrator) remoteURL(ctx context.Context, job natspkg.BuildJob) (string, error) {
+	authedURL := job.CloneURL
+	if authedURL == "" {
+		authedURL = job.RepoURL
+	}
+	if !job.Untrusted() {
+		token, err := o.gh.GenerateInstallationToken(ctx, job.InstallationID)
+		if err != nil {
+			return "", fmt.Errorf("generate installation token: %w", err)
+		}
+		// Inject token into clone URL: https://x-access-token:<token>@github.com/...
+		authedURL = injectToken(authedURL, token)
+	}
+	return authedURL, nil
+}
+
+// ErrRepoUnreachable is returned when a job's repository does not answer
+// git ls-remote. Retrying the clone would only burn worker time.
+type ErrRepoUnreachable struct {
+	Repo   string
+	Reason string
+}
+
+func (e *ErrRepoUnreachable) Error() string {
+	return fmt.Sprintf("repository %s unreachable: %s", e.Repo, e.Reason)
+}
+
+// reachability is the outcome of probeRemote.
+type reachability struct {
+	url string // authenticated fetch URL
+	err error
+}
+
+// probeRemote resolves the job's fetch URL and checks in the background
+// that the repository answers git ls-remote within
+// worker.reachability_timeout_seconds, so an unreachable repository fails
+// the job before it takes a workspace. A timeout of 0 skips the check.
+func (o *Orchestrator) probeRemote(ctx context.Context, job natspkg.BuildJob) <-chan reachability {
+	ch := make(chan reachability, 1)
+	go func() {
+		url, err := o.remoteURL(ctx, job)
+		if err == nil {
+			timeout := time.Duration(o.cfg.Worker.ReachabilityTimeoutSeconds) * time.Second
+			err = checkReachable(ctx, githubpkg.RepoFullName(job.RepoURL), url, timeout)
+		}
+		ch <- reachability{url: url, err: err}
+	}()
+	return ch
+}
+
+// checkReachable runs git ls-remote against url, returning
+// *ErrRepoUnreachable when it fails or does not answer within timeout.
+// Cancellation of ctx is returned as is.
+func checkReachable(ctx context.Context, repo, url string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := procgroup.Command(probeCtx, "git", "ls-remote", "--exit-code", url, "HEAD")
+	// Fail instead of prompting when the remote asks for credentials.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.CombinedOutput()
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case probeCtx.Err() != nil:
+		return &ErrRepoUnreachable{Repo: repo, Reason: fmt.Sprintf("no answer to git ls-remote within %s", timeout)}
 	}
+	reason := strings.TrimSpace(string(out))
+	if reason == "" {
+		reason = err.Error()
+	}
+	return &ErrRepoUnreachable{Repo: repo, Reason: urlCredentials.ReplaceAllString(reason, "://***@")}
+}
 
-	// Inject token into clone URL: https://x-access-token:<token>@github.com/...
-	authedURL := injectToken(repoURL, token)
+// urlCredentials matches credentials embedded in a URL.
+var urlCredentials = regexp.MustCompile(`://[^/@\s]+@`)
 
-	repoDir := fmt.Sprintf("/tmp/repo-%s", jobID)
+// cloneRepo clones the repository from authedURL (see remoteURL) to
+// repoDir, checking out the job's SHA. A commit that is not yet fetchable is
+// retried for up to the configured fetch window.
+func (o *Orchestrator) cloneRepo(ctx context.Context, log *zap.Logger, job natspkg.BuildJob, authedURL, repoDir string) error {
 
-	if out, err := runGit(ctx, "clone", "--no-tags", authedURL, repoDir); err != nil {
-		return "", fmt.Errorf("git clone: %w\n%s", err, out)
+	// Trusted jobs materialize from the worker's mirror of the repository;
+	// fork code is cloned directly so it never lands in the mirror.
+	mirrored := false
+	if dir := o.cfg.Worker.GitMirrorDir; dir != "" && !job.Untrusted() {
+		start := time.Now()
+		if err := cloneFromMirror(ctx, mirrorPath(dir, job.RepoURL), authedURL, repoDir); err != nil {
+			log.Warn("mirror clone failed, cloning directly", zap.Error(err))
+			_ = os.RemoveAll(repoDir)
+		} else {
+			mirrored = true
+			log.Info("workspace materialized from mirror", zap.Duration("elapsed", time.Since(start)))
+		}
+	}
+	if !mirrored {
+		if out, err := runGit(ctx, "clone", "--no-tags", authedURL, repoDir); err != nil {
+			return fmt.Errorf("git clone: %w\n%s", err, out)
+		}
 	}
 
-	if out, err := runGitDir(ctx, repoDir, "checkout", sha); err != nil {
-		return "", fmt.Errorf("git checkout %s: %w\n%s", sha, err, out)
+	window := time.Duration(o.cfg.Worker.CommitFetchWindowSeconds) * time.Second
+	if err := checkoutCommit(ctx, repoDir, job.SHA, window, commitPollInterval); err != nil {
+		return err
 	}
 
-	return repoDir, nil
+	return nil
+}
+
+// commitPollInterval is the delay between fetch-by-SHA attempts.
+const commitPollInterval = 5 * time.Second
+
+// ErrCommitNotFound is returned when the pushed commit is still not
+// fetchable from the remote after the poll window.
+type ErrCommitNotFound struct {
+	SHA string
+}
+
+func (e *ErrCommitNotFound) Error() string {
+	return fmt.Sprintf("commit %s not found on remote", e.SHA)
+}
+
+// checkoutCommit checks out sha in repoDir. A webhook can arrive before the
+// commit is reachable from a branch the clone fetched (replication lag, force
+// pushes, forks), so a missing commit is fetched by SHA, polling until window
+// elapses.
+func checkoutCommit(ctx context.Context, repoDir, sha string, window, interval time.Duration) error {
+	deadline := time.Now().Add(window)
+	for {
+		if _, err := runGitDir(ctx, repoDir, "cat-file", "-e", sha+"^{commit}"); err == nil {
+			break
+		}
+		if _, err := runGitDir(ctx, repoDir, "fetch", "--no-tags", "origin", sha); err == nil {
+			break
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return &ErrCommitNotFound{SHA: sha}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+
+	if out, err := runGitDir(ctx, repoDir, "checkout", "-q", sha); err != nil {
+		return fmt.Errorf("git checkout %s: %w\n%s", sha, err, out)
+	}
+	return nil
 }
 
 // initialCommitSHA returns the first commit SHA of the repository using the local clone.
@@ -57,14 +196,15 @@ func injectToken(repoURL, token string) string {
 }
 
 func runGit(ctx context.Context, args ...string) (string, error) {
-	cmd := exec.CommandContext(ctx, "git", args...)
-	out, err := cmd.CombinedOutput()
-	return string(out), err
+	return runGitDir(ctx, "", args...)
 }
 
 func runGitDir(ctx context.Context, dir string, args ...string) (string, error) {
-	cmd := exec.CommandContext(ctx, "git", args...)
+	start := time.Now()
+	cmd := procgroup.Command(ctx, "git", args...)
 	cmd.Dir = dir
 	out, err := cmd.CombinedOutput()
+	procgroup.Track(ctx, cmd)
+	buildreport.RecordCommand(ctx, "git", args, start, err)
 	return string(out), err
 }
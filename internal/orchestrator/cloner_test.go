@@ -0,0 +1,76 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckoutCommitFetchesBySHA(t *testing.T) {
+	origin, _ := initTestRepo(t, "feat: first")
+	ctx := context.Background()
+
+	clone := t.TempDir()
+	if out, err := runGit(ctx, "clone", "-q", origin, clone); err != nil {
+		t.Fatalf("clone: %v\n%s", err, out)
+	}
+
+	// A commit made after the clone, reachable only by SHA.
+	if out, err := runGitDir(ctx, origin, "-c", "user.name=Dev", "-c", "user.email=dev@example.com",
+		"commit", "-q", "--allow-empty", "-m", "feat: second"); err != nil {
+		t.Fatalf("commit: %v\n%s", err, out)
+	}
+	out, err := runGitDir(ctx, origin, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha := strings.TrimSpace(out)
+
+	if err := checkoutCommit(ctx, clone, sha, time.Second, 10*time.Millisecond); err != nil {
+		t.Fatalf("checkoutCommit: %v", err)
+	}
+	head, _ := runGitDir(ctx, clone, "rev-parse", "HEAD")
+	if strings.TrimSpace(head) != sha {
+		t.Errorf("HEAD = %s, want %s", head, sha)
+	}
+}
+
+func TestCheckoutCommitNotFound(t *testing.T) {
+	dir, _ := initTestRepo(t, "feat: first")
+	missing := strings.Repeat("b", 40)
+
+	if out, err := runGitDir(context.Background(), dir, "remote", "add", "origin", dir); err != nil {
+		t.Fatalf("remote add: %v\n%s", err, out)
+	}
+	err := checkoutCommit(context.Background(), dir, missing, 50*time.Millisecond, 10*time.Millisecond)
+	var notFound *ErrCommitNotFound
+	if !errors.As(err, &notFound) || notFound.SHA != missing {
+		t.Fatalf("err = %v, want ErrCommitNotFound", err)
+	}
+}
+
+func TestCheckReachable(t *testing.T) {
+	dir, _ := initTestRepo(t, "feat: first")
+	ctx := context.Background()
+
+	if err := checkReachable(ctx, "acme/shop", dir, 10*time.Second); err != nil {
+		t.Fatalf("reachable repo: %v", err)
+	}
+	if err := checkReachable(ctx, "acme/shop", "/nonexistent/repo", 0); err != nil {
+		t.Fatalf("disabled probe: %v", err)
+	}
+
+	err := checkReachable(ctx, "acme/gone", t.TempDir()+"/missing", 10*time.Second)
+	var unreachable *ErrRepoUnreachable
+	if !errors.As(err, &unreachable) || unreachable.Repo != "acme/gone" {
+		t.Fatalf("err = %v, want ErrRepoUnreachable", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := checkReachable(cancelled, "acme/shop", dir, 10*time.Second); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled probe err = %v, want context.Canceled", err)
+	}
+}
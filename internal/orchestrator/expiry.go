@@ -0,0 +1,19 @@
+package orchestrator
+
+import (
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/clock"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+)
+
+// expired reports whether job was queued longer than worker.job_ttl_hours,
+// and how long ago it was queued.
+func (o *Orchestrator) expired(job natspkg.BuildJob) (time.Duration, bool) {
+	ttl := time.Duration(o.cfg.Worker.JobTTLHours) * time.Hour
+	if ttl <= 0 || job.PublishedAt.IsZero() {
+		return 0, false
+	}
+	age := clock.Since(o.clock, job.PublishedAt)
+	return age, age > ttl
+}
@@ -0,0 +1,33 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/clock"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+)
+
+func TestExpired(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	cfg := &config.Config{}
+	cfg.Worker.JobTTLHours = 72
+	o := &Orchestrator{cfg: cfg, clock: clk}
+
+	job := natspkg.BuildJob{PublishedAt: clk.Now().Add(-71 * time.Hour)}
+	if _, ok := o.expired(job); ok {
+		t.Error("job within its TTL expired")
+	}
+	clk.Advance(2 * time.Hour)
+	if age, ok := o.expired(job); !ok || age != 73*time.Hour {
+		t.Errorf("expired = %s, %v; want 73h, true", age, ok)
+	}
+	if _, ok := o.expired(natspkg.BuildJob{}); ok {
+		t.Error("job without a publish time expired")
+	}
+	cfg.Worker.JobTTLHours = 0
+	if _, ok := o.expired(job); ok {
+		t.Error("job expired with expiry disabled")
+	}
+}
@@ -0,0 +1,50 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	buildahpkg "github.com/jorgerua/build-system/container-build-service/internal/buildah"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+// ErrTagExists is returned when a push would overwrite an existing immutable
+// tag. Retrying cannot succeed, so the build fails without further attempts.
+type ErrTagExists struct {
+	ImageRef string
+}
+
+func (e *ErrTagExists) Error() string {
+	return fmt.Sprintf("tag %s already exists in the registry and is immutable", e.ImageRef)
+}
+
+// tagIsMutable reports whether tag matches one of the allowed mutable tag patterns.
+func tagIsMutable(cfg config.RegistryConfig, tag string) bool {
+	for _, pattern := range cfg.MutableTags {
+		if ok, _ := path.Match(pattern, tag); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTagImmutable refuses imageRef when tag immutability is enforced, for
+// every job or those on a protected branch, the tag is not allowed to move,
+// and it already exists in the registry.
+func (o *Orchestrator) checkTagImmutable(ctx context.Context, imageRef string, protected bool) error {
+	if !o.cfg.Registry.ImmutableTags && !(protected && o.cfg.Registry.ProtectedImmutableTags) {
+		return nil
+	}
+	if _, tag := buildahpkg.SplitTag(imageRef); tagIsMutable(o.cfg.Registry, tag) {
+		return nil
+	}
+	exists, err := o.builder.TagExists(ctx, imageRef)
+	if err != nil {
+		return fmt.Errorf("check tag: %w", err)
+	}
+	if exists {
+		return &ErrTagExists{ImageRef: imageRef}
+	}
+	return nil
+}
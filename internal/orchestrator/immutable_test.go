@@ -0,0 +1,22 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+func TestTagIsMutable(t *testing.T) {
+	cfg := config.RegistryConfig{MutableTags: []string{"latest", "main-*"}}
+	tests := map[string]bool{
+		"latest":      true,
+		"main-abc123": true,
+		"1.2.3":       false,
+		"":            false,
+	}
+	for tag, want := range tests {
+		if got := tagIsMutable(cfg, tag); got != want {
+			t.Errorf("tagIsMutable(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
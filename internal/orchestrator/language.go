@@ -0,0 +1,38 @@
+package orchestrator
+
+import (
+	"github.com/jorgerua/build-system/container-build-service/internal/detection"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+)
+
+// Sources of a project's language, as recorded in the build report.
+const (
+	languageFromRepoConfig = "ocibuild.yaml"
+	languageFromRegistry   = "registry"
+	languageDetected       = "detected"
+)
+
+// projectLanguage returns the language of project, at projectDir, and
+// where it came from. A language pinned for the project wins over one
+// pinned for the whole repository, and .ocibuild.yaml over the registry;
+// without a pin the language is detected.
+func projectLanguage(job natspkg.BuildJob, repoCfg RepoConfig, projectDir, project string) (detection.Result, string, error) {
+	var registry natspkg.Languages
+	if job.Languages != nil {
+		registry = *job.Languages
+	}
+	candidates := []struct{ name, source string }{
+		{repoCfg.Build.Languages[project], languageFromRepoConfig},
+		{registry.Projects[project], languageFromRegistry},
+		{repoCfg.Build.Language, languageFromRepoConfig},
+		{registry.Default, languageFromRegistry},
+	}
+	for _, c := range candidates {
+		if c.name != "" {
+			r, err := detection.Pin(projectDir, c.name)
+			return r, c.source, err
+		}
+	}
+	r, err := detection.Detect(projectDir)
+	return r, languageDetected, err
+}
@@ -0,0 +1,57 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/detection"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+)
+
+func TestProjectLanguage(t *testing.T) {
+	dir := t.TempDir()
+	// A mixed project: go.mod from tooling next to the Maven build.
+	for _, f := range []string{"go.mod", "pom.xml"} {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry := &natspkg.Languages{Default: "dotnet", Projects: map[string]string{"api": "gradle"}}
+	file := RepoConfig{Build: RepoBuildConfig{Language: "go", Languages: map[string]string{"api": "java"}}}
+
+	for _, c := range []struct {
+		name      string
+		languages *natspkg.Languages
+		cfg       RepoConfig
+		project   string
+		tool      detection.BuildTool
+		source    string
+	}{
+		{"detected", nil, RepoConfig{}, "api", detection.BuildToolGo, languageDetected},
+		{"registry default", registry, RepoConfig{}, "web", detection.BuildToolDotNet, languageFromRegistry},
+		{"registry project", registry, RepoConfig{}, "api", detection.BuildToolGradle, languageFromRegistry},
+		{"file default over registry", registry, RepoConfig{Build: RepoBuildConfig{Language: "go"}}, "web", detection.BuildToolGo, languageFromRepoConfig},
+		{"registry project over file default", registry, RepoConfig{Build: RepoBuildConfig{Language: "go"}}, "api", detection.BuildToolGradle, languageFromRegistry},
+		{"file project", registry, file, "api", detection.BuildToolMaven, languageFromRepoConfig},
+	} {
+		r, source, err := projectLanguage(natspkg.BuildJob{Languages: c.languages}, c.cfg, dir, c.project)
+		if err != nil || r.BuildTool != c.tool || source != c.source {
+			t.Errorf("%s: %s from %s, %v; want %s from %s", c.name, r.BuildTool, source, err, c.tool, c.source)
+		}
+	}
+
+	pinned := RepoConfig{Build: RepoBuildConfig{Language: "java"}}
+	var unknown *detection.ErrUnknownLanguage
+	_, _, err := projectLanguage(natspkg.BuildJob{}, pinned, t.TempDir(), "api")
+	if !errors.As(err, &unknown) {
+		t.Errorf("java without build files: err = %v, want ErrUnknownLanguage", err)
+	}
+	// The pipeline wraps it; the project is skipped, never failed.
+	err = fmt.Errorf("language detection (%s): %w", languageFromRepoConfig, err)
+	if !unknownLanguage(err) || isPermanent(err) {
+		t.Errorf("unknownLanguage(%v) = %v, isPermanent = %v; want a skip", err, unknownLanguage(err), isPermanent(err))
+	}
+}
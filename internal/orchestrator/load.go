@@ -0,0 +1,51 @@
+package orchestrator
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// waitEWMAAlpha weights the most recent queue wait in the moving average.
+const waitEWMAAlpha = 0.2
+
+// loadTracker counts running jobs and project builds and keeps an
+// exponentially weighted moving average of job queue wait, for autoscaling
+// signals.
+type loadTracker struct {
+	running atomic.Int64
+	jobs    atomic.Int64
+
+	mu      sync.Mutex
+	avgWait time.Duration
+}
+
+func (l *loadTracker) buildStarted()  { l.running.Add(1) }
+func (l *loadTracker) buildFinished() { l.running.Add(-1) }
+func (l *loadTracker) jobStarted()    { l.jobs.Add(1) }
+func (l *loadTracker) jobFinished()   { l.jobs.Add(-1) }
+
+func (l *loadTracker) observeWait(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.avgWait == 0 {
+		l.avgWait = d
+		return
+	}
+	l.avgWait = time.Duration(waitEWMAAlpha*float64(d) + (1-waitEWMAAlpha)*float64(l.avgWait))
+}
+
+// Load reports the number of project builds currently running on this
+// worker, the configured build capacity, and the average queue wait.
+func (o *Orchestrator) Load() (running, capacity int, avgWait time.Duration) {
+	o.load.mu.Lock()
+	avgWait = o.load.avgWait
+	o.load.mu.Unlock()
+	return int(o.load.running.Load()), o.cfg.Worker.Concurrency, avgWait
+}
+
+// RunningJobs reports the number of jobs this worker is handling, from
+// receipt to ack, whether or not they are building yet.
+func (o *Orchestrator) RunningJobs() int {
+	return int(o.load.jobs.Load())
+}
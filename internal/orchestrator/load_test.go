@@ -0,0 +1,42 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+func TestLoad(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Worker.Concurrency = 4
+	o := &Orchestrator{cfg: cfg}
+
+	o.load.jobStarted()
+	o.load.buildStarted()
+	o.load.buildStarted()
+	o.load.buildFinished()
+	if running, capacity, _ := o.Load(); running != 1 || capacity != 4 {
+		t.Errorf("Load = %d, %d; want 1, 4", running, capacity)
+	}
+	if n := o.RunningJobs(); n != 1 {
+		t.Errorf("RunningJobs = %d, want 1", n)
+	}
+	o.load.jobFinished()
+	if n := o.RunningJobs(); n != 0 {
+		t.Errorf("RunningJobs = %d, want 0", n)
+	}
+}
+
+func TestObserveWait(t *testing.T) {
+	var l loadTracker
+	l.observeWait(10 * time.Second)
+	if l.avgWait != 10*time.Second {
+		t.Errorf("first wait = %s, want 10s", l.avgWait)
+	}
+	// 0.2*20s + 0.8*10s
+	l.observeWait(20 * time.Second)
+	if l.avgWait != 12*time.Second {
+		t.Errorf("average = %s, want 12s", l.avgWait)
+	}
+}
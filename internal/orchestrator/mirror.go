@@ -0,0 +1,59 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/cachelock"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+)
+
+// mirrorLockStale bounds how long a crashed worker's mirror lock is honoured.
+const mirrorLockStale = 10 * time.Minute
+
+// mirrorPath returns the bare mirror directory of repoURL under dir.
+func mirrorPath(dir, repoURL string) string {
+	name := githubpkg.RepoFullName(repoURL)
+	if name == repoURL {
+		sum := sha256.Sum256([]byte(repoURL))
+		name = hex.EncodeToString(sum[:8])
+	}
+	return filepath.Join(dir, filepath.FromSlash(name)+".git")
+}
+
+// cloneFromMirror brings the mirror up to date from fetchURL and clones it
+// into repoDir with --local, which hardlinks the object store instead of
+// copying it (git copies when the two are on different filesystems). The
+// workspace's origin is then pointed at fetchURL so later fetches by SHA go
+// to the remote. fetchURL is never stored in the mirror.
+func cloneFromMirror(ctx context.Context, mirror, fetchURL, repoDir string) error {
+	if err := os.MkdirAll(filepath.Dir(mirror), 0o755); err != nil {
+		return fmt.Errorf("create mirror dir: %w", err)
+	}
+	lock, err := cachelock.Acquire(ctx, filepath.Dir(mirror), filepath.Base(mirror), mirrorLockStale)
+	if err != nil {
+		return fmt.Errorf("lock mirror: %w", err)
+	}
+	defer lock.Release()
+
+	if !dirExists(mirror) {
+		if out, err := runGit(ctx, "init", "-q", "--bare", mirror); err != nil {
+			return fmt.Errorf("git init mirror: %w\n%s", err, out)
+		}
+	}
+	if out, err := runGitDir(ctx, mirror, "fetch", "-q", "--prune", "--no-tags", fetchURL, "+refs/heads/*:refs/heads/*"); err != nil {
+		return fmt.Errorf("git fetch mirror: %w\n%s", err, out)
+	}
+	if out, err := runGit(ctx, "clone", "-q", "--local", "--no-checkout", mirror, repoDir); err != nil {
+		return fmt.Errorf("git clone from mirror: %w\n%s", err, out)
+	}
+	if out, err := runGitDir(ctx, repoDir, "remote", "set-url", "origin", fetchURL); err != nil {
+		return fmt.Errorf("git remote set-url: %w\n%s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package orchestrator
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMirrorPath(t *testing.T) {
+	got := mirrorPath("/cache", "https://github.com/acme/shop.git")
+	if want := filepath.Join("/cache", "acme", "shop.git"); got != want {
+		t.Errorf("mirrorPath = %q, want %q", got, want)
+	}
+	if got := mirrorPath("/cache", "local"); filepath.Dir(got) != "/cache" || !strings.HasSuffix(got, ".git") {
+		t.Errorf("mirrorPath(unparseable) = %q", got)
+	}
+}
+
+func TestCloneFromMirror(t *testing.T) {
+	origin, first := initTestRepo(t, "feat: first")
+	ctx := context.Background()
+	mirror := filepath.Join(t.TempDir(), "acme", "shop.git")
+
+	ws1 := filepath.Join(t.TempDir(), "ws")
+	if err := cloneFromMirror(ctx, mirror, origin, ws1); err != nil {
+		t.Fatalf("first clone: %v", err)
+	}
+	if _, err := runGitDir(ctx, ws1, "cat-file", "-e", first+"^{commit}"); err != nil {
+		t.Errorf("first commit missing from workspace: %v", err)
+	}
+	if url, _ := runGitDir(ctx, ws1, "remote", "get-url", "origin"); strings.TrimSpace(url) != origin {
+		t.Errorf("origin = %q, want %q", url, origin)
+	}
+
+	// A later commit reaches new workspaces through the mirror update.
+	if out, err := runGitDir(ctx, origin, "-c", "user.name=Dev", "-c", "user.email=dev@example.com",
+		"commit", "-q", "--allow-empty", "-m", "feat: second"); err != nil {
+		t.Fatalf("commit: %v\n%s", err, out)
+	}
+	out, _ := runGitDir(ctx, origin, "rev-parse", "HEAD")
+	second := strings.TrimSpace(out)
+
+	ws2 := filepath.Join(t.TempDir(), "ws")
+	if err := cloneFromMirror(ctx, mirror, origin, ws2); err != nil {
+		t.Fatalf("second clone: %v", err)
+	}
+	if _, err := runGitDir(ctx, ws2, "cat-file", "-e", second+"^{commit}"); err != nil {
+		t.Errorf("second commit missing from workspace: %v", err)
+	}
+}
@@ -2,23 +2,37 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/buildreport"
+	"github.com/jorgerua/build-system/container-build-service/internal/procgroup"
 )
 
 // affectedProjects runs `nx affected` and returns projects under apps/.
-func affectedProjects(ctx context.Context, repoDir, baseSHA, headSHA string) ([]string, error) {
-	cmd := exec.CommandContext(ctx, "nx", "affected",
-		"--base="+baseSHA,
-		"--head="+headSHA,
+// skipCache bypasses the Nx computation cache.
+func affectedProjects(ctx context.Context, repoDir, baseSHA, headSHA string, skipCache bool) ([]string, error) {
+	args := []string{
+		"affected",
+		"--base=" + baseSHA,
+		"--head=" + headSHA,
 		"--plain",
-	)
+	}
+	if skipCache {
+		args = append(args, "--skip-nx-cache")
+	}
+	cmd := procgroup.Command(ctx, "nx", args...)
 	cmd.Dir = repoDir
 
+	start := time.Now()
 	out, err := cmd.Output()
+	procgroup.Track(ctx, cmd)
+	buildreport.RecordCommand(ctx, "nx", args, start, err)
 	if err != nil {
 		return nil, fmt.Errorf("nx affected: %w", err)
 	}
@@ -39,6 +53,25 @@ func affectedProjects(ctx context.Context, repoDir, baseSHA, headSHA string) ([]
 	return projects, nil
 }
 
+// allApps returns every project under apps/, for jobs that build without
+// nx.
+func allApps(repoDir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(repoDir, "apps"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list apps: %w", err)
+	}
+	var projects []string
+	for _, e := range entries {
+		if e.IsDir() {
+			projects = append(projects, e.Name())
+		}
+	}
+	return projects, nil
+}
+
 func dirExists(path string) bool {
 	info, err := os.Stat(path)
 	return err == nil && info.IsDir()
@@ -0,0 +1,30 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestAllApps(t *testing.T) {
+	dir := t.TempDir()
+	if projects, err := allApps(dir); err != nil || projects != nil {
+		t.Errorf("allApps without apps/ = %v, %v; want nil, nil", projects, err)
+	}
+	for _, app := range []string{"web", "api"} {
+		if err := os.MkdirAll(filepath.Join(dir, "apps", app), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "apps", "README.md"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	projects, err := allApps(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"api", "web"}; !slices.Equal(projects, want) {
+		t.Errorf("allApps = %v, want %v", projects, want)
+	}
+}
@@ -2,26 +2,52 @@ package orchestrator
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
+	"maps"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	buildahpkg "github.com/jorgerua/build-system/container-build-service/internal/buildah"
+	"github.com/jorgerua/build-system/container-build-service/internal/buildreport"
+	"github.com/jorgerua/build-system/container-build-service/internal/buildwarn"
+	"github.com/jorgerua/build-system/container-build-service/internal/clock"
 	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/cost"
 	"github.com/jorgerua/build-system/container-build-service/internal/detection"
+	"github.com/jorgerua/build-system/container-build-service/internal/diagnosis"
+	"github.com/jorgerua/build-system/container-build-service/internal/events"
 	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	"github.com/jorgerua/build-system/container-build-service/internal/hostinfo"
 	metricspkg "github.com/jorgerua/build-system/container-build-service/internal/metrics"
 	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/jorgerua/build-system/container-build-service/internal/procgroup"
+	"github.com/jorgerua/build-system/container-build-service/internal/resultcache"
 	"github.com/jorgerua/build-system/container-build-service/internal/semver"
 	"github.com/jorgerua/build-system/container-build-service/internal/templates"
 	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/toolchain"
 	"github.com/nats-io/nats.go/jetstream"
 	"go.uber.org/zap"
 )
 
+// flakinessWindow is the number of recent builds a branch's flakiness score
+// is computed over.
+const flakinessWindow = 20
+
+// durationBaselineWindow is the number of recent successful builds the p95
+// duration baseline is computed over; durationBaselineMinSamples is the
+// minimum history required before anomalies are reported.
+const (
+	durationBaselineWindow     = 50
+	durationBaselineMinSamples = 5
+)
+
 // Orchestrator processes build jobs from NATS.
 type Orchestrator struct {
 	cfg        *config.Config
@@ -30,9 +56,31 @@ type Orchestrator struct {
 	versions   *tidb.VersionRepository
 	buildState *tidb.BuildStateRepository
 	buildRec   *tidb.BuildRecordRepository
+	skips      *tidb.SkippedBuildRepository
+	orgConfigs *tidb.OrgBuildConfigRepository
 	subscriber *natspkg.Subscriber
+	events     *events.Bridge
 	bm         *metricspkg.BuildMetrics
+	classifier *diagnosis.Classifier
+	toolchains *toolchain.Manager
+	clock      clock.Clock
 	logger     *zap.Logger
+	host       hostinfo.Info
+
+	cacheShared bool
+	results     *resultcache.Cache
+	load        loadTracker
+	imageUses   baseImageUsage
+
+	toolsOnce sync.Once
+	tools     map[string]string
+
+	// Set by Run and Shutdown; running counts the jobs being handled.
+	mu            sync.Mutex
+	draining      bool
+	stopConsuming context.CancelFunc
+	stopJobs      context.CancelCauseFunc
+	running       sync.WaitGroup
 }
 
 // New creates an Orchestrator.
@@ -43,10 +91,20 @@ func New(
 	versions *tidb.VersionRepository,
 	buildState *tidb.BuildStateRepository,
 	buildRec *tidb.BuildRecordRepository,
+	skips *tidb.SkippedBuildRepository,
+	orgConfigs *tidb.OrgBuildConfigRepository,
 	subscriber *natspkg.Subscriber,
+	bridge *events.Bridge,
 	bm *metricspkg.BuildMetrics,
+	classifier *diagnosis.Classifier,
+	toolchains *toolchain.Manager,
+	clk clock.Clock,
 	logger *zap.Logger,
 ) *Orchestrator {
+	host, err := hostinfo.Collect()
+	if err != nil {
+		logger.Named("orchestrator").Warn("hostname lookup failed; build records will not name this worker", zap.Error(err))
+	}
 	return &Orchestrator{
 		cfg:        cfg,
 		gh:         gh,
@@ -54,47 +112,253 @@ func New(
 		versions:   versions,
 		buildState: buildState,
 		buildRec:   buildRec,
+		skips:      skips,
+		orgConfigs: orgConfigs,
 		subscriber: subscriber,
+		events:     bridge,
 		bm:         bm,
-		logger:     logger,
+		classifier: classifier,
+		toolchains: toolchains,
+		clock:      clk,
+		logger:     logger.Named("orchestrator"),
+		host:       host,
+
+		cacheShared: cacheIsShared(cfg.Cache, logger),
+		results:     openResultCache(cfg.Cache, logger),
 	}
 }
 
-// Run starts consuming build jobs until ctx is cancelled.
+// Run starts consuming build jobs until ctx is cancelled or Shutdown is
+// called. Jobs run in a context that only Shutdown cancels.
 func (o *Orchestrator) Run(ctx context.Context) error {
-	return o.subscriber.Subscribe(ctx, o.handleJob)
+	consumeCtx, stopConsuming := context.WithCancel(ctx)
+	defer stopConsuming()
+	// Not cancelled on return: handlers outlive Subscribe until Shutdown
+	// applies the shutdown policy to them.
+	jobsCtx, stopJobs := context.WithCancelCause(context.WithoutCancel(ctx))
+	o.mu.Lock()
+	if o.draining {
+		o.mu.Unlock()
+		stopJobs(nil)
+		return nil
+	}
+	o.stopConsuming, o.stopJobs = stopConsuming, stopJobs
+	o.mu.Unlock()
+
+	err := o.subscriber.Subscribe(consumeCtx, func(_ context.Context, msg jetstream.Msg, job natspkg.BuildJob) error {
+		o.mu.Lock()
+		if o.draining {
+			o.mu.Unlock()
+			return errRequeue
+		}
+		o.running.Add(1)
+		o.mu.Unlock()
+		defer o.running.Done()
+		o.load.jobStarted()
+		defer o.load.jobFinished()
+		return o.handleJob(jobsCtx, msg, job)
+	})
+	if consumeCtx.Err() != nil && ctx.Err() == nil {
+		return nil // stopped by Shutdown
+	}
+	return err
 }
 
 // handleJob is the NATS message handler. It processes a single build job.
 // Returning an error causes the message to be nacked (used only for clone failures).
-func (o *Orchestrator) handleJob(ctx context.Context, msg jetstream.Msg, job natspkg.BuildJob) error {
+func (o *Orchestrator) handleJob(ctx context.Context, msg jetstream.Msg, job natspkg.BuildJob) (jobErr error) {
 	log := o.logger.With(
 		zap.String("sha", job.SHA),
 		zap.String("repo", job.RepoURL),
 	)
+	if job.BuildNumber > 0 {
+		log = log.With(zap.Int64("build_number", job.BuildNumber))
+	}
+	if job.Untrusted() {
+		log = log.With(zap.String("trust", string(job.Trust)), zap.String("clone_url", job.CloneURL))
+		if pr := job.PullRequest; pr != nil {
+			log = log.With(zap.Int("pull_request", pr.Number))
+		}
+	}
 	log.Info("job received",
 		zap.Time("published_at", job.PublishedAt),
 		zap.Duration("queue_wait", time.Since(job.PublishedAt)),
 	)
+	if age, ok := o.expired(job); ok {
+		// Not retryable: ack so the stale job leaves the queue.
+		repo := githubpkg.RepoFullName(job.RepoURL)
+		log.Warn("job expired, skipping", zap.Duration("age", age), zap.Int("job_ttl_hours", o.cfg.Worker.JobTTLHours))
+		o.bm.JobExpired(repo, age)
+		o.recordSkip(ctx, log, job, tidb.SkipExpired, fmt.Sprintf("queued %s ago, past worker.job_ttl_hours", age.Round(time.Minute)))
+		return nil
+	}
+	if err := o.routeJob(msg, job); err != nil {
+		return err
+	}
+	if unmet := job.Affinity.Unmet(o.cfg.Worker.Labels); len(unmet) > 0 {
+		log.Warn("building despite unmet affinity hints", zap.Strings("unmet", unmet))
+	}
+	reach := o.probeRemote(ctx, job)
+
+	// Resolve base SHA for nx affected. Checked before cloning so a
+	// redelivered job whose first run completed (but whose ack was lost
+	// when the worker died) is acked without rebuilding anything.
+	// Untrusted jobs diff against their pull request base and never
+	// advance the repository's last processed SHA. Requeued jobs rebuild
+	// a processed commit on purpose.
+	baseSHA := job.BaseSHA
+	if !job.Untrusted() {
+		var err error
+		baseSHA, err = o.buildState.GetLastSHA(ctx, job.RepoURL)
+		if err != nil {
+			log.Error("get last sha failed", zap.Error(err))
+			return err
+		}
+		if baseSHA == job.SHA && !job.Requeue {
+			log.Info("job already processed, skipping")
+			o.recordSkip(ctx, log, job, tidb.SkipDuplicate, "commit is the repository's last processed SHA")
+			return nil
+		}
+	}
 
-	jobID := job.SHA[:8] // short ID for temp paths
-	repoDir := fmt.Sprintf("/tmp/repo-%s", jobID)
-	defer os.RemoveAll(repoDir)
+	remote := <-reach
+	if remote.err != nil {
+		var unreachable *ErrRepoUnreachable
+		switch {
+		case shutdownCause(ctx) != nil:
+			return errRequeue
+		case errors.As(remote.err, &unreachable):
+			// Not retryable: ack so the job fails fast. The next push
+			// probes the repository again.
+			log.Error("repository unreachable, failing job", zap.Error(remote.err))
+			o.bm.RepoUnreachable(githubpkg.RepoFullName(job.RepoURL))
+			o.recordSkip(ctx, log, job, tidb.SkipRepoUnreachable, unreachable.Reason)
+			return nil
+		}
+		log.Error("resolve clone url failed", zap.Error(remote.err))
+		return remote.err
+	}
+
+	jobID := job.EffectiveID()
+	log = log.With(zap.String("job_id", jobID))
+	started := events.FromJob(job)
+	started.JobID, started.Worker = jobID, o.host.Hostname
+	run := o.events.Start(started)
+	ctx = events.WithRun(ctx, run)
+	defer func() { run.Finish(jobErr) }()
+	ws, err := newWorkspace(o.cfg.Worker.WorkspaceDir, jobID, int64(o.cfg.Worker.WorkspaceQuotaMB)<<20)
+	if err != nil {
+		log.Error("workspace setup failed", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := ws.remove(); err != nil {
+			log.Warn("workspace cleanup failed", zap.Error(err))
+		}
+	}()
+	if job.CompileOnly || job.Untrusted() {
+		defer o.removeJobImages(ctx, log, jobID)
+	}
+	repoDir := ws.repoDir
+	ctx = procgroup.WithTempDir(ctx, ws.tmpDir)
+	ctx, stopQuota := ws.enforce(ctx, time.Duration(o.cfg.Worker.WorkspaceCheckSeconds)*time.Second, log)
+	defer stopQuota()
+
+	// Kill anything the job's tools left running before the workspace goes.
+	ctx, procs := procgroup.WithTracker(ctx)
+	defer procs.Sweep(log)
+
+	if dir := o.cfg.Worker.ReportDir; dir != "" {
+		report := buildreport.New(o.clock, jobID, job.RepoURL, job.SHA, o.toolVersions(ctx))
+		report.SetHost(o.host)
+		ctx = buildreport.WithReport(ctx, report)
+		defer func() {
+			written, err := report.Finish(dir, o.cfg.Worker.ReportZstdLevel, jobErr)
+			if err != nil {
+				log.Warn("write build report failed", zap.Error(err))
+				return
+			}
+			log.Info("build report written",
+				zap.String("path", written.Path),
+				zap.Int("bytes", written.Size),
+				zap.Int("uncompressed_bytes", written.RawSize),
+			)
+		}()
+	}
 
 	// Clone repository. On failure: nack the message for retry.
 	log.Info("clone started")
-	if _, err := cloneRepo(ctx, o.gh, job.RepoURL, job.InstallationID, job.SHA, jobID); err != nil {
-		log.Error("clone failed", zap.Error(err))
+	if err := o.cloneRepo(ctx, log, job, remote.url, repoDir); err != nil {
+		var notFound *ErrCommitNotFound
+		if reason, detail, ok := skipFor(ctx, err); ok {
+			// Not retryable: the same commit would outgrow it again.
+			log.Error("workspace quota exceeded during clone, skipping job", zap.String("detail", detail))
+			o.recordSkip(ctx, log, job, reason, detail)
+			return nil
+		}
+		if errors.As(err, &notFound) {
+			log.Error("pushed commit not found on remote",
+				zap.Int("fetch_window_seconds", o.cfg.Worker.CommitFetchWindowSeconds),
+				zap.Error(err),
+			)
+		} else {
+			log.Error("clone failed", zap.Error(err))
+		}
 		return err // causes nack in subscriber
 	}
 	log.Info("clone complete", zap.String("repo_dir", repoDir))
 
-	// Resolve base SHA for nx affected.
-	baseSHA, err := o.buildState.GetLastSHA(ctx, job.RepoURL)
-	if err != nil {
-		log.Error("get last sha failed", zap.Error(err))
-		return err
+	if mode := o.cfg.Worker.CheckoutVerification; mode != "off" {
+		mismatches, err := verifyCheckout(ctx, repoDir, job)
+		if err != nil {
+			log.Error("checkout verification failed", zap.Error(err))
+			return err
+		}
+		if len(mismatches) > 0 {
+			details := make([]string, len(mismatches))
+			for i, m := range mismatches {
+				details[i] = m.String()
+			}
+			if mode == "enforce" {
+				// Not retryable: ack without advancing last_processed_sha so
+				// the next push is diffed against the last verified commit.
+				log.Error("checkout does not match webhook commit, skipping job", zap.Strings("mismatches", details))
+				o.recordSkip(ctx, log, job, tidb.SkipCheckoutMismatch, strings.Join(details, "; "))
+				return nil
+			}
+			log.Warn("checkout does not match webhook commit", zap.Strings("mismatches", details))
+		} else {
+			log.Info("checkout verified")
+		}
+	}
+
+	job.BranchProtected = o.branchProtected(ctx, log, job)
+	if job.BranchProtected {
+		log = log.With(zap.Bool("branch_protected", true))
 	}
+	buildreport.FromContext(ctx).SetBranch(job.Branch, job.BranchProtected)
+
+	if policy, ok := o.cfg.Policy.SignaturePolicyFor(githubpkg.RepoFullName(job.RepoURL), job.BranchProtected); ok {
+		if err := verifySignature(ctx, repoDir, job.SHA, policy); err != nil {
+			if reason, detail, ok := skipFor(ctx, err); ok {
+				// Not retryable: ack without building or advancing the SHA.
+				log.Error("commit signature rejected by policy, skipping job",
+					zap.String("policy", policy.Match),
+					zap.String("skip_reason", reason),
+					zap.Error(err),
+				)
+				if reason == tidb.SkipSignature {
+					o.bm.UntrustedCommit(githubpkg.RepoFullName(job.RepoURL))
+				}
+				o.recordSkip(ctx, log, job, reason, detail)
+				return nil
+			}
+			log.Error("signature verification failed", zap.Error(err))
+			return err
+		}
+		log.Info("commit signature verified", zap.String("policy", policy.Match))
+	}
+
 	if baseSHA == "" {
 		// First run: use the repository's initial commit.
 		initial, err := initialCommitSHA(ctx, repoDir)
@@ -105,10 +369,52 @@ func (o *Orchestrator) handleJob(ctx context.Context, msg jetstream.Msg, job nat
 		baseSHA = initial
 		log.Info("first run: using initial commit as base", zap.String("base_sha", baseSHA))
 	}
+	buildreport.FromContext(ctx).SetBase(baseSHA)
+
+	defaults, err := o.orgDefaults(ctx, job)
+	if err != nil {
+		log.Error("organization build defaults lookup failed", zap.Error(err))
+		return err
+	}
+	repoCfg, err := loadRepoConfig(repoDir, defaults)
+	if err != nil {
+		// Not retryable: the file is part of the commit, and the
+		// defaults were validated when they were saved.
+		log.Error("invalid repository build config, skipping job", zap.Error(err))
+		o.recordSkip(ctx, log, job, tidb.SkipInvalidConfig, err.Error())
+		return nil
+	}
+	buildreport.FromContext(ctx).SetBuildConfig(repoCfg.effective)
+	if defaults != "" {
+		log.Info("organization build defaults applied", zap.String("effective_config", repoCfg.effective))
+	}
+	if repoCfg.Build.Clean && !job.Clean {
+		job.Clean = true
+		log.Info("clean build requested by " + repoConfigFile)
+	}
+	if job.CompileOnly {
+		buildreport.FromContext(ctx).SetCompileOnly()
+	}
+	if job.Clean {
+		log = log.With(zap.Bool("clean", true))
+		buildreport.FromContext(ctx).SetClean()
+	}
 
-	// Detect affected projects under apps/.
-	projects, err := affectedProjects(ctx, repoDir, baseSHA, job.SHA)
+	ctx, err = o.provisionToolchains(ctx, log, repoDir)
 	if err != nil {
+		log.Error("toolchain provisioning failed", zap.Error(err))
+		return err
+	}
+
+	// Detect affected projects under apps/. The Nx cache may be shared
+	// with other workers, so serialize access to it.
+	projects, err := o.cachedAffectedProjects(ctx, log, job, repoDir, baseSHA)
+	if err != nil {
+		if reason, detail, ok := skipFor(ctx, err); ok {
+			log.Error("workspace quota exceeded during nx affected, skipping job", zap.String("detail", detail))
+			o.recordSkip(ctx, log, job, reason, detail)
+			return nil
+		}
 		log.Error("nx affected failed", zap.Error(err))
 		return err
 	}
@@ -116,97 +422,451 @@ func (o *Orchestrator) handleJob(ctx context.Context, msg jetstream.Msg, job nat
 		zap.Strings("projects", projects),
 		zap.Int("count", len(projects)),
 	)
+	affected := len(projects)
+	if d := job.Directives; d != nil {
+		var unknown []string
+		projects, unknown = d.Apply(projects, func(name string) bool {
+			return dirExists(filepath.Join(repoDir, "apps", name))
+		})
+		if len(unknown) > 0 {
+			log.Warn("build directive names unknown projects", zap.Strings("unknown", unknown))
+		}
+		log.Info("commit message directives applied",
+			zap.Strings("build", d.Build),
+			zap.Strings("skip", d.Skip),
+			zap.Strings("projects", projects),
+		)
+	}
 	o.bm.QueueWaitTime(job.PublishedAt)
+	o.load.observeWait(time.Since(job.PublishedAt))
 	o.bm.ProjectsAffected(len(projects))
 
 	if len(projects) == 0 {
 		log.Info("no affected projects, updating sha and acking")
-		return o.finish(ctx, job.RepoURL, job.SHA, log)
+		detail := "no project under apps/ changed since " + baseSHA
+		if affected > 0 {
+			detail = "commit message directives skipped every affected project"
+		}
+		o.recordSkip(ctx, log, job, tidb.SkipNoAffectedProjects, detail)
+		return o.finish(ctx, job, log)
 	}
 
-	// Dispatch parallel builds with concurrency semaphore.
-	sem := make(chan struct{}, o.cfg.Worker.Concurrency)
-	var wg sync.WaitGroup
-	for _, project := range projects {
-		wg.Add(1)
-		sem <- struct{}{}
-		go func(proj string) {
-			defer wg.Done()
-			defer func() { <-sem }()
-			o.buildProject(ctx, job, jobID, repoDir, proj)
-		}(project)
+	sched := o.scheduler(job, log)
+	build := o.buildProject
+	if job.CompileOnly {
+		build = o.compileProject
 	}
-	wg.Wait()
+	sched.dispatch(projects, func(proj string) {
+		o.load.buildStarted()
+		defer o.load.buildFinished()
+		build(ctx, job, repoCfg, jobID, repoDir, proj)
+	})
 
+	if shutdownCause(ctx) != nil {
+		log.Warn("job stopped by worker shutdown, returning it to the queue")
+		return errRequeue
+	}
+	if quotaExceeded(ctx) != nil {
+		// The job's builds were stopped and recorded as failed; finish it.
+		ctx = context.WithoutCancel(ctx)
+	}
 	log.Info("job completed", zap.String("sha", job.SHA))
-	return o.finish(ctx, job.RepoURL, job.SHA, log)
+	return o.finish(ctx, job, log)
+}
+
+// toolVersions returns the worker's tool versions, probed once.
+func (o *Orchestrator) toolVersions(ctx context.Context) map[string]string {
+	o.toolsOnce.Do(func() { o.tools = buildreport.ToolVersions(ctx) })
+	return o.tools
 }
 
 // finish updates the last processed SHA and returns nil (triggering ack).
-func (o *Orchestrator) finish(ctx context.Context, repo, sha string, log *zap.Logger) error {
-	if err := o.buildState.UpdateLastSHA(ctx, repo, sha); err != nil {
+// Untrusted and compile-only jobs leave the SHA untouched.
+func (o *Orchestrator) finish(ctx context.Context, job natspkg.BuildJob, log *zap.Logger) error {
+	if job.Untrusted() || job.CompileOnly || job.Requeue {
+		return nil
+	}
+	if err := o.buildState.UpdateLastSHA(ctx, job.RepoURL, job.SHA); err != nil {
 		log.Error("update last sha failed", zap.Error(err))
 		// Non-fatal: ack the message anyway to prevent reprocessing.
 	}
 	return nil
 }
 
+// recordSkip persists why job built nothing. A store failure only loses
+// the record.
+func (o *Orchestrator) recordSkip(ctx context.Context, log *zap.Logger, job natspkg.BuildJob, reason, detail string) {
+	err := o.skips.Record(ctx, tidb.SkippedBuild{
+		Repo:   githubpkg.RepoFullName(job.RepoURL),
+		SHA:    job.SHA,
+		Ref:    "refs/heads/" + job.Branch,
+		Reason: reason,
+		Detail: detail,
+		Source: tidb.SkipSourceWorker,
+	})
+	if err != nil {
+		log.Warn("record skipped build failed", zap.Error(err))
+	}
+	skipped := events.FromJob(job)
+	skipped.Reason, skipped.Detail = reason, detail
+	o.events.Emit(events.JobSkipped, skipped)
+}
+
+// skipFor returns why a job whose step failed with err is acked without
+// building, or false when a redelivery may succeed: a job that outgrew its
+// workspace would outgrow it again, and a rejected signature stays rejected.
+func skipFor(ctx context.Context, err error) (reason, detail string, ok bool) {
+	var untrusted *ErrUntrustedCommit
+	if quota := quotaExceeded(ctx); quota != nil {
+		return tidb.SkipQuota, quota.Error(), true
+	}
+	if errors.As(err, &untrusted) {
+		return tidb.SkipSignature, untrusted.Error(), true
+	}
+	return "", "", false
+}
+
+// projectResult records a project's outcome in the build report and the
+// job's events.
+func projectResult(ctx context.Context, project, status string, attempts int, err error) {
+	buildreport.FromContext(ctx).ProjectResult(project, status, attempts, err)
+	events.RunFrom(ctx).Project(project, status, err)
+}
+
 // buildProject runs the two-phase claim + build pipeline for a single project,
 // with application-level retry.
-func (o *Orchestrator) buildProject(ctx context.Context, job natspkg.BuildJob, jobID, repoDir, project string) {
+func (o *Orchestrator) buildProject(ctx context.Context, job natspkg.BuildJob, repoCfg RepoConfig, jobID, repoDir, project string) {
 	log := o.logger.With(
 		zap.String("project", project),
 		zap.String("sha", job.SHA),
 	)
+	ctx = buildreport.WithProject(ctx, project)
+	report := buildreport.FromContext(ctx)
+	// Every attempt's CPU time counts towards the build's cost, and its
+	// output towards the build's log cap.
+	ctx, _ = cost.WithMeter(ctx)
+	ctx, logs := buildahpkg.WithLogBudget(ctx, o.cfg.Buildah.MaxLogBytes)
 
 	stale := time.Duration(o.cfg.Worker.StaleClaimMinutes) * time.Minute
 
-	// Two-phase claim (task 10.5).
-	claimed, err := o.buildRec.Claim(ctx, project, job.SHA, stale)
+	if shutdownCause(ctx) != nil {
+		log.Info("build not started, worker shutting down")
+		return
+	}
+
+	// Two-phase claim (task 10.5). A requeued job claims the records
+	// the requeue reopened.
+	worker := o.host.Hostname
+	repo := githubpkg.RepoFullName(job.RepoURL)
+	var (
+		claim   int64
+		claimed bool
+		err     error
+	)
+	if job.Requeue {
+		claim, claimed, err = o.buildRec.ClaimReopened(ctx, project, job.SHA, repo, worker, stale)
+	} else {
+		claim, claimed, err = o.buildRec.Claim(ctx, project, job.SHA, repo, stale)
+	}
 	if err != nil {
 		log.Error("claim failed", zap.Error(err))
 		return
 	}
 	if !claimed {
 		log.Info("build skipped (already claimed or completed)")
+		projectResult(ctx, project, "skipped", 0, nil)
 		return
 	}
+	if err := o.buildRec.RecordQueued(ctx, project, job.SHA, job.PublishedAt, job.BuildNumber, worker); err != nil {
+		log.Warn("record queue time failed", zap.Error(err))
+	}
+	defer func() {
+		if dropped := o.logTruncated(ctx, log, project, logs); dropped > 0 {
+			if err := o.buildRec.RecordLogTruncation(context.WithoutCancel(ctx), project, job.SHA, dropped); err != nil {
+				log.Warn("record log truncation failed", zap.Error(err))
+			}
+		}
+	}()
+	// The warnings of the last attempt are the build's.
+	var warns *buildwarn.Collector
+	defer func() {
+		warnings := warns.Warnings()
+		o.reportWarnings(ctx, log, project, warnings)
+		if err := o.buildRec.RecordWarnings(context.WithoutCancel(ctx), project, job.SHA, warnings); err != nil {
+			log.Warn("record build warnings failed", zap.Error(err))
+		}
+	}()
 
 	// Application-level retry (task 10.7).
 	maxRetries := o.cfg.Worker.MaxBuildRetries
 	var lastErr error
+	attempts := 0
 	for attempt := 1; attempt <= maxRetries; attempt++ {
+		attempts = attempt
 		log := log.With(zap.Int("attempt", attempt))
 		log.Info("build started")
 
-		start := time.Now()
-		lastErr = o.runBuildPipeline(ctx, job, jobID, repoDir, project, log)
-		elapsed := time.Since(start)
+		start := o.clock.Now()
+		var attemptCtx context.Context
+		attemptCtx, warns = buildwarn.WithCollector(ctx)
+		lastErr = o.runBuildPipeline(attemptCtx, job, repoCfg, jobID, repoDir, project, log)
+		elapsed := clock.Since(o.clock, start)
+		if unknownLanguage(lastErr) {
+			log.Warn("unknown language, skipping project", zap.Error(lastErr))
+			// Drop the claim so it doesn't block future builds.
+			if err := o.buildRec.Release(ctx, project, job.SHA, claim); err != nil {
+				log.Warn("release build claim failed", zap.Error(err))
+			}
+			projectResult(ctx, project, "skipped", attempt, nil)
+			return
+		}
 		if lastErr == nil {
 			log.Info("build completed")
-			_ = o.buildRec.SetStatus(ctx, project, job.SHA, tidb.BuildStatusSuccess)
+			o.setStatus(ctx, log, project, job.SHA, claim, tidb.BuildStatusSuccess)
 			o.bm.BuildStatus(project, "success")
+			projectResult(ctx, project, "success", attempt, nil)
+			o.recordAttempts(ctx, log, job, project, attempt, attempt > 1)
+			o.checkDuration(ctx, log, repo, project, job.SHA, elapsed)
+			return
+		}
+		if shutdownCause(ctx) != nil {
+			o.interrupted(ctx, log, job, project, claim, attempt)
 			return
 		}
 
+		if quota := quotaExceeded(ctx); quota != nil {
+			lastErr = fmt.Errorf("%w: %w", quota, lastErr)
+			// Record the failure even though the job's context is done.
+			ctx = context.WithoutCancel(ctx)
+		}
 		o.bm.RetryCount(project, attempt)
 		log.Warn("build attempt failed", zap.Error(lastErr))
-		_ = elapsed // duration emitted on success only (failed durations tracked via retry count)
+		if isPermanent(lastErr) {
+			break
+		}
 		if attempt < maxRetries {
 			backoff := time.Duration(attempt*attempt) * 5 * time.Second
 			log.Info("retrying after backoff", zap.Duration("backoff", backoff))
 			select {
 			case <-ctx.Done():
+				if shutdownCause(ctx) != nil {
+					o.interrupted(ctx, log, job, project, claim, attempt)
+				}
 				return
-			case <-time.After(backoff):
+			case <-o.clock.After(backoff):
 			}
 		}
 	}
 
 	// All attempts exhausted — mark as permanent failure.
-	log.Error("build failed permanently", zap.Error(lastErr))
-	_ = o.buildRec.SetStatus(ctx, project, job.SHA, tidb.BuildStatusFailure)
+	diag := o.classifier.Classify(lastErr)
+	log.Error("build failed permanently",
+		zap.Error(lastErr),
+		zap.String("failure_category", diag.Category),
+		zap.String("failure_hint", diag.Hint),
+	)
+	o.setStatus(ctx, log, project, job.SHA, claim, tidb.BuildStatusFailure)
+	if err := o.buildRec.RecordFailure(ctx, project, job.SHA, diag.Category, diag.Hint); err != nil {
+		log.Warn("record failure diagnosis failed", zap.Error(err))
+	}
 	o.bm.BuildStatus(project, "failure")
+	o.bm.FailureCategory(project, diag.Category)
+	projectResult(ctx, project, "failure", attempts, lastErr)
+	report.ProjectFailure(project, diag.Category, diag.Hint)
+	o.writeDiagnostics(ctx, log, jobID, repoDir, project, lastErr)
+	o.recordAttempts(ctx, log, job, project, attempts, false)
+}
+
+// compileProject runs a compile-only build of project. It is not claimed or
+// recorded in build_records, which track images, so a full build of the
+// same commit still runs later.
+func (o *Orchestrator) compileProject(ctx context.Context, job natspkg.BuildJob, repoCfg RepoConfig, jobID, repoDir, project string) {
+	log := o.logger.With(
+		zap.String("project", project),
+		zap.String("sha", job.SHA),
+		zap.Bool("compile_only", true),
+	)
+	ctx = buildreport.WithProject(ctx, project)
+	report := buildreport.FromContext(ctx)
+	if shutdownCause(ctx) != nil {
+		log.Info("build not started, worker shutting down")
+		return
+	}
+	ctx, logs := buildahpkg.WithLogBudget(ctx, o.cfg.Buildah.MaxLogBytes)
+	defer o.logTruncated(ctx, log, project, logs)
+	ctx, warns := buildwarn.WithCollector(ctx)
+	defer func() { o.reportWarnings(ctx, log, project, warns.Warnings()) }()
+
+	log.Info("build started")
+	err := o.runBuildPipeline(ctx, job, repoCfg, jobID, repoDir, project, log)
+	if unknownLanguage(err) {
+		log.Warn("unknown language, skipping project", zap.Error(err))
+		projectResult(ctx, project, "skipped", 1, nil)
+		return
+	}
+	if err != nil {
+		diag := o.classifier.Classify(err)
+		log.Error("compile-only build failed", zap.Error(err), zap.String("failure_category", diag.Category))
+		o.bm.BuildStatus(project, "failure")
+		projectResult(ctx, project, "failure", 1, err)
+		report.ProjectFailure(project, diag.Category, diag.Hint)
+		o.writeDiagnostics(ctx, log, jobID, repoDir, project, err)
+		return
+	}
+	o.bm.BuildStatus(project, "success")
+	projectResult(ctx, project, "success", 1, nil)
+}
+
+// logTruncated reports how much of project's build output the log cap
+// dropped, if any, and returns it.
+func (o *Orchestrator) logTruncated(ctx context.Context, log *zap.Logger, project string, logs *buildahpkg.LogBudget) int64 {
+	dropped := logs.Dropped()
+	if dropped > 0 {
+		log.Warn("build output truncated",
+			zap.Int64("dropped_bytes", dropped),
+			zap.Int64("max_log_bytes", o.cfg.Buildah.MaxLogBytes),
+		)
+		buildreport.FromContext(ctx).ProjectLogTruncated(project, dropped)
+	}
+	return dropped
+}
+
+// jobImageCleanupTimeout bounds removing a job's local images.
+const jobImageCleanupTimeout = 2 * time.Minute
+
+// removeJobImages removes the images job jobID built without pushing, the
+// compile-only and validation builds; see buildahpkg.JobImageRef. Without
+// it they would stay in the storage until retention.
+func (o *Orchestrator) removeJobImages(ctx context.Context, log *zap.Logger, jobID string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jobImageCleanupTimeout)
+	defer cancel()
+	n, err := o.builder.RemoveJobImages(ctx, jobID)
+	if err != nil {
+		log.Warn("job image cleanup failed", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		log.Info("job images removed", zap.Int("images", n))
+	}
+}
+
+// writeDiagnostics collects the diagnostic bundle of a failed project build
+// into worker.diagnostics_dir, when set, and links it from the build report.
+func (o *Orchestrator) writeDiagnostics(ctx context.Context, log *zap.Logger, jobID, repoDir, project string, failure error) {
+	dir := o.cfg.Worker.DiagnosticsDir
+	if dir == "" {
+		return
+	}
+	written, err := buildreport.WriteDiagnostics(ctx, dir, buildreport.Failure{
+		JobID:   jobID,
+		Project: project,
+		Err:     failure,
+		RepoDir: repoDir,
+	})
+	if err != nil {
+		log.Warn("write diagnostic bundle failed", zap.Error(err))
+		return
+	}
+	buildreport.FromContext(ctx).ProjectDiagnostics(project, written.Path)
+	log.Info("diagnostic bundle written", zap.String("path", written.Path), zap.Int("bytes", written.Size))
+}
+
+// isPermanent reports whether a pipeline error cannot be fixed by retrying.
+func isPermanent(err error) bool {
+	var tagExists *ErrTagExists
+	var quota *ErrWorkspaceQuota
+	var baseImage *ErrBaseImageNotAllowed
+	var warnings *ErrWarningPolicy
+	return errors.As(err, &tagExists) || errors.As(err, &quota) ||
+		errors.As(err, &baseImage) || errors.As(err, &warnings)
+}
+
+// unknownLanguage reports whether a pipeline error is language detection
+// finding no supported language: the project is skipped, not failed.
+func unknownLanguage(err error) bool {
+	var unknown *detection.ErrUnknownLanguage
+	return errors.As(err, &unknown)
+}
+
+// setStatus completes a claimed build record under claim. Illegal
+// transitions (for example a record another worker already finished
+// differently) and superseded claims are logged and counted rather than
+// applied.
+func (o *Orchestrator) setStatus(ctx context.Context, log *zap.Logger, project, sha string, claim int64, status tidb.BuildStatus) {
+	err := o.buildRec.SetStatus(ctx, project, sha, claim, status)
+	var (
+		illegal    *tidb.ErrIllegalTransition
+		superseded *tidb.ErrClaimSuperseded
+	)
+	switch {
+	case errors.As(err, &illegal):
+		log.Warn("illegal build status transition rejected",
+			zap.String("from", string(illegal.From)), zap.String("to", string(illegal.To)))
+		o.bm.StatusConflict(project, "illegal_transition")
+	case errors.As(err, &superseded):
+		log.Warn("build status from superseded claim rejected",
+			zap.String("status", string(status)),
+			zap.Int64("claim", superseded.Claim),
+			zap.Int64("current_claim", superseded.Current),
+		)
+		o.bm.StatusConflict(project, "superseded")
+	case err != nil:
+		log.Error("set build status failed", zap.String("status", string(status)), zap.Error(err))
+	default:
+		log.Info("build status transition",
+			zap.String("from", string(tidb.BuildStatusPending)), zap.String("to", string(status)))
+		events.RunFrom(ctx).Transition(project, string(tidb.BuildStatusPending), string(status))
+	}
+}
+
+// checkDuration compares a successful build's duration with the p95
+// baseline of the repository's project, emitting an anomaly alert when it
+// exceeds the configured factor, then records the duration into the
+// baseline.
+func (o *Orchestrator) checkDuration(ctx context.Context, log *zap.Logger, repo, project, sha string, elapsed time.Duration) {
+	if factor := o.cfg.Worker.DurationAnomalyFactor; factor > 0 {
+		p95, samples, err := o.buildRec.DurationP95(ctx, repo, project, durationBaselineWindow)
+		if err != nil {
+			log.Warn("duration baseline failed", zap.Error(err))
+		} else if samples >= durationBaselineMinSamples && elapsed > time.Duration(float64(p95)*factor) {
+			log.Warn("build duration anomaly",
+				zap.Duration("duration", elapsed),
+				zap.Duration("p95_baseline", p95),
+				zap.Float64("factor", factor),
+			)
+			o.bm.DurationAnomaly(project, elapsed, p95)
+		}
+	}
+	if err := o.buildRec.RecordDuration(ctx, project, sha, elapsed); err != nil {
+		log.Warn("record duration failed", zap.Error(err))
+	}
+}
+
+// recordAttempts persists the attempt count for a finished build. A build that
+// failed and then passed on the same commit is flagged flaky, and the
+// flakiness score of the repository's branch over its recent history is
+// emitted.
+func (o *Orchestrator) recordAttempts(ctx context.Context, log *zap.Logger, job natspkg.BuildJob, project string, attempts int, flaky bool) {
+	if err := o.buildRec.RecordAttempts(ctx, project, job.SHA, job.Branch, attempts, flaky); err != nil {
+		log.Warn("record attempts failed", zap.Error(err))
+		return
+	}
+	if !flaky {
+		return
+	}
+	o.bm.Flaky(project)
+
+	f, err := o.buildRec.FlakinessScore(ctx, githubpkg.RepoFullName(job.RepoURL), job.Branch, flakinessWindow)
+	if err != nil {
+		log.Warn("flakiness score failed", zap.Error(err))
+		return
+	}
+	o.bm.FlakinessScore(f.Repo, f.Branch, f.Score)
+	log.Warn("flaky build: passed only after retry with no code change",
+		zap.Int("attempts", attempts),
+		zap.String("branch", f.Branch),
+		zap.Float64("flakiness_score", f.Score),
+	)
 }
 
 // runBuildPipeline executes the full per-project build pipeline:
@@ -214,26 +874,27 @@ func (o *Orchestrator) buildProject(ctx context.Context, job natspkg.BuildJob, j
 func (o *Orchestrator) runBuildPipeline(
 	ctx context.Context,
 	job natspkg.BuildJob,
+	repoCfg RepoConfig,
 	jobID, repoDir, project string,
 	log *zap.Logger,
 ) error {
 	projectDir := filepath.Join(repoDir, "apps", project)
 
-	// Language detection — unknown language is a skip, not a build failure.
-	result, err := detection.Detect(projectDir)
+	// Language detection, unless pinned — unknown language is a skip, not
+	// a build failure; see unknownLanguage.
+	result, source, err := projectLanguage(job, repoCfg, projectDir, project)
 	if err == nil {
 		defer pipelineTimer(o, project, string(result.Language))(&err)
 	}
 	if err != nil {
-		var unknownErr *detection.ErrUnknownLanguage
-		if errors.As(err, &unknownErr) {
-			log.Warn("unknown language, skipping project", zap.String("project_dir", projectDir))
-			// Mark claim as failure so it doesn't block future builds.
-			_ = o.buildRec.SetStatus(ctx, project, job.SHA, tidb.BuildStatusFailure)
-			return nil // not a retryable error
-		}
-		return fmt.Errorf("language detection: %w", err)
+		return fmt.Errorf("language detection (%s): %w", source, err)
 	}
+	log.Info("project language",
+		zap.String("language", string(result.Language)),
+		zap.String("build_tool", string(result.BuildTool)),
+		zap.String("source", source),
+	)
+	buildreport.FromContext(ctx).ProjectLanguage(project, string(result.BuildTool), source)
 
 	// Calculate version.
 	currentVersion, err := o.versions.Get(ctx, project)
@@ -246,50 +907,212 @@ func (o *Orchestrator) runBuildPipeline(
 		return fmt.Errorf("semver increment: %w", err)
 	}
 
+	buildArgs, err := o.buildEnv(job, repoCfg, jobID, project, newVersion)
+	if err != nil {
+		return fmt.Errorf("build env: %w", err)
+	}
+
+	// Untrusted code must not read the repository's credentials.
+	var secrets []config.BuildSecret
+	if !job.Untrusted() {
+		secrets = o.cfg.Buildah.SecretsFor(githubpkg.RepoFullName(job.RepoURL))
+	}
+	mounts := make([]templates.Secret, len(secrets))
+	for i, s := range secrets {
+		mounts[i] = templates.Secret{
+			ID: s.ID, Env: s.Env,
+			NetrcMachine: s.NetrcMachine, NetrcLogin: s.NetrcLogin,
+			MavenServer: s.MavenServer, MavenUsername: s.MavenUsername,
+		}
+	}
+
 	// Generate Dockerfile.
 	dockerfileContent, err := templates.Render(result.BuildTool, templates.TemplateVars{
 		ProjectName:    project,
 		ProjectSubpath: "apps/" + project,
 		ArtifactName:   project,
+		Proxy: templates.Proxy{
+			GoProxy:     o.cfg.Proxy.GoProxy,
+			GoSumDB:     o.cfg.Proxy.GoSumDB,
+			MavenMirror: o.cfg.Proxy.MavenMirror,
+			NuGetSource: o.cfg.Proxy.NuGetSource,
+		},
+		BuildArgs: slices.Sorted(maps.Keys(buildArgs)),
+		Secrets:   mounts,
+		Caches:    o.buildCaches(job, repoCfg, result.BuildTool),
+		Go: templates.Go{
+			Flags:     repoCfg.Build.Go.Flags,
+			Private:   repoCfg.Build.Go.Private,
+			NoProxy:   repoCfg.Build.Go.NoProxy,
+			NoSumDB:   repoCfg.Build.Go.NoSumDB,
+			Toolchain: repoCfg.Build.Go.Toolchain,
+		},
+		Gradle: templates.Gradle{
+			// Clean builds reuse no task outputs; untrusted ones share none.
+			BuildCache:      o.cfg.Gradle.BuildCache && !job.Clean,
+			RemoteCacheURL:  o.cfg.Gradle.RemoteBuildCacheURL,
+			RemoteCachePush: o.cfg.Gradle.RemoteBuildCachePush && !job.Untrusted(),
+		},
+		DotNet: templates.DotNet{
+			FallbackFolders: o.cfg.DotNet.FallbackFolders,
+			NodeReuse:       o.cfg.DotNet.NodeReuse,
+			Workloads:       o.cfg.DotNet.Workloads,
+		},
 	})
 	if err != nil {
 		return fmt.Errorf("render dockerfile: %w", err)
 	}
+	if policy, ok := o.cfg.Policy.BaseImagePolicyFor(githubpkg.RepoFullName(job.RepoURL), job.BranchProtected); ok {
+		if images := disallowedImages(policy, dockerfileContent); len(images) > 0 {
+			if policy.Severity != "warn" {
+				return &ErrBaseImageNotAllowed{Images: images}
+			}
+			buildwarn.Add(ctx, buildwarn.BaseImageNotAllowed, buildwarn.SeverityWarning,
+				"base images not allowed by policy %q: %s", policy.Match, strings.Join(images, ", "))
+		}
+	}
+	o.imageUses.observe(dockerfileContent)
 
 	// Build image.
-	imageRef := buildahpkg.ImageRef(o.cfg.Registry.URL, project, newVersion)
-	if err := o.builder.Build(ctx, jobID, project, imageRef, repoDir, dockerfileContent); err != nil {
+	opts := buildahpkg.BuildOptions{
+		NoCache:   job.Clean,
+		Ignore:    repoCfg.Build.contextIgnore(project),
+		BuildArgs: buildArgs,
+		Secrets:   secrets,
+	}
+	if n, ok := o.cfg.Buildah.NetworkFor(githubpkg.RepoFullName(job.RepoURL)); ok {
+		opts.Network, opts.DNS, opts.DNSSearch, opts.AddHosts = n.Network, n.DNS, n.DNSSearch, n.AddHosts
+	}
+	if repoCfg.Build.Network == "none" {
+		opts.Network, opts.DNS, opts.DNSSearch, opts.AddHosts = "none", nil, nil, nil
+	}
+	if job.CompileOnly {
+		// Compile and test in the builder stage; no image is produced.
+		opts.Target = "builder"
+		imageRef := buildahpkg.JobImageRef(jobID, "compile-only/"+project, job.SHA[:12])
+		if err := o.build(ctx, jobID, project, imageRef, repoDir, dockerfileContent, opts); err != nil {
+			return fmt.Errorf("buildah build: %w", err)
+		}
+		if err := warningGate(ctx, job); err != nil {
+			return err
+		}
+		log.Info("compile-only build complete (no image)",
+			zap.String("language", string(result.Language)),
+			zap.String("branch", job.Branch),
+		)
+		return nil
+	}
+	if job.Untrusted() {
+		// Validation build: tag locally so the image can never reach the
+		// registry, and stop before push and version update.
+		imageRef := buildahpkg.JobImageRef(jobID, "untrusted/"+project, job.SHA[:12])
+		if err := o.build(ctx, jobID, project, imageRef, repoDir, dockerfileContent, opts); err != nil {
+			return fmt.Errorf("buildah build: %w", err)
+		}
+		if err := warningGate(ctx, job); err != nil {
+			return err
+		}
+		log.Info("validation build complete (untrusted, not pushed)",
+			zap.String("language", string(result.Language)),
+			zap.String("image", imageRef),
+		)
+		return nil
+	}
+
+	registry, repository := o.cfg.Registry.ImageRepository(githubpkg.RepoFullName(job.RepoURL), project)
+	imageRef := buildahpkg.ImageRef(registry, repository, newVersion)
+	if err := o.checkTagImmutable(ctx, imageRef, job.BranchProtected); err != nil {
+		return err
+	}
+	if err := o.build(ctx, jobID, project, imageRef, repoDir, dockerfileContent, opts); err != nil {
 		return fmt.Errorf("buildah build: %w", err)
 	}
+	// Warnings found so far keep the image from being pushed.
+	if err := warningGate(ctx, job); err != nil {
+		return err
+	}
 
 	// Push image.
-	if err := o.builder.Push(ctx, project, imageRef); err != nil {
+	digest, err := o.builder.Push(ctx, project, imageRef)
+	if err != nil {
 		return fmt.Errorf("buildah push: %w", err)
 	}
 
+	buildreport.FromContext(ctx).ProjectImage(project, imageRef, digest)
+
+	// Record provenance so the image can be traced back to its source.
+	dockerfileSum := sha256.Sum256([]byte(dockerfileContent))
+	if err := o.buildRec.RecordImage(ctx, project, job.SHA, githubpkg.RepoFullName(job.RepoURL),
+		imageRef, digest, hex.EncodeToString(dockerfileSum[:])); err != nil {
+		log.Error("record image provenance failed", zap.Error(err), zap.String("digest", digest))
+		// Non-fatal: image was pushed successfully.
+	}
+
+	o.recordCost(ctx, log, project, job.SHA, imageRef)
+
 	// Update version in TiDB on success.
 	if err := o.versions.Update(ctx, project, newVersion); err != nil {
 		log.Error("version update failed", zap.Error(err), zap.String("new_version", newVersion))
 		// Non-fatal: image was pushed successfully.
 	}
+	o.propagateVersion(ctx, log, job, project, imageRef, newVersion)
 
 	log.Info("build pipeline complete",
 		zap.String("language", string(result.Language)),
 		zap.String("version", newVersion),
 		zap.String("image", imageRef),
+		zap.String("digest", digest),
 	)
 	return nil
 }
 
+// build runs the image build and records how much of it the layer cache
+// served.
+func (o *Orchestrator) build(ctx context.Context, jobID, project, imageRef, repoDir, dockerfile string, opts buildahpkg.BuildOptions) error {
+	layers, err := o.builder.Build(ctx, jobID, project, imageRef, repoDir, dockerfile, opts)
+	if layers.Steps > 0 {
+		o.bm.LayerCache(project, layers.Steps, layers.Cached)
+		buildreport.FromContext(ctx).ProjectLayerCache(project, layers.Steps, layers.Cached)
+	}
+	if err == nil && !opts.NoCache && layers.Steps > 0 && layers.Cached == 0 {
+		buildwarn.Add(ctx, buildwarn.ColdLayerCache, buildwarn.SeverityInfo,
+			"the layer cache served none of the image build's %d steps", layers.Steps)
+	}
+	return err
+}
+
+// recordCost estimates a pushed build's cost from the CPU time metered so
+// far and the compressed image size, and stores it on the build record.
+func (o *Orchestrator) recordCost(ctx context.Context, log *zap.Logger, project, sha, imageRef string) {
+	usage := cost.Usage{CPU: cost.FromContext(ctx).CPU()}
+	size, err := o.builder.ImageSize(ctx, imageRef)
+	if err != nil {
+		log.Warn("image size lookup failed; cost excludes storage and egress", zap.Error(err))
+	} else {
+		usage.ImageBytes = size
+		o.checkImageSize(ctx, imageRef, size)
+	}
+	usd := cost.Estimate(o.cfg.Cost, usage)
+	if err := o.buildRec.RecordCost(ctx, project, sha, usage.CPU.Seconds(), usage.ImageBytes, usd); err != nil {
+		log.Warn("record build cost failed", zap.Error(err))
+		return
+	}
+	log.Info("build cost estimated",
+		zap.Duration("cpu", usage.CPU),
+		zap.Int64("image_bytes", usage.ImageBytes),
+		zap.Float64("cost_usd", usd),
+	)
+}
+
 // pipelineStart marks the beginning of a timed build for metrics.
 // Usage: defer pipelineStart(o, project, language)()
 func pipelineTimer(o *Orchestrator, project, language string) func(err *error) {
-	start := time.Now()
+	start := o.clock.Now()
 	return func(err *error) {
 		status := "success"
 		if err != nil && *err != nil {
 			status = "failure"
 		}
-		o.bm.BuildDuration(project, language, status, time.Since(start))
+		o.bm.BuildDuration(project, language, status, clock.Since(o.clock, start))
 	}
 }
@@ -0,0 +1,138 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"go.uber.org/zap"
+	"go.yaml.in/yaml/v3"
+)
+
+// propagateAttempts bounds retries when another build updated the file
+// between read and write, as parallel projects sharing a kustomization do.
+const propagateAttempts = 5
+
+// propagateVersion commits a pushed image's version back to Git as
+// configured by propagate. Failures are logged: the image is already pushed.
+func (o *Orchestrator) propagateVersion(ctx context.Context, log *zap.Logger, job natspkg.BuildJob, project, image, version string) {
+	cfg := o.cfg.Propagate
+	if !cfg.Enabled {
+		return
+	}
+	repo := cfg.Repo
+	if repo == "" {
+		repo = githubpkg.RepoFullName(job.RepoURL)
+	}
+	path := strings.ReplaceAll(cfg.Path, "{project}", project)
+	log = log.With(zap.String("propagate_repo", repo), zap.String("propagate_path", path))
+
+	token, err := o.gh.GenerateInstallationToken(ctx, job.InstallationID)
+	if err != nil {
+		log.Error("version propagation failed", zap.Error(err))
+		return
+	}
+	message := fmt.Sprintf("chore(release): %s %s\n\nBuilt from %s. %s", project, version, job.SHA, githubpkg.PropagationMarker)
+	for attempt := 1; ; attempt++ {
+		err = o.propagateOnce(ctx, token, repo, path, cfg, message, image, version)
+		if !errors.Is(err, githubpkg.ErrContentConflict) || attempt == propagateAttempts {
+			break
+		}
+	}
+	if err != nil {
+		log.Error("version propagation failed", zap.Error(err))
+		return
+	}
+	log.Info("version propagated", zap.String("version", version))
+}
+
+func (o *Orchestrator) propagateOnce(ctx context.Context, token, repo, path string, cfg config.PropagateConfig, message, image, version string) error {
+	file, err := o.gh.GetContents(ctx, token, repo, path, cfg.Branch)
+	if err != nil {
+		return err
+	}
+	content, err := propagatedContent(cfg.Format, file.Content, image, version)
+	if err != nil {
+		return fmt.Errorf("update %s: %w", path, err)
+	}
+	if bytes.Equal(content, file.Content) {
+		return nil
+	}
+	return o.gh.PutContents(ctx, token, repo, path, cfg.Branch, message, content, file)
+}
+
+// propagatedContent returns the file updated for a new image version. In
+// "kustomize" format the images entry named after the image repository
+// gets the version as newTag, and is added if missing.
+func propagatedContent(format string, current []byte, image, version string) ([]byte, error) {
+	if format != "kustomize" {
+		return []byte(version + "\n"), nil
+	}
+	name := image // registry/repository, without the tag
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name = image[:i]
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(current, &doc); err != nil {
+		return nil, fmt.Errorf("parse kustomization: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("kustomization is not a mapping")
+	}
+	images := mappingValue(root, "images")
+	if images == nil {
+		images = &yaml.Node{Kind: yaml.SequenceNode}
+		root.Content = append(root.Content, scalar("images"), images)
+	}
+	var entry *yaml.Node
+	for _, item := range images.Content {
+		if n := mappingValue(item, "name"); n != nil && n.Value == name {
+			entry = item
+			break
+		}
+	}
+	if entry == nil {
+		entry = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{scalar("name"), scalar(name)}}
+		images.Content = append(images.Content, entry)
+	}
+	if tag := mappingValue(entry, "newTag"); tag != nil {
+		tag.Value, tag.Tag, tag.Style = version, "!!str", 0
+	} else {
+		entry.Content = append(entry.Content, scalar("newTag"), scalar(version))
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("encode kustomization: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// mappingValue returns the value of key in a YAML mapping node, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
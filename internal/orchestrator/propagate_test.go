@@ -0,0 +1,39 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPropagatedContent(t *testing.T) {
+	got, err := propagatedContent("version", []byte("1.0.0\n"), "reg.io/acme/api:1.1.0", "1.1.0")
+	if err != nil || string(got) != "1.1.0\n" {
+		t.Errorf("version format = %q, %v", got, err)
+	}
+
+	kustomization := `# deployed by argo
+resources:
+  - deployment.yaml
+images:
+  - name: reg.io/acme/api
+    newTag: 1.0.0
+  - name: reg.io/acme/web
+    newTag: 2.0.0
+`
+	got, err = propagatedContent("kustomize", []byte(kustomization), "reg.io/acme/api:1.1.0", "1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(kustomization, "newTag: 1.0.0", "newTag: 1.1.0", 1)
+	if string(got) != want {
+		t.Errorf("kustomize update =\n%s\nwant\n%s", got, want)
+	}
+
+	got, err = propagatedContent("kustomize", nil, "localhost:5000/acme/api:1.1.0", "1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "images:\n  - name: localhost:5000/acme/api\n    newTag: 1.1.0\n"; string(got) != want {
+		t.Errorf("new kustomization = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,28 @@
+package orchestrator
+
+import (
+	"context"
+
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"go.uber.org/zap"
+)
+
+// branchProtected reports whether the job's branch has GitHub branch
+// protection. Untrusted jobs, built from a fork's branch, never count as
+// protected. When the lookup fails the branch is assumed protected so the
+// stricter policies still apply.
+func (o *Orchestrator) branchProtected(ctx context.Context, log *zap.Logger, job natspkg.BuildJob) bool {
+	if job.Branch == "" || job.Untrusted() {
+		return false
+	}
+	token, err := o.gh.GenerateInstallationToken(ctx, job.InstallationID)
+	if err == nil {
+		var protected bool
+		if protected, err = o.gh.BranchProtected(ctx, token, githubpkg.RepoFullName(job.RepoURL), job.Branch); err == nil {
+			return protected
+		}
+	}
+	log.Warn("branch protection lookup failed, assuming protected", zap.String("branch", job.Branch), zap.Error(err))
+	return true
+}
@@ -0,0 +1,261 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/buildenv"
+	"github.com/jorgerua/build-system/container-build-service/internal/detection"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"go.yaml.in/yaml/v3"
+)
+
+// repoConfigFile is the optional per-repository build configuration,
+// read from the repository root of the checked-out commit.
+const repoConfigFile = ".ocibuild.yaml"
+
+// RepoConfig is the content of .ocibuild.yaml.
+type RepoConfig struct {
+	Build RepoBuildConfig `yaml:"build"`
+
+	// effective is the configuration applied, as YAML: the repository's
+	// file over its organization's defaults.
+	effective string
+}
+
+// RepoBuildConfig holds per-repository build options.
+type RepoBuildConfig struct {
+	// Clean disables all build caches, for debugging cache-related failures.
+	Clean bool `yaml:"clean"`
+	// Context selects what is sent to the image build: "repo" (default, the
+	// whole checkout) or "project" (the project's own directory plus
+	// shared code, without other apps or git metadata).
+	Context string `yaml:"context"`
+	// Env is passed to the image build as build arguments, overriding the
+	// worker's build_env. Values are templates over the job; see package
+	// buildenv.
+	Env map[string]string `yaml:"env"`
+	// Network "none" builds the repository's images without network
+	// access. Other network settings are the worker's to choose; see
+	// buildah.networks.
+	Network string `yaml:"network"`
+	// Caches declares extra cache directories of the build step, such as
+	// ~/.cache/pip or the Cypress binary cache, kept across the
+	// repository's builds like the build tool's dependency caches.
+	Caches []RepoCache `yaml:"caches"`
+	// Go sets the Go environment of the repository's Go image builds.
+	Go RepoGoConfig `yaml:"go"`
+	// Language pins the language of the repository's projects, bypassing
+	// detection, and Languages that of single projects; see
+	// detection.PinNames. They take precedence over the repository's
+	// registry settings.
+	Language  string            `yaml:"language"`
+	Languages map[string]string `yaml:"languages"`
+}
+
+// RepoGoConfig holds Go build variables. Authentication for private
+// modules comes from the worker's build secrets (buildah.secrets with a
+// netrc_machine), never from the repository.
+type RepoGoConfig struct {
+	Flags     string `yaml:"flags"`     // GOFLAGS, e.g. "-mod=mod -trimpath"
+	Private   string `yaml:"private"`   // GOPRIVATE, e.g. "github.com/acme/*"
+	NoProxy   string `yaml:"noproxy"`   // GONOPROXY
+	NoSumDB   string `yaml:"nosumdb"`   // GONOSUMDB
+	Toolchain string `yaml:"toolchain"` // GOTOOLCHAIN, e.g. "local" or "go1.26.2"
+}
+
+// RepoCache is a cache directory declared in .ocibuild.yaml.
+type RepoCache struct {
+	// ID names the cache within the repository.
+	ID string `yaml:"id"`
+	// Path is where the cache is mounted in the builder stage.
+	Path string `yaml:"path"`
+	// Env, when set, is exported to the build step with Path as its value,
+	// such as PIP_CACHE_DIR or CYPRESS_CACHE_FOLDER.
+	Env string `yaml:"env"`
+}
+
+var (
+	goFlagsPattern     = regexp.MustCompile(`^[A-Za-z0-9 ,=./_+:@-]*$`)
+	goPatternsPattern  = regexp.MustCompile(`^[A-Za-z0-9,./_*?\[\]-]*$`)
+	goToolchainPattern = regexp.MustCompile(`^((auto|local|path)|go1(\.[0-9]+)*(rc[0-9]+)?(\+(auto|path))?)?$`)
+	repoCacheIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+	envNamePattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Build context modes of RepoBuildConfig.Context.
+const (
+	contextRepo    = "repo"
+	contextProject = "project"
+)
+
+// contextIgnore returns the ignore patterns for project's build context.
+func (c RepoBuildConfig) contextIgnore(project string) []string {
+	if c.Context != contextProject {
+		return nil
+	}
+	return []string{".git", "apps/*", "!apps/" + project}
+}
+
+// loadRepoConfig reads .ocibuild.yaml from repoDir over the organization's
+// defaults, a document of the same form (empty for none): keys the
+// repository sets override the defaults', mappings such as build.env
+// merging key by key and lists replacing the defaults' list. A missing file
+// without defaults yields the zero config.
+func loadRepoConfig(repoDir, defaults string) (RepoConfig, error) {
+	data, err := os.ReadFile(filepath.Join(repoDir, repoConfigFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return RepoConfig{}, fmt.Errorf("read %s: %w", repoConfigFile, err)
+	}
+	if defaults == "" {
+		return parseRepoConfig(data, repoConfigFile)
+	}
+	base, err := yamlMapping([]byte(defaults), orgDefaultsName)
+	if err != nil {
+		return RepoConfig{}, err
+	}
+	own, err := yamlMapping(data, repoConfigFile)
+	if err != nil {
+		return RepoConfig{}, err
+	}
+	merged, err := yaml.Marshal(mergeConfig(base, own))
+	if err != nil {
+		return RepoConfig{}, fmt.Errorf("merge %s: %w", repoConfigFile, err)
+	}
+	return parseRepoConfig(merged, repoConfigFile+" with "+orgDefaultsName)
+}
+
+// orgDefaults returns the default .ocibuild.yaml of the job's repository
+// owner, or "" when it has none.
+func (o *Orchestrator) orgDefaults(ctx context.Context, job natspkg.BuildJob) (string, error) {
+	owner, _, _ := strings.Cut(githubpkg.RepoFullName(job.RepoURL), "/")
+	c, err := o.orgConfigs.Get(ctx, owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return c.Config, nil
+}
+
+// orgDefaultsName names the organization's defaults in errors.
+const orgDefaultsName = "organization defaults"
+
+// ValidateOrgDefaults checks an organization's default .ocibuild.yaml.
+func ValidateOrgDefaults(defaults string) error {
+	_, err := parseRepoConfig([]byte(defaults), orgDefaultsName)
+	return err
+}
+
+// yamlMapping decodes a YAML document that must be a mapping, or empty.
+func yamlMapping(data []byte, name string) (map[string]any, error) {
+	var m map[string]any
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+	return m, nil
+}
+
+// mergeConfig returns base with over's keys overriding it, merging nested
+// mappings key by key.
+func mergeConfig(base, over map[string]any) map[string]any {
+	out := make(map[string]any, len(base)+len(over))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		b, bok := out[k].(map[string]any)
+		o, ook := v.(map[string]any)
+		if bok && ook {
+			v = mergeConfig(b, o)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// parseRepoConfig parses and validates a .ocibuild.yaml document; name
+// identifies it in errors. An empty document yields the zero config.
+func parseRepoConfig(data []byte, name string) (RepoConfig, error) {
+	var cfg RepoConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", name, err)
+	}
+	if err := cfg.validate(name); err != nil {
+		return cfg, err
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		cfg.effective = string(data)
+	}
+	return cfg, nil
+}
+
+// validate checks the options of cfg, read from name.
+func (cfg RepoConfig) validate(name string) error {
+	switch cfg.Build.Context {
+	case "", contextRepo, contextProject:
+	default:
+		return fmt.Errorf("%s: build.context must be %q or %q, got %q", name, contextRepo, contextProject, cfg.Build.Context)
+	}
+	if n := cfg.Build.Network; n != "" && n != "none" {
+		return fmt.Errorf("%s: build.network must be \"none\", got %q", name, n)
+	}
+	if _, err := buildenv.Parse(cfg.Build.Env); err != nil {
+		return fmt.Errorf("%s: build.env: %w", name, err)
+	}
+	seen := map[string]bool{}
+	for i, c := range cfg.Build.Caches {
+		switch {
+		case !repoCacheIDPattern.MatchString(c.ID):
+			return fmt.Errorf("%s: build.caches[%d].id must be lowercase letters, digits, '.', '_' or '-', got %q", name, i, c.ID)
+		case seen[c.ID]:
+			return fmt.Errorf("%s: build.caches[%d]: duplicate id %q", name, i, c.ID)
+		case !path.IsAbs(c.Path) || strings.ContainsAny(c.Path, ", "):
+			return fmt.Errorf("%s: build.caches[%d].path must be an absolute path without commas or spaces, got %q", name, i, c.Path)
+		case c.Env != "" && !envNamePattern.MatchString(c.Env):
+			return fmt.Errorf("%s: build.caches[%d].env: invalid environment variable name %q", name, i, c.Env)
+		}
+		seen[c.ID] = true
+	}
+	if err := cfg.Build.Go.validate(); err != nil {
+		return fmt.Errorf("%s: build.go.%w", name, err)
+	}
+	if l := cfg.Build.Language; l != "" && !detection.ValidPin(l) {
+		return fmt.Errorf("%s: build.language must be one of %v, got %q", name, detection.PinNames, l)
+	}
+	for _, project := range slices.Sorted(maps.Keys(cfg.Build.Languages)) {
+		if l := cfg.Build.Languages[project]; !detection.ValidPin(l) {
+			return fmt.Errorf("%s: build.languages.%s must be one of %v, got %q", name, project, detection.PinNames, l)
+		}
+	}
+	return nil
+}
+
+// validate keeps the Go variables free of shell and Dockerfile quoting.
+func (g RepoGoConfig) validate() error {
+	if !goFlagsPattern.MatchString(g.Flags) {
+		return fmt.Errorf("flags: unsupported characters in %q", g.Flags)
+	}
+	for _, p := range []struct{ key, value string }{{"private", g.Private}, {"noproxy", g.NoProxy}, {"nosumdb", g.NoSumDB}} {
+		if !goPatternsPattern.MatchString(p.value) {
+			return fmt.Errorf("%s must be a comma-separated list of module path patterns, got %q", p.key, p.value)
+		}
+	}
+	if !goToolchainPattern.MatchString(g.Toolchain) {
+		return fmt.Errorf("toolchain must be \"auto\", \"local\", \"path\" or a version such as go1.26.2, got %q", g.Toolchain)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+)
+
+func TestLoadRepoConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := loadRepoConfig(dir, "")
+	if err != nil || cfg.Build.Clean {
+		t.Fatalf("missing file: cfg = %+v, err = %v", cfg, err)
+	}
+
+	path := filepath.Join(dir, repoConfigFile)
+	if err := os.WriteFile(path, []byte("build:\n  clean: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = loadRepoConfig(dir, "")
+	if err != nil || !cfg.Build.Clean {
+		t.Fatalf("clean: cfg = %+v, err = %v", cfg, err)
+	}
+
+	if err := os.WriteFile(path, []byte("build: [\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRepoConfig(dir, ""); err == nil {
+		t.Error("malformed file accepted")
+	}
+}
+
+func TestRepoConfigContext(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, repoConfigFile)
+
+	if err := os.WriteFile(path, []byte("build:\n  context: project\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadRepoConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".git", "apps/*", "!apps/api"}
+	if got := cfg.Build.contextIgnore("api"); !reflect.DeepEqual(got, want) {
+		t.Errorf("contextIgnore = %v, want %v", got, want)
+	}
+	if got := (RepoBuildConfig{}).contextIgnore("api"); got != nil {
+		t.Errorf("default context ignores %v", got)
+	}
+
+	if err := os.WriteFile(path, []byte("build:\n  context: dist\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRepoConfig(dir, ""); err == nil {
+		t.Error("unknown build.context accepted")
+	}
+}
+
+func TestRepoConfigEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, repoConfigFile)
+	if err := os.WriteFile(path, []byte("build:\n  env:\n    GIT_COMMIT: \"{{.CommitHash | short}}\"\n    STAGE: prod\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	repoCfg, err := loadRepoConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := &Orchestrator{cfg: &config.Config{}}
+	o.cfg.Worker.BuildEnv = map[string]string{"STAGE": "dev", "REPO": "{{.Repository.FullName}}@{{.Branch}}"}
+	job := natspkg.BuildJob{RepoURL: "https://github.com/acme/shop.git", SHA: "0123456789abcdef0123456789abcdef01234567", Branch: "main"}
+	got, err := o.buildEnv(job, repoCfg, "01J", "api", "1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"GIT_COMMIT": "0123456789ab", "STAGE": "prod", "REPO": "acme/shop@main"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildEnv = %v, want %v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("build:\n  env:\n    X: \"{{exec}}\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRepoConfig(dir, ""); err == nil {
+		t.Error("non-whitelisted template function accepted")
+	}
+}
+
+func TestRepoConfigNetwork(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, repoConfigFile)
+
+	if err := os.WriteFile(path, []byte("build:\n  network: none\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := loadRepoConfig(dir, ""); err != nil || cfg.Build.Network != "none" {
+		t.Fatalf("cfg = %+v, err = %v", cfg, err)
+	}
+
+	if err := os.WriteFile(path, []byte("build:\n  network: host\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRepoConfig(dir, ""); err == nil {
+		t.Error("repository chose host networking")
+	}
+}
+
+func TestRepoConfigCaches(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, repoConfigFile)
+
+	valid := "build:\n  caches:\n    - id: pip\n      path: /root/.cache/pip\n      env: PIP_CACHE_DIR\n    - id: cypress\n      path: /root/.cache/Cypress\n"
+	if err := os.WriteFile(path, []byte(valid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadRepoConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RepoCache{{ID: "pip", Path: "/root/.cache/pip", Env: "PIP_CACHE_DIR"}, {ID: "cypress", Path: "/root/.cache/Cypress"}}
+	if !reflect.DeepEqual(cfg.Build.Caches, want) {
+		t.Errorf("caches = %+v, want %+v", cfg.Build.Caches, want)
+	}
+
+	for _, invalid := range []string{
+		"build:\n  caches:\n    - id: Pip\n      path: /root/.cache/pip\n",
+		"build:\n  caches:\n    - id: pip\n      path: ~/.cache/pip\n",
+		"build:\n  caches:\n    - id: pip\n      path: /a,target=/b\n",
+		"build:\n  caches:\n    - id: pip\n      path: /a\n    - id: pip\n      path: /b\n",
+		"build:\n  caches:\n    - id: pip\n      path: /a\n      env: PIP-DIR\n",
+	} {
+		if err := os.WriteFile(path, []byte(invalid), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadRepoConfig(dir, ""); err == nil {
+			t.Errorf("accepted %q", invalid)
+		}
+	}
+}
+
+func TestRepoConfigGo(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, repoConfigFile)
+
+	valid := "build:\n  go:\n    flags: -mod=mod -trimpath\n    private: github.com/acme/*,gitlab.acme.dev\n    toolchain: go1.26.2+auto\n"
+	if err := os.WriteFile(path, []byte(valid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadRepoConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RepoGoConfig{Flags: "-mod=mod -trimpath", Private: "github.com/acme/*,gitlab.acme.dev", Toolchain: "go1.26.2+auto"}
+	if cfg.Build.Go != want {
+		t.Errorf("go = %+v, want %+v", cfg.Build.Go, want)
+	}
+
+	for _, invalid := range []string{
+		"build:\n  go:\n    flags: '-ldflags=\"-X main.v=1\"'\n",
+		"build:\n  go:\n    private: github.com/acme/*;rm -rf /\n",
+		"build:\n  go:\n    toolchain: 1.26\n",
+	} {
+		if err := os.WriteFile(path, []byte(invalid), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadRepoConfig(dir, ""); err == nil {
+			t.Errorf("accepted %q", invalid)
+		}
+	}
+}
+
+func TestRepoConfigOrgDefaults(t *testing.T) {
+	dir := t.TempDir()
+	defaults := "build:\n  network: none\n  env:\n    A: org\n    B: org\n  caches:\n    - id: pip\n      path: /root/.cache/pip\n  go:\n    private: github.com/acme/*\n"
+
+	cfg, err := loadRepoConfig(dir, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Build.Network != "none" || cfg.Build.Env["A"] != "org" || cfg.Build.Go.Private != "github.com/acme/*" {
+		t.Errorf("without a file: cfg = %+v, want the defaults", cfg.Build)
+	}
+
+	own := "build:\n  clean: true\n  env:\n    B: repo\n  caches:\n    - id: npm\n      path: /root/.npm\n  go:\n    flags: -trimpath\n"
+	if err := os.WriteFile(filepath.Join(dir, repoConfigFile), []byte(own), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = loadRepoConfig(dir, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RepoBuildConfig{
+		Clean:   true,
+		Network: "none",
+		Env:     map[string]string{"A": "org", "B": "repo"},
+		Caches:  []RepoCache{{ID: "npm", Path: "/root/.npm"}},
+		Go:      RepoGoConfig{Flags: "-trimpath", Private: "github.com/acme/*"},
+	}
+	if !reflect.DeepEqual(cfg.Build, want) {
+		t.Errorf("merged = %+v, want %+v", cfg.Build, want)
+	}
+	if back, err := parseRepoConfig([]byte(cfg.effective), "effective"); err != nil || !reflect.DeepEqual(back.Build, want) {
+		t.Errorf("effective config %q = %+v, %v", cfg.effective, back.Build, err)
+	}
+
+	if err := ValidateOrgDefaults("build:\n  network: host\n"); err == nil {
+		t.Error("invalid defaults accepted")
+	}
+}
+
+func TestRepoConfigLanguage(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, repoConfigFile)
+	for data, valid := range map[string]bool{
+		"build:\n  language: java\n  languages:\n    tools: go\n": true,
+		"build:\n  language: rust\n":                              false,
+		"build:\n  languages:\n    tools: golang\n":               false,
+	} {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadRepoConfig(dir, ""); (err == nil) != valid {
+			t.Errorf("%q: err = %v, want valid %v", data, err, valid)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package orchestrator
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"go.uber.org/zap"
+)
+
+// schedule runs a job's project builds. Concurrent schedules build up to
+// concurrency projects at once; deterministic ones build them one by one
+// in an order fixed by seed, so a failure that depends on build order
+// reproduces by rerunning with the same seed.
+type schedule struct {
+	concurrency   int
+	deterministic bool
+	seed          uint64
+}
+
+// scheduler returns the schedule of a job's builds.
+func (o *Orchestrator) scheduler(job natspkg.BuildJob, log *zap.Logger) schedule {
+	w := o.cfg.Worker
+	if !w.DeterministicSchedule {
+		return schedule{concurrency: w.Concurrency}
+	}
+	seed := uint64(w.ScheduleSeed)
+	if seed == 0 {
+		h := fnv.New64a()
+		h.Write([]byte(job.SHA))
+		seed = h.Sum64()
+	}
+	log.Info("deterministic schedule", zap.Uint64("seed", seed))
+	return schedule{concurrency: 1, deterministic: true, seed: seed}
+}
+
+// order returns the order projects are built in.
+func (s schedule) order(projects []string) []string {
+	if !s.deterministic {
+		return projects
+	}
+	// Shuffle a sorted copy, so the order only depends on the seed and the
+	// set of projects, not on how nx listed them.
+	out := slices.Sorted(slices.Values(projects))
+	r := rand.New(rand.NewPCG(s.seed, 0))
+	r.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	return out
+}
+
+// dispatch calls build for every project and waits for all of them.
+func (s schedule) dispatch(projects []string, build func(project string)) {
+	if s.deterministic {
+		for _, p := range s.order(projects) {
+			build(p)
+		}
+		return
+	}
+
+	sem := make(chan struct{}, max(s.concurrency, 1))
+	var wg sync.WaitGroup
+	for _, project := range projects {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(proj string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			build(proj)
+		}(project)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,61 @@
+package orchestrator
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestScheduleDeterministic(t *testing.T) {
+	projects := []string{"api", "web", "worker", "billing", "auth", "search"}
+	run := func(s schedule, in []string) []string {
+		var (
+			order   []string
+			running atomic.Int32
+		)
+		s.dispatch(in, func(p string) {
+			if running.Add(1) > 1 {
+				t.Error("deterministic schedule ran builds concurrently")
+			}
+			order = append(order, p)
+			running.Add(-1)
+		})
+		return order
+	}
+
+	s := schedule{concurrency: 1, deterministic: true, seed: 42}
+	first := run(s, projects)
+	reversed := slices.Clone(projects)
+	slices.Reverse(reversed)
+	if again := run(s, reversed); !slices.Equal(first, again) {
+		t.Errorf("same seed built %v, then %v", first, again)
+	}
+	if got := slices.Sorted(slices.Values(first)); !slices.Equal(got, slices.Sorted(slices.Values(projects))) {
+		t.Errorf("built %v, want every project once", first)
+	}
+
+	other := false
+	for seed := uint64(1); seed < 20 && !other; seed++ {
+		other = !slices.Equal(first, run(schedule{concurrency: 1, deterministic: true, seed: seed}, projects))
+	}
+	if !other {
+		t.Error("every seed produced the same order")
+	}
+}
+
+func TestScheduleConcurrent(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		built []string
+	)
+	schedule{concurrency: 2}.dispatch([]string{"a", "b", "c"}, func(p string) {
+		mu.Lock()
+		built = append(built, p)
+		mu.Unlock()
+	})
+	slices.Sort(built)
+	if !slices.Equal(built, []string{"a", "b", "c"}) {
+		t.Errorf("built %v", built)
+	}
+}
@@ -0,0 +1,110 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/buildreport"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"go.uber.org/zap"
+)
+
+// Causes of the job context of jobs stopped by a worker shutdown.
+var (
+	errShutdownRequeue = errors.New("worker shutting down, build requeued")
+	errShutdownAbort   = errors.New("worker shutting down, build aborted")
+)
+
+// categoryShutdown is the failure category of builds aborted by a shutdown.
+const categoryShutdown = "worker_shutdown"
+
+// shutdownCause returns why ctx was stopped by a worker shutdown, or nil.
+func shutdownCause(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, errShutdownRequeue) || errors.Is(cause, errShutdownAbort) {
+		return cause
+	}
+	return nil
+}
+
+// errRequeue returns a stopped job to the queue at once. Its redelivery
+// skips the projects that completed, including aborted ones.
+var errRequeue = &natspkg.DeferError{Reason: "worker shutting down"}
+
+// Shutdown stops consuming jobs and applies worker.shutdown_policy to the
+// running ones, returning once they have stopped or ctx ends.
+func (o *Orchestrator) Shutdown(ctx context.Context) error {
+	o.mu.Lock()
+	o.draining = true
+	stopConsuming, stopJobs := o.stopConsuming, o.stopJobs
+	o.mu.Unlock()
+	if stopConsuming == nil {
+		return nil // never started consuming
+	}
+	stopConsuming()
+
+	done := make(chan struct{})
+	go func() {
+		o.running.Wait()
+		close(done)
+	}()
+	policy := o.cfg.Worker.ShutdownPolicy
+	log := o.logger.With(zap.String("policy", policy))
+	log.Info("worker shutting down")
+
+	cause := errShutdownRequeue
+	switch policy {
+	case "wait":
+		wait := time.Duration(o.cfg.Worker.ShutdownWaitMinutes) * time.Minute
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+			log.Warn("running builds did not finish in time, requeueing them", zap.Duration("waited", wait))
+		}
+	case "abort":
+		cause = errShutdownAbort
+	}
+	stopJobs(cause)
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// interrupted settles a claimed build stopped by a worker shutdown. An
+// aborted build is recorded as failed; a requeued one has its claim
+// released so the redelivered job rebuilds it at once. claim is the
+// build record's claim sequence.
+func (o *Orchestrator) interrupted(ctx context.Context, log *zap.Logger, job natspkg.BuildJob, project string, claim int64, attempts int) {
+	cause := shutdownCause(ctx)
+	ctx = context.WithoutCancel(ctx)
+	report := buildreport.FromContext(ctx)
+
+	if errors.Is(cause, errShutdownAbort) {
+		log.Warn("build aborted by worker shutdown")
+		o.setStatus(ctx, log, project, job.SHA, claim, tidb.BuildStatusFailure)
+		hint := "The worker stopped during the build (worker.shutdown_policy abort); retry the build."
+		if err := o.buildRec.RecordFailure(ctx, project, job.SHA, categoryShutdown, hint); err != nil {
+			log.Warn("record failure diagnosis failed", zap.Error(err))
+		}
+		o.bm.BuildStatus(project, "failure")
+		o.bm.FailureCategory(project, categoryShutdown)
+		projectResult(ctx, project, "failure", attempts, cause)
+		report.ProjectFailure(project, categoryShutdown, hint)
+		return
+	}
+
+	log.Warn("build interrupted by worker shutdown, releasing claim for requeue")
+	if err := o.buildRec.Release(ctx, project, job.SHA, claim); err != nil {
+		log.Warn("release build claim failed", zap.Error(err))
+	}
+	projectResult(ctx, project, "requeued", attempts, cause)
+}
@@ -0,0 +1,55 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		policy      string
+		waitMinutes int
+		jobTime     time.Duration // how long the running job takes uninterrupted
+		want        error         // the running job's stop cause
+	}{
+		{"wait", 1, 10 * time.Millisecond, nil},
+		{"wait", 0, time.Hour, errShutdownRequeue},
+		{"requeue", 30, time.Hour, errShutdownRequeue},
+		{"abort", 30, time.Hour, errShutdownAbort},
+	}
+	for _, tc := range tests {
+		cfg := &config.Config{}
+		cfg.Worker.ShutdownPolicy = tc.policy
+		cfg.Worker.ShutdownWaitMinutes = tc.waitMinutes
+		o := &Orchestrator{cfg: cfg, logger: zap.NewNop()}
+
+		_, stopConsuming := context.WithCancel(context.Background())
+		jobsCtx, stopJobs := context.WithCancelCause(context.Background())
+		o.stopConsuming, o.stopJobs = stopConsuming, stopJobs
+		o.running.Add(1)
+		var got error
+		go func() {
+			defer o.running.Done()
+			select {
+			case <-jobsCtx.Done():
+				got = shutdownCause(jobsCtx)
+			case <-time.After(tc.jobTime):
+			}
+		}()
+
+		if err := o.Shutdown(context.Background()); err != nil {
+			t.Fatalf("%s: Shutdown = %v", tc.policy, err)
+		}
+		if !errors.Is(got, tc.want) || (got == nil) != (tc.want == nil) {
+			t.Errorf("%s (wait %dm): job stopped by %v, want %v", tc.policy, tc.waitMinutes, got, tc.want)
+		}
+		if !o.draining {
+			t.Errorf("%s: not draining after Shutdown", tc.policy)
+		}
+	}
+}
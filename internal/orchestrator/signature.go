@@ -0,0 +1,52 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/procgroup"
+)
+
+// ErrUntrustedCommit is returned when a commit is unsigned or signed by a key
+// outside the repository's signature policy allowlist.
+type ErrUntrustedCommit struct {
+	SHA    string
+	Reason string
+}
+
+func (e *ErrUntrustedCommit) Error() string {
+	return fmt.Sprintf("untrusted commit %s: %s", e.SHA, e.Reason)
+}
+
+// verifySignature runs `git verify-commit` for sha, trusting only the keys
+// configured by the policy (SSH allowed signers and/or a GPG keyring).
+func verifySignature(ctx context.Context, repoDir, sha string, policy config.SignaturePolicy) error {
+	args := []string{}
+	if policy.AllowedSignersFile != "" {
+		args = append(args, "-c", "gpg.ssh.allowedSignersFile="+policy.AllowedSignersFile)
+	}
+	args = append(args, "verify-commit", "--raw", sha)
+
+	cmd := procgroup.Command(ctx, "git", args...)
+	cmd.Dir = repoDir
+	cmd.Env = cmd.Environ()
+	if policy.GPGHome != "" {
+		cmd.Env = append(cmd.Env, "GNUPGHOME="+policy.GPGHome)
+	}
+	out, err := cmd.CombinedOutput()
+	procgroup.Track(ctx, cmd)
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			reason := strings.TrimSpace(string(out))
+			if reason == "" {
+				reason = "no valid signature"
+			}
+			return &ErrUntrustedCommit{SHA: sha, Reason: reason}
+		}
+		return fmt.Errorf("git verify-commit: %w", err)
+	}
+	return nil
+}
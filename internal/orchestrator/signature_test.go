@@ -0,0 +1,52 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+)
+
+func TestVerifySignatureUnsigned(t *testing.T) {
+	dir, sha := initTestRepo(t, "fix: unsigned")
+
+	err := verifySignature(context.Background(), dir, sha, config.SignaturePolicy{Match: "*"})
+	var untrusted *ErrUntrustedCommit
+	if !errors.As(err, &untrusted) {
+		t.Fatalf("expected ErrUntrustedCommit, got %v", err)
+	}
+	if untrusted.SHA != sha {
+		t.Errorf("SHA = %q, want %q", untrusted.SHA, sha)
+	}
+}
+
+func TestSkipFor(t *testing.T) {
+	quotaCtx, cancel := context.WithCancelCause(context.Background())
+	cancel(&ErrWorkspaceQuota{Used: 2 << 20, Quota: 1 << 20})
+	untrusted := &ErrUntrustedCommit{SHA: "abc123", Reason: "no valid signature"}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		err        error
+		wantReason string
+		wantOK     bool
+	}{
+		{"quota exceeded", quotaCtx, errors.New("git clone: signal: killed"), tidb.SkipQuota, true},
+		{"quota wins over signature", quotaCtx, untrusted, tidb.SkipQuota, true},
+		{"signature rejected", context.Background(), fmt.Errorf("verify: %w", untrusted), tidb.SkipSignature, true},
+		{"transient failure", context.Background(), errors.New("git clone: connection reset"), "", false},
+	}
+	for _, tc := range tests {
+		reason, detail, ok := skipFor(tc.ctx, tc.err)
+		if reason != tc.wantReason || ok != tc.wantOK {
+			t.Errorf("%s: skipFor = %q, %v; want %q, %v", tc.name, reason, ok, tc.wantReason, tc.wantOK)
+		}
+		if ok && detail == "" {
+			t.Errorf("%s: skip without detail", tc.name)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+)
+
+// checkoutMismatch describes a difference between the cloned HEAD and the
+// commit announced by the webhook.
+type checkoutMismatch struct {
+	Field    string
+	Expected string
+	Actual   string
+}
+
+func (m checkoutMismatch) String() string {
+	return fmt.Sprintf("%s: expected %q, got %q", m.Field, m.Expected, m.Actual)
+}
+
+// verifyCheckout compares the repository HEAD with the job's SHA and, when
+// the webhook provided it, the head commit's author and message. It guards
+// against ref confusion (e.g. a force-push racing the clone).
+func verifyCheckout(ctx context.Context, repoDir string, job natspkg.BuildJob) ([]checkoutMismatch, error) {
+	out, err := runGitDir(ctx, repoDir, "log", "-1", "--format=%H%n%ae%n%B", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("git log HEAD: %w\n%s", err, out)
+	}
+	parts := strings.SplitN(out, "\n", 3)
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("unexpected git log output %q", out)
+	}
+	sha, email, message := parts[0], parts[1], parts[2]
+
+	var mismatches []checkoutMismatch
+	if sha != job.SHA {
+		mismatches = append(mismatches, checkoutMismatch{"sha", job.SHA, sha})
+	}
+	if hc := job.HeadCommit; hc != nil {
+		if hc.ID != "" && hc.ID != sha {
+			mismatches = append(mismatches, checkoutMismatch{"head_commit.id", hc.ID, sha})
+		}
+		if hc.AuthorEmail != "" && !strings.EqualFold(hc.AuthorEmail, email) {
+			mismatches = append(mismatches, checkoutMismatch{"author_email", hc.AuthorEmail, email})
+		}
+		if strings.TrimSpace(hc.Message) != strings.TrimSpace(message) {
+			mismatches = append(mismatches, checkoutMismatch{"message", strings.TrimSpace(hc.Message), strings.TrimSpace(message)})
+		}
+	}
+	return mismatches, nil
+}
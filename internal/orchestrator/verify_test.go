@@ -0,0 +1,81 @@
+package orchestrator
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+)
+
+func initTestRepo(t *testing.T, message string) (dir, sha string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir = t.TempDir()
+	ctx := context.Background()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=Dev", "-c", "user.email=dev@example.com", "commit", "-q", "--allow-empty", "-m", message},
+	} {
+		if out, err := runGitDir(ctx, dir, args...); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	out, err := runGitDir(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, strings.TrimSpace(out)
+}
+
+func TestVerifyCheckout(t *testing.T) {
+	dir, sha := initTestRepo(t, "feat: add login\n\nBody text.")
+
+	tests := []struct {
+		name       string
+		job        natspkg.BuildJob
+		wantFields []string
+	}{
+		{
+			name: "match",
+			job: natspkg.BuildJob{SHA: sha, HeadCommit: &natspkg.CommitInfo{
+				ID: sha, Message: "feat: add login\n\nBody text.", AuthorEmail: "DEV@example.com",
+			}},
+		},
+		{
+			name: "no head commit metadata",
+			job:  natspkg.BuildJob{SHA: sha},
+		},
+		{
+			name:       "sha mismatch",
+			job:        natspkg.BuildJob{SHA: strings.Repeat("a", 40)},
+			wantFields: []string{"sha"},
+		},
+		{
+			name: "author and message mismatch",
+			job: natspkg.BuildJob{SHA: sha, HeadCommit: &natspkg.CommitInfo{
+				ID: sha, Message: "fix: something else", AuthorEmail: "other@example.com",
+			}},
+			wantFields: []string{"author_email", "message"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := verifyCheckout(context.Background(), dir, tc.job)
+			if err != nil {
+				t.Fatalf("verifyCheckout: %v", err)
+			}
+			var fields []string
+			for _, m := range got {
+				fields = append(fields, m.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tc.wantFields, ",") {
+				t.Errorf("mismatched fields = %v, want %v", fields, tc.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/buildreport"
+	"github.com/jorgerua/build-system/container-build-service/internal/buildwarn"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"go.uber.org/zap"
+)
+
+// ErrWarningPolicy is returned when a build has warnings at or above the
+// repository's fail_on_warning severity. Retrying cannot help: the same
+// build warns again.
+type ErrWarningPolicy struct {
+	Severity string
+	Warnings []buildwarn.Warning
+}
+
+func (e *ErrWarningPolicy) Error() string {
+	found := make([]string, len(e.Warnings))
+	for i, w := range e.Warnings {
+		found[i] = fmt.Sprintf("%s (%s): %s", w.Code, w.Severity, w.Message)
+	}
+	return fmt.Sprintf("warnings fail the build (fail_on_warning %s): %s", e.Severity, strings.Join(found, "; "))
+}
+
+// warningGate fails the build when the warnings collected under ctx so far
+// reach job's fail_on_warning severity.
+func warningGate(ctx context.Context, job natspkg.BuildJob) error {
+	if job.FailOnWarning == "" {
+		return nil
+	}
+	failing := buildwarn.AtLeast(buildwarn.FromContext(ctx).Warnings(), buildwarn.Severity(job.FailOnWarning))
+	if len(failing) == 0 {
+		return nil
+	}
+	return &ErrWarningPolicy{Severity: job.FailOnWarning, Warnings: failing}
+}
+
+// checkImageSize warns about a pushed image larger than
+// warnings.large_image_mb. The size is known only once the image is
+// published, so the warning is recorded but never fails the build.
+func (o *Orchestrator) checkImageSize(ctx context.Context, imageRef string, size int64) {
+	limit := int64(o.cfg.Warnings.LargeImageMB) << 20
+	if limit == 0 || size <= limit {
+		return
+	}
+	buildwarn.Add(ctx, buildwarn.LargeImage, buildwarn.SeverityWarning,
+		"image %s is %d MiB compressed, over the %d MiB threshold", imageRef, size>>20, o.cfg.Warnings.LargeImageMB)
+}
+
+// reportWarnings logs and counts the warnings of a project's last build
+// attempt and records them in the build report.
+func (o *Orchestrator) reportWarnings(ctx context.Context, log *zap.Logger, project string, warnings []buildwarn.Warning) {
+	for _, w := range warnings {
+		log.Warn("build warning",
+			zap.String("code", w.Code),
+			zap.String("severity", string(w.Severity)),
+			zap.String("message", w.Message),
+		)
+		o.bm.BuildWarning(project, w.Code, string(w.Severity))
+	}
+	buildreport.FromContext(ctx).ProjectWarnings(project, warnings)
+}
@@ -0,0 +1,36 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/buildwarn"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+)
+
+func TestWarningGate(t *testing.T) {
+	ctx, _ := buildwarn.WithCollector(context.Background())
+	buildwarn.Add(ctx, buildwarn.ColdLayerCache, buildwarn.SeverityInfo, "cold")
+	buildwarn.Add(ctx, buildwarn.BaseImageNotAllowed, buildwarn.SeverityWarning, "base images not allowed")
+
+	if err := warningGate(ctx, natspkg.BuildJob{}); err != nil {
+		t.Errorf("no policy: err = %v, want nil", err)
+	}
+	if err := warningGate(ctx, natspkg.BuildJob{FailOnWarning: "critical"}); err != nil {
+		t.Errorf("critical: err = %v, want nil", err)
+	}
+
+	err := warningGate(ctx, natspkg.BuildJob{FailOnWarning: "warning"})
+	var policy *ErrWarningPolicy
+	if !errors.As(err, &policy) || len(policy.Warnings) != 1 || policy.Warnings[0].Code != buildwarn.BaseImageNotAllowed {
+		t.Fatalf("warning: err = %v, want the base image warning only", err)
+	}
+	if !isPermanent(err) {
+		t.Error("warning policy failure should not be retried")
+	}
+	if !strings.Contains(err.Error(), "base_image_not_allowed (warning): base images not allowed") {
+		t.Errorf("error = %q", err)
+	}
+}
@@ -0,0 +1,130 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrWorkspaceQuota is returned when a job's workspace outgrows
+// worker.workspace_quota_mb. It is not retryable.
+type ErrWorkspaceQuota struct {
+	Used  int64
+	Quota int64
+}
+
+func (e *ErrWorkspaceQuota) Error() string {
+	return fmt.Sprintf("workspace quota exceeded: %d bytes used, quota %d bytes", e.Used, e.Quota)
+}
+
+// workspace is a job's private directory: the repository checkout and the
+// TMPDIR its tools write to, removed together when the job ends.
+type workspace struct {
+	root    string
+	repoDir string
+	tmpDir  string
+	quota   int64 // bytes; 0 is unlimited
+}
+
+func newWorkspace(parent, jobID string, quota int64) (*workspace, error) {
+	root := filepath.Join(parent, "job-"+jobID)
+	ws := &workspace{
+		root:    root,
+		repoDir: filepath.Join(root, "repo"),
+		tmpDir:  filepath.Join(root, "tmp"),
+		quota:   quota,
+	}
+	if err := os.MkdirAll(ws.tmpDir, 0o700); err != nil {
+		return nil, fmt.Errorf("create workspace: %w", err)
+	}
+	return ws, nil
+}
+
+func (w *workspace) remove() error {
+	return os.RemoveAll(w.root)
+}
+
+// usage returns the bytes the workspace occupies. Files hardlinked from
+// elsewhere, like git objects shared with the mirror, are not charged.
+func (w *workspace) usage() (int64, error) {
+	var total int64
+	err := filepath.WalkDir(w.root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // removed while walking
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !sharedLink(info) {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// enforce measures the workspace every interval until stop is called. When
+// it exceeds the quota, the returned context is cancelled with an
+// *ErrWorkspaceQuota cause, killing the job's running tools.
+func (w *workspace) enforce(ctx context.Context, interval time.Duration, log *zap.Logger) (context.Context, func()) {
+	if w.quota <= 0 {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			used, err := w.usage()
+			if err != nil {
+				log.Warn("workspace usage check failed", zap.Error(err))
+				continue
+			}
+			if used > w.quota {
+				log.Error("workspace quota exceeded, stopping the job's builds",
+					zap.Int64("used_bytes", used),
+					zap.Int64("quota_bytes", w.quota),
+				)
+				cancel(&ErrWorkspaceQuota{Used: used, Quota: w.quota})
+				return
+			}
+		}
+	}()
+	return ctx, func() {
+		close(done)
+		cancel(nil)
+	}
+}
+
+// quotaExceeded returns the quota error ctx was cancelled with, if any.
+func quotaExceeded(ctx context.Context) *ErrWorkspaceQuota {
+	var quota *ErrWorkspaceQuota
+	if errors.As(context.Cause(ctx), &quota) {
+		return quota
+	}
+	return nil
+}
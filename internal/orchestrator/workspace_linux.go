@@ -0,0 +1,12 @@
+package orchestrator
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// sharedLink reports whether a file has other hardlinks.
+func sharedLink(info fs.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && st.Nlink > 1
+}
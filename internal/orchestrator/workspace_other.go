@@ -0,0 +1,10 @@
+//go:build !linux
+
+package orchestrator
+
+import "io/fs"
+
+// sharedLink always reports false outside Linux; workers only run on Linux.
+func sharedLink(info fs.FileInfo) bool {
+	return false
+}
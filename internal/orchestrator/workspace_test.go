@@ -0,0 +1,91 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWorkspaceUsage(t *testing.T) {
+	ws, err := newWorkspace(t.TempDir(), "job1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(ws.repoDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ws.repoDir, "a"), make([]byte, 1000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ws.tmpDir, "b"), make([]byte, 500), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A hardlink to a file outside the workspace is not charged.
+	outside := filepath.Join(t.TempDir(), "object")
+	if err := os.WriteFile(outside, make([]byte, 4000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(outside, filepath.Join(ws.repoDir, "object")); err != nil {
+		t.Skipf("hardlinks unsupported: %v", err)
+	}
+
+	used, err := ws.usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(1500); used != want && used != want+4000 {
+		t.Errorf("usage = %d, want %d", used, want)
+	}
+	if err := ws.remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(ws.root); !os.IsNotExist(err) {
+		t.Errorf("workspace not removed: %v", err)
+	}
+}
+
+func TestWorkspaceEnforce(t *testing.T) {
+	ws, err := newWorkspace(t.TempDir(), "job1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := ws.enforce(context.Background(), 10*time.Millisecond, zap.NewNop())
+	defer stop()
+	if quotaExceeded(ctx) != nil {
+		t.Fatal("quota exceeded before any writes")
+	}
+	if err := os.WriteFile(filepath.Join(ws.tmpDir, "big"), make([]byte, 200), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("context not cancelled after exceeding the quota")
+	}
+	quota := quotaExceeded(ctx)
+	if quota == nil || quota.Used != 200 || quota.Quota != 100 {
+		t.Fatalf("cause = %v, want workspace quota error", context.Cause(ctx))
+	}
+	if !isPermanent(errors.Join(errors.New("buildah bud: signal: killed"), quota)) {
+		t.Error("quota error is retryable")
+	}
+}
+
+func TestWorkspaceNoQuota(t *testing.T) {
+	ws, err := newWorkspace(t.TempDir(), "job1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	got, stop := ws.enforce(ctx, time.Millisecond, zap.NewNop())
+	defer stop()
+	if got != ctx {
+		t.Error("enforce without a quota wrapped the context")
+	}
+}
@@ -0,0 +1,216 @@
+// Package preflight verifies, before the worker consumes jobs, that it can
+// build at all: the required binaries are installed, its directories are
+// writable, and the registry and NATS are reachable. The latest report is
+// published as the "preflight" expvar.
+package preflight
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/httpclient"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// binaries are the tools every build runs.
+var binaries = []string{"nx", "buildah", "git"}
+
+// Check is the outcome of one preflight check.
+type Check struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the outcome of a preflight run.
+type Report struct {
+	Passed  bool      `json:"passed"`
+	Skipped bool      `json:"skipped,omitempty"`
+	Checks  []Check   `json:"checks"`
+	Time    time.Time `json:"time"`
+}
+
+// Failed returns the names of the failed checks.
+func (r Report) Failed() []string {
+	var names []string
+	for _, c := range r.Checks {
+		if !c.OK {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+var (
+	latest      atomic.Pointer[Report]
+	publishOnce sync.Once
+)
+
+// Checker runs the preflight checks.
+type Checker struct {
+	cfg      *config.Config
+	nc       *nats.Conn
+	client   *http.Client
+	lookPath func(string) (string, error)
+	logger   *zap.Logger
+}
+
+// New creates a Checker.
+func New(cfg *config.Config, nc *nats.Conn, httpClient *http.Client, logger *zap.Logger) *Checker {
+	publishOnce.Do(func() {
+		expvar.Publish("preflight", expvar.Func(func() any { return latest.Load() }))
+	})
+	return &Checker{
+		cfg:      cfg,
+		nc:       nc,
+		client:   httpclient.WithTimeout(httpClient, 5*time.Second),
+		lookPath: exec.LookPath,
+		logger:   logger.Named("preflight"),
+	}
+}
+
+// Run runs every check once.
+func (c *Checker) Run(ctx context.Context) Report {
+	r := Report{Passed: true, Time: time.Now().UTC()}
+	add := func(name string, err error) {
+		check := Check{Name: name, OK: err == nil}
+		if err != nil {
+			check.Error = err.Error()
+			r.Passed = false
+		}
+		r.Checks = append(r.Checks, check)
+	}
+
+	for _, bin := range binaries {
+		_, err := c.lookPath(bin)
+		add("binary:"+bin, err)
+	}
+	for _, dir := range c.dirs() {
+		add("writable:"+dir, writable(dir))
+	}
+	for _, host := range c.registries() {
+		add("registry:"+host, c.pingRegistry(ctx, host))
+	}
+	add("nats", c.pingNATS())
+	return r
+}
+
+// Wait runs the checks until they pass, every worker.preflight_retry_seconds,
+// publishing each report. With worker.preflight_skip set it returns at once.
+// It returns ctx's error if cancelled first.
+func (c *Checker) Wait(ctx context.Context) error {
+	if c.cfg.Worker.PreflightSkip {
+		latest.Store(&Report{Passed: true, Skipped: true, Time: time.Now().UTC()})
+		c.logger.Warn("preflight skipped by worker.preflight_skip")
+		return nil
+	}
+	retry := time.Duration(c.cfg.Worker.PreflightRetrySeconds) * time.Second
+	for {
+		r := c.Run(ctx)
+		latest.Store(&r)
+		if r.Passed {
+			c.logger.Info("preflight passed", zap.Int("checks", len(r.Checks)))
+			return nil
+		}
+		c.logger.Error("preflight failed, not consuming builds",
+			zap.Strings("failed", r.Failed()),
+			zap.Any("report", r),
+			zap.Duration("retry_in", retry),
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+// dirs returns the directories the worker writes to.
+func (c *Checker) dirs() []string {
+	var dirs []string
+	for _, d := range []string{
+		c.cfg.Cache.Dir,
+		c.cfg.Cache.ResultDir,
+		c.cfg.Worker.WorkspaceDir,
+		c.cfg.Worker.GitMirrorDir,
+		c.cfg.Worker.ReportDir,
+		c.cfg.Worker.DiagnosticsDir,
+		c.cfg.Buildah.StorageRoot,
+		c.cfg.Buildah.CacheMountDir,
+	} {
+		if d != "" && !slices.Contains(dirs, d) {
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs
+}
+
+// registries returns the registry hosts images are pushed to.
+func (c *Checker) registries() []string {
+	var hosts []string
+	if c.cfg.Registry.URL != "" {
+		hosts = append(hosts, c.cfg.Registry.URL)
+	}
+	for _, m := range c.cfg.Registry.Images {
+		if m.Registry != "" && !slices.Contains(hosts, m.Registry) {
+			hosts = append(hosts, m.Registry)
+		}
+	}
+	return hosts
+}
+
+// writable creates dir if needed and writes a file into it.
+func writable(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString("ok")
+	return errors.Join(err, f.Close(), os.Remove(f.Name()))
+}
+
+// pingRegistry checks that host answers the registry API base endpoint.
+// Any response short of a server error will do: 401 is the usual answer
+// to an anonymous request. Registries without TLS are tried over http.
+func (c *Checker) pingRegistry(ctx context.Context, host string) error {
+	var errs []error
+	for _, scheme := range []string{"https", "http"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+host+"/v2/", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("registry answered %d", resp.StatusCode)
+		}
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// pingNATS checks that the connection is up with a server round trip.
+func (c *Checker) pingNATS() error {
+	if c.nc == nil || !c.nc.IsConnected() {
+		return errors.New("not connected")
+	}
+	return c.nc.FlushTimeout(5 * time.Second)
+}
@@ -0,0 +1,62 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestRun(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer registry.Close()
+
+	readOnly := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(readOnly, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.Cache.Dir = filepath.Join(t.TempDir(), "nx")
+	cfg.Worker.WorkspaceDir = readOnly // a file: cannot hold a workspace
+	cfg.Registry.URL = strings.TrimPrefix(registry.URL, "http://")
+
+	c := New(cfg, nil, http.DefaultClient, zap.NewNop())
+	c.lookPath = func(name string) (string, error) {
+		if name == "nx" {
+			return "", errors.New("not found")
+		}
+		return "/usr/bin/" + name, nil
+	}
+	r := c.Run(context.Background())
+
+	want := []string{"binary:nx", "writable:" + readOnly, "nats"}
+	if r.Passed || strings.Join(r.Failed(), ",") != strings.Join(want, ",") {
+		t.Errorf("failed checks = %v, want %v", r.Failed(), want)
+	}
+	if len(r.Checks) != 7 {
+		t.Errorf("ran %d checks, want 7: %+v", len(r.Checks), r.Checks)
+	}
+	if _, err := os.Stat(cfg.Cache.Dir); err != nil {
+		t.Errorf("cache dir not created: %v", err)
+	}
+}
+
+func TestWaitSkip(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Worker.PreflightSkip = true
+	if err := New(cfg, nil, http.DefaultClient, zap.NewNop()).Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r := latest.Load(); r == nil || !r.Skipped {
+		t.Errorf("published report = %+v, want skipped", r)
+	}
+}
@@ -0,0 +1,131 @@
+// Package procgroup runs the external tools a build shells out to (git, nx,
+// buildah, skopeo) in process groups of their own, so that cancelling a
+// build kills the whole tree a tool started and a job can sweep up any
+// process its tools left behind.
+package procgroup
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// waitDelay bounds how long Wait blocks on output pipes held open by a
+// killed command's descendants.
+const waitDelay = 10 * time.Second
+
+// Command is exec.CommandContext for a tool started in its own process
+// group. Cancelling ctx kills the group rather than only the tool. The tool
+// inherits the TMPDIR set by WithTempDir and the variables set by WithEnv,
+// and is looked up first in, and runs with, the PATH directories set by
+// WithPath.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	dirs := PathDirs(ctx)
+	if !strings.Contains(name, "/") {
+		for _, dir := range dirs {
+			if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+				name = filepath.Join(dir, name)
+				break
+			}
+		}
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	env := Env(ctx)
+	if dir := TempDir(ctx); dir != "" {
+		env = append(env, "TMPDIR="+dir)
+	}
+	if len(dirs) > 0 {
+		path := append(slices.Clone(dirs), os.Getenv("PATH"))
+		env = append(env, "PATH="+strings.Join(path, string(os.PathListSeparator)))
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	setGroup(cmd)
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
+
+type pathKey struct{}
+
+// WithPath returns a context whose commands find tools in dir before the
+// directories of earlier WithPath calls and the worker's PATH, such as a
+// selected runtime's bin directory.
+func WithPath(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, pathKey{}, append([]string{dir}, PathDirs(ctx)...))
+}
+
+// PathDirs returns the directories set by WithPath, most recent first.
+func PathDirs(ctx context.Context) []string {
+	dirs, _ := ctx.Value(pathKey{}).([]string)
+	return dirs
+}
+
+type envKey struct{}
+
+// WithEnv returns a context whose commands also get the KEY=value
+// variables in env, overriding the worker's and earlier WithEnv calls'.
+func WithEnv(ctx context.Context, env ...string) context.Context {
+	return context.WithValue(ctx, envKey{}, append(slices.Clone(Env(ctx)), env...))
+}
+
+// Env returns the variables set by WithEnv.
+func Env(ctx context.Context) []string {
+	env, _ := ctx.Value(envKey{}).([]string)
+	return env
+}
+
+type tempDirKey struct{}
+
+// WithTempDir returns a context whose commands use dir as TMPDIR.
+func WithTempDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, tempDirKey{}, dir)
+}
+
+// TempDir returns the directory set by WithTempDir, or "" for the default.
+// It suits os.CreateTemp and os.MkdirTemp.
+func TempDir(ctx context.Context) string {
+	dir, _ := ctx.Value(tempDirKey{}).(string)
+	return dir
+}
+
+// Tracker records the process groups of the commands run for one job.
+type Tracker struct {
+	mu     sync.Mutex
+	groups map[int]string // pgid -> tool name
+}
+
+type trackerKey struct{}
+
+// WithTracker returns a context whose commands, passed to Track, are swept
+// by the returned Tracker.
+func WithTracker(ctx context.Context) (context.Context, *Tracker) {
+	t := &Tracker{groups: make(map[int]string)}
+	return context.WithValue(ctx, trackerKey{}, t), t
+}
+
+// Track records the process group of a finished command created by Command
+// with the Tracker carried by ctx, if any.
+func Track(ctx context.Context, cmd *exec.Cmd) {
+	t, _ := ctx.Value(trackerKey{}).(*Tracker)
+	if t == nil || cmd.Process == nil {
+		return
+	}
+	t.mu.Lock()
+	t.groups[cmd.Process.Pid] = cmd.Path
+	t.mu.Unlock()
+}
+
+// Stray is a process still running in a tracked group after its tool
+// exited.
+type Stray struct {
+	PID  int
+	PGID int
+	Tool string // the tool that started the group
+	Comm string // the stray process's own name
+}
@@ -0,0 +1,174 @@
+package procgroup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+func setGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		// The tool leads its group, so its pid is the group id.
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// Sweep kills every process left running in the tracked groups and returns
+// what it found. Tools are expected to wait for their children, so any
+// survivor is a leak.
+func (t *Tracker) Sweep(logger *zap.Logger) []Stray {
+	t.mu.Lock()
+	groups := make(map[int]string, len(t.groups))
+	for pgid, tool := range t.groups {
+		groups[pgid] = tool
+	}
+	t.groups = make(map[int]string)
+	t.mu.Unlock()
+	if len(groups) == 0 {
+		return nil
+	}
+
+	procs, err := listProcs()
+	if err != nil {
+		logger.Warn("process sweep failed", zap.Error(err))
+		return nil
+	}
+	var strays []Stray
+	for _, p := range procs {
+		tool, ok := groups[p.pgid]
+		if !ok || p.state == 'Z' {
+			continue
+		}
+		strays = append(strays, Stray{PID: p.pid, PGID: p.pgid, Tool: tool, Comm: p.comm})
+	}
+	killed := make(map[int]bool)
+	for _, s := range strays {
+		logger.Warn("stray process left by build tool, killing",
+			zap.Int("pid", s.PID),
+			zap.Int("pgid", s.PGID),
+			zap.String("tool", s.Tool),
+			zap.String("comm", s.Comm),
+		)
+		if !killed[s.PGID] {
+			killed[s.PGID] = true
+			if err := syscall.Kill(-s.PGID, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+				logger.Warn("kill stray process group failed", zap.Int("pgid", s.PGID), zap.Error(err))
+			}
+		}
+	}
+	return strays
+}
+
+// StartReaper reaps orphaned processes reparented to the worker when it runs
+// as PID 1 in its container, where nothing else would collect them and they
+// would accumulate as zombies. Only orphans are reaped: commands the worker
+// started lead their own process group and are waited for by exec. The
+// returned function stops the reaper.
+func StartReaper(logger *zap.Logger) (stop func()) {
+	if os.Getpid() != 1 {
+		return func() {}
+	}
+	sig := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sig, syscall.SIGCHLD)
+	go func() {
+		for {
+			select {
+			case <-sig:
+				reapOrphans(logger)
+			case <-done:
+				return
+			}
+		}
+	}()
+	logger.Info("zombie reaper started")
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
+
+func reapOrphans(logger *zap.Logger) {
+	procs, err := listProcs()
+	if err != nil {
+		logger.Warn("zombie scan failed", zap.Error(err))
+		return
+	}
+	self := os.Getpid()
+	for _, p := range procs {
+		if p.state != 'Z' || p.ppid != self || p.pgid == p.pid {
+			continue
+		}
+		var ws syscall.WaitStatus
+		if pid, err := syscall.Wait4(p.pid, &ws, syscall.WNOHANG, nil); err == nil && pid == p.pid {
+			logger.Debug("reaped orphaned process", zap.Int("pid", p.pid), zap.String("comm", p.comm))
+		}
+	}
+}
+
+type proc struct {
+	pid, ppid, pgid int
+	state           byte
+	comm            string
+}
+
+// listProcs reads every process from /proc.
+func listProcs() ([]proc, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var procs []proc
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + e.Name() + "/stat")
+		if err != nil {
+			continue // exited since ReadDir
+		}
+		p, err := parseStat(stat)
+		if err != nil || p.pid != pid {
+			continue
+		}
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
+
+// parseStat parses the fields of /proc/<pid>/stat that the sweep needs:
+// "pid (comm) state ppid pgrp ...". comm may contain spaces and
+// parentheses, so it extends to the last ')'.
+func parseStat(stat []byte) (proc, error) {
+	open, end := bytes.IndexByte(stat, '('), bytes.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return proc{}, fmt.Errorf("malformed stat %q", stat)
+	}
+	var p proc
+	var err error
+	if p.pid, err = strconv.Atoi(string(bytes.TrimSpace(stat[:open]))); err != nil {
+		return proc{}, fmt.Errorf("malformed stat pid: %w", err)
+	}
+	p.comm = string(stat[open+1 : end])
+	fields := bytes.Fields(stat[end+1:])
+	if len(fields) < 3 || len(fields[0]) != 1 {
+		return proc{}, fmt.Errorf("malformed stat %q", stat)
+	}
+	p.state = fields[0][0]
+	if p.ppid, err = strconv.Atoi(string(fields[1])); err != nil {
+		return proc{}, fmt.Errorf("malformed stat ppid: %w", err)
+	}
+	if p.pgid, err = strconv.Atoi(string(fields[2])); err != nil {
+		return proc{}, fmt.Errorf("malformed stat pgrp: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,95 @@
+package procgroup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParseStat(t *testing.T) {
+	p, err := parseStat([]byte("4242 (node (nx) x) S 17 4200 4200 0 -1 4194560 100"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.pid != 4242 || p.comm != "node (nx) x" || p.state != 'S' || p.ppid != 17 || p.pgid != 4200 {
+		t.Errorf("parseStat = %+v", p)
+	}
+	for _, bad := range []string{"", "12 sh S 1 1", "12 (sh) S x 1", "x (sh) S 1 1"} {
+		if _, err := parseStat([]byte(bad)); err == nil {
+			t.Errorf("parseStat(%q) accepted", bad)
+		}
+	}
+}
+
+// alive reports whether any process remains in a process group.
+func alive(pgid int) bool {
+	return syscall.Kill(-pgid, 0) == nil
+}
+
+func TestCommandCancelKillsGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := Command(ctx, "sh", "-c", "sleep 30 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("sh unavailable: %v", err)
+	}
+	pgid := cmd.Process.Pid
+	cancel()
+	_ = cmd.Wait()
+	deadline := time.Now().Add(2 * time.Second)
+	for alive(pgid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if alive(pgid) {
+		t.Error("process group survived cancellation")
+	}
+}
+
+func TestSweepKillsStrays(t *testing.T) {
+	ctx, tracker := WithTracker(context.Background())
+	cmd := Command(ctx, "sh", "-c", "sleep 30 >/dev/null 2>&1 &")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("sh unavailable: %v", err)
+	}
+	Track(ctx, cmd)
+
+	strays := tracker.Sweep(zap.NewNop())
+	if len(strays) != 1 || strays[0].Comm != "sleep" {
+		t.Fatalf("strays = %+v, want the background sleep", strays)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for alive(strays[0].PGID) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if alive(strays[0].PGID) {
+		t.Error("stray survived the sweep")
+	}
+	if again := tracker.Sweep(zap.NewNop()); len(again) != 0 {
+		t.Errorf("second sweep found %+v", again)
+	}
+}
+
+func TestCommandWithPath(t *testing.T) {
+	older, newer := t.TempDir(), t.TempDir()
+	for _, dir := range []string{older, newer} {
+		script := "#!/bin/sh\necho \"$0 $JAVA_HOME $PATH\"\n"
+		if err := os.WriteFile(filepath.Join(dir, "java"), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := WithPath(context.Background(), older)
+	ctx = WithEnv(WithPath(ctx, newer), "JAVA_HOME=/opt/jdk")
+	out, err := Command(ctx, "java").Output()
+	if err != nil {
+		t.Skipf("sh unavailable: %v", err)
+	}
+	want := filepath.Join(newer, "java") + " /opt/jdk " + newer + ":" + older + ":"
+	if !strings.HasPrefix(string(out), want) {
+		t.Errorf("output = %q, want prefix %q", out, want)
+	}
+}
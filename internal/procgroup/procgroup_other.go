@@ -0,0 +1,18 @@
+//go:build !linux
+
+package procgroup
+
+import (
+	"os/exec"
+
+	"go.uber.org/zap"
+)
+
+// Process groups are only managed on Linux; workers only run on Linux.
+func setGroup(cmd *exec.Cmd) {}
+
+// Sweep finds nothing outside Linux.
+func (t *Tracker) Sweep(logger *zap.Logger) []Stray { return nil }
+
+// StartReaper does nothing outside Linux.
+func StartReaper(logger *zap.Logger) (stop func()) { return func() {} }
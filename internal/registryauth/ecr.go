@@ -0,0 +1,343 @@
+package registryauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ecrHost matches private ECR registry hosts and captures their region.
+var ecrHost = regexp.MustCompile(`^\d{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// ecrRegion returns the AWS region of an ECR registry host, or "".
+func ecrRegion(host string) string {
+	if m := ecrHost.FindStringSubmatch(host); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// ecr mints ECR authorization tokens (valid for 12 hours) with
+// GetAuthorizationToken.
+type ecr struct {
+	region string
+	client *http.Client
+	env    func(string) string
+	now    func() time.Time
+	// Endpoints, overridden in tests.
+	endpoint, stsEndpoint, imdsEndpoint string
+
+	creds awsCredentials // cached temporary credentials
+}
+
+func newECR(region string, client *http.Client) *ecr {
+	return &ecr{
+		region:       region,
+		client:       client,
+		env:          os.Getenv,
+		now:          time.Now,
+		endpoint:     "https://api.ecr." + region + ".amazonaws.com/",
+		stsEndpoint:  "https://sts." + region + ".amazonaws.com/",
+		imdsEndpoint: "http://169.254.169.254",
+	}
+}
+
+func (e *ecr) mint(ctx context.Context) (token, error) {
+	creds, err := e.credentials(ctx)
+	if err != nil {
+		return token{}, err
+	}
+	body := []byte("{}")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	signV4(req, body, creds, e.region, "ecr", e.now())
+
+	var out struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"` // epoch seconds
+		} `json:"authorizationData"`
+	}
+	if err := doJSON(e.client, req, &out); err != nil {
+		return token{}, fmt.Errorf("ecr GetAuthorizationToken: %w", err)
+	}
+	if len(out.AuthorizationData) == 0 {
+		return token{}, fmt.Errorf("ecr GetAuthorizationToken: no authorization data")
+	}
+	data := out.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+	if err != nil {
+		return token{}, fmt.Errorf("ecr authorization token: %w", err)
+	}
+	user, pass, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return token{}, fmt.Errorf("ecr authorization token: not user:password")
+	}
+	return token{username: user, password: pass, expires: time.Unix(int64(data.ExpiresAt), 0)}, nil
+}
+
+// awsCredentials sign AWS requests; temporary ones carry a session token
+// and an expiry.
+type awsCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	SessionToken    string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// credentials resolves AWS credentials like the AWS SDKs do, minus shared
+// config files: static keys in the environment, then a web identity token
+// (EKS IRSA), then the container credentials endpoint (EKS Pod Identity,
+// ECS), then the EC2 instance role.
+func (e *ecr) credentials(ctx context.Context) (awsCredentials, error) {
+	if id := e.env("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: e.env("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    e.env("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	if e.creds.Expiration.Sub(e.now()) > refreshMargin {
+		return e.creds, nil
+	}
+	var (
+		creds awsCredentials
+		err   error
+	)
+	switch {
+	case e.env("AWS_WEB_IDENTITY_TOKEN_FILE") != "" && e.env("AWS_ROLE_ARN") != "":
+		creds, err = e.webIdentity(ctx)
+	case e.env("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" || e.env("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "":
+		creds, err = e.containerCredentials(ctx)
+	default:
+		creds, err = e.instanceRole(ctx)
+	}
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("aws credentials: %w", err)
+	}
+	e.creds = creds
+	return creds, nil
+}
+
+// webIdentity exchanges the projected service account token for role
+// credentials with STS AssumeRoleWithWebIdentity.
+func (e *ecr) webIdentity(ctx context.Context) (awsCredentials, error) {
+	jwt, err := os.ReadFile(e.env("AWS_WEB_IDENTITY_TOKEN_FILE"))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	session := e.env("AWS_ROLE_SESSION_NAME")
+	if session == "" {
+		session = "container-build-service"
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {e.env("AWS_ROLE_ARN")},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {strings.TrimSpace(string(jwt))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.stsEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("sts AssumeRoleWithWebIdentity: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return awsCredentials{}, fmt.Errorf("sts AssumeRoleWithWebIdentity: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var out struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return awsCredentials{}, fmt.Errorf("sts AssumeRoleWithWebIdentity: %w", err)
+	}
+	c := out.Credentials
+	return awsCredentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken, Expiration: c.Expiration}, nil
+}
+
+// containerCredentials reads role credentials from the container
+// credentials endpoint.
+func (e *ecr) containerCredentials(ctx context.Context) (awsCredentials, error) {
+	u := e.env("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if u == "" {
+		u = "http://169.254.170.2" + e.env("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	auth := e.env("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if f := e.env("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); f != "" {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return awsCredentials{}, err
+		}
+		auth = strings.TrimSpace(string(data))
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	var creds awsCredentials
+	if err := doJSON(e.client, req, &creds); err != nil {
+		return awsCredentials{}, fmt.Errorf("container credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// instanceRole reads the instance role's credentials from IMDSv2.
+func (e *ecr) instanceRole(ctx context.Context) (awsCredentials, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, e.imdsEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	imdsToken, err := doText(e.client, req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("instance metadata token: %w", err)
+	}
+	get := func(path string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.imdsEndpoint+path, nil)
+		if err == nil {
+			req.Header.Set("X-aws-ec2-metadata-token", imdsToken)
+		}
+		return req, err
+	}
+	const base = "/latest/meta-data/iam/security-credentials/"
+	req, err = get(base)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	role, err := doText(e.client, req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("instance role: %w", err)
+	}
+	role, _, _ = strings.Cut(role, "\n")
+	if req, err = get(base + role); err != nil {
+		return awsCredentials{}, err
+	}
+	var creds awsCredentials
+	if err := doJSON(e.client, req, &creds); err != nil {
+		return awsCredentials{}, fmt.Errorf("instance role credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// signV4 signs req with AWS Signature Version 4, covering the host, the
+// content type and every X-Amz-* header.
+func signV4(req *http.Request, body []byte, c awsCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if k = strings.ToLower(k); k == "content-type" || strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signed,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+	key := []byte("AWS4" + c.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// doJSON sends req and decodes a 200 OK JSON response into v.
+func doJSON(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// doText sends req and returns a 200 OK response body.
+func doText(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,45 @@
+package registryauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// gcp mints Artifact Registry and Container Registry credentials from the
+// access token of the metadata server's default service account (the
+// node's, or the Kubernetes service account's under Workload Identity).
+type gcp struct {
+	client   *http.Client
+	metadata string // overridden in tests
+	now      func() time.Time
+}
+
+func newGCP(client *http.Client) *gcp {
+	return &gcp{client: client, metadata: "http://metadata.google.internal", now: time.Now}
+}
+
+func (g *gcp) mint(ctx context.Context) (token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		g.metadata+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return token{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"` // seconds
+	}
+	if err := doJSON(g.client, req, &out); err != nil {
+		return token{}, fmt.Errorf("gcp access token: %w", err)
+	}
+	if out.AccessToken == "" {
+		return token{}, fmt.Errorf("gcp access token: empty token")
+	}
+	return token{
+		username: "oauth2accesstoken",
+		password: out.AccessToken,
+		expires:  g.now().Add(time.Duration(out.ExpiresIn) * time.Second),
+	}, nil
+}
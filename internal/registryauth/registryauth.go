@@ -0,0 +1,202 @@
+// Package registryauth keeps the registry credentials of image pushes
+// fresh. Registries such as ECR and Artifact Registry only accept
+// short-lived tokens, so a static auth file stops working on a long-lived
+// worker; Store mints the tokens on demand, refreshes them before they
+// expire, and writes them with the static credentials into one auth file
+// for buildah and skopeo.
+package registryauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/httpclient"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// refreshMargin is how long before expiry a token is replaced, so a
+	// push never starts with a token about to expire.
+	refreshMargin = 15 * time.Minute
+	// mintTimeout bounds the calls minting one token.
+	mintTimeout = 30 * time.Second
+)
+
+// provider mints the credentials of a registry.
+type provider interface {
+	mint(ctx context.Context) (token, error)
+}
+
+type token struct {
+	username, password string
+	expires            time.Time
+}
+
+type entry struct {
+	registry string
+	provider provider
+	current  token
+}
+
+// Store holds the registry credentials of the worker. It is safe for
+// concurrent use.
+type Store struct {
+	static string // registry.auth_file
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	entries []*entry
+	dir     string // holds the merged auth file
+	path    string // the merged auth file, once written
+	now     func() time.Time
+}
+
+// NewStore creates a Store for cfg.Registry.
+func NewStore(cfg *config.Config, client *http.Client, logger *zap.Logger) (*Store, error) {
+	s := &Store{static: cfg.Registry.AuthFile, logger: logger.Named("registryauth"), now: time.Now}
+	client = httpclient.WithTimeout(client, mintTimeout)
+	for _, rc := range cfg.Registry.Credentials {
+		var p provider
+		switch rc.Provider {
+		case "ecr":
+			region := rc.Region
+			if region == "" {
+				region = ecrRegion(rc.Registry)
+			}
+			if region == "" {
+				return nil, fmt.Errorf("registry credentials for %s: no region in the host, set region", rc.Registry)
+			}
+			p = newECR(region, client)
+		case "gcp":
+			p = newGCP(client)
+		default:
+			return nil, fmt.Errorf("registry credentials for %s: unknown provider %q", rc.Registry, rc.Provider)
+		}
+		s.entries = append(s.entries, &entry{registry: rc.Registry, provider: p})
+	}
+	return s, nil
+}
+
+// AuthFile returns the auth file to pass to buildah and skopeo as
+// --authfile, or "" when none is configured. With minted credentials it is
+// a private copy of registry.auth_file holding fresh tokens; a token that
+// cannot be refreshed is kept while it is still valid.
+func (s *Store) AuthFile(ctx context.Context) (string, error) {
+	if len(s.entries) == 0 {
+		return s.static, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	changed := false
+	for _, e := range s.entries {
+		if e.current.expires.Sub(now) > refreshMargin {
+			continue
+		}
+		t, err := e.provider.mint(ctx)
+		if err != nil {
+			if e.current.expires.After(now) {
+				s.logger.Warn("registry token refresh failed, using the current token",
+					zap.String("registry", e.registry), zap.Time("expires", e.current.expires), zap.Error(err))
+				continue
+			}
+			return "", fmt.Errorf("registry credentials for %s: %w", e.registry, err)
+		}
+		s.logger.Info("registry token minted", zap.String("registry", e.registry), zap.Time("expires", t.expires))
+		e.current = t
+		changed = true
+	}
+	if changed || s.path == "" {
+		if err := s.write(); err != nil {
+			return "", err
+		}
+	}
+	return s.path, nil
+}
+
+// write replaces the merged auth file: the static file's content with an
+// "auths" entry per minted token. Commands already reading the previous
+// file are unaffected.
+func (s *Store) write() error {
+	doc := map[string]any{}
+	if s.static != "" {
+		data, err := os.ReadFile(s.static)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("read registry auth file: %w", err)
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &doc); err != nil {
+				return fmt.Errorf("parse registry auth file: %w", err)
+			}
+		}
+	}
+	auths, _ := doc["auths"].(map[string]any)
+	if auths == nil {
+		auths = map[string]any{}
+	}
+	for _, e := range s.entries {
+		auth := base64.StdEncoding.EncodeToString([]byte(e.current.username + ":" + e.current.password))
+		auths[e.registry] = map[string]string{"auth": auth}
+	}
+	doc["auths"] = auths
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "registry-auth-")
+		if err != nil {
+			return fmt.Errorf("create registry auth dir: %w", err)
+		}
+		s.dir = dir
+	}
+	tmp, err := os.CreateTemp(s.dir, ".auth-*.json")
+	if err != nil {
+		return fmt.Errorf("write registry auth file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write registry auth file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write registry auth file: %w", err)
+	}
+	path := filepath.Join(s.dir, "auth.json")
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write registry auth file: %w", err)
+	}
+	s.path = path
+	return nil
+}
+
+// Close removes the merged auth file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// Module provides the Store via fx, removing its auth file on shutdown.
+var Module = fx.Module("registryauth",
+	fx.Provide(NewStore),
+	fx.Invoke(func(lc fx.Lifecycle, s *Store) {
+		lc.Append(fx.Hook{OnStop: func(context.Context) error { return s.Close() }})
+	}),
+)
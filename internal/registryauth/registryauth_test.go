@@ -0,0 +1,222 @@
+package registryauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case of the AWS Signature Version 4 test suite.
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+}
+
+func TestECRRegion(t *testing.T) {
+	tests := map[string]string{
+		"123456789012.dkr.ecr.eu-west-1.amazonaws.com":          "eu-west-1",
+		"123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com": "us-gov-west-1",
+		"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn":      "cn-north-1",
+		"public.ecr.aws":            "",
+		"europe-docker.pkg.dev":     "",
+		"dkr.ecr.eu-west-1.example": "",
+	}
+	for host, want := range tests {
+		if got := ecrRegion(host); got != want {
+			t.Errorf("ecrRegion(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestECRMint(t *testing.T) {
+	expires := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/20260301/eu-west-1/ecr/aws4_request") ||
+			r.Header.Get("X-Amz-Security-Token") != "session" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"authorizationData": []map[string]any{{
+			"authorizationToken": base64.StdEncoding.EncodeToString([]byte("AWS:secret-password")),
+			"expiresAt":          expires.Unix(),
+		}}})
+	}))
+	defer srv.Close()
+
+	env := map[string]string{"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "key", "AWS_SESSION_TOKEN": "session"}
+	e := newECR("eu-west-1", srv.Client())
+	e.endpoint = srv.URL + "/"
+	e.env = func(k string) string { return env[k] }
+	e.now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	tok, err := e.mint(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.username != "AWS" || tok.password != "secret-password" || !tok.expires.Equal(expires) {
+		t.Errorf("token = %+v", tok)
+	}
+}
+
+func TestECRWebIdentity(t *testing.T) {
+	dir := t.TempDir()
+	jwtFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(jwtFile, []byte("jwt\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("Action") != "AssumeRoleWithWebIdentity" || r.FormValue("WebIdentityToken") != "jwt" ||
+			r.FormValue("RoleArn") != "arn:aws:iam::123456789012:role/builder" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>ASIA</AccessKeyId><SecretAccessKey>key</SecretAccessKey><SessionToken>session</SessionToken>
+<Expiration>2026-03-01T13:00:00Z</Expiration></Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer sts.Close()
+
+	env := map[string]string{"AWS_WEB_IDENTITY_TOKEN_FILE": jwtFile, "AWS_ROLE_ARN": "arn:aws:iam::123456789012:role/builder"}
+	e := newECR("eu-west-1", sts.Client())
+	e.stsEndpoint = sts.URL
+	e.env = func(k string) string { return env[k] }
+	e.now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	creds, err := e.credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "ASIA" || creds.SessionToken != "session" || !creds.Expiration.Equal(time.Date(2026, 3, 1, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("credentials = %+v", creds)
+	}
+}
+
+func TestGCPMint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing header", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`))
+	}))
+	defer srv.Close()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	g := &gcp{client: srv.Client(), metadata: srv.URL, now: func() time.Time { return now }}
+
+	tok, err := g.mint(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.username != "oauth2accesstoken" || tok.password != "ya29.token" || !tok.expires.Equal(now.Add(3599*time.Second)) {
+		t.Errorf("token = %+v", tok)
+	}
+}
+
+// fakeProvider mints numbered tokens valid for an hour, or fails.
+type fakeProvider struct {
+	now   *time.Time
+	n     int
+	err   error
+	mints int
+}
+
+func (p *fakeProvider) mint(context.Context) (token, error) {
+	p.mints++
+	if p.err != nil {
+		return token{}, p.err
+	}
+	p.n++
+	return token{username: "user", password: "pass" + strconv.Itoa(p.n), expires: p.now.Add(time.Hour)}, nil
+}
+
+func TestStoreAuthFile(t *testing.T) {
+	dir := t.TempDir()
+	static := filepath.Join(dir, "config.json")
+	staticAuth := `{"auths":{"ghcr.io":{"auth":"Z2hjcjp0b2tlbg=="}},"credHelpers":{"gcr.io":"gcloud"}}`
+	if err := os.WriteFile(static, []byte(staticAuth), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	p := &fakeProvider{now: &now}
+	s := &Store{static: static, logger: zap.NewNop(), now: func() time.Time { return now },
+		entries: []*entry{{registry: "123456789012.dkr.ecr.eu-west-1.amazonaws.com", provider: p}}}
+	defer s.Close()
+
+	read := func() map[string]any {
+		t.Helper()
+		path, err := s.AuthFile(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+	ecrAuth := func(doc map[string]any) string {
+		entry := doc["auths"].(map[string]any)["123456789012.dkr.ecr.eu-west-1.amazonaws.com"].(map[string]any)
+		decoded, _ := base64.StdEncoding.DecodeString(entry["auth"].(string))
+		return string(decoded)
+	}
+
+	doc := read()
+	if got := ecrAuth(doc); got != "user:pass1" {
+		t.Errorf("minted auth = %q", got)
+	}
+	if doc["auths"].(map[string]any)["ghcr.io"] == nil || doc["credHelpers"] == nil {
+		t.Errorf("static entries lost: %v", doc)
+	}
+
+	// Still fresh: not minted again.
+	now = now.Add(30 * time.Minute)
+	if read(); p.mints != 1 {
+		t.Errorf("mints = %d, want 1", p.mints)
+	}
+	// Within the refresh margin: replaced.
+	now = now.Add(20 * time.Minute)
+	if got := ecrAuth(read()); got != "user:pass2" || p.mints != 2 {
+		t.Errorf("refreshed auth = %q after %d mints", got, p.mints)
+	}
+	// A failed refresh keeps a token that is still valid...
+	p.err = errors.New("throttled")
+	now = now.Add(50 * time.Minute)
+	if got := ecrAuth(read()); got != "user:pass2" {
+		t.Errorf("auth after failed refresh = %q", got)
+	}
+	// ...but not an expired one.
+	now = now.Add(time.Hour)
+	if _, err := s.AuthFile(context.Background()); err == nil {
+		t.Error("AuthFile succeeded with an expired token")
+	}
+}
+
+func TestStoreWithoutCredentials(t *testing.T) {
+	s := &Store{static: "/etc/registry/config.json", logger: zap.NewNop(), now: time.Now}
+	if path, err := s.AuthFile(context.Background()); err != nil || path != "/etc/registry/config.json" {
+		t.Errorf("AuthFile = %q, %v", path, err)
+	}
+}
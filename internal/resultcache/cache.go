@@ -0,0 +1,128 @@
+// Package resultcache is a small worker-local on-disk key/value store for
+// results that are expensive to recompute but fully determined by their key,
+// such as the nx project graph of a commit range.
+package resultcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+)
+
+// Cache stores JSON values as one file per key. A nil *Cache is a valid,
+// always-empty cache.
+type Cache struct {
+	dir        string
+	maxEntries int
+
+	hits, misses, evictions atomic.Int64
+}
+
+// Stats counts cache lookups and evictions.
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+// TakeStats returns the counts since the previous call and resets them.
+func (c *Cache) TakeStats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	return Stats{
+		Hits:      c.hits.Swap(0),
+		Misses:    c.misses.Swap(0),
+		Evictions: c.evictions.Swap(0),
+	}
+}
+
+// Open creates dir if needed and returns a cache holding at most maxEntries
+// values; the least recently written are evicted first.
+func Open(dir string, maxEntries int) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create result cache dir: %w", err)
+	}
+	return &Cache{dir: dir, maxEntries: maxEntries}, nil
+}
+
+// Get decodes the value stored under key into v and reports whether it was found.
+func (c *Cache) Get(key string, v any) bool {
+	if c == nil {
+		return false
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil || json.Unmarshal(data, v) != nil {
+		c.misses.Add(1)
+		return false
+	}
+	c.hits.Add(1)
+	return true
+}
+
+// Put stores v under key, replacing any previous value.
+func (c *Cache) Put(key string, v any) error {
+	if c == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal cached result: %w", err)
+	}
+	tmp, err := os.CreateTemp(c.dir, ".put-*")
+	if err != nil {
+		return fmt.Errorf("write cached result: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write cached result: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write cached result: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("write cached result: %w", err)
+	}
+	return c.evict()
+}
+
+// path hashes key so any string is a safe file name.
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// evict removes the oldest entries beyond maxEntries.
+func (c *Cache) evict() error {
+	if c.maxEntries <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil || len(matches) <= c.maxEntries {
+		return err
+	}
+
+	type entry struct {
+		path  string
+		mtime int64
+	}
+	entries := make([]entry, 0, len(matches))
+	for _, m := range matches {
+		if info, err := os.Stat(m); err == nil {
+			entries = append(entries, entry{m, info.ModTime().UnixNano()})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].mtime < entries[j].mtime })
+	for _, e := range entries[:max(0, len(entries)-c.maxEntries)] {
+		if os.Remove(e.path) == nil {
+			c.evictions.Add(1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package resultcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetPut(t *testing.T) {
+	c, err := Open(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	if c.Get("affected:a..b", &got) {
+		t.Fatal("Get on empty cache reported a hit")
+	}
+	if err := c.Put("affected:a..b", []string{"api", "web"}); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Get("affected:a..b", &got) || len(got) != 2 || got[0] != "api" {
+		t.Errorf("Get = %v", got)
+	}
+	if st := c.TakeStats(); st != (Stats{Hits: 1, Misses: 1}) {
+		t.Errorf("TakeStats = %+v, want 1 hit and 1 miss", st)
+	}
+	if st := c.TakeStats(); st != (Stats{}) {
+		t.Errorf("TakeStats after reset = %+v", st)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Open(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []string{"one", "two", "three"} {
+		if err := c.Put(key, i); err != nil {
+			t.Fatal(err)
+		}
+		// Distinct mtimes so the eviction order is deterministic.
+		old := time.Now().Add(time.Duration(i-10) * time.Minute)
+		_ = os.Chtimes(c.path(key), old, old)
+	}
+	if err := c.evict(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("entries = %d, want 2", len(files))
+	}
+	if st := c.TakeStats(); st.Evictions != 1 {
+		t.Errorf("evictions = %d, want 1", st.Evictions)
+	}
+	var v int
+	if c.Get("one", &v) {
+		t.Error("oldest entry was not evicted")
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	var c *Cache
+	var v int
+	if c.Get("k", &v) || c.Put("k", 1) != nil {
+		t.Error("nil cache should be empty and accept writes")
+	}
+}
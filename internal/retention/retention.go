@@ -0,0 +1,211 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	buildahpkg "github.com/jorgerua/build-system/container-build-service/internal/buildah"
+	"github.com/jorgerua/build-system/container-build-service/internal/buildreport"
+	"github.com/jorgerua/build-system/container-build-service/internal/clock"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	metricspkg "github.com/jorgerua/build-system/container-build-service/internal/metrics"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// leaderLock names the advisory lock electing the worker that applies the
+// database rules.
+const leaderLock = "cbs_retention"
+
+// Runner periodically deletes build data older than the configured ages.
+// Every worker prunes its own storage; the database, which they share, is
+// pruned by one of them, elected through leader.
+type Runner struct {
+	cfg      config.RetentionConfig
+	jobTTL   time.Duration
+	leader   *tidb.Leader
+	buildRec *tidb.BuildRecordRepository
+	skips    *tidb.SkippedBuildRepository
+	caches   *tidb.CacheSnapshotRepository
+	builder  *buildahpkg.Builder
+	// reportDir and diagnosticsDir are worker.report_dir and
+	// worker.diagnostics_dir.
+	reportDir      string
+	diagnosticsDir string
+	bm             *metricspkg.BuildMetrics
+	clock          clock.Clock
+	logger         *zap.Logger
+}
+
+// New creates a Runner and schedules it on the fx lifecycle.
+func New(cfg *config.Config, db *sql.DB, buildRec *tidb.BuildRecordRepository, skips *tidb.SkippedBuildRepository, caches *tidb.CacheSnapshotRepository, builder *buildahpkg.Builder, bm *metricspkg.BuildMetrics, clk clock.Clock, logger *zap.Logger, lc fx.Lifecycle) *Runner {
+	r := &Runner{
+		cfg:            cfg.Retention,
+		jobTTL:         time.Duration(cfg.Worker.JobTTLHours) * time.Hour,
+		leader:         tidb.NewLeader(db, leaderLock),
+		buildRec:       buildRec,
+		skips:          skips,
+		caches:         caches,
+		builder:        builder,
+		reportDir:      cfg.Worker.ReportDir,
+		diagnosticsDir: cfg.Worker.DiagnosticsDir,
+		bm:             bm,
+		clock:          clk,
+		logger:         logger.Named("retention"),
+	}
+	if r.cfg.IntervalMinutes <= 0 {
+		r.logger.Info("retention disabled")
+		return r
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			go func() {
+				defer close(done)
+				r.loop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			cancel()
+			<-done
+			r.leader.Release(ctx)
+			return nil
+		},
+	})
+	return r
+}
+
+func (r *Runner) loop(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(r.cfg.IntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		r.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rule is a retention rule: it reclaims one kind of data older than days.
+type rule struct {
+	name string
+	days int
+	// shared rules prune the database all workers share, and are applied
+	// by the leader only.
+	shared bool
+	run    func(ctx context.Context, cutoff time.Time, dryRun bool) (int64, error)
+}
+
+// rules returns the retention rules, in the order they are applied.
+func (r *Runner) rules() []rule {
+	return []rule{
+		// Archive first, so records archived younger than the deletion ages
+		// are kept.
+		{"archive_build_records", r.cfg.ArchiveRecordDays, true, r.buildRec.ArchiveCompletedBefore},
+		{"success_build_records", r.cfg.SuccessRecordDays, true, func(ctx context.Context, cutoff time.Time, dryRun bool) (int64, error) {
+			return r.buildRec.DeleteCompletedBefore(ctx, tidb.BuildStatusSuccess, cutoff, dryRun)
+		}},
+		{"failure_build_records", r.cfg.FailureRecordDays, true, func(ctx context.Context, cutoff time.Time, dryRun bool) (int64, error) {
+			return r.buildRec.DeleteCompletedBefore(ctx, tidb.BuildStatusFailure, cutoff, dryRun)
+		}},
+		{"expired_build_records", r.cfg.FailureRecordDays, true, func(ctx context.Context, cutoff time.Time, dryRun bool) (int64, error) {
+			return r.buildRec.DeleteCompletedBefore(ctx, tidb.BuildStatusExpired, cutoff, dryRun)
+		}},
+		{"deleted_build_records", r.cfg.DeletedRecordDays, true, r.buildRec.PurgeDeletedBefore},
+		{"skipped_builds", r.cfg.SkipRecordDays, true, r.skips.DeleteBefore},
+		{"cache_snapshots", r.cfg.CacheSnapshotDays, true, r.caches.DeleteBefore},
+		{"cache_mounts", r.cfg.CacheMountDays, false, func(ctx context.Context, cutoff time.Time, dryRun bool) (int64, error) {
+			n, err := r.builder.PruneCacheMounts(ctx, cutoff, dryRun)
+			return int64(n), err
+		}},
+		{"local_images", r.cfg.LocalImageDays, false, func(ctx context.Context, cutoff time.Time, dryRun bool) (int64, error) {
+			n, err := r.builder.PruneImages(ctx, cutoff, dryRun)
+			return int64(n), err
+		}},
+		{"build_reports", r.cfg.ReportDays, false, r.pruneDir(r.reportDir)},
+		{"diagnostic_bundles", r.cfg.DiagnosticsDays, false, r.pruneDir(r.diagnosticsDir)},
+	}
+}
+
+// pruneDir returns a rule run that prunes the files in dir, when set.
+func (r *Runner) pruneDir(dir string) func(context.Context, time.Time, bool) (int64, error) {
+	return func(_ context.Context, cutoff time.Time, dryRun bool) (int64, error) {
+		if dir == "" {
+			return 0, nil
+		}
+		n, err := buildreport.Prune(dir, cutoff, dryRun)
+		return int64(n), err
+	}
+}
+
+// RunOnce expires build records stuck pending past the job TTL, then
+// applies every configured retention rule a single time and logs what was
+// (or, in dry-run mode, would be) reclaimed. Only the leader expires
+// records and applies the database rules.
+func (r *Runner) RunOnce(ctx context.Context) {
+	now := r.clock.Now()
+	leading, err := r.leader.Acquire(ctx)
+	if err != nil {
+		r.logger.Warn("retention leader election failed, skipping database rules", zap.Error(err))
+	}
+	if leading && r.jobTTL > 0 {
+		r.expirePending(ctx, now.Add(-r.jobTTL))
+	}
+	r.apply(ctx, now, r.rules(), leading)
+}
+
+// apply applies rules as of now, the shared ones only when leading.
+func (r *Runner) apply(ctx context.Context, now time.Time, rules []rule, leading bool) {
+	for _, rule := range rules {
+		if rule.days <= 0 || (rule.shared && !leading) {
+			continue
+		}
+		cutoff := now.AddDate(0, 0, -rule.days)
+		n, err := rule.run(ctx, cutoff, r.cfg.DryRun)
+		if err != nil {
+			r.logger.Error("retention rule failed", zap.String("rule", rule.name), zap.Error(err))
+			continue
+		}
+		msg := "retention rule applied"
+		if r.cfg.DryRun {
+			msg = "retention dry run: would reclaim"
+		}
+		r.logger.Info(msg,
+			zap.String("rule", rule.name),
+			zap.Time("cutoff", cutoff),
+			zap.Int64("count", n),
+		)
+	}
+}
+
+// expirePending marks the build records claimed before cutoff and still
+// pending as expired: no worker is going to finish them.
+func (r *Runner) expirePending(ctx context.Context, cutoff time.Time) {
+	n, err := r.buildRec.ExpirePendingBefore(ctx, cutoff, r.cfg.DryRun)
+	if err != nil {
+		r.logger.Error("expire pending build records failed", zap.Error(err))
+		return
+	}
+	if n == 0 {
+		return
+	}
+	if r.cfg.DryRun {
+		r.logger.Info("retention dry run: would expire pending build records", zap.Time("cutoff", cutoff), zap.Int64("count", n))
+		return
+	}
+	r.logger.Warn("pending build records expired", zap.Time("cutoff", cutoff), zap.Int64("count", n))
+	r.bm.PendingExpired(n)
+}
+
+// Module provides and starts the retention Runner via fx.
+var Module = fx.Module("retention",
+	fx.Provide(New),
+	fx.Invoke(func(*Runner) {}),
+)
@@ -0,0 +1,138 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestApply(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	type call struct {
+		rule   string
+		cutoff time.Time
+		dryRun bool
+	}
+	var calls []call
+	fake := func(name string, days int, shared bool, err error) rule {
+		return rule{name, days, shared, func(_ context.Context, cutoff time.Time, dryRun bool) (int64, error) {
+			calls = append(calls, call{name, cutoff, dryRun})
+			return 3, err
+		}}
+	}
+	rules := []rule{
+		fake("records", 30, true, nil),
+		fake("disabled", 0, true, nil),
+		fake("broken", 1, true, errors.New("db down")),
+		fake("images", 7, false, nil),
+	}
+
+	for _, tc := range []struct {
+		name    string
+		dryRun  bool
+		leading bool
+		want    []call
+	}{
+		{"leader", false, true, []call{
+			{"records", time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), false},
+			{"broken", time.Date(2026, 3, 30, 12, 0, 0, 0, time.UTC), false},
+			{"images", time.Date(2026, 3, 24, 12, 0, 0, 0, time.UTC), false},
+		}},
+		{"dry run", true, true, []call{
+			{"records", time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), true},
+			{"broken", time.Date(2026, 3, 30, 12, 0, 0, 0, time.UTC), true},
+			{"images", time.Date(2026, 3, 24, 12, 0, 0, 0, time.UTC), true},
+		}},
+		// Other workers prune their own storage only.
+		{"follower", false, false, []call{
+			{"images", time.Date(2026, 3, 24, 12, 0, 0, 0, time.UTC), false},
+		}},
+	} {
+		calls = nil
+		r := &Runner{cfg: config.RetentionConfig{DryRun: tc.dryRun}, logger: zap.NewNop()}
+		r.apply(context.Background(), now, rules, tc.leading)
+		if !slices.Equal(calls, tc.want) {
+			t.Errorf("%s: calls = %v, want %v", tc.name, calls, tc.want)
+		}
+	}
+}
+
+func TestRulesShared(t *testing.T) {
+	r := &Runner{}
+	var local []string
+	for _, rule := range r.rules() {
+		if !rule.shared {
+			local = append(local, rule.name)
+		}
+	}
+	if !slices.Equal(local, []string{"cache_mounts", "local_images", "build_reports", "diagnostic_bundles"}) {
+		t.Errorf("rules applied on every worker = %v, want the storage ones", local)
+	}
+}
+
+// writeAged writes files into dir last modified age ago.
+func writeAged(t *testing.T, dir string, age time.Duration, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(-age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// remaining lists the files left in dir.
+func remaining(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestReportRetention(t *testing.T) {
+	dir := t.TempDir()
+	writeAged(t, dir, 40*24*time.Hour, "old-1.json.zst", "old-2.json")
+	writeAged(t, dir, time.Hour, "new-3.json.zst")
+
+	r := &Runner{cfg: config.RetentionConfig{ReportDays: 30, DryRun: true}, reportDir: dir, logger: zap.NewNop()}
+	r.apply(context.Background(), time.Now(), r.rules(), false)
+	if got := remaining(t, dir); len(got) != 3 {
+		t.Errorf("dry run removed reports: %v left", got)
+	}
+
+	r.cfg.DryRun = false
+	r.apply(context.Background(), time.Now(), r.rules(), false)
+	if got := remaining(t, dir); !slices.Equal(got, []string{"new-3.json.zst"}) {
+		t.Errorf("reports left = %v, want the recent one", got)
+	}
+}
+
+func TestDiagnosticsRetention(t *testing.T) {
+	dir := t.TempDir()
+	writeAged(t, dir, 20*24*time.Hour, "job1-api-1.tar.gz")
+	writeAged(t, dir, 24*time.Hour, "job2-web-2.tar.gz")
+
+	// Reports are kept forever; bundles for 14 days.
+	r := &Runner{cfg: config.RetentionConfig{DiagnosticsDays: 14}, reportDir: dir, diagnosticsDir: dir, logger: zap.NewNop()}
+	r.apply(context.Background(), time.Now(), r.rules(), false)
+	if got := remaining(t, dir); !slices.Equal(got, []string{"job2-web-2.tar.gz"}) {
+		t.Errorf("bundles left = %v, want the recent one", got)
+	}
+}
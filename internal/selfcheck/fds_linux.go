@@ -0,0 +1,20 @@
+package selfcheck
+
+import (
+	"os"
+	"syscall"
+)
+
+// openFDs returns the number of open file descriptors and the soft
+// RLIMIT_NOFILE, or -1 when unknown.
+func openFDs() (open, limit int) {
+	open, limit = -1, -1
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		open = len(entries) - 1 // the descriptor ReadDir itself held
+	}
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err == nil && rl.Cur < 1<<31 {
+		limit = int(rl.Cur)
+	}
+	return open, limit
+}
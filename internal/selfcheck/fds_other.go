@@ -0,0 +1,8 @@
+//go:build !linux
+
+package selfcheck
+
+// openFDs reports unknown outside Linux; services only run on Linux.
+func openFDs() (open, limit int) {
+	return -1, -1
+}
@@ -0,0 +1,160 @@
+// Package selfcheck periodically samples the process's goroutines, open
+// file descriptors and NATS subscriptions, warning when they cross a
+// threshold or keep growing. The latest sample is published as the
+// "selfcheck" expvar.
+package selfcheck
+
+import (
+	"context"
+	"expvar"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	metricspkg "github.com/jorgerua/build-system/container-build-service/internal/metrics"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Sample is one measurement. Unknown values are -1.
+type Sample struct {
+	Goroutines        int       `json:"goroutines"`
+	OpenFDs           int       `json:"open_fds"`
+	FDLimit           int       `json:"fd_limit"`
+	NATSSubscriptions int       `json:"nats_subscriptions"`
+	Time              time.Time `json:"time"`
+}
+
+var (
+	latest      atomic.Pointer[Sample]
+	publishOnce sync.Once
+)
+
+// Monitor runs the self-check.
+type Monitor struct {
+	cfg     config.SelfCheckConfig
+	nc      *nats.Conn
+	metrics *metricspkg.RuntimeMetrics
+	logger  *zap.Logger
+
+	prev    Sample
+	streaks map[string]int // consecutive increases per resource
+}
+
+// New creates a Monitor and schedules it on the fx lifecycle.
+func New(cfg *config.Config, nc *nats.Conn, metrics *metricspkg.RuntimeMetrics, logger *zap.Logger, lc fx.Lifecycle) *Monitor {
+	m := &Monitor{
+		cfg:     cfg.SelfCheck,
+		nc:      nc,
+		metrics: metrics,
+		logger:  logger.Named("selfcheck"),
+		streaks: make(map[string]int),
+	}
+	publishOnce.Do(func() {
+		expvar.Publish("selfcheck", expvar.Func(func() any { return latest.Load() }))
+	})
+	if m.cfg.IntervalSeconds <= 0 {
+		return m
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			go func() {
+				defer close(done)
+				m.loop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			cancel()
+			<-done
+			return nil
+		},
+	})
+	return m
+}
+
+func (m *Monitor) loop(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(m.cfg.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.check(m.sample())
+		}
+	}
+}
+
+func (m *Monitor) sample() Sample {
+	s := Sample{
+		Goroutines:        runtime.NumGoroutine(),
+		NATSSubscriptions: -1,
+		Time:              time.Now().UTC(),
+	}
+	s.OpenFDs, s.FDLimit = openFDs()
+	if m.nc != nil {
+		s.NATSSubscriptions = m.nc.NumSubscriptions()
+	}
+	return s
+}
+
+// check records a sample and returns the warnings it raised, as
+// "resource:reason" strings.
+func (m *Monitor) check(s Sample) []string {
+	latest.Store(&s)
+	m.metrics.Resources(s.Goroutines, s.OpenFDs, s.NATSSubscriptions)
+
+	var warnings []string
+	warn := func(resource, reason string, fields ...zap.Field) {
+		warnings = append(warnings, resource+":"+reason)
+		m.metrics.ResourceWarning(resource, reason)
+		m.logger.Warn("resource "+reason, append(fields, zap.String("resource", resource))...)
+	}
+
+	if max := m.cfg.MaxGoroutines; max > 0 && s.Goroutines > max {
+		warn("goroutines", "threshold exceeded", zap.Int("value", s.Goroutines), zap.Int("max", max))
+	}
+	if s.OpenFDs >= 0 && s.FDLimit > 0 && s.OpenFDs*100 > s.FDLimit*m.cfg.MaxFDPercent {
+		warn("open_fds", "threshold exceeded", zap.Int("value", s.OpenFDs), zap.Int("limit", s.FDLimit),
+			zap.Int("max_percent", m.cfg.MaxFDPercent))
+	}
+	if max := m.cfg.MaxNATSSubscriptions; max > 0 && s.NATSSubscriptions > max {
+		warn("nats_subscriptions", "threshold exceeded", zap.Int("value", s.NATSSubscriptions), zap.Int("max", max))
+	}
+
+	if n := m.cfg.GrowthSamples; n > 0 && !m.prev.Time.IsZero() {
+		for _, r := range []struct {
+			name       string
+			prev, curr int
+		}{
+			{"goroutines", m.prev.Goroutines, s.Goroutines},
+			{"open_fds", m.prev.OpenFDs, s.OpenFDs},
+			{"nats_subscriptions", m.prev.NATSSubscriptions, s.NATSSubscriptions},
+		} {
+			if r.curr < 0 || r.curr <= r.prev {
+				m.streaks[r.name] = 0
+				continue
+			}
+			m.streaks[r.name]++
+			if m.streaks[r.name] == n {
+				warn(r.name, "growing steadily", zap.Int("value", r.curr), zap.Int("samples", n))
+				m.streaks[r.name] = 0
+			}
+		}
+	}
+	m.prev = s
+	return warnings
+}
+
+// Module provides and starts the self-check Monitor via fx.
+var Module = fx.Module("selfcheck",
+	fx.Provide(metricspkg.NewRuntimeMetrics, New),
+	fx.Invoke(func(*Monitor) {}),
+)
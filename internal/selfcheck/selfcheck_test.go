@@ -0,0 +1,52 @@
+package selfcheck
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	metricspkg "github.com/jorgerua/build-system/container-build-service/internal/metrics"
+	"go.uber.org/zap"
+)
+
+func newMonitor(cfg config.SelfCheckConfig) *Monitor {
+	return &Monitor{
+		cfg:     cfg,
+		metrics: metricspkg.NewRuntimeMetrics(&statsd.NoOpClient{}),
+		logger:  zap.NewNop(),
+		streaks: make(map[string]int),
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	m := newMonitor(config.SelfCheckConfig{MaxGoroutines: 100, MaxFDPercent: 80, MaxNATSSubscriptions: 5})
+	got := m.check(Sample{Goroutines: 101, OpenFDs: 81, FDLimit: 100, NATSSubscriptions: 6, Time: time.Now()})
+	want := []string{"goroutines:threshold exceeded", "open_fds:threshold exceeded", "nats_subscriptions:threshold exceeded"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("warnings = %v, want %v", got, want)
+	}
+	if got := m.check(Sample{Goroutines: 10, OpenFDs: 80, FDLimit: 100, NATSSubscriptions: -1, Time: time.Now()}); len(got) != 0 {
+		t.Errorf("warnings under thresholds = %v", got)
+	}
+	if s := latest.Load(); s == nil || s.Goroutines != 10 {
+		t.Errorf("latest sample = %+v", s)
+	}
+}
+
+func TestCheckGrowth(t *testing.T) {
+	m := newMonitor(config.SelfCheckConfig{MaxFDPercent: 80, GrowthSamples: 3})
+	var warned []string
+	for i, g := range []int{10, 11, 12, 12, 13, 14, 15} {
+		for _, w := range m.check(Sample{Goroutines: g, OpenFDs: -1, NATSSubscriptions: 2, Time: time.Now()}) {
+			warned = append(warned, w)
+			if i != 6 {
+				t.Errorf("sample %d warned %q", i, w)
+			}
+		}
+	}
+	if len(warned) != 1 || warned[0] != "goroutines:growing steadily" {
+		t.Errorf("warnings = %v, want one growth warning", warned)
+	}
+}
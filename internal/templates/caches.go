@@ -0,0 +1,77 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/detection"
+)
+
+// Cache is a persistent cache directory mounted into a template's build
+// step (RUN --mount=type=cache), shared by the builds that use its ID.
+type Cache struct {
+	ID     string // the buildah cache ID
+	Target string // mount path in the builder stage
+	Env    string // if set, exported to the step with Target as its value
+}
+
+// Names of the built-in dependency caches, the keys of
+// buildah.cache_paths.
+const (
+	CacheGoMod   = "go-mod"
+	CacheGoBuild = "go-build"
+	CacheMaven   = "maven"
+	CacheGradle  = "gradle"
+	CacheNuGet   = "nuget"
+)
+
+// languageCaches are the dependency caches of each build tool, at their
+// default paths.
+var languageCaches = map[detection.BuildTool][]Cache{
+	detection.BuildToolGo: {
+		{ID: CacheGoMod, Target: "/go/pkg/mod", Env: "GOMODCACHE"},
+		{ID: CacheGoBuild, Target: "/root/.cache/go-build", Env: "GOCACHE"},
+	},
+	// Maven has no variable for its local repository; the template passes
+	// -Dmaven.repo.local.
+	detection.BuildToolMaven:  {{ID: CacheMaven, Target: "/root/.m2/repository"}},
+	detection.BuildToolGradle: {{ID: CacheGradle, Target: "/root/.gradle-cache", Env: "GRADLE_USER_HOME"}},
+	detection.BuildToolDotNet: {{ID: CacheNuGet, Target: "/root/.nuget/packages", Env: "NUGET_PACKAGES"}},
+}
+
+// LanguageCaches returns the dependency caches of buildTool, with the
+// mount paths in paths (by cache name) overriding the defaults.
+func LanguageCaches(buildTool detection.BuildTool, paths map[string]string) []Cache {
+	caches := make([]Cache, 0, len(languageCaches[buildTool]))
+	for _, c := range languageCaches[buildTool] {
+		if p := paths[c.ID]; p != "" {
+			c.Target = p
+		}
+		caches = append(caches, c)
+	}
+	return caches
+}
+
+// cachePath returns the mount path of the cache with id, or "".
+func cachePath(caches []Cache, id string) string {
+	for _, c := range caches {
+		if c.ID == id {
+			return c.Target
+		}
+	}
+	return ""
+}
+
+// withMounts returns the prefix of a RUN instruction that mounts caches
+// and secrets and exports their variables.
+func withMounts(caches []Cache, secrets []Secret) string {
+	var mounts, exports strings.Builder
+	for _, c := range caches {
+		fmt.Fprintf(&mounts, "--mount=type=cache,id=%s,target=%s ", c.ID, c.Target)
+		if c.Env != "" {
+			fmt.Fprintf(&exports, "export %s=%s && ", c.Env, c.Target)
+		}
+	}
+	secretFlags, secretExports := secretMounts(secrets)
+	return mounts.String() + secretFlags + exports.String() + secretExports
+}
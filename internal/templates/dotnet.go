@@ -0,0 +1,40 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CacheDotNetWorkloads names the cache of user-local .NET workloads.
+const CacheDotNetWorkloads = "dotnet-workloads"
+
+// DotNetWorkloadsCache is mounted for DotNet.Workloads. Its path is fixed:
+// the SDK installs user-local workloads into $HOME/.dotnet.
+var DotNetWorkloadsCache = Cache{ID: CacheDotNetWorkloads, Target: "/root/.dotnet"}
+
+// dotnetRoot is the SDK's install directory in the builder image.
+const dotnetRoot = "/usr/share/dotnet"
+
+// dotnetSetup returns the commands run before dotnet restore: the NuGet
+// and MSBuild variables of d and, with d.Workloads, the workload restore.
+// With the workloads cache mounted, the SDK's feature band is switched to
+// user-local installs first, so workloads land in the cache instead of the
+// image's SDK directory.
+func dotnetSetup(d DotNet, caches []Cache) string {
+	var b strings.Builder
+	if len(d.FallbackFolders) > 0 {
+		fmt.Fprintf(&b, "export NUGET_FALLBACK_PACKAGES='%s' && ", strings.Join(d.FallbackFolders, ";"))
+	}
+	if !d.NodeReuse {
+		b.WriteString("export MSBUILDDISABLENODEREUSE=1 && ")
+	}
+	if d.Workloads {
+		if cachePath(caches, CacheDotNetWorkloads) != "" {
+			// The marker is per feature band, e.g. 8.0.400 for SDK 8.0.404.
+			b.WriteString(`band=$(dotnet --version | sed 's/[0-9][0-9]$/00/') && `)
+			fmt.Fprintf(&b, `mkdir -p %[1]s/metadata/workloads/$band && touch %[1]s/metadata/workloads/$band/userlocal && `, dotnetRoot)
+		}
+		b.WriteString("dotnet workload restore && ")
+	}
+	return b.String()
+}
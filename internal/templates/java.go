@@ -0,0 +1,127 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Gradle holds the Gradle build settings; see config.GradleConfig.
+type Gradle struct {
+	BuildCache bool // --build-cache
+	// RemoteCacheURL is an HTTP build cache used next to the local one;
+	// RemoteCachePush also stores task outputs in it.
+	RemoteCacheURL  string
+	RemoteCachePush bool
+}
+
+// mavenServers returns the secrets that authenticate Maven servers.
+func mavenServers(secrets []Secret) []Secret {
+	var servers []Secret
+	for _, s := range secrets {
+		if s.MavenServer != "" && s.Env != "" {
+			servers = append(servers, s)
+		}
+	}
+	return servers
+}
+
+// mavenSettings returns the settings.xml of vars' Maven build, or "" when
+// it needs none: the mirror of every repository, a server per build secret
+// with a MavenServer, its password read from the secret's variable, and
+// the local repository in the maven cache.
+func mavenSettings(vars TemplateVars) string {
+	servers := mavenServers(vars.Secrets)
+	localRepo := cachePath(vars.Caches, CacheMaven)
+	if vars.Proxy.MavenMirror == "" && len(servers) == 0 && localRepo == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<settings>\n")
+	if localRepo != "" {
+		fmt.Fprintf(&b, "  <localRepository>%s</localRepository>\n", xmlEscape(localRepo))
+	}
+	if len(servers) > 0 {
+		b.WriteString("  <servers>\n")
+		for _, s := range servers {
+			fmt.Fprintf(&b, "    <server>\n      <id>%s</id>\n      <username>%s</username>\n      <password>${env.%s}</password>\n    </server>\n",
+				xmlEscape(s.MavenServer), xmlEscape(s.MavenUsername), s.Env)
+		}
+		b.WriteString("  </servers>\n")
+	}
+	if mirror := vars.Proxy.MavenMirror; mirror != "" {
+		b.WriteString(`  <mirrors>
+    <mirror>
+      <id>proxy</id>
+      <mirrorOf>*</mirrorOf>
+      <url>` + xmlEscape(mirror) + `</url>
+    </mirror>
+  </mirrors>
+`)
+	}
+	b.WriteString("</settings>\n")
+	return b.String()
+}
+
+// gradleInit returns the init script of vars' Gradle build, or "" when it
+// needs none. Like the Maven settings, it points every Maven repository at
+// the mirror, authenticates repositories named after a secret's
+// MavenServer (with a mirror, "proxy" authenticates all of them) and adds
+// the remote build cache.
+func gradleInit(vars TemplateVars) string {
+	servers := mavenServers(vars.Secrets)
+	mirror, remote := vars.Proxy.MavenMirror, vars.Gradle.RemoteCacheURL
+	if mirror == "" && len(servers) == 0 && remote == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("// Generated by container-build-service.\n")
+	if mirror != "" || len(servers) > 0 {
+		fmt.Fprintf(&b, "def mirror = %s\n", groovyString(mirror))
+		b.WriteString("def servers = [\n")
+		for _, s := range servers {
+			fmt.Fprintf(&b, "    %s: [%s, %s],\n", groovyString(s.MavenServer), groovyString(s.MavenUsername), groovyString(s.Env))
+		}
+		b.WriteString(`]
+def configureRepositories = { RepositoryHandler repositories ->
+    repositories.withType(MavenArtifactRepository).configureEach { repo ->
+        def server = servers[repo.name]
+        if (mirror) {
+            repo.url = mirror
+            server = servers['proxy'] ?: server
+        }
+        if (server) {
+            repo.credentials {
+                username = server[0]
+                password = System.getenv(server[1])
+            }
+        }
+    }
+}
+beforeSettings { settings ->
+    configureRepositories(settings.pluginManagement.repositories)
+    configureRepositories(settings.dependencyResolutionManagement.repositories)
+}
+allprojects {
+    configureRepositories(buildscript.repositories)
+    configureRepositories(repositories)
+}
+`)
+	}
+	if remote != "" {
+		fmt.Fprintf(&b, `settingsEvaluated { settings ->
+    settings.buildCache {
+        remote(HttpBuildCache) {
+            url = %s
+            push = %t
+        }
+    }
+}
+`, groovyString(remote), vars.Gradle.RemoteCachePush)
+	}
+	return b.String()
+}
+
+// groovyString quotes s as a Groovy string literal without interpolation.
+func groovyString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`).Replace(s) + "'"
+}
@@ -0,0 +1,58 @@
+package templates
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+	"text/template"
+)
+
+// Proxy routes a build's dependency downloads through internal proxies.
+// Empty fields leave the tool's default source in place.
+type Proxy struct {
+	GoProxy     string // GOPROXY, e.g. "https://athens.internal"
+	GoSumDB     string // GOSUMDB, e.g. "off" where sum.golang.org is unreachable
+	MavenMirror string // mirror of every Maven repository
+	NuGetSource string // replaces every NuGet package source
+}
+
+// funcs are the helpers available to Dockerfile templates. Generated
+// files are passed base64-encoded so no value needs shell quoting.
+var funcs = template.FuncMap{
+	"mavenSettings": func(vars TemplateVars) string { return encodeNonEmpty(mavenSettings(vars)) },
+	"gradleInit":    func(vars TemplateVars) string { return encodeNonEmpty(gradleInit(vars)) },
+	"nugetConfig":   func(source string) string { return encodeFile(nugetConfig(source)) },
+	"withMounts":    withMounts,
+	"cachePath":     cachePath,
+	"dotnetSetup":   dotnetSetup,
+}
+
+// nugetConfig returns a NuGet.Config replacing every package source.
+func nugetConfig(source string) string {
+	return `<?xml version="1.0" encoding="utf-8"?>
+<configuration>
+  <packageSources>
+    <clear />
+    <add key="proxy" value="` + xmlEscape(source) + `" />
+  </packageSources>
+</configuration>
+`
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func encodeFile(content string) string {
+	return base64.StdEncoding.EncodeToString([]byte(content))
+}
+
+// encodeNonEmpty is encodeFile, keeping "" for a file not generated.
+func encodeNonEmpty(content string) string {
+	if content == "" {
+		return ""
+	}
+	return encodeFile(content)
+}
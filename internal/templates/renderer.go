@@ -17,6 +17,40 @@ type TemplateVars struct {
 	ProjectName    string // e.g. "api"
 	ProjectSubpath string // e.g. "apps/api"
 	ArtifactName   string // e.g. "api" or "api-1.0.0.jar"
+	Proxy          Proxy
+	// BuildArgs are declared with ARG in the builder stage, making them
+	// environment variables of its build steps.
+	BuildArgs []string
+	// Secrets are mounted into the builder stage's build step.
+	Secrets []Secret
+	// Caches are mounted into the builder stage's build step; see
+	// LanguageCaches.
+	Caches []Cache
+	// DotNet tunes the build step of .NET images.
+	DotNet DotNet
+	// Go sets the Go environment of Go images' builder stage.
+	Go Go
+	// Gradle tunes the build step of Gradle images.
+	Gradle Gradle
+}
+
+// Go holds the Go build variables; empty fields keep the toolchain's
+// defaults.
+type Go struct {
+	Flags     string // GOFLAGS
+	Private   string // GOPRIVATE
+	NoProxy   string // GONOPROXY
+	NoSumDB   string // GONOSUMDB
+	Toolchain string // GOTOOLCHAIN
+}
+
+// DotNet holds the .NET build settings; see config.DotNetConfig.
+type DotNet struct {
+	FallbackFolders []string // NUGET_FALLBACK_PACKAGES
+	NodeReuse       bool     // unset MSBUILDDISABLENODEREUSE
+	// Workloads runs dotnet workload restore, installing user-local
+	// workloads into the CacheDotNetWorkloads cache when it is mounted.
+	Workloads bool
 }
 
 var templateNames = map[detection.BuildTool]string{
@@ -38,7 +72,7 @@ func Render(buildTool detection.BuildTool, vars TemplateVars) (string, error) {
 		return "", fmt.Errorf("read template %q: %w", tmplName, err)
 	}
 
-	tmpl, err := template.New(tmplName).Parse(string(tmplContent))
+	tmpl, err := template.New(tmplName).Funcs(funcs).Parse(string(tmplContent))
 	if err != nil {
 		return "", fmt.Errorf("parse template %q: %w", tmplName, err)
 	}
@@ -77,3 +77,214 @@ func TestRender(t *testing.T) {
 		t.Error("expected error for unknown build tool")
 	}
 }
+
+func TestRenderProxy(t *testing.T) {
+	vars := TemplateVars{ProjectName: "api", ProjectSubpath: "apps/api", ArtifactName: "api"}
+	for _, tool := range []detection.BuildTool{detection.BuildToolGo, detection.BuildToolMaven, detection.BuildToolDotNet} {
+		out, err := Render(tool, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(out, "GOPROXY") || strings.Contains(out, "base64") {
+			t.Errorf("%s: proxy settings rendered without a proxy:\n%s", tool, out)
+		}
+	}
+
+	vars.Proxy = Proxy{
+		GoProxy:     "https://athens.internal,off",
+		GoSumDB:     "off",
+		MavenMirror: "https://nexus.internal/repository/maven-public/?a=1&b=2",
+		NuGetSource: "https://nexus.internal/repository/nuget/index.json",
+	}
+	out, _ := Render(detection.BuildToolGo, vars)
+	if !strings.Contains(out, "WORKDIR /src\nENV GOPROXY=https://athens.internal,off\nENV GOSUMDB=off\n") {
+		t.Errorf("go proxy not set in builder stage:\n%s", out)
+	}
+	out, _ = Render(detection.BuildToolMaven, vars)
+	settings := encodeFile(mavenSettings(vars))
+	if !strings.Contains(out, "echo "+settings+" | base64 -d > /root/.m2/settings.xml") ||
+		!strings.Contains(mavenSettings(vars), "maven-public/?a=1&amp;b=2</url>") {
+		t.Errorf("maven settings not written:\n%s", out)
+	}
+	out, _ = Render(detection.BuildToolDotNet, vars)
+	if !strings.Contains(out, "echo "+encodeFile(nugetConfig(vars.Proxy.NuGetSource))+" | base64 -d > /root/.nuget/NuGet/NuGet.Config") {
+		t.Errorf("NuGet.Config not written:\n%s", out)
+	}
+}
+
+func TestRenderBuildArgs(t *testing.T) {
+	vars := TemplateVars{ProjectName: "api", ProjectSubpath: "apps/api", ArtifactName: "api", BuildArgs: []string{"GIT_COMMIT", "STAGE"}}
+	for tool := range templateNames {
+		out, err := Render(tool, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, "WORKDIR /src\nARG GIT_COMMIT\nARG STAGE\n") {
+			t.Errorf("%s: build args not declared in builder stage:\n%s", tool, out)
+		}
+	}
+}
+
+func TestRenderSecrets(t *testing.T) {
+	vars := TemplateVars{
+		ProjectName: "api", ProjectSubpath: "apps/api", ArtifactName: "api",
+		Secrets: []Secret{{ID: "npm", Env: "NPM_TOKEN"}, {ID: "pip"}},
+	}
+	want := `RUN --mount=type=secret,id=npm --mount=type=secret,id=pip export NPM_TOKEN="$(cat /run/secrets/npm)" && `
+	for tool := range templateNames {
+		out, err := Render(tool, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, want) {
+			t.Errorf("%s: secrets not mounted into the build step:\n%s", tool, out)
+		}
+		if strings.Count(out, "--mount=type=secret,id=npm ") != 1 {
+			t.Errorf("%s: secrets mounted into more than the build step:\n%s", tool, out)
+		}
+	}
+
+	vars.Secrets = nil
+	out, err := Render(detection.BuildToolGo, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "RUN CGO_ENABLED=0") {
+		t.Errorf("build step changed without secrets:\n%s", out)
+	}
+}
+
+func TestRenderCaches(t *testing.T) {
+	vars := TemplateVars{
+		ProjectName: "api", ProjectSubpath: "apps/api", ArtifactName: "api",
+		Secrets: []Secret{{ID: "npm", Env: "NPM_TOKEN"}},
+	}
+	for tool := range templateNames {
+		vars.Caches = append(LanguageCaches(tool, nil), Cache{ID: "acme/api/pip", Target: "/root/.cache/pip", Env: "PIP_CACHE_DIR"})
+		out, err := Render(tool, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, "--mount=type=cache,id=acme/api/pip,target=/root/.cache/pip --mount=type=secret,id=npm ") ||
+			!strings.Contains(out, `export PIP_CACHE_DIR=/root/.cache/pip && export NPM_TOKEN="$(cat /run/secrets/npm)" && `) {
+			t.Errorf("%s: caches not mounted into the build step:\n%s", tool, out)
+		}
+	}
+
+	vars.Caches = LanguageCaches(detection.BuildToolMaven, map[string]string{CacheMaven: "/cache/m2"})
+	out, err := Render(detection.BuildToolMaven, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "--mount=type=cache,id=maven,target=/cache/m2 ") || !strings.Contains(mavenSettings(vars), "<localRepository>/cache/m2</localRepository>") {
+		t.Errorf("maven cache path override not applied:\n%s", out)
+	}
+}
+
+func TestRenderDotNet(t *testing.T) {
+	vars := TemplateVars{ProjectName: "api", ProjectSubpath: "apps/api", ArtifactName: "api"}
+	out, err := Render(detection.BuildToolDotNet, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "RUN export MSBUILDDISABLENODEREUSE=1 && dotnet restore") {
+		t.Errorf("node reuse not disabled by default:\n%s", out)
+	}
+
+	vars.DotNet = DotNet{FallbackFolders: []string{"/opt/nuget/offline", "/opt/nuget/shared"}, NodeReuse: true, Workloads: true}
+	out, err = Render(detection.BuildToolDotNet, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "RUN export NUGET_FALLBACK_PACKAGES='/opt/nuget/offline;/opt/nuget/shared' && dotnet workload restore && dotnet restore") {
+		t.Errorf("uncached workload restore not rendered:\n%s", out)
+	}
+
+	vars.Caches = []Cache{DotNetWorkloadsCache}
+	out, err = Render(detection.BuildToolDotNet, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "--mount=type=cache,id=dotnet-workloads,target=/root/.dotnet ") ||
+		!strings.Contains(out, "touch /usr/share/dotnet/metadata/workloads/$band/userlocal && dotnet workload restore && ") {
+		t.Errorf("workloads not installed into the cache:\n%s", out)
+	}
+}
+
+func TestRenderNetrc(t *testing.T) {
+	vars := TemplateVars{
+		ProjectName: "api", ProjectSubpath: "apps/api", ArtifactName: "api",
+		Secrets: []Secret{{ID: "gh", NetrcMachine: "github.com", NetrcLogin: "x-access-token"}},
+	}
+	out, err := Render(detection.BuildToolGo, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `RUN --mount=type=secret,id=gh --mount=type=tmpfs,target=/run/netrc ` +
+		`printf 'machine github.com login x-access-token password %s\n' "$(cat /run/secrets/gh)" >> /run/netrc/netrc && ` +
+		`chmod 600 /run/netrc/netrc && ln -sf /run/netrc/netrc /root/.netrc && export NETRC=/run/netrc/netrc && CGO_ENABLED=0`
+	if !strings.Contains(out, want) {
+		t.Errorf(".netrc not generated in the build step:\n%s", out)
+	}
+}
+
+func TestRenderGo(t *testing.T) {
+	vars := TemplateVars{
+		ProjectName: "api", ProjectSubpath: "apps/api", ArtifactName: "api",
+		Go: Go{Flags: "-mod=mod -trimpath", Private: "github.com/acme/*", Toolchain: "local"},
+	}
+	out, err := Render(detection.BuildToolGo, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "ENV GOFLAGS=\"-mod=mod -trimpath\"\nENV GOPRIVATE=github.com/acme/*\nENV GOTOOLCHAIN=local\n") {
+		t.Errorf("Go variables not set:\n%s", out)
+	}
+	if strings.Contains(out, "GONOSUMDB") {
+		t.Errorf("unset Go variable rendered:\n%s", out)
+	}
+}
+
+func TestRenderJavaSettings(t *testing.T) {
+	vars := TemplateVars{ProjectName: "api", ProjectSubpath: "apps/api", ArtifactName: "api"}
+	for _, tool := range []detection.BuildTool{detection.BuildToolMaven, detection.BuildToolGradle} {
+		out, err := Render(tool, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(out, "base64") {
+			t.Errorf("%s: settings generated without any:\n%s", tool, out)
+		}
+	}
+
+	vars.Secrets = []Secret{{ID: "nexus", Env: "NEXUS_PASSWORD", MavenServer: "proxy", MavenUsername: "ci"}}
+	vars.Proxy.MavenMirror = "https://nexus.internal/repository/maven-public/"
+	vars.Gradle = Gradle{BuildCache: true, RemoteCacheURL: "https://gradle-cache.internal/cache/", RemoteCachePush: true}
+
+	settings := mavenSettings(vars)
+	if !strings.Contains(settings, "<id>proxy</id>\n      <username>ci</username>\n      <password>${env.NEXUS_PASSWORD}</password>") {
+		t.Errorf("maven server credentials not generated:\n%s", settings)
+	}
+
+	out, err := Render(detection.BuildToolGradle, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	init := gradleInit(vars)
+	if !strings.Contains(out, "echo "+encodeFile(init)+" | base64 -d > /etc/cbs/init.gradle") ||
+		!strings.Contains(out, "gradle build -x test --no-daemon --init-script /etc/cbs/init.gradle --build-cache") {
+		t.Errorf("gradle init script not applied:\n%s", out)
+	}
+	for _, want := range []string{
+		"def mirror = 'https://nexus.internal/repository/maven-public/'",
+		"'proxy': ['ci', 'NEXUS_PASSWORD'],",
+		"url = 'https://gradle-cache.internal/cache/'\n            push = true",
+	} {
+		if !strings.Contains(init, want) {
+			t.Errorf("init script missing %q:\n%s", want, init)
+		}
+	}
+	if got := groovyString(`a'b\c`); got != `'a\'b\\c'` {
+		t.Errorf("groovyString = %s", got)
+	}
+}
@@ -0,0 +1,47 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Secret is a build secret mounted into a template's build step.
+type Secret struct {
+	ID  string // read from /run/secrets/<ID>
+	Env string // if set, also exported to the step under this name
+	// NetrcMachine, if set, adds the secret to the step's .netrc as the
+	// password of NetrcLogin on this host, for tools such as go and git
+	// that authenticate from it.
+	NetrcMachine string
+	NetrcLogin   string
+	// MavenServer, if set, makes the secret the password of MavenUsername
+	// on the Maven server (Gradle repository) of this ID, read from Env.
+	MavenServer   string
+	MavenUsername string
+}
+
+// netrcDir is a tmpfs of the build step holding its generated .netrc.
+const netrcDir = "/run/netrc"
+
+// secretMounts returns the RUN flags mounting secrets and the commands
+// exporting those with an Env, so the step's commands see them without the
+// values being written to a layer. The .netrc of secrets with a
+// NetrcMachine is written to a tmpfs too, found through NETRC and a
+// symlink from $HOME.
+func secretMounts(secrets []Secret) (mounts, exports string) {
+	var m, e, netrc strings.Builder
+	for _, s := range secrets {
+		fmt.Fprintf(&m, "--mount=type=secret,id=%s ", s.ID)
+		if s.Env != "" {
+			fmt.Fprintf(&e, "export %s=\"$(cat /run/secrets/%s)\" && ", s.Env, s.ID)
+		}
+		if s.NetrcMachine != "" {
+			fmt.Fprintf(&netrc, "printf 'machine %s login %s password %%s\\n' \"$(cat /run/secrets/%s)\" >> %s/netrc && ", s.NetrcMachine, s.NetrcLogin, s.ID, netrcDir)
+		}
+	}
+	if netrc.Len() > 0 {
+		fmt.Fprintf(&m, "--mount=type=tmpfs,target=%s ", netrcDir)
+		fmt.Fprintf(&e, "%schmod 600 %[2]s/netrc && ln -sf %[2]s/netrc /root/.netrc && export NETRC=%[2]s/netrc && ", netrc.String(), netrcDir)
+	}
+	return m.String(), e.String()
+}
@@ -0,0 +1,79 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Annotation is a note attached to a build by a human or bot, e.g.
+// "retried due to registry outage".
+type Annotation struct {
+	ID        int64     `json:"id"`
+	BuildID   int64     `json:"build_id"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AnnotationRepository manages build annotations in TiDB.
+type AnnotationRepository struct {
+	db *sql.DB
+}
+
+// NewAnnotationRepository creates an AnnotationRepository.
+func NewAnnotationRepository(db *sql.DB) *AnnotationRepository {
+	return &AnnotationRepository{db: db}
+}
+
+// Add attaches an annotation to a build and returns it as stored.
+func (r *AnnotationRepository) Add(ctx context.Context, buildID int64, author, body string) (*Annotation, error) {
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO build_annotations (build_id, author, body) VALUES (?, ?, ?)`,
+		buildID, author, body,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert annotation: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("annotation id: %w", err)
+	}
+
+	a := Annotation{ID: id}
+	err = r.db.QueryRowContext(ctx,
+		`SELECT build_id, author, body, created_at FROM build_annotations WHERE id = ?`, id,
+	).Scan(&a.BuildID, &a.Author, &a.Body, &a.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("read annotation: %w", err)
+	}
+	return &a, nil
+}
+
+// List returns a build's annotations, oldest first.
+func (r *AnnotationRepository) List(ctx context.Context, buildID int64) ([]Annotation, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, build_id, author, body, created_at
+		FROM build_annotations
+		WHERE build_id = ?
+		ORDER BY id
+	`, buildID)
+	if err != nil {
+		return nil, fmt.Errorf("list annotations: %w", err)
+	}
+	defer rows.Close()
+
+	annotations := []Annotation{}
+	for rows.Next() {
+		var a Annotation
+		if err := rows.Scan(&a.ID, &a.BuildID, &a.Author, &a.Body, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan annotation: %w", err)
+		}
+		annotations = append(annotations, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("annotation rows: %w", err)
+	}
+	return annotations, nil
+}
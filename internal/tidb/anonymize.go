@@ -0,0 +1,132 @@
+package tidb
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// AnonymizedBuild is one NDJSON line of an anonymized export: a build's
+// durations, sizes and outcome, without repository, project, commit or
+// worker names, image references or free-text failure hints.
+// Identifiers are keyed hashes, so builds of one project can still be
+// grouped; timestamps are truncated to the hour.
+type AnonymizedBuild struct {
+	Repo            string    `json:"repo"`
+	Project         string    `json:"project"`
+	Commit          string    `json:"commit"`
+	Worker          string    `json:"worker,omitempty"`
+	Status          string    `json:"status"`
+	Attempts        int       `json:"attempts"`
+	Flaky           bool      `json:"flaky"`
+	FailureCategory string    `json:"failure_category,omitempty"`
+	DurationMS      *int64    `json:"duration_ms,omitempty"`
+	QueueWaitMS     *int64    `json:"queue_wait_ms,omitempty"`
+	CPUSeconds      *float64  `json:"cpu_seconds,omitempty"`
+	ImageBytes      *int64    `json:"image_bytes,omitempty"`
+	LogDroppedBytes *int64    `json:"log_dropped_bytes,omitempty"`
+	ClaimedHour     time.Time `json:"claimed_hour"`
+}
+
+// Anonymizer hashes identifiers with a secret key. Unkeyed hashes of
+// public repository names could be reversed by hashing candidate names.
+type Anonymizer struct {
+	key []byte
+}
+
+// NewAnonymizer creates an Anonymizer. Exports with the same key hash
+// identifiers alike, so they can be compared.
+func NewAnonymizer(key []byte) *Anonymizer {
+	return &Anonymizer{key: key}
+}
+
+// id returns the hash of an identifier of the given kind, or "" for "".
+func (a *Anonymizer) id(kind, s string) string {
+	if s == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind + "\x00" + s))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// anonymizedRow is the build_records columns read by ExportAnonymized.
+type anonymizedRow struct {
+	repo, project, commitSHA, worker, status, failureCategory sql.NullString
+	attempts                                                  int
+	flaky                                                     bool
+	durationMS, imageBytes, logDropped                        sql.NullInt64
+	cpuSeconds                                                sql.NullFloat64
+	queuedAt                                                  sql.NullTime
+	claimedAt                                                 time.Time
+}
+
+// build anonymizes a row.
+func (a *Anonymizer) build(r anonymizedRow) AnonymizedBuild {
+	b := AnonymizedBuild{
+		Repo:            a.id("repo", r.repo.String),
+		Project:         a.id("project", r.repo.String+"\x00"+r.project.String),
+		Commit:          a.id("commit", r.commitSHA.String),
+		Worker:          a.id("worker", r.worker.String),
+		Status:          r.status.String,
+		Attempts:        r.attempts,
+		Flaky:           r.flaky,
+		FailureCategory: r.failureCategory.String,
+		ClaimedHour:     r.claimedAt.UTC().Truncate(time.Hour),
+	}
+	if r.durationMS.Valid {
+		b.DurationMS = &r.durationMS.Int64
+	}
+	if r.imageBytes.Valid {
+		b.ImageBytes = &r.imageBytes.Int64
+	}
+	if r.logDropped.Valid {
+		b.LogDroppedBytes = &r.logDropped.Int64
+	}
+	if r.cpuSeconds.Valid {
+		b.CPUSeconds = &r.cpuSeconds.Float64
+	}
+	if r.queuedAt.Valid {
+		wait := max(r.claimedAt.Sub(r.queuedAt.Time), 0).Milliseconds()
+		b.QueueWaitMS = &wait
+	}
+	return b
+}
+
+// ExportAnonymized writes every build record not deleted to w as NDJSON
+// AnonymizedBuild lines, for sharing performance data outside the
+// organization.
+func ExportAnonymized(ctx context.Context, db *sql.DB, w io.Writer, a *Anonymizer) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT repo, project, commit_sha, worker, status, failure_category, attempts, flaky,
+		       duration_ms, image_bytes, log_dropped_bytes, cpu_seconds, queued_at, claimed_at
+		FROM build_records
+		WHERE deleted_at IS NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("anonymized export: %w", err)
+	}
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	n := 0
+	for rows.Next() {
+		var r anonymizedRow
+		if err := rows.Scan(&r.repo, &r.project, &r.commitSHA, &r.worker, &r.status, &r.failureCategory, &r.attempts, &r.flaky,
+			&r.durationMS, &r.imageBytes, &r.logDropped, &r.cpuSeconds, &r.queuedAt, &r.claimedAt); err != nil {
+			return n, fmt.Errorf("anonymized export scan: %w", err)
+		}
+		if err := enc.Encode(a.build(r)); err != nil {
+			return n, fmt.Errorf("anonymized export encode: %w", err)
+		}
+		n++
+	}
+	return n, rows.Err()
+}
@@ -0,0 +1,53 @@
+package tidb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnonymizerBuild(t *testing.T) {
+	claimed := time.Date(2026, 10, 16, 12, 34, 56, 0, time.UTC)
+	row := anonymizedRow{
+		repo:       sql.NullString{String: "acme/shop", Valid: true},
+		project:    sql.NullString{String: "services/cart", Valid: true},
+		commitSHA:  sql.NullString{String: "0123456789abcdef0123456789abcdef01234567", Valid: true},
+		worker:     sql.NullString{String: "worker-7", Valid: true},
+		status:     sql.NullString{String: "success", Valid: true},
+		attempts:   2,
+		durationMS: sql.NullInt64{Int64: 90000, Valid: true},
+		queuedAt:   sql.NullTime{Time: claimed.Add(-3 * time.Second), Valid: true},
+		claimedAt:  claimed,
+	}
+	a := NewAnonymizer([]byte("secret"))
+	b := a.build(row)
+
+	data, _ := json.Marshal(b)
+	for _, leak := range []string{"acme", "shop", "cart", "0123456789abcdef", "worker-7"} {
+		if strings.Contains(string(data), leak) {
+			t.Errorf("export leaks %q: %s", leak, data)
+		}
+	}
+	if *b.DurationMS != 90000 || *b.QueueWaitMS != 3000 || b.Attempts != 2 || b.Status != "success" {
+		t.Errorf("build = %s", data)
+	}
+	if !b.ClaimedHour.Equal(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("claimed_hour = %s", b.ClaimedHour)
+	}
+	if b.ImageBytes != nil || b.CPUSeconds != nil {
+		t.Errorf("unset columns exported: %s", data)
+	}
+
+	if again := a.build(row); again.Repo != b.Repo || again.Project != b.Project {
+		t.Error("same key hashed differently")
+	}
+	if other := NewAnonymizer([]byte("other")).build(row); other.Repo == b.Repo {
+		t.Error("different keys hashed alike")
+	}
+	row.repo.String = "acme/web"
+	if b2 := a.build(row); b2.Project == b.Project {
+		t.Error("same project path in another repository hashed alike")
+	}
+}
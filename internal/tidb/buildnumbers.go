@@ -0,0 +1,37 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// BuildNumberRepository hands out per-repository build numbers.
+type BuildNumberRepository struct {
+	db *sql.DB
+}
+
+// NewBuildNumberRepository creates a BuildNumberRepository.
+func NewBuildNumberRepository(db *sql.DB) *BuildNumberRepository {
+	return &BuildNumberRepository{db: db}
+}
+
+// Next returns the repository's next build number, starting at 1. Numbers
+// increase monotonically per repository ("owner/name", case-insensitive);
+// a number is consumed even if the build it was assigned to never runs.
+func (r *BuildNumberRepository) Next(ctx context.Context, repo string) (int64, error) {
+	// LAST_INSERT_ID(expr) makes the new value the statement's insert ID,
+	// so it is read back atomically without a second query.
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO build_numbers (repo, last_number) VALUES (?, LAST_INSERT_ID(1))
+		ON DUPLICATE KEY UPDATE last_number = LAST_INSERT_ID(last_number + 1)
+	`, NormalizeRepoName(repo))
+	if err != nil {
+		return 0, fmt.Errorf("next build number of %s: %w", repo, err)
+	}
+	n, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("next build number of %s: %w", repo, err)
+	}
+	return n, nil
+}
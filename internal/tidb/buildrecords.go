@@ -3,9 +3,14 @@ package tidb
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/buildwarn"
 )
 
 // BuildStatus represents the status of a build record.
@@ -15,6 +20,9 @@ const (
 	BuildStatusPending BuildStatus = "pending"
 	BuildStatusSuccess BuildStatus = "success"
 	BuildStatusFailure BuildStatus = "failure"
+	// BuildStatusExpired marks a record left pending past the job TTL,
+	// whose build no worker finished.
+	BuildStatusExpired BuildStatus = "expired"
 )
 
 // BuildRecord represents a row in build_records.
@@ -23,6 +31,7 @@ type BuildRecord struct {
 	Project   string
 	CommitSHA string
 	Status    BuildStatus
+	ClaimSeq  int64
 	ClaimedAt time.Time
 }
 
@@ -37,78 +46,676 @@ func NewBuildRecordRepository(db *sql.DB) *BuildRecordRepository {
 }
 
 // Claim attempts to atomically claim a (project, commitSHA) build slot.
+// repo ("owner/name") is recorded on the new record.
 //
-// Returns (true, nil) when the claim succeeds (this worker owns the build).
-// Returns (false, nil) when the build should be skipped (already claimed,
+// Returns (seq, true, nil) when the claim succeeds (this worker owns the
+// build). seq numbers the claims of the record: each re-claim of a stale
+// pending record increments it, and SetStatus and Release apply only under
+// the current claim, so a worker whose claim was taken over cannot finalize
+// or drop the new holder's build.
+// Returns (0, false, nil) when the build should be skipped (already claimed,
 // completed, or another worker won a re-claim race).
-func (r *BuildRecordRepository) Claim(ctx context.Context, project, commitSHA string, staleThreshold time.Duration) (bool, error) {
+func (r *BuildRecordRepository) Claim(ctx context.Context, project, commitSHA, repo string, staleThreshold time.Duration) (int64, bool, error) {
 	// Phase 1: atomic INSERT. INSERT … ON DUPLICATE KEY UPDATE with a no-op
 	// update returns affected=1 on insert, affected=0 on duplicate.
 	res, err := r.db.ExecContext(ctx, `
-		INSERT INTO build_records (project, commit_sha, status)
-		VALUES (?, ?, 'pending')
+		INSERT INTO build_records (project, commit_sha, repo, status)
+		VALUES (?, ?, ?, 'pending')
 		ON DUPLICATE KEY UPDATE id = id
-	`, project, commitSHA)
+	`, project, commitSHA, repo)
 	if err != nil {
-		return false, fmt.Errorf("build record insert: %w", err)
+		return 0, false, fmt.Errorf("build record insert: %w", err)
 	}
 
 	affected, err := res.RowsAffected()
 	if err != nil {
-		return false, fmt.Errorf("rows affected: %w", err)
+		return 0, false, fmt.Errorf("rows affected: %w", err)
 	}
 	if affected == 1 {
 		// Fresh insert — this worker owns the build.
-		return true, nil
+		return 1, true, nil
 	}
 
 	// Phase 2: duplicate key — read the existing record.
 	var rec BuildRecord
 	err = r.db.QueryRowContext(ctx,
-		`SELECT id, status, claimed_at FROM build_records WHERE project = ? AND commit_sha = ?`,
+		`SELECT id, status, claim_seq, claimed_at FROM build_records WHERE project = ? AND commit_sha = ?`,
 		project, commitSHA,
-	).Scan(&rec.ID, &rec.Status, &rec.ClaimedAt)
+	).Scan(&rec.ID, &rec.Status, &rec.ClaimSeq, &rec.ClaimedAt)
 	if err != nil {
-		return false, fmt.Errorf("build record read: %w", err)
+		return 0, false, fmt.Errorf("build record read: %w", err)
 	}
 
 	switch rec.Status {
-	case BuildStatusSuccess, BuildStatusFailure:
+	case BuildStatusSuccess, BuildStatusFailure, BuildStatusExpired:
 		// Already completed — skip.
-		return false, nil
+		return 0, false, nil
 	case BuildStatusPending:
 		if time.Since(rec.ClaimedAt) < staleThreshold {
 			// Recent pending — another worker is actively processing.
-			return false, nil
+			return 0, false, nil
 		}
 		// Stale pending — attempt conditional re-claim.
 		upd, err := r.db.ExecContext(ctx, `
 			UPDATE build_records
-			SET claimed_at = NOW()
-			WHERE project = ? AND commit_sha = ? AND status = 'pending' AND claimed_at = ?
-		`, project, commitSHA, rec.ClaimedAt)
+			SET claimed_at = NOW(), claim_seq = claim_seq + 1
+			WHERE project = ? AND commit_sha = ? AND status = 'pending' AND claim_seq = ?
+		`, project, commitSHA, rec.ClaimSeq)
 		if err != nil {
-			return false, fmt.Errorf("re-claim update: %w", err)
+			return 0, false, fmt.Errorf("re-claim update: %w", err)
+		}
+		if rows, _ := upd.RowsAffected(); rows == 1 {
+			return rec.ClaimSeq + 1, true, nil
 		}
-		rows, _ := upd.RowsAffected()
-		return rows == 1, nil
 	}
 
-	return false, nil
+	return 0, false, nil
 }
 
-// SetStatus updates the final status (success or failure) of a build record.
-func (r *BuildRecordRepository) SetStatus(ctx context.Context, project, commitSHA string, status BuildStatus) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE build_records SET status = ? WHERE project = ? AND commit_sha = ?`,
-		string(status), project, commitSHA,
+// Reopen returns the failed and expired build records of a repository's
+// commit to pending, for a requeue, and returns their projects. A reopened
+// record has no worker until ClaimReopened hands it to one.
+func (r *BuildRecordRepository) Reopen(ctx context.Context, repo, commitSHA string) ([]string, error) {
+	const where = `repo = ? AND commit_sha = ? AND status IN ('failure', 'expired') AND deleted_at IS NULL`
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reopen builds: %w", err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, `SELECT project FROM build_records WHERE `+where+` ORDER BY project FOR UPDATE`, repo, commitSHA)
+	if err != nil {
+		return nil, fmt.Errorf("reopen builds: %w", err)
+	}
+	var projects []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("reopen builds scan: %w", err)
+		}
+		projects = append(projects, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reopen builds rows: %w", err)
+	}
+	if len(projects) == 0 {
+		return nil, nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE build_records
+		SET status = 'pending', claimed_at = NOW(), claim_seq = claim_seq + 1, worker = NULL,
+		    failure_category = NULL, failure_hint = NULL
+		WHERE `+where, repo, commitSHA); err != nil {
+		return nil, fmt.Errorf("reopen builds: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("reopen builds: %w", err)
+	}
+	return projects, nil
+}
+
+// ClaimReopened claims a record reopened by Reopen for worker, like Claim
+// does a new one. A record that was not reopened, or that another worker
+// has claimed since, is claimed by Claim.
+func (r *BuildRecordRepository) ClaimReopened(ctx context.Context, project, commitSHA, repo, worker string, staleThreshold time.Duration) (int64, bool, error) {
+	// Claim's fresh records are numbered 1 and get their worker right
+	// after; reopened ones are numbered above and have none.
+	const reopened = `project = ? AND commit_sha = ? AND status = 'pending' AND worker IS NULL AND claim_seq > 1`
+	var seq int64
+	err := r.db.QueryRowContext(ctx, `SELECT claim_seq FROM build_records WHERE `+reopened, project, commitSHA).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r.Claim(ctx, project, commitSHA, repo, staleThreshold)
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("reopened build record read: %w", err)
+	}
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE build_records
+		SET claimed_at = NOW(), claim_seq = claim_seq + 1, worker = ?
+		WHERE `+reopened+` AND claim_seq = ?
+	`, worker, project, commitSHA, seq)
+	if err != nil {
+		return 0, false, fmt.Errorf("reopened build claim: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return 0, false, nil // another worker won
+	}
+	return seq + 1, true, nil
+}
+
+// ErrIllegalTransition is returned when a status change is not allowed from
+// the record's current status.
+type ErrIllegalTransition struct {
+	From, To BuildStatus
+}
+
+func (e *ErrIllegalTransition) Error() string {
+	return fmt.Sprintf("illegal build status transition %s -> %s", e.From, e.To)
+}
+
+// ErrClaimSuperseded is returned when a pending record was re-claimed after
+// the caller's claim: the current holder owns the record's status.
+type ErrClaimSuperseded struct {
+	Claim, Current int64
+}
+
+func (e *ErrClaimSuperseded) Error() string {
+	return fmt.Sprintf("build claim %d superseded by claim %d", e.Claim, e.Current)
+}
+
+// CanTransition reports whether a record may move from s to next: pending
+// records complete as success or failure, and completed records are final.
+func (s BuildStatus) CanTransition(next BuildStatus) bool {
+	return s == BuildStatusPending && (next == BuildStatusSuccess || next == BuildStatusFailure)
+}
+
+// SetStatus moves a pending build record to its final status (success or
+// failure) under claim, the sequence number Claim returned. The update is
+// applied at most once: repeating the transition the record already made
+// under the same claim is a no-op, a record re-claimed since returns
+// *ErrClaimSuperseded and any other change returns *ErrIllegalTransition.
+func (r *BuildRecordRepository) SetStatus(ctx context.Context, project, commitSHA string, claim int64, status BuildStatus) error {
+	if !BuildStatusPending.CanTransition(status) {
+		return &ErrIllegalTransition{From: BuildStatusPending, To: status}
+	}
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE build_records SET status = ? WHERE project = ? AND commit_sha = ? AND status = 'pending' AND claim_seq = ?`,
+		string(status), project, commitSHA, claim,
+	)
+	if err != nil {
+		return fmt.Errorf("set build status: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return err
+	}
+
+	var (
+		current BuildStatus
+		seq     int64
 	)
+	err = r.db.QueryRowContext(ctx,
+		`SELECT status, claim_seq FROM build_records WHERE project = ? AND commit_sha = ?`,
+		project, commitSHA,
+	).Scan(&current, &seq)
 	if err != nil {
 		return fmt.Errorf("set build status: %w", err)
 	}
+	return statusConflict(current, seq, status, claim)
+}
+
+// statusConflict classifies a SetStatus that updated no row, given the
+// record's current status and claim.
+func statusConflict(current BuildStatus, seq int64, status BuildStatus, claim int64) error {
+	switch {
+	case seq != claim:
+		return &ErrClaimSuperseded{Claim: claim, Current: seq}
+	case current == status:
+		return nil
+	default:
+		return &ErrIllegalTransition{From: current, To: status}
+	}
+}
+
+// Release drops a pending claim, so the build can be claimed again at once
+// rather than after the stale claim threshold. A claim superseded by a
+// re-claim is left to its current holder.
+func (r *BuildRecordRepository) Release(ctx context.Context, project, commitSHA string, claim int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`DELETE FROM build_records WHERE project = ? AND commit_sha = ? AND status = 'pending' AND claim_seq = ?`,
+		project, commitSHA, claim,
+	)
+	if err != nil {
+		return fmt.Errorf("release build claim: %w", err)
+	}
+	return nil
+}
+
+// ExpirePendingBefore marks the records still pending that were claimed
+// before cutoff as expired. With dryRun it only counts them.
+func (r *BuildRecordRepository) ExpirePendingBefore(ctx context.Context, cutoff time.Time, dryRun bool) (int64, error) {
+	const where = `status = 'pending' AND claimed_at < ? AND deleted_at IS NULL`
+	if dryRun {
+		var n int64
+		if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM build_records WHERE `+where, cutoff).Scan(&n); err != nil {
+			return 0, fmt.Errorf("count stuck pending build records: %w", err)
+		}
+		return n, nil
+	}
+	res, err := r.db.ExecContext(ctx, `UPDATE build_records SET status = 'expired' WHERE `+where, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("expire pending build records: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// RecordFailure stores the diagnosis of a failed build.
+func (r *BuildRecordRepository) RecordFailure(ctx context.Context, project, commitSHA, category, hint string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE build_records SET failure_category = ?, failure_hint = ? WHERE project = ? AND commit_sha = ?`,
+		category, hint, project, commitSHA,
+	)
+	if err != nil {
+		return fmt.Errorf("record build failure: %w", err)
+	}
+	return nil
+}
+
+// RecordAttempts stores how many build attempts a record took, and the
+// branch it was built for. A build that succeeded only after a retry on the
+// same commit is flagged as flaky.
+func (r *BuildRecordRepository) RecordAttempts(ctx context.Context, project, commitSHA, branch string, attempts int, flaky bool) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE build_records SET attempts = ?, flaky = ?, branch = ? WHERE project = ? AND commit_sha = ?`,
+		attempts, flaky, branch, project, commitSHA,
+	)
+	if err != nil {
+		return fmt.Errorf("record build attempts: %w", err)
+	}
+	return nil
+}
+
+// RecordLogTruncation stores how many bytes of a build's output were
+// dropped by the log cap.
+func (r *BuildRecordRepository) RecordLogTruncation(ctx context.Context, project, commitSHA string, dropped int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE build_records SET log_dropped_bytes = ? WHERE project = ? AND commit_sha = ?`,
+		dropped, project, commitSHA,
+	)
+	if err != nil {
+		return fmt.Errorf("record log truncation: %w", err)
+	}
+	return nil
+}
+
+// RecordWarnings stores the warnings of a build's last attempt, replacing
+// those of earlier attempts.
+func (r *BuildRecordRepository) RecordWarnings(ctx context.Context, project, commitSHA string, warnings []buildwarn.Warning) error {
+	var data []byte
+	if len(warnings) > 0 {
+		var err error
+		if data, err = json.Marshal(warnings); err != nil {
+			return fmt.Errorf("record build warnings: %w", err)
+		}
+	}
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE build_records SET warnings = ? WHERE project = ? AND commit_sha = ?`,
+		data, project, commitSHA,
+	)
+	if err != nil {
+		return fmt.Errorf("record build warnings: %w", err)
+	}
+	return nil
+}
+
+// RecordDuration stores the wall-clock duration of the successful build attempt.
+func (r *BuildRecordRepository) RecordDuration(ctx context.Context, project, commitSHA string, d time.Duration) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE build_records SET duration_ms = ? WHERE project = ? AND commit_sha = ?`,
+		d.Milliseconds(), project, commitSHA,
+	)
+	if err != nil {
+		return fmt.Errorf("record build duration: %w", err)
+	}
+	return nil
+}
+
+// RecordCost stores the resources a successful build consumed and their
+// estimated price.
+func (r *BuildRecordRepository) RecordCost(ctx context.Context, project, commitSHA string, cpuSeconds float64, imageBytes int64, costUSD float64) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE build_records SET cpu_seconds = ?, image_bytes = ?, cost_usd = ? WHERE project = ? AND commit_sha = ?`,
+		cpuSeconds, imageBytes, costUSD, project, commitSHA,
+	)
+	if err != nil {
+		return fmt.Errorf("record build cost: %w", err)
+	}
+	return nil
+}
+
+// Usage is the aggregated build cost of a repository or owner.
+type Usage struct {
+	Key        string  `json:"key"` // "owner/name", or "owner" when grouped by owner
+	Builds     int64   `json:"builds"`
+	CPUSeconds float64 `json:"cpu_seconds"`
+	ImageBytes int64   `json:"image_bytes"`
+	CostUSD    float64 `json:"cost_usd"`
+}
+
+// UsageSince aggregates the recorded cost of builds updated since the given
+// time, per repository or, with byOwner, per repository owner. Builds
+// without a cost estimate are not counted. Results are ordered by cost,
+// highest first.
+func (r *BuildRecordRepository) UsageSince(ctx context.Context, since time.Time, byOwner bool) ([]Usage, error) {
+	key := "repo"
+	if byOwner {
+		key = "SUBSTRING_INDEX(repo, '/', 1)"
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+key+` AS k, COUNT(*), COALESCE(SUM(cpu_seconds), 0),
+		       COALESCE(SUM(image_bytes), 0), COALESCE(SUM(cost_usd), 0)
+		FROM build_records
+		WHERE repo IS NOT NULL AND cost_usd IS NOT NULL AND updated_at >= ?
+		GROUP BY k
+		ORDER BY SUM(cost_usd) DESC, k
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []Usage{}
+	for rows.Next() {
+		var u Usage
+		if err := rows.Scan(&u.Key, &u.Builds, &u.CPUSeconds, &u.ImageBytes, &u.CostUSD); err != nil {
+			return nil, fmt.Errorf("usage scan: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("usage rows: %w", err)
+	}
+	return usage, nil
+}
+
+// DurationP95 returns the 95th percentile duration over the last `window`
+// successful builds of the repository's project, along with the number of
+// samples used. Projects of the same name in other repositories do not
+// count.
+func (r *BuildRecordRepository) DurationP95(ctx context.Context, repo, project string, window int) (time.Duration, int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT duration_ms FROM build_records
+		WHERE repo = ? AND project = ? AND status = 'success' AND duration_ms IS NOT NULL
+		ORDER BY id DESC
+		LIMIT ?
+	`, repo, project, window)
+	if err != nil {
+		return 0, 0, fmt.Errorf("duration baseline: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []int64
+	for rows.Next() {
+		var ms int64
+		if err := rows.Scan(&ms); err != nil {
+			return 0, 0, fmt.Errorf("duration baseline scan: %w", err)
+		}
+		samples = append(samples, ms)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("duration baseline rows: %w", err)
+	}
+	return p95(samples), len(samples), nil
+}
+
+// p95 returns the nearest-rank 95th percentile of samples in milliseconds,
+// sorting them: the smallest sample at least 95% of them do not exceed. It
+// is 0 without samples.
+func p95(samples []int64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	idx := (len(samples)*95+99)/100 - 1 // rank ⌈0.95·n⌉, 1-based
+	return time.Duration(samples[idx]) * time.Millisecond
+}
+
+// DeleteCompletedBefore removes completed records with the given status last
+// updated before cutoff. With dryRun it only counts the matching records.
+// Pending and archived records are never removed.
+func (r *BuildRecordRepository) DeleteCompletedBefore(ctx context.Context, status BuildStatus, cutoff time.Time, dryRun bool) (int64, error) {
+	if status == BuildStatusPending {
+		return 0, fmt.Errorf("refusing to delete pending build records")
+	}
+	if dryRun {
+		var n int64
+		err := r.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM build_records WHERE status = ? AND updated_at < ? AND archived_at IS NULL`,
+			string(status), cutoff,
+		).Scan(&n)
+		if err != nil {
+			return 0, fmt.Errorf("count expired build records: %w", err)
+		}
+		return n, nil
+	}
+
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM build_records WHERE status = ? AND updated_at < ? AND archived_at IS NULL`,
+		string(status), cutoff,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired build records: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, r.deleteOrphanedAnnotations(ctx)
+}
+
+// deleteOrphanedAnnotations removes annotations whose build is gone:
+// annotations go with their build.
+func (r *BuildRecordRepository) deleteOrphanedAnnotations(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, `
+		DELETE a FROM build_annotations a
+		LEFT JOIN build_records r ON r.id = a.build_id
+		WHERE r.id IS NULL
+	`); err != nil {
+		return fmt.Errorf("delete orphaned annotations: %w", err)
+	}
+	return nil
+}
+
+// SoftDelete hides a build record from every lookup and listing and
+// schedules it, with its annotations, for purging by retention. It returns
+// sql.ErrNoRows when the build does not exist, is already deleted or is
+// still pending: purging an in-flight record would free its claim.
+func (r *BuildRecordRepository) SoftDelete(ctx context.Context, id int64) error {
+	return r.setLifecycle(ctx, "soft delete", id, `
+		UPDATE build_records SET deleted_at = NOW(), updated_at = updated_at
+		WHERE id = ? AND deleted_at IS NULL AND status <> 'pending'`)
+}
+
+// Archive keeps a completed build record past the retention ages and hides
+// it from repository listings; it can still be looked up by id or digest.
+// It returns sql.ErrNoRows when the build does not exist, is deleted, is
+// still pending or is already archived.
+func (r *BuildRecordRepository) Archive(ctx context.Context, id int64) error {
+	return r.setLifecycle(ctx, "archive", id, `
+		UPDATE build_records SET archived_at = NOW(), updated_at = updated_at
+		WHERE id = ? AND deleted_at IS NULL AND archived_at IS NULL AND status <> 'pending'`)
+}
+
+// Restore undoes SoftDelete and Archive on a build record that has not been
+// purged yet. It returns sql.ErrNoRows when the build does not exist or is
+// neither deleted nor archived.
+func (r *BuildRecordRepository) Restore(ctx context.Context, id int64) error {
+	return r.setLifecycle(ctx, "restore", id, `
+		UPDATE build_records SET deleted_at = NULL, archived_at = NULL, updated_at = updated_at
+		WHERE id = ? AND (deleted_at IS NOT NULL OR archived_at IS NOT NULL)`)
+}
+
+// setLifecycle runs a single-record update, mapping no affected row to
+// sql.ErrNoRows. The updates keep updated_at so retention ages are
+// unaffected.
+func (r *BuildRecordRepository) setLifecycle(ctx context.Context, op string, id int64, query string) error {
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("%s build %d: %w", op, id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PurgeDeletedBefore permanently removes build records soft-deleted before
+// cutoff, with their annotations. With dryRun it only counts them.
+func (r *BuildRecordRepository) PurgeDeletedBefore(ctx context.Context, cutoff time.Time, dryRun bool) (int64, error) {
+	if dryRun {
+		var n int64
+		err := r.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM build_records WHERE deleted_at < ?`, cutoff,
+		).Scan(&n)
+		if err != nil {
+			return 0, fmt.Errorf("count deleted build records: %w", err)
+		}
+		return n, nil
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM build_records WHERE deleted_at < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("purge deleted build records: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, r.deleteOrphanedAnnotations(ctx)
+}
+
+// ArchiveCompletedBefore archives completed records last updated before
+// cutoff. With dryRun it only counts them.
+func (r *BuildRecordRepository) ArchiveCompletedBefore(ctx context.Context, cutoff time.Time, dryRun bool) (int64, error) {
+	const where = `status <> 'pending' AND updated_at < ? AND archived_at IS NULL AND deleted_at IS NULL`
+	if dryRun {
+		var n int64
+		if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM build_records WHERE `+where, cutoff).Scan(&n); err != nil {
+			return 0, fmt.Errorf("count archivable build records: %w", err)
+		}
+		return n, nil
+	}
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE build_records SET archived_at = NOW(), updated_at = updated_at WHERE `+where, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("archive build records: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// RecordImage stores the provenance of the image pushed for a build record.
+func (r *BuildRecordRepository) RecordImage(ctx context.Context, project, commitSHA, repo, imageRef, digest, dockerfileSHA256 string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE build_records
+		SET repo = ?, image_ref = ?, image_digest = ?, dockerfile_sha256 = ?
+		WHERE project = ? AND commit_sha = ?
+	`, repo, imageRef, digest, dockerfileSHA256, project, commitSHA)
+	if err != nil {
+		return fmt.Errorf("record image: %w", err)
+	}
 	return nil
 }
 
+// Provenance links a pushed image back to the build that produced it.
+type Provenance struct {
+	BuildID          int64       `json:"build_id"`
+	BuildNumber      int64       `json:"build_number,omitempty"` // per repository
+	Project          string      `json:"project"`
+	Repo             string      `json:"repo"`
+	CommitSHA        string      `json:"commit_sha"`
+	Status           BuildStatus `json:"status"`
+	ImageRef         string      `json:"image_ref"`
+	ImageDigest      string      `json:"image_digest"`
+	DockerfileSHA256 string      `json:"dockerfile_sha256"`
+	FailureCategory  string      `json:"failure_category,omitempty"`
+	FailureHint      string      `json:"failure_hint,omitempty"`
+	// LogDroppedBytes is how much build output the log cap dropped.
+	LogDroppedBytes int64 `json:"log_dropped_bytes,omitempty"`
+	// Warnings are the non-fatal findings of the build's last attempt.
+	Warnings   []buildwarn.Warning `json:"warnings,omitempty"`
+	ClaimedAt  time.Time           `json:"claimed_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+	ArchivedAt *time.Time          `json:"archived_at,omitempty"`
+}
+
+// provenanceColumns selects a build_records row for scanProvenance.
+const provenanceColumns = `
+	id, COALESCE(build_number, 0), project, COALESCE(repo, ''), commit_sha, status,
+	COALESCE(image_ref, ''), COALESCE(image_digest, ''), COALESCE(dockerfile_sha256, ''),
+	COALESCE(failure_category, ''), COALESCE(failure_hint, ''), COALESCE(log_dropped_bytes, 0),
+	warnings, claimed_at, updated_at, archived_at`
+
+func scanProvenance(row interface{ Scan(...any) error }) (*Provenance, error) {
+	var (
+		p        Provenance
+		warnings []byte
+		archived sql.NullTime
+	)
+	err := row.Scan(&p.BuildID, &p.BuildNumber, &p.Project, &p.Repo, &p.CommitSHA, &p.Status,
+		&p.ImageRef, &p.ImageDigest, &p.DockerfileSHA256,
+		&p.FailureCategory, &p.FailureHint, &p.LogDroppedBytes, &warnings, &p.ClaimedAt, &p.UpdatedAt, &archived)
+	if err != nil {
+		return nil, err
+	}
+	if len(warnings) > 0 {
+		if err := json.Unmarshal(warnings, &p.Warnings); err != nil {
+			return nil, fmt.Errorf("build %d warnings: %w", p.BuildID, err)
+		}
+	}
+	if archived.Valid {
+		p.ArchivedAt = &archived.Time
+	}
+	return &p, nil
+}
+
+// FindByDigest returns the build that pushed the image with the given digest,
+// or sql.ErrNoRows if no build recorded it. Deleted builds are not returned.
+func (r *BuildRecordRepository) FindByDigest(ctx context.Context, digest string) (*Provenance, error) {
+	p, err := scanProvenance(r.db.QueryRowContext(ctx, `
+		SELECT `+provenanceColumns+`
+		FROM build_records
+		WHERE image_digest = ? AND deleted_at IS NULL
+		ORDER BY id DESC
+		LIMIT 1
+	`, digest))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find by digest: %w", err)
+	}
+	return p, nil
+}
+
+// FindByID returns the build record with the given id, or sql.ErrNoRows if
+// it does not exist or was deleted.
+func (r *BuildRecordRepository) FindByID(ctx context.Context, id int64) (*Provenance, error) {
+	p, err := scanProvenance(r.db.QueryRowContext(ctx,
+		`SELECT `+provenanceColumns+` FROM build_records WHERE id = ? AND deleted_at IS NULL`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find build %d: %w", id, err)
+	}
+	return p, nil
+}
+
+// RecentByRepo returns the most recently updated builds of a repository
+// ("owner/name"), newest first. Archived and deleted builds are left out.
+func (r *BuildRecordRepository) RecentByRepo(ctx context.Context, repo string, limit int) ([]Provenance, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+provenanceColumns+`
+		FROM build_records
+		WHERE repo = ? AND archived_at IS NULL AND deleted_at IS NULL
+		ORDER BY updated_at DESC, id DESC
+		LIMIT ?
+	`, repo, limit)
+	if err != nil {
+		return nil, fmt.Errorf("recent builds: %w", err)
+	}
+	defer rows.Close()
+
+	builds := []Provenance{}
+	for rows.Next() {
+		p, err := scanProvenance(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan build: %w", err)
+		}
+		builds = append(builds, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("recent build rows: %w", err)
+	}
+	return builds, nil
+}
+
 // GetStatus returns the current status of a build record, or ErrNoRows if not found.
 func (r *BuildRecordRepository) GetStatus(ctx context.Context, project, commitSHA string) (BuildStatus, error) {
 	var status BuildStatus
@@ -124,3 +731,37 @@ func (r *BuildRecordRepository) GetStatus(ctx context.Context, project, commitSH
 	}
 	return status, nil
 }
+
+// FailedCommits returns which of commitSHAs have a failed project build
+// that is not deleted.
+func (r *BuildRecordRepository) FailedCommits(ctx context.Context, commitSHAs []string) (map[string]bool, error) {
+	failed := map[string]bool{}
+	if len(commitSHAs) == 0 {
+		return failed, nil
+	}
+	args := make([]any, len(commitSHAs))
+	for i, sha := range commitSHAs {
+		args[i] = sha
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT DISTINCT commit_sha FROM build_records
+		WHERE status = 'failure' AND deleted_at IS NULL AND commit_sha IN (`+
+			strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")+`)`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed commits: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sha string
+		if err := rows.Scan(&sha); err != nil {
+			return nil, fmt.Errorf("failed commits scan: %w", err)
+		}
+		failed[sha] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed commits rows: %w", err)
+	}
+	return failed, nil
+}
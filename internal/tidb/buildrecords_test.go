@@ -0,0 +1,77 @@
+package tidb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBuildStatusCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to BuildStatus
+		want     bool
+	}{
+		{BuildStatusPending, BuildStatusSuccess, true},
+		{BuildStatusPending, BuildStatusFailure, true},
+		{BuildStatusPending, BuildStatusPending, false},
+		{BuildStatusSuccess, BuildStatusFailure, false},
+		{BuildStatusFailure, BuildStatusSuccess, false},
+		{BuildStatusSuccess, BuildStatusPending, false},
+	}
+	for _, tc := range tests {
+		if got := tc.from.CanTransition(tc.to); got != tc.want {
+			t.Errorf("%s -> %s: CanTransition = %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
+
+func TestStatusConflict(t *testing.T) {
+	var illegal *ErrIllegalTransition
+	var superseded *ErrClaimSuperseded
+
+	if err := statusConflict(BuildStatusSuccess, 1, BuildStatusSuccess, 1); err != nil {
+		t.Errorf("repeated transition: err = %v, want nil", err)
+	}
+	if err := statusConflict(BuildStatusSuccess, 1, BuildStatusFailure, 1); !errors.As(err, &illegal) {
+		t.Errorf("success -> failure: err = %v, want ErrIllegalTransition", err)
+	}
+	for _, current := range []BuildStatus{BuildStatusPending, BuildStatusSuccess} {
+		err := statusConflict(current, 2, BuildStatusSuccess, 1)
+		if !errors.As(err, &superseded) || superseded.Current != 2 {
+			t.Errorf("%s under claim 2: err = %v, want ErrClaimSuperseded by 2", current, err)
+		}
+	}
+}
+
+func TestP95(t *testing.T) {
+	// seq returns the samples 1..n ms, newest (largest) first.
+	seq := func(n int) []int64 {
+		s := make([]int64, n)
+		for i := range s {
+			s[i] = int64(n - i)
+		}
+		return s
+	}
+	tests := []struct {
+		name    string
+		samples []int64
+		want    time.Duration
+	}{
+		{"empty", nil, 0},
+		{"single", []int64{1200}, 1200 * time.Millisecond},
+		{"two", []int64{900, 100}, 900 * time.Millisecond},
+		{"unsorted", []int64{30, 10, 50, 20, 40}, 50 * time.Millisecond},
+		// Rank ⌈0.95·n⌉: exact at 20 and 100 samples, rounded up between.
+		{"19 samples", seq(19), 19 * time.Millisecond},
+		{"20 samples", seq(20), 19 * time.Millisecond},
+		{"21 samples", seq(21), 20 * time.Millisecond},
+		{"100 samples", seq(100), 95 * time.Millisecond},
+		{"101 samples", seq(101), 96 * time.Millisecond},
+		{"ties", []int64{5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 700}, 5 * time.Millisecond},
+	}
+	for _, tc := range tests {
+		if got := p95(tc.samples); got != tc.want {
+			t.Errorf("%s: p95 = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CacheSnapshot is the measured size of one worker cache. Hits, Misses and
+// Evictions count the cache's activity since the worker's previous
+// snapshot, for caches that track it.
+type CacheSnapshot struct {
+	Worker    string
+	Cache     string
+	Bytes     int64
+	Files     int64
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	TakenAt   time.Time
+}
+
+// CacheDay is one cache of one worker on one UTC day: its size at the day's
+// last snapshot and its activity over the day.
+type CacheDay struct {
+	Day       string   `json:"day"` // YYYY-MM-DD
+	Worker    string   `json:"worker"`
+	Cache     string   `json:"cache"`
+	Bytes     int64    `json:"bytes"`
+	Files     int64    `json:"files"`
+	Hits      int64    `json:"hits"`
+	Misses    int64    `json:"misses"`
+	Evictions int64    `json:"evictions"`
+	HitRate   *float64 `json:"hit_rate,omitempty"` // nil without lookups
+}
+
+// CacheSnapshotRepository manages cache size snapshots in TiDB.
+type CacheSnapshotRepository struct {
+	db *sql.DB
+}
+
+// NewCacheSnapshotRepository creates a CacheSnapshotRepository.
+func NewCacheSnapshotRepository(db *sql.DB) *CacheSnapshotRepository {
+	return &CacheSnapshotRepository{db: db}
+}
+
+// Record stores snapshots taken together.
+func (r *CacheSnapshotRepository) Record(ctx context.Context, snaps []CacheSnapshot) error {
+	if len(snaps) == 0 {
+		return nil
+	}
+	values := make([]string, len(snaps))
+	args := make([]any, 0, len(snaps)*8)
+	for i, s := range snaps {
+		values[i] = "(?, ?, ?, ?, ?, ?, ?, ?)"
+		args = append(args, s.Worker, s.Cache, s.Bytes, s.Files, s.Hits, s.Misses, s.Evictions, s.TakenAt)
+	}
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO cache_snapshots (worker, cache, bytes, files, hits, misses, evictions, taken_at) VALUES `+
+			strings.Join(values, ", "),
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("insert cache snapshots: %w", err)
+	}
+	return nil
+}
+
+// TrendSince returns the daily trend of every cache since since, oldest day
+// first. Non-empty cache and worker narrow it.
+func (r *CacheSnapshotRepository) TrendSince(ctx context.Context, since time.Time, cache, worker string) ([]CacheDay, error) {
+	query := `SELECT worker, cache, bytes, files, hits, misses, evictions, taken_at FROM cache_snapshots WHERE taken_at >= ?`
+	args := []any{since}
+	if cache != "" {
+		query, args = query+` AND cache = ?`, append(args, cache)
+	}
+	if worker != "" {
+		query, args = query+` AND worker = ?`, append(args, worker)
+	}
+	rows, err := r.db.QueryContext(ctx, query+` ORDER BY taken_at`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cache trend: %w", err)
+	}
+	defer rows.Close()
+
+	var snaps []CacheSnapshot
+	for rows.Next() {
+		var s CacheSnapshot
+		if err := rows.Scan(&s.Worker, &s.Cache, &s.Bytes, &s.Files, &s.Hits, &s.Misses, &s.Evictions, &s.TakenAt); err != nil {
+			return nil, fmt.Errorf("cache trend scan: %w", err)
+		}
+		snaps = append(snaps, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cache trend rows: %w", err)
+	}
+	return summarizeCacheTrend(snaps), nil
+}
+
+// summarizeCacheTrend groups snapshots, oldest first, by UTC day, worker and
+// cache.
+func summarizeCacheTrend(snaps []CacheSnapshot) []CacheDay {
+	days := map[string]*CacheDay{}
+	for _, s := range snaps {
+		day := s.TakenAt.UTC().Format(time.DateOnly)
+		key := day + "\x00" + s.Worker + "\x00" + s.Cache
+		d := days[key]
+		if d == nil {
+			d = &CacheDay{Day: day, Worker: s.Worker, Cache: s.Cache}
+			days[key] = d
+		}
+		d.Bytes, d.Files = s.Bytes, s.Files
+		d.Hits += s.Hits
+		d.Misses += s.Misses
+		d.Evictions += s.Evictions
+	}
+	out := make([]CacheDay, 0, len(days))
+	for _, d := range days {
+		if lookups := d.Hits + d.Misses; lookups > 0 {
+			rate := float64(d.Hits) / float64(lookups)
+			d.HitRate = &rate
+		}
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Cache != b.Cache {
+			return a.Cache < b.Cache
+		}
+		return a.Worker < b.Worker
+	})
+	return out
+}
+
+// DeleteBefore removes snapshots taken before cutoff. With dryRun it only
+// counts them.
+func (r *CacheSnapshotRepository) DeleteBefore(ctx context.Context, cutoff time.Time, dryRun bool) (int64, error) {
+	if dryRun {
+		var n int64
+		if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM cache_snapshots WHERE taken_at < ?`, cutoff).Scan(&n); err != nil {
+			return 0, fmt.Errorf("count expired cache snapshots: %w", err)
+		}
+		return n, nil
+	}
+	res, err := r.db.ExecContext(ctx, `DELETE FROM cache_snapshots WHERE taken_at < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired cache snapshots: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
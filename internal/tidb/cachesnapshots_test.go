@@ -0,0 +1,33 @@
+package tidb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarizeCacheTrend(t *testing.T) {
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	snaps := []CacheSnapshot{
+		{Worker: "w1", Cache: "results", Bytes: 100, Files: 1, Hits: 3, Misses: 1, TakenAt: day.Add(time.Hour)},
+		{Worker: "w1", Cache: "nx", Bytes: 500, Files: 10, TakenAt: day.Add(time.Hour)},
+		{Worker: "w1", Cache: "results", Bytes: 150, Files: 2, Hits: 1, Misses: 3, Evictions: 2, TakenAt: day.Add(20 * time.Hour)},
+		{Worker: "w1", Cache: "nx", Bytes: 700, Files: 12, TakenAt: day.Add(25 * time.Hour)},
+	}
+	got := summarizeCacheTrend(snaps)
+	if len(got) != 3 {
+		t.Fatalf("days = %+v, want 3", got)
+	}
+	if d := got[0]; d.Day != "2026-03-02" || d.Cache != "nx" || d.Bytes != 500 || d.HitRate != nil {
+		t.Errorf("first = %+v", d)
+	}
+	d := got[1]
+	if d.Cache != "results" || d.Bytes != 150 || d.Files != 2 || d.Hits != 4 || d.Misses != 4 || d.Evictions != 2 {
+		t.Errorf("results day = %+v", d)
+	}
+	if d.HitRate == nil || *d.HitRate != 0.5 {
+		t.Errorf("hit rate = %v, want 0.5", d.HitRate)
+	}
+	if d := got[2]; d.Day != "2026-03-03" || d.Bytes != 700 {
+		t.Errorf("last = %+v", d)
+	}
+}
@@ -4,21 +4,44 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jorgerua/build-system/container-build-service/internal/config"
 	"go.uber.org/fx"
 )
 
-// New opens a TiDB (MySQL-compatible) connection pool.
-func New(cfg *config.Config, lc fx.Lifecycle) (*sql.DB, error) {
-	db, err := sql.Open("mysql", cfg.TiDB.DSN)
+// Open opens and pings a TiDB (MySQL-compatible) connection pool.
+func Open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("tidb open: %w", err)
 	}
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("tidb ping: %w", err)
 	}
+	return db, nil
+}
+
+// migrateTimeout bounds the schema migration run on startup.
+const migrateTimeout = 5 * time.Minute
+
+// New opens a TiDB connection pool closed on fx shutdown, applying pending
+// schema migrations first with tidb.auto_migrate.
+func New(cfg *config.Config, lc fx.Lifecycle) (*sql.DB, error) {
+	db, err := Open(cfg.TiDB.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TiDB.AutoMigrate {
+		ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+		defer cancel()
+		if _, err := Migrate(ctx, db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
 
 	lc.Append(fx.Hook{
 		OnStop: func(_ context.Context) error {
@@ -0,0 +1,106 @@
+package tidb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// JobDuration is how long a completed build job took, from its first
+// project's claim to its last project's completion.
+type JobDuration struct {
+	Repo     string
+	Duration time.Duration
+}
+
+// JobDurationsSince returns the duration of every build job, one per
+// repository and commit, whose builds were claimed since the given time
+// and have all completed.
+func (r *BuildRecordRepository) JobDurationsSince(ctx context.Context, since time.Time) ([]JobDuration, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT repo, TIMESTAMPDIFF(SECOND, MIN(claimed_at), MAX(updated_at))
+		FROM build_records
+		WHERE claimed_at >= ? AND repo IS NOT NULL AND deleted_at IS NULL
+		GROUP BY repo, commit_sha
+		HAVING SUM(status = 'pending') = 0
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("job durations: %w", err)
+	}
+	defer rows.Close()
+	var out []JobDuration
+	for rows.Next() {
+		var (
+			d       JobDuration
+			seconds int64
+		)
+		if err := rows.Scan(&d.Repo, &seconds); err != nil {
+			return nil, fmt.Errorf("job durations scan: %w", err)
+		}
+		d.Duration = time.Duration(max(seconds, 0)) * time.Second
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("job durations rows: %w", err)
+	}
+	return out, nil
+}
+
+// RunningJob is a build job a worker is building.
+type RunningJob struct {
+	Repo      string
+	Worker    string
+	ClaimedAt time.Time
+}
+
+// RunningJobs returns the build jobs with a pending build claimed since
+// the given time; older claims are stale and presumed abandoned.
+func (r *BuildRecordRepository) RunningJobs(ctx context.Context, since time.Time) ([]RunningJob, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT repo, COALESCE(MAX(worker), ''), MIN(claimed_at)
+		FROM build_records
+		WHERE status = 'pending' AND claimed_at >= ? AND repo IS NOT NULL AND deleted_at IS NULL
+		GROUP BY repo, commit_sha
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("running jobs: %w", err)
+	}
+	defer rows.Close()
+	var out []RunningJob
+	for rows.Next() {
+		var j RunningJob
+		if err := rows.Scan(&j.Repo, &j.Worker, &j.ClaimedAt); err != nil {
+			return nil, fmt.Errorf("running jobs scan: %w", err)
+		}
+		out = append(out, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("running jobs rows: %w", err)
+	}
+	return out, nil
+}
+
+// ActiveWorkers returns the workers that claimed a build since the given
+// time.
+func (r *BuildRecordRepository) ActiveWorkers(ctx context.Context, since time.Time) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT worker FROM build_records
+		WHERE claimed_at >= ? AND worker IS NOT NULL AND worker <> ''
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("active workers: %w", err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var w string
+		if err := rows.Scan(&w); err != nil {
+			return nil, fmt.Errorf("active workers scan: %w", err)
+		}
+		out = append(out, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("active workers rows: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,239 @@
+package tidb
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// exportTables lists the tables included in a build history export, in
+// import order.
+var exportTables = []string{"project_versions", "build_state", "build_records", "build_annotations", "repositories", "build_numbers", "skipped_builds", "cache_snapshots", "held_builds", "warm_images", "org_build_configs"}
+
+// exportOmitted lists, per table, the columns left out of an export:
+// credentials that must not end up in backup files. Importing leaves them
+// unchanged, so webhook secrets have to be set again on a new database.
+var exportOmitted = map[string][]string{
+	"repositories": {"webhook_secret", "webhook_secret_previous"},
+}
+
+// exportQueries replaces SELECT * for the tables whose rows refer to
+// another row by id. Ids are not portable between databases, so the
+// reference is exported by the natural key of the row it points at too.
+var exportQueries = map[string]string{
+	"build_annotations": `SELECT a.*, r.project AS build_project, r.commit_sha AS build_commit_sha
+		FROM build_annotations a JOIN build_records r ON r.id = a.build_id`,
+}
+
+// importKeys lists the columns identifying a row of the tables that have
+// no unique key but their id. Import skips a row of these tables matching
+// an existing one on them; rows of the other tables are upserted on their
+// unique key.
+var importKeys = map[string][]string{
+	"build_annotations": {"build_id", "author", "created_at"},
+	"skipped_builds":    {"repo", "sha", "reason", "source", "created_at"},
+	"cache_snapshots":   {"worker", "cache", "taken_at"},
+	"held_builds":       {"repo", "sha", "created_at"},
+}
+
+// ExportRecord is one NDJSON line of a build history export.
+type ExportRecord struct {
+	Table string         `json:"table"`
+	Row   map[string]any `json:"row"`
+}
+
+// sqlTimeLayout is accepted by both TiDB and MySQL for TIMESTAMP columns.
+const sqlTimeLayout = "2006-01-02 15:04:05.999999"
+
+// Export writes every row of the build store tables to w as NDJSON.
+func Export(ctx context.Context, db *sql.DB, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	total := 0
+	for _, table := range exportTables {
+		n, err := exportTable(ctx, db, table, enc)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func exportTable(ctx context.Context, db *sql.DB, table string, enc *json.Encoder) (int, error) {
+	q, ok := exportQueries[table]
+	if !ok {
+		q = "SELECT * FROM " + table
+	}
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return 0, fmt.Errorf("export %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, fmt.Errorf("export %s columns: %w", table, err)
+	}
+
+	n := 0
+	for rows.Next() {
+		values := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, fmt.Errorf("export %s scan: %w", table, err)
+		}
+
+		if err := enc.Encode(ExportRecord{Table: table, Row: exportRow(table, cols, values)}); err != nil {
+			return n, fmt.Errorf("export %s encode: %w", table, err)
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// exportRow returns a scanned row of table as exported.
+func exportRow(table string, cols []string, values []any) map[string]any {
+	row := make(map[string]any, len(cols))
+	for i, col := range cols {
+		if slices.Contains(exportOmitted[table], col) {
+			continue
+		}
+		switch v := values[i].(type) {
+		case []byte:
+			row[col] = string(v)
+		case time.Time:
+			row[col] = v.UTC().Format(sqlTimeLayout)
+		default:
+			row[col] = v
+		}
+	}
+	return row
+}
+
+// Import upserts NDJSON records produced by Export into db. Rows are
+// matched on their natural key, never on their id: an existing row with
+// the same primary or unique key is overwritten, one identified the same
+// by importKeys is kept, and any other is inserted under a new id.
+func Import(ctx context.Context, db *sql.DB, r io.Reader) (int, error) {
+	allowed := make(map[string]bool, len(exportTables))
+	for _, t := range exportTables {
+		allowed[t] = true
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	n := 0
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var rec ExportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return n, fmt.Errorf("import line %d: %w", line, err)
+		}
+		if !allowed[rec.Table] {
+			return n, fmt.Errorf("import line %d: unknown table %q", line, rec.Table)
+		}
+		if err := importRow(ctx, db, rec); err != nil {
+			return n, fmt.Errorf("import line %d: %w", line, err)
+		}
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return n, fmt.Errorf("import read: %w", err)
+	}
+	return n, nil
+}
+
+func importRow(ctx context.Context, db *sql.DB, rec ExportRecord) error {
+	row := maps.Clone(rec.Row)
+	delete(row, "id")
+	if rec.Table == "build_annotations" {
+		project, commit := row["build_project"], row["build_commit_sha"]
+		if project == nil || commit == nil {
+			return fmt.Errorf("annotation without its build's project and commit")
+		}
+		var buildID int64
+		err := db.QueryRowContext(ctx,
+			`SELECT id FROM build_records WHERE project = ? AND commit_sha = ?`, project, commit,
+		).Scan(&buildID)
+		if err != nil {
+			return fmt.Errorf("annotated build %v@%v: %w", project, commit, err)
+		}
+		delete(row, "build_project")
+		delete(row, "build_commit_sha")
+		row["build_id"] = buildID
+	}
+
+	q, args, err := importStatement(rec.Table, row)
+	if err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, q, args...); err != nil {
+		return fmt.Errorf("upsert %s: %w", rec.Table, err)
+	}
+	return nil
+}
+
+// importStatement returns the statement importing row into table; see
+// Import.
+func importStatement(table string, row map[string]any) (string, []any, error) {
+	names := slices.Sorted(maps.Keys(row))
+	if len(names) == 0 {
+		return "", nil, fmt.Errorf("empty row for table %s", table)
+	}
+	cols := make([]string, 0, len(names))
+	args := make([]any, 0, len(names))
+	updates := make([]string, 0, len(names))
+	for _, col := range names {
+		if !isIdentifier(col) {
+			return "", nil, fmt.Errorf("invalid column name %q", col)
+		}
+		cols = append(cols, "`"+col+"`")
+		args = append(args, row[col])
+		updates = append(updates, fmt.Sprintf("`%s` = VALUES(`%s`)", col, col))
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+
+	keys, ok := importKeys[table]
+	if !ok {
+		return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s",
+			table, strings.Join(cols, ", "), placeholders, strings.Join(updates, ", "),
+		), args, nil
+	}
+	match := make([]string, len(keys))
+	for i, key := range keys {
+		v, ok := row[key]
+		if !ok {
+			return "", nil, fmt.Errorf("%s row without %s", table, key)
+		}
+		match[i] = "`" + key + "` = ?"
+		args = append(args, v)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM %s WHERE %s)",
+		table, strings.Join(cols, ", "), placeholders, table, strings.Join(match, " AND "),
+	), args, nil
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package tidb
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExportRow(t *testing.T) {
+	at := time.Date(2026, 3, 2, 9, 30, 0, 0, time.FixedZone("CET", 3600))
+	row := exportRow("repositories",
+		[]string{"full_name", "settings", "webhook_secret", "webhook_secret_previous", "created_at"},
+		[]any{[]byte("acme/shop"), nil, []byte("s3cret"), []byte("old"), at},
+	)
+	if _, ok := row["webhook_secret"]; ok {
+		t.Error("webhook_secret exported")
+	}
+	if _, ok := row["webhook_secret_previous"]; ok {
+		t.Error("webhook_secret_previous exported")
+	}
+	if row["full_name"] != "acme/shop" || row["created_at"] != "2026-03-02 08:30:00" {
+		t.Errorf("row = %v", row)
+	}
+	if v, ok := row["settings"]; !ok || v != nil {
+		t.Errorf("settings = %v, %v; want exported NULL", v, ok)
+	}
+
+	// Other tables keep their columns of the same name.
+	if row := exportRow("build_records", []string{"webhook_secret"}, []any{int64(1)}); row["webhook_secret"] != int64(1) {
+		t.Errorf("build_records row = %v", row)
+	}
+}
+
+func TestImportStatement(t *testing.T) {
+	q, args, err := importStatement("build_records", map[string]any{"project": "api", "commit_sha": "abc123", "status": "success"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "INSERT INTO build_records (`commit_sha`, `project`, `status`) VALUES (?, ?, ?) " +
+		"ON DUPLICATE KEY UPDATE `commit_sha` = VALUES(`commit_sha`), `project` = VALUES(`project`), `status` = VALUES(`status`)"
+	if q != want || !slices.Equal(args, []any{"abc123", "api", "success"}) {
+		t.Errorf("build_records = %s %v", q, args)
+	}
+
+	// Tables without a natural unique key insert rows they do not have.
+	q, args, err = importStatement("cache_snapshots", map[string]any{"worker": "w1", "cache": "nx", "bytes": 10, "taken_at": "2026-03-02 08:30:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "INSERT INTO cache_snapshots (`bytes`, `cache`, `taken_at`, `worker`) SELECT ?, ?, ?, ? FROM DUAL " +
+		"WHERE NOT EXISTS (SELECT 1 FROM cache_snapshots WHERE `worker` = ? AND `cache` = ? AND `taken_at` = ?)"
+	if q != want || !slices.Equal(args, []any{10, "nx", "2026-03-02 08:30:00", "w1", "w1", "nx", "2026-03-02 08:30:00"}) {
+		t.Errorf("cache_snapshots = %s %v", q, args)
+	}
+
+	for name, tc := range map[string]struct {
+		table string
+		row   map[string]any
+	}{
+		"empty":       {"build_state", map[string]any{}},
+		"bad column":  {"build_state", map[string]any{"repo`; DROP": "x"}},
+		"missing key": {"held_builds", map[string]any{"repo": "acme/shop", "sha": "abc123"}},
+	} {
+		if _, _, err := importStatement(tc.table, tc.row); err == nil {
+			t.Errorf("%s: importStatement succeeded", name)
+		}
+	}
+}
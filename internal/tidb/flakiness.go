@@ -0,0 +1,89 @@
+package tidb
+
+import (
+	"context"
+	"fmt"
+)
+
+// Flakiness sums up the recent builds of a repository's branch: how many
+// passed only after a retry on the same commit.
+type Flakiness struct {
+	Repo   string `json:"repo"` // "owner/name"
+	Branch string `json:"branch"`
+	// Builds counts the completed builds considered, Flaky those of them
+	// flagged flaky.
+	Builds int `json:"builds"`
+	Flaky  int `json:"flaky"`
+	// Score is Flaky over Builds, 0..1.
+	Score float64 `json:"score"`
+}
+
+// newFlakiness returns the Flakiness of builds completed builds, flaky of
+// them flaky.
+func newFlakiness(repo, branch string, builds, flaky int) Flakiness {
+	f := Flakiness{Repo: repo, Branch: branch, Builds: builds, Flaky: flaky}
+	if builds > 0 {
+		f.Score = float64(flaky) / float64(builds)
+	}
+	return f
+}
+
+// recentCompleted numbers each repository branch's completed builds, the
+// newest first, as n.
+const recentCompleted = `
+	SELECT repo, branch, flaky,
+	       ROW_NUMBER() OVER (PARTITION BY repo, branch ORDER BY id DESC) AS n
+	FROM build_records
+	WHERE status IN ('success', 'failure') AND branch IS NOT NULL AND deleted_at IS NULL`
+
+// FlakinessScore returns the flakiness of the last window completed builds
+// of repo's branch, across its projects. A branch without history scores 0.
+func (r *BuildRecordRepository) FlakinessScore(ctx context.Context, repo, branch string, window int) (Flakiness, error) {
+	var builds, flaky int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(flaky), 0) FROM (`+recentCompleted+`
+			AND repo = ? AND branch = ?
+		) recent
+		WHERE n <= ?
+	`, repo, branch, window).Scan(&builds, &flaky)
+	if err != nil {
+		return Flakiness{}, fmt.Errorf("flakiness score: %w", err)
+	}
+	return newFlakiness(repo, branch, builds, flaky), nil
+}
+
+// FlakinessByBranch returns the flakiness of the last window completed
+// builds of every branch with builds, of repo or, when repo is "", of every
+// repository. Branches are sorted by repository and name.
+func (r *BuildRecordRepository) FlakinessByBranch(ctx context.Context, repo string, window int) ([]Flakiness, error) {
+	q := `SELECT repo, branch, COUNT(*), COALESCE(SUM(flaky), 0) FROM (` + recentCompleted
+	args := []any{}
+	if repo != "" {
+		q += ` AND repo = ?`
+		args = append(args, repo)
+	}
+	q += `
+		) recent
+		WHERE n <= ?
+		GROUP BY repo, branch
+		ORDER BY repo, branch`
+	args = append(args, window)
+
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("flakiness by branch: %w", err)
+	}
+	defer rows.Close()
+	out := []Flakiness{}
+	for rows.Next() {
+		var (
+			repo, branch  string
+			builds, flaky int
+		)
+		if err := rows.Scan(&repo, &branch, &builds, &flaky); err != nil {
+			return nil, fmt.Errorf("flakiness by branch scan: %w", err)
+		}
+		out = append(out, newFlakiness(repo, branch, builds, flaky))
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,20 @@
+package tidb
+
+import "testing"
+
+func TestNewFlakiness(t *testing.T) {
+	for _, c := range []struct {
+		builds, flaky int
+		want          float64
+	}{
+		{0, 0, 0},
+		{4, 0, 0},
+		{4, 1, 0.25},
+		{20, 20, 1},
+	} {
+		f := newFlakiness("acme/shop", "main", c.builds, c.flaky)
+		if f.Score != c.want || f.Builds != c.builds || f.Flaky != c.flaky || f.Repo != "acme/shop" || f.Branch != "main" {
+			t.Errorf("newFlakiness(%d, %d) = %+v; want score %v", c.builds, c.flaky, f, c.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// HeldBuild is a push kept out of the build queue by a change freeze, to be
+// published once the freeze is over.
+type HeldBuild struct {
+	ID        int64     `json:"id"`
+	Repo      string    `json:"repo"` // owner/name
+	SHA       string    `json:"sha"`
+	Reason    string    `json:"reason"`
+	ReleaseAt time.Time `json:"release_at"`
+	CreatedAt time.Time `json:"created_at"`
+	// Job is the encoded build job.
+	Job []byte `json:"-"`
+}
+
+// HeldBuildRepository manages held builds in TiDB.
+type HeldBuildRepository struct {
+	db *sql.DB
+}
+
+// NewHeldBuildRepository creates a HeldBuildRepository.
+func NewHeldBuildRepository(db *sql.DB) *HeldBuildRepository {
+	return &HeldBuildRepository{db: db}
+}
+
+// Hold stores a held build and returns its ID.
+func (r *HeldBuildRepository) Hold(ctx context.Context, h HeldBuild) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO held_builds (repo, sha, reason, job, release_at) VALUES (?, ?, ?, ?, ?)`,
+		NormalizeRepoName(h.Repo), h.SHA, h.Reason, h.Job, h.ReleaseAt.UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("insert held build: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// List returns the held builds, of repo unless it is empty, in the order
+// they are released.
+func (r *HeldBuildRepository) List(ctx context.Context, repo string) ([]HeldBuild, error) {
+	query, args := `SELECT id, repo, sha, reason, job, release_at, created_at FROM held_builds`, []any{}
+	if repo != "" {
+		query, args = query+` WHERE repo = ?`, append(args, NormalizeRepoName(repo))
+	}
+	return r.query(ctx, query+` ORDER BY release_at, id`, args...)
+}
+
+// Due returns up to limit held builds whose release time has come, oldest
+// first.
+func (r *HeldBuildRepository) Due(ctx context.Context, now time.Time, limit int) ([]HeldBuild, error) {
+	return r.query(ctx, `
+		SELECT id, repo, sha, reason, job, release_at, created_at FROM held_builds
+		WHERE release_at <= ? ORDER BY id LIMIT ?
+	`, now.UTC(), limit)
+}
+
+func (r *HeldBuildRepository) query(ctx context.Context, query string, args ...any) ([]HeldBuild, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list held builds: %w", err)
+	}
+	defer rows.Close()
+
+	held := []HeldBuild{}
+	for rows.Next() {
+		var h HeldBuild
+		if err := rows.Scan(&h.ID, &h.Repo, &h.SHA, &h.Reason, &h.Job, &h.ReleaseAt, &h.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan held build: %w", err)
+		}
+		held = append(held, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("held build rows: %w", err)
+	}
+	return held, nil
+}
+
+// Postpone moves the release of a held build to releaseAt, for a freeze
+// that was extended.
+func (r *HeldBuildRepository) Postpone(ctx context.Context, id int64, reason string, releaseAt time.Time) error {
+	if _, err := r.db.ExecContext(ctx,
+		`UPDATE held_builds SET reason = ?, release_at = ? WHERE id = ?`, reason, releaseAt.UTC(), id,
+	); err != nil {
+		return fmt.Errorf("postpone held build: %w", err)
+	}
+	return nil
+}
+
+// Take removes a held build for publishing. It returns false when another
+// webhook-server took it first.
+func (r *HeldBuildRepository) Take(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM held_builds WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("take held build: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	return n == 1, nil
+}
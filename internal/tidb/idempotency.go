@@ -0,0 +1,102 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// idempotencyPurgeBatch bounds the expired keys deleted per reservation.
+const idempotencyPurgeBatch = 100
+
+// StoredResponse is the response recorded under an idempotency key. Status
+// is 0 while the first request with the key is still being handled.
+type StoredResponse struct {
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyKeyRepository stores the responses of API requests made with
+// an Idempotency-Key header, so that retries replay them.
+type IdempotencyKeyRepository struct {
+	db *sql.DB
+}
+
+// NewIdempotencyKeyRepository creates an IdempotencyKeyRepository.
+func NewIdempotencyKeyRepository(db *sql.DB) *IdempotencyKeyRepository {
+	return &IdempotencyKeyRepository{db: db}
+}
+
+// Reserve claims a caller's (scope's) key for a request with the given
+// fingerprint. It returns nil when the key was free, the caller then
+// completing or releasing it, or else the response stored under the key.
+// Keys older than ttl are free again; expired keys are deleted here, a
+// batch at a time.
+func (r *IdempotencyKeyRepository) Reserve(ctx context.Context, scope, key, fingerprint string, ttl time.Duration) (*StoredResponse, error) {
+	cutoff := time.Now().Add(-ttl)
+	if _, err := r.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE created_at < ? ORDER BY created_at LIMIT ?`,
+		cutoff, idempotencyPurgeBatch,
+	); err != nil {
+		return nil, fmt.Errorf("purge idempotency keys: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE scope = ? AND idem_key = ? AND created_at < ?`,
+		scope, key, cutoff,
+	); err != nil {
+		return nil, fmt.Errorf("expire idempotency key: %w", err)
+	}
+
+	res, err := r.db.ExecContext(ctx,
+		`INSERT IGNORE INTO idempotency_keys (scope, idem_key, fingerprint) VALUES (?, ?, ?)`,
+		scope, key, fingerprint,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("reserve idempotency key: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return nil, nil
+	}
+
+	var s StoredResponse
+	err = r.db.QueryRowContext(ctx,
+		`SELECT fingerprint, status, content_type, body FROM idempotency_keys WHERE scope = ? AND idem_key = ?`,
+		scope, key,
+	).Scan(&s.Fingerprint, &s.Status, &s.ContentType, &s.Body)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released between the insert and the read; the caller may retry.
+		return &StoredResponse{Fingerprint: fingerprint}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read idempotency key: %w", err)
+	}
+	return &s, nil
+}
+
+// Complete stores the response of the request that reserved a key.
+func (r *IdempotencyKeyRepository) Complete(ctx context.Context, scope, key string, status int, contentType string, body []byte) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET status = ?, content_type = ?, body = ? WHERE scope = ? AND idem_key = ?`,
+		status, contentType, body, scope, key,
+	)
+	if err != nil {
+		return fmt.Errorf("complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Release frees a reserved key whose request must not be replayed.
+func (r *IdempotencyKeyRepository) Release(ctx context.Context, scope, key string) error {
+	_, err := r.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE scope = ? AND idem_key = ? AND status = 0`,
+		scope, key,
+	)
+	if err != nil {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -1,9 +1,14 @@
 package tidb_test
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -87,7 +92,7 @@ func TestTiDBVersionAndSHA(t *testing.T) {
 	brr := tidb.NewBuildRecordRepository(db)
 	commitSHA := "def456" + time.Now().Format("150405")
 
-	claimed, err := brr.Claim(ctx, project, commitSHA, 30*time.Minute)
+	first, claimed, err := brr.Claim(ctx, project, commitSHA, "test/repo", 30*time.Minute)
 	if err != nil {
 		t.Fatalf("first claim: %v", err)
 	}
@@ -96,7 +101,7 @@ func TestTiDBVersionAndSHA(t *testing.T) {
 	}
 
 	// Second claim attempt should be skipped (not stale).
-	claimed, err = brr.Claim(ctx, project, commitSHA, 30*time.Minute)
+	_, claimed, err = brr.Claim(ctx, project, commitSHA, "test/repo", 30*time.Minute)
 	if err != nil {
 		t.Fatalf("second claim: %v", err)
 	}
@@ -104,8 +109,34 @@ func TestTiDBVersionAndSHA(t *testing.T) {
 		t.Error("second claim should be skipped")
 	}
 
+	// A build still in flight cannot be deleted.
+	var pendingID int64
+	if err := db.QueryRowContext(ctx, `SELECT id FROM build_records WHERE project = ? AND commit_sha = ?`, project, commitSHA).Scan(&pendingID); err != nil {
+		t.Fatalf("pending record id: %v", err)
+	}
+	if err := brr.SoftDelete(ctx, pendingID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("soft delete pending: err = %v, want sql.ErrNoRows", err)
+	}
+
+	// A stale claim is taken over; its holder can no longer complete or
+	// release the record.
+	claim, claimed, err := brr.Claim(ctx, project, commitSHA, "test/repo", 0)
+	if err != nil {
+		t.Fatalf("re-claim: %v", err)
+	}
+	if !claimed || claim != first+1 {
+		t.Fatalf("re-claim = %d, %v; want %d, true", claim, claimed, first+1)
+	}
+	var superseded *tidb.ErrClaimSuperseded
+	if err := brr.SetStatus(ctx, project, commitSHA, first, tidb.BuildStatusFailure); !errors.As(err, &superseded) {
+		t.Errorf("stale claim set status: err = %v, want ErrClaimSuperseded", err)
+	}
+	if err := brr.Release(ctx, project, commitSHA, first); err != nil {
+		t.Fatalf("stale claim release: %v", err)
+	}
+
 	// Update to success.
-	if err := brr.SetStatus(ctx, project, commitSHA, tidb.BuildStatusSuccess); err != nil {
+	if err := brr.SetStatus(ctx, project, commitSHA, claim, tidb.BuildStatusSuccess); err != nil {
 		t.Fatalf("set status: %v", err)
 	}
 
@@ -116,4 +147,510 @@ func TestTiDBVersionAndSHA(t *testing.T) {
 	if status != tidb.BuildStatusSuccess {
 		t.Errorf("status: got %q, want success", status)
 	}
+
+	// Completed records are final; repeating the same transition is a no-op.
+	if err := brr.SetStatus(ctx, project, commitSHA, claim, tidb.BuildStatusSuccess); err != nil {
+		t.Errorf("repeat success: %v", err)
+	}
+	var illegal *tidb.ErrIllegalTransition
+	if err := brr.SetStatus(ctx, project, commitSHA, claim, tidb.BuildStatusFailure); !errors.As(err, &illegal) {
+		t.Errorf("success -> failure: err = %v, want ErrIllegalTransition", err)
+	}
+
+	// Image provenance lookup by digest.
+	digest := "sha256:" + commitSHA
+	if err := brr.RecordImage(ctx, project, commitSHA, "test/repo", "registry/"+project+":1.2.3", digest, "abc"); err != nil {
+		t.Fatalf("record image: %v", err)
+	}
+	prov, err := brr.FindByDigest(ctx, digest)
+	if err != nil {
+		t.Fatalf("find by digest: %v", err)
+	}
+	if prov.Project != project || prov.CommitSHA != commitSHA || prov.Repo != "test/repo" {
+		t.Errorf("provenance: got %+v", prov)
+	}
+
+	// Annotations.
+	ar := tidb.NewAnnotationRepository(db)
+	if _, err := ar.Add(ctx, prov.BuildID, "oncall", "retried due to registry outage"); err != nil {
+		t.Fatalf("add annotation: %v", err)
+	}
+	notes, err := ar.List(ctx, prov.BuildID)
+	if err != nil {
+		t.Fatalf("list annotations: %v", err)
+	}
+	if len(notes) != 1 || notes[0].Author != "oncall" {
+		t.Errorf("annotations: got %+v", notes)
+	}
+	if byID, err := brr.FindByID(ctx, prov.BuildID); err != nil || byID.CommitSHA != commitSHA {
+		t.Errorf("find by id: got %+v, %v", byID, err)
+	}
+
+	// Archive, soft delete and restore.
+	if err := brr.Archive(ctx, prov.BuildID); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if recent, err := brr.RecentByRepo(ctx, "test/repo", 100); err != nil {
+		t.Fatalf("recent: %v", err)
+	} else {
+		for _, b := range recent {
+			if b.BuildID == prov.BuildID {
+				t.Error("archived build listed by RecentByRepo")
+			}
+		}
+	}
+	if byID, err := brr.FindByID(ctx, prov.BuildID); err != nil || byID.ArchivedAt == nil {
+		t.Errorf("find archived by id: got %+v, %v", byID, err)
+	}
+	if err := brr.SoftDelete(ctx, prov.BuildID); err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	if _, err := brr.FindByID(ctx, prov.BuildID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("find deleted by id: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := brr.SoftDelete(ctx, prov.BuildID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("repeat soft delete: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := brr.Restore(ctx, prov.BuildID); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if byID, err := brr.FindByID(ctx, prov.BuildID); err != nil || byID.ArchivedAt != nil {
+		t.Errorf("find restored by id: got %+v, %v", byID, err)
+	}
+}
+
+// TestTiDBExportImport round-trips the build store through NDJSON.
+// Requires TIDB_DSN (see TestTiDBVersionAndSHA).
+func TestTiDBExportImport(t *testing.T) {
+	dsn := os.Getenv("TIDB_DSN")
+	if dsn == "" {
+		t.Skip("TIDB_DSN not set — skipping integration test")
+	}
+
+	db, err := sql.Open("mysql", dsn+"?parseTime=true&multiStatements=true")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(tidb.Schema); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+
+	ctx := context.Background()
+	project := "export-project-" + time.Now().Format("20060102150405")
+	vr := tidb.NewVersionRepository(db)
+	if err := vr.Update(ctx, project, "0.1.0"); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if _, err := vr.Get(ctx, project); err != nil {
+		t.Fatalf("seed get: %v", err)
+	}
+	if err := vr.Update(ctx, project, "3.4.5"); err != nil {
+		t.Fatalf("seed update: %v", err)
+	}
+	repos := tidb.NewRepositoryRepository(db)
+	if _, err := repos.Put(ctx, "acme/"+project, tidb.RepositorySettings{}); err != nil {
+		t.Fatalf("seed repository: %v", err)
+	}
+	const secret = "export-test-webhook-secret"
+	if err := repos.RotateWebhookSecret(ctx, "acme/"+project, secret); err != nil {
+		t.Fatalf("seed secret: %v", err)
+	}
+
+	var buf bytes.Buffer
+	n, err := tidb.Export(ctx, db, &buf)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if n == 0 {
+		t.Fatal("export wrote no records")
+	}
+	if bytes.Contains(buf.Bytes(), []byte(secret)) || bytes.Contains(buf.Bytes(), []byte("webhook_secret")) {
+		t.Error("export contains webhook secrets")
+	}
+
+	// Change the version, then import must restore the exported value.
+	if err := vr.Update(ctx, project, "9.9.9"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := tidb.Import(ctx, db, &buf); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	version, err := vr.Get(ctx, project)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if version != "3.4.5" {
+		t.Errorf("version after import: got %q, want 3.4.5", version)
+	}
+}
+
+// TestTiDBImportMatchesNaturalKeys checks that an import into a database
+// holding other rows under the same ids leaves them alone, and that
+// importing twice adds nothing. Requires TIDB_DSN.
+func TestTiDBImportMatchesNaturalKeys(t *testing.T) {
+	dsn := os.Getenv("TIDB_DSN")
+	if dsn == "" {
+		t.Skip("TIDB_DSN not set — skipping integration test")
+	}
+	db, err := sql.Open("mysql", dsn+"?parseTime=true&multiStatements=true")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(tidb.Schema); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+
+	ctx := context.Background()
+	brr := tidb.NewBuildRecordRepository(db)
+	suffix := time.Now().Format("20060102150405")
+	local, imported := "local-"+suffix, "imported-"+suffix
+	if _, _, err := brr.Claim(ctx, local, "aaa111", "test/import", time.Minute); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	var localID int64
+	if err := db.QueryRowContext(ctx, `SELECT id FROM build_records WHERE project = ? AND commit_sha = 'aaa111'`, local).Scan(&localID); err != nil {
+		t.Fatalf("local id: %v", err)
+	}
+
+	// Rows exported elsewhere, under the local build's id.
+	var dump bytes.Buffer
+	enc := json.NewEncoder(&dump)
+	for _, rec := range []tidb.ExportRecord{
+		{Table: "build_records", Row: map[string]any{"id": localID, "project": imported, "commit_sha": "bbb222", "repo": "test/import", "status": "success"}},
+		{Table: "build_annotations", Row: map[string]any{"id": localID, "build_id": localID, "build_project": imported, "build_commit_sha": "bbb222", "author": "ops", "body": "restored", "created_at": "2026-03-02 08:30:00"}},
+	} {
+		if err := enc.Encode(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 2 {
+		if _, err := tidb.Import(ctx, db, bytes.NewReader(dump.Bytes())); err != nil {
+			t.Fatalf("import: %v", err)
+		}
+	}
+
+	prov, err := brr.FindByID(ctx, localID)
+	if err != nil || prov.Project != local {
+		t.Fatalf("local build after import = %+v, %v; want project %s", prov, err, local)
+	}
+	var importedID int64
+	if err := db.QueryRowContext(ctx, `SELECT id FROM build_records WHERE project = ? AND commit_sha = 'bbb222'`, imported).Scan(&importedID); err != nil {
+		t.Fatalf("imported build: %v", err)
+	}
+	notes, err := tidb.NewAnnotationRepository(db).List(ctx, importedID)
+	if err != nil {
+		t.Fatalf("annotations: %v", err)
+	}
+	if len(notes) != 1 || notes[0].Body != "restored" {
+		t.Errorf("imported build annotations = %+v; want the one restored", notes)
+	}
+	if notes, _ := tidb.NewAnnotationRepository(db).List(ctx, localID); len(notes) != 0 {
+		t.Errorf("local build annotations = %+v; want none", notes)
+	}
+}
+
+func TestTiDBRepositoryRegistry(t *testing.T) {
+	dsn := os.Getenv("TIDB_DSN")
+	if dsn == "" {
+		t.Skip("TIDB_DSN not set — skipping integration test")
+	}
+
+	db, err := sql.Open("mysql", dsn+"?parseTime=true&multiStatements=true")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(tidb.Schema); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+
+	ctx := context.Background()
+	name := "Test/Repo-" + time.Now().Format("20060102150405")
+	repos := tidb.NewRepositoryRepository(db)
+
+	if _, err := repos.Get(ctx, name); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("get before onboarding: err = %v, want sql.ErrNoRows", err)
+	}
+	stored, err := repos.Put(ctx, name, tidb.RepositorySettings{Namespace: "team-a", Projects: []string{"api-*"}})
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if stored.FullName != tidb.NormalizeRepoName(name) || stored.Settings.Namespace != "team-a" {
+		t.Errorf("stored = %+v", stored)
+	}
+	if _, err := repos.Get(ctx, tidb.NormalizeRepoName(name)); err != nil {
+		t.Errorf("get by normalized name: %v", err)
+	}
+	for _, secret := range []string{"first-secret-0123", "second-secret-0123"} {
+		if err := repos.RotateWebhookSecret(ctx, name, secret); err != nil {
+			t.Fatalf("rotate webhook secret: %v", err)
+		}
+	}
+	secrets, err := repos.WebhookSecrets(ctx, name)
+	if err != nil || len(secrets) != 2 || secrets[0] != "second-secret-0123" || secrets[1] != "first-secret-0123" {
+		t.Errorf("webhook secrets = %v, %v; want current then previous", secrets, err)
+	}
+	if err := repos.ClearWebhookSecret(ctx, name); err != nil {
+		t.Fatalf("clear webhook secret: %v", err)
+	}
+	if secrets, _ := repos.WebhookSecrets(ctx, name); len(secrets) != 0 {
+		t.Errorf("webhook secrets after clear = %v", secrets)
+	}
+
+	if err := repos.Delete(ctx, name); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := repos.Delete(ctx, name); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("second delete: err = %v, want sql.ErrNoRows", err)
+	}
+
+	// Build numbers count per repository, case-insensitively.
+	numbers := tidb.NewBuildNumberRepository(db)
+	for i, repo := range []string{name, strings.ToLower(name), name + "-other"} {
+		n, err := numbers.Next(ctx, repo)
+		if err != nil {
+			t.Fatalf("next build number: %v", err)
+		}
+		if want := []int64{1, 2, 1}[i]; n != want {
+			t.Errorf("build number %d of %s = %d, want %d", i, repo, n, want)
+		}
+	}
+}
+
+// TestTiDBMigrate applies the migrations twice: the second run finds none
+// pending. Requires TIDB_DSN.
+func TestTiDBMigrate(t *testing.T) {
+	dsn := os.Getenv("TIDB_DSN")
+	if dsn == "" {
+		t.Skip("TIDB_DSN not set — skipping integration test")
+	}
+
+	db, err := sql.Open("mysql", dsn+"?parseTime=true")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if _, err := tidb.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	applied, err := tidb.Migrate(ctx, db)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second migrate = %v, %v; want nothing applied", applied, err)
+	}
+	statuses, err := tidb.MigrationStatuses(ctx, db)
+	if err != nil {
+		t.Fatalf("statuses: %v", err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %d pending after migrate", s.Version)
+		}
+	}
+}
+
+// TestTiDBRequeueReclaim checks that a requeue reopens a failed build so
+// the requeued job claims it again, once. Requires TIDB_DSN.
+func TestTiDBRequeueReclaim(t *testing.T) {
+	dsn := os.Getenv("TIDB_DSN")
+	if dsn == "" {
+		t.Skip("TIDB_DSN not set — skipping integration test")
+	}
+	db, err := sql.Open("mysql", dsn+"?parseTime=true&multiStatements=true")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(tidb.Schema); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+
+	ctx := context.Background()
+	brr := tidb.NewBuildRecordRepository(db)
+	project := "requeue-" + time.Now().Format("20060102150405")
+	repo, sha := "test/requeue", "fed987"+time.Now().Format("150405")
+
+	claim, claimed, err := brr.Claim(ctx, project, sha, repo, 30*time.Minute)
+	if err != nil || !claimed {
+		t.Fatalf("claim = %v, %v", claimed, err)
+	}
+	if err := brr.SetStatus(ctx, project, sha, claim, tidb.BuildStatusFailure); err != nil {
+		t.Fatalf("set failure: %v", err)
+	}
+	if _, claimed, _ := brr.Claim(ctx, project, sha, repo, 30*time.Minute); claimed {
+		t.Fatal("a failed build should not be claimed without a requeue")
+	}
+
+	projects, err := brr.Reopen(ctx, repo, sha)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if len(projects) != 1 || projects[0] != project {
+		t.Fatalf("reopened %v; want [%s]", projects, project)
+	}
+	if again, err := brr.Reopen(ctx, repo, sha); err != nil || len(again) != 0 {
+		t.Errorf("second reopen = %v, %v; want none", again, err)
+	}
+
+	requeued, claimed, err := brr.ClaimReopened(ctx, project, sha, repo, "worker-a", 30*time.Minute)
+	if err != nil || !claimed {
+		t.Fatalf("requeued claim = %v, %v", claimed, err)
+	}
+	if requeued <= claim {
+		t.Errorf("requeued claim %d does not supersede %d", requeued, claim)
+	}
+	if _, claimed, _ := brr.ClaimReopened(ctx, project, sha, repo, "worker-b", 30*time.Minute); claimed {
+		t.Error("a reopened build should be claimed once")
+	}
+	if err := brr.SetStatus(ctx, project, sha, claim, tidb.BuildStatusSuccess); err == nil {
+		t.Error("the failed run's claim should be superseded")
+	}
+	if err := brr.SetStatus(ctx, project, sha, requeued, tidb.BuildStatusSuccess); err != nil {
+		t.Fatalf("set success: %v", err)
+	}
+}
+
+// TestTiDBFlakinessByBranch checks that flakiness is kept per repository
+// branch, over its newest builds. Requires TIDB_DSN.
+func TestTiDBFlakinessByBranch(t *testing.T) {
+	dsn := os.Getenv("TIDB_DSN")
+	if dsn == "" {
+		t.Skip("TIDB_DSN not set — skipping integration test")
+	}
+	db, err := sql.Open("mysql", dsn+"?parseTime=true&multiStatements=true")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(tidb.Schema); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+
+	ctx := context.Background()
+	brr := tidb.NewBuildRecordRepository(db)
+	repo := "test/flaky-" + time.Now().Format("20060102150405")
+	for i, b := range []struct {
+		project, branch string
+		flaky           bool
+	}{
+		{"api", "main", false},
+		{"web", "main", true},
+		{"api", "dev", false},
+	} {
+		sha := fmt.Sprintf("f1a%037d", i)
+		claim, _, err := brr.Claim(ctx, b.project+"-"+repo, sha, repo, time.Minute)
+		if err != nil {
+			t.Fatalf("claim: %v", err)
+		}
+		if err := brr.SetStatus(ctx, b.project+"-"+repo, sha, claim, tidb.BuildStatusSuccess); err != nil {
+			t.Fatalf("set status: %v", err)
+		}
+		if err := brr.RecordAttempts(ctx, b.project+"-"+repo, sha, b.branch, 2, b.flaky); err != nil {
+			t.Fatalf("record attempts: %v", err)
+		}
+	}
+
+	got, err := brr.FlakinessByBranch(ctx, repo, 20)
+	if err != nil {
+		t.Fatalf("flakiness by branch: %v", err)
+	}
+	want := []tidb.Flakiness{
+		{Repo: repo, Branch: "dev", Builds: 1, Flaky: 0, Score: 0},
+		{Repo: repo, Branch: "main", Builds: 2, Flaky: 1, Score: 0.5},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("flakiness = %+v; want %+v", got, want)
+	}
+	if f, err := brr.FlakinessScore(ctx, repo, "main", 1); err != nil || f.Builds != 1 || f.Score != 1 {
+		t.Errorf("newest main build = %+v, %v; want the flaky one", f, err)
+	}
+	if f, err := brr.FlakinessScore(ctx, repo, "release", 20); err != nil || f.Builds != 0 || f.Score != 0 {
+		t.Errorf("branch without builds = %+v, %v", f, err)
+	}
+}
+
+// TestTiDBDurationP95PerRepo checks that projects of the same name in two
+// repositories have their own baseline. Requires TIDB_DSN.
+func TestTiDBDurationP95PerRepo(t *testing.T) {
+	dsn := os.Getenv("TIDB_DSN")
+	if dsn == "" {
+		t.Skip("TIDB_DSN not set — skipping integration test")
+	}
+	db, err := sql.Open("mysql", dsn+"?parseTime=true&multiStatements=true")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(tidb.Schema); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+
+	ctx := context.Background()
+	brr := tidb.NewBuildRecordRepository(db)
+	stamp := time.Now().Format("20060102150405")
+	project := "api-" + stamp
+	for i, b := range []struct {
+		repo     string
+		duration time.Duration
+	}{
+		{"test/shop-" + stamp, time.Minute},
+		{"test/shop-" + stamp, 2 * time.Minute},
+		{"test/billing-" + stamp, 30 * time.Minute},
+	} {
+		sha := fmt.Sprintf("d0a%037d", i)
+		claim, _, err := brr.Claim(ctx, project, sha, b.repo, time.Minute)
+		if err != nil {
+			t.Fatalf("claim: %v", err)
+		}
+		if err := brr.SetStatus(ctx, project, sha, claim, tidb.BuildStatusSuccess); err != nil {
+			t.Fatalf("set status: %v", err)
+		}
+		if err := brr.RecordDuration(ctx, project, sha, b.duration); err != nil {
+			t.Fatalf("record duration: %v", err)
+		}
+	}
+
+	if p95, n, err := brr.DurationP95(ctx, "test/shop-"+stamp, project, 20); err != nil || n != 2 || p95 != 2*time.Minute {
+		t.Errorf("shop p95 = %s, %d samples, %v; want 2m, 2", p95, n, err)
+	}
+	if p95, n, err := brr.DurationP95(ctx, "test/billing-"+stamp, project, 20); err != nil || n != 1 || p95 != 30*time.Minute {
+		t.Errorf("billing p95 = %s, %d samples, %v; want 30m, 1", p95, n, err)
+	}
+}
+
+// TestTiDBLeader checks that one process at a time leads. Requires
+// TIDB_DSN.
+func TestTiDBLeader(t *testing.T) {
+	dsn := os.Getenv("TIDB_DSN")
+	if dsn == "" {
+		t.Skip("TIDB_DSN not set — skipping integration test")
+	}
+	db, err := sql.Open("mysql", dsn+"?parseTime=true")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	name := "cbs_test_leader_" + time.Now().Format("150405.000")
+	a, b := tidb.NewLeader(db, name), tidb.NewLeader(db, name)
+	if ok, err := a.Acquire(ctx); err != nil || !ok {
+		t.Fatalf("first acquire = %v, %v", ok, err)
+	}
+	if ok, err := a.Acquire(ctx); err != nil || !ok {
+		t.Errorf("leader lost the lead: %v, %v", ok, err)
+	}
+	if ok, err := b.Acquire(ctx); err != nil || ok {
+		t.Errorf("second process leads too: %v, %v", ok, err)
+	}
+	a.Release(ctx)
+	if ok, err := b.Acquire(ctx); err != nil || !ok {
+		t.Errorf("acquire after release = %v, %v", ok, err)
+	}
+	b.Release(ctx)
 }
@@ -0,0 +1,69 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// Leader elects one of the processes sharing the database to run a task
+// that must not run on each of them, such as purging old build records.
+// The leader holds a named advisory lock on a connection of its own for as
+// long as it runs. When it dies the connection closes, releasing the lock,
+// and the next process to call Acquire takes over.
+type Leader struct {
+	db   *sql.DB
+	name string
+
+	mu   sync.Mutex
+	conn *sql.Conn // holds the lock while leading
+}
+
+// NewLeader creates the Leader of the processes using the lock name.
+func NewLeader(db *sql.DB, name string) *Leader {
+	return &Leader{db: db, name: name}
+}
+
+// Acquire reports whether this process leads, taking the lead if no other
+// process holds it. It never waits for the lock.
+func (l *Leader) Acquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn != nil {
+		// The lock lives as long as the connection holding it.
+		if err := l.conn.PingContext(ctx); err == nil {
+			return true, nil
+		}
+		l.conn.Close()
+		l.conn = nil
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("leader %s: %w", l.name, err)
+	}
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 0)`, l.name).Scan(&locked); err != nil {
+		conn.Close()
+		return false, fmt.Errorf("leader %s lock: %w", l.name, err)
+	}
+	if locked.Int64 != 1 {
+		conn.Close()
+		return false, nil
+	}
+	l.conn = conn
+	return true, nil
+}
+
+// Release gives up the lead, if held.
+func (l *Leader) Release(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return
+	}
+	_, _ = l.conn.ExecContext(ctx, `SELECT RELEASE_LOCK(?)`, l.name)
+	l.conn.Close()
+	l.conn = nil
+}
@@ -0,0 +1,200 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationLock serializes Migrate across processes starting together.
+const migrationLock = "cbs_schema_migrations"
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is a versioned schema change, from migrations/NNNN_name.sql.
+// Migrations are applied in version order and never edited once
+// released: a schema change is a new file.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+var migrations = mustLoadMigrations(migrationFiles)
+
+// mustLoadMigrations reads the embedded migrations, panicking on a
+// misnamed or duplicate file, which is a build mistake.
+func mustLoadMigrations(files fs.FS) []Migration {
+	names, err := fs.Glob(files, "migrations/*.sql")
+	if err != nil {
+		panic(err)
+	}
+	var out []Migration
+	for _, name := range names {
+		m, err := parseMigrationName(path.Base(name))
+		if err != nil {
+			panic(err)
+		}
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			panic(err)
+		}
+		m.SQL = string(data)
+		out = append(out, m)
+	}
+	slices.SortFunc(out, func(a, b Migration) int { return a.Version - b.Version })
+	for i := 1; i < len(out); i++ {
+		if out[i].Version == out[i-1].Version {
+			panic(fmt.Sprintf("duplicate migration version %d", out[i].Version))
+		}
+	}
+	return out
+}
+
+// parseMigrationName parses "0002_add_owner.sql".
+func parseMigrationName(file string) (Migration, error) {
+	base, ok := strings.CutSuffix(file, ".sql")
+	version, name, sep := strings.Cut(base, "_")
+	v, err := strconv.Atoi(version)
+	if !ok || !sep || err != nil || v <= 0 || name == "" {
+		return Migration{}, fmt.Errorf("migration %q: want NNNN_name.sql", file)
+	}
+	return Migration{Version: v, Name: name}, nil
+}
+
+// Migrations returns the schema migrations in version order.
+func Migrations() []Migration {
+	return slices.Clone(migrations)
+}
+
+// statements splits a migration into its statements, which end with a
+// semicolon at the end of a line. Comment lines are dropped.
+func statements(sql string) []string {
+	var (
+		out []string
+		cur strings.Builder
+	)
+	for line := range strings.Lines(sql) {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		if strings.HasSuffix(trimmed, ";") {
+			out = append(out, strings.TrimSuffix(strings.TrimSpace(cur.String()), ";"))
+			cur.Reset()
+		}
+	}
+	if s := strings.TrimSpace(cur.String()); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// MigrationStatus is a migration and when it was applied; AppliedAt is nil
+// while it is pending.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// ensureMigrationTable creates the table recording applied migrations.
+func ensureMigrationTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+		  version    INT          NOT NULL PRIMARY KEY,
+		  name       VARCHAR(255) NOT NULL,
+		  applied_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// MigrationStatuses returns every migration with when it was applied.
+func MigrationStatuses(ctx context.Context, db *sql.DB) ([]MigrationStatus, error) {
+	if err := ensureMigrationTable(ctx, db); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("applied migrations: %w", err)
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			v  int
+			at time.Time
+		)
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, fmt.Errorf("applied migrations scan: %w", err)
+		}
+		applied[v] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("applied migrations rows: %w", err)
+	}
+	out := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		out[i] = MigrationStatus{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			out[i].AppliedAt = &at
+		}
+	}
+	return out, nil
+}
+
+// Migrate applies the pending migrations in order and returns them. It
+// holds a named lock meanwhile, so replicas starting together apply each
+// migration once. DDL is not transactional: a migration that fails part
+// way is left partly applied and not recorded, so its statements must be
+// safe to run again (IF NOT EXISTS).
+func Migrate(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	defer conn.Close()
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 60)`, migrationLock).Scan(&locked); err != nil {
+		return nil, fmt.Errorf("migration lock: %w", err)
+	}
+	if locked.Int64 != 1 {
+		return nil, fmt.Errorf("migration lock: timed out waiting for another migration")
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.WithoutCancel(ctx), `SELECT RELEASE_LOCK(?)`, migrationLock)
+	}()
+
+	statuses, err := MigrationStatuses(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, s := range statuses {
+		if s.AppliedAt != nil {
+			continue
+		}
+		for i, stmt := range statements(s.SQL) {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return applied, fmt.Errorf("migration %04d_%s statement %d: %w", s.Version, s.Name, i+1, err)
+			}
+		}
+		if _, err := conn.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, s.Version, s.Name); err != nil {
+			return applied, fmt.Errorf("record migration %04d_%s: %w", s.Version, s.Name, err)
+		}
+		applied = append(applied, s.Migration)
+	}
+	return applied, nil
+}
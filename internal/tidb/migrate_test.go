@@ -0,0 +1,166 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func TestMigrations(t *testing.T) {
+	if len(migrations) == 0 || migrations[0].Version != 1 {
+		t.Fatalf("migrations = %v", migrations)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d: versions must be contiguous", m.Name, m.Version, i+1)
+		}
+		if len(statements(m.SQL)) == 0 {
+			t.Errorf("migration %04d_%s has no statements", m.Version, m.Name)
+		}
+	}
+	if !strings.Contains(Schema, "CREATE TABLE IF NOT EXISTS build_records") {
+		t.Error("Schema lacks the baseline")
+	}
+}
+
+func TestParseMigrationName(t *testing.T) {
+	m, err := parseMigrationName("0002_add_owner.sql")
+	if err != nil || m.Version != 2 || m.Name != "add_owner" {
+		t.Errorf("parseMigrationName = %+v, %v", m, err)
+	}
+	for _, bad := range []string{"add_owner.sql", "0002.sql", "0002_add_owner.up", "0000_zero.sql", "x2_name.sql"} {
+		if _, err := parseMigrationName(bad); err == nil {
+			t.Errorf("parseMigrationName(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestStatements(t *testing.T) {
+	sql := `-- header comment
+
+CREATE TABLE a (
+  id INT -- inline
+);
+ALTER TABLE a ADD COLUMN b INT;
+
+INSERT INTO a VALUES (1)`
+	got := statements(sql)
+	want := []string{"CREATE TABLE a (\n  id INT -- inline\n)", "ALTER TABLE a ADD COLUMN b INT", "INSERT INTO a VALUES (1)"}
+	if len(got) != len(want) {
+		t.Fatalf("statements = %q", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("statement %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// oldInitScript returns the table statements of the tidb-init.sql that
+// created databases before versioned migrations.
+func oldInitScript(t *testing.T) []string {
+	t.Helper()
+	data, err := os.ReadFile("testdata/tidb-init-v0.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, stmt := range statements(string(data)) {
+		if strings.HasPrefix(stmt, "CREATE DATABASE") || strings.HasPrefix(stmt, "USE ") {
+			continue
+		}
+		out = append(out, stmt)
+	}
+	return out
+}
+
+// TestBaselineMatchesOldInitScript keeps the baseline the schema the old
+// init script created: databases made by it record the baseline as
+// applied, so any later column must come from a later migration.
+func TestBaselineMatchesOldInitScript(t *testing.T) {
+	got, want := statements(migrations[0].SQL), oldInitScript(t)
+	if !slices.Equal(got, want) {
+		t.Errorf("baseline statements = %q\nwant the old init script's %q", got, want)
+	}
+}
+
+// TestTiDBMigrateFromOldInitScript migrates a scratch database created by
+// the old init script, with a build record in it, and uses the current
+// schema. Requires TIDB_DSN.
+func TestTiDBMigrateFromOldInitScript(t *testing.T) {
+	dsn := os.Getenv("TIDB_DSN")
+	if dsn == "" {
+		t.Skip("TIDB_DSN not set — skipping integration test")
+	}
+	server, err := sql.Open("mysql", dsn+"?parseTime=true")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer server.Close()
+	ctx := context.Background()
+	name := fmt.Sprintf("cbs_migrate_%d", time.Now().UnixNano())
+	if _, err := server.ExecContext(ctx, "CREATE DATABASE "+name); err != nil {
+		t.Fatalf("create database: %v", err)
+	}
+	defer server.ExecContext(context.Background(), "DROP DATABASE "+name)
+
+	base, _, _ := strings.Cut(dsn, "/")
+	db, err := sql.Open("mysql", base+"/"+name+"?parseTime=true")
+	if err != nil {
+		t.Fatalf("open scratch database: %v", err)
+	}
+	defer db.Close()
+	for _, stmt := range oldInitScript(t) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("old init script: %v", err)
+		}
+	}
+	if _, err := db.ExecContext(ctx,
+		`INSERT INTO build_records (project, commit_sha, status) VALUES ('api', ?, 'failure')`, strings.Repeat("a", 40)); err != nil {
+		t.Fatalf("seed build record: %v", err)
+	}
+
+	if _, err := Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	builds := NewBuildRecordRepository(db)
+	sha := strings.Repeat("b", 40)
+	claim, claimed, err := builds.Claim(ctx, "api", sha, "o/r", time.Hour)
+	if err != nil || !claimed {
+		t.Fatalf("claim = %v, %v", claimed, err)
+	}
+	if err := builds.RecordAttempts(ctx, "api", sha, "main", 2, true); err != nil {
+		t.Errorf("record attempts: %v", err)
+	}
+	if err := builds.RecordWarnings(ctx, "api", sha, nil); err != nil {
+		t.Errorf("record warnings: %v", err)
+	}
+	if err := builds.SetStatus(ctx, "api", sha, claim, BuildStatusSuccess); err != nil {
+		t.Errorf("set status: %v", err)
+	}
+	pending := strings.Repeat("c", 40)
+	if _, _, err := builds.Claim(ctx, "api", pending, "o/r", time.Hour); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if _, err := builds.ExpirePendingBefore(ctx, time.Now().Add(time.Hour), false); err != nil {
+		t.Errorf("expire pending: %v", err)
+	}
+	if status, err := builds.GetStatus(ctx, "api", pending); err != nil || status != BuildStatusExpired {
+		t.Errorf("status = %q, %v; want expired", status, err)
+	}
+	recent, err := builds.RecentByRepo(ctx, "o/r", 10)
+	if err != nil || len(recent) != 2 {
+		t.Errorf("recent = %+v, %v", recent, err)
+	}
+	if _, err := NewRepositoryRepository(db).List(ctx); err != nil {
+		t.Errorf("list repositories: %v", err)
+	}
+}
@@ -0,0 +1,3 @@
+-- Attempts per build, and builds that passed only on retry.
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS flaky BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+-- Build durations, for the p95 baseline.
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS duration_ms BIGINT NULL;
@@ -0,0 +1,2 @@
+-- Retention deletes completed builds by status and age.
+ALTER TABLE build_records ADD INDEX IF NOT EXISTS idx_status_updated (status, updated_at);
@@ -0,0 +1,6 @@
+-- The image each build pushed, for provenance lookups by digest.
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS repo VARCHAR(255) NULL;
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS image_ref VARCHAR(512) NULL;
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS image_digest VARCHAR(80) NULL;
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS dockerfile_sha256 CHAR(64) NULL;
+ALTER TABLE build_records ADD INDEX IF NOT EXISTS idx_image_digest (image_digest);
@@ -0,0 +1,9 @@
+-- Notes attached to builds for post-incident review.
+CREATE TABLE IF NOT EXISTS build_annotations (
+  id         BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  build_id   BIGINT       NOT NULL,
+  author     VARCHAR(255) NOT NULL,
+  body       TEXT         NOT NULL,
+  created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  KEY idx_build (build_id)
+);
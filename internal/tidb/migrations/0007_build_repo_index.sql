@@ -0,0 +1,2 @@
+-- A repository's recent builds, for its feed.
+ALTER TABLE build_records ADD INDEX IF NOT EXISTS idx_repo_updated (repo, updated_at);
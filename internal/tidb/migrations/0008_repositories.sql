@@ -0,0 +1,7 @@
+-- The repository registry.
+CREATE TABLE IF NOT EXISTS repositories (
+  full_name  VARCHAR(255) NOT NULL PRIMARY KEY,
+  settings   JSON         NOT NULL,
+  created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
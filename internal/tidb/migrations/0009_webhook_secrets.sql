@@ -0,0 +1,4 @@
+-- Per-repository webhook secrets, with the previous one kept during
+-- rotation.
+ALTER TABLE repositories ADD COLUMN IF NOT EXISTS webhook_secret VARCHAR(255) NULL;
+ALTER TABLE repositories ADD COLUMN IF NOT EXISTS webhook_secret_previous VARCHAR(255) NULL;
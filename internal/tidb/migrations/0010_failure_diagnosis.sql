@@ -0,0 +1,3 @@
+-- The classification of failed builds.
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS failure_category VARCHAR(64) NULL;
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS failure_hint VARCHAR(512) NULL;
@@ -0,0 +1,4 @@
+-- Metered usage and estimated cost of builds.
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS cpu_seconds DOUBLE NULL;
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS image_bytes BIGINT NULL;
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS cost_usd DECIMAL(14,6) NULL;
@@ -0,0 +1,5 @@
+-- When builds were queued and which worker ran them, for the throughput
+-- report.
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS queued_at TIMESTAMP NULL;
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS worker VARCHAR(255) NULL;
+ALTER TABLE build_records ADD INDEX IF NOT EXISTS idx_claimed (claimed_at);
@@ -0,0 +1,4 @@
+-- Archived and soft-deleted builds.
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP NULL;
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+ALTER TABLE build_records ADD INDEX IF NOT EXISTS idx_deleted (deleted_at);
@@ -0,0 +1,7 @@
+-- Per-repository build numbers, assigned at enqueue time.
+CREATE TABLE IF NOT EXISTS build_numbers (
+  repo        VARCHAR(255) NOT NULL PRIMARY KEY,
+  last_number BIGINT       NOT NULL,
+  updated_at  TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS build_number BIGINT NULL;
@@ -0,0 +1,13 @@
+-- Pushes and builds that were skipped, and why.
+CREATE TABLE IF NOT EXISTS skipped_builds (
+  id         BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  repo       VARCHAR(255) NOT NULL,
+  sha        VARCHAR(64)  NOT NULL,
+  ref        VARCHAR(255) NOT NULL,
+  reason     VARCHAR(64)  NOT NULL,
+  detail     TEXT         NOT NULL,
+  source     VARCHAR(16)  NOT NULL,
+  created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  KEY idx_repo_created (repo, created_at),
+  KEY idx_created (created_at)
+);
@@ -0,0 +1,14 @@
+-- Periodic cache size snapshots of each worker.
+CREATE TABLE IF NOT EXISTS cache_snapshots (
+  id         BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  worker     VARCHAR(255) NOT NULL,
+  cache      VARCHAR(64)  NOT NULL,
+  bytes      BIGINT       NOT NULL,
+  files      BIGINT       NOT NULL,
+  hits       BIGINT       NOT NULL DEFAULT 0,
+  misses     BIGINT       NOT NULL DEFAULT 0,
+  evictions  BIGINT       NOT NULL DEFAULT 0,
+  taken_at   TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  KEY idx_cache_taken (cache, taken_at),
+  KEY idx_taken (taken_at)
+);
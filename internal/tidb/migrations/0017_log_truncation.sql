@@ -0,0 +1,2 @@
+-- Build output dropped by the log cap.
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS log_dropped_bytes BIGINT NULL;
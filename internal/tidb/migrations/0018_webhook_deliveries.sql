@@ -0,0 +1,2 @@
+-- When each repository's last signed webhook delivery arrived.
+ALTER TABLE repositories ADD COLUMN IF NOT EXISTS last_delivery_at TIMESTAMP NULL;
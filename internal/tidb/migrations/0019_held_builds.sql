@@ -0,0 +1,12 @@
+-- Build jobs held until a change freeze ends.
+CREATE TABLE IF NOT EXISTS held_builds (
+  id         BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  repo       VARCHAR(255) NOT NULL,
+  sha        VARCHAR(64)  NOT NULL,
+  reason     TEXT         NOT NULL,
+  job        MEDIUMTEXT   NOT NULL,
+  release_at TIMESTAMP    NOT NULL,
+  created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  KEY idx_release (release_at),
+  KEY idx_repo (repo)
+);
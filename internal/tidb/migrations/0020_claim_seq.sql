@@ -0,0 +1,2 @@
+-- The claim sequence fencing build status updates.
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS claim_seq INT NOT NULL DEFAULT 1;
@@ -0,0 +1,12 @@
+-- Base images kept pre-pulled on each worker.
+CREATE TABLE IF NOT EXISTS warm_images (
+  worker     VARCHAR(255) NOT NULL,
+  image      VARCHAR(512) NOT NULL,
+  digest     VARCHAR(80)  NOT NULL,
+  image_id   VARCHAR(80)  NOT NULL,
+  uses       DOUBLE       NOT NULL DEFAULT 0,
+  pinned     BOOLEAN      NOT NULL DEFAULT FALSE,
+  pulled_at  TIMESTAMP    NOT NULL,
+  checked_at TIMESTAMP    NOT NULL,
+  PRIMARY KEY (worker, image)
+);
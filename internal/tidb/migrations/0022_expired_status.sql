@@ -0,0 +1,2 @@
+-- Pending build records left past the job TTL are marked expired.
+ALTER TABLE build_records MODIFY COLUMN status ENUM('pending','success','failure','expired') NOT NULL DEFAULT 'pending';
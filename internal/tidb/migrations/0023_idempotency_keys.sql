@@ -0,0 +1,12 @@
+-- Responses to requests carrying an Idempotency-Key, replayed on retries.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  scope        VARCHAR(255) NOT NULL,
+  idem_key     VARCHAR(255) NOT NULL,
+  fingerprint  CHAR(64)     NOT NULL,
+  status       INT          NOT NULL DEFAULT 0,
+  content_type VARCHAR(255) NOT NULL DEFAULT '',
+  body         MEDIUMBLOB   NULL,
+  created_at   TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (scope, idem_key),
+  KEY idx_created (created_at)
+);
@@ -0,0 +1,8 @@
+-- Organization-wide defaults for .ocibuild.yaml, which each repository of
+-- the owner inherits and overrides per key.
+CREATE TABLE IF NOT EXISTS org_build_configs (
+  owner      VARCHAR(255) NOT NULL PRIMARY KEY,
+  config     TEXT         NOT NULL,
+  updated_by VARCHAR(255) NOT NULL DEFAULT '',
+  updated_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+-- Non-fatal findings of a build's last attempt, as a JSON array of
+-- {code, severity, message}; see package buildwarn.
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS warnings JSON NULL;
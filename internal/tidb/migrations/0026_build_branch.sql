@@ -0,0 +1,4 @@
+-- The branch each build was pushed to, so flakiness is tracked per
+-- repository and branch.
+ALTER TABLE build_records ADD COLUMN IF NOT EXISTS branch VARCHAR(255) NULL;
+ALTER TABLE build_records ADD INDEX IF NOT EXISTS idx_repo_branch (repo, branch);
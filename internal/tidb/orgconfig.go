@@ -0,0 +1,71 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OrgBuildConfig is an organization's default .ocibuild.yaml, which every
+// repository of the owner inherits and can override per key.
+type OrgBuildConfig struct {
+	Owner     string    `json:"owner"` // lowercase
+	Config    string    `json:"config"`
+	UpdatedBy string    `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrgBuildConfigRepository stores organization build defaults.
+type OrgBuildConfigRepository struct {
+	db *sql.DB
+}
+
+// NewOrgBuildConfigRepository creates an OrgBuildConfigRepository.
+func NewOrgBuildConfigRepository(db *sql.DB) *OrgBuildConfigRepository {
+	return &OrgBuildConfigRepository{db: db}
+}
+
+// Get returns an owner's build defaults, or sql.ErrNoRows.
+func (r *OrgBuildConfigRepository) Get(ctx context.Context, owner string) (*OrgBuildConfig, error) {
+	var c OrgBuildConfig
+	err := r.db.QueryRowContext(ctx,
+		`SELECT owner, config, updated_by, updated_at FROM org_build_configs WHERE owner = ?`,
+		strings.ToLower(owner),
+	).Scan(&c.Owner, &c.Config, &c.UpdatedBy, &c.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get build defaults of %s: %w", owner, err)
+	}
+	return &c, nil
+}
+
+// Put sets an owner's build defaults, returning them as stored.
+func (r *OrgBuildConfigRepository) Put(ctx context.Context, owner, config, by string) (*OrgBuildConfig, error) {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO org_build_configs (owner, config, updated_by) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE config = VALUES(config), updated_by = VALUES(updated_by)
+	`, strings.ToLower(owner), config, by)
+	if err != nil {
+		return nil, fmt.Errorf("put build defaults of %s: %w", owner, err)
+	}
+	return r.Get(ctx, owner)
+}
+
+// Delete removes an owner's build defaults. It returns sql.ErrNoRows when
+// the owner has none.
+func (r *OrgBuildConfigRepository) Delete(ctx context.Context, owner string) error {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM org_build_configs WHERE owner = ?`, strings.ToLower(owner))
+	if err != nil {
+		return fmt.Errorf("delete build defaults of %s: %w", owner, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Repository is an onboarded repository and its build settings.
+type Repository struct {
+	FullName string             `json:"full_name"` // "owner/name", lowercase
+	Settings RepositorySettings `json:"settings"`
+	// HasWebhookSecret reports whether the repository's webhooks are signed
+	// with its own secret instead of github.webhook_secret. The secret
+	// itself is never returned.
+	HasWebhookSecret bool `json:"has_webhook_secret"`
+	// LastDeliveryAt is when the repository's last webhook delivery with a
+	// valid signature arrived, such as the ping GitHub sends when a
+	// webhook is created. Nil when none has arrived since onboarding.
+	LastDeliveryAt *time.Time `json:"last_delivery_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// RepositorySettings are per-repository overrides, stored as JSON so new
+// settings need no schema change.
+type RepositorySettings struct {
+	// Registry and Namespace override where the repository's images are
+	// pushed, like a registry.images mapping.
+	Registry  string `json:"registry,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Env is passed to builds of the repository.
+	Env map[string]string `json:"env,omitempty"`
+	// Projects limits builds to nx projects matching these path.Match
+	// patterns. Empty builds every affected project.
+	Projects []string `json:"projects,omitempty"`
+	// Notify lists notification targets for build results.
+	Notify []string `json:"notify,omitempty"`
+	// Requires and Avoids are worker labels the repository's builds should
+	// run on or away from, such as "large-memory"; see nats.Affinity.
+	Requires []string `json:"requires,omitempty"`
+	Avoids   []string `json:"avoids,omitempty"`
+	// Language pins the language of the repository's projects, bypassing
+	// detection, and Languages that of single projects; see
+	// detection.PinNames. The repository's .ocibuild.yaml takes precedence.
+	Language  string            `json:"language,omitempty"`
+	Languages map[string]string `json:"languages,omitempty"`
+	// FailOnWarning fails project builds with warnings of this severity
+	// or above: "info", "warning" or "critical". Empty only reports them.
+	FailOnWarning string `json:"fail_on_warning,omitempty"`
+}
+
+// RepositoryRepository manages the repository registry in TiDB.
+type RepositoryRepository struct {
+	db *sql.DB
+}
+
+// NewRepositoryRepository creates a RepositoryRepository.
+func NewRepositoryRepository(db *sql.DB) *RepositoryRepository {
+	return &RepositoryRepository{db: db}
+}
+
+// NormalizeRepoName returns the registry key of a repository full name.
+// GitHub owner and repository names are case-insensitive.
+func NormalizeRepoName(fullName string) string {
+	return strings.ToLower(fullName)
+}
+
+// repositoryColumns selects a repositories row for scanRepository.
+const repositoryColumns = `full_name, settings, webhook_secret IS NOT NULL, last_delivery_at, created_at, updated_at`
+
+// Get returns an onboarded repository, or sql.ErrNoRows.
+func (r *RepositoryRepository) Get(ctx context.Context, fullName string) (*Repository, error) {
+	repo, err := scanRepository(r.db.QueryRowContext(ctx,
+		`SELECT `+repositoryColumns+` FROM repositories WHERE full_name = ?`,
+		NormalizeRepoName(fullName),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get repository %s: %w", fullName, err)
+	}
+	return repo, nil
+}
+
+// List returns every onboarded repository, ordered by name.
+func (r *RepositoryRepository) List(ctx context.Context) ([]Repository, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+repositoryColumns+` FROM repositories ORDER BY full_name`)
+	if err != nil {
+		return nil, fmt.Errorf("list repositories: %w", err)
+	}
+	defer rows.Close()
+
+	repos := []Repository{}
+	for rows.Next() {
+		repo, err := scanRepository(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan repository: %w", err)
+		}
+		repos = append(repos, *repo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository rows: %w", err)
+	}
+	return repos, nil
+}
+
+// Put onboards a repository or replaces its settings, returning it as
+// stored.
+func (r *RepositoryRepository) Put(ctx context.Context, fullName string, settings RepositorySettings) (*Repository, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("marshal repository settings: %w", err)
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO repositories (full_name, settings) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE settings = VALUES(settings)
+	`, NormalizeRepoName(fullName), string(data))
+	if err != nil {
+		return nil, fmt.Errorf("put repository %s: %w", fullName, err)
+	}
+	return r.Get(ctx, fullName)
+}
+
+// Delete removes a repository from the registry. It returns sql.ErrNoRows
+// when the repository was not onboarded.
+func (r *RepositoryRepository) Delete(ctx context.Context, fullName string) error {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM repositories WHERE full_name = ?`, NormalizeRepoName(fullName))
+	if err != nil {
+		return fmt.Errorf("delete repository %s: %w", fullName, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// WebhookSecrets returns the secrets a repository's webhooks may be signed
+// with: the current one and, during a rotation, the previous one. It
+// returns nil when the repository is not onboarded or has no secret of its
+// own.
+func (r *RepositoryRepository) WebhookSecrets(ctx context.Context, fullName string) ([]string, error) {
+	var current, previous sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		`SELECT webhook_secret, webhook_secret_previous FROM repositories WHERE full_name = ?`,
+		NormalizeRepoName(fullName),
+	).Scan(&current, &previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("webhook secrets of %s: %w", fullName, err)
+	}
+	var secrets []string
+	for _, s := range []sql.NullString{current, previous} {
+		if s.Valid && s.String != "" {
+			secrets = append(secrets, s.String)
+		}
+	}
+	return secrets, nil
+}
+
+// RotateWebhookSecret sets a repository's webhook secret. The replaced
+// secret stays valid until the next rotation, so the GitHub hook can be
+// updated without dropping deliveries. It returns sql.ErrNoRows when the
+// repository is not onboarded.
+func (r *RepositoryRepository) RotateWebhookSecret(ctx context.Context, fullName, secret string) error {
+	if err := r.onboarded(ctx, fullName); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE repositories
+		SET webhook_secret_previous = webhook_secret, webhook_secret = ?
+		WHERE full_name = ?
+	`, secret, NormalizeRepoName(fullName))
+	if err != nil {
+		return fmt.Errorf("rotate webhook secret of %s: %w", fullName, err)
+	}
+	return nil
+}
+
+// ClearWebhookSecret removes a repository's own webhook secrets, falling
+// back to github.webhook_secret. It returns sql.ErrNoRows when the
+// repository is not onboarded.
+func (r *RepositoryRepository) ClearWebhookSecret(ctx context.Context, fullName string) error {
+	if err := r.onboarded(ctx, fullName); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE repositories SET webhook_secret = NULL, webhook_secret_previous = NULL
+		WHERE full_name = ?
+	`, NormalizeRepoName(fullName))
+	if err != nil {
+		return fmt.Errorf("clear webhook secret of %s: %w", fullName, err)
+	}
+	return nil
+}
+
+// RecordDelivery notes that a webhook delivery for a repository arrived.
+// Repositories that are not onboarded are ignored. It leaves updated_at,
+// the time the settings changed, alone.
+func (r *RepositoryRepository) RecordDelivery(ctx context.Context, fullName string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE repositories SET last_delivery_at = CURRENT_TIMESTAMP, updated_at = updated_at
+		WHERE full_name = ?
+	`, NormalizeRepoName(fullName))
+	if err != nil {
+		return fmt.Errorf("record webhook delivery of %s: %w", fullName, err)
+	}
+	return nil
+}
+
+// onboarded returns sql.ErrNoRows when a repository is not in the registry.
+// Updates cannot tell a missing row from an unchanged one by rows affected.
+func (r *RepositoryRepository) onboarded(ctx context.Context, fullName string) error {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT TRUE FROM repositories WHERE full_name = ?`, NormalizeRepoName(fullName),
+	).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("look up repository %s: %w", fullName, err)
+	}
+	return nil
+}
+
+func scanRepository(row interface{ Scan(...any) error }) (*Repository, error) {
+	var (
+		repo      Repository
+		settings  []byte
+		delivered sql.NullTime
+	)
+	if err := row.Scan(&repo.FullName, &settings, &repo.HasWebhookSecret, &delivered, &repo.CreatedAt, &repo.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if delivered.Valid {
+		repo.LastDeliveryAt = &delivered.Time
+	}
+	if err := json.Unmarshal(settings, &repo.Settings); err != nil {
+		return nil, fmt.Errorf("decode settings of %s: %w", repo.FullName, err)
+	}
+	return &repo, nil
+}
@@ -0,0 +1,141 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Reasons a push or build job was not built.
+const (
+	SkipBranchFilter       = "branch_filter"        // the push was not to main
+	SkipBranchDeleted      = "branch_deleted"       // the push deleted the branch
+	SkipNoCommits          = "no_commits"           // the push added no commits
+	SkipPropagationCommits = "propagation_commits"  // only [skip build] version bumps
+	SkipDuplicate          = "duplicate"            // the commit was already processed
+	SkipNoAffectedProjects = "no_affected_projects" // no project changed, after directives
+	SkipRepoUnreachable    = "repo_unreachable"     // git ls-remote failed or timed out
+	SkipFrozen             = "frozen"               // a change freeze was in effect
+	SkipExpired            = "expired"              // queued longer than worker.job_ttl_hours
+	SkipSignature          = "signature"            // the commit signature was rejected by policy
+	SkipInvalidConfig      = "invalid_config"       // the commit's .ocibuild.yaml is invalid
+	SkipQuota              = "quota"                // the job outgrew worker.workspace_quota_mb
+	SkipCheckoutMismatch   = "checkout_mismatch"    // the checkout does not match the webhook commit
+	SkipClosed             = "closed"               // the repository is not onboarded, in closed mode
+)
+
+// Where a skip was decided.
+const (
+	SkipSourceWebhook   = "webhook"
+	SkipSourceWorker    = "worker"
+	SkipSourceSimulated = "simulated" // a push synthesized by POST /webhook/simulate
+)
+
+// SkippedBuild records a push or build job that was deliberately not built,
+// so "why didn't my push build?" can be answered without the logs.
+type SkippedBuild struct {
+	ID        int64     `json:"id"`
+	Repo      string    `json:"repo"` // owner/name
+	SHA       string    `json:"sha"`
+	Ref       string    `json:"ref"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail,omitempty"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SkipFilter selects skipped builds; zero fields match everything.
+type SkipFilter struct {
+	Repo   string
+	SHA    string
+	Reason string
+	Since  time.Time
+	Limit  int
+}
+
+// SkippedBuildRepository manages skipped build records in TiDB.
+type SkippedBuildRepository struct {
+	db *sql.DB
+}
+
+// NewSkippedBuildRepository creates a SkippedBuildRepository.
+func NewSkippedBuildRepository(db *sql.DB) *SkippedBuildRepository {
+	return &SkippedBuildRepository{db: db}
+}
+
+// Record stores a skipped build.
+func (r *SkippedBuildRepository) Record(ctx context.Context, s SkippedBuild) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO skipped_builds (repo, sha, ref, reason, detail, source) VALUES (?, ?, ?, ?, ?, ?)`,
+		NormalizeRepoName(s.Repo), s.SHA, s.Ref, s.Reason, s.Detail, s.Source,
+	)
+	if err != nil {
+		return fmt.Errorf("insert skipped build: %w", err)
+	}
+	return nil
+}
+
+// List returns the skipped builds matching f, newest first.
+func (r *SkippedBuildRepository) List(ctx context.Context, f SkipFilter) ([]SkippedBuild, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if f.Repo != "" {
+		where, args = append(where, "repo = ?"), append(args, NormalizeRepoName(f.Repo))
+	}
+	if f.SHA != "" {
+		where, args = append(where, "sha LIKE ?"), append(args, f.SHA+"%")
+	}
+	if f.Reason != "" {
+		where, args = append(where, "reason = ?"), append(args, f.Reason)
+	}
+	if !f.Since.IsZero() {
+		where, args = append(where, "created_at >= ?"), append(args, f.Since)
+	}
+	query := `SELECT id, repo, sha, ref, reason, detail, source, created_at FROM skipped_builds`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, f.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list skipped builds: %w", err)
+	}
+	defer rows.Close()
+
+	skips := []SkippedBuild{}
+	for rows.Next() {
+		var s SkippedBuild
+		if err := rows.Scan(&s.ID, &s.Repo, &s.SHA, &s.Ref, &s.Reason, &s.Detail, &s.Source, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan skipped build: %w", err)
+		}
+		skips = append(skips, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("skipped build rows: %w", err)
+	}
+	return skips, nil
+}
+
+// DeleteBefore removes skipped builds recorded before cutoff. With dryRun
+// it only counts them.
+func (r *SkippedBuildRepository) DeleteBefore(ctx context.Context, cutoff time.Time, dryRun bool) (int64, error) {
+	if dryRun {
+		var n int64
+		if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM skipped_builds WHERE created_at < ?`, cutoff).Scan(&n); err != nil {
+			return 0, fmt.Errorf("count expired skipped builds: %w", err)
+		}
+		return n, nil
+	}
+	res, err := r.db.ExecContext(ctx, `DELETE FROM skipped_builds WHERE created_at < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired skipped builds: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
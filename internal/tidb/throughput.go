@@ -0,0 +1,142 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RecordQueued stores when a claimed build's job was published, its
+// repository build number (0 when none was assigned) and the worker that
+// claimed it, for queue wait and utilization reporting.
+func (r *BuildRecordRepository) RecordQueued(ctx context.Context, project, commitSHA string, queuedAt time.Time, buildNumber int64, worker string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE build_records SET queued_at = ?, build_number = NULLIF(?, 0), worker = ? WHERE project = ? AND commit_sha = ?`,
+		queuedAt, buildNumber, worker, project, commitSHA,
+	)
+	if err != nil {
+		return fmt.Errorf("record queued: %w", err)
+	}
+	return nil
+}
+
+// DayThroughput summarizes the builds claimed on one UTC day.
+type DayThroughput struct {
+	Day       string `json:"day"` // YYYY-MM-DD
+	Started   int64  `json:"started"`
+	Completed int64  `json:"completed"`
+	Failed    int64  `json:"failed"`
+	// QueueWaitP50 and QueueWaitP95 are the median and 95th percentile time
+	// from job publication to claim, in seconds. Builds claimed before
+	// queue times were recorded are not counted.
+	QueueWaitP50 float64 `json:"queue_wait_p50_seconds"`
+	QueueWaitP95 float64 `json:"queue_wait_p95_seconds"`
+	// Workers is the number of distinct workers that claimed a build.
+	Workers int `json:"workers"`
+	// Utilization is the percentage of the day's build slots (workers ×
+	// slots per worker × elapsed time) spent on builds, from each build's
+	// claim and last update timestamps.
+	Utilization float64 `json:"utilization_percent"`
+}
+
+// throughputSample is one build_records row of a throughput report.
+type throughputSample struct {
+	status    BuildStatus
+	claimedAt time.Time
+	updatedAt time.Time
+	queuedAt  sql.NullTime
+	worker    sql.NullString
+}
+
+// ThroughputSince reports daily throughput for builds claimed since the
+// given time, oldest day first. slotsPerWorker is the number of builds a
+// worker runs concurrently.
+func (r *BuildRecordRepository) ThroughputSince(ctx context.Context, since time.Time, slotsPerWorker int) ([]DayThroughput, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT status, claimed_at, updated_at, queued_at, worker
+		FROM build_records
+		WHERE claimed_at >= ?
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("throughput: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []throughputSample
+	for rows.Next() {
+		var s throughputSample
+		if err := rows.Scan(&s.status, &s.claimedAt, &s.updatedAt, &s.queuedAt, &s.worker); err != nil {
+			return nil, fmt.Errorf("throughput scan: %w", err)
+		}
+		samples = append(samples, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("throughput rows: %w", err)
+	}
+	return summarizeThroughput(samples, slotsPerWorker, time.Now()), nil
+}
+
+// summarizeThroughput groups samples by the UTC day they were claimed. The
+// current day's capacity only counts the time elapsed up to now.
+func summarizeThroughput(samples []throughputSample, slotsPerWorker int, now time.Time) []DayThroughput {
+	type acc struct {
+		DayThroughput
+		waits   []float64
+		workers map[string]bool
+		busy    time.Duration
+	}
+	days := map[string]*acc{}
+	for _, s := range samples {
+		key := s.claimedAt.UTC().Format(time.DateOnly)
+		d := days[key]
+		if d == nil {
+			d = &acc{DayThroughput: DayThroughput{Day: key}, workers: map[string]bool{}}
+			days[key] = d
+		}
+		d.Started++
+		switch s.status {
+		case BuildStatusSuccess:
+			d.Completed++
+		case BuildStatusFailure:
+			d.Failed++
+		}
+		if s.queuedAt.Valid {
+			wait := max(s.claimedAt.Sub(s.queuedAt.Time), 0)
+			d.waits = append(d.waits, wait.Seconds())
+		}
+		if s.worker.Valid && s.worker.String != "" {
+			d.workers[s.worker.String] = true
+		}
+		if s.status != BuildStatusPending && s.status != BuildStatusExpired {
+			d.busy += max(s.updatedAt.Sub(s.claimedAt), 0)
+		}
+	}
+
+	out := make([]DayThroughput, 0, len(days))
+	for _, d := range days {
+		sort.Float64s(d.waits)
+		d.QueueWaitP50 = percentile(d.waits, 50)
+		d.QueueWaitP95 = percentile(d.waits, 95)
+		d.Workers = len(d.workers)
+
+		start, _ := time.Parse(time.DateOnly, d.Day)
+		span := min(now.Sub(start), 24*time.Hour)
+		if capacity := time.Duration(d.Workers*max(slotsPerWorker, 1)) * span; capacity > 0 {
+			d.Utilization = min(100*float64(d.busy)/float64(capacity), 100)
+		}
+		out = append(out, d.DayThroughput)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Day < out[j].Day })
+	return out
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted values, or
+// 0 when there are none.
+func percentile(sorted []float64, p int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[(len(sorted)*p+99)/100-1]
+}
@@ -0,0 +1,57 @@
+package tidb
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestSummarizeThroughput(t *testing.T) {
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return day.Add(d) }
+	queued := func(d time.Duration) sql.NullTime { return sql.NullTime{Time: at(d), Valid: true} }
+	worker := func(name string) sql.NullString { return sql.NullString{String: name, Valid: true} }
+
+	samples := []throughputSample{
+		{BuildStatusSuccess, at(time.Hour), at(7 * time.Hour), queued(time.Hour - 10*time.Second), worker("w1")},
+		{BuildStatusFailure, at(2 * time.Hour), at(8 * time.Hour), queued(2*time.Hour - 30*time.Second), worker("w2")},
+		{BuildStatusPending, at(3 * time.Hour), at(3 * time.Hour), queued(3*time.Hour - 20*time.Second), worker("w1")},
+		{BuildStatusSuccess, at(26 * time.Hour), at(27 * time.Hour), sql.NullTime{}, sql.NullString{}},
+	}
+	got := summarizeThroughput(samples, 1, at(72*time.Hour))
+	if len(got) != 2 {
+		t.Fatalf("days = %+v, want 2", got)
+	}
+
+	first := got[0]
+	if first.Day != "2026-03-02" || first.Started != 3 || first.Completed != 1 || first.Failed != 1 {
+		t.Errorf("first day = %+v", first)
+	}
+	if first.QueueWaitP50 != 20 || first.QueueWaitP95 != 30 {
+		t.Errorf("queue wait p50/p95 = %v/%v, want 20/30", first.QueueWaitP50, first.QueueWaitP95)
+	}
+	// 12 busy hours over 2 workers × 1 slot × 24 hours.
+	if first.Workers != 2 || first.Utilization != 25 {
+		t.Errorf("workers/utilization = %d/%v, want 2/25", first.Workers, first.Utilization)
+	}
+
+	second := got[1]
+	if second.Day != "2026-03-03" || second.Completed != 1 || second.QueueWaitP50 != 0 || second.Utilization != 0 {
+		t.Errorf("second day = %+v", second)
+	}
+}
+
+func TestSummarizeThroughputPartialDay(t *testing.T) {
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	samples := []throughputSample{{
+		status:    BuildStatusSuccess,
+		claimedAt: day.Add(time.Hour),
+		updatedAt: day.Add(2 * time.Hour),
+		worker:    sql.NullString{String: "w1", Valid: true},
+	}}
+	got := summarizeThroughput(samples, 2, day.Add(4*time.Hour))
+	// 1 busy hour over 1 worker × 2 slots × 4 elapsed hours.
+	if got[0].Utilization != 12.5 {
+		t.Errorf("utilization = %v, want 12.5", got[0].Utilization)
+	}
+}
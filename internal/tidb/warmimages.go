@@ -0,0 +1,95 @@
+package tidb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WarmImage is a base image a worker keeps pulled for its builds.
+type WarmImage struct {
+	Worker  string `json:"worker"`
+	Image   string `json:"image"`
+	Digest  string `json:"digest"` // registry manifest digest when pulled
+	ImageID string `json:"image_id"`
+	// Uses counts the builds from the image, decayed so recent builds
+	// weigh more.
+	Uses float64 `json:"uses"`
+	// Pinned is true for images configured in buildah.warm_images.images.
+	Pinned    bool      `json:"pinned"`
+	PulledAt  time.Time `json:"pulled_at"`
+	CheckedAt time.Time `json:"checked_at"` // last digest check
+}
+
+// WarmImageRepository manages the workers' warm image sets in TiDB.
+type WarmImageRepository struct {
+	db *sql.DB
+}
+
+// NewWarmImageRepository creates a WarmImageRepository.
+func NewWarmImageRepository(db *sql.DB) *WarmImageRepository {
+	return &WarmImageRepository{db: db}
+}
+
+// Replace stores images as the whole warm set of worker.
+func (r *WarmImageRepository) Replace(ctx context.Context, worker string, images []WarmImage) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("replace warm images: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM warm_images WHERE worker = ?`, worker); err != nil {
+		return fmt.Errorf("delete warm images: %w", err)
+	}
+	if len(images) > 0 {
+		values := make([]string, len(images))
+		args := make([]any, 0, len(images)*8)
+		for i, w := range images {
+			values[i] = "(?, ?, ?, ?, ?, ?, ?, ?)"
+			args = append(args, worker, w.Image, w.Digest, w.ImageID, w.Uses, w.Pinned, w.PulledAt.UTC(), w.CheckedAt.UTC())
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO warm_images (worker, image, digest, image_id, uses, pinned, pulled_at, checked_at) VALUES `+
+				strings.Join(values, ", "),
+			args...,
+		)
+		if err != nil {
+			return fmt.Errorf("insert warm images: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("replace warm images: %w", err)
+	}
+	return nil
+}
+
+// List returns the warm images of worker, or of every worker when it is
+// empty, by worker and most used first.
+func (r *WarmImageRepository) List(ctx context.Context, worker string) ([]WarmImage, error) {
+	query := `SELECT worker, image, digest, image_id, uses, pinned, pulled_at, checked_at FROM warm_images`
+	var args []any
+	if worker != "" {
+		query, args = query+` WHERE worker = ?`, append(args, worker)
+	}
+	rows, err := r.db.QueryContext(ctx, query+` ORDER BY worker, pinned DESC, uses DESC, image`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list warm images: %w", err)
+	}
+	defer rows.Close()
+
+	images := []WarmImage{}
+	for rows.Next() {
+		var w WarmImage
+		if err := rows.Scan(&w.Worker, &w.Image, &w.Digest, &w.ImageID, &w.Uses, &w.Pinned, &w.PulledAt, &w.CheckedAt); err != nil {
+			return nil, fmt.Errorf("scan warm image: %w", err)
+		}
+		images = append(images, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("warm image rows: %w", err)
+	}
+	return images, nil
+}
@@ -0,0 +1,127 @@
+package toolchain
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// dotnet provisions the .NET SDK from the release-metadata feed.
+type dotnet struct {
+	m    *Manager
+	feed string
+}
+
+func (*dotnet) name() string { return "dotnet" }
+
+// detect turns global.json's sdk.version and rollForward policy into a
+// version range.
+func (*dotnet) detect(repoDir string) (string, string, error) {
+	data, err := os.ReadFile(filepath.Join(repoDir, "global.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	var g struct {
+		SDK struct {
+			Version     string `json:"version"`
+			RollForward string `json:"rollForward"`
+		} `json:"sdk"`
+	}
+	if err := json.Unmarshal(data, &g); err != nil {
+		return "", "", fmt.Errorf("parse global.json: %w", err)
+	}
+	if g.SDK.Version == "" {
+		return "", "", nil
+	}
+	v, ok := parseVersion(g.SDK.Version)
+	if !ok {
+		return "", "", fmt.Errorf("global.json: invalid sdk version %q", g.SDK.Version)
+	}
+
+	// SDK patch numbers hold the feature band: 8.0.1xx.
+	band := version{v[0], v[1], v[2] - v[2]%100 + 100}
+	var hi version
+	switch strings.ToLower(g.SDK.RollForward) {
+	case "disable":
+		return v.String(), "global.json", nil
+	case "", "patch", "latestpatch":
+		hi = band
+	case "feature", "latestfeature":
+		hi = v.bump(2)
+	default: // minor, latestMinor, major, latestMajor
+		hi = v.bump(1)
+	}
+	return fmt.Sprintf(">=%s <%s", v, hi), "global.json", nil
+}
+
+func (*dotnet) constraint(spec string) (versionRange, error) {
+	return parseRange(spec)
+}
+
+// resolve picks the newest SDK matching r in the release channel of its
+// lowest accepted version; rolling forward never leaves that channel.
+func (d *dotnet) resolve(ctx context.Context, spec string, r versionRange) (version, artifact, error) {
+	lo, _, err := parsePartial(strings.TrimLeft(strings.Fields(spec)[0], ">="))
+	if err != nil {
+		return version{}, artifact{}, err
+	}
+	rid := runtime.GOOS + "-" + map[string]string{"amd64": "x64", "arm64": "arm64"}[runtime.GOARCH]
+	body, err := d.m.get(ctx, fmt.Sprintf("%s/release-metadata/%d.%d/releases.json", d.feed, lo[0], lo[1]))
+	if err != nil {
+		return version{}, artifact{}, err
+	}
+	defer body.Close()
+	var meta struct {
+		Releases []struct {
+			SDKs []struct {
+				Version string `json:"version"`
+				Files   []struct {
+					Name string `json:"name"`
+					RID  string `json:"rid"`
+					URL  string `json:"url"`
+					Hash string `json:"hash"`
+				} `json:"files"`
+			} `json:"sdks"`
+		} `json:"releases"`
+	}
+	if err := json.NewDecoder(body).Decode(&meta); err != nil {
+		return version{}, artifact{}, fmt.Errorf("decode dotnet releases: %w", err)
+	}
+
+	var (
+		best  version
+		found artifact
+	)
+	for _, rel := range meta.Releases {
+		for _, sdk := range rel.SDKs {
+			v, ok := parseVersion(sdk.Version)
+			if !ok || !r.match(v) || (found.url != "" && v.compare(best) <= 0) {
+				continue
+			}
+			for _, f := range sdk.Files {
+				if f.RID == rid && strings.HasSuffix(f.Name, ".tar.gz") {
+					// The SDK archive has no top-level directory.
+					best, found = v, artifact{url: f.URL, newHash: sha512.New, sum: f.Hash}
+				}
+			}
+		}
+	}
+	if found.url == "" {
+		return version{}, artifact{}, fmt.Errorf("no .NET SDK for %s matches %q", rid, spec)
+	}
+	return best, found, nil
+}
+
+func (*dotnet) layout(home string) (string, []string) {
+	return home, []string{"DOTNET_ROOT=" + home}
+}
@@ -0,0 +1,122 @@
+package toolchain
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// golang provisions Go from go.dev/dl or a mirror of it.
+type golang struct {
+	m    *Manager
+	dist string
+}
+
+func (*golang) name() string { return "go" }
+
+// detect reads the workspace's go.work, else its go.mod. A toolchain line
+// pins the exact release and wins over the go directive.
+func (*golang) detect(repoDir string) (string, string, error) {
+	for _, name := range []string{"go.work", "go.mod"} {
+		f, err := os.Open(filepath.Join(repoDir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		var directive, toolchain string
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) != 2 {
+				continue
+			}
+			switch fields[0] {
+			case "go":
+				directive = fields[1]
+			case "toolchain":
+				toolchain = "=" + strings.TrimPrefix(fields[1], "go")
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return "", "", err
+		}
+		if toolchain != "" {
+			return toolchain, name + " toolchain", nil
+		}
+		if directive != "" {
+			return directive, name, nil
+		}
+	}
+	return "", "", nil
+}
+
+// constraint treats a go directive as a minimum within its minor release,
+// so "1.22" and "1.22.1" select the newest 1.22 patch. "=1.22.3", from a
+// toolchain line, is exact.
+func (*golang) constraint(spec string) (versionRange, error) {
+	if exact, ok := strings.CutPrefix(spec, "="); ok {
+		return parseRange(exact)
+	}
+	return parseRange("~" + spec)
+}
+
+// resolve picks the newest stable release matching r that has an archive
+// for this platform.
+func (g *golang) resolve(ctx context.Context, spec string, r versionRange) (version, artifact, error) {
+	body, err := g.m.get(ctx, g.dist+"/?mode=json&include=all")
+	if err != nil {
+		return version{}, artifact{}, err
+	}
+	defer body.Close()
+	var releases []struct {
+		Version string `json:"version"`
+		Stable  bool   `json:"stable"`
+		Files   []struct {
+			Filename string `json:"filename"`
+			OS       string `json:"os"`
+			Arch     string `json:"arch"`
+			SHA256   string `json:"sha256"`
+			Kind     string `json:"kind"`
+		} `json:"files"`
+	}
+	if err := json.NewDecoder(body).Decode(&releases); err != nil {
+		return version{}, artifact{}, fmt.Errorf("decode go releases: %w", err)
+	}
+
+	var (
+		best  version
+		found artifact
+	)
+	for _, rel := range releases {
+		v, ok := parseVersion(strings.TrimPrefix(rel.Version, "go"))
+		if !ok || !rel.Stable || !r.match(v) || (found.url != "" && v.compare(best) <= 0) {
+			continue
+		}
+		for _, f := range rel.Files {
+			if f.Kind == "archive" && f.OS == runtime.GOOS && f.Arch == runtime.GOARCH && strings.HasSuffix(f.Filename, ".tar.gz") {
+				best = v
+				found = artifact{url: g.dist + "/" + f.Filename, newHash: sha256.New, sum: f.SHA256, strip: true}
+			}
+		}
+	}
+	if found.url == "" {
+		return version{}, artifact{}, fmt.Errorf("no go release for %s/%s matches %q", runtime.GOOS, runtime.GOARCH, spec)
+	}
+	return best, found, nil
+}
+
+// layout keeps the go command from switching to another toolchain itself.
+func (*golang) layout(home string) (string, []string) {
+	return filepath.Join(home, "bin"), []string{"GOROOT=" + home, "GOTOOLCHAIN=local"}
+}
@@ -0,0 +1,128 @@
+package toolchain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// java provisions Eclipse Temurin JDKs through the Adoptium API.
+type java struct {
+	m   *Manager
+	api string
+}
+
+func (*java) name() string { return "java" }
+
+// detect reads .java-version (jenv), else the java line of .sdkmanrc.
+func (*java) detect(repoDir string) (string, string, error) {
+	spec, err := firstLine(filepath.Join(repoDir, ".java-version"))
+	if err != nil || spec != "" {
+		return spec, ".java-version", err
+	}
+	rc, err := keyValues(filepath.Join(repoDir, ".sdkmanrc"))
+	if err != nil {
+		return "", "", err
+	}
+	if v := rc["java"]; v != "" {
+		// SDKMAN versions carry a vendor suffix: 21.0.2-tem.
+		v, _, _ = strings.Cut(v, "-")
+		return v, ".sdkmanrc", nil
+	}
+	return "", "", nil
+}
+
+// constraint accepts a feature release ("21", or "1.8" for 8) or an exact
+// version.
+func (*java) constraint(spec string) (versionRange, error) {
+	spec = strings.TrimPrefix(spec, "1.")
+	if _, n, err := parsePartial(spec); err == nil && n < 3 {
+		// "17.0" means any 17, like "17".
+		spec, _, _ = strings.Cut(spec, ".")
+	}
+	return parseRange(spec)
+}
+
+// resolve returns the latest GA release of the requested feature version;
+// the Adoptium API serves only the latest build of each feature release.
+func (j *java) resolve(ctx context.Context, spec string, r versionRange) (version, artifact, error) {
+	feature, _, _ := strings.Cut(strings.TrimPrefix(spec, "1."), ".")
+	if _, err := strconv.Atoi(feature); err != nil {
+		return version{}, artifact{}, fmt.Errorf("invalid java version %q", spec)
+	}
+	arch := map[string]string{"amd64": "x64", "arm64": "aarch64"}[runtime.GOARCH]
+	if arch == "" {
+		return version{}, artifact{}, fmt.Errorf("no jdk release for %s", runtime.GOARCH)
+	}
+	q := url.Values{
+		"architecture": {arch},
+		"image_type":   {"jdk"},
+		"os":           {runtime.GOOS},
+		"vendor":       {"eclipse"},
+	}
+	body, err := j.m.get(ctx, j.api+"/assets/latest/"+feature+"/hotspot?"+q.Encode())
+	if err != nil {
+		return version{}, artifact{}, err
+	}
+	defer body.Close()
+	var assets []struct {
+		Binary struct {
+			Package struct {
+				Checksum string `json:"checksum"`
+				Link     string `json:"link"`
+			} `json:"package"`
+		} `json:"binary"`
+		Version struct {
+			Major    int `json:"major"`
+			Minor    int `json:"minor"`
+			Security int `json:"security"`
+		} `json:"version"`
+	}
+	if err := json.NewDecoder(body).Decode(&assets); err != nil {
+		return version{}, artifact{}, fmt.Errorf("decode adoptium assets: %w", err)
+	}
+	for _, a := range assets {
+		v := version{a.Version.Major, a.Version.Minor, a.Version.Security}
+		if !strings.HasSuffix(a.Binary.Package.Link, ".tar.gz") {
+			continue
+		}
+		if !r.match(v) {
+			return version{}, artifact{}, fmt.Errorf("jdk %s is not available: the latest %s release is %s", spec, feature, v)
+		}
+		return v, artifact{url: a.Binary.Package.Link, newHash: sha256.New, sum: a.Binary.Package.Checksum, strip: true}, nil
+	}
+	return version{}, artifact{}, fmt.Errorf("no jdk %s release for %s/%s", feature, runtime.GOOS, arch)
+}
+
+func (*java) layout(home string) (string, []string) {
+	return filepath.Join(home, "bin"), []string{"JAVA_HOME=" + home}
+}
+
+// keyValues reads the key=value lines of path, skipping comments. A
+// missing file has none.
+func keyValues(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	kv := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if k, v, ok := strings.Cut(line, "="); ok {
+			kv[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return kv, nil
+}
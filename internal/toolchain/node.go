@@ -0,0 +1,197 @@
+package toolchain
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// node provisions Node.js from nodejs.org/dist or a mirror of it.
+type node struct {
+	m    *Manager
+	dist string
+}
+
+func (*node) name() string { return "node" }
+
+// nodeVersionFiles are the files naming a Node.js version on their first
+// line, in precedence order.
+var nodeVersionFiles = []string{".nvmrc", ".node-version"}
+
+// detect prefers a .nvmrc or .node-version over package.json; within
+// package.json the Volta pin wins over engines.node.
+func (*node) detect(repoDir string) (string, string, error) {
+	for _, name := range nodeVersionFiles {
+		spec, err := firstLine(filepath.Join(repoDir, name))
+		if err != nil {
+			return "", "", err
+		}
+		if spec != "" {
+			return spec, name, nil
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(repoDir, "package.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	var pkg struct {
+		Volta struct {
+			Node string `json:"node"`
+		} `json:"volta"`
+		Engines struct {
+			Node string `json:"node"`
+		} `json:"engines"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return "", "", fmt.Errorf("parse package.json: %w", err)
+	}
+	if s := strings.TrimSpace(pkg.Volta.Node); s != "" {
+		return s, "package.json volta", nil
+	}
+	if s := strings.TrimSpace(pkg.Engines.Node); s != "" {
+		return s, "package.json engines", nil
+	}
+	return "", "", nil
+}
+
+// constraint accepts node-semver ranges and the nvm aliases "node",
+// "stable", "latest", "lts/*" and "lts/<codename>".
+func (*node) constraint(spec string) (versionRange, error) {
+	if isNodeAlias(spec) {
+		return nil, nil
+	}
+	return parseRange(spec)
+}
+
+func isNodeAlias(spec string) bool {
+	switch spec = strings.ToLower(spec); spec {
+	case "node", "stable", "latest", "current":
+		return true
+	}
+	return strings.HasPrefix(spec, "lts/")
+}
+
+// resolve picks the highest release matching spec from the dist index.
+func (n *node) resolve(ctx context.Context, spec string, r versionRange) (version, artifact, error) {
+	body, err := n.m.get(ctx, n.dist+"/index.json")
+	if err != nil {
+		return version{}, artifact{}, err
+	}
+	defer body.Close()
+	var releases []struct {
+		Version string `json:"version"`
+		LTS     any    `json:"lts"` // false, or the LTS codename
+	}
+	if err := json.NewDecoder(body).Decode(&releases); err != nil {
+		return version{}, artifact{}, fmt.Errorf("decode node index: %w", err)
+	}
+
+	lower := strings.ToLower(spec)
+	var best version
+	found := false
+	for _, rel := range releases {
+		v, ok := parseVersion(rel.Version)
+		if !ok {
+			continue
+		}
+		codename, _ := rel.LTS.(string)
+		switch {
+		case lower == "lts/*":
+			ok = codename != ""
+		case strings.HasPrefix(lower, "lts/"):
+			ok = strings.EqualFold(codename, strings.TrimPrefix(lower, "lts/"))
+		case r == nil:
+			ok = true
+		default:
+			ok = r.match(v)
+		}
+		if ok && (!found || v.compare(best) > 0) {
+			best, found = v, true
+		}
+	}
+	if !found {
+		return version{}, artifact{}, fmt.Errorf("no node release matches %q", spec)
+	}
+
+	name, err := nodeArchive(best)
+	if err != nil {
+		return version{}, artifact{}, err
+	}
+	dir := n.dist + "/v" + best.String() + "/"
+	sum, err := n.checksum(ctx, dir+"SHASUMS256.txt", name)
+	if err != nil {
+		return version{}, artifact{}, err
+	}
+	return best, artifact{url: dir + name, newHash: sha256.New, sum: sum, strip: true}, nil
+}
+
+// nodeArchive is the dist archive of v for this platform.
+func nodeArchive(v version) (string, error) {
+	var arch string
+	switch runtime.GOARCH {
+	case "amd64":
+		arch = "x64"
+	case "arm64":
+		arch = "arm64"
+	default:
+		return "", fmt.Errorf("no node release for %s", runtime.GOARCH)
+	}
+	return fmt.Sprintf("node-v%s-%s-%s.tar.gz", v, runtime.GOOS, arch), nil
+}
+
+// checksum returns the digest published for name in a SHASUMS file.
+func (n *node) checksum(ctx context.Context, url, name string) (string, error) {
+	body, err := n.m.get(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	sc := bufio.NewScanner(body)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && fields[1] == name {
+			return fields[0], nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", fmt.Errorf("read checksums: %w", err)
+	}
+	return "", fmt.Errorf("no checksum published for %s", name)
+}
+
+func (*node) layout(home string) (string, []string) {
+	return filepath.Join(home, "bin"), nil
+}
+
+// firstLine returns the first line of path that is neither blank nor a
+// comment, or "" when the file does not exist.
+func firstLine(path string) (string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			return line, nil
+		}
+	}
+	return "", sc.Err()
+}
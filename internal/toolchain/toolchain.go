@@ -0,0 +1,415 @@
+// Package toolchain provisions the language runtimes a repository asks for
+// — Node.js, Go, a JDK and the .NET SDK — so its workspace is bootstrapped
+// and built with the versions it was developed against rather than
+// whichever ones the worker image ships.
+package toolchain
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/httpclient"
+	"go.uber.org/fx"
+)
+
+// downloadTimeout bounds fetching one runtime archive.
+const downloadTimeout = 10 * time.Minute
+
+// provenanceFile records, in an installed runtime, the archive it was
+// installed from.
+const provenanceFile = ".provenance.json"
+
+// How an archive's digest was verified.
+const (
+	VerifiedPinned    = "pinned"    // against toolchain.checksums
+	VerifiedPublished = "published" // against the release index only
+)
+
+// Provenance is the archive a runtime was installed from.
+type Provenance struct {
+	URL      string `json:"url"`
+	SHA256   string `json:"sha256"`
+	Verified string `json:"verified"`
+}
+
+// Runtime is a provisioned toolchain version.
+type Runtime struct {
+	Tool    string // node, go, java or dotnet
+	Version string
+	Spec    string // the version spec it was selected by
+	Source  string // the file declaring Spec
+	// Bin is put first on the PATH, and Env added to the environment, of
+	// commands using the runtime.
+	Bin string
+	Env []string
+	// Provenance is nil for runtimes installed before it was recorded.
+	Provenance *Provenance
+}
+
+// tool provisions one kind of runtime.
+type tool interface {
+	name() string
+	// detect returns the version spec declared by the repository in
+	// repoDir and the file it came from, or "" when it declares none.
+	detect(repoDir string) (spec, source string, err error)
+	// constraint returns the versions spec accepts, or nil when only the
+	// release index can resolve it, such as for an alias.
+	constraint(spec string) (versionRange, error)
+	// resolve returns the newest release accepted by spec and r.
+	resolve(ctx context.Context, spec string, r versionRange) (version, artifact, error)
+	// layout returns the bin directory and environment of an installed
+	// runtime rooted at home.
+	layout(home string) (bin string, env []string)
+}
+
+// artifact is a runtime archive to download.
+type artifact struct {
+	url     string
+	newHash func() hash.Hash
+	sum     string // hex digest published for url
+	// strip drops the archive's single top-level directory.
+	strip bool
+}
+
+// Manager installs runtimes into the managed toolchain directories and
+// resolves version specs against them. It is safe for concurrent use.
+type Manager struct {
+	tools  []tool
+	dirs   map[string]string // tool name to install directory
+	client *http.Client
+	// pinned maps archive file names to their SHA-256 digest.
+	pinned        map[string]string
+	requirePinned bool
+
+	mu sync.Mutex // serializes installs
+}
+
+// NewManager creates a Manager for the tools enabled by cfg.Node and
+// cfg.Toolchain.
+func NewManager(cfg *config.Config, client *http.Client) *Manager {
+	m := &Manager{
+		dirs:          map[string]string{},
+		client:        httpclient.WithTimeout(client, downloadTimeout),
+		pinned:        map[string]string{},
+		requirePinned: cfg.Toolchain.RequirePinned,
+	}
+	for _, pin := range cfg.Toolchain.Checksums {
+		m.pinned[pin.File] = strings.ToLower(pin.SHA256)
+	}
+	if cfg.Node.Enabled {
+		m.add(&node{m: m, dist: strings.TrimSuffix(cfg.Node.DistURL, "/")}, cfg.Node.ToolchainDir)
+	}
+	if tc := cfg.Toolchain; tc.Enabled {
+		m.add(&golang{m: m, dist: strings.TrimSuffix(tc.GoDistURL, "/")}, filepath.Join(tc.Dir, "go"))
+		m.add(&java{m: m, api: strings.TrimSuffix(tc.JavaAPIURL, "/")}, filepath.Join(tc.Dir, "java"))
+		m.add(&dotnet{m: m, feed: strings.TrimSuffix(tc.DotnetFeedURL, "/")}, filepath.Join(tc.Dir, "dotnet"))
+	}
+	return m
+}
+
+func (m *Manager) add(t tool, dir string) {
+	m.tools = append(m.tools, t)
+	m.dirs[t.name()] = dir
+}
+
+// Provision installs every runtime the repository in repoDir declares and
+// returns them. Tools the repository declares no version of are left to
+// the worker image.
+func (m *Manager) Provision(ctx context.Context, repoDir string) ([]Runtime, error) {
+	var runtimes []Runtime
+	for _, t := range m.tools {
+		spec, source, err := t.detect(repoDir)
+		if err != nil {
+			return nil, fmt.Errorf("detect %s version: %w", t.name(), err)
+		}
+		if spec == "" {
+			continue
+		}
+		rt, err := m.ensure(ctx, t, spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s from %s: %w", t.name(), spec, source, err)
+		}
+		rt.Source = source
+		runtimes = append(runtimes, rt)
+	}
+	return runtimes, nil
+}
+
+// Ensure returns the runtime of tool selected by spec, installing it when
+// no installed version matches.
+func (m *Manager) Ensure(ctx context.Context, name, spec string) (Runtime, error) {
+	for _, t := range m.tools {
+		if t.name() == name {
+			return m.ensure(ctx, t, strings.TrimSpace(spec))
+		}
+	}
+	return Runtime{}, fmt.Errorf("toolchain %s is not enabled", name)
+}
+
+func (m *Manager) ensure(ctx context.Context, t tool, spec string) (Runtime, error) {
+	r, err := t.constraint(spec)
+	if err != nil {
+		return Runtime{}, err
+	}
+	v, ok := m.installed(t, r)
+	if !ok {
+		var a artifact
+		if v, a, err = t.resolve(ctx, spec, r); err != nil {
+			return Runtime{}, err
+		}
+		if err := m.install(ctx, t, v, a); err != nil {
+			return Runtime{}, err
+		}
+	}
+	home := m.home(t, v)
+	bin, env := t.layout(home)
+	return Runtime{Tool: t.name(), Version: v.String(), Spec: spec, Bin: bin, Env: env, Provenance: readProvenance(home)}, nil
+}
+
+func (m *Manager) home(t tool, v version) string {
+	return filepath.Join(m.dirs[t.name()], "v"+v.String())
+}
+
+// installed returns the highest trusted installed version matching r.
+// Aliases (a nil r) are never resolved offline.
+func (m *Manager) installed(t tool, r versionRange) (version, bool) {
+	if r == nil {
+		return version{}, false
+	}
+	entries, err := os.ReadDir(m.dirs[t.name()])
+	if err != nil {
+		return version{}, false
+	}
+	var best version
+	found := false
+	for _, e := range entries {
+		v, ok := parseVersion(e.Name())
+		if !ok || !e.IsDir() || !r.match(v) || !m.trusted(m.home(t, v)) {
+			continue
+		}
+		if !found || v.compare(best) > 0 {
+			best, found = v, true
+		}
+	}
+	return best, found
+}
+
+// trusted reports whether the runtime installed at home may be used: with
+// toolchain.require_pinned, only one whose archive matched the digest
+// pinned for it now.
+func (m *Manager) trusted(home string) bool {
+	if !m.requirePinned {
+		return true
+	}
+	p := readProvenance(home)
+	return p != nil && p.Verified == VerifiedPinned && m.pinned[archiveName(p.URL)] == p.SHA256
+}
+
+// install downloads, verifies and unpacks version v unless a trusted
+// install of it exists; an untrusted one is replaced. The runtime appears
+// in the toolchain directory atomically.
+//
+// The archive must match the digest published for it and the one pinned
+// in toolchain.checksums, if any. An archive with neither, or with no pin
+// under toolchain.require_pinned, is refused.
+func (m *Manager) install(ctx context.Context, t tool, v version, a artifact) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir, dest := m.dirs[t.name()], m.home(t, v)
+	if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		if m.trusted(dest) {
+			return nil
+		}
+		if err := os.RemoveAll(dest); err != nil {
+			return fmt.Errorf("remove unverified %s %s: %w", t.name(), v, err)
+		}
+	}
+	pinned, ok := m.pinned[archiveName(a.url)]
+	switch {
+	case !ok && m.requirePinned:
+		return fmt.Errorf("%s: no checksum pinned for %s in toolchain.checksums", a.url, archiveName(a.url))
+	case !ok && a.sum == "":
+		return fmt.Errorf("%s: no checksum published", a.url)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create toolchain dir: %w", err)
+	}
+
+	archive, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		return fmt.Errorf("create download file: %w", err)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	body, err := m.get(ctx, a.url)
+	if err != nil {
+		return err
+	}
+	h, s256 := a.newHash(), sha256.New()
+	_, err = io.Copy(io.MultiWriter(archive, h, s256), body)
+	body.Close()
+	if err != nil {
+		return fmt.Errorf("download %s: %w", a.url, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); a.sum != "" && got != strings.ToLower(a.sum) {
+		return fmt.Errorf("%s: checksum mismatch: got %s, want %s", a.url, got, a.sum)
+	}
+	prov := Provenance{URL: a.url, SHA256: hex.EncodeToString(s256.Sum(nil)), Verified: VerifiedPublished}
+	if ok {
+		if prov.SHA256 != pinned {
+			return fmt.Errorf("%s: checksum mismatch: got sha256 %s, pinned %s", a.url, prov.SHA256, pinned)
+		}
+		prov.Verified = VerifiedPinned
+	}
+
+	tmp, err := os.MkdirTemp(dir, ".install-*")
+	if err != nil {
+		return fmt.Errorf("create install dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := extract(archive, tmp, a.strip); err != nil {
+		return fmt.Errorf("extract %s: %w", a.url, err)
+	}
+	data, _ := json.Marshal(prov)
+	if err := os.WriteFile(filepath.Join(tmp, provenanceFile), data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return fmt.Errorf("install %s %s: %w", t.name(), v, err)
+	}
+	return nil
+}
+
+// readProvenance returns the provenance recorded in the runtime installed
+// at home, or nil.
+func readProvenance(home string) *Provenance {
+	data, err := os.ReadFile(filepath.Join(home, provenanceFile))
+	if err != nil {
+		return nil
+	}
+	var p Provenance
+	if json.Unmarshal(data, &p) != nil {
+		return nil
+	}
+	return &p
+}
+
+// archiveName returns the file name of an archive URL, which pins are
+// keyed by.
+func archiveName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return path.Base(u.Path)
+	}
+	return path.Base(rawURL)
+}
+
+// get fetches url, failing on any status but 200 OK.
+func (m *Manager) get(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// extract unpacks a gzipped tarball into dir, dropping its top-level
+// directory when strip is set. Entries and symlinks that would escape dir
+// are rejected.
+func extract(r io.Reader, dir string, strip bool) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(hdr.Name, "./")
+		if strip {
+			_, rel, _ = strings.Cut(rel, "/")
+		}
+		if rel = strings.TrimSuffix(rel, "/"); rel == "" || rel == "." {
+			continue
+		}
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("unsafe path %q", hdr.Name)
+		}
+		target := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, tr, fs.FileMode(hdr.Mode).Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(hdr.Linkname) || !filepath.IsLocal(filepath.Join(filepath.Dir(rel), hdr.Linkname)) {
+				return fmt.Errorf("unsafe symlink %q -> %q", hdr.Name, hdr.Linkname)
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader, perm fs.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Module provides the toolchain Manager via fx.
+var Module = fx.Module("toolchain",
+	fx.Provide(NewManager),
+)
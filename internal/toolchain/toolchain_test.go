@@ -0,0 +1,351 @@
+package toolchain
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name       string
+		tool       tool
+		files      map[string]string
+		wantSpec   string
+		wantSource string
+	}{
+		{"node none", &node{}, nil, "", ""},
+		{
+			"node nvmrc wins", &node{},
+			map[string]string{".nvmrc": "# team default\n\nlts/iron\n", "package.json": `{"engines":{"node":">=18"}}`},
+			"lts/iron", ".nvmrc",
+		},
+		{"node-version", &node{}, map[string]string{".node-version": "v20.11.1\n"}, "v20.11.1", ".node-version"},
+		{
+			"node volta over engines", &node{},
+			map[string]string{"package.json": `{"volta":{"node":"20.11.1"},"engines":{"node":"^18"}}`},
+			"20.11.1", "package.json volta",
+		},
+		{"node engines", &node{}, map[string]string{"package.json": `{"engines":{"node":">=18 <21"}}`}, ">=18 <21", "package.json engines"},
+		{"go directive", &golang{}, map[string]string{"go.mod": "module x\n\ngo 1.22\n"}, "1.22", "go.mod"},
+		{
+			"go toolchain", &golang{},
+			map[string]string{"go.mod": "module x\n\ngo 1.22\ntoolchain go1.22.5\n"},
+			"=1.22.5", "go.mod toolchain",
+		},
+		{
+			"go work wins", &golang{},
+			map[string]string{"go.work": "go 1.23.1\n\nuse ./apps/api\n", "go.mod": "module x\n\ngo 1.22\n"},
+			"1.23.1", "go.work",
+		},
+		{"java-version", &java{}, map[string]string{".java-version": "17\n"}, "17", ".java-version"},
+		{"sdkmanrc", &java{}, map[string]string{".sdkmanrc": "# sdk env\njava=21.0.2-tem\n"}, "21.0.2", ".sdkmanrc"},
+		{"global.json patch", &dotnet{}, map[string]string{"global.json": `{"sdk":{"version":"8.0.100"}}`}, ">=8.0.100 <8.0.200", "global.json"},
+		{
+			"global.json latestFeature", &dotnet{},
+			map[string]string{"global.json": `{"sdk":{"version":"8.0.204","rollForward":"latestFeature"}}`},
+			">=8.0.204 <8.1.0", "global.json",
+		},
+		{
+			"global.json disable", &dotnet{},
+			map[string]string{"global.json": `{"sdk":{"version":"8.0.204","rollForward":"disable"}}`},
+			"8.0.204", "global.json",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tc.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			spec, source, err := tc.tool.detect(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spec != tc.wantSpec || source != tc.wantSource {
+				t.Errorf("detect = %q, %q; want %q, %q", spec, source, tc.wantSpec, tc.wantSource)
+			}
+		})
+	}
+}
+
+// testArchive returns a gzipped tarball holding an executable at bin, under
+// top unless top is "", plus a symlink to it named link.
+func testArchive(t *testing.T, top, bin, link string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	script := "#!/bin/sh\necho " + bin + "\n"
+	headers := []*tar.Header{
+		{Name: top + bin, Typeflag: tar.TypeReg, Mode: 0o755, Size: int64(len(script))},
+		{Name: top + link, Typeflag: tar.TypeSymlink, Linkname: filepath.Base(bin)},
+	}
+	if top != "" {
+		headers = append([]*tar.Header{{Name: top, Typeflag: tar.TypeDir, Mode: 0o755}}, headers...)
+	}
+	for _, h := range headers {
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			tw.Write([]byte(script))
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// distServer fakes the release feeds of every tool. corrupt breaks the
+// published node checksum.
+type distServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	downloads []string
+	// nodeName and nodeSum are the node archive's file name and SHA-256.
+	nodeName, nodeSum string
+}
+
+func newDistServer(t *testing.T, corrupt bool) *distServer {
+	t.Helper()
+	arch := map[string]string{"amd64": "x64", "arm64": "arm64"}[runtime.GOARCH]
+	if arch == "" {
+		t.Skipf("no releases for %s", runtime.GOARCH)
+	}
+	node := testArchive(t, "node-v20.11.1/", "bin/node", "bin/npm")
+	nodeSum := sha256.Sum256(node)
+	if corrupt {
+		nodeSum[0] ^= 0xff
+	}
+	goArchive := testArchive(t, "go/", "bin/go", "bin/gofmt")
+	goSum := sha256.Sum256(goArchive)
+	jdk := testArchive(t, "jdk-21.0.2+13/", "bin/java", "bin/javac")
+	jdkSum := sha256.Sum256(jdk)
+	sdk := testArchive(t, "", "dotnet", "dotnet-link")
+	sdkSum := sha512.Sum512(sdk)
+	nodeName := fmt.Sprintf("node-v20.11.1-%s-%s.tar.gz", runtime.GOOS, arch)
+	goName := fmt.Sprintf("go1.22.5.%s-%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+
+	s := &distServer{nodeName: nodeName, nodeSum: hex.EncodeToString(nodeSum[:])}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		archives := map[string][]byte{
+			"/node/v20.11.1/" + nodeName: node,
+			"/go/" + goName:              goArchive,
+			"/java/jdk21.tar.gz":         jdk,
+			"/dotnet/sdk-8.0.105.tar.gz": sdk,
+			"/dotnet/sdk-8.0.204.tar.gz": sdk,
+		}
+		if data, ok := archives[r.URL.Path]; ok {
+			s.mu.Lock()
+			s.downloads = append(s.downloads, r.URL.Path)
+			s.mu.Unlock()
+			w.Write(data)
+			return
+		}
+		switch r.URL.Path {
+		case "/node/index.json":
+			fmt.Fprint(w, `[
+				{"version":"v21.6.0","lts":false},
+				{"version":"v20.11.1","lts":"Iron"},
+				{"version":"v20.10.0","lts":"Iron"},
+				{"version":"v18.19.0","lts":"Hydrogen"}
+			]`)
+		case "/node/v20.11.1/SHASUMS256.txt":
+			fmt.Fprintf(w, "%s  %s\n", hex.EncodeToString(nodeSum[:]), nodeName)
+		case "/go/":
+			if r.URL.Query().Get("mode") != "json" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprintf(w, `[
+				{"version":"go1.23rc1","stable":false,"files":[]},
+				{"version":"go1.22.5","stable":true,"files":[
+					{"filename":"go1.22.5.src.tar.gz","os":"","arch":"","kind":"source","sha256":"x"},
+					{"filename":%q,"os":%q,"arch":%q,"kind":"archive","sha256":%q}
+				]},
+				{"version":"go1.21.9","stable":true,"files":[]}
+			]`, goName, runtime.GOOS, runtime.GOARCH, hex.EncodeToString(goSum[:]))
+		case "/java/assets/latest/21/hotspot":
+			fmt.Fprintf(w, `[{"binary":{"package":{"checksum":%q,"link":%q}},"version":{"major":21,"minor":0,"security":2}}]`,
+				hex.EncodeToString(jdkSum[:]), s.URL+"/java/jdk21.tar.gz")
+		case "/dotnet/release-metadata/8.0/releases.json":
+			rid := runtime.GOOS + "-" + arch
+			sdkFiles := func(v string) string {
+				return fmt.Sprintf(`{"version":%q,"files":[{"name":"dotnet-sdk-%s.tar.gz","rid":%q,"url":%q,"hash":%q}]}`,
+					v, rid, rid, s.URL+"/dotnet/sdk-"+v+".tar.gz", hex.EncodeToString(sdkSum[:]))
+			}
+			fmt.Fprintf(w, `{"releases":[{"sdks":[%s]},{"sdks":[%s,%s]}]}`,
+				sdkFiles("8.0.204"), sdkFiles("8.0.105"), sdkFiles("8.0.100"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testManager(s *distServer, dir string) *Manager {
+	return NewManager(&config.Config{
+		Node: config.NodeConfig{Enabled: true, ToolchainDir: filepath.Join(dir, "node"), DistURL: s.URL + "/node/"},
+		Toolchain: config.ToolchainConfig{
+			Enabled:       true,
+			Dir:           dir,
+			GoDistURL:     s.URL + "/go",
+			JavaAPIURL:    s.URL + "/java",
+			DotnetFeedURL: s.URL + "/dotnet",
+		},
+	}, s.Client())
+}
+
+func TestProvision(t *testing.T) {
+	s := newDistServer(t, false)
+	dir := t.TempDir()
+	m := testManager(s, dir)
+
+	repo := t.TempDir()
+	for name, data := range map[string]string{
+		".nvmrc":        "lts/iron\n",
+		"go.mod":        "module x\n\ngo 1.22\n",
+		".java-version": "21\n",
+		"global.json":   `{"sdk":{"version":"8.0.100"}}`,
+	} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []Runtime{
+		{Tool: "node", Version: "20.11.1", Spec: "lts/iron", Source: ".nvmrc", Bin: filepath.Join(dir, "node", "v20.11.1", "bin")},
+		{
+			Tool: "go", Version: "1.22.5", Spec: "1.22", Source: "go.mod", Bin: filepath.Join(dir, "go", "v1.22.5", "bin"),
+			Env: []string{"GOROOT=" + filepath.Join(dir, "go", "v1.22.5"), "GOTOOLCHAIN=local"},
+		},
+		{
+			Tool: "java", Version: "21.0.2", Spec: "21", Source: ".java-version", Bin: filepath.Join(dir, "java", "v21.0.2", "bin"),
+			Env: []string{"JAVA_HOME=" + filepath.Join(dir, "java", "v21.0.2")},
+		},
+		{
+			Tool: "dotnet", Version: "8.0.105", Spec: ">=8.0.100 <8.0.200", Source: "global.json", Bin: filepath.Join(dir, "dotnet", "v8.0.105"),
+			Env: []string{"DOTNET_ROOT=" + filepath.Join(dir, "dotnet", "v8.0.105")},
+		},
+	}
+	for range 2 {
+		got, err := m.Provision(context.Background(), repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("Provision = %+v, want %+v", got, want)
+		}
+		for i := range want {
+			if g, w := got[i], want[i]; g.Tool != w.Tool || g.Version != w.Version || g.Spec != w.Spec ||
+				g.Source != w.Source || g.Bin != w.Bin || !slices.Equal(g.Env, w.Env) {
+				t.Errorf("runtime %d = %+v, want %+v", i, g, w)
+			}
+		}
+	}
+	if len(s.downloads) != 4 {
+		t.Errorf("downloads = %v, want one per tool", s.downloads)
+	}
+
+	for _, exe := range []string{"node/v20.11.1/bin/npm", "go/v1.22.5/bin/go", "java/v21.0.2/bin/javac", "dotnet/v8.0.105/dotnet"} {
+		if out, err := os.ReadFile(filepath.Join(dir, exe)); err != nil || !strings.HasPrefix(string(out), "#!/bin/sh") {
+			t.Errorf("%s = %q, %v", exe, out, err)
+		}
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	s := newDistServer(t, false)
+	m := testManager(s, t.TempDir())
+	ctx := context.Background()
+
+	for _, spec := range []string{"^20.10", "20.11.1"} {
+		if rt, err := m.Ensure(ctx, "node", spec); err != nil || rt.Version != "20.11.1" {
+			t.Errorf("Ensure(node, %q) = %+v, %v", spec, rt, err)
+		}
+	}
+	if rt, err := m.Ensure(ctx, "go", "=1.22.5"); err != nil || rt.Version != "1.22.5" {
+		t.Errorf("Ensure(go, =1.22.5) = %+v, %v", rt, err)
+	}
+	if _, err := m.Ensure(ctx, "node", "^22"); err == nil {
+		t.Error("Ensure(node, ^22) succeeded without a matching release")
+	}
+	if _, err := m.Ensure(ctx, "java", "21.0.1"); err == nil || !strings.Contains(err.Error(), "latest 21 release is 21.0.2") {
+		t.Errorf("Ensure(java, 21.0.1) = %v, want unavailable", err)
+	}
+	if _, err := m.Ensure(ctx, "ruby", "3"); err == nil {
+		t.Error("Ensure(ruby) succeeded")
+	}
+}
+
+func TestEnsureRejectsChecksumMismatch(t *testing.T) {
+	s := newDistServer(t, true)
+	dir := t.TempDir()
+	m := testManager(s, dir)
+	if _, err := m.Ensure(context.Background(), "node", "20"); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Ensure = %v, want checksum mismatch", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "node")); len(entries) != 0 {
+		t.Errorf("toolchain dir not cleaned up: %v", entries)
+	}
+}
+
+func TestEnsurePinnedChecksums(t *testing.T) {
+	s := newDistServer(t, false)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// Installed against the published digest only.
+	m := testManager(s, dir)
+	rt, err := m.Ensure(ctx, "node", "20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := rt.Provenance; p == nil || p.Verified != VerifiedPublished || p.SHA256 != s.nodeSum || !strings.HasSuffix(p.URL, s.nodeName) {
+		t.Fatalf("provenance = %+v", rt.Provenance)
+	}
+
+	m.requirePinned = true
+	if _, err := m.Ensure(ctx, "go", "1.22"); err == nil || !strings.Contains(err.Error(), "no checksum pinned") {
+		t.Errorf("Ensure(go) = %v, want refused without a pin", err)
+	}
+	m.pinned[s.nodeName] = strings.Repeat("0", 64)
+	if _, err := m.Ensure(ctx, "node", "20"); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Ensure(node) = %v, want pin mismatch", err)
+	}
+
+	// The published-only install is replaced by a pinned one.
+	m.pinned[s.nodeName] = s.nodeSum
+	for range 2 {
+		rt, err = m.Ensure(ctx, "node", "20")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := rt.Provenance; p == nil || p.Verified != VerifiedPinned || p.SHA256 != s.nodeSum {
+			t.Errorf("provenance = %+v, want pinned", rt.Provenance)
+		}
+	}
+	if n := len(s.downloads); n != 3 {
+		t.Errorf("downloads = %v, want the node archive fetched three times", s.downloads)
+	}
+}
@@ -0,0 +1,232 @@
+package toolchain
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// version is a release version, major.minor.patch.
+type version [3]int
+
+// parseVersion parses an exact version such as "20.11.1" or "v20.11.1".
+func parseVersion(s string) (version, bool) {
+	v, n, err := parsePartial(s)
+	return v, err == nil && n == 3
+}
+
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+func (v version) compare(w version) int {
+	for i := range v {
+		if c := cmp.Compare(v[i], w[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// bump returns the lowest version above every version matching the first n
+// parts of v: bump(20.11.x, 2) is 20.12.0.
+func (v version) bump(n int) version {
+	var out version
+	copy(out[:n], v[:n])
+	out[n-1]++
+	return out
+}
+
+// parsePartial parses a possibly partial version such as "20", "20.11" or
+// "20.x", returning how many leading parts were given. Missing parts are 0.
+func parsePartial(s string) (version, int, error) {
+	var v version
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "="), "v")
+	if s == "" {
+		return v, 0, fmt.Errorf("empty version")
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, 0, fmt.Errorf("invalid version %q", s)
+	}
+	n := 0
+	for _, p := range parts {
+		if p == "x" || p == "X" || p == "*" {
+			break
+		}
+		i, err := strconv.Atoi(p)
+		if err != nil || i < 0 {
+			return v, 0, fmt.Errorf("invalid version %q", s)
+		}
+		v[n] = i
+		n++
+	}
+	return v, n, nil
+}
+
+// comparator is one bound of a range, such as ">=20.0.0".
+type comparator struct {
+	op string // "=", ">", ">=", "<" or "<="
+	v  version
+}
+
+func (c comparator) match(v version) bool {
+	d := v.compare(c.v)
+	switch c.op {
+	case ">":
+		return d > 0
+	case ">=":
+		return d >= 0
+	case "<":
+		return d < 0
+	case "<=":
+		return d <= 0
+	}
+	return d == 0
+}
+
+// versionRange is a node-semver range: a version matches when it satisfies
+// every comparator of any one set.
+type versionRange [][]comparator
+
+// parseRange parses the node-semver subset found in .nvmrc and engines
+// fields: exact and partial versions, x-ranges, ^ and ~, the comparison
+// operators, hyphen ranges, and sets joined by "||".
+func parseRange(s string) (versionRange, error) {
+	var r versionRange
+	for _, set := range strings.Split(s, "||") {
+		cs, err := parseSet(strings.Fields(set))
+		if err != nil {
+			return nil, fmt.Errorf("node version %q: %w", s, err)
+		}
+		r = append(r, cs)
+	}
+	return r, nil
+}
+
+func parseSet(fields []string) ([]comparator, error) {
+	if len(fields) == 3 && fields[1] == "-" {
+		lo, n, err := parsePartial(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		cs := []comparator{{">=", lo}}
+		if n == 0 {
+			cs = nil
+		}
+		hi, n, err := parsePartial(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case n == 3:
+			cs = append(cs, comparator{"<=", hi})
+		case n > 0:
+			cs = append(cs, comparator{"<", hi.bump(n)})
+		}
+		return cs, nil
+	}
+
+	var cs []comparator
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		op := leadingOp(f)
+		if op == f {
+			// An operator separated from its version: ">= 20".
+			if i+1 == len(fields) {
+				return nil, fmt.Errorf("operator %q without version", op)
+			}
+			i++
+			f += fields[i]
+		}
+		expanded, err := expand(op, f[len(op):])
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, expanded...)
+	}
+	return cs, nil
+}
+
+func leadingOp(s string) string {
+	for _, op := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// expand turns one operator and partial version into comparators.
+func expand(op, s string) ([]comparator, error) {
+	if s == "*" || s == "x" || s == "X" {
+		s = ""
+	}
+	var (
+		v   version
+		n   int
+		err error
+	)
+	if s != "" {
+		if v, n, err = parsePartial(s); err != nil {
+			return nil, err
+		}
+	}
+	if n == 0 {
+		switch op {
+		case ">", "<":
+			// Nothing is above or below every version.
+			return []comparator{{"<", version{}}}, nil
+		}
+		return nil, nil
+	}
+
+	switch op {
+	case "", "=":
+		if n == 3 {
+			return []comparator{{"=", v}}, nil
+		}
+		return []comparator{{">=", v}, {"<", v.bump(n)}}, nil
+	case "^":
+		// Allow changes that leave the first non-zero part alone.
+		keep := 1
+		for keep < n && v[keep-1] == 0 {
+			keep++
+		}
+		return []comparator{{">=", v}, {"<", v.bump(keep)}}, nil
+	case "~":
+		return []comparator{{">=", v}, {"<", v.bump(min(n, 2))}}, nil
+	case ">=":
+		return []comparator{{">=", v}}, nil
+	case "<":
+		return []comparator{{"<", v}}, nil
+	case ">":
+		if n == 3 {
+			return []comparator{{">", v}}, nil
+		}
+		return []comparator{{">=", v.bump(n)}}, nil
+	case "<=":
+		if n == 3 {
+			return []comparator{{"<=", v}}, nil
+		}
+		return []comparator{{"<", v.bump(n)}}, nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", op)
+}
+
+func (r versionRange) match(v version) bool {
+	for _, set := range r {
+		ok := true
+		for _, c := range set {
+			if !c.match(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package toolchain
+
+import "testing"
+
+func TestRangeMatch(t *testing.T) {
+	tests := []struct {
+		spec    string
+		match   []string
+		noMatch []string
+	}{
+		{"20.11.1", []string{"20.11.1"}, []string{"20.11.0", "20.12.0"}},
+		{"v20", []string{"20.0.0", "20.19.5"}, []string{"19.9.0", "21.0.0"}},
+		{"20.x", []string{"20.3.1"}, []string{"21.0.0"}},
+		{"^18.17.0", []string{"18.17.0", "18.20.4"}, []string{"18.16.9", "19.0.0"}},
+		{"^0.10.2", []string{"0.10.48"}, []string{"0.11.0"}},
+		{"~18.17", []string{"18.17.1"}, []string{"18.18.0"}},
+		{">= 18 <21", []string{"18.0.0", "20.19.5"}, []string{"17.9.1", "21.0.0"}},
+		{">18", []string{"19.0.0"}, []string{"18.20.4"}},
+		{"<=20.1", []string{"20.1.9"}, []string{"20.2.0"}},
+		{"18 - 20", []string{"18.0.0", "20.19.5"}, []string{"21.0.0"}},
+		{"^16 || ^20", []string{"16.20.2", "20.0.0"}, []string{"18.0.0"}},
+		{"*", []string{"22.1.0"}, nil},
+	}
+	for _, tc := range tests {
+		r, err := parseRange(tc.spec)
+		if err != nil {
+			t.Fatalf("parseRange(%q): %v", tc.spec, err)
+		}
+		for _, s := range tc.match {
+			if v, _ := parseVersion(s); !r.match(v) {
+				t.Errorf("%q does not match %s", tc.spec, s)
+			}
+		}
+		for _, s := range tc.noMatch {
+			if v, _ := parseVersion(s); r.match(v) {
+				t.Errorf("%q matches %s", tc.spec, s)
+			}
+		}
+	}
+
+	for _, bad := range []string{"20.a", ">=", "1.2.3.4"} {
+		if _, err := parseRange(bad); err == nil {
+			t.Errorf("parseRange(%q) succeeded", bad)
+		}
+	}
+}
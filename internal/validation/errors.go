@@ -0,0 +1,39 @@
+// Package validation collects field-level validation errors so callers can
+// report every problem with an input at once, by field name.
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError describes one invalid field. Field uses the input's external
+// naming (JSON or config key), e.g. "sha" or "worker.concurrency".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is a list of field errors. It implements error.
+type Errors []FieldError
+
+// Add records an error for field.
+func (e *Errors) Add(field, format string, args ...any) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns e as an error, or nil when there are no errors.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, f := range e {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return "invalid " + strings.Join(parts, "; ")
+}
@@ -0,0 +1,215 @@
+// Package warmimages keeps the base images the worker's builds use most
+// pulled in its buildah storage, so image builds start without a cold pull.
+// Images are pulled again when their registry digest changes, and the warm
+// set is recorded for GET /admin/warm-images.
+package warmimages
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"time"
+
+	buildahpkg "github.com/jorgerua/build-system/container-build-service/internal/buildah"
+	"github.com/jorgerua/build-system/container-build-service/internal/clock"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// usageHalfLife is how fast past builds stop counting towards an
+	// image's use, so the warm set follows what is built lately.
+	usageHalfLife = 24 * time.Hour
+	// minUses drops images not used for about four half-lives.
+	minUses = 0.05
+)
+
+// UsageSource reports the base images of the worker's builds.
+type UsageSource interface {
+	TakeBaseImageUsage() map[string]int
+}
+
+// Keeper periodically refreshes the worker's warm image set.
+type Keeper struct {
+	cfg     config.WarmImagesConfig
+	usage   UsageSource
+	builder *buildahpkg.Builder
+	warm    *tidb.WarmImageRepository
+	clock   clock.Clock
+	logger  *zap.Logger
+	worker  string
+
+	loaded  bool
+	last    time.Time
+	uses    map[string]float64
+	current map[string]tidb.WarmImage // by image
+}
+
+// New creates a Keeper and schedules it on the fx lifecycle.
+func New(cfg *config.Config, usage UsageSource, builder *buildahpkg.Builder, warm *tidb.WarmImageRepository, clk clock.Clock, logger *zap.Logger, lc fx.Lifecycle) *Keeper {
+	worker, _ := os.Hostname()
+	k := &Keeper{
+		cfg:     cfg.Buildah.WarmImages,
+		usage:   usage,
+		builder: builder,
+		warm:    warm,
+		clock:   clk,
+		logger:  logger.Named("warmimages"),
+		worker:  worker,
+		uses:    map[string]float64{},
+		current: map[string]tidb.WarmImage{},
+	}
+	if k.cfg.IntervalMinutes <= 0 {
+		k.logger.Info("warm images disabled")
+		return k
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			go func() {
+				defer close(done)
+				k.loop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			cancel()
+			<-done
+			return nil
+		},
+	})
+	return k
+}
+
+func (k *Keeper) loop(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(k.cfg.IntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		k.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce picks the warm set from the configured images and the recent
+// builds' base images, pulls those missing or changed in their registry,
+// and records the set.
+func (k *Keeper) RunOnce(ctx context.Context) {
+	now := k.clock.Now().UTC()
+	if !k.loaded {
+		// Carry the warm set over a restart.
+		images, err := k.warm.List(ctx, k.worker)
+		if err != nil {
+			k.logger.Warn("load warm images failed", zap.Error(err))
+		}
+		for _, w := range images {
+			k.uses[w.Image], k.current[w.Image] = w.Uses, w
+		}
+		k.loaded, k.last = err == nil, now
+	}
+	k.addUses(k.usage.TakeBaseImageUsage(), now.Sub(k.last))
+	k.last = now
+
+	next := map[string]tidb.WarmImage{}
+	var ids []string
+	for _, image := range selectImages(k.cfg.Images, k.uses, k.cfg.MaxImages) {
+		w, ok := k.refresh(ctx, image, now)
+		if !ok {
+			continue
+		}
+		w.Worker, w.Uses, w.Pinned = k.worker, k.uses[image], slices.Contains(k.cfg.Images, image)
+		next[image] = w
+		ids = append(ids, w.ImageID)
+	}
+	k.current = next
+	k.builder.SetWarm(ids)
+
+	images := make([]tidb.WarmImage, 0, len(next))
+	for _, image := range slices.Sorted(maps.Keys(next)) {
+		images = append(images, next[image])
+	}
+	if err := k.warm.Replace(ctx, k.worker, images); err != nil {
+		k.logger.Error("record warm images failed", zap.Error(err))
+		return
+	}
+	k.logger.Info("warm images refreshed", zap.Int("images", len(images)))
+}
+
+// refresh checks image's registry digest and pulls it when it is not warm
+// yet or has changed. A warm image whose check fails stays warm.
+func (k *Keeper) refresh(ctx context.Context, image string, now time.Time) (tidb.WarmImage, bool) {
+	w, warm := k.current[image]
+	digest, err := k.builder.RemoteDigest(ctx, image)
+	if err != nil {
+		k.logger.Warn("warm image digest check failed", zap.String("image", image), zap.Error(err))
+		return w, warm
+	}
+	if warm && digest == w.Digest {
+		w.CheckedAt = now
+		return w, true
+	}
+	id, err := k.builder.Pull(ctx, image)
+	if err != nil {
+		k.logger.Warn("warm image pull failed", zap.String("image", image), zap.Error(err))
+		return w, warm
+	}
+	k.logger.Info("warm image pulled",
+		zap.String("image", image),
+		zap.String("digest", digest),
+		zap.String("previous_digest", w.Digest),
+	)
+	return tidb.WarmImage{Image: image, Digest: digest, ImageID: id, PulledAt: now, CheckedAt: now}, true
+}
+
+// addUses decays the past uses by the time elapsed since the previous
+// refresh and adds the new ones.
+func (k *Keeper) addUses(uses map[string]int, elapsed time.Duration) {
+	decay := math.Pow(0.5, elapsed.Hours()/usageHalfLife.Hours())
+	for image, n := range k.uses {
+		if n *= decay; n < minUses {
+			delete(k.uses, image)
+		} else {
+			k.uses[image] = n
+		}
+	}
+	for image, n := range uses {
+		k.uses[image] += float64(n)
+	}
+}
+
+// selectImages returns the warm set: the pinned images, then up to max of
+// the most used others.
+func selectImages(pinned []string, uses map[string]float64, limit int) []string {
+	var out []string
+	for _, image := range pinned {
+		if !slices.Contains(out, image) {
+			out = append(out, image)
+		}
+	}
+	var ranked []string
+	for image := range uses {
+		if !slices.Contains(out, image) {
+			ranked = append(ranked, image)
+		}
+	}
+	slices.SortFunc(ranked, func(a, b string) int {
+		return cmp.Or(cmp.Compare(uses[b], uses[a]), cmp.Compare(a, b))
+	})
+	return append(out, ranked[:min(limit, len(ranked))]...)
+}
+
+// Module provides and starts the Keeper via fx.
+var Module = fx.Module("warmimages",
+	fx.Provide(New),
+	fx.Invoke(func(*Keeper) {}),
+)
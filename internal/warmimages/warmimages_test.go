@@ -0,0 +1,51 @@
+package warmimages
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSelectImages(t *testing.T) {
+	uses := map[string]float64{
+		"golang:1.26-bookworm":              5,
+		"gcr.io/distroless/static-debian12": 5,
+		"maven:3.9-eclipse-temurin-21":      2,
+		"mcr.microsoft.com/dotnet/sdk:8.0":  0.5,
+		"eclipse-temurin:21-jre-jammy":      2,
+	}
+	got := selectImages([]string{"alpine:3.20", "eclipse-temurin:21-jre-jammy", "alpine:3.20"}, uses, 3)
+	want := []string{
+		"alpine:3.20",
+		"eclipse-temurin:21-jre-jammy",
+		"gcr.io/distroless/static-debian12",
+		"golang:1.26-bookworm",
+		"maven:3.9-eclipse-temurin-21",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("selectImages = %v, want %v", got, want)
+	}
+	if got := selectImages(nil, uses, 0); len(got) != 0 {
+		t.Errorf("selectImages with no room = %v, want none", got)
+	}
+}
+
+func TestAddUses(t *testing.T) {
+	k := &Keeper{uses: map[string]float64{"golang:1.26-bookworm": 4, "alpine:3.20": 0.08}}
+	k.addUses(map[string]int{"maven:3.9-eclipse-temurin-21": 1}, usageHalfLife)
+
+	if got := k.uses["golang:1.26-bookworm"]; got != 2 {
+		t.Errorf("uses after a half-life = %v, want 2", got)
+	}
+	if _, ok := k.uses["alpine:3.20"]; ok {
+		t.Error("image decayed below minUses was kept")
+	}
+	if got := k.uses["maven:3.9-eclipse-temurin-21"]; got != 1 {
+		t.Errorf("new uses = %v, want 1", got)
+	}
+
+	k.addUses(map[string]int{"golang:1.26-bookworm": 1}, time.Duration(0))
+	if got := k.uses["golang:1.26-bookworm"]; got != 3 {
+		t.Errorf("uses = %v, want 3", got)
+	}
+}
@@ -2,14 +2,23 @@ package webhook
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/events"
+	"github.com/jorgerua/build-system/container-build-service/internal/freeze"
 	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	metricspkg "github.com/jorgerua/build-system/container-build-service/internal/metrics"
 	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
-	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"github.com/jorgerua/build-system/container-build-service/internal/validation"
 	"go.uber.org/zap"
 )
 
@@ -17,6 +26,7 @@ import (
 type pushPayload struct {
 	Ref        string `json:"ref"`
 	After      string `json:"after"`
+	Deleted    bool   `json:"deleted"`
 	Repository struct {
 		CloneURL string `json:"clone_url"`
 	} `json:"repository"`
@@ -26,21 +36,39 @@ type pushPayload struct {
 	Commits []struct {
 		Message string `json:"message"`
 	} `json:"commits"`
+	HeadCommit *struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+		Author  struct {
+			Email string `json:"email"`
+		} `json:"author"`
+	} `json:"head_commit"`
+
+	// source is where skips of the push are recorded as decided:
+	// tidb.SkipSourceWebhook unless set.
+	source string
 }
 
 // Handler handles incoming GitHub webhook requests.
 type Handler struct {
 	cfg       *config.Config
 	publisher *natspkg.Publisher
+	spool     *natspkg.Spool // nil when spooling is disabled
+	repos     *tidb.RepositoryRepository
+	numbers   *tidb.BuildNumberRepository
+	skips     *tidb.SkippedBuildRepository
+	held      *tidb.HeldBuildRepository
+	metrics   *metricspkg.WebhookMetrics
+	events    *events.Bridge
 	logger    *zap.Logger
 }
 
-// NewHandler creates a webhook Handler.
-func NewHandler(cfg *config.Config, publisher *natspkg.Publisher, logger *zap.Logger) *Handler {
-	return &Handler{cfg: cfg, publisher: publisher, logger: logger}
+// NewHandler creates a webhook Handler. spool may be nil.
+func NewHandler(cfg *config.Config, publisher *natspkg.Publisher, spool *natspkg.Spool, repos *tidb.RepositoryRepository, numbers *tidb.BuildNumberRepository, skips *tidb.SkippedBuildRepository, held *tidb.HeldBuildRepository, metrics *metricspkg.WebhookMetrics, bridge *events.Bridge, logger *zap.Logger) *Handler {
+	return &Handler{cfg: cfg, publisher: publisher, spool: spool, repos: repos, numbers: numbers, skips: skips, held: held, metrics: metrics, events: bridge, logger: logger.Named("webhook")}
 }
 
-// ServeHTTP handles POST /webhook.
+// ServeHTTP handles POST /v1/webhook (and the legacy /webhook).
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -50,29 +78,111 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate HMAC-SHA256 signature.
+	repo, err := deliveryRepo(body)
+	if err != nil {
+		h.logger.Warn("webhook repository ambiguous", zap.Error(err))
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	secrets, err := h.webhookSecrets(r.Context(), repo)
+	if err != nil {
+		h.logger.Error("webhook secret lookup failed", zap.Error(err))
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	}
 	sig := r.Header.Get("X-Hub-Signature-256")
-	if err := githubpkg.ValidateWebhookSignature(h.cfg.GitHub.WebhookSecret, sig, body); err != nil {
+	if err := githubpkg.ValidateWebhookSignatureAny(secrets, sig, body); err != nil {
 		h.logger.Warn("webhook signature invalid", zap.Error(err))
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if repo != "" {
+		if err := h.repos.RecordDelivery(r.Context(), repo); err != nil {
+			h.logger.Warn("record webhook delivery failed", zap.String("repo", repo), zap.Error(err))
+		}
+	}
 
-	// Only process push events.
-	if r.Header.Get("X-GitHub-Event") != "push" {
+	switch event := r.Header.Get("X-GitHub-Event"); {
+	case event == "push":
+		h.handlePush(w, body)
+	case event == "pull_request" && h.cfg.GitHub.ForkPullRequests:
+		h.handlePullRequest(w, body)
+	default:
 		w.WriteHeader(http.StatusOK)
-		return
 	}
+}
+
+// webhookSecrets returns the secrets a delivery may be signed with. A
+// repository with its own secret in the registry accepts only that secret
+// (and the one it replaced); others use github.webhook_secret. The
+// repository name is read from the still-unverified body, which is safe:
+// naming another repository only selects secrets the sender must know.
+func (h *Handler) webhookSecrets(ctx context.Context, repo string) ([]string, error) {
+	if repo != "" {
+		secrets, err := h.repos.WebhookSecrets(ctx, repo)
+		if err != nil || len(secrets) > 0 {
+			return secrets, err
+		}
+	}
+	return []string{h.cfg.GitHub.WebhookSecret}, nil
+}
+
+// deliveryRepo returns the full name of the repository a delivery is
+// about, or "". The secrets are chosen by this name and the job is built
+// from the clone URLs, so a delivery whose names and clone URLs disagree
+// is rejected: it could otherwise be signed with one repository's secret
+// and build another.
+func deliveryRepo(body []byte) (string, error) {
+	var payload struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+			CloneURL string `json:"clone_url"`
+		} `json:"repository"`
+		PullRequest struct {
+			Base struct {
+				Repo struct {
+					FullName string `json:"full_name"`
+					CloneURL string `json:"clone_url"`
+				} `json:"repo"`
+			} `json:"base"`
+		} `json:"pull_request"`
+	}
+	_ = json.Unmarshal(body, &payload)
+	repo := ""
+	for _, name := range []string{
+		payload.Repository.FullName,
+		githubpkg.RepoFullName(payload.Repository.CloneURL),
+		payload.PullRequest.Base.Repo.FullName,
+		githubpkg.RepoFullName(payload.PullRequest.Base.Repo.CloneURL),
+	} {
+		switch {
+		case name == "":
+		case repo == "":
+			repo = name
+		case !strings.EqualFold(name, repo):
+			return "", fmt.Errorf("delivery names both %s and %s", repo, name)
+		}
+	}
+	return repo, nil
+}
 
+// handlePush handles a push delivery; see push.
+func (h *Handler) handlePush(w http.ResponseWriter, body []byte) {
 	var payload pushPayload
 	if err := json.Unmarshal(body, &payload); err != nil {
 		h.logger.Warn("unmarshal payload failed", zap.Error(err))
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
+	h.push(w, payload)
+}
 
-	// Filter to main branch only.
-	if payload.Ref != "refs/heads/main" {
-		w.WriteHeader(http.StatusOK)
+// push publishes a trusted build job for pushes to main, and a compile-only
+// one for pushes to github.compile_only_branches. During a change freeze
+// the push is skipped or held, per freeze.mode.
+func (h *Handler) push(w http.ResponseWriter, payload pushPayload) {
+	if reason, detail := skipPush(payload, h.cfg.GitHub); reason != "" {
+		h.skip(w, payload, reason, detail)
 		return
 	}
 
@@ -81,26 +191,285 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	for _, c := range payload.Commits {
 		messages = append(messages, c.Message)
 	}
+	if onlyPropagationCommits(messages) {
+		h.skip(w, payload, tidb.SkipPropagationCommits, "every commit is a [skip build] version propagation commit")
+		return
+	}
 
 	// Publish build job; worker will generate the installation token.
 	job := natspkg.BuildJob{
 		RepoURL:        payload.Repository.CloneURL,
 		SHA:            payload.After,
+		Branch:         strings.TrimPrefix(payload.Ref, "refs/heads/"),
 		CommitMessages: messages,
 		InstallationID: payload.Installation.ID,
 		PublishedAt:    time.Now().UTC(),
+		Directives:     natspkg.ParseDirectives(messages),
+	}
+	job.CompileOnly = job.Branch != "main" || natspkg.RequestsCompileOnly(messages)
+	if hc := payload.HeadCommit; hc != nil {
+		job.HeadCommit = &natspkg.CommitInfo{
+			ID:          hc.ID,
+			Message:     hc.Message,
+			AuthorEmail: hc.Author.Email,
+		}
 	}
 
-	if err := h.publisher.Publish(context.Background(), job); err != nil {
+	repo := githubpkg.RepoFullName(job.RepoURL)
+	frozen, ok := freeze.Active(h.cfg.Freeze, repo, time.Now())
+	switch {
+	case !ok:
+		h.publish(w, job, nil)
+	case freeze.Overridden(messages):
+		h.logger.Warn("change freeze overridden", zap.String("repo", repo), zap.String("sha", job.SHA), zap.String("freeze", frozen.Reason))
+		h.publish(w, job, nil)
+	case h.cfg.Freeze.Mode == "hold":
+		h.publish(w, job, &frozen)
+	default:
+		h.skip(w, payload, tidb.SkipFrozen, freezeDetail(frozen))
+	}
+}
+
+// freezeDetail describes a freeze for a skip record.
+func freezeDetail(w freeze.Window) string {
+	detail := "change freeze until " + w.Until.UTC().Format(time.RFC3339)
+	if w.Reason != "" {
+		detail += ": " + w.Reason
+	}
+	return detail
+}
+
+// skipPush returns why a push must not be built, or "". Only main and the
+// compile-only branches are built. A deletion has no commit to build
+// (after is all zeros); a push without commits only moves the branch to a
+// commit that was already pushed.
+func skipPush(p pushPayload, gh config.GitHubConfig) (reason, detail string) {
+	branch, isBranch := strings.CutPrefix(p.Ref, "refs/heads/")
+	switch {
+	case !isBranch || (branch != "main" && !gh.CompileOnly(branch)):
+		return tidb.SkipBranchFilter, "only main and github.compile_only_branches are built"
+	case p.Deleted || (p.After != "" && strings.Trim(p.After, "0") == ""):
+		return tidb.SkipBranchDeleted, "the push deleted the branch"
+	case gh.SkipEmptyPushes && len(p.Commits) == 0:
+		return tidb.SkipNoCommits, "the push added no commits"
+	}
+	return "", ""
+}
+
+// skip records a push that is not built and responds 200 with why, e.g.
+// {"skipped":"branch_filter","detail":"..."}, which GitHub shows in the
+// delivery log.
+func (h *Handler) skip(w http.ResponseWriter, p pushPayload, reason, detail string) {
+	h.recordSkip(p, reason, detail)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(struct {
+		Skipped string `json:"skipped"`
+		Detail  string `json:"detail,omitempty"`
+	}{reason, detail})
+}
+
+// recordSkip logs, counts and records a push that is not built.
+func (h *Handler) recordSkip(p pushPayload, reason, detail string) {
+	source := p.source
+	if source == "" {
+		source = tidb.SkipSourceWebhook
+	}
+	h.recordSkipped(tidb.SkippedBuild{
+		Repo:   githubpkg.RepoFullName(p.Repository.CloneURL),
+		SHA:    p.After,
+		Ref:    p.Ref,
+		Reason: reason,
+		Detail: detail,
+		Source: source,
+	})
+}
+
+// recordSkipped logs, counts and records a skipped build. A store failure
+// only loses the record.
+func (h *Handler) recordSkipped(s tidb.SkippedBuild) {
+	h.logger.Info("push skipped, not building", zap.String("reason", s.Reason),
+		zap.String("repo", s.Repo), zap.String("ref", s.Ref), zap.String("sha", s.SHA))
+	h.metrics.PushSkipped(s.Reason)
+	if err := h.skips.Record(context.Background(), s); err != nil {
+		h.logger.Warn("record skipped push failed", zap.Error(err), zap.String("repo", s.Repo))
+	}
+	h.events.Emit(events.JobSkipped, events.Job{
+		Repo:   s.Repo,
+		SHA:    s.SHA,
+		Branch: strings.TrimPrefix(s.Ref, "refs/heads/"),
+		Reason: s.Reason,
+		Detail: s.Detail,
+	})
+}
+
+// onlyPropagationCommits reports whether a push is made entirely of the
+// service's own version propagation commits, which must not trigger builds.
+func onlyPropagationCommits(messages []string) bool {
+	for _, m := range messages {
+		if !githubpkg.IsPropagationCommit(m) {
+			return false
+		}
+	}
+	return len(messages) > 0
+}
+
+// writeValidationError responds 400 with the invalid fields, e.g.
+// {"error":"invalid build job","details":[{"field":"sha","message":"..."}]}.
+func writeValidationError(w http.ResponseWriter, err error) {
+	var details validation.Errors
+	errors.As(err, &details)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error   string            `json:"error"`
+		Details validation.Errors `json:"details"`
+	}{"invalid build job", details})
+}
+
+// publish sends job to the build queue and writes the response. With a
+// freeze, job is held until it ends instead.
+func (h *Handler) publish(w http.ResponseWriter, job natspkg.BuildJob, frozen *freeze.Window) {
+	if err := job.Validate(); err != nil {
+		h.logger.Warn("build job invalid", zap.Error(err), zap.String("repo", job.RepoURL), zap.String("sha", job.SHA))
+		writeValidationError(w, err)
+		return
+	}
+	repo := githubpkg.RepoFullName(job.RepoURL)
+	registered, err := h.repos.Get(context.Background(), repo)
+	switch {
+	case err == nil:
+		if s := registered.Settings; len(s.Requires)+len(s.Avoids) > 0 {
+			job.Affinity = &natspkg.Affinity{Requires: s.Requires, Avoids: s.Avoids}
+		}
+		if s := registered.Settings; s.Language != "" || len(s.Languages) > 0 {
+			job.Languages = &natspkg.Languages{Default: s.Language, Projects: s.Languages}
+		}
+		job.FailOnWarning = registered.Settings.FailOnWarning
+	case h.cfg.GitHub.RepositoryMode != "closed":
+		// Open mode builds any repository; a lookup failure only loses
+		// its affinity hints.
+		if !errors.Is(err, sql.ErrNoRows) {
+			h.logger.Warn("repository lookup failed, publishing without affinity hints", zap.Error(err), zap.String("repo", repo))
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		h.logger.Warn("repository not onboarded, rejecting webhook", zap.String("repo", repo))
+		h.recordSkipped(tidb.SkippedBuild{
+			Repo:   repo,
+			SHA:    job.SHA,
+			Ref:    "refs/heads/" + job.Branch,
+			Reason: tidb.SkipClosed,
+			Detail: "repository not onboarded and github.repository_mode is closed",
+			Source: tidb.SkipSourceWebhook,
+		})
+		http.Error(w, "repository not onboarded", http.StatusForbidden)
+		return
+	default:
+		h.logger.Error("repository lookup failed", zap.Error(err), zap.String("repo", repo))
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	// A store outage must not drop the build: it is queued without a number.
+	n, err := h.numbers.Next(context.Background(), repo)
+	if err != nil {
+		h.logger.Warn("build number not assigned", zap.Error(err), zap.String("repo", job.RepoURL))
+	}
+	job.BuildNumber = n
+
+	if frozen != nil {
+		h.hold(w, job, *frozen)
+		return
+	}
+
+	var (
+		id      string
+		spooled bool
+	)
+	if h.spool != nil {
+		id, spooled, err = h.spool.Publish(context.Background(), job)
+	} else {
+		id, err = h.publisher.Publish(context.Background(), job)
+	}
+	var tooLarge *natspkg.ErrPayloadTooLarge
+	if errors.As(err, &tooLarge) {
+		h.logger.Error("build job too large to publish", zap.Error(err), zap.String("sha", job.SHA))
+		http.Error(w, "build job too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
 		h.logger.Error("publish build job failed", zap.Error(err), zap.String("sha", job.SHA))
 		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
 		return
 	}
 
+	job.ID = id
+	h.events.Emit(events.JobQueued, events.FromJob(job))
+	if spooled {
+		h.logger.Warn("nats unavailable, build job spooled",
+			zap.String("job_id", id),
+			zap.Int64("build_number", job.BuildNumber),
+			zap.String("repo", job.RepoURL),
+			zap.String("sha", job.SHA),
+			zap.Int("spooled", h.spool.Pending()),
+		)
+		writeAccepted(w, acceptedJob{JobID: id, BuildNumber: job.BuildNumber, Spooled: true})
+		return
+	}
 	h.logger.Info("build job published",
+		zap.String("job_id", id),
+		zap.Int64("build_number", job.BuildNumber),
 		zap.String("repo", job.RepoURL),
 		zap.String("sha", job.SHA),
 		zap.Int64("installation_id", job.InstallationID),
+		zap.String("trust", string(job.Trust)),
+		zap.Any("directives", job.Directives),
+	)
+	writeAccepted(w, acceptedJob{JobID: id, BuildNumber: job.BuildNumber})
+}
+
+// hold stores job until the freeze ends; see freeze.Releaser.
+func (h *Handler) hold(w http.ResponseWriter, job natspkg.BuildJob, frozen freeze.Window) {
+	data, err := json.Marshal(job)
+	if err == nil {
+		_, err = h.held.Hold(context.Background(), tidb.HeldBuild{
+			Repo:      githubpkg.RepoFullName(job.RepoURL),
+			SHA:       job.SHA,
+			Reason:    frozen.Reason,
+			ReleaseAt: frozen.Until,
+			Job:       data,
+		})
+	}
+	if err != nil {
+		h.logger.Error("hold build job failed", zap.Error(err), zap.String("sha", job.SHA))
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	h.logger.Info("build job held by change freeze",
+		zap.Int64("build_number", job.BuildNumber),
+		zap.String("repo", job.RepoURL),
+		zap.String("sha", job.SHA),
+		zap.Time("until", frozen.Until),
+		zap.String("freeze", frozen.Reason),
 	)
+	held := events.FromJob(job)
+	held.HeldUntil = &frozen.Until
+	held.Reason = frozen.Reason
+	h.events.Emit(events.JobHeld, held)
+	writeAccepted(w, acceptedJob{BuildNumber: job.BuildNumber, HeldUntil: &frozen.Until})
+}
+
+// acceptedJob is the 202 response to a push whose build job was queued,
+// spooled or held, e.g. {"job_id":"01J...","build_number":7}.
+type acceptedJob struct {
+	JobID       string     `json:"job_id,omitempty"`
+	BuildNumber int64      `json:"build_number,omitempty"`
+	Spooled     bool       `json:"spooled,omitempty"`
+	HeldUntil   *time.Time `json:"held_until,omitempty"`
+}
+
+func writeAccepted(w http.ResponseWriter, job acceptedJob) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
 }
@@ -0,0 +1,149 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"go.uber.org/zap"
+)
+
+func TestWriteValidationError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeValidationError(rec, natspkg.BuildJob{RepoURL: "https://github.com/acme/shop.git"}.Validate())
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	var body struct {
+		Error   string `json:"error"`
+		Details []struct {
+			Field   string `json:"field"`
+			Message string `json:"message"`
+		} `json:"details"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error != "invalid build job" || len(body.Details) != 2 ||
+		body.Details[0].Field != "sha" || body.Details[1].Field != "installation_id" {
+		t.Errorf("body = %+v", body)
+	}
+}
+
+func TestOnlyPropagationCommits(t *testing.T) {
+	bump := "chore(release): api 1.2.3\n\nBuilt from abc. [skip build]"
+	tests := []struct {
+		messages []string
+		want     bool
+	}{
+		{nil, false},
+		{[]string{bump}, true},
+		{[]string{bump, bump}, true},
+		{[]string{bump, "feat: cart"}, false},
+	}
+	for _, tc := range tests {
+		if got := onlyPropagationCommits(tc.messages); got != tc.want {
+			t.Errorf("onlyPropagationCommits(%q) = %v, want %v", tc.messages, got, tc.want)
+		}
+	}
+}
+
+func TestSkipPush(t *testing.T) {
+	commit := []struct {
+		Message string `json:"message"`
+	}{{Message: "feat: cart"}}
+	const main = "refs/heads/main"
+	gh := config.GitHubConfig{SkipEmptyPushes: true, CompileOnlyBranches: []string{"feature/*"}}
+	allowEmpty := gh
+	allowEmpty.SkipEmptyPushes = false
+	tests := []struct {
+		name    string
+		payload pushPayload
+		gh      config.GitHubConfig
+		want    string
+	}{
+		{"push", pushPayload{Ref: main, After: "abc123", Commits: commit}, gh, ""},
+		{"compile-only branch", pushPayload{Ref: "refs/heads/feature/cart", After: "abc123", Commits: commit}, gh, ""},
+		{"other branch", pushPayload{Ref: "refs/heads/release", After: "abc123", Commits: commit}, gh, "branch_filter"},
+		{"tag", pushPayload{Ref: "refs/tags/v1.0.0", After: "abc123"}, gh, "branch_filter"},
+		{"deleted flag", pushPayload{Ref: main, After: "abc123", Deleted: true}, allowEmpty, "branch_deleted"},
+		{"zero after", pushPayload{Ref: main, After: "0000000000000000000000000000000000000000"}, allowEmpty, "branch_deleted"},
+		{"no commits", pushPayload{Ref: main, After: "abc123"}, gh, "no_commits"},
+		{"no commits allowed", pushPayload{Ref: main, After: "abc123"}, allowEmpty, ""},
+	}
+	for _, tc := range tests {
+		if got, _ := skipPush(tc.payload, tc.gh); got != tc.want {
+			t.Errorf("%s: skipPush = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSimulatePayload(t *testing.T) {
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+	req := simulateRequest{Repo: "acme/shop", Branch: "main", SHA: sha, Messages: []string{"feat: cart", "fix: total"}}
+	p, err := req.payload(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Ref != "refs/heads/main" || p.After != sha || p.Installation.ID != 42 || p.source != "simulated" {
+		t.Errorf("payload = %+v", p)
+	}
+	if got := githubpkg.RepoFullName(p.Repository.CloneURL); got != "acme/shop" {
+		t.Errorf("repo = %q", got)
+	}
+	if len(p.Commits) != 2 || p.HeadCommit == nil || p.HeadCommit.ID != sha || p.HeadCommit.Message != "fix: total" {
+		t.Errorf("commits = %+v, head = %+v", p.Commits, p.HeadCommit)
+	}
+	if reason, _ := skipPush(p, config.GitHubConfig{SkipEmptyPushes: true}); reason != "" {
+		t.Errorf("skipPush = %q", reason)
+	}
+
+	req = simulateRequest{Repo: "acme/shop", Branch: "release", SHA: sha}
+	if p, _ = req.payload(42); len(p.Commits) != 1 || p.Commits[0].Message != defaultSimulatedMessage {
+		t.Errorf("commits = %+v", p.Commits)
+	}
+	if reason, _ := skipPush(p, config.GitHubConfig{}); reason != "branch_filter" {
+		t.Errorf("skipPush = %q, want branch_filter", reason)
+	}
+}
+
+func TestDeliveryRepo(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+		ok   bool
+	}{
+		{"push", `{"repository":{"full_name":"acme/shop","clone_url":"https://github.com/acme/shop.git"}}`, "acme/shop", true},
+		{"case differs", `{"repository":{"full_name":"Acme/Shop","clone_url":"https://github.com/acme/shop.git"}}`, "Acme/Shop", true},
+		{"clone url only", `{"repository":{"clone_url":"https://github.com/acme/shop.git"}}`, "acme/shop", true},
+		{"no repository", `{"zen":"hello"}`, "", true},
+		{"pull request", `{"repository":{"full_name":"acme/shop"},"pull_request":{"base":{"repo":{"full_name":"acme/shop","clone_url":"https://github.com/acme/shop.git"}}}}`, "acme/shop", true},
+		{"clone url mismatch", `{"repository":{"full_name":"acme/open","clone_url":"https://github.com/acme/secret.git"}}`, "", false},
+		{"base mismatch", `{"repository":{"full_name":"acme/open"},"pull_request":{"base":{"repo":{"clone_url":"https://github.com/acme/secret.git"}}}}`, "", false},
+	}
+	for _, tc := range tests {
+		got, err := deliveryRepo([]byte(tc.body))
+		if got != tc.want || (err == nil) != tc.ok {
+			t.Errorf("%s: deliveryRepo = %q, %v; want %q, ok %v", tc.name, got, err, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestServeHTTPRejectsRepoMismatch(t *testing.T) {
+	h := &Handler{cfg: &config.Config{}, logger: zap.NewNop()}
+	body := `{"ref":"refs/heads/main","repository":{"full_name":"acme/open","clone_url":"https://github.com/acme/secret.git"}}`
+	r := httptest.NewRequest("POST", "/v1/webhook", strings.NewReader(body))
+	r.Header.Set("X-GitHub-Event", "push")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d; want 400", w.Code)
+	}
+}
@@ -0,0 +1,180 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/zap"
+)
+
+// metaMinRefetch rate-limits meta API fetches after a failure.
+const metaMinRefetch = time.Minute
+
+// OriginVerifier decides whether a webhook request comes from an accepted
+// address: GitHub's published hook ranges and/or configured CIDRs.
+type OriginVerifier struct {
+	cfg        config.HookOriginConfig
+	static     []netip.Prefix
+	proxies    []netip.Prefix
+	httpClient *http.Client
+	logger     *zap.Logger
+
+	mu        sync.Mutex
+	meta      []netip.Prefix
+	fetchedAt time.Time
+	attemptAt time.Time
+}
+
+// NewOriginVerifier creates an OriginVerifier that fetches GitHub's meta API
+// with httpClient. CIDRs were checked by config.Validate.
+func NewOriginVerifier(cfg *config.Config, httpClient *http.Client, logger *zap.Logger) *OriginVerifier {
+	hc := cfg.GitHub.HookOrigin
+	return &OriginVerifier{
+		cfg:        hc,
+		static:     parsePrefixes(hc.CIDRs),
+		proxies:    parsePrefixes(hc.TrustedProxies),
+		httpClient: httpClient,
+		logger:     logger,
+	}
+}
+
+// Enabled reports whether any origin restriction is configured.
+func (v *OriginVerifier) Enabled() bool {
+	return v.cfg.Meta || len(v.static) > 0
+}
+
+// Wrap rejects requests from unaccepted origins with 403 before calling h.
+func (v *OriginVerifier) Wrap(h http.Handler) http.Handler {
+	if !v.Enabled() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, ok := v.clientAddr(r)
+		if !ok || !v.allowed(r.Context(), addr) {
+			v.logger.Warn("webhook origin rejected",
+				zap.String("remote_addr", r.RemoteAddr),
+				zap.String("client", addr.String()),
+			)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// clientAddr returns the request's client address. When the peer is a
+// trusted proxy, X-Forwarded-For is walked from the right, skipping
+// trusted proxies, so a client cannot spoof its address by prepending
+// entries.
+func (v *OriginVerifier) clientAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+	if !contains(v.proxies, addr) {
+		return addr, true
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr = hop.Unmap()
+		if !contains(v.proxies, addr) {
+			return addr, true
+		}
+	}
+	return addr, true
+}
+
+func (v *OriginVerifier) allowed(ctx context.Context, addr netip.Addr) bool {
+	if contains(v.static, addr) {
+		return true
+	}
+	if !v.cfg.Meta {
+		return false
+	}
+	return contains(v.metaRanges(ctx), addr)
+}
+
+// metaRanges returns GitHub's hook ranges, refetching them when older than
+// the refresh interval. On fetch failure the last known ranges are kept.
+func (v *OriginVerifier) metaRanges(ctx context.Context) []netip.Prefix {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	refresh := time.Duration(v.cfg.MetaRefreshMinutes) * time.Minute
+	if time.Since(v.fetchedAt) >= refresh && time.Since(v.attemptAt) >= metaMinRefetch {
+		v.attemptAt = time.Now()
+		ranges, err := v.fetchMeta(ctx)
+		if err != nil {
+			v.logger.Warn("github meta fetch failed, keeping previous hook ranges",
+				zap.Int("ranges", len(v.meta)), zap.Error(err))
+		} else {
+			v.meta = ranges
+			v.fetchedAt = time.Now()
+			v.logger.Info("github hook ranges refreshed", zap.Int("ranges", len(ranges)))
+		}
+	}
+	return v.meta
+}
+
+func (v *OriginVerifier) fetchMeta(ctx context.Context) ([]netip.Prefix, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.MetaURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build meta request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch meta: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status from meta endpoint: %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Hooks []string `json:"hooks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode meta: %w", err)
+	}
+	if len(doc.Hooks) == 0 {
+		return nil, fmt.Errorf("meta lists no hook ranges")
+	}
+	return parsePrefixes(doc.Hooks), nil
+}
+
+func parsePrefixes(cidrs []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, c := range cidrs {
+		if p, err := netip.ParsePrefix(c); err == nil {
+			prefixes = append(prefixes, p.Masked())
+		}
+	}
+	return prefixes
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
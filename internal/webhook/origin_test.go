@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestOriginVerifier(t *testing.T) {
+	var fetches atomic.Int32
+	meta := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		_, _ = w.Write([]byte(`{"hooks":["192.30.252.0/22","2a0a:a440::/29"]}`))
+	}))
+	defer meta.Close()
+
+	cfg := &config.Config{GitHub: config.GitHubConfig{HookOrigin: config.HookOriginConfig{
+		Meta:               true,
+		MetaURL:            meta.URL,
+		MetaRefreshMinutes: 60,
+		CIDRs:              []string{"10.1.0.0/16"},
+		TrustedProxies:     []string{"10.0.0.0/24"},
+	}}}
+	h := NewOriginVerifier(cfg, http.DefaultClient, zap.NewNop()).Wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		want       int
+	}{
+		{"github hook range", "192.30.252.10:443", "", http.StatusOK},
+		{"github ipv6 hook range", "[2a0a:a440::1]:443", "", http.StatusOK},
+		{"configured cidr", "10.1.2.3:1234", "", http.StatusOK},
+		{"unknown origin", "203.0.113.7:1234", "", http.StatusForbidden},
+		{"via trusted proxy", "10.0.0.5:80", "192.30.252.10", http.StatusOK},
+		{"spoofed hop before real client", "10.0.0.5:80", "192.30.252.10, 203.0.113.7", http.StatusForbidden},
+		{"forwarded header from untrusted peer", "203.0.113.7:1234", "192.30.252.10", http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("meta fetched %d times, want 1 within the refresh interval", n)
+	}
+}
+
+func TestOriginVerifierDisabled(t *testing.T) {
+	v := NewOriginVerifier(&config.Config{}, http.DefaultClient, zap.NewNop())
+	if v.Enabled() {
+		t.Error("verifier enabled without meta or CIDRs")
+	}
+}
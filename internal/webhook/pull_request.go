@@ -0,0 +1,87 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"go.uber.org/zap"
+)
+
+// pullRequestPayload represents the relevant fields of a GitHub
+// pull_request webhook.
+type pullRequestPayload struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Title string `json:"title"`
+		Head  struct {
+			Ref  string `json:"ref"`
+			SHA  string `json:"sha"`
+			Repo struct {
+				FullName string `json:"full_name"`
+				CloneURL string `json:"clone_url"`
+			} `json:"repo"`
+		} `json:"head"`
+		Base struct {
+			Ref  string `json:"ref"`
+			SHA  string `json:"sha"`
+			Repo struct {
+				FullName string `json:"full_name"`
+				CloneURL string `json:"clone_url"`
+			} `json:"repo"`
+		} `json:"base"`
+	} `json:"pull_request"`
+	Installation struct {
+		ID int64 `json:"id"`
+	} `json:"installation"`
+}
+
+// isForkBuild reports whether the payload is a new or updated pull request
+// against main whose head lives in another repository. Pull requests from
+// branches of the repository itself are built when they merge.
+func (p pullRequestPayload) isForkBuild() bool {
+	switch p.Action {
+	case "opened", "synchronize", "reopened":
+	default:
+		return false
+	}
+	pr := p.PullRequest
+	return pr.Base.Ref == "main" &&
+		pr.Head.Repo.FullName != "" &&
+		!strings.EqualFold(pr.Head.Repo.FullName, pr.Base.Repo.FullName)
+}
+
+// handlePullRequest publishes an untrusted, build-only job for pull
+// requests opened from forks.
+func (h *Handler) handlePullRequest(w http.ResponseWriter, body []byte) {
+	var payload pullRequestPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		h.logger.Warn("unmarshal payload failed", zap.Error(err))
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !payload.isForkBuild() {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	pr := payload.PullRequest
+	h.publish(w, natspkg.BuildJob{
+		RepoURL:        pr.Base.Repo.CloneURL,
+		SHA:            pr.Head.SHA,
+		Branch:         pr.Head.Ref,
+		CommitMessages: []string{pr.Title},
+		InstallationID: payload.Installation.ID,
+		PublishedAt:    time.Now().UTC(),
+		Trust:          natspkg.TrustUntrusted,
+		CloneURL:       pr.Head.Repo.CloneURL,
+		BaseSHA:        pr.Base.SHA,
+		PullRequest: &natspkg.PullRequestInfo{
+			Number:   payload.Number,
+			HeadRepo: pr.Head.Repo.FullName,
+		},
+	}, nil)
+}
@@ -0,0 +1,32 @@
+package webhook
+
+import "testing"
+
+func TestIsForkBuild(t *testing.T) {
+	payload := func(action, base, head, ref string) pullRequestPayload {
+		var p pullRequestPayload
+		p.Action = action
+		p.PullRequest.Base.Ref = ref
+		p.PullRequest.Base.Repo.FullName = base
+		p.PullRequest.Head.Repo.FullName = head
+		return p
+	}
+
+	tests := []struct {
+		name string
+		p    pullRequestPayload
+		want bool
+	}{
+		{"fork opened", payload("opened", "acme/shop", "dev/shop", "main"), true},
+		{"fork synchronized", payload("synchronize", "acme/shop", "dev/shop", "main"), true},
+		{"same repository", payload("opened", "acme/shop", "ACME/shop", "main"), false},
+		{"closed", payload("closed", "acme/shop", "dev/shop", "main"), false},
+		{"other base branch", payload("opened", "acme/shop", "dev/shop", "release"), false},
+		{"deleted fork", payload("opened", "acme/shop", "", "main"), false},
+	}
+	for _, tc := range tests {
+		if got := tc.p.isForkBuild(); got != tc.want {
+			t.Errorf("%s: isForkBuild() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
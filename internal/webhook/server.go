@@ -2,34 +2,154 @@ package webhook
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/nats-io/nats.go/jetstream"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
 
+// Route is an HTTP handler mounted on the server mux by other modules.
+type Route struct {
+	Pattern string // net/http ServeMux pattern, e.g. "GET /images/{digest}"
+	Handler http.Handler
+	// Unversioned mounts the route at Pattern only, outside the API
+	// version prefix, for operational endpoints such as /debug/pprof/.
+	Unversioned bool
+}
+
+// AsRoute annotates a Route constructor so that it joins the "routes" group.
+func AsRoute(f any) any {
+	return fx.Annotate(f, fx.ResultTags(`group:"routes"`))
+}
+
+// ServerParams groups fx dependencies for the HTTP server.
+type ServerParams struct {
+	fx.In
+	Config  *config.Config
+	Handler *Handler
+	Origin  *OriginVerifier
+	// Shedder, nil when disabled, bounds the webhooks handled at once.
+	Shedder *LoadShedder
+	// Consumer and Control, when present, add the build consumer's lag
+	// and the queue pause switch to /readyz.
+	Consumer jetstream.Consumer `optional:"true"`
+	Control  *natspkg.Control   `optional:"true"`
+	// Link, when NATS is connected lazily, makes /readyz report
+	// "degraded" until it is ready. Spool adds the spooled job count.
+	Link      *natspkg.Link  `optional:"true"`
+	Spool     *natspkg.Spool `optional:"true"`
+	Logger    *zap.Logger
+	Lifecycle fx.Lifecycle
+	Routes    []Route `group:"routes"`
+}
+
 // NewServer creates and registers an HTTP server with health check and webhook endpoint.
-func NewServer(cfg *config.Config, handler *Handler, logger *zap.Logger, lc fx.Lifecycle) *http.Server {
+func NewServer(p ServerParams) *http.Server {
+	logger := p.Logger
+	cfg := p.Config.Server
+
+	// draining flips /readyz to 503 on shutdown so the load balancer stops
+	// routing new requests here before the listener closes.
+	var draining atomic.Bool
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
-	mux.Handle("/webhook", handler)
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if p.Consumer == nil && p.Control == nil && p.Link == nil {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		// Lag and pausing are informational: workers falling behind or
+		// paused is no reason to stop accepting webhooks.
+		ready := readiness{Status: "ready"}
+		status := http.StatusOK
+		if p.Spool != nil {
+			ready.Spooled = p.Spool.Pending()
+		}
+		if p.Link != nil && !p.Link.Ready() {
+			// Without NATS, webhooks are only accepted into the spool.
+			ready.Status, ready.NATSError = "degraded", p.Link.Err().Error()
+			if p.Spool == nil {
+				status = http.StatusServiceUnavailable
+			}
+			writeReadiness(w, status, ready)
+			return
+		}
+		consumer := p.Consumer
+		if consumer == nil && p.Link != nil {
+			consumer = p.Link.Consumer()
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		if consumer != nil {
+			if lag, err := natspkg.Lag(ctx, consumer); err != nil {
+				ready.NATSError = err.Error()
+			} else {
+				ready.NATS = &lag
+			}
+		}
+		if p.Control != nil {
+			if state, err := p.Control.Pause(ctx); err != nil {
+				ready.NATSError = err.Error()
+			} else {
+				ready.Queue = &state
+			}
+		}
+		writeReadiness(w, status, ready)
+	})
+	var hook http.Handler = p.Handler
+	if p.Origin != nil {
+		hook = p.Origin.Wrap(hook)
+	}
+	hook = p.Shedder.Wrap(hook)
+	routes := append([]Route{{Pattern: "/webhook", Handler: hook}}, p.Routes...)
+	var sunset time.Time
+	if cfg.LegacySunset != "" {
+		sunset, _ = time.Parse(time.DateOnly, cfg.LegacySunset) // checked by config.Validate
+	}
+	for _, r := range routes {
+		if r.Unversioned {
+			mux.Handle(r.Pattern, r.Handler)
+			continue
+		}
+		mux.Handle(versioned(r.Pattern), r.Handler)
+		if cfg.LegacyRoutes {
+			mux.Handle(r.Pattern, deprecated(r.Handler, sunset))
+		}
+	}
 
 	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", 8080),
-		Handler:      mux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+		Addr:           fmt.Sprintf(":%d", cfg.Port),
+		Handler:        mux,
+		ReadTimeout:    time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:   time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:    time.Duration(cfg.IdleTimeoutSeconds) * time.Second,
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+	}
+	if cfg.H2C {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
 	}
 
-	lc.Append(fx.Hook{
+	p.Lifecycle.Append(fx.Hook{
 		OnStart: func(_ context.Context) error {
 			go func() {
-				logger.Info("webhook server starting", zap.String("addr", srv.Addr))
+				logger.Info("webhook server starting", zap.String("addr", srv.Addr), zap.Bool("h2c", cfg.H2C))
 				if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 					logger.Error("webhook server error", zap.Error(err))
 				}
@@ -37,13 +157,71 @@ func NewServer(cfg *config.Config, handler *Handler, logger *zap.Logger, lc fx.L
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
+			draining.Store(true)
+			srv.SetKeepAlivesEnabled(false)
+			drain := time.Duration(cfg.DrainSeconds) * time.Second
+			logger.Info("webhook server draining", zap.Duration("drain", drain))
+			select {
+			case <-time.After(drain):
+			case <-ctx.Done():
+			}
 			return srv.Shutdown(ctx)
 		},
 	})
 	return srv
 }
 
-// Module provides the webhook HTTP server via fx.
+// readiness is the /readyz body.
+type readiness struct {
+	Status    string               `json:"status"`
+	NATS      *natspkg.ConsumerLag `json:"nats,omitempty"`
+	NATSError string               `json:"nats_error,omitempty"`
+	Queue     *natspkg.PauseState  `json:"queue,omitempty"`
+	Spooled   int                  `json:"spooled,omitempty"`
+}
+
+func writeReadiness(w http.ResponseWriter, status int, ready readiness) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ready)
+}
+
+// apiVersion is the path prefix of the current API version. Routes are
+// declared without it and mounted under it; a breaking change (new status
+// values, cursor pagination) ships as a new prefix served alongside the old
+// one, so callers opt in by path.
+const apiVersion = "/v1"
+
+// legacyDeprecatedAt is when the unversioned paths were deprecated, sent
+// in the Deprecation header (RFC 9745).
+var legacyDeprecatedAt = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// versioned prefixes the path of a ServeMux pattern with apiVersion,
+// keeping any method: "GET /builds/{id}" becomes "GET /v1/builds/{id}".
+func versioned(pattern string) string {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		return apiVersion + pattern
+	}
+	return method + " " + apiVersion + path
+}
+
+// deprecated serves h on a legacy unversioned path, announcing the /v1
+// successor through Deprecation, Sunset and Link headers.
+func deprecated(h http.Handler, sunset time.Time) http.Handler {
+	deprecation := fmt.Sprintf("@%d", legacyDeprecatedAt.Unix())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", deprecation)
+		if !sunset.IsZero() {
+			w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		w.Header().Add("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", apiVersion, r.URL.EscapedPath()))
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Module provides the webhook HTTP server via fx and starts it.
 var Module = fx.Module("webhook",
-	fx.Provide(NewHandler, NewServer),
+	fx.Provide(NewHandler, NewOriginVerifier, NewLoadShedder, NewSpool, NewServer, AsRoute(NewSimulateRoute)),
+	fx.Invoke(func(*http.Server) {}),
 )
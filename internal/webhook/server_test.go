@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func TestServerDrain(t *testing.T) {
+	lc := fxtest.NewLifecycle(t)
+	cfg := &config.Config{Server: config.ServerConfig{Port: 0, MaxHeaderBytes: 4096, H2C: true}}
+	srv := NewServer(ServerParams{Config: cfg, Logger: zap.NewNop(), Lifecycle: lc})
+
+	if srv.MaxHeaderBytes != 4096 || srv.Protocols == nil || !srv.Protocols.UnencryptedHTTP2() {
+		t.Errorf("server tuning not applied: max header %d, protocols %v", srv.MaxHeaderBytes, srv.Protocols)
+	}
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	lc.RequireStart()
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("/readyz before shutdown = %d, want 200", code)
+	}
+	lc.RequireStop()
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz while draining = %d, want 503", code)
+	}
+}
+
+func TestServerVersionedRoutes(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	newServer := func(cfg config.ServerConfig) *http.Server {
+		return NewServer(ServerParams{
+			Config:    &config.Config{Server: cfg},
+			Logger:    zap.NewNop(),
+			Lifecycle: fxtest.NewLifecycle(t),
+			Routes:    []Route{{Pattern: "GET /builds/{id}", Handler: ok}},
+		})
+	}
+	get := func(srv *http.Server, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	srv := newServer(config.ServerConfig{LegacyRoutes: true, LegacySunset: "2027-06-30"})
+	if rec := get(srv, "/v1/builds/42"); rec.Code != http.StatusNoContent || rec.Header().Get("Deprecation") != "" {
+		t.Errorf("/v1 route: code %d, Deprecation %q", rec.Code, rec.Header().Get("Deprecation"))
+	}
+	rec := get(srv, "/builds/42")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("legacy route: code %d", rec.Code)
+	}
+	if rec.Header().Get("Deprecation") == "" {
+		t.Error("legacy route: missing Deprecation header")
+	}
+	if got, want := rec.Header().Get("Sunset"), "Wed, 30 Jun 2027 00:00:00 GMT"; got != want {
+		t.Errorf("Sunset = %q, want %q", got, want)
+	}
+	if got, want := rec.Header().Get("Link"), `</v1/builds/42>; rel="successor-version"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+
+	srv = newServer(config.ServerConfig{})
+	if rec := get(srv, "/builds/42"); rec.Code != http.StatusNotFound {
+		t.Errorf("legacy route with legacy_routes off: code %d, want 404", rec.Code)
+	}
+}
+
+// fakeConsumer serves Info; other methods are not used by the server.
+type fakeConsumer struct {
+	jetstream.Consumer
+	info *jetstream.ConsumerInfo
+	err  error
+}
+
+func (c *fakeConsumer) Info(context.Context) (*jetstream.ConsumerInfo, error) { return c.info, c.err }
+
+func TestServerReadyzLag(t *testing.T) {
+	readyz := func(consumer jetstream.Consumer) (int, readiness) {
+		srv := NewServer(ServerParams{
+			Config:    &config.Config{},
+			Logger:    zap.NewNop(),
+			Lifecycle: fxtest.NewLifecycle(t),
+			Consumer:  consumer,
+		})
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body readiness
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+
+	code, body := readyz(&fakeConsumer{info: &jetstream.ConsumerInfo{
+		NumPending: 12, NumAckPending: 3, NumRedelivered: 1, NumWaiting: 2,
+	}})
+	want := natspkg.ConsumerLag{Pending: 12, AckPending: 3, Redelivered: 1, Waiting: 2}
+	if code != http.StatusOK || body.NATS == nil || *body.NATS != want {
+		t.Errorf("/readyz = %d %+v, want 200 with lag %+v", code, body, want)
+	}
+
+	code, body = readyz(&fakeConsumer{err: errors.New("nats: timeout")})
+	if code != http.StatusOK || body.NATSError == "" || body.NATS != nil {
+		t.Errorf("/readyz with consumer error = %d %+v, want 200 with nats_error", code, body)
+	}
+}
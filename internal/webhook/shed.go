@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	metricspkg "github.com/jorgerua/build-system/container-build-service/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// maxRetryAfter caps the Retry-After of a shed webhook.
+const maxRetryAfter = 60 * time.Second
+
+// LoadShedder bounds the webhooks handled at once, so a burst of deliveries
+// (an organization-wide branch rename) queues briefly instead of exhausting
+// the server, and is shed with 503 and a Retry-After header once the queue
+// is full. GitHub does not redeliver on its own; senders that honor
+// Retry-After, or a redelivery, bring the webhook back.
+type LoadShedder struct {
+	slots    chan struct{}
+	maxQueue int64
+	wait     time.Duration
+	queued   atomic.Int64
+	shed     atomic.Int64
+	metrics  *metricspkg.WebhookMetrics
+	logger   *zap.Logger
+
+	mu  sync.Mutex
+	avg time.Duration // moving average of a webhook's handling time
+}
+
+// NewLoadShedder creates the LoadShedder of server.webhook_concurrency,
+// or nil when it is 0.
+func NewLoadShedder(cfg *config.Config, metrics *metricspkg.WebhookMetrics, logger *zap.Logger) *LoadShedder {
+	sc := cfg.Server
+	if sc.WebhookConcurrency == 0 {
+		return nil
+	}
+	return &LoadShedder{
+		slots:    make(chan struct{}, sc.WebhookConcurrency),
+		maxQueue: int64(sc.WebhookQueue),
+		wait:     time.Duration(sc.WebhookQueueSeconds) * time.Second,
+		metrics:  metrics,
+		logger:   logger.Named("shed"),
+	}
+}
+
+// Wrap admits requests to h within the concurrency bound, queueing or
+// shedding the rest.
+func (s *LoadShedder) Wrap(h http.Handler) http.Handler {
+	if s == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.acquire(w, r) {
+			return
+		}
+		defer func() { <-s.slots }()
+		start := time.Now()
+		h.ServeHTTP(w, r)
+		s.observe(time.Since(start))
+	})
+}
+
+// acquire takes a handling slot, waiting in the queue if there is room. It
+// writes the 503 and returns false when the request is shed.
+func (s *LoadShedder) acquire(w http.ResponseWriter, r *http.Request) bool {
+	select {
+	case s.slots <- struct{}{}:
+		s.metrics.Backlog(len(s.slots), int(s.queued.Load()))
+		return true
+	default:
+	}
+	queued := s.queued.Add(1)
+	defer s.queued.Add(-1)
+	s.metrics.Backlog(len(s.slots), int(queued))
+	if queued > s.maxQueue {
+		s.reject(w, "queue_full", queued)
+		return false
+	}
+	timer := time.NewTimer(s.wait)
+	defer timer.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		s.reject(w, "queue_timeout", s.queued.Load())
+		return false
+	case <-r.Context().Done():
+		return false // the sender gave up
+	}
+}
+
+// reject answers 503 with the time the queue ahead should take to drain.
+func (s *LoadShedder) reject(w http.ResponseWriter, reason string, queued int64) {
+	s.metrics.Shed(reason)
+	if n := s.shed.Add(1); n == 1 || n%100 == 0 {
+		s.logger.Warn("webhooks shed under load",
+			zap.String("reason", reason),
+			zap.Int64("queued", queued),
+			zap.Int64("shed", n),
+		)
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(s.retryAfter(queued)))
+	http.Error(w, "server busy, retry later", http.StatusServiceUnavailable)
+}
+
+// retryAfter estimates in seconds how long queued webhooks take to drain
+// through the handling slots, between 1 and maxRetryAfter.
+func (s *LoadShedder) retryAfter(queued int64) int {
+	s.mu.Lock()
+	avg := s.avg
+	s.mu.Unlock()
+	rounds := float64(queued)/float64(cap(s.slots)) + 1
+	secs := math.Ceil(rounds * avg.Seconds())
+	return int(min(max(secs, 1), maxRetryAfter.Seconds()))
+}
+
+// observe folds a webhook's handling time into the moving average.
+func (s *LoadShedder) observe(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.avg == 0 {
+		s.avg = d
+		return
+	}
+	s.avg += (d - s.avg) / 8
+}
@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	metricspkg "github.com/jorgerua/build-system/container-build-service/internal/metrics"
+	"go.uber.org/zap"
+)
+
+func newTestShedder(concurrency, queue, wait int) *LoadShedder {
+	cfg := &config.Config{Server: config.ServerConfig{WebhookConcurrency: concurrency, WebhookQueue: queue, WebhookQueueSeconds: wait}}
+	return NewLoadShedder(cfg, metricspkg.NewWebhookMetrics(&statsd.NoOpClient{}), zap.NewNop())
+}
+
+func TestLoadShedderBurst(t *testing.T) {
+	s := newTestShedder(2, 3, 30)
+	release := make(chan struct{})
+	h := s.Wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	const burst = 20
+	codes := make(chan *httptest.ResponseRecorder, burst)
+	var wg sync.WaitGroup
+	for range burst {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", nil))
+			codes <- rec
+		}()
+	}
+
+	// 2 handled and 3 queued: the other 15 are shed without waiting.
+	shed := 0
+	for shed < burst-5 {
+		select {
+		case rec := <-codes:
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("early response = %d, want 503", rec.Code)
+			}
+			if rec.Header().Get("Retry-After") == "" {
+				t.Error("503 without Retry-After")
+			}
+			shed++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d requests shed, want %d", shed, burst-5)
+		}
+	}
+	close(release)
+	wg.Wait()
+	close(codes)
+	accepted := 0
+	for rec := range codes {
+		if rec.Code == http.StatusAccepted {
+			accepted++
+		}
+	}
+	if accepted != 5 {
+		t.Errorf("accepted = %d, want 5", accepted)
+	}
+}
+
+func TestLoadShedderQueueTimeout(t *testing.T) {
+	s := newTestShedder(1, 10, 1)
+	release := make(chan struct{})
+	defer close(release)
+	h := s.Wrap(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { <-release }))
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook", nil))
+	for len(s.slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhook", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("code = %d, want 503 after waiting", rec.Code)
+	}
+}
+
+func TestLoadShedderRetryAfter(t *testing.T) {
+	s := newTestShedder(4, 100, 5)
+	if got := s.retryAfter(10); got != 1 {
+		t.Errorf("no observations: retryAfter = %d, want 1", got)
+	}
+	s.observe(2 * time.Second)
+	// 8 queued ahead of 4 slots: three rounds of 2s.
+	if got := s.retryAfter(8); got != 6 {
+		t.Errorf("retryAfter(8) = %d, want 6", got)
+	}
+	if got := s.retryAfter(1000); got != 60 {
+		t.Errorf("retryAfter(1000) = %d, want the 60s cap", got)
+	}
+	disabled := newTestShedder(0, 0, 0)
+	if disabled != nil {
+		t.Fatal("server.webhook_concurrency 0 should disable shedding")
+	}
+	if h := disabled.Wrap(http.NotFoundHandler()); h == nil {
+		t.Error("disabled shedder should pass requests through")
+	}
+}
@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/auth"
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	githubpkg "github.com/jorgerua/build-system/container-build-service/internal/github"
+	"github.com/jorgerua/build-system/container-build-service/internal/idempotency"
+	"github.com/jorgerua/build-system/container-build-service/internal/tidb"
+	"go.uber.org/zap"
+)
+
+// simulateRequest is the body of POST /webhook/simulate.
+type simulateRequest struct {
+	Repo   string `json:"repo"` // "owner/name"
+	Branch string `json:"branch"`
+	SHA    string `json:"sha"`
+	// Messages are the pushed commits' messages, oldest first; the last
+	// is the head commit's. Directives in them apply as in a real push.
+	Messages []string `json:"messages"`
+	// InstallationID is looked up from the GitHub App when 0.
+	InstallationID int64 `json:"installation_id"`
+}
+
+// defaultSimulatedMessage is the commit message of a simulated push
+// without messages.
+const defaultSimulatedMessage = "simulated push"
+
+// payload synthesizes the GitHub push delivery for the request.
+func (req simulateRequest) payload(installationID int64) (pushPayload, error) {
+	messages := req.Messages
+	if len(messages) == 0 {
+		messages = []string{defaultSimulatedMessage}
+	}
+	type commit struct {
+		ID      string `json:"id,omitempty"`
+		Message string `json:"message"`
+	}
+	commits := make([]commit, len(messages))
+	for i, m := range messages {
+		commits[i] = commit{Message: m}
+	}
+	head := commits[len(commits)-1]
+	head.ID = req.SHA
+	body, err := json.Marshal(map[string]any{
+		"ref":          "refs/heads/" + req.Branch,
+		"after":        req.SHA,
+		"repository":   map[string]string{"clone_url": "https://github.com/" + req.Repo + ".git", "full_name": req.Repo},
+		"installation": map[string]int64{"id": installationID},
+		"commits":      commits,
+		"head_commit":  head,
+	})
+	var p pushPayload
+	if err == nil {
+		err = json.Unmarshal(body, &p)
+	}
+	p.source = tidb.SkipSourceSimulated
+	return p, err
+}
+
+// NewSimulateRoute serves POST /webhook/simulate: handles a push of
+// {"repo", "branch", "sha", "messages", "installation_id"} as if GitHub
+// had delivered it, through the same branch filters, directives, freeze
+// and repository checks, so filters can be debugged and repositories
+// onboarded without pushing empty commits. The response is the webhook's:
+// 202 with the job when it is queued or held, 200 with the skip reason
+// otherwise. With an Idempotency-Key header, a retried request replays the
+// first response instead of queueing the commit again.
+func NewSimulateRoute(h *Handler, cfg *config.Config, httpClient *http.Client, keys *idempotency.Keys, authn *auth.Authenticator) Route {
+	hf := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req simulateRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		owner, name, ok := strings.Cut(req.Repo, "/")
+		switch {
+		case !ok || owner == "" || name == "" || strings.Contains(name, "/"):
+			http.Error(w, "repo must be owner/name", http.StatusBadRequest)
+			return
+		case req.Branch == "" || req.SHA == "":
+			http.Error(w, "branch and sha are required", http.StatusBadRequest)
+			return
+		}
+
+		installationID := req.InstallationID
+		if installationID == 0 {
+			id, err := lookupInstallation(r, cfg, httpClient, req.Repo)
+			if err != nil {
+				h.logger.Warn("simulated push installation lookup failed", zap.String("repo", req.Repo), zap.Error(err))
+				http.Error(w, "installation lookup failed; set installation_id", http.StatusBadRequest)
+				return
+			}
+			installationID = id
+		}
+
+		payload, err := req.payload(installationID)
+		if err != nil {
+			h.logger.Error("synthesize push failed", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		p, _ := auth.PrincipalFrom(r.Context())
+		h.logger.Info("simulated push",
+			zap.String("by", p.Subject),
+			zap.String("repo", req.Repo),
+			zap.String("branch", req.Branch),
+			zap.String("sha", req.SHA),
+		)
+		h.push(w, payload)
+	})
+	return Route{
+		Pattern: "POST /webhook/simulate",
+		Handler: authn.Require(auth.RoleTrigger, keys.Wrap(hf)),
+	}
+}
+
+// lookupInstallation returns the ID of the App's installation covering
+// repo.
+func lookupInstallation(r *http.Request, cfg *config.Config, httpClient *http.Client, repo string) (int64, error) {
+	client, err := githubpkg.NewClient(cfg, httpClient)
+	if err != nil {
+		return 0, err
+	}
+	return client.RepoInstallationID(r.Context(), repo)
+}
@@ -0,0 +1,52 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/jorgerua/build-system/container-build-service/internal/config"
+	natspkg "github.com/jorgerua/build-system/container-build-service/internal/nats"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// spoolDrainInterval is how often spooled jobs are retried.
+const spoolDrainInterval = 5 * time.Second
+
+// SpoolParams groups fx dependencies for the webhook spool.
+type SpoolParams struct {
+	fx.In
+	Config    *config.Config
+	Publisher *natspkg.Publisher
+	Link      *natspkg.Link `optional:"true"`
+	Logger    *zap.Logger
+	Lifecycle fx.Lifecycle
+}
+
+// NewSpool opens the build job spool configured by server.spool_dir and
+// drains it in the background, or returns nil when spooling is disabled.
+func NewSpool(p SpoolParams) (*natspkg.Spool, error) {
+	dir := p.Config.Server.SpoolDir
+	if dir == "" {
+		return nil, nil
+	}
+	spool, err := natspkg.NewSpool(dir, p.Publisher, p.Link)
+	if err != nil {
+		return nil, err
+	}
+	if n := spool.Pending(); n > 0 {
+		p.Logger.Info("build jobs left in spool", zap.String("dir", dir), zap.Int("pending", n))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go spool.Run(ctx, spoolDrainInterval, p.Logger)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+	return spool, nil
+}